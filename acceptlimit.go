@@ -0,0 +1,116 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andeya/erpc/v7/socket"
+)
+
+var (
+	statTooManyConnections = NewStatus(CodeServiceUnavailable, CodeText(CodeServiceUnavailable), "too many connections")
+	statAcceptRateLimited  = NewStatus(CodeServiceUnavailable, CodeText(CodeServiceUnavailable), "connection rate limit exceeded")
+)
+
+// acceptLimiter limits the connections accepted by the listeners,
+// by the number of the connections at the same time and the accepting rate.
+type acceptLimiter struct {
+	maxConns   int64 // atomic
+	conns      int64
+	withStatus int32 // atomic
+	mu         sync.Mutex
+	rate       float64
+	tokens     float64
+	last       time.Time
+}
+
+func newAcceptLimiter(cfg *PeerConfig) *acceptLimiter {
+	l := &acceptLimiter{last: time.Now()}
+	l.set(cfg)
+	return l
+}
+
+// set sets the limits of the config at runtime, keeping the number of the accepted connections.
+func (l *acceptLimiter) set(cfg *PeerConfig) {
+	atomic.StoreInt64(&l.maxConns, int64(cfg.MaxConnections))
+	atomic.StoreInt32(&l.withStatus, boolToInt32(cfg.RejectWithStatus))
+	rate := float64(cfg.AcceptRateLimit)
+	if rate < 0 {
+		rate = 0
+	}
+	l.mu.Lock()
+	if l.rate != rate {
+		l.rate, l.tokens, l.last = rate, rate, time.Now()
+	}
+	l.mu.Unlock()
+}
+
+// acquire returns the rejection status if the connection exceeds the limits,
+// otherwise the caller must call release after the connection is closed.
+func (l *acceptLimiter) acquire() *Status {
+	l.mu.Lock()
+	if l.rate > 0 {
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.rate {
+			l.tokens = l.rate
+		}
+		l.last = now
+		ok := l.tokens >= 1
+		if ok {
+			l.tokens--
+		}
+		if !ok {
+			l.mu.Unlock()
+			return statAcceptRateLimited
+		}
+	}
+	l.mu.Unlock()
+	// the connections are counted even without the limit, which can be set at runtime
+	conns := atomic.AddInt64(&l.conns, 1)
+	if maxConns := atomic.LoadInt64(&l.maxConns); maxConns > 0 && conns > maxConns {
+		atomic.AddInt64(&l.conns, -1)
+		return statTooManyConnections
+	}
+	return nil
+}
+
+func (l *acceptLimiter) release() {
+	atomic.AddInt64(&l.conns, -1)
+}
+
+// reject closes the rejected connection,
+// and pushes the busy notice before it if RejectWithStatus is true.
+func (l *acceptLimiter) reject(conn net.Conn, stat *Status, protoFunc ...ProtoFunc) {
+	Warnf("reject connection from %s: %s", conn.RemoteAddr().String(), stat.Cause())
+	if atomic.LoadInt32(&l.withStatus) == 0 {
+		conn.Close()
+		return
+	}
+	s := socket.NewSocket(conn, protoFunc...)
+	msg := socket.GetMessage(
+		socket.WithServiceMethod(BusyServiceMethod),
+		socket.WithStatus(stat),
+	)
+	msg.SetMtype(TypePush)
+	conn.SetDeadline(time.Now().Add(time.Second))
+	s.WriteMessage(msg)
+	socket.PutMessage(msg)
+	s.Close()
+}
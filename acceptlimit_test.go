@@ -0,0 +1,81 @@
+package erpc_test
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaxConnections(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{
+		ListenPort:       9105,
+		MaxConnections:   1,
+		RejectWithStatus: true,
+	})
+	srv.RouteCallFunc(batch_call)
+	go srv.ListenAndServe()
+	defer srv.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess1, stat := cli.Dial(":9105")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	time.Sleep(100 * time.Millisecond)
+	sess2, stat := cli.Dial(":9105")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	select {
+	case <-sess2.CloseNotify():
+	case <-time.After(3 * time.Second):
+		t.Fatal("the connection exceeding MaxConnections is not rejected")
+	}
+	var result int
+	if stat = sess1.Call("/batch/call", 1, &result).Status(); !stat.OK() || result != 2 {
+		t.Fatalf("result: %d, stat: %v", result, stat)
+	}
+
+	// the released connection can be reused
+	sess1.Close()
+	time.Sleep(100 * time.Millisecond)
+	sess3, stat := cli.Dial(":9105")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	if stat = sess3.Call("/batch/call", 2, &result).Status(); !stat.OK() || result != 4 {
+		t.Fatalf("result: %d, stat: %v", result, stat)
+	}
+}
+
+func TestAcceptRateLimit(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{
+		ListenPort:      9106,
+		AcceptRateLimit: 2,
+	})
+	go srv.ListenAndServe()
+	defer srv.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	var sessions []erpc.Session
+	for i := 0; i < 4; i++ {
+		sess, stat := cli.Dial(":9106")
+		if !stat.OK() {
+			t.Fatal(stat)
+		}
+		sessions = append(sessions, sess)
+	}
+	time.Sleep(200 * time.Millisecond)
+	var rejected int
+	for _, sess := range sessions {
+		if !sess.Health() {
+			rejected++
+		}
+	}
+	if rejected != 2 {
+		t.Fatalf("rejected: expect 2, got %d", rejected)
+	}
+}
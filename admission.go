@@ -0,0 +1,169 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/andeya/erpc/v7/utils"
+	"github.com/andeya/goutil"
+)
+
+// MetaRetryAfter the key of the duration after which the shed CALL can be retried, e.g. "100ms"
+const MetaRetryAfter = "X-Retry-After"
+
+// GetRetryAfter gets the duration after which the shed CALL can be retried, from the reply metadata.
+func GetRetryAfter(meta *utils.Args) (time.Duration, bool) {
+	s := meta.Peek(MetaRetryAfter)
+	if len(s) == 0 {
+		return 0, false
+	}
+	d, err := time.ParseDuration(goutil.BytesToString(s))
+	if err != nil || d < 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// admissionQueue queues the messages when the global goroutine pool is saturated,
+// and sheds the ones over the queue length or waiting longer than the max queueing delay.
+type admissionQueue struct {
+	ch       chan admission
+	maxQueue int64
+	maxDelay time.Duration
+	goFunc   func(func()) bool // tries to run the function in the global goroutine pool
+	queued   int64
+	shed     uint64
+	closeCh  chan struct{}
+	doneCh   chan struct{}
+}
+
+type admission struct {
+	ctx      *handlerCtx
+	fn       func()
+	queuedAt time.Time
+}
+
+// newAdmissionQueue returns nil if the queue is disabled.
+func newAdmissionQueue(maxQueue int, maxDelay time.Duration) *admissionQueue {
+	if maxQueue <= 0 {
+		return nil
+	}
+	q := &admissionQueue{
+		ch:       make(chan admission, maxQueue),
+		maxQueue: int64(maxQueue),
+		maxDelay: maxDelay,
+		goFunc:   func(fn func()) bool { return _gopool.Go(fn) == nil },
+		closeCh:  make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// submit runs fn in the global goroutine pool, or queues it if the pool is saturated.
+// NOTE: The shed message is handled with CodeServiceUnavailable, i.e. the CALL is replied without the handler.
+func (q *admissionQueue) submit(ctx *handlerCtx, fn func()) bool {
+	if q.goFunc(fn) {
+		return true
+	}
+	select {
+	case <-q.closeCh:
+		q.shedding(ctx, "peer is closed")
+		TryGo(fn)
+		return true
+	default:
+	}
+	// NOTE: the one being admitted is also counted, so the queue length is exact
+	if atomic.AddInt64(&q.queued, 1) > q.maxQueue {
+		atomic.AddInt64(&q.queued, -1)
+		q.shedding(ctx, "admission queue is full")
+		TryGo(fn)
+		return true
+	}
+	q.ch <- admission{ctx: ctx, fn: fn, queuedAt: time.Now()}
+	return true
+}
+
+func (q *admissionQueue) run() {
+	defer close(q.doneCh)
+	for {
+		select {
+		case a := <-q.ch:
+			q.admit(a)
+		case <-q.closeCh:
+			// shed the rest, their contexts are waited by the graceful shutdown
+			for {
+				select {
+				case a := <-q.ch:
+					atomic.AddInt64(&q.queued, -1)
+					q.shedding(a.ctx, "peer is closed")
+					TryGo(a.fn)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// admit waits for an idle goroutine of the pool, until the max queueing delay.
+func (q *admissionQueue) admit(a admission) {
+	defer atomic.AddInt64(&q.queued, -1)
+	for {
+		if q.maxDelay > 0 && time.Since(a.queuedAt) > q.maxDelay {
+			q.shedding(a.ctx, "queueing delay exceeds "+q.maxDelay.String())
+			TryGo(a.fn)
+			return
+		}
+		if q.goFunc(a.fn) {
+			return
+		}
+		select {
+		case <-q.closeCh:
+			q.shedding(a.ctx, "peer is closed")
+			TryGo(a.fn)
+			return
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+// shedding marks the CALL or PUSH to be handled with CodeServiceUnavailable,
+// NOTE: the REPLY is never shed, since its call is waiting for it.
+func (q *admissionQueue) shedding(ctx *handlerCtx, cause string) {
+	if mtype := ctx.input.Mtype(); mtype != TypeCall && mtype != TypePush {
+		return
+	}
+	atomic.AddUint64(&q.shed, 1)
+	if ctx.stat.OK() {
+		ctx.stat = statServiceUnavailable.Copy(cause)
+	}
+	retryAfter := q.maxDelay
+	if retryAfter <= 0 {
+		retryAfter = 100 * time.Millisecond
+	}
+	ctx.output.Meta().Set(MetaRetryAfter, retryAfter.String())
+}
+
+func (q *admissionQueue) len() int64 {
+	return atomic.LoadInt64(&q.queued)
+}
+
+func (q *admissionQueue) stop() {
+	close(q.closeCh)
+	<-q.doneCh
+}
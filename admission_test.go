@@ -0,0 +1,72 @@
+package erpc
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func admission_slow(ctx CallCtx, arg *int) (int, *Status) {
+	time.Sleep(300 * time.Millisecond)
+	return *arg, nil
+}
+
+func TestAdmissionQueue(t *testing.T) {
+	srv := NewPeer(PeerConfig{AdmissionQueue: 2, MaxQueueDelay: 200 * time.Millisecond})
+	defer srv.Close()
+	// the saturated pool of one goroutine
+	sem := make(chan struct{}, 1)
+	srv.(*peer).admission.goFunc = func(fn func()) bool {
+		select {
+		case sem <- struct{}{}:
+			go func() {
+				defer func() { <-sem }()
+				fn()
+			}()
+			return true
+		default:
+			return false
+		}
+	}
+	srv.RouteCallFunc(admission_slow)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	time.Sleep(100 * time.Millisecond)
+	cli := NewPeer(PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+
+	// the 1st is handled, the 2nd and 3rd are queued and expire, the 4th is shed by the full queue
+	var cmds []CallCmd
+	for i := 0; i < 4; i++ {
+		cmds = append(cmds, sess.AsyncCall("/admission/slow", i, new(int), make(chan CallCmd, 1)))
+		time.Sleep(20 * time.Millisecond)
+	}
+	if n := srv.Stats().AdmissionQueue; n != 2 {
+		t.Fatalf("admission queue: %d, expect 2", n)
+	}
+	for i, cmd := range cmds {
+		<-cmd.Done()
+		if i == 0 {
+			if !cmd.StatusOK() {
+				t.Fatal(cmd.Status())
+			}
+			continue
+		}
+		if cmd.Status().Code() != CodeServiceUnavailable {
+			t.Fatalf("call %d: expect shed, got %v", i, cmd.Status())
+		}
+		if d, ok := GetRetryAfter(cmd.InputMeta()); !ok || d != 200*time.Millisecond {
+			t.Fatalf("call %d: retry after %v, %v", i, d, ok)
+		}
+	}
+	if st := srv.Stats(); st.Shed != 3 || st.AdmissionQueue != 0 {
+		t.Fatalf("shed: %d, admission queue: %d", st.Shed, st.AdmissionQueue)
+	}
+}
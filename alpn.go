@@ -0,0 +1,90 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+)
+
+// alpnProtos the ProtoFuncs selected by the TLS ALPN protocol.
+type alpnProtos struct {
+	mu    sync.RWMutex
+	names []string // in order of preference
+	funcs map[string]ProtoFunc
+}
+
+// RegisterALPN registers the ProtoFunc used for the TLS connections
+// that negotiated the ALPN protocol, e.g. "erpc-raw", "erpc-json".
+// NOTE:
+//  The protocols are advertised in order of registration, as the preference;
+//  The connections without negotiated protocol use the ProtoFunc passed in as usual;
+//  For server role, it must be called before listening.
+func (p *peer) RegisterALPN(protocol string, protoFunc ProtoFunc) {
+	a := &p.alpn
+	a.mu.Lock()
+	if a.funcs == nil {
+		a.funcs = make(map[string]ProtoFunc)
+	}
+	if _, ok := a.funcs[protocol]; !ok {
+		a.names = append(a.names, protocol)
+	}
+	a.funcs[protocol] = protoFunc
+	a.mu.Unlock()
+	if p.dialer.tlsConfig != nil {
+		p.dialer.tlsConfig = p.withALPN(p.dialer.tlsConfig)
+	}
+}
+
+// withALPN returns a copy of the TLS config advertising the registered protocols.
+func (p *peer) withALPN(tlsConfig *tls.Config) *tls.Config {
+	a := &p.alpn
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if tlsConfig == nil || len(a.names) == 0 {
+		return tlsConfig
+	}
+	cfg := tlsConfig.Clone()
+	nextProtos := append([]string{}, a.names...)
+	for _, name := range cfg.NextProtos {
+		if _, ok := a.funcs[name]; !ok {
+			nextProtos = append(nextProtos, name)
+		}
+	}
+	cfg.NextProtos = nextProtos
+	return cfg
+}
+
+// selectALPN returns the ProtoFunc of the negotiated protocol if the connection is TLS,
+// otherwise returns the passed one.
+// NOTE: The TLS handshake must be completed.
+func (p *peer) selectALPN(conn net.Conn, protoFunc []ProtoFunc) []ProtoFunc {
+	c, ok := conn.(*tls.Conn)
+	if !ok {
+		return protoFunc
+	}
+	protocol := c.ConnectionState().NegotiatedProtocol
+	if protocol == "" {
+		return protoFunc
+	}
+	p.alpn.mu.RLock()
+	fn, ok := p.alpn.funcs[protocol]
+	p.alpn.mu.RUnlock()
+	if !ok {
+		return protoFunc
+	}
+	return []ProtoFunc{fn}
+}
@@ -0,0 +1,67 @@
+package erpc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7/proto/jsonproto"
+)
+
+// listenAddrPlugin captures the listening address.
+type listenAddrPlugin chan net.Addr
+
+func (listenAddrPlugin) Name() string { return "listen_addr" }
+
+func (p listenAddrPlugin) PostListen(addr net.Addr) error {
+	p <- addr
+	return nil
+}
+
+func TestALPN(t *testing.T) {
+	addrCh := make(listenAddrPlugin, 1)
+	srv := erpc.NewPeer(erpc.PeerConfig{}, addrCh)
+	srv.SetTLSConfig(erpc.GenerateTLSConfigForServer())
+	srv.RegisterALPN("erpc-json", jsonproto.NewJSONProtoFunc())
+	srv.RouteCallFunc(batch_call)
+	go srv.ListenAndServe()
+	defer srv.Close()
+	var addr string
+	select {
+	case a := <-addrCh:
+		_, port, _ := net.SplitHostPort(a.String())
+		addr = "127.0.0.1:" + port
+	case <-time.After(3 * time.Second):
+		t.Fatal("listen timeout")
+	}
+
+	var result int
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	cli.SetTLSConfig(erpc.GenerateTLSConfigForClient())
+	cli.RegisterALPN("erpc-json", jsonproto.NewJSONProtoFunc())
+	sess, stat := cli.Dial(addr)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	if stat = sess.Call("/batch/call", 1, &result).Status(); !stat.OK() || result != 2 {
+		t.Fatalf("result: %d, stat: %v", result, stat)
+	}
+
+	// the server uses the JSON protocol, but the client does not
+	tlsConfig := erpc.GenerateTLSConfigForClient()
+	tlsConfig.NextProtos = []string{"erpc-json"}
+	cli2 := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli2.Close()
+	cli2.SetTLSConfig(tlsConfig)
+	sess, stat = cli2.Dial(addr)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if stat = sess.AsyncCall("/batch/call", 1, &result, nil).Wait(ctx); stat.OK() {
+		t.Fatal("mismatched protocol: expect error!")
+	}
+}
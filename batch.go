@@ -0,0 +1,266 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/andeya/erpc/v7/codec"
+	"github.com/andeya/erpc/v7/socket"
+	"github.com/andeya/erpc/v7/utils"
+	"github.com/andeya/goutil"
+)
+
+// batchEntry a call or reply of the batch body.
+type batchEntry struct {
+	serviceMethod string
+	status        []byte // urlencoded status, only for reply
+	meta          []byte // urlencoded metadata
+	bodyCodec     byte
+	body          []byte
+}
+
+var errBadBatch = errors.New("bad batch body")
+
+// encodeBatch encodes the entries:
+// {uvarint count}{{uvarint len}{service method}{uvarint len}{status}{uvarint len}{meta}{1 byte body codec}{uvarint len}{body}}...
+func encodeBatch(entries []batchEntry) []byte {
+	b := appendUvarint(nil, uint64(len(entries)))
+	for _, e := range entries {
+		b = appendBatchField(b, goutil.StringToBytes(e.serviceMethod))
+		b = appendBatchField(b, e.status)
+		b = appendBatchField(b, e.meta)
+		b = append(b, e.bodyCodec)
+		b = appendBatchField(b, e.body)
+	}
+	return b
+}
+
+func appendBatchField(b, field []byte) []byte {
+	b = appendUvarint(b, uint64(len(field)))
+	return append(b, field...)
+}
+
+func appendUvarint(b []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], x)]...)
+}
+
+func decodeBatch(b []byte) ([]batchEntry, error) {
+	n, i := binary.Uvarint(b)
+	if i <= 0 || n > uint64(len(b)) {
+		return nil, errBadBatch
+	}
+	b = b[i:]
+	var (
+		entries = make([]batchEntry, n)
+		field   []byte
+		ok      bool
+	)
+	for k := range entries {
+		e := &entries[k]
+		if field, b, ok = readBatchField(b); !ok {
+			return nil, errBadBatch
+		}
+		e.serviceMethod = string(field)
+		if e.status, b, ok = readBatchField(b); !ok {
+			return nil, errBadBatch
+		}
+		if e.meta, b, ok = readBatchField(b); !ok || len(b) == 0 {
+			return nil, errBadBatch
+		}
+		e.bodyCodec, b = b[0], b[1:]
+		if e.body, b, ok = readBatchField(b); !ok {
+			return nil, errBadBatch
+		}
+	}
+	if len(b) != 0 {
+		return nil, errBadBatch
+	}
+	return entries, nil
+}
+
+func readBatchField(b []byte) (field, rest []byte, ok bool) {
+	n, i := binary.Uvarint(b)
+	if i <= 0 || n > uint64(len(b)-i) {
+		return nil, nil, false
+	}
+	return b[i : i+int(n)], b[i+int(n):], true
+}
+
+// CallBatch frames the calls into one CALL of BatchServiceMethod, and sends it in a single round trip,
+// then decodes the replies positionally, and returns the call commands in the order of the items.
+// NOTE:
+// The setting is applied to the batch call, and the item's setting is applied to the item only,
+// e.g. its body codec and metadata;
+// Each item fails or succeeds independently, check the status of each call command;
+// The remote peer handles the items in order, in the goroutine of the batch call,
+// regardless of the handler pools.
+func (s *session) CallBatch(items []BatchItem, setting ...MessageSetting) []CallCmd {
+	var (
+		callCmds = make([]CallCmd, len(items))
+		entries  = make([]batchEntry, 0, len(items))
+		indexes  = make([]int, 0, len(items))
+	)
+	for i, item := range items {
+		m := socket.NewMessage()
+		m.SetServiceMethod(item.ServiceMethod)
+		m.SetBody(item.Arg)
+		for _, fn := range item.Setting {
+			if fn != nil {
+				fn(m)
+			}
+		}
+		if m.BodyCodec() == codec.NilCodecID {
+			m.SetBodyCodec(s.DefaultBodyCodec())
+		}
+		body, err := m.MarshalBody()
+		if err != nil {
+			callCmds[i] = NewFakeCallCmd(item.ServiceMethod, item.Arg, item.Result, statBadMessage.Copy(err))
+			continue
+		}
+		entries = append(entries, batchEntry{
+			serviceMethod: m.ServiceMethod(),
+			meta:          append([]byte(nil), m.Meta().QueryString()...),
+			bodyCodec:     m.BodyCodec(),
+			body:          body,
+		})
+		indexes = append(indexes, i)
+	}
+	if len(entries) == 0 {
+		return callCmds
+	}
+
+	var reply []byte
+	setting = append(append([]MessageSetting(nil), setting...), WithBodyCodec(codec.ID_PLAIN))
+	stat := s.Call(BatchServiceMethod, encodeBatch(entries), &reply, setting...).Status()
+	var replies []batchEntry
+	if stat.OK() {
+		var err error
+		if replies, err = decodeBatch(reply); err == nil && len(replies) != len(entries) {
+			err = errBadBatch
+		}
+		if err != nil {
+			stat = statBadMessage.Copy(err)
+		}
+	}
+	for k, i := range indexes {
+		item := items[i]
+		if !stat.OK() {
+			callCmds[i] = NewFakeCallCmd(item.ServiceMethod, item.Arg, item.Result, stat)
+			continue
+		}
+		r := replies[k]
+		itemStat := new(Status)
+		itemStat.DecodeQuery(r.status)
+		if itemStat.OK() && item.Result != nil && len(r.body) > 0 {
+			if err := codec.Unmarshal(r.bodyCodec, r.body, item.Result); err != nil {
+				itemStat = statBadMessage.Copy(err)
+			}
+		}
+		inputMeta := utils.AcquireArgs()
+		inputMeta.ParseBytes(r.meta)
+		callCmds[i] = &batchCallCmd{
+			CallCmd:        NewFakeCallCmd(item.ServiceMethod, item.Arg, item.Result, itemStat),
+			inputMeta:      inputMeta,
+			inputBodyCodec: r.bodyCodec,
+		}
+	}
+	return callCmds
+}
+
+// batchCallCmd the call command of the batch item.
+type batchCallCmd struct {
+	CallCmd
+	inputMeta      *utils.Args
+	inputBodyCodec byte
+}
+
+// InputBodyCodec gets the body codec type of the item reply.
+func (c *batchCallCmd) InputBodyCodec() byte {
+	return c.inputBodyCodec
+}
+
+// InputMeta returns the metadata of the item reply.
+func (c *batchCallCmd) InputMeta() *utils.Args {
+	return c.inputMeta
+}
+
+// handleBatchFunc is set in init, to break the initialization cycle of the context pool.
+var handleBatchFunc func(*handlerCtx)
+
+func init() {
+	handleBatchFunc = handleBatch
+}
+
+// newBatchHandler creates the handler of the batch call.
+func newBatchHandler(pluginContainer *PluginContainer) *Handler {
+	return &Handler{
+		name:              BatchServiceMethod,
+		isUnknown:         true,
+		unknownHandleFunc: handleBatchFunc,
+		pluginContainer:   pluginContainer,
+	}
+}
+
+// handleBatch handles the items of the batch call in order by their handlers,
+// and replies them in one message.
+func handleBatch(c *handlerCtx) {
+	entries, err := decodeBatch(*c.input.Body().(*[]byte))
+	if err != nil {
+		c.stat = statBadMessage.Copy(err)
+		return
+	}
+	replies := make([]batchEntry, len(entries))
+	for i, e := range entries {
+		replies[i] = c.handleBatchEntry(e)
+	}
+	c.output.SetBody(encodeBatch(replies))
+	c.output.SetBodyCodec(codec.ID_PLAIN)
+}
+
+// handleBatchEntry handles the item as a call, and captures its reply.
+func (c *handlerCtx) handleBatchEntry(e batchEntry) (r batchEntry) {
+	// not replied if the batch call is canceled
+	r.status = statCallCanceled.EncodeQuery()
+	sub := c.sess.peer.getContext(c.sess, false)
+	defer c.sess.peer.putContext(sub, false)
+	sub.batchReply = func(m Message) *Status {
+		body, err := m.MarshalBody()
+		if err != nil {
+			return statInternalServerError.Copy(err)
+		}
+		r = batchEntry{
+			status:    append([]byte(nil), m.Status(true).EncodeQuery()...),
+			meta:      append([]byte(nil), m.Meta().QueryString()...),
+			bodyCodec: m.BodyCodec(),
+			body:      body,
+		}
+		return nil
+	}
+	sub.input.SetMtype(TypeCall)
+	sub.input.SetSeq(c.input.Seq())
+	sub.input.SetServiceMethod(e.serviceMethod)
+	sub.input.Meta().ParseBytes(e.meta)
+	sub.input.SetBodyCodec(e.bodyCodec)
+	socket.WithContext(c.input.Context())(sub.input)
+	// binds the handler by the new body function, as reading the message
+	if err := sub.input.UnmarshalBody(e.body); err != nil && sub.stat.OK() {
+		sub.stat = statBadMessage.Copy(err)
+	}
+	sub.handleCall()
+	return r
+}
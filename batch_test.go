@@ -0,0 +1,55 @@
+package erpc_test
+
+import (
+	"testing"
+	"time"
+)
+
+func batch_call(_ erpc.CallCtx, arg *int) (int, *erpc.Status) {
+	if *arg < 0 {
+		return 0, erpc.NewStatus(1001, "negative", "")
+	}
+	return *arg * 2, nil
+}
+
+func TestCallBatch(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{ListenPort: 9101})
+	srv.RouteCallFunc(batch_call)
+	go srv.ListenAndServe()
+	defer srv.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(":9101")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	results := make([]int, 4)
+	items := []erpc.BatchItem{
+		{ServiceMethod: "/batch/call", Arg: 1, Result: &results[0]},
+		{ServiceMethod: "/batch/call", Arg: -1, Result: &results[1]},
+		{ServiceMethod: "/batch/call", Arg: 3, Result: &results[2], Setting: []erpc.MessageSetting{erpc.WithBodyCodec('j')}},
+		{ServiceMethod: "/batch/none", Arg: 4, Result: &results[3]},
+	}
+	callCmds := sess.CallBatch(items)
+	if len(callCmds) != len(items) {
+		t.Fatalf("got %d call commands", len(callCmds))
+	}
+	if !callCmds[0].StatusOK() || results[0] != 2 {
+		t.Fatalf("item 0: %v, %d", callCmds[0].Status(), results[0])
+	}
+	if callCmds[1].Status().Code() != 1001 {
+		t.Fatalf("item 1: %v", callCmds[1].Status())
+	}
+	if !callCmds[2].StatusOK() || results[2] != 6 || callCmds[2].InputBodyCodec() != 'j' {
+		t.Fatalf("item 2: %v, %d", callCmds[2].Status(), results[2])
+	}
+	if callCmds[3].Status().Code() != erpc.CodeNotFound {
+		t.Fatalf("item 3: %v", callCmds[3].Status())
+	}
+	// the items are sent in one call
+	if n := sess.Stats().CallsSent; n != 1 {
+		t.Fatalf("sent %d calls", n)
+	}
+}
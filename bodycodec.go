@@ -0,0 +1,66 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+const (
+	// CodecServiceMethod the service method of the default body codec negotiation,
+	// it is a PUSH handled by the framework, and the old peer not supporting it logs it as the unknown PUSH.
+	CodecServiceMethod = "/erpc/codec"
+	// MetaCodecSyn the key of the body codec name proposed by the client
+	MetaCodecSyn = "X-Codec-Syn"
+	// MetaCodecAck the key of the body codec name confirmed by the server
+	MetaCodecAck = "X-Codec-Ack"
+)
+
+// negotiateCodec proposes the default body codec of the peer to the server.
+func (s *session) negotiateCodec() {
+	if !s.peer.negotiateCodec {
+		return
+	}
+	c, err := s.peer.codecs.Get(s.peer.defaultBodyCodec)
+	if err != nil {
+		return
+	}
+	if stat := s.RawPush(CodecServiceMethod, nil, WithSetMeta(MetaCodecSyn, c.Name()), s.withTime()); !stat.OK() {
+		Debugf("negotiate body codec: %s", stat.String())
+	}
+}
+
+// handleCodec handles the default body codec negotiation.
+// NOTE: The server confirms the proposed codec if supported, otherwise its own default one.
+func (s *session) handleCodec(header Header) {
+	if !s.peer.negotiateCodec {
+		return
+	}
+	if name := header.Meta().Peek(MetaCodecSyn); len(name) > 0 {
+		c, err := s.peer.codecs.GetByName(string(name))
+		if err != nil {
+			if c, err = s.peer.codecs.Get(s.peer.defaultBodyCodec); err != nil {
+				return
+			}
+		}
+		s.SetDefaultBodyCodec(c.ID())
+		if stat := s.RawPush(CodecServiceMethod, nil, WithSetMeta(MetaCodecAck, c.Name()), s.withTimeEcho(header)); !stat.OK() {
+			Debugf("confirm body codec: %s", stat.String())
+		}
+		return
+	}
+	if name := header.Meta().Peek(MetaCodecAck); len(name) > 0 {
+		s.observeSkew(header)
+		if c, err := s.peer.codecs.GetByName(string(name)); err == nil {
+			s.SetDefaultBodyCodec(c.ID())
+		}
+	}
+}
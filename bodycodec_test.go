@@ -0,0 +1,67 @@
+package erpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7/codec"
+)
+
+var codecPushed = make(chan byte, 4)
+
+func codec_push(ctx PushCtx, arg *string) *Status {
+	codecPushed <- ctx.GetBodyCodec()
+	return nil
+}
+
+func TestNegotiateCodec(t *testing.T) {
+	srv := NewPeer(PeerConfig{ListenPort: 9128, NegotiateCodec: true})
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+
+	plainCli := NewPeer(PeerConfig{DefaultBodyCodec: codec.NAME_PLAIN, NegotiateCodec: true})
+	defer plainCli.Close()
+	plainCli.RoutePushFunc(codec_push)
+	plainSess, stat := plainCli.Dial(":9128")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	jsonCli := NewPeer(PeerConfig{DefaultBodyCodec: codec.NAME_PLAIN})
+	defer jsonCli.Close()
+	jsonCli.RoutePushFunc(codec_push)
+	jsonSess, stat := jsonCli.Dial(":9128")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	for _, c := range []struct {
+		sess  Session
+		codec byte
+	}{
+		{plainSess, codec.ID_PLAIN},
+		{jsonSess, codec.ID_JSON},
+	} {
+		srvSess, ok := srv.GetSession(c.sess.LocalAddr().String())
+		if !ok {
+			t.Fatal("the server session is not found")
+		}
+		if id := srvSess.DefaultBodyCodec(); id != c.codec {
+			t.Fatalf("server codec: %q, expect %q", id, c.codec)
+		}
+		if stat = srvSess.Push("/codec/push", "hello"); !stat.OK() {
+			t.Fatal(stat)
+		}
+		if id := <-codecPushed; id != c.codec {
+			t.Fatalf("pushed codec: %q, expect %q", id, c.codec)
+		}
+	}
+	// the client is confirmed
+	if id := plainSess.DefaultBodyCodec(); id != codec.ID_PLAIN {
+		t.Fatalf("client codec: %q", id)
+	}
+	if err := plainSess.SetDefaultBodyCodec(0xfe); err == nil {
+		t.Fatal("expect the error of the unknown codec")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"reflect"
+	"sync"
+)
+
+// BodyReleaser the opt-in contract of reusing the bodies by the pool, to reduce the allocations per call.
+// NOTE:
+//  If the arg pointer type of a handler implements it, the arg is got from the pool,
+//  and released and put back after handling, so the handler and plugins must not hold it after returning;
+//  If the reply of a call handler implements it, ReleaseBody is called after the reply is written,
+//  e.g. to put it back to the pool owned by the handler.
+type BodyReleaser interface {
+	// ReleaseBody resets the body before it is reused.
+	ReleaseBody()
+}
+
+var (
+	bodyReleaserType = reflect.TypeOf((*BodyReleaser)(nil)).Elem()
+	// argPools reflect.Type of the arg elem -> *sync.Pool, nil if not implemented BodyReleaser
+	argPools sync.Map
+)
+
+func getArgPool(argElem reflect.Type) *sync.Pool {
+	if p, ok := argPools.Load(argElem); ok {
+		return p.(*sync.Pool)
+	}
+	var pool *sync.Pool
+	if reflect.PtrTo(argElem).Implements(bodyReleaserType) {
+		pool = &sync.Pool{
+			New: func() interface{} {
+				return reflect.New(argElem).Interface()
+			},
+		}
+	}
+	p, _ := argPools.LoadOrStore(argElem, pool)
+	return p.(*sync.Pool)
+}
+
+// releaseArgValue puts the arg value back to the pool, if it implements BodyReleaser.
+func (h *Handler) releaseArgValue(arg reflect.Value) {
+	if !arg.IsValid() || h.argElem == nil {
+		return
+	}
+	pool := getArgPool(h.argElem)
+	if pool == nil {
+		return
+	}
+	body := arg.Interface()
+	body.(BodyReleaser).ReleaseBody()
+	pool.Put(body)
+}
+
+// releaseBody releases the opt-in reusable arg and reply bodies, after the call or push is handled.
+func (c *handlerCtx) releaseBody() {
+	if c.handler == nil {
+		return
+	}
+	// NOTE: the reply may be the arg itself, so release it before the arg is put back.
+	if c.input.Mtype() == TypeCall {
+		if r, ok := c.output.Body().(BodyReleaser); ok {
+			r.ReleaseBody()
+		}
+	}
+	c.handler.releaseArgValue(c.arg)
+	c.arg = emptyValue
+}
@@ -0,0 +1,78 @@
+package erpc_test
+
+import (
+	"testing"
+)
+
+type (
+	// PlainBody the arg not reused.
+	PlainBody struct {
+		A string
+		B []int
+	}
+	// PooledBody the arg reused by the pool.
+	PooledBody struct {
+		A string
+		B []int
+	}
+	bodyHome struct {
+		erpc.CallCtx
+	}
+)
+
+// ReleaseBody implements erpc.BodyReleaser.
+func (b *PooledBody) ReleaseBody() {
+	b.A = ""
+	b.B = b.B[:0]
+}
+
+func (h *bodyHome) Plain(arg *PlainBody) (*PlainBody, *erpc.Status) {
+	return arg, nil
+}
+
+func (h *bodyHome) Pooled(arg *PooledBody) (*PooledBody, *erpc.Status) {
+	if arg.A == "" || len(arg.B) != 3 {
+		return nil, erpc.NewStatus(400, "stale body", arg)
+	}
+	return arg, nil
+}
+
+func TestBodyReleaser(t *testing.T) {
+	srv, cli, sess := erpc.NewPipePeerPair(erpc.PeerConfig{}, erpc.PeerConfig{})
+	defer srv.Close()
+	defer cli.Close()
+	srv.RouteCall(new(bodyHome))
+	for i := 0; i < 100; i++ {
+		var result PooledBody
+		arg := &PooledBody{A: "a", B: []int{i, i, i}}
+		if stat := sess.Call("/body_home/pooled", arg, &result).Status(); !stat.OK() {
+			t.Fatal(stat)
+		}
+		if result.A != "a" || len(result.B) != 3 || result.B[0] != i {
+			t.Fatalf("result: %+v", result)
+		}
+	}
+}
+
+func benchmarkBody(b *testing.B, serviceMethod string, arg, result interface{}) {
+	defer erpc.SetLoggerLevel("ERROR")()
+	srv, cli, sess := erpc.NewPipePeerPair(erpc.PeerConfig{}, erpc.PeerConfig{})
+	defer srv.Close()
+	defer cli.Close()
+	srv.RouteCall(new(bodyHome))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if stat := sess.Call(serviceMethod, arg, result).Status(); !stat.OK() {
+			b.Fatal(stat)
+		}
+	}
+}
+
+func BenchmarkPlainBody(b *testing.B) {
+	benchmarkBody(b, "/body_home/plain", &PlainBody{A: "a", B: []int{1, 2, 3}}, new(PlainBody))
+}
+
+func BenchmarkPooledBody(b *testing.B) {
+	benchmarkBody(b, "/body_home/pooled", &PooledBody{A: "a", B: []int{1, 2, 3}}, new(PooledBody))
+}
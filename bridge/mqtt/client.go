@@ -0,0 +1,414 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+// Config the MQTT broker connection config.
+type Config struct {
+	// Broker the broker address, e.g. "127.0.0.1:1883"
+	Broker    string
+	ClientID  string
+	Username  string
+	Password  string
+	TLSConfig *tls.Config
+	// KeepAlive the keep alive interval, default 60s
+	KeepAlive time.Duration
+	// Timeout the timeout of dialing and waiting for acknowledgement, default 10s
+	Timeout time.Duration
+	// RedialInterval the interval of reconnecting after disconnected, default 1s
+	RedialInterval time.Duration
+	// DeliveryQueueSize the size of the queue of the broker messages waiting to be forwarded, default 1024.
+	// The messages are dropped when the queue is full, so that the slow sessions do not block reading.
+	DeliveryQueueSize int
+}
+
+func (c *Config) check() error {
+	if c.Broker == "" {
+		return errors.New("mqtt: broker address is empty")
+	}
+	if c.ClientID == "" {
+		c.ClientID = fmt.Sprintf("erpc-%d", time.Now().UnixNano())
+	}
+	if c.KeepAlive <= 0 {
+		c.KeepAlive = 60 * time.Second
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.RedialInterval <= 0 {
+		c.RedialInterval = time.Second
+	}
+	if c.DeliveryQueueSize <= 0 {
+		c.DeliveryQueueSize = 1024
+	}
+	return nil
+}
+
+var errNotConnected = errors.New("mqtt: not connected")
+
+// client a MQTT 3.1.1 client, supports QoS 0 and 1.
+type client struct {
+	cfg        Config
+	onPublish  func(*publish)
+	deliveries chan *publish
+
+	wMu  sync.Mutex
+	conn net.Conn
+
+	mu      sync.Mutex
+	nextID  uint16
+	pending map[uint16]chan byte
+	subs    map[string]byte
+	closed  bool
+	done    chan struct{}
+}
+
+func newClient(cfg Config, onPublish func(*publish)) (*client, error) {
+	if err := cfg.check(); err != nil {
+		return nil, err
+	}
+	c := &client{
+		cfg:        cfg,
+		onPublish:  onPublish,
+		deliveries: make(chan *publish, cfg.DeliveryQueueSize),
+		pending:    make(map[uint16]chan byte),
+		subs:       make(map[string]byte),
+		done:       make(chan struct{}),
+	}
+	conn, r, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	go c.run(conn, r)
+	go c.deliver()
+	return c, nil
+}
+
+// deliver forwards the queued broker messages out of the read goroutine.
+func (c *client) deliver() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case p := <-c.deliveries:
+			c.onPublish(p)
+		}
+	}
+}
+
+func (c *client) connect() (net.Conn, *bufio.Reader, error) {
+	dialer := &net.Dialer{Timeout: c.cfg.Timeout}
+	var conn net.Conn
+	var err error
+	if c.cfg.TLSConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.cfg.Broker, c.cfg.TLSConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", c.cfg.Broker)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	// CONNECT with clean session
+	var flags byte = 0x02
+	if c.cfg.Username != "" {
+		flags |= 0x80
+	}
+	if c.cfg.Password != "" {
+		flags |= 0x40
+	}
+	b := appendString(nil, "MQTT")
+	b = append(b, 4, flags)
+	b = appendUint16(b, uint16(c.cfg.KeepAlive/time.Second))
+	b = appendString(b, c.cfg.ClientID)
+	if c.cfg.Username != "" {
+		b = appendString(b, c.cfg.Username)
+	}
+	if c.cfg.Password != "" {
+		b = appendString(b, c.cfg.Password)
+	}
+	b, _ = encodePacket(packetConnect, 0, b)
+	conn.SetDeadline(time.Now().Add(c.cfg.Timeout))
+	if _, err = conn.Write(b); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	r := bufio.NewReader(conn)
+	pk, err := readPacket(r)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if pk.typ != packetConnack || len(pk.payload) != 2 {
+		conn.Close()
+		return nil, nil, errMalformedPacket
+	}
+	if code := pk.payload[1]; code != 0 {
+		conn.Close()
+		return nil, nil, fmt.Errorf("mqtt: connection refused, return code %d", code)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, r, nil
+}
+
+// run reads the packets, and reconnects after disconnected.
+func (c *client) run(conn net.Conn, r *bufio.Reader) {
+	for {
+		stop := make(chan struct{})
+		go c.keepAlive(conn, stop)
+		err := c.readLoop(r)
+		close(stop)
+		conn.Close()
+		c.mu.Lock()
+		for id, ch := range c.pending {
+			close(ch)
+			delete(c.pending, id)
+		}
+		closed := c.closed
+		c.mu.Unlock()
+		if closed {
+			return
+		}
+		erpc.Warnf("mqtt: disconnected from %s: %v", c.cfg.Broker, err)
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-time.After(c.cfg.RedialInterval):
+			}
+			conn, r, err = c.connect()
+			if err == nil {
+				break
+			}
+			erpc.Warnf("mqtt: reconnect %s: %v", c.cfg.Broker, err)
+		}
+		c.wMu.Lock()
+		c.conn = conn
+		c.wMu.Unlock()
+		go c.resubscribe()
+	}
+}
+
+func (c *client) resubscribe() {
+	c.mu.Lock()
+	subs := make(map[string]byte, len(c.subs))
+	for filter, qos := range c.subs {
+		subs[filter] = qos
+	}
+	c.mu.Unlock()
+	for filter, qos := range subs {
+		if err := c.doSubscribe(filter, qos); err != nil {
+			erpc.Warnf("mqtt: resubscribe %s: %v", filter, err)
+		}
+	}
+}
+
+func (c *client) keepAlive(conn net.Conn, stop chan struct{}) {
+	ticker := time.NewTicker(c.cfg.KeepAlive * 3 / 4)
+	defer ticker.Stop()
+	ping, _ := encodePacket(packetPingreq, 0, nil)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.wMu.Lock()
+			conn.SetWriteDeadline(time.Now().Add(c.cfg.Timeout))
+			_, err := conn.Write(ping)
+			conn.SetWriteDeadline(time.Time{})
+			c.wMu.Unlock()
+			if err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (c *client) readLoop(r *bufio.Reader) error {
+	for {
+		pk, err := readPacket(r)
+		if err != nil {
+			return err
+		}
+		switch pk.typ {
+		case packetPublish:
+			p, err := decodePublish(pk)
+			if err != nil {
+				return err
+			}
+			if p.qos > 1 {
+				return errors.New("mqtt: QoS 2 is not supported")
+			}
+			select {
+			case c.deliveries <- p:
+			default:
+				erpc.Warnf("mqtt: delivery queue is full, drop the message of %s", p.topic)
+			}
+			if p.qos == 1 {
+				b, _ := encodePacket(packetPuback, 0, appendUint16(nil, p.packetID))
+				if err = c.write(b); err != nil {
+					return err
+				}
+			}
+		case packetPuback, packetSuback, packetUnsuback:
+			rd := &reader{b: pk.payload}
+			id := rd.uint16()
+			code := rd.byte() // the granted QoS of SUBACK
+			if pk.typ != packetSuback {
+				code = 0
+			}
+			c.mu.Lock()
+			if ch, ok := c.pending[id]; ok {
+				ch <- code
+				delete(c.pending, id)
+			}
+			c.mu.Unlock()
+		case packetPingresp:
+		default:
+			return fmt.Errorf("mqtt: unexpected packet type %d", pk.typ)
+		}
+	}
+}
+
+func (c *client) write(b []byte) error {
+	c.wMu.Lock()
+	defer c.wMu.Unlock()
+	if c.conn == nil {
+		return errNotConnected
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.cfg.Timeout))
+	_, err := c.conn.Write(b)
+	c.conn.SetWriteDeadline(time.Time{})
+	return err
+}
+
+// request writes the packet that expects an acknowledgement, and waits for it.
+func (c *client) request(encode func(packetID uint16) ([]byte, error)) (byte, error) {
+	ch := make(chan byte, 1)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return 0, errNotConnected
+	}
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+	b, err := encode(id)
+	if err == nil {
+		err = c.write(b)
+	}
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return 0, err
+	}
+	select {
+	case code, ok := <-ch:
+		if !ok {
+			return 0, errNotConnected
+		}
+		return code, nil
+	case <-time.After(c.cfg.Timeout):
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return 0, errors.New("mqtt: acknowledgement timeout")
+	}
+}
+
+func (c *client) publish(topic string, payload []byte, qos byte, retain bool) error {
+	p := &publish{topic: topic, payload: payload, qos: qos, retain: retain}
+	if qos == 0 {
+		b, err := p.encode()
+		if err != nil {
+			return err
+		}
+		return c.write(b)
+	}
+	_, err := c.request(func(id uint16) ([]byte, error) {
+		p.packetID = id
+		return p.encode()
+	})
+	return err
+}
+
+func (c *client) subscribe(filter string, qos byte) error {
+	if err := c.doSubscribe(filter, qos); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.subs[filter] = qos
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *client) doSubscribe(filter string, qos byte) error {
+	code, err := c.request(func(id uint16) ([]byte, error) {
+		b := appendUint16(nil, id)
+		b = appendString(b, filter)
+		return encodePacket(packetSubscribe, 2, append(b, qos))
+	})
+	if err != nil {
+		return err
+	}
+	if code == 0x80 {
+		return fmt.Errorf("mqtt: subscribe %s: refused by broker", filter)
+	}
+	return nil
+}
+
+func (c *client) unsubscribe(filter string) error {
+	c.mu.Lock()
+	delete(c.subs, filter)
+	c.mu.Unlock()
+	_, err := c.request(func(id uint16) ([]byte, error) {
+		b := appendUint16(nil, id)
+		return encodePacket(packetUnsubscribe, 2, appendString(b, filter))
+	})
+	return err
+}
+
+func (c *client) close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	c.mu.Unlock()
+	b, _ := encodePacket(packetDisconnect, 0, nil)
+	c.write(b)
+	c.wMu.Lock()
+	defer c.wMu.Unlock()
+	return c.conn.Close()
+}
@@ -0,0 +1,267 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mqtt is a bridge between erpc PUSH and MQTT topics.
+//
+// The pushes received by the peer are published to the broker,
+// and the broker messages are forwarded to the subscribed sessions as pushes.
+// Only MQTT 3.1.1 with QoS 0 and 1 is supported.
+package mqtt
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/codec"
+)
+
+// Rule is a topic rewriting rule between the service method and the MQTT topic,
+// by replacing the prefix, e.g. Rule{ServiceMethod: "/iot/", Topic: "devices/"}
+// maps the push "/iot/temp/1" to the topic "devices/temp/1", and vice versa.
+type Rule struct {
+	// ServiceMethod the service method prefix
+	ServiceMethod string
+	// Topic the MQTT topic prefix
+	Topic string
+	// QoS the QoS of publishing to the broker, 0 or 1.
+	// The PUSH is at most once, so QoS 1 only ensures delivery from the bridge to the broker.
+	QoS byte
+	// Retain the retain flag of publishing to the broker
+	Retain bool
+	// BodyCodec the body codec of the pushes forwarded from the broker, default JSON
+	BodyCodec byte
+	// Inbound only forwards the broker messages to the sessions, no publishing
+	Inbound bool
+	// Outbound only publishes the pushes to the broker, no forwarding
+	Outbound bool
+}
+
+// DefaultRule maps the service method to the topic without the leading '/'.
+var DefaultRule = Rule{ServiceMethod: "/", Topic: ""}
+
+// Bridge a bridge between erpc PUSH and MQTT topics,
+// it is also a plugin that publishes the received pushes.
+type Bridge struct {
+	client *client
+	rules  []Rule
+	mu     sync.RWMutex
+	subs   map[string]map[erpc.Session]struct{} // topic filter -> sessions
+}
+
+var (
+	_ erpc.PostReadPushBodyPlugin = (*Bridge)(nil)
+	_ erpc.PostDisconnectPlugin   = (*Bridge)(nil)
+)
+
+// New connects to the broker and creates a bridge.
+// NOTE:
+//  The rules are matched in order, if no rule is specified, DefaultRule is used;
+//  The bridge reconnects and resubscribes automatically after disconnected.
+func New(cfg Config, rules ...Rule) (*Bridge, error) {
+	if len(rules) == 0 {
+		rules = []Rule{DefaultRule}
+	}
+	b := &Bridge{
+		rules: rules,
+		subs:  make(map[string]map[erpc.Session]struct{}),
+	}
+	c, err := newClient(cfg, b.forward)
+	if err != nil {
+		return nil, err
+	}
+	b.client = c
+	return b, nil
+}
+
+// Name returns the plugin name.
+func (b *Bridge) Name() string {
+	return "mqtt-bridge"
+}
+
+// PostReadPushBody publishes the push to the broker.
+func (b *Bridge) PostReadPushBody(ctx erpc.ReadCtx) *erpc.Status {
+	topic, rule, ok := b.ToTopic(ctx.ServiceMethod())
+	if !ok {
+		return nil
+	}
+	var payload []byte
+	switch body := ctx.Input().Body().(type) {
+	case *[]byte:
+		payload = *body
+	default:
+		var err error
+		payload, err = codec.Marshal(ctx.Input().BodyCodec(), body)
+		if err != nil {
+			return erpc.NewStatus(erpc.CodeBadMessage, erpc.CodeText(erpc.CodeBadMessage), err.Error())
+		}
+	}
+	if err := b.client.publish(topic, payload, rule.QoS, rule.Retain); err != nil {
+		erpc.Warnf("mqtt: publish %s: %v", topic, err)
+	}
+	return nil
+}
+
+// PostDisconnect unsubscribes the topics of the disconnected session.
+func (b *Bridge) PostDisconnect(sess erpc.BaseSession) *erpc.Status {
+	if s, ok := sess.(erpc.Session); ok {
+		b.UnsubscribeAll(s)
+	}
+	return nil
+}
+
+// UnknownPush accepts the pushes without handler, so that they can be published by the bridge.
+// e.g. peer.SetUnknownPush(mqtt.UnknownPush)
+func UnknownPush(erpc.UnknownPushCtx) *erpc.Status {
+	return nil
+}
+
+// Publish publishes the body to the topic mapped from the service method.
+// NOTE: The body is marshaled by the body codec, unless it is []byte.
+func (b *Bridge) Publish(serviceMethod string, body interface{}, bodyCodec byte) error {
+	topic, rule, ok := b.ToTopic(serviceMethod)
+	if !ok {
+		return fmt.Errorf("mqtt: no rule for %s", serviceMethod)
+	}
+	payload, ok := body.([]byte)
+	if !ok {
+		var err error
+		payload, err = codec.Marshal(bodyCodec, body)
+		if err != nil {
+			return err
+		}
+	}
+	return b.client.publish(topic, payload, rule.QoS, rule.Retain)
+}
+
+// Subscribe subscribes the topic filter for the session,
+// and the matched broker messages are pushed to it.
+// NOTE: The filter can contain wildcards '+' and '#', and the QoS is up to 1.
+func (b *Bridge) Subscribe(sess erpc.Session, topicFilter string, qos byte) error {
+	if qos > 1 {
+		qos = 1
+	}
+	b.mu.Lock()
+	sessions, ok := b.subs[topicFilter]
+	if !ok {
+		sessions = make(map[erpc.Session]struct{})
+		b.subs[topicFilter] = sessions
+	}
+	sessions[sess] = struct{}{}
+	b.mu.Unlock()
+	if ok {
+		return nil
+	}
+	err := b.client.subscribe(topicFilter, qos)
+	if err != nil {
+		// only roll back the registration of this session,
+		// the others may be added during subscribing
+		b.mu.Lock()
+		if sessions := b.subs[topicFilter]; sessions != nil {
+			delete(sessions, sess)
+			if len(sessions) == 0 {
+				delete(b.subs, topicFilter)
+			}
+		}
+		b.mu.Unlock()
+	}
+	return err
+}
+
+// Unsubscribe unsubscribes the topic filter for the session.
+func (b *Bridge) Unsubscribe(sess erpc.Session, topicFilter string) error {
+	b.mu.Lock()
+	sessions := b.subs[topicFilter]
+	delete(sessions, sess)
+	empty := sessions != nil && len(sessions) == 0
+	if empty {
+		delete(b.subs, topicFilter)
+	}
+	b.mu.Unlock()
+	if empty {
+		return b.client.unsubscribe(topicFilter)
+	}
+	return nil
+}
+
+// UnsubscribeAll unsubscribes all topic filters for the session.
+func (b *Bridge) UnsubscribeAll(sess erpc.Session) {
+	var filters []string
+	b.mu.RLock()
+	for filter, sessions := range b.subs {
+		if _, ok := sessions[sess]; ok {
+			filters = append(filters, filter)
+		}
+	}
+	b.mu.RUnlock()
+	for _, filter := range filters {
+		if err := b.Unsubscribe(sess, filter); err != nil {
+			erpc.Warnf("mqtt: unsubscribe %s: %v", filter, err)
+		}
+	}
+}
+
+// Close disconnects from the broker.
+func (b *Bridge) Close() error {
+	return b.client.close()
+}
+
+// ToTopic returns the topic mapped from the service method by the first matched outbound rule.
+func (b *Bridge) ToTopic(serviceMethod string) (string, Rule, bool) {
+	for _, r := range b.rules {
+		if !r.Inbound && strings.HasPrefix(serviceMethod, r.ServiceMethod) {
+			return r.Topic + serviceMethod[len(r.ServiceMethod):], r, true
+		}
+	}
+	return "", Rule{}, false
+}
+
+// ToServiceMethod returns the service method mapped from the topic by the first matched inbound rule.
+func (b *Bridge) ToServiceMethod(topic string) (string, Rule, bool) {
+	for _, r := range b.rules {
+		if !r.Outbound && strings.HasPrefix(topic, r.Topic) {
+			return r.ServiceMethod + topic[len(r.Topic):], r, true
+		}
+	}
+	return "", Rule{}, false
+}
+
+// forward pushes the broker message to the subscribed sessions.
+func (b *Bridge) forward(p *publish) {
+	serviceMethod, rule, ok := b.ToServiceMethod(p.topic)
+	if !ok {
+		return
+	}
+	bodyCodec := rule.BodyCodec
+	if bodyCodec == codec.NilCodecID {
+		bodyCodec = codec.ID_JSON
+	}
+	var sessions = make(map[erpc.Session]struct{})
+	b.mu.RLock()
+	for filter, ss := range b.subs {
+		if MatchTopic(filter, p.topic) {
+			for sess := range ss {
+				sessions[sess] = struct{}{}
+			}
+		}
+	}
+	b.mu.RUnlock()
+	for sess := range sessions {
+		stat := sess.Push(serviceMethod, p.payload, erpc.WithBodyCodec(bodyCodec))
+		if !stat.OK() {
+			erpc.Debugf("mqtt: forward %s to %s: %s", p.topic, sess.ID(), stat.String())
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package mqtt
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+func TestMatchTopic(t *testing.T) {
+	cases := []struct {
+		filter, topic string
+		match         bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/#", "a", true},
+		{"a/#", "a/b/c", true},
+		{"+/b", "a/b", true},
+		{"#", "$SYS/x", false},
+		{"a/b", "a/c", false},
+	}
+	for _, c := range cases {
+		if got := MatchTopic(c.filter, c.topic); got != c.match {
+			t.Errorf("MatchTopic(%q, %q) = %v", c.filter, c.topic, got)
+		}
+	}
+}
+
+// broker is a minimal MQTT broker for testing.
+type broker struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	subs map[net.Conn][]string
+}
+
+func newBroker(t *testing.T) *broker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &broker{ln: ln, subs: make(map[net.Conn][]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *broker) write(conn net.Conn, typ, flags byte, body []byte) {
+	p, _ := encodePacket(typ, flags, body)
+	b.mu.Lock()
+	conn.Write(p)
+	b.mu.Unlock()
+}
+
+func (b *broker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		pk, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		rd := &reader{b: pk.payload}
+		switch pk.typ {
+		case packetConnect:
+			b.write(conn, packetConnack, 0, []byte{0, 0})
+		case packetSubscribe:
+			id := rd.uint16()
+			filter := rd.string()
+			qos := rd.byte()
+			b.mu.Lock()
+			b.subs[conn] = append(b.subs[conn], filter)
+			b.mu.Unlock()
+			b.write(conn, packetSuback, 0, append(appendUint16(nil, id), qos))
+		case packetUnsubscribe:
+			b.write(conn, packetUnsuback, 0, appendUint16(nil, rd.uint16()))
+		case packetPublish:
+			p, _ := decodePublish(pk)
+			if p.qos == 1 {
+				b.write(conn, packetPuback, 0, appendUint16(nil, p.packetID))
+			}
+			b.mu.Lock()
+			var targets []net.Conn
+			for c, filters := range b.subs {
+				for _, f := range filters {
+					if MatchTopic(f, p.topic) {
+						targets = append(targets, c)
+						break
+					}
+				}
+			}
+			b.mu.Unlock()
+			for _, c := range targets {
+				fwd := &publish{topic: p.topic, payload: p.payload}
+				data, _ := fwd.encode()
+				b.mu.Lock()
+				c.Write(data)
+				b.mu.Unlock()
+			}
+		case packetPingreq:
+			b.write(conn, packetPingresp, 0, nil)
+		}
+	}
+}
+
+type Temp struct {
+	erpc.PushCtx
+}
+
+var received = make(chan map[string]int, 1)
+
+func (t *Temp) Test(arg *map[string]int) *erpc.Status {
+	received <- *arg
+	return nil
+}
+
+func TestBridge(t *testing.T) {
+	brk := newBroker(t)
+	defer brk.ln.Close()
+
+	bridge, err := New(
+		Config{Broker: brk.ln.Addr().String()},
+		Rule{ServiceMethod: "/iot/", Topic: "devices/", QoS: 1},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bridge.Close()
+	if topic, _, _ := bridge.ToTopic("/iot/temp/test"); topic != "devices/temp/test" {
+		t.Fatalf("ToTopic: got %q", topic)
+	}
+
+	srv := erpc.NewPeer(erpc.PeerConfig{ListenPort: 9097}, bridge)
+	srv.SetUnknownPush(UnknownPush)
+	go srv.ListenAndServe()
+	time.Sleep(500 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	cli.SubRoute("/iot").RoutePush(new(Temp))
+	sess, stat := cli.Dial(":9097")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	time.Sleep(100 * time.Millisecond)
+	srv.RangeSession(func(s erpc.Session) bool {
+		if err = bridge.Subscribe(s, "devices/temp/#", 1); err != nil {
+			t.Fatal(err)
+		}
+		return true
+	})
+
+	// erpc push -> broker -> erpc push
+	stat = sess.Push("/iot/temp/test", map[string]int{"v": 25})
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	select {
+	case v := <-received:
+		if v["v"] != 25 {
+			t.Fatalf("got %v", v)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	sess.Close()
+	time.Sleep(100 * time.Millisecond)
+	bridge.mu.RLock()
+	n := len(bridge.subs)
+	bridge.mu.RUnlock()
+	if n != 0 {
+		t.Fatalf("subscriptions are not released: %d", n)
+	}
+}
+
+func TestDeliveryQueue(t *testing.T) {
+	brk := newBroker(t)
+	defer brk.ln.Close()
+
+	block := make(chan struct{})
+	c, err := newClient(Config{
+		Broker:            brk.ln.Addr().String(),
+		Timeout:           time.Second,
+		DeliveryQueueSize: 1,
+	}, func(*publish) { <-block })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+	defer close(block)
+	if err = c.subscribe("a", 0); err != nil {
+		t.Fatal(err)
+	}
+	// the slow delivery does not block reading the acknowledgements
+	for i := 0; i < 3; i++ {
+		if err = c.publish("a", []byte("x"), 1, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = c.subscribe("b", 1); err != nil {
+		t.Fatal(err)
+	}
+}
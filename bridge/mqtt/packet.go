@@ -0,0 +1,201 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+// MQTT 3.1.1 control packet types
+const (
+	packetConnect     byte = 1
+	packetConnack     byte = 2
+	packetPublish     byte = 3
+	packetPuback      byte = 4
+	packetSubscribe   byte = 8
+	packetSuback      byte = 9
+	packetUnsubscribe byte = 10
+	packetUnsuback    byte = 11
+	packetPingreq     byte = 12
+	packetPingresp    byte = 13
+	packetDisconnect  byte = 14
+)
+
+const maxRemainingLength = 268435455
+
+var errMalformedPacket = errors.New("mqtt: malformed packet")
+
+// packet a MQTT control packet.
+type packet struct {
+	payload []byte
+	typ     byte
+	flags   byte
+}
+
+func readPacket(r *bufio.Reader) (*packet, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	p := &packet{typ: b >> 4, flags: b & 0x0f}
+	var n, shift int
+	for i := 0; ; i++ {
+		if i == 4 {
+			return nil, errMalformedPacket
+		}
+		b, err = r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+	}
+	p.payload = make([]byte, n)
+	if _, err = io.ReadFull(r, p.payload); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func encodePacket(typ, flags byte, body []byte) ([]byte, error) {
+	n := len(body)
+	if n > maxRemainingLength {
+		return nil, errors.New("mqtt: packet too large")
+	}
+	b := make([]byte, 0, n+5)
+	b = append(b, typ<<4|flags)
+	for {
+		d := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			d |= 0x80
+		}
+		b = append(b, d)
+		if n == 0 {
+			break
+		}
+	}
+	return append(b, body...), nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func appendUint16(b []byte, n uint16) []byte {
+	return append(b, byte(n>>8), byte(n))
+}
+
+// reader reads the fields of packet payload.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) uint16() uint16 {
+	if r.err != nil || len(r.b) < 2 {
+		r.err = errMalformedPacket
+		return 0
+	}
+	n := binary.BigEndian.Uint16(r.b)
+	r.b = r.b[2:]
+	return n
+}
+
+func (r *reader) string() string {
+	n := int(r.uint16())
+	if r.err != nil || len(r.b) < n {
+		r.err = errMalformedPacket
+		return ""
+	}
+	s := string(r.b[:n])
+	r.b = r.b[n:]
+	return s
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil || len(r.b) < 1 {
+		r.err = errMalformedPacket
+		return 0
+	}
+	c := r.b[0]
+	r.b = r.b[1:]
+	return c
+}
+
+// publish a PUBLISH packet.
+type publish struct {
+	topic    string
+	payload  []byte
+	packetID uint16
+	qos      byte
+	retain   bool
+}
+
+func (p *publish) encode() ([]byte, error) {
+	var flags = p.qos << 1
+	if p.retain {
+		flags |= 1
+	}
+	b := appendString(make([]byte, 0, len(p.topic)+len(p.payload)+4), p.topic)
+	if p.qos > 0 {
+		b = appendUint16(b, p.packetID)
+	}
+	return encodePacket(packetPublish, flags, append(b, p.payload...))
+}
+
+func decodePublish(pk *packet) (*publish, error) {
+	p := &publish{qos: (pk.flags >> 1) & 3, retain: pk.flags&1 != 0}
+	r := &reader{b: pk.payload}
+	p.topic = r.string()
+	if p.qos > 0 {
+		p.packetID = r.uint16()
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	p.payload = r.b
+	return p, nil
+}
+
+// MatchTopic reports whether the topic matches the filter with MQTT wildcards '+' and '#'.
+// NOTE: The topics starting with '$' do not match the filters starting with a wildcard.
+func MatchTopic(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	fs := strings.Split(filter, "/")
+	ts := strings.Split(topic, "/")
+	for i, f := range fs {
+		if f == "#" {
+			return i == len(fs)-1
+		}
+		if i >= len(ts) {
+			return false
+		}
+		if f != "+" && f != ts[i] {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
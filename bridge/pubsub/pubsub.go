@@ -0,0 +1,302 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pubsub is a topic publish/subscribe layer bridged across the server instances by a broker, e.g. Redis.
+//
+// The sessions subscribe the topics on the node they are connected to,
+// and the message published on any node is pushed to all the subscribers in the cluster,
+// with the topic as the service method.
+package pubsub
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/codec"
+)
+
+// Broker the message broker shared by the server instances.
+type Broker interface {
+	// Publish publishes the data to the channel.
+	Publish(channel string, data []byte) error
+	// Subscribe subscribes the channel, and returns the unsubscribe function.
+	// NOTE: The handler is called in the reading goroutine, and must not block.
+	Subscribe(channel string, handler func(data []byte)) (unsubscribe func() error, err error)
+	// Close closes the broker connection.
+	Close() error
+}
+
+// Config the pub/sub config
+type Config struct {
+	// ChannelPrefix the prefix of the broker channel names, default "erpc:"
+	ChannelPrefix string
+	// Channel maps the topic to the broker channel name, default ChannelPrefix+topic
+	Channel func(topic string) string
+	// BodyCodec the default codec of marshaling the published body, default JSON
+	BodyCodec byte
+	// QueueSize the size of the queue of the messages waiting to be pushed to each subscriber, default 1024.
+	// The messages are dropped when the queue of the slow subscriber is full, so that it does not block the others.
+	QueueSize int
+}
+
+// PubSub a topic publish/subscribe layer bridged by the broker,
+// it is also a plugin that unsubscribes the topics of the disconnected sessions.
+type PubSub struct {
+	broker      Broker
+	channel     func(topic string) string
+	bodyCodec   byte
+	queueSize   int
+	mu          sync.RWMutex
+	topics      map[string]*topic
+	subscribers map[erpc.Session]*subscriber
+	dropped     uint64
+}
+
+type topic struct {
+	sessions    map[erpc.Session]struct{}
+	unsubscribe func() error
+}
+
+// subscriber the session subscribing the topics, with its queue of the messages to push.
+type subscriber struct {
+	sess   erpc.Session
+	queue  chan *delivery
+	topics int // the number of the subscribed topics
+	done   chan struct{}
+}
+
+type delivery struct {
+	topic     string
+	bodyCodec byte
+	payload   []byte
+}
+
+var _ erpc.PostDisconnectPlugin = (*PubSub)(nil)
+
+// ErrBadMessage the broker message is not published by PubSub.
+var ErrBadMessage = errors.New("pubsub: bad message")
+
+// New creates a pub/sub layer on the broker.
+func New(broker Broker, cfg Config) *PubSub {
+	if cfg.ChannelPrefix == "" {
+		cfg.ChannelPrefix = "erpc:"
+	}
+	if cfg.Channel == nil {
+		prefix := cfg.ChannelPrefix
+		cfg.Channel = func(topic string) string {
+			return prefix + topic
+		}
+	}
+	if cfg.BodyCodec == codec.NilCodecID {
+		cfg.BodyCodec = codec.ID_JSON
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+	return &PubSub{
+		broker:      broker,
+		channel:     cfg.Channel,
+		bodyCodec:   cfg.BodyCodec,
+		queueSize:   cfg.QueueSize,
+		topics:      make(map[string]*topic),
+		subscribers: make(map[erpc.Session]*subscriber),
+	}
+}
+
+// Name returns the plugin name.
+func (p *PubSub) Name() string {
+	return "pubsub"
+}
+
+// PostDisconnect unsubscribes the topics of the disconnected session.
+func (p *PubSub) PostDisconnect(sess erpc.BaseSession) *erpc.Status {
+	if s, ok := sess.(erpc.Session); ok {
+		p.UnsubscribeAll(s)
+	}
+	return nil
+}
+
+// Publish publishes the body to the topic, e.g. "/topic/x",
+// and it is pushed to the subscribers on all the nodes.
+// NOTE: The body is marshaled by the body codec of the setting or Config.BodyCodec, unless it is []byte.
+func (p *PubSub) Publish(topic string, body interface{}, setting ...erpc.MessageSetting) error {
+	bodyCodec := p.bodyCodec
+	if len(setting) > 0 {
+		m := erpc.GetMessage(setting...)
+		if id := m.BodyCodec(); id != codec.NilCodecID {
+			bodyCodec = id
+		}
+		erpc.PutMessage(m)
+	}
+	payload, ok := body.([]byte)
+	if !ok {
+		var err error
+		payload, err = codec.Marshal(bodyCodec, body)
+		if err != nil {
+			return err
+		}
+	}
+	// the body codec is carried by the first byte
+	data := make([]byte, 0, len(payload)+1)
+	data = append(data, bodyCodec)
+	data = append(data, payload...)
+	return p.broker.Publish(p.channel(topic), data)
+}
+
+// Subscribe subscribes the topic for the session,
+// the broker channel is subscribed by the first subscriber on the node.
+func (p *PubSub) Subscribe(sess erpc.Session, topicName string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.topics[topicName]; ok {
+		if _, ok = t.sessions[sess]; !ok {
+			t.sessions[sess] = struct{}{}
+			p.addSubscriber(sess)
+		}
+		return nil
+	}
+	unsubscribe, err := p.broker.Subscribe(p.channel(topicName), func(data []byte) {
+		p.forward(topicName, data)
+	})
+	if err != nil {
+		return err
+	}
+	p.topics[topicName] = &topic{
+		sessions:    map[erpc.Session]struct{}{sess: {}},
+		unsubscribe: unsubscribe,
+	}
+	p.addSubscriber(sess)
+	return nil
+}
+
+// addSubscriber counts a subscribed topic of the session, and starts pushing to it for the first one.
+// NOTE: The caller holds p.mu.
+func (p *PubSub) addSubscriber(sess erpc.Session) {
+	sub, ok := p.subscribers[sess]
+	if !ok {
+		sub = &subscriber{
+			sess:  sess,
+			queue: make(chan *delivery, p.queueSize),
+			done:  make(chan struct{}),
+		}
+		p.subscribers[sess] = sub
+		go sub.run()
+	}
+	sub.topics++
+}
+
+// removeSubscriber uncounts a subscribed topic of the session, and stops pushing to it after the last one.
+// NOTE: The caller holds p.mu.
+func (p *PubSub) removeSubscriber(sess erpc.Session) {
+	sub, ok := p.subscribers[sess]
+	if !ok {
+		return
+	}
+	sub.topics--
+	if sub.topics <= 0 {
+		delete(p.subscribers, sess)
+		close(sub.done)
+	}
+}
+
+// run pushes the queued messages to the session, out of the broker reading goroutine.
+func (s *subscriber) run() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case d := <-s.queue:
+			if stat := s.sess.Push(d.topic, d.payload, erpc.WithBodyCodec(d.bodyCodec)); !stat.OK() {
+				erpc.Debugf("pubsub: push %s to %s: %s", d.topic, s.sess.ID(), stat.String())
+			}
+		}
+	}
+}
+
+// Unsubscribe unsubscribes the topic for the session,
+// the broker channel is unsubscribed after the last subscriber on the node.
+func (p *PubSub) Unsubscribe(sess erpc.Session, topicName string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t, ok := p.topics[topicName]
+	if !ok {
+		return nil
+	}
+	if _, ok = t.sessions[sess]; !ok {
+		return nil
+	}
+	delete(t.sessions, sess)
+	p.removeSubscriber(sess)
+	if len(t.sessions) > 0 {
+		return nil
+	}
+	delete(p.topics, topicName)
+	return t.unsubscribe()
+}
+
+// UnsubscribeAll unsubscribes all the topics for the session.
+func (p *PubSub) UnsubscribeAll(sess erpc.Session) {
+	var topics []string
+	p.mu.RLock()
+	for name, t := range p.topics {
+		if _, ok := t.sessions[sess]; ok {
+			topics = append(topics, name)
+		}
+	}
+	p.mu.RUnlock()
+	for _, name := range topics {
+		if err := p.Unsubscribe(sess, name); err != nil {
+			erpc.Warnf("pubsub: unsubscribe %s: %v", name, err)
+		}
+	}
+}
+
+// Dropped returns the number of the messages dropped for the full queues of the slow subscribers.
+func (p *PubSub) Dropped() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
+// Close closes the broker.
+func (p *PubSub) Close() error {
+	return p.broker.Close()
+}
+
+// forward queues the broker message to the local subscribers, without blocking.
+func (p *PubSub) forward(topicName string, data []byte) {
+	if len(data) == 0 {
+		erpc.Warnf("pubsub: %s: %v", topicName, ErrBadMessage)
+		return
+	}
+	d := &delivery{topic: topicName, bodyCodec: data[0], payload: data[1:]}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	t, ok := p.topics[topicName]
+	if !ok {
+		return
+	}
+	for sess := range t.sessions {
+		sub := p.subscribers[sess]
+		if sub == nil {
+			continue
+		}
+		select {
+		case sub.queue <- d:
+		default:
+			atomic.AddUint64(&p.dropped, 1)
+			erpc.Warnf("pubsub: the queue of %s is full, drop the message of %s", sess.ID(), topicName)
+		}
+	}
+}
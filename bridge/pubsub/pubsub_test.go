@@ -0,0 +1,306 @@
+package pubsub
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+// server is a minimal Redis server of PUBLISH and SUBSCRIBE for testing.
+type server struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	subs  map[string]map[*redisConn]struct{}
+	conns map[net.Conn]struct{}
+}
+
+func newServer(t *testing.T) *server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{ln: ln, subs: make(map[string]map[*redisConn]struct{}), conns: make(map[net.Conn]struct{})}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns[conn] = struct{}{}
+			s.mu.Unlock()
+			go s.serve(&redisConn{conn: conn, r: bufio.NewReader(conn)})
+		}
+	}()
+	return s
+}
+
+func (s *server) serve(c *redisConn) {
+	defer func() {
+		c.conn.Close()
+		s.mu.Lock()
+		delete(s.conns, c.conn)
+		for _, subs := range s.subs {
+			delete(subs, c)
+		}
+		s.mu.Unlock()
+	}()
+	for {
+		reply, err := c.readReply()
+		if err != nil {
+			return
+		}
+		args, _ := reply.([]interface{})
+		if len(args) < 2 {
+			continue
+		}
+		cmd, _ := args[0].([]byte)
+		channel, _ := args[1].([]byte)
+		switch string(cmd) {
+		case "AUTH":
+			if string(channel) == "secret" {
+				c.conn.Write([]byte("+OK\r\n"))
+			} else {
+				c.conn.Write([]byte("-WRONGPASS invalid password\r\n"))
+			}
+		case "PUBLISH":
+			data, _ := args[2].([]byte)
+			s.mu.Lock()
+			for sub := range s.subs[string(channel)] {
+				sub.write("message", channel, data)
+			}
+			n := len(s.subs[string(channel)])
+			s.mu.Unlock()
+			c.conn.Write([]byte(":" + strconv.Itoa(n) + "\r\n"))
+		case "SUBSCRIBE":
+			for _, arg := range args[1:] {
+				channel, _ := arg.([]byte)
+				s.mu.Lock()
+				if s.subs[string(channel)] == nil {
+					s.subs[string(channel)] = make(map[*redisConn]struct{})
+				}
+				s.subs[string(channel)][c] = struct{}{}
+				s.mu.Unlock()
+				c.write("subscribe", channel, []byte("1"))
+			}
+		case "UNSUBSCRIBE":
+			s.mu.Lock()
+			delete(s.subs[string(channel)], c)
+			s.mu.Unlock()
+			c.write("unsubscribe", channel, []byte("0"))
+		}
+	}
+}
+
+// kill closes all the client connections.
+func (s *server) kill() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *server) count(channel string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subs[channel])
+}
+
+var received = make(chan string, 10)
+
+type Topic struct {
+	erpc.PushCtx
+}
+
+// X receives the published message.
+func (t *Topic) X(text *string) *erpc.Status {
+	received <- *text
+	return nil
+}
+
+func newNode(t *testing.T, addr string) (erpc.Peer, *PubSub, string) {
+	broker, err := DialRedis(RedisConfig{Addr: addr, Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := New(broker, Config{})
+	srv := erpc.NewPeer(erpc.PeerConfig{}, ps)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	return srv, ps, lis.Addr().String()
+}
+
+func TestPubSub(t *testing.T) {
+	redis := newServer(t)
+	defer redis.ln.Close()
+	addr := redis.ln.Addr().String()
+	if _, err := DialRedis(RedisConfig{Addr: addr, Password: "wrong"}); err == nil {
+		t.Fatal("expect the auth error")
+	}
+	srvA, psA, _ := newNode(t, addr)
+	defer srvA.Close()
+	defer psA.Close()
+	srvB, psB, addrB := newNode(t, addr)
+	defer srvB.Close()
+	defer psB.Close()
+
+	// the client is connected to the node B
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	cli.RoutePush(new(Topic))
+	sess, stat := cli.Dial(addrB)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	time.Sleep(100 * time.Millisecond)
+	srvSess, ok := srvB.GetSession(sess.LocalAddr().String())
+	if !ok {
+		t.Fatal("the session is not found on the node B")
+	}
+	if err := psB.Subscribe(srvSess, "/topic/x"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := redis.count("erpc:/topic/x"); n != 1 {
+		t.Fatalf("subscribers: %d", n)
+	}
+
+	// published on the node A
+	if err := psA.Publish("/topic/x", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case text := <-received:
+		if text != "hello" {
+			t.Fatalf("received: %q", text)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("not received")
+	}
+
+	// unsubscribed after disconnected
+	sess.Close()
+	time.Sleep(200 * time.Millisecond)
+	if n := redis.count("erpc:/topic/x"); n != 0 {
+		t.Fatalf("subscribers after disconnected: %d", n)
+	}
+}
+
+func TestRedisReconnect(t *testing.T) {
+	redis := newServer(t)
+	defer redis.ln.Close()
+	broker, err := DialRedis(RedisConfig{Addr: redis.ln.Addr().String(), RedialInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+	got := make(chan string, 10)
+	if _, err = broker.Subscribe("a", func(data []byte) { got <- string(data) }); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	redis.kill()
+	// subscribed again after reconnected, and the broken publishing connection is dialed again
+	for i := 0; ; i++ {
+		if i == 100 {
+			t.Fatal("not received after reconnected")
+		}
+		broker.Publish("a", []byte("hello"))
+		select {
+		case text := <-got:
+			if text != "hello" {
+				t.Fatalf("got: %q", text)
+			}
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
+
+// localBroker a broker calling the handlers in the publishing goroutine.
+type localBroker struct {
+	mu       sync.Mutex
+	handlers map[string]func(data []byte)
+}
+
+func (b *localBroker) Publish(channel string, data []byte) error {
+	b.mu.Lock()
+	h := b.handlers[channel]
+	b.mu.Unlock()
+	if h != nil {
+		h(data)
+	}
+	return nil
+}
+
+func (b *localBroker) Subscribe(channel string, handler func(data []byte)) (func() error, error) {
+	b.mu.Lock()
+	b.handlers[channel] = handler
+	b.mu.Unlock()
+	return func() error { return nil }, nil
+}
+
+func (b *localBroker) Close() error { return nil }
+
+// stubSession a session recording or blocking the pushes.
+type stubSession struct {
+	erpc.Session
+	id     string
+	block  chan struct{}
+	pushed chan string
+}
+
+func (s *stubSession) ID() string { return s.id }
+
+func (s *stubSession) Push(serviceMethod string, args interface{}, setting ...erpc.MessageSetting) *erpc.Status {
+	if s.block != nil {
+		<-s.block
+	}
+	s.pushed <- string(args.([]byte))
+	return nil
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	ps := New(&localBroker{handlers: make(map[string]func(data []byte))}, Config{QueueSize: 2})
+	block := make(chan struct{})
+	defer close(block)
+	slow := &stubSession{id: "slow", block: block, pushed: make(chan string, 10)}
+	fast := &stubSession{id: "fast", pushed: make(chan string, 10)}
+	for _, sess := range []*stubSession{slow, fast} {
+		if err := ps.Subscribe(sess, "/topic/x"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the slow subscriber does not block publishing and the others
+	for i := 0; i < 5; i++ {
+		if err := ps.Publish("/topic/x", []byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case text := <-fast.pushed:
+			if text != strconv.Itoa(i) {
+				t.Fatalf("pushed: %q", text)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("not pushed to the fast subscriber")
+		}
+	}
+	// 2 queued, and at most 1 in pushing
+	if n := ps.Dropped(); n < 2 || n > 3 {
+		t.Fatalf("dropped: %d", n)
+	}
+	ps.UnsubscribeAll(slow)
+	ps.UnsubscribeAll(fast)
+	if n := len(ps.subscribers); n != 0 {
+		t.Fatalf("subscribers: %d", n)
+	}
+}
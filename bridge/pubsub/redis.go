@@ -0,0 +1,451 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+// RedisConfig the Redis server connection config.
+type RedisConfig struct {
+	// Addr the server address, e.g. "127.0.0.1:6379" or "redis://127.0.0.1:6379"
+	Addr string
+	// Username the ACL username, optional
+	Username string
+	Password string
+	// Timeout the timeout of dialing and each command, default 10s
+	Timeout time.Duration
+	// RedialInterval the interval of reconnecting after disconnected, default 1s
+	RedialInterval time.Duration
+}
+
+// RedisBroker a broker on the Redis PUBLISH and SUBSCRIBE commands.
+// NOTE:
+//  It reconnects after disconnected, and subscribes the channels again,
+//  but the messages published during the disconnection are lost;
+//  TLS is not supported.
+type RedisBroker struct {
+	cfg     RedisConfig
+	pubMu   sync.Mutex
+	pub     *redisConn // for the commands, nil after broken
+	mu      sync.Mutex
+	sub     *redisConn // in the subscribe mode
+	nextID  int
+	subs    map[string]map[int]func(data []byte) // channel -> id -> handler
+	locks   map[string]*channelLock
+	closed  bool
+	closeCh chan struct{}
+}
+
+// channelLock serializes the SUBSCRIBE and UNSUBSCRIBE commands of a channel.
+type channelLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+var _ Broker = (*RedisBroker)(nil)
+
+// ErrRedisClosed the Redis connection is closed.
+var ErrRedisClosed = errors.New("pubsub: redis connection closed")
+
+// DialRedis connects to the Redis server, with a connection for publishing and another for subscribing.
+func DialRedis(cfg RedisConfig) (*RedisBroker, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.RedialInterval <= 0 {
+		cfg.RedialInterval = time.Second
+	}
+	pub, err := dialRedis(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := dialRedis(cfg)
+	if err != nil {
+		pub.conn.Close()
+		return nil, err
+	}
+	b := &RedisBroker{
+		cfg:     cfg,
+		pub:     pub,
+		sub:     sub,
+		subs:    make(map[string]map[int]func(data []byte)),
+		locks:   make(map[string]*channelLock),
+		closeCh: make(chan struct{}),
+	}
+	go b.readLoop()
+	return b, nil
+}
+
+// Publish publishes the data to the channel.
+// NOTE: The broken connection is dialed again by the next Publish.
+func (b *RedisBroker) Publish(channel string, data []byte) error {
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+	if b.isClosed() {
+		return ErrRedisClosed
+	}
+	if b.pub == nil {
+		pub, err := dialRedis(b.cfg)
+		if err != nil {
+			return err
+		}
+		b.pub = pub
+	}
+	b.pub.conn.SetDeadline(time.Now().Add(b.cfg.Timeout))
+	_, err := b.pub.do("PUBLISH", []byte(channel), data)
+	if _, ok := err.(redisError); err != nil && !ok {
+		b.pub.conn.Close()
+		b.pub = nil
+		return err
+	}
+	b.pub.conn.SetDeadline(time.Time{})
+	return err
+}
+
+// Subscribe subscribes the channel, and returns the unsubscribe function.
+// NOTE: The handler is called in the reading goroutine, and must not block.
+func (b *RedisBroker) Subscribe(channel string, handler func(data []byte)) (func() error, error) {
+	unlock := b.lockChannel(channel)
+	defer unlock()
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil, ErrRedisClosed
+	}
+	b.nextID++
+	id := b.nextID
+	handlers, ok := b.subs[channel]
+	if !ok {
+		handlers = make(map[int]func(data []byte))
+		b.subs[channel] = handlers
+	}
+	handlers[id] = handler
+	sub := b.sub
+	b.mu.Unlock()
+	// the channel is subscribed again by the reconnection after it is added
+	if !ok && !b.command(sub, "SUBSCRIBE", channel) {
+		b.remove(channel, id)
+		return nil, ErrRedisClosed
+	}
+	return func() error {
+		unlock := b.lockChannel(channel)
+		defer unlock()
+		if !b.remove(channel, id) {
+			return nil
+		}
+		b.mu.Lock()
+		sub := b.sub
+		b.mu.Unlock()
+		// the channel is not subscribed again by the reconnection after it is removed
+		if !b.command(sub, "UNSUBSCRIBE", channel) {
+			return ErrRedisClosed
+		}
+		return nil
+	}, nil
+}
+
+// command writes the command of the channel to the subscribing connection,
+// and reports whether it is done by the connection or the reconnection replacing it.
+func (b *RedisBroker) command(sub *redisConn, cmd, channel string) bool {
+	if err := sub.write(cmd, []byte(channel)); err == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.closed && b.sub != sub
+}
+
+// lockChannel locks the channel, and returns the unlock function.
+func (b *RedisBroker) lockChannel(channel string) func() {
+	b.mu.Lock()
+	l, ok := b.locks[channel]
+	if !ok {
+		l = new(channelLock)
+		b.locks[channel] = l
+	}
+	l.refs++
+	b.mu.Unlock()
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		b.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(b.locks, channel)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// remove removes the handler, and reports whether the channel has no handler.
+func (b *RedisBroker) remove(channel string, id int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	handlers, ok := b.subs[channel]
+	if !ok {
+		return false
+	}
+	if _, ok = handlers[id]; !ok {
+		return false
+	}
+	delete(handlers, id)
+	if len(handlers) > 0 {
+		return false
+	}
+	delete(b.subs, channel)
+	return true
+}
+
+// Close closes the connections.
+func (b *RedisBroker) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.closeCh)
+	b.sub.conn.Close()
+	b.mu.Unlock()
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+	if b.pub == nil {
+		return nil
+	}
+	return b.pub.conn.Close()
+}
+
+func (b *RedisBroker) isClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+func (b *RedisBroker) readLoop() {
+	for {
+		b.mu.Lock()
+		sub := b.sub
+		b.mu.Unlock()
+		err := b.doRead(sub)
+		sub.conn.Close()
+		if b.isClosed() {
+			return
+		}
+		erpc.Warnf("pubsub: redis disconnected, reconnecting: %v", err)
+		if !b.reconnect() {
+			return
+		}
+	}
+}
+
+// reconnect dials the subscribing connection again until the broker is closed,
+// and subscribes the channels again.
+func (b *RedisBroker) reconnect() bool {
+	for {
+		select {
+		case <-b.closeCh:
+			return false
+		case <-time.After(b.cfg.RedialInterval):
+		}
+		sub, err := dialRedis(b.cfg)
+		if err != nil {
+			erpc.Warnf("pubsub: redis reconnect: %v", err)
+			continue
+		}
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			sub.conn.Close()
+			return false
+		}
+		channels := make([][]byte, 0, len(b.subs))
+		for channel := range b.subs {
+			channels = append(channels, []byte(channel))
+		}
+		b.sub = sub
+		if len(channels) > 0 {
+			err = sub.write("SUBSCRIBE", channels...)
+		}
+		b.mu.Unlock()
+		if err != nil {
+			// read the broken connection to reconnect again
+			erpc.Warnf("pubsub: redis resubscribe: %v", err)
+		}
+		return true
+	}
+}
+
+func (b *RedisBroker) doRead(sub *redisConn) error {
+	for {
+		reply, err := sub.readReply()
+		if err != nil {
+			return err
+		}
+		// ["message", channel, data], or the confirmations of (un)subscribe
+		msg, ok := reply.([]interface{})
+		if !ok || len(msg) != 3 {
+			continue
+		}
+		kind, _ := msg[0].([]byte)
+		channel, _ := msg[1].([]byte)
+		data, _ := msg[2].([]byte)
+		if string(kind) != "message" {
+			continue
+		}
+		var handlers []func(data []byte)
+		b.mu.Lock()
+		for _, h := range b.subs[string(channel)] {
+			handlers = append(handlers, h)
+		}
+		b.mu.Unlock()
+		for _, h := range handlers {
+			h(data)
+		}
+	}
+}
+
+// redisConn a connection speaking the RESP protocol.
+type redisConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	timeout time.Duration // the write timeout, optional
+	wMu     sync.Mutex
+}
+
+func dialRedis(cfg RedisConfig) (*redisConn, error) {
+	addr := strings.TrimPrefix(cfg.Addr, "redis://")
+	conn, err := net.DialTimeout("tcp", addr, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn), timeout: cfg.Timeout}
+	if cfg.Password != "" {
+		conn.SetDeadline(time.Now().Add(cfg.Timeout))
+		if cfg.Username != "" {
+			_, err = c.do("AUTH", []byte(cfg.Username), []byte(cfg.Password))
+		} else {
+			_, err = c.do("AUTH", []byte(cfg.Password))
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn.SetDeadline(time.Time{})
+	}
+	return c, nil
+}
+
+// do sends the command and reads the reply.
+func (c *redisConn) do(cmd string, args ...[]byte) (interface{}, error) {
+	if err := c.write(cmd, args...); err != nil {
+		return nil, err
+	}
+	reply, err := c.readReply()
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := reply.(redisError); ok {
+		return nil, e
+	}
+	return reply, nil
+}
+
+func (c *redisConn) write(cmd string, args ...[]byte) error {
+	b := make([]byte, 0, 64)
+	b = append(b, '*')
+	b = strconv.AppendInt(b, int64(len(args)+1), 10)
+	b = append(b, "\r\n"...)
+	b = appendBulk(b, []byte(cmd))
+	for _, arg := range args {
+		b = appendBulk(b, arg)
+	}
+	c.wMu.Lock()
+	defer c.wMu.Unlock()
+	if c.timeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+		defer c.conn.SetWriteDeadline(time.Time{})
+	}
+	_, err := c.conn.Write(b)
+	return err
+}
+
+func appendBulk(b, s []byte) []byte {
+	b = append(b, '$')
+	b = strconv.AppendInt(b, int64(len(s)), 10)
+	b = append(b, "\r\n"...)
+	b = append(b, s...)
+	return append(b, "\r\n"...)
+}
+
+// redisError the error reply of Redis.
+type redisError string
+
+func (e redisError) Error() string {
+	return "pubsub: redis: " + string(e)
+}
+
+// readReply reads a reply, which is string, redisError, int64, []byte (nil for null) or []interface{}.
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return nil, fmt.Errorf("pubsub: redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err = io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		array := make([]interface{}, n)
+		for i := range array {
+			if array[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	default:
+		return nil, fmt.Errorf("pubsub: redis: bad reply %q", line)
+	}
+}
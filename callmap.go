@@ -0,0 +1,105 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// callCmdShards the number of shards of the pending call map, must be a power of 2.
+const callCmdShards = 32
+
+// callCmdMap the pending calls waiting for the reply, sharded by seq to reduce the lock contention.
+// NOTE:
+//  The seq is always new when storing, which is the worst case of sync.Map.
+type callCmdMap struct {
+	shards [callCmdShards]callCmdShard
+	count  int64
+}
+
+type callCmdShard struct {
+	mu   sync.Mutex
+	cmds map[uint64]*callCmd
+	_    [48]byte // pads to the cache line, avoiding false sharing
+}
+
+func newCallCmdMap() *callCmdMap {
+	m := new(callCmdMap)
+	for i := range m.shards {
+		m.shards[i].cmds = make(map[uint64]*callCmd)
+	}
+	return m
+}
+
+func (m *callCmdMap) shard(seq uint64) *callCmdShard {
+	return &m.shards[seq&(callCmdShards-1)]
+}
+
+// Load returns the pending call of the seq.
+func (m *callCmdMap) Load(seq uint64) (*callCmd, bool) {
+	s := m.shard(seq)
+	s.mu.Lock()
+	cmd, ok := s.cmds[seq]
+	s.mu.Unlock()
+	return cmd, ok
+}
+
+// Store sets the pending call of the seq.
+func (m *callCmdMap) Store(seq uint64, cmd *callCmd) {
+	s := m.shard(seq)
+	s.mu.Lock()
+	if _, ok := s.cmds[seq]; !ok {
+		atomic.AddInt64(&m.count, 1)
+	}
+	s.cmds[seq] = cmd
+	s.mu.Unlock()
+}
+
+// Delete removes the pending call of the seq.
+func (m *callCmdMap) Delete(seq uint64) {
+	s := m.shard(seq)
+	s.mu.Lock()
+	if _, ok := s.cmds[seq]; ok {
+		delete(s.cmds, seq)
+		atomic.AddInt64(&m.count, -1)
+	}
+	s.mu.Unlock()
+}
+
+// Range calls f for each pending call, until f returns false.
+// NOTE: f is called without holding the lock, so it can delete the calls.
+func (m *callCmdMap) Range(f func(seq uint64, cmd *callCmd) bool) {
+	var cmds []*callCmd
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.Lock()
+		cmds = cmds[:0]
+		for _, cmd := range s.cmds {
+			cmds = append(cmds, cmd)
+		}
+		s.mu.Unlock()
+		for _, cmd := range cmds {
+			if !f(GetSeq64(cmd.output), cmd) {
+				return
+			}
+		}
+	}
+}
+
+// Len returns the number of the pending calls.
+func (m *callCmdMap) Len() int {
+	return int(atomic.LoadInt64(&m.count))
+}
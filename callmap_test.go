@@ -0,0 +1,78 @@
+package erpc
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/andeya/goutil"
+)
+
+func newSeqCallCmd(seq uint64) *callCmd {
+	output := GetMessage()
+	setSeq64(output, seq)
+	return &callCmd{output: output}
+}
+
+func TestCallCmdMap(t *testing.T) {
+	m := newCallCmdMap()
+	// crosses the boundary of the high 32 bits
+	for i := uint64(1<<32 - 50); i < 1<<32+50; i++ {
+		m.Store(i, newSeqCallCmd(i))
+	}
+	m.Store(1<<32+1, newSeqCallCmd(1<<32+1))
+	if m.Len() != 100 {
+		t.Fatalf("len: %d", m.Len())
+	}
+	if cmd, ok := m.Load(1<<32 - 7); !ok || GetSeq64(cmd.output) != 1<<32-7 {
+		t.Fatalf("load: %v %v", cmd, ok)
+	}
+	var n int
+	m.Range(func(seq uint64, cmd *callCmd) bool {
+		m.Delete(seq)
+		n++
+		return true
+	})
+	if n != 100 || m.Len() != 0 {
+		t.Fatalf("range: %d, len: %d", n, m.Len())
+	}
+	if _, ok := m.Load(1<<32 - 7); ok {
+		t.Fatal("deleted")
+	}
+}
+
+// benchmarkPendingCalls stores, loads and deletes the new seqs concurrently, like the pending calls.
+func benchmarkPendingCalls(b *testing.B, store func(uint64, *callCmd), load func(uint64) bool, del func(uint64)) {
+	var seq uint64
+	cmd := new(callCmd)
+	b.SetParallelism(64)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s := atomic.AddUint64(&seq, 1)
+			store(s, cmd)
+			if !load(s) {
+				b.Fatal("not found")
+			}
+			del(s)
+		}
+	})
+}
+
+func BenchmarkPendingCallsAtomicMap(b *testing.B) {
+	m := goutil.AtomicMap()
+	benchmarkPendingCalls(b,
+		func(seq uint64, cmd *callCmd) { m.Store(seq, cmd) },
+		func(seq uint64) bool { _, ok := m.Load(seq); return ok },
+		func(seq uint64) { m.Delete(seq) },
+	)
+}
+
+func BenchmarkPendingCallsSharded(b *testing.B) {
+	m := newCallCmdMap()
+	benchmarkPendingCalls(b,
+		m.Store,
+		func(seq uint64) bool { _, ok := m.Load(seq); return ok },
+		m.Delete,
+	)
+}
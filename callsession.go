@@ -0,0 +1,116 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"context"
+	"time"
+)
+
+type sessionWaitKey struct{}
+
+// WithSessionWait sets the maximum duration of waiting for the session to be connected by the id,
+// in Peer.CallSession and Peer.PushSession.
+// If the session is disconnected before replying the CALL, the CALL is sent again
+// on the session reconnected with the same id in the duration.
+// NOTE:
+//  The client keeps its session id on the server across redials by the auth plugin calling SetID,
+//  or plugin/resume;
+//  The CALL may be handled more than once, only for idempotent calls,
+//  or deduplicate them by the idempotency key, e.g. plugin/dedup.
+func WithSessionWait(d time.Duration) MessageSetting {
+	return func(m Message) {
+		WithContext(context.WithValue(m.Context(), sessionWaitKey{}, d))(m)
+	}
+}
+
+func getSessionWait(setting []MessageSetting) time.Duration {
+	m := GetMessage(setting...)
+	d, _ := m.Context().Value(sessionWaitKey{}).(time.Duration)
+	PutMessage(m)
+	return d
+}
+
+// CallSession sends a CALL to the session by the id, e.g. the server calls the connected agent,
+// and waits for the reply.
+// NOTE:
+//  The session is waited for by WithSessionWait, if it is not connected;
+//  If the session is not found, the status code is CodeSessionNotFound.
+func (p *peer) CallSession(sessionID, serviceMethod string, args, result interface{}, setting ...MessageSetting) CallCmd {
+	var (
+		deadline = time.Now().Add(getSessionWait(setting))
+		last     *session
+	)
+	for {
+		sess, ok := p.waitSession(sessionID, deadline, last)
+		if !ok {
+			return NewFakeCallCmd(serviceMethod, args, result, statSessionNotFound.Copy(sessionID))
+		}
+		callCmd := sess.Call(serviceMethod, args, result, setting...)
+		if !retrySessionCall(callCmd.Status()) || callCmd.Context().Err() != nil || sess.Health() || !time.Now().Before(deadline) {
+			return callCmd
+		}
+		Debugf("the session %s is disconnected before replying %s, wait for it to reconnect", sessionID, serviceMethod)
+		last = sess
+	}
+}
+
+// PushSession sends a PUSH to the session by the id.
+// NOTE:
+//  The session is waited for by WithSessionWait, if it is not connected;
+//  If the session is not found, the status code is CodeSessionNotFound.
+func (p *peer) PushSession(sessionID, serviceMethod string, args interface{}, setting ...MessageSetting) *Status {
+	sess, ok := p.waitSession(sessionID, time.Now().Add(getSessionWait(setting)), nil)
+	if !ok {
+		return statSessionNotFound.Copy(sessionID)
+	}
+	return sess.Push(serviceMethod, args, setting...)
+}
+
+// waitSession waits for the healthy session by the id until the deadline, except the last one.
+func (p *peer) waitSession(sessionID string, deadline time.Time, last *session) (*session, bool) {
+	interval := 10 * time.Millisecond
+	for {
+		sess, ok := p.sessHub.get(sessionID)
+		if ok && sess != last && sess.Health() {
+			return sess, true
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil, false
+		}
+		if wait > interval {
+			wait = interval
+		}
+		select {
+		case <-p.closeCh:
+			return nil, false
+		case <-time.After(wait):
+		}
+		if interval < 100*time.Millisecond {
+			interval *= 2
+		}
+	}
+}
+
+// retrySessionCall reports whether the CALL failed for the disconnection.
+func retrySessionCall(stat *Status) bool {
+	switch stat.Code() {
+	case CodeConnClosed, CodeWriteFailed, CodeCallCanceled:
+		return true
+	default:
+		return false
+	}
+}
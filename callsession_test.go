@@ -0,0 +1,126 @@
+package erpc_test
+
+import (
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7/plugin/resume"
+)
+
+// relay forwards the connections to the target, and breaks them by breakAll.
+type relay struct {
+	net.Listener
+	target string
+	mu     sync.Mutex
+	conns  []net.Conn
+}
+
+func newRelay(t *testing.T, target string) *relay {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &relay{Listener: lis, target: target}
+	go func() {
+		for {
+			c, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			s, err := net.Dial("tcp", target)
+			if err != nil {
+				c.Close()
+				continue
+			}
+			r.mu.Lock()
+			r.conns = append(r.conns, c, s)
+			r.mu.Unlock()
+			go io.Copy(c, s)
+			go io.Copy(s, c)
+		}
+	}()
+	return r
+}
+
+func (r *relay) breakAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.conns {
+		c.Close()
+	}
+	r.conns = nil
+}
+
+var (
+	agentCalled int32
+	agentIDs    = make(chan string, 1)
+)
+
+// agent_register sends the session id of the agent.
+func agent_register(ctx erpc.CallCtx, _ *struct{}) (string, *erpc.Status) {
+	agentIDs <- ctx.Session().ID()
+	return "", nil
+}
+
+type agent struct {
+	erpc.CallCtx
+}
+
+// Exec sleeps 300ms at the first time.
+func (a *agent) Exec(cmd *string) (string, *erpc.Status) {
+	if atomic.AddInt32(&agentCalled, 1) == 1 {
+		time.Sleep(300 * time.Millisecond)
+	}
+	return "done: " + *cmd, nil
+}
+
+func TestCallSession(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{}, resume.NewServerPlugin(time.Second))
+	defer srv.Close()
+	srv.RouteCallFunc(agent_register)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	r := newRelay(t, lis.Addr().String())
+	defer r.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{RedialTimes: 10, RedialInterval: 50 * time.Millisecond}, resume.NewClientPlugin())
+	defer cli.Close()
+	cli.RouteCall(new(agent))
+	sess, stat := cli.Dial(r.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	if stat = sess.Call("/agent/register", nil, nil).Status(); !stat.OK() {
+		t.Fatal(stat)
+	}
+	id := <-agentIDs
+
+	var result string
+	if stat = srv.CallSession("not-found", "/agent/exec", "ls", &result).Status(); stat.Code() != erpc.CodeSessionNotFound {
+		t.Fatalf("expect session not found, got %v", stat)
+	}
+
+	// the connection is broken before replying, the call is sent again on the resumed session
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		r.breakAll()
+	}()
+	stat = srv.CallSession(id, "/agent/exec", "ls", &result, erpc.WithSessionWait(2*time.Second)).Status()
+	if !stat.OK() || result != "done: ls" {
+		t.Fatalf("result: %q, stat: %v", result, stat)
+	}
+	if n := atomic.LoadInt32(&agentCalled); n != 2 {
+		t.Fatalf("called: %d, expect 2", n)
+	}
+	if stat = srv.PushSession(id, "/agent/unknown", nil); !stat.OK() {
+		t.Fatal(stat)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// Clock the source of the time, used by the session age, context age, heartbeat and redial timers.
+	// NOTE:
+	//  Inject it by PeerConfig.Clock, e.g. a fake clock to fast-forward the time in tests, see erpctest.Clock;
+	//  The cost time of PeerConfig.CountTime is always measured by the system clock.
+	Clock interface {
+		// Now returns the current time.
+		Now() time.Time
+		// AfterFunc waits for the duration to elapse and then calls f in its own goroutine,
+		// and returns a Timer that can be used to cancel the call.
+		AfterFunc(d time.Duration, f func()) Timer
+	}
+	// Timer the timer created by Clock.AfterFunc.
+	Timer interface {
+		// Stop prevents the Timer from firing, and reports whether it is stopped before firing.
+		Stop() bool
+	}
+)
+
+// SystemClock the clock of the time package, the default one.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+func isSystemClock(clock Clock) bool {
+	_, ok := clock.(systemClock)
+	return ok
+}
+
+// ClockSleep pauses the current goroutine for at least the duration by the clock.
+func ClockSleep(clock Clock, d time.Duration) {
+	if isSystemClock(clock) {
+		time.Sleep(d)
+		return
+	}
+	<-ClockAfter(clock, d)
+}
+
+// ClockAfter waits for the duration to elapse by the clock, and then sends the current time on the returned channel.
+func ClockAfter(clock Clock, d time.Duration) <-chan time.Time {
+	if isSystemClock(clock) {
+		return time.After(d)
+	}
+	ch := make(chan time.Time, 1)
+	clock.AfterFunc(d, func() { ch <- clock.Now() })
+	return ch
+}
+
+// ClockWithTimeout returns a copy of the parent context, which is canceled after the timeout by the clock,
+// and its Err returns context.DeadlineExceeded.
+func ClockWithTimeout(clock Clock, parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if isSystemClock(clock) {
+		return context.WithTimeout(parent, timeout)
+	}
+	inner, cancel := context.WithCancel(parent)
+	c := &clockCtx{Context: inner, deadline: clock.Now().Add(timeout)}
+	if timeout <= 0 {
+		c.expire(cancel)
+		return c, cancel
+	}
+	timer := clock.AfterFunc(timeout, func() { c.expire(cancel) })
+	return c, func() {
+		timer.Stop()
+		cancel()
+	}
+}
+
+// clockCtx the context with the deadline by the clock.
+type clockCtx struct {
+	context.Context
+	deadline time.Time
+	mu       sync.Mutex
+	expired  bool
+}
+
+func (c *clockCtx) expire(cancel context.CancelFunc) {
+	c.mu.Lock()
+	if c.Context.Err() == nil {
+		c.expired = true
+	}
+	cancel()
+	c.mu.Unlock()
+}
+
+func (c *clockCtx) Deadline() (time.Time, bool) {
+	if d, ok := c.Context.Deadline(); ok && d.Before(c.deadline) {
+		return d, true
+	}
+	return c.deadline, true
+}
+
+func (c *clockCtx) Err() error {
+	c.mu.Lock()
+	expired := c.expired
+	c.mu.Unlock()
+	if expired {
+		return context.DeadlineExceeded
+	}
+	return c.Context.Err()
+}
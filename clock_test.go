@@ -0,0 +1,92 @@
+package erpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7/erpctest"
+)
+
+func TestClockContextAge(t *testing.T) {
+	clock := erpctest.NewClock(time.Now())
+	errCh := make(chan error, 1)
+	started := make(chan struct{})
+	srv, cli, sess := erpc.NewPipePeerPair(erpc.PeerConfig{DefaultContextAge: time.Minute, Clock: clock}, erpc.PeerConfig{})
+	defer srv.Close()
+	defer cli.Close()
+	srv.RoutePushFunc(func(ctx erpc.PushCtx, _ *struct{}) *erpc.Status {
+		close(started)
+		<-ctx.Context().Done()
+		errCh <- ctx.Context().Err()
+		return nil
+	})
+	if stat := sess.Push("/func1", nil); !stat.OK() {
+		t.Fatal(stat)
+	}
+	<-started
+	clock.Advance(59 * time.Second)
+	select {
+	case err := <-errCh:
+		t.Fatalf("expired early: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	clock.Advance(time.Second)
+	select {
+	case err := <-errCh:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("err: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the context age is not expired by the clock")
+	}
+}
+
+func TestClockSessionAge(t *testing.T) {
+	clock := erpctest.NewClock(time.Now())
+	srv := erpc.NewPeer(erpc.PeerConfig{DefaultSessionAge: time.Hour, Clock: clock})
+	defer srv.Close()
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	if _, stat := erpc.ConnectPipe(srv, cli); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if !clock.WaitTimers(1, time.Second) {
+		t.Fatal("the session age timer is not set")
+	}
+	clock.Advance(time.Hour)
+	for i := 0; srv.CountSession() > 0; i++ {
+		if i > 100 {
+			t.Fatal("the session is not closed after the session age")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClockWithTimeout(t *testing.T) {
+	clock := erpctest.NewClock(time.Now())
+	ctx, cancel := erpc.ClockWithTimeout(clock, context.Background(), time.Second)
+	if deadline, ok := ctx.Deadline(); !ok || !deadline.Equal(clock.Now().Add(time.Second)) {
+		t.Fatalf("deadline: %v", deadline)
+	}
+	cancel()
+	<-ctx.Done()
+	if ctx.Err() != context.Canceled {
+		t.Fatalf("err: %v", ctx.Err())
+	}
+	if n := clock.Timers(); n != 0 {
+		t.Fatalf("the timer is not stopped: %d", n)
+	}
+	done := make(chan struct{})
+	go func() {
+		erpc.ClockSleep(clock, time.Hour)
+		close(done)
+	}()
+	clock.WaitTimers(1, time.Second)
+	clock.Advance(time.Hour)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("not woken up")
+	}
+}
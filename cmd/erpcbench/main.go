@@ -0,0 +1,241 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command erpcbench benchmarks the erpc calls by the erpcbench package, running the combinations of the networks, codecs,
+// concurrency and payload sizes, and reports the throughput and the latency percentiles, to compare the tuning options;
+// the latency distributions can be recorded to a file, and the compare mode fails if the P99 regresses between two records.
+//
+// Usage:
+//  erpcbench -network tcp,kcp,quic -codec protobuf,json -c 1,16,64 -size 128,4096 -n 100000
+//  erpcbench -serve -addr :8972
+//  erpcbench -addr 192.168.1.2:8972 -c 64 -duration 30s -v
+//  erpcbench -c 16 -n 100000 -record current.json -label $(git rev-parse --short HEAD)
+//  erpcbench compare -p 99 -threshold 0.1 base.json current.json
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/erpcbench"
+	"github.com/andeya/erpc/v7/proto/jsonproto"
+	"github.com/andeya/erpc/v7/proto/pbproto"
+)
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	if err := run(ctx, os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "erpcbench:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdout io.Writer) error {
+	if len(args) > 0 && args[0] == "compare" {
+		return compare(args[1:], stdout)
+	}
+	fs := flag.NewFlagSet("erpcbench", flag.ContinueOnError)
+	var (
+		serve     = fs.Bool("serve", false, "only run the benchmark server on -addr")
+		delay     = fs.Duration("delay", 0, "the delay of the server to mock the business processing")
+		addr      = fs.String("addr", "", "the address of the server, empty means starting a local one for each run")
+		networks  = fs.String("network", "tcp", "the comma-separated networks, e.g. tcp,kcp,quic")
+		protoName = fs.String("proto", "raw", "the protocol: raw, json or pb")
+		codecs    = fs.String("codec", "protobuf", "the comma-separated body codecs, e.g. protobuf,json")
+		conc      = fs.String("c", "1", "the comma-separated numbers of the concurrent callers")
+		sizes     = fs.String("size", "128", "the comma-separated payload sizes in bytes")
+		sessions  = fs.Int("sessions", 1, "the number of the sessions shared by the callers")
+		requests  = fs.Int("n", 10000, "the number of the calls of each run")
+		duration  = fs.Duration("duration", 0, "the duration of each run, instead of -n")
+		warmup    = fs.Int("warmup", 5, "the number of the warmup calls of each caller")
+		digits    = fs.Int("digits", 3, "the significant digits of the latency histogram")
+		seed      = fs.Int64("seed", 1, "the seed of the payload data")
+		verbose   = fs.Bool("v", false, "print the percentile distribution of each run")
+		recordTo  = fs.String("record", "", "the file to record the latency distributions of the runs, for the compare mode")
+		label     = fs.String("label", "", "the label of the record, e.g. the commit")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	erpc.SetLoggerLevel("ERROR")
+	var protoFunc erpc.ProtoFunc
+	switch *protoName {
+	case "raw":
+		protoFunc = erpc.DefaultProtoFunc()
+	case "json":
+		protoFunc = jsonproto.NewJSONProtoFunc()
+	case "pb":
+		protoFunc = pbproto.NewPbProtoFunc()
+	default:
+		return fmt.Errorf("unknown protocol %q", *protoName)
+	}
+
+	if *serve {
+		if *addr == "" {
+			return errors.New("-serve requires -addr")
+		}
+		srv, err := erpcbench.NewServer(erpcbench.ServerConfig{
+			Network: split(*networks)[0],
+			Addr:    *addr,
+			Delay:   *delay,
+			Options: []erpc.Plugin{erpc.WithProtoFunc(protoFunc)},
+		})
+		if err != nil {
+			return err
+		}
+		defer srv.Close()
+		fmt.Fprintf(stdout, "serving %s on %s\n", erpcbench.ServiceMethod, srv.Addr())
+		<-ctx.Done()
+		return nil
+	}
+
+	concs, err := splitInts(*conc)
+	if err != nil {
+		return err
+	}
+	payloadSizes, err := splitInts(*sizes)
+	if err != nil {
+		return err
+	}
+	record := erpcbench.NewRecord(*label)
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "network\tcodec\tconcurrency\tsize\trequests\terrors\tTPS\tmean\tp50\tp90\tp99\tp99.9\tmax\t")
+	for _, network := range split(*networks) {
+		for _, codecName := range split(*codecs) {
+			for _, c := range concs {
+				for _, size := range payloadSizes {
+					if ctx.Err() != nil {
+						return flush(tw, record, *recordTo)
+					}
+					res, err := erpcbench.Run(ctx, erpcbench.Config{
+						Network:           network,
+						Addr:              *addr,
+						ProtoFunc:         protoFunc,
+						BodyCodec:         codecName,
+						Concurrency:       c,
+						Sessions:          *sessions,
+						Requests:          *requests,
+						Duration:          *duration,
+						PayloadSize:       size,
+						Warmup:            *warmup,
+						SignificantDigits: *digits,
+						Seed:              *seed,
+					})
+					if err != nil {
+						tw.Flush()
+						return fmt.Errorf("%s/%s/%d/%d: %w", network, codecName, c, size, err)
+					}
+					record.Add(res.Name(), res.Latency, res.Errors)
+					h := res.Latency
+					fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%.0f\t%s\t%s\t%s\t%s\t%s\t%s\t\n",
+						network, codecName, c, size, res.Requests, res.Errors, res.TPS(), time.Duration(h.Mean()),
+						h.Percentile(50), h.Percentile(90), h.Percentile(99), h.Percentile(99.9), h.Percentile(100))
+					if *verbose {
+						tw.Flush()
+						if err = res.WriteReport(stdout); err != nil {
+							return err
+						}
+						fmt.Fprintln(stdout)
+					}
+				}
+			}
+		}
+	}
+	return flush(tw, record, *recordTo)
+}
+
+// flush flushes the table and writes the record file if any.
+func flush(tw *tabwriter.Writer, record *erpcbench.Record, filename string) error {
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if filename == "" {
+		return nil
+	}
+	return record.WriteFile(filename)
+}
+
+// compare compares the current record with the base one, and returns the error if the latency regresses.
+func compare(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("erpcbench compare", flag.ContinueOnError)
+	var (
+		percentile = fs.Float64("p", 99, "the compared percentile")
+		threshold  = fs.Float64("threshold", 0.1, "the max ratio of the increase of the percentile latency, e.g. 0.1 means 10%")
+		minCount   = fs.Uint64("min-count", 1, "the min number of the latencies to compare")
+	)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: erpcbench compare [flags] <base record> <current record>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("compare requires the base and the current record files")
+	}
+	base, err := erpcbench.ReadRecordFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	current, err := erpcbench.ReadRecordFile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	c := erpcbench.Compare(base, current, erpcbench.CompareOptions{
+		Percentile: *percentile,
+		Threshold:  *threshold,
+		MinCount:   *minCount,
+	})
+	if err = c.WriteReport(stdout); err != nil {
+		return err
+	}
+	return c.Err()
+}
+
+func split(s string) []string {
+	var a []string
+	for _, x := range strings.Split(s, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			a = append(a, x)
+		}
+	}
+	if len(a) == 0 {
+		a = append(a, "")
+	}
+	return a
+}
+
+func splitInts(s string) ([]int, error) {
+	var a []int
+	for _, x := range split(s) {
+		n, err := strconv.Atoi(x)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("bad positive number %q", x)
+		}
+		a = append(a, n)
+	}
+	return a, nil
+}
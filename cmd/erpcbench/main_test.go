@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7/erpcbench"
+)
+
+func TestRun(t *testing.T) {
+	var out bytes.Buffer
+	if err := run(context.Background(), []string{"-codec", "protobuf,json", "-c", "1,2", "-size", "64", "-n", "50"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 || !strings.Contains(lines[0], "p99.9") || strings.Join(strings.Fields(lines[4])[:6], " ") != "tcp json 2 64 50 0" {
+		t.Fatalf("bad report:\n%s", out.String())
+	}
+	if err := run(context.Background(), []string{"-c", "0"}, &out); err == nil {
+		t.Fatal("expect the error of the bad concurrency")
+	}
+
+	dir := t.TempDir()
+	base, current := filepath.Join(dir, "base.json"), filepath.Join(dir, "current.json")
+	if err := run(context.Background(), []string{"-n", "50", "-record", base}, &out); err != nil {
+		t.Fatal(err)
+	}
+	srv, err := erpcbench.NewServer(erpcbench.ServerConfig{Delay: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	if err = run(context.Background(), []string{"-n", "20", "-addr", srv.Addr(), "-record", current}, &out); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err = run(context.Background(), []string{"compare", base, base}, &out); err != nil || !strings.Contains(out.String(), "tcp/protobuf/c1/128B") {
+		t.Fatalf("out: %s, err: %v", out.String(), err)
+	}
+	if err = run(context.Background(), []string{"compare", "-threshold", "0.5", base, current}, &out); err == nil || !strings.Contains(err.Error(), "regressed") {
+		t.Fatalf("expect the regression, got %v", err)
+	}
+}
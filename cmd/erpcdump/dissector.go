@@ -0,0 +1,120 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// dissectorLua the Wireshark Lua dissector of the default (raw) protocol.
+// NOTE: The frames with the transfer filters are shown without decoding the payload.
+const dissectorLua = `-- Wireshark dissector of the erpc default (raw) protocol, generated by erpcdump -dissector.
+-- Usage: wireshark -X lua_script:erpc.lua, or copy it to the personal plugins directory.
+local erpc = Proto("erpc", "erpc raw protocol")
+
+local mtypes = { [1] = "CALL", [2] = "REPLY", [3] = "PUSH", [4] = "AUTH_CALL", [5] = "AUTH_REPLY" }
+
+local f = erpc.fields
+f.size = ProtoField.uint32("erpc.size", "Size")
+f.xfer = ProtoField.bytes("erpc.xfer", "Transfer filters")
+f.seq = ProtoField.string("erpc.seq", "Seq (base 36)")
+f.mtype = ProtoField.uint8("erpc.mtype", "Type", base.DEC, mtypes, 0x7f)
+f.ext_flag = ProtoField.bool("erpc.ext_flag", "Extensions", 8, nil, 0x80)
+f.service_method = ProtoField.string("erpc.service_method", "Service method")
+f.status = ProtoField.string("erpc.status", "Status")
+f.meta = ProtoField.string("erpc.meta", "Metadata")
+f.extensions = ProtoField.bytes("erpc.extensions", "Extensions")
+f.body_codec = ProtoField.char("erpc.body_codec", "Body codec")
+f.body = ProtoField.bytes("erpc.body", "Body")
+
+erpc.prefs.port = Pref.uint("TCP port", {{PORT}}, "The TCP port of the erpc sessions")
+
+local function frame_len(tvb, pinfo, offset)
+	return tvb(offset, 4):uint()
+end
+
+local function dissect_frame(tvb, pinfo, tree)
+	pinfo.cols.protocol = "ERPC"
+	local t = tree:add(erpc, tvb())
+	t:add(f.size, tvb(0, 4))
+	local off = 4
+	local xfer_len = tvb(off, 1):uint()
+	if xfer_len > 0 then
+		t:add(f.xfer, tvb(off + 1, xfer_len))
+		t:add(f.body, tvb(off + 1 + xfer_len))
+		pinfo.cols.info:append(" [filtered]")
+		return tvb:len()
+	end
+	off = off + 1
+	local seq_len = tvb(off, 1):uint()
+	local seq = tvb(off + 1, seq_len):string()
+	t:add(f.seq, tvb(off + 1, seq_len))
+	off = off + 1 + seq_len
+	local mtype = tvb(off, 1):uint()
+	t:add(f.mtype, tvb(off, 1))
+	t:add(f.ext_flag, tvb(off, 1))
+	off = off + 1
+	local sm_len = tvb(off, 1):uint()
+	local sm = ""
+	if sm_len > 0 then
+		sm = tvb(off + 1, sm_len):string()
+		t:add(f.service_method, tvb(off + 1, sm_len))
+	end
+	off = off + 1 + sm_len
+	for _, field in ipairs({ f.status, f.meta }) do
+		local n = tvb(off, 2):uint()
+		if n > 0 then
+			t:add(field, tvb(off + 2, n))
+		end
+		off = off + 2 + n
+	end
+	if bit.band(mtype, 0x80) ~= 0 then
+		local n = tvb(off, 2):uint()
+		t:add(f.extensions, tvb(off + 2, n))
+		off = off + 2 + n
+	end
+	t:add(f.body_codec, tvb(off, 1))
+	off = off + 1
+	if off < tvb:len() then
+		t:add(f.body, tvb(off))
+	end
+	pinfo.cols.info:append(" " .. (mtypes[bit.band(mtype, 0x7f)] or "Undefined") .. " seq=" .. tonumber(seq, 36) .. " " .. sm)
+	return tvb:len()
+end
+
+function erpc.dissector(tvb, pinfo, tree)
+	dissect_tcp_pdus(tvb, tree, 4, frame_len, dissect_frame)
+	return tvb:len()
+end
+
+local port = erpc.prefs.port
+DissectorTable.get("tcp.port"):add(port, erpc)
+
+function erpc.prefs_changed()
+	if port ~= erpc.prefs.port then
+		DissectorTable.get("tcp.port"):remove(port, erpc)
+		port = erpc.prefs.port
+		DissectorTable.get("tcp.port"):add(port, erpc)
+	end
+end
+`
+
+// writeDissector writes the Wireshark Lua dissector of the TCP port.
+func writeDissector(w io.Writer, port int) error {
+	_, err := io.WriteString(w, strings.Replace(dissectorLua, "{{PORT}}", strconv.Itoa(port), 1))
+	return err
+}
@@ -0,0 +1,221 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/codec"
+	"github.com/andeya/erpc/v7/proto"
+)
+
+// maxPending the max number of the out-of-order segments buffered by a stream
+const maxPending = 1024
+
+// dumper decodes the frames of the streams, and prints the transcripts.
+type dumper struct {
+	w         io.Writer
+	protoFunc erpc.ProtoFunc
+	limits    proto.Limits
+	// codecHint the body codec used to print the bodies without the codec id
+	codecHint byte
+	// maxBody the max number of the body bytes printed, 0 means no limit
+	maxBody int
+	// hexBody prints all the bodies as the hex dump
+	hexBody bool
+	streams map[string]*stream
+	frames  int
+}
+
+// stream the reassembled bytes of one direction of a TCP connection.
+type stream struct {
+	src, dst string
+	started  bool
+	broken   bool
+	next     uint32
+	pending  map[uint32][]byte
+	buf      []byte
+}
+
+// addSegment reassembles the TCP segment, and prints the completed frames.
+func (d *dumper) addSegment(t time.Time, seg *segment) {
+	key := seg.src + ">" + seg.dst
+	s := d.streams[key]
+	if s == nil || seg.syn {
+		s = &stream{src: seg.src, dst: seg.dst, pending: make(map[uint32][]byte)}
+		d.streams[key] = s
+	}
+	if seg.syn {
+		s.started, s.next = true, seg.seq+1
+	} else if !s.started {
+		// NOTE: the capture may begin in the middle of the connection
+		s.started, s.next = true, seg.seq
+	}
+	if len(seg.payload) > 0 {
+		if diff := int32(seg.seq - s.next); diff > 0 {
+			if len(s.pending) < maxPending {
+				s.pending[seg.seq] = seg.payload
+			}
+		} else {
+			s.append(seg.payload, -diff)
+			s.flushPending()
+		}
+		d.decode(t, s)
+	}
+	if seg.fin {
+		if len(s.buf) > 0 && !s.broken {
+			fmt.Fprintf(d.w, "%s %s > %s incomplete frame of %d bytes\n", formatTime(t), s.src, s.dst, len(s.buf))
+		}
+		delete(d.streams, key)
+	}
+}
+
+// append appends the payload skipping the overlap bytes of the retransmission.
+func (s *stream) append(payload []byte, overlap int32) {
+	if int(overlap) >= len(payload) {
+		return
+	}
+	payload = payload[overlap:]
+	s.buf = append(s.buf, payload...)
+	s.next += uint32(len(payload))
+}
+
+func (s *stream) flushPending() {
+	for len(s.pending) > 0 {
+		found := false
+		for seq, payload := range s.pending {
+			if diff := int32(seq - s.next); diff <= 0 {
+				delete(s.pending, seq)
+				s.append(payload, -diff)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return
+		}
+	}
+}
+
+// decode prints the completed frames of the stream.
+func (d *dumper) decode(t time.Time, s *stream) {
+	for !s.broken && len(s.buf) > 0 {
+		r := bytes.NewReader(s.buf)
+		m, err := proto.Decode(r, d.limits, d.protoFunc)
+		if err == io.ErrUnexpectedEOF {
+			// waits for the rest of the frame
+			return
+		}
+		if err != nil {
+			// NOTE: the frame boundary is lost, so the rest of the stream is skipped
+			fmt.Fprintf(d.w, "%s %s > %s decode error: %s\n", formatTime(t), s.src, s.dst, err)
+			s.broken, s.buf = true, nil
+			return
+		}
+		s.buf = s.buf[len(s.buf)-r.Len():]
+		d.print(t, s.src, s.dst, m)
+		erpc.PutMessage(m)
+	}
+}
+
+// dumpRaw prints the frames of the raw capture, i.e. the bytes of one direction of a connection.
+func (d *dumper) dumpRaw(data []byte) {
+	s := &stream{src: "-", dst: "-", buf: data}
+	d.decode(time.Time{}, s)
+	if len(s.buf) > 0 && !s.broken {
+		fmt.Fprintf(d.w, "incomplete frame of %d bytes\n", len(s.buf))
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format("15:04:05.000000")
+}
+
+// print prints the transcript of the message.
+func (d *dumper) print(t time.Time, src, dst string, m erpc.Message) {
+	d.frames++
+	fmt.Fprintf(d.w, "%s %s > %s %s seq=%d", formatTime(t), src, dst, erpc.TypeText(m.Mtype()), m.Seq())
+	if sm := m.ServiceMethod(); sm != "" {
+		fmt.Fprintf(d.w, " %s", sm)
+	}
+	fmt.Fprintf(d.w, " size=%d\n", m.Size())
+	if m.XferPipe().Len() > 0 {
+		fmt.Fprintf(d.w, "    xfer: %s\n", strings.Join(m.XferPipe().Names(), ","))
+	}
+	if stat := m.Status(); !stat.OK() {
+		fmt.Fprintf(d.w, "    status: code=%d msg=%q", stat.Code(), stat.Msg())
+		if cause := stat.Cause(); cause != nil {
+			fmt.Fprintf(d.w, " cause=%q", cause.Error())
+		}
+		fmt.Fprintln(d.w)
+	}
+	if m.Meta().Len() > 0 {
+		fmt.Fprintf(d.w, "    meta: %s\n", m.Meta().QueryString())
+	}
+	m.Extensions().VisitAll(func(typ byte, value []byte) {
+		fmt.Fprintf(d.w, "    extension 0x%02x: %x\n", typ, value)
+	})
+	body, _ := m.Body().(*[]byte)
+	if body == nil || len(*body) == 0 {
+		return
+	}
+	id := m.BodyCodec()
+	if id == codec.NilCodecID {
+		id = d.codecHint
+	}
+	name := codecName(id)
+	b := *body
+	var suffix string
+	if d.maxBody > 0 && len(b) > d.maxBody {
+		b, suffix = b[:d.maxBody], fmt.Sprintf("... (%d bytes)", len(*body))
+	}
+	if !d.hexBody && isText(id) && utf8.Valid(b) {
+		fmt.Fprintf(d.w, "    body(%s): %s%s\n", name, b, suffix)
+		return
+	}
+	fmt.Fprintf(d.w, "    body(%s):%s\n", name, suffix)
+	for _, line := range strings.Split(strings.TrimSuffix(hex.Dump(b), "\n"), "\n") {
+		fmt.Fprintf(d.w, "      %s\n", line)
+	}
+}
+
+func codecName(id byte) string {
+	if id == codec.NilCodecID {
+		return "unknown"
+	}
+	if c, err := codec.Get(id); err == nil {
+		return c.Name()
+	}
+	return fmt.Sprintf("0x%02x", id)
+}
+
+// isText reports whether the body of the codec is printable text.
+func isText(id byte) bool {
+	switch id {
+	case codec.ID_JSON, codec.ID_PLAIN, codec.ID_FORM, codec.ID_XML:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command erpcdump prints the human-readable transcripts of the erpc frames in the pcap or raw capture files,
+// to debug the interop issues between the versions.
+//
+// Usage:
+//  tcpdump -i lo -w erpc.pcap tcp port 9090
+//  erpcdump -r erpc.pcap -port 9090
+//  erpcdump -r frames.bin -format raw -proto json
+//  erpcdump -dissector -port 9090 > erpc.lua
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/codec"
+	"github.com/andeya/erpc/v7/proto"
+	"github.com/andeya/erpc/v7/proto/jsonproto"
+	"github.com/andeya/erpc/v7/proto/pbproto"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "erpcdump:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("erpcdump", flag.ContinueOnError)
+	var (
+		file      = fs.String("r", "-", "the capture file, - means stdin")
+		format    = fs.String("format", "auto", "the capture format: auto, pcap or raw (the bytes of one direction of a connection)")
+		protoName = fs.String("proto", "raw", "the protocol of the frames: raw, json or pb")
+		port      = fs.Int("port", 0, "only decode the TCP segments of the port in the pcap file, 0 means all")
+		codecHint = fs.String("codec", "", "the body codec name used for the bodies without the codec id, e.g. json")
+		hexBody   = fs.Bool("hex", false, "print all the bodies as the hex dump")
+		maxBody   = fs.Int("max-body", 1024, "the max number of the body bytes printed, 0 means no limit")
+		maxSize   = fs.Uint("max-size", 0, "the max size of a frame, 0 means the default of proto.Decode")
+		dissector = fs.Bool("dissector", false, "write the Wireshark Lua dissector of the raw protocol on the port, instead of dumping")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	w := bufio.NewWriter(stdout)
+	defer w.Flush()
+	if *dissector {
+		if *port <= 0 {
+			return errors.New("-dissector requires -port")
+		}
+		return writeDissector(w, *port)
+	}
+	d := &dumper{
+		w:       w,
+		limits:  proto.Limits{MaxMessageSize: uint32(*maxSize)},
+		maxBody: *maxBody,
+		hexBody: *hexBody,
+		streams: make(map[string]*stream),
+	}
+	switch *protoName {
+	case "raw":
+		d.protoFunc = erpc.DefaultProtoFunc()
+	case "json":
+		d.protoFunc = jsonproto.NewJSONProtoFunc()
+	case "pb":
+		d.protoFunc = pbproto.NewPbProtoFunc()
+	default:
+		return fmt.Errorf("unknown protocol %q", *protoName)
+	}
+	if *codecHint != "" {
+		c, err := codec.GetByName(*codecHint)
+		if err != nil {
+			return err
+		}
+		d.codecHint = c.ID()
+	}
+	var r io.Reader = stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	br := bufio.NewReader(r)
+	if *format == "auto" {
+		head, _ := br.Peek(4)
+		if isPcap(head) {
+			*format = "pcap"
+		} else {
+			*format = "raw"
+		}
+	}
+	switch *format {
+	case "pcap":
+		return d.dumpPcap(br, *port)
+	case "raw":
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return err
+		}
+		d.dumpRaw(data)
+		return nil
+	}
+	return fmt.Errorf("unknown format %q", *format)
+}
+
+// dumpPcap prints the frames of the TCP segments in the pcap file.
+func (d *dumper) dumpPcap(r io.Reader, port int) error {
+	p, err := newPcapReader(r)
+	if err != nil {
+		return err
+	}
+	portStr := strconv.Itoa(port)
+	for {
+		t, data, err := p.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		seg, ok := parsePacket(p.linkType, data)
+		if !ok {
+			continue
+		}
+		if port > 0 && !hasPort(seg.src, portStr) && !hasPort(seg.dst, portStr) {
+			continue
+		}
+		d.addSegment(t, seg)
+	}
+}
+
+func hasPort(addr, port string) bool {
+	_, p, _ := net.SplitHostPort(addr)
+	return p == port
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andeya/erpc/v7"
+)
+
+func pack(t *testing.T, mtype byte, seq int32, setting ...erpc.MessageSetting) []byte {
+	var buf bytes.Buffer
+	m := erpc.GetMessage(setting...)
+	defer erpc.PutMessage(m)
+	m.SetMtype(mtype)
+	m.SetSeq(seq)
+	if err := erpc.DefaultProtoFunc()(&buf).Pack(m); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// tcpPacket builds the Ethernet/IPv4/TCP packet.
+func tcpPacket(srcPort, dstPort uint16, seq uint32, syn bool, payload []byte) []byte {
+	tcp := make([]byte, 20)
+	binary.BigEndian.PutUint16(tcp[0:], srcPort)
+	binary.BigEndian.PutUint16(tcp[2:], dstPort)
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	tcp[12] = 5 << 4
+	if syn {
+		tcp[13] = 0x02
+	}
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(40+len(payload)))
+	ip[9] = 6
+	copy(ip[12:], []byte{127, 0, 0, 1})
+	copy(ip[16:], []byte{127, 0, 0, 2})
+	eth := make([]byte, 14)
+	binary.BigEndian.PutUint16(eth[12:], 0x0800)
+	return append(append(append(eth, ip...), tcp...), payload...)
+}
+
+func pcapFile(packets ...[]byte) []byte {
+	var buf bytes.Buffer
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], 65535)
+	binary.LittleEndian.PutUint32(hdr[20:], linkEthernet)
+	buf.Write(hdr)
+	for i, p := range packets {
+		rec := make([]byte, 16)
+		binary.LittleEndian.PutUint32(rec[0:], 1700000000)
+		binary.LittleEndian.PutUint32(rec[4:], uint32(i))
+		binary.LittleEndian.PutUint32(rec[8:], uint32(len(p)))
+		binary.LittleEndian.PutUint32(rec[12:], uint32(len(p)))
+		buf.Write(rec)
+		buf.Write(p)
+	}
+	return buf.Bytes()
+}
+
+func dump(t *testing.T, data []byte, args ...string) string {
+	file := filepath.Join(t.TempDir(), "capture")
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := run(append([]string{"-r", file}, args...), nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestDumpPcap(t *testing.T) {
+	call := pack(t, erpc.TypeCall, 1, erpc.WithServiceMethod("/home/test"),
+		erpc.WithAddMeta("k", "v"), erpc.WithBodyCodec('j'), erpc.WithBody(map[string]int{"a": 1}))
+	reply := pack(t, erpc.TypeReply, 1, erpc.WithBodyCodec('p'), erpc.WithBody([]byte{8, 1}))
+	const isn = 1000
+	out := dump(t, pcapFile(
+		tcpPacket(40000, 9090, isn, true, nil),
+		// the out-of-order segment, the retransmission and the other port
+		tcpPacket(40000, 9090, isn+1+10, false, call[10:]),
+		tcpPacket(40000, 9090, isn+1, false, call[:10]),
+		tcpPacket(40000, 9090, isn+1, false, call[:10]),
+		tcpPacket(40001, 9999, 1, false, []byte("noise")),
+		tcpPacket(9090, 40000, 5000, false, reply),
+	), "-port", "9090")
+	for _, s := range []string{
+		"127.0.0.1:40000 > 127.0.0.2:9090 CALL seq=1 /home/test",
+		"meta: k=v",
+		`body(json): {"a":1}`,
+		"127.0.0.1:9090 > 127.0.0.2:40000 REPLY seq=1",
+		"body(protobuf):",
+		"08 01",
+	} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("expect %q in the transcript:\n%s", s, out)
+		}
+	}
+	if strings.Count(out, "CALL") != 1 || strings.Contains(out, "error") {
+		t.Fatalf("bad transcript:\n%s", out)
+	}
+}
+
+func TestDumpRaw(t *testing.T) {
+	data := append(pack(t, erpc.TypePush, 0, erpc.WithServiceMethod("/a/b"), erpc.WithBody([]byte("hi"))),
+		0, 0, 0, 9)
+	out := dump(t, data, "-codec", "plain")
+	if !strings.Contains(out, "PUSH seq=0 /a/b") || !strings.Contains(out, "body(plain): hi") ||
+		!strings.Contains(out, "incomplete frame of 4 bytes") {
+		t.Fatalf("bad transcript:\n%s", out)
+	}
+}
+
+func TestDissector(t *testing.T) {
+	var out bytes.Buffer
+	if err := run([]string{"-dissector", "-port", "9090"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `Pref.uint("TCP port", 9090,`) {
+		t.Fatalf("bad dissector:\n%s", out.String())
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// The link types of the pcap files.
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLinuxSLL = 113
+)
+
+// pcapReader reads the packets of the classic libpcap file.
+type pcapReader struct {
+	r        io.Reader
+	order    binary.ByteOrder
+	nano     bool
+	linkType uint32
+}
+
+func newPcapReader(r io.Reader) (*pcapReader, error) {
+	var hdr [24]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("pcap: read file header: %w", err)
+	}
+	p := &pcapReader{r: r}
+	switch binary.LittleEndian.Uint32(hdr[:4]) {
+	case 0xa1b2c3d4:
+		p.order = binary.LittleEndian
+	case 0xa1b23c4d:
+		p.order, p.nano = binary.LittleEndian, true
+	case 0xd4c3b2a1:
+		p.order = binary.BigEndian
+	case 0x4d3cb2a1:
+		p.order, p.nano = binary.BigEndian, true
+	default:
+		return nil, errors.New("pcap: bad magic number, only the classic pcap format is supported")
+	}
+	p.linkType = p.order.Uint32(hdr[20:24])
+	switch p.linkType {
+	case linkNull, linkEthernet, linkRaw, linkLinuxSLL:
+	default:
+		return nil, fmt.Errorf("pcap: unsupported link type %d", p.linkType)
+	}
+	return p, nil
+}
+
+// isPcap reports whether the head of the file is the pcap magic number.
+func isPcap(head []byte) bool {
+	if len(head) < 4 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(head[:4]) {
+	case 0xa1b2c3d4, 0xa1b23c4d, 0xd4c3b2a1, 0x4d3cb2a1:
+		return true
+	}
+	return false
+}
+
+// next reads the next packet, and returns io.EOF at the end of the file.
+func (p *pcapReader) next() (t time.Time, data []byte, err error) {
+	var hdr [16]byte
+	if _, err = io.ReadFull(p.r, hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = errors.New("pcap: truncated packet header")
+		}
+		return
+	}
+	sec, frac := p.order.Uint32(hdr[0:4]), p.order.Uint32(hdr[4:8])
+	if !p.nano {
+		frac *= 1000
+	}
+	t = time.Unix(int64(sec), int64(frac))
+	n := p.order.Uint32(hdr[8:12])
+	if n > 1<<18 {
+		return t, nil, fmt.Errorf("pcap: bad packet length %d", n)
+	}
+	data = make([]byte, n)
+	if _, err = io.ReadFull(p.r, data); err != nil {
+		err = errors.New("pcap: truncated packet")
+	}
+	return
+}
+
+// segment the TCP segment of a packet.
+type segment struct {
+	src, dst string
+	seq      uint32
+	syn, fin bool
+	payload  []byte
+}
+
+// parsePacket parses the TCP segment from the link layer packet, and returns false if it is not TCP.
+func parsePacket(linkType uint32, data []byte) (*segment, bool) {
+	var ethType uint16
+	switch linkType {
+	case linkEthernet:
+		if len(data) < 14 {
+			return nil, false
+		}
+		ethType, data = binary.BigEndian.Uint16(data[12:14]), data[14:]
+		// the 802.1Q VLAN tag
+		for ethType == 0x8100 && len(data) >= 4 {
+			ethType, data = binary.BigEndian.Uint16(data[2:4]), data[4:]
+		}
+	case linkLinuxSLL:
+		if len(data) < 16 {
+			return nil, false
+		}
+		ethType, data = binary.BigEndian.Uint16(data[14:16]), data[16:]
+	case linkNull:
+		if len(data) < 4 {
+			return nil, false
+		}
+		data = data[4:]
+	}
+	if ethType == 0 && len(data) > 0 {
+		// the raw IP packet
+		switch data[0] >> 4 {
+		case 4:
+			ethType = 0x0800
+		case 6:
+			ethType = 0x86dd
+		}
+	}
+	var srcIP, dstIP net.IP
+	switch ethType {
+	case 0x0800:
+		if len(data) < 20 {
+			return nil, false
+		}
+		ihl := int(data[0]&0x0f) * 4
+		total := int(binary.BigEndian.Uint16(data[2:4]))
+		if data[9] != 6 || ihl < 20 || total < ihl || len(data) < total {
+			return nil, false
+		}
+		srcIP, dstIP = net.IP(data[12:16]), net.IP(data[16:20])
+		data = data[ihl:total]
+	case 0x86dd:
+		if len(data) < 40 {
+			return nil, false
+		}
+		// NOTE: the extension headers are not supported
+		payloadLen := int(binary.BigEndian.Uint16(data[4:6]))
+		if data[6] != 6 || len(data) < 40+payloadLen {
+			return nil, false
+		}
+		srcIP, dstIP = net.IP(data[8:24]), net.IP(data[24:40])
+		data = data[40 : 40+payloadLen]
+	default:
+		return nil, false
+	}
+	if len(data) < 20 {
+		return nil, false
+	}
+	off := int(data[12]>>4) * 4
+	if off < 20 || len(data) < off {
+		return nil, false
+	}
+	flags := data[13]
+	return &segment{
+		src:     net.JoinHostPort(srcIP.String(), strconv.Itoa(int(binary.BigEndian.Uint16(data[0:2])))),
+		dst:     net.JoinHostPort(dstIP.String(), strconv.Itoa(int(binary.BigEndian.Uint16(data[2:4])))),
+		seq:     binary.BigEndian.Uint32(data[4:8]),
+		syn:     flags&0x02 != 0,
+		fin:     flags&0x01 != 0,
+		payload: data[off:],
+	}, true
+}
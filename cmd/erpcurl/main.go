@@ -0,0 +1,266 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command erpcurl dials a peer and sends an ad-hoc CALL or PUSH with the JSON body, prints the reply and status,
+// and can listen for the pushes, the erpc equivalent of grpcurl for quick testing.
+//
+// Usage:
+//  erpcurl -d '{"a":1}' 127.0.0.1:9090 /home/test
+//  echo '{"a":1}' | erpcurl -d @- -H X-Token=abc 127.0.0.1:9090 /home/test
+//  erpcurl -push -d '"hi"' 127.0.0.1:9090 /chat/say
+//  erpcurl -listen -wait 10s 127.0.0.1:9090 /chat/join
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/codec"
+	"github.com/andeya/erpc/v7/proto/jsonproto"
+	"github.com/andeya/erpc/v7/proto/pbproto"
+)
+
+// errStatus the error of the reply status that is not OK.
+var errStatus = errors.New("the reply status is not OK")
+
+func main() {
+	err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	if err == errStatus {
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "erpcurl:", err)
+		os.Exit(2)
+	}
+}
+
+// metaFlag the repeatable -H key=value flag.
+type metaFlag [][2]string
+
+func (m *metaFlag) String() string {
+	return fmt.Sprint([][2]string(*m))
+}
+
+func (m *metaFlag) Set(s string) error {
+	i := strings.IndexAny(s, "=:")
+	if i <= 0 {
+		return fmt.Errorf("bad metadata %q, expect key=value", s)
+	}
+	*m = append(*m, [2]string{strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])})
+	return nil
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("erpcurl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: erpcurl [flags] <addr> [<service method>]")
+		fs.PrintDefaults()
+	}
+	var meta metaFlag
+	fs.Var(&meta, "H", "the metadata key=value of the message, repeatable")
+	var (
+		network   = fs.String("network", "tcp", "the network: tcp, tcp4, tcp6, unix, kcp or quic")
+		protoName = fs.String("proto", "raw", "the protocol: raw, json or pb")
+		codecName = fs.String("codec", "json", "the body codec name, the JSON body is converted for the other codecs")
+		data      = fs.String("d", "", "the JSON body, @- reads it from stdin, @file reads it from the file")
+		push      = fs.Bool("push", false, "send a PUSH instead of a CALL")
+		listen    = fs.Bool("listen", false, "print the pushes received from the peer")
+		wait      = fs.Duration("wait", 0, "the duration of listening for the pushes, 0 means until interrupted")
+		timeout   = fs.Duration("timeout", 10*time.Second, "the timeout of dialing and the call")
+		useTLS    = fs.Bool("tls", false, "dial with TLS")
+		insecure  = fs.Bool("insecure", false, "skip verifying the TLS certificate of the peer")
+		verbose   = fs.Bool("v", false, "print the metadata, status and cost time of the reply, and the peer logs")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 || (fs.NArg() == 1 && !*listen) {
+		fs.Usage()
+		return errors.New("expect the address and the service method")
+	}
+	addr, serviceMethod := fs.Arg(0), fs.Arg(1)
+
+	c, err := codec.GetByName(*codecName)
+	if err != nil {
+		return err
+	}
+	body, err := readBody(*data, stdin, c)
+	if err != nil {
+		return err
+	}
+	var protoFunc erpc.ProtoFunc
+	switch *protoName {
+	case "raw":
+		protoFunc = erpc.DefaultProtoFunc()
+	case "json":
+		protoFunc = jsonproto.NewJSONProtoFunc()
+	case "pb":
+		protoFunc = pbproto.NewPbProtoFunc()
+	default:
+		return fmt.Errorf("unknown protocol %q", *protoName)
+	}
+	if !*verbose {
+		erpc.SetLoggerLevel("WARNING")
+	}
+
+	out := &printer{w: stdout}
+	cli := erpc.NewPeer(erpc.PeerConfig{Network: *network, DialTimeout: *timeout, CountTime: *verbose})
+	defer cli.Close()
+	if *useTLS {
+		cli.SetTLSConfig(&tls.Config{InsecureSkipVerify: *insecure})
+	}
+	if *listen {
+		cli.SetUnknownPush(func(ctx erpc.UnknownPushCtx) *erpc.Status {
+			out.printMessage("PUSH "+ctx.ServiceMethod(), ctx.GetBodyCodec(), ctx.InputBodyBytes(), func(f func(key, value []byte)) {
+				ctx.VisitMeta(f)
+			}, *verbose)
+			return nil
+		})
+	}
+	sess, stat := cli.Dial(addr, protoFunc)
+	if !stat.OK() {
+		return stat.Cause()
+	}
+
+	if serviceMethod != "" {
+		setting := []erpc.MessageSetting{erpc.WithBodyCodec(c.ID())}
+		for _, kv := range meta {
+			setting = append(setting, erpc.WithAddMeta(kv[0], kv[1]))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		setting = append(setting, erpc.WithContext(ctx))
+		if *push {
+			stat = sess.Push(serviceMethod, body, setting...)
+		} else {
+			var reply []byte
+			cmd := sess.Call(serviceMethod, body, &reply, setting...)
+			stat = cmd.Status()
+			if stat.OK() || len(reply) > 0 {
+				out.printMessage("", cmd.InputBodyCodec(), reply, cmd.InputMeta().VisitAll, *verbose)
+			}
+			if *verbose {
+				fmt.Fprintf(stderr, "cost: %s\n", cmd.CostTime())
+			}
+		}
+		cancel()
+		if !stat.OK() {
+			fmt.Fprintf(stderr, "status: code=%d msg=%q", stat.Code(), stat.Msg())
+			if cause := stat.Cause(); cause != nil {
+				fmt.Fprintf(stderr, " cause=%q", cause.Error())
+			}
+			fmt.Fprintln(stderr)
+			if !*listen {
+				return errStatus
+			}
+		}
+	}
+
+	if *listen {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		defer signal.Stop(interrupt)
+		var timer <-chan time.Time
+		if *wait > 0 {
+			timer = time.After(*wait)
+		}
+		select {
+		case <-interrupt:
+		case <-timer:
+		case <-sess.CloseNotify():
+		}
+	}
+	return nil
+}
+
+// readBody reads the JSON body, and converts it to the body codec.
+func readBody(data string, stdin io.Reader, c codec.Codec) ([]byte, error) {
+	var b []byte
+	switch {
+	case data == "@-":
+		var err error
+		if b, err = io.ReadAll(stdin); err != nil {
+			return nil, err
+		}
+	case strings.HasPrefix(data, "@"):
+		var err error
+		if b, err = os.ReadFile(data[1:]); err != nil {
+			return nil, err
+		}
+	default:
+		b = []byte(data)
+	}
+	b = []byte(strings.TrimSpace(string(b)))
+	if len(b) == 0 {
+		return nil, nil
+	}
+	if !json.Valid(b) {
+		return nil, errors.New("the body is not valid JSON")
+	}
+	if c.ID() == codec.ID_JSON {
+		return b, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	b, err := c.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("convert the JSON body to %s: %w", c.Name(), err)
+	}
+	return b, nil
+}
+
+// printer prints the messages of the call and the pushes concurrently.
+type printer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (p *printer) printMessage(title string, bodyCodec byte, body []byte, visitMeta func(func(key, value []byte)), verbose bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if title != "" {
+		fmt.Fprintln(p.w, title)
+	}
+	if verbose {
+		visitMeta(func(key, value []byte) {
+			fmt.Fprintf(p.w, "< %s: %s\n", key, value)
+		})
+	}
+	if len(body) == 0 {
+		return
+	}
+	switch bodyCodec {
+	case codec.ID_JSON, codec.ID_PLAIN, codec.ID_FORM, codec.ID_XML, codec.NilCodecID:
+		if utf8.Valid(body) {
+			fmt.Fprintf(p.w, "%s\n", body)
+			return
+		}
+	}
+	fmt.Fprint(p.w, hex.Dump(body))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/andeya/erpc/v7"
+)
+
+type Test struct {
+	erpc.CallCtx
+}
+
+func (t *Test) Echo(arg *map[string]interface{}) (map[string]interface{}, *erpc.Status) {
+	(*arg)["token"] = string(t.PeekMeta("X-Token"))
+	return *arg, nil
+}
+
+func (t *Test) Fail(arg *struct{}) (struct{}, *erpc.Status) {
+	return struct{}{}, erpc.NewStatus(400, "bad request", "missing name")
+}
+
+func (t *Test) Subscribe(arg *string) (string, *erpc.Status) {
+	t.Session().Push("/test/news", "hello "+*arg)
+	return "ok", nil
+}
+
+func serve(t *testing.T) string {
+	srv := erpc.NewPeer(erpc.PeerConfig{})
+	t.Cleanup(func() { srv.Close() })
+	srv.RouteCall(new(Test))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	return lis.Addr().String()
+}
+
+func curl(args []string, stdin string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	err := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), stderr.String(), err
+}
+
+func TestCall(t *testing.T) {
+	addr := serve(t)
+	out, _, err := curl([]string{"-d", "@-", "-H", "X-Token=abc", addr, "/test/echo"}, `{"a":1}`)
+	if err != nil || out != `{"a":1,"token":"abc"}`+"\n" {
+		t.Fatalf("out: %q, err: %v", out, err)
+	}
+
+	_, errOut, err := curl([]string{"-d", "{}", addr, "/test/fail"}, "")
+	if err != errStatus || !strings.Contains(errOut, `status: code=400 msg="bad request" cause="missing name"`) {
+		t.Fatalf("stderr: %q, err: %v", errOut, err)
+	}
+
+	if _, _, err = curl([]string{"-d", "{", addr, "/test/echo"}, ""); err == nil {
+		t.Fatal("expect the error of the invalid JSON body")
+	}
+}
+
+func TestListen(t *testing.T) {
+	addr := serve(t)
+	out, _, err := curl([]string{"-listen", "-wait", "300ms", "-d", `"erpc"`, addr, "/test/subscribe"}, "")
+	if err != nil || !strings.Contains(out, "PUSH /test/news\n\"hello erpc\"\n") || !strings.Contains(out, "\"ok\"\n") {
+		t.Fatalf("out: %q, err: %v", out, err)
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package avro is an Apache Avro body codec with writer/reader schema resolution.
+//
+// The encoded data is in Confluent wire format: a zero magic byte,
+// a 4-byte big-endian schema id in the registry, and the avro binary data,
+// so it can interop with Kafka-centric ecosystems.
+package avro
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7/codec"
+)
+
+// avro codec name and id
+const (
+	NAME_AVRO = "avro"
+	ID_AVRO   = 'a'
+)
+
+// Schemaer is implemented by the body types that declare their avro schema.
+// For marshaling it is the writer schema, and for unmarshaling it is the reader schema.
+type Schemaer interface {
+	AvroSchema() string
+}
+
+var defaultCodec = NewAvroCodec(NewMemoryRegistry())
+
+func init() {
+	codec.Reg(defaultCodec)
+}
+
+// SetRegistry sets the schema registry of the registered avro codec.
+// NOTE: Make sure to call it before the codec is used.
+func SetRegistry(registry Registry) {
+	defaultCodec.mu.Lock()
+	defaultCodec.registry = registry
+	defaultCodec.failed = make(map[int32]failedLookup)
+	defaultCodec.mu.Unlock()
+}
+
+// AvroCodec avro codec
+type AvroCodec struct {
+	registry Registry
+	bySource map[string]*registeredSchema
+	byID     map[int32]*Schema
+	mu       sync.RWMutex
+	// the schema ids failed to look up, and the time to retry
+	failed   map[int32]failedLookup
+	fetching chan struct{} // limits the concurrent lookups in the registry
+}
+
+type failedLookup struct {
+	err   error
+	until time.Time
+}
+
+// the limits of looking up the unknown schema ids from the registry,
+// the ids come from the remote data, so they must be bounded
+var (
+	// LookupFailureTTL the duration of caching the failed lookup of an id
+	LookupFailureTTL = time.Minute
+	// MaxConcurrentLookups the maximum number of the concurrent lookups,
+	// the lookup exceeding it fails immediately
+	MaxConcurrentLookups = 8
+	// maxFailedLookups the maximum number of the cached failed lookups
+	maxFailedLookups = 1024
+)
+
+// ErrTooManyLookups too many concurrent lookups in the schema registry
+var ErrTooManyLookups = errors.New("avro codec: too many concurrent schema lookups")
+
+type registeredSchema struct {
+	id     int32
+	schema *Schema
+}
+
+// NewAvroCodec creates an avro codec with the schema registry.
+// NOTE: Use the registered codec in general, it is only for custom codec id.
+func NewAvroCodec(registry Registry) *AvroCodec {
+	return &AvroCodec{
+		registry: registry,
+		bySource: make(map[string]*registeredSchema),
+		byID:     make(map[int32]*Schema),
+		failed:   make(map[int32]failedLookup),
+		fetching: make(chan struct{}, MaxConcurrentLookups),
+	}
+}
+
+// Name returns codec name.
+func (*AvroCodec) Name() string {
+	return NAME_AVRO
+}
+
+// ID returns codec id.
+func (*AvroCodec) ID() byte {
+	return ID_AVRO
+}
+
+const headerLen = 5
+
+// Marshal returns the avro encoding of v, v must implement Schemaer.
+func (c *AvroCodec) Marshal(v interface{}) ([]byte, error) {
+	switch v.(type) {
+	case nil, *struct{}, struct{}:
+		return []byte{}, nil
+	}
+	s, ok := v.(Schemaer)
+	if !ok {
+		return nil, fmt.Errorf("avro codec: %T does not implement avro.Schemaer", v)
+	}
+	rs, err := c.register(s.AvroSchema())
+	if err != nil {
+		return nil, err
+	}
+	b, err := Encode(rs.schema, v)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, headerLen, headerLen+len(b))
+	binary.BigEndian.PutUint32(data[1:], uint32(rs.id))
+	return append(data, b...), nil
+}
+
+// Unmarshal parses the avro encoded data and stores the result in the value pointed to by v.
+// NOTE:
+//  The writer schema is resolved by the schema id in data;
+//  If v implements Schemaer, the data is resolved to its reader schema, otherwise to the writer schema.
+func (c *AvroCodec) Unmarshal(data []byte, v interface{}) error {
+	switch v.(type) {
+	case nil, *struct{}:
+		return nil
+	}
+	if len(data) < headerLen || data[0] != 0 {
+		return fmt.Errorf("avro codec: invalid data header")
+	}
+	writer, err := c.lookup(int32(binary.BigEndian.Uint32(data[1:])))
+	if err != nil {
+		return err
+	}
+	var reader *Schema
+	if s, ok := v.(Schemaer); ok {
+		rs, err := c.parse(s.AvroSchema())
+		if err != nil {
+			return err
+		}
+		reader = rs
+	}
+	return Decode(writer, reader, data[headerLen:], v)
+}
+
+func (c *AvroCodec) register(source string) (*registeredSchema, error) {
+	c.mu.RLock()
+	rs, ok := c.bySource[source]
+	registry := c.registry
+	c.mu.RUnlock()
+	if ok && rs.id != 0 {
+		return rs, nil
+	}
+	schema, err := c.parse(source)
+	if err != nil {
+		return nil, err
+	}
+	subject := schema.Name
+	if subject == "" {
+		subject = schema.Type
+	}
+	id, err := registry.Register(subject, source)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	rs = &registeredSchema{id: id, schema: schema}
+	c.bySource[source] = rs
+	c.byID[id] = schema
+	c.mu.Unlock()
+	return rs, nil
+}
+
+func (c *AvroCodec) parse(source string) (*Schema, error) {
+	c.mu.RLock()
+	rs, ok := c.bySource[source]
+	c.mu.RUnlock()
+	if ok {
+		return rs.schema, nil
+	}
+	schema, err := Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if _, ok = c.bySource[source]; !ok {
+		c.bySource[source] = &registeredSchema{schema: schema}
+	}
+	c.mu.Unlock()
+	return schema, nil
+}
+
+func (c *AvroCodec) lookup(id int32) (*Schema, error) {
+	c.mu.RLock()
+	schema, ok := c.byID[id]
+	registry := c.registry
+	c.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+	now := time.Now()
+	c.mu.RLock()
+	f, ok := c.failed[id]
+	c.mu.RUnlock()
+	if ok && now.Before(f.until) {
+		return nil, f.err
+	}
+	select {
+	case c.fetching <- struct{}{}:
+	default:
+		return nil, ErrTooManyLookups
+	}
+	source, err := registry.GetSchema(id)
+	<-c.fetching
+	if err == nil {
+		schema, err = c.parse(source)
+	}
+	if err != nil {
+		c.addFailed(id, err, now)
+		return nil, err
+	}
+	c.mu.Lock()
+	c.byID[id] = schema
+	delete(c.failed, id)
+	c.mu.Unlock()
+	return schema, nil
+}
+
+func (c *AvroCodec) addFailed(id int32, err error, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.failed) >= maxFailedLookups {
+		for k, f := range c.failed {
+			if !now.Before(f.until) {
+				delete(c.failed, k)
+			}
+		}
+		if len(c.failed) >= maxFailedLookups {
+			c.failed = make(map[int32]failedLookup)
+		}
+	}
+	c.failed[id] = failedLookup{err: err, until: now.Add(LookupFailureTTL)}
+}
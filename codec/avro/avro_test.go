@@ -0,0 +1,156 @@
+package avro
+
+import (
+	"testing"
+
+	"github.com/andeya/erpc/v7/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+const userV1 = `{
+	"type": "record", "name": "User", "namespace": "erpc.test",
+	"fields": [
+		{"name": "name", "type": "string"},
+		{"name": "age", "type": "int"},
+		{"name": "score", "type": "int"},
+		{"name": "role", "type": {"type": "enum", "name": "Role", "symbols": ["ADMIN", "GUEST", "ROBOT"]}},
+		{"name": "tags", "type": {"type": "array", "items": "string"}},
+		{"name": "attrs", "type": {"type": "map", "values": "long"}},
+		{"name": "friend", "type": ["null", "User"], "default": null}
+	]
+}`
+
+const userV2 = `{
+	"type": "record", "name": "User", "namespace": "erpc.test",
+	"fields": [
+		{"name": "name", "type": "string"},
+		{"name": "score", "type": "long"},
+		{"name": "role", "type": {"type": "enum", "name": "Role", "symbols": ["ADMIN", "GUEST"], "default": "GUEST"}},
+		{"name": "email", "type": "string", "default": "none"},
+		{"name": "tags", "type": {"type": "array", "items": "string"}},
+		{"name": "attrs", "type": {"type": "map", "values": "double"}},
+		{"name": "friend", "type": ["null", "User"], "default": null}
+	]
+}`
+
+type UserV1 struct {
+	Name   string
+	Age    int
+	Score  int32
+	Role   string
+	Tags   []string
+	Attrs  map[string]int64
+	Friend *UserV1
+}
+
+func (*UserV1) AvroSchema() string { return userV1 }
+
+type UserV2 struct {
+	Name   string `avro:"name"`
+	Score  int64
+	Role   string
+	Email  string
+	Tags   []string
+	Attrs  map[string]float64
+	Friend *UserV2
+}
+
+func (*UserV2) AvroSchema() string { return userV2 }
+
+func TestSchemaResolution(t *testing.T) {
+	v1 := &UserV1{
+		Name: "andeya", Age: 18, Score: 99, Role: "ROBOT",
+		Tags:   []string{"a", "b"},
+		Attrs:  map[string]int64{"x": 1},
+		Friend: &UserV1{Name: "henry", Role: "ADMIN"},
+	}
+	w, r := MustParse(userV1), MustParse(userV2)
+	data, err := Encode(w, v1)
+	assert.NoError(t, err)
+
+	var v2 UserV2
+	assert.NoError(t, Decode(w, r, data, &v2))
+	assert.Equal(t, UserV2{
+		Name: "andeya", Score: 99, Role: "GUEST", Email: "none",
+		Tags:   []string{"a", "b"},
+		Attrs:  map[string]float64{"x": 1},
+		Friend: &UserV2{Name: "henry", Role: "ADMIN", Email: "none", Tags: []string{}, Attrs: map[string]float64{}},
+	}, v2)
+
+	var generic interface{}
+	assert.NoError(t, Decode(w, nil, data, &generic))
+	m := generic.(map[string]interface{})
+	assert.Equal(t, "andeya", m["name"])
+	assert.Equal(t, int32(18), m["age"])
+	assert.Equal(t, "ROBOT", m["role"])
+	assert.Nil(t, m["friend"].(map[string]interface{})["friend"])
+
+	// the new writer lacks the field without default
+	data, err = Encode(r, &v2)
+	assert.NoError(t, err)
+	assert.Error(t, Decode(r, w, data, new(UserV1)))
+}
+
+func TestAvroCodec(t *testing.T) {
+	c, err := codec.Get(ID_AVRO)
+	assert.NoError(t, err)
+	assert.Equal(t, NAME_AVRO, c.Name())
+
+	_, err = c.Marshal(map[string]int{})
+	assert.Error(t, err)
+
+	data, err := c.Marshal(&UserV1{Name: "andeya", Role: "GUEST"})
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0), data[0])
+
+	var v2 UserV2
+	assert.NoError(t, c.Unmarshal(data, &v2))
+	assert.Equal(t, "andeya", v2.Name)
+	assert.Equal(t, "none", v2.Email)
+
+	var v1 UserV1
+	assert.NoError(t, c.Unmarshal(data, &v1))
+	assert.Equal(t, "andeya", v1.Name)
+
+	assert.Error(t, c.Unmarshal([]byte{1, 2}, &v1))
+}
+
+func TestParseError(t *testing.T) {
+	for _, s := range []string{
+		`"unknown"`,
+		`{"type": "record", "fields": []}`,
+		`{"type": "enum", "name": "E", "symbols": []}`,
+		`[["null"]]`,
+		`{`,
+	} {
+		_, err := Parse(s)
+		assert.Error(t, err, s)
+	}
+}
+
+type countingRegistry struct {
+	Registry
+	gets int
+}
+
+func (r *countingRegistry) GetSchema(id int32) (string, error) {
+	r.gets++
+	return r.Registry.GetSchema(id)
+}
+
+func TestLookupFailureCache(t *testing.T) {
+	r := &countingRegistry{Registry: NewMemoryRegistry()}
+	c := NewAvroCodec(r)
+	var v1 UserV1
+	unknown := []byte{0, 0, 0, 0, 99}
+	assert.Error(t, c.Unmarshal(unknown, &v1))
+	assert.Error(t, c.Unmarshal(unknown, &v1))
+	assert.Equal(t, 1, r.gets)
+
+	// the concurrent lookups are limited
+	c.failed = make(map[int32]failedLookup)
+	for i := 0; i < cap(c.fetching); i++ {
+		c.fetching <- struct{}{}
+	}
+	assert.Equal(t, ErrTooManyLookups, c.Unmarshal(unknown, &v1))
+}
@@ -0,0 +1,524 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package avro
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+var errShortBuffer = errors.New("avro: unexpected end of data")
+
+// Decode parses the avro binary data written with the writer schema,
+// resolves it to the reader schema, and stores the result in the value pointed to by v.
+// NOTE:
+//  If reader is nil, the writer schema is used;
+//  v can be a pointer to struct, map[string]interface{} or interface{}.
+func Decode(writer, reader *Schema, data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("avro: Decode requires a non-nil pointer, got %T", v)
+	}
+	if reader == nil {
+		reader = writer
+	}
+	d := &decoder{buf: data}
+	return d.decode(writer, reader, rv.Elem())
+}
+
+type decoder struct {
+	buf []byte
+}
+
+func (d *decoder) readLong() (int64, error) {
+	n, size := binary.Varint(d.buf)
+	if size <= 0 {
+		return 0, errShortBuffer
+	}
+	d.buf = d.buf[size:]
+	return n, nil
+}
+
+func (d *decoder) readN(n int) ([]byte, error) {
+	if n < 0 || n > len(d.buf) {
+		return nil, errShortBuffer
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b, nil
+}
+
+func (d *decoder) readBytes() ([]byte, error) {
+	n, err := d.readLong()
+	if err != nil {
+		return nil, err
+	}
+	if n > int64(len(d.buf)) {
+		return nil, errShortBuffer
+	}
+	return d.readN(int(n))
+}
+
+// readBlockCount reads the count of array or map block,
+// negative count is followed by the block size in bytes.
+func (d *decoder) readBlockCount() (int64, error) {
+	n, err := d.readLong()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		if _, err = d.readLong(); err != nil {
+			return 0, err
+		}
+		n = -n
+	}
+	if n > int64(len(d.buf)) {
+		// every item takes at least one byte, except for null items
+		return 0, errShortBuffer
+	}
+	return n, nil
+}
+
+// decode reads the value of writer schema w, resolves it to reader schema r and sets it to v.
+// NOTE: v is settable or invalid (skip).
+func (d *decoder) decode(w, r *Schema, v reflect.Value) error {
+	if w.Type == TypeUnion {
+		i, err := d.readLong()
+		if err != nil {
+			return err
+		}
+		if i < 0 || i >= int64(len(w.Union)) {
+			return fmt.Errorf("avro: invalid union index %d", i)
+		}
+		w = w.Union[i]
+	}
+	if r.Type == TypeUnion {
+		branch := resolveUnion(w, r)
+		if branch == nil {
+			return fmt.Errorf("avro: %s does not match any branch of reader union", typeName(w))
+		}
+		r = branch
+	}
+	if !compatible(w, r) {
+		return fmt.Errorf("avro: writer %s is not compatible with reader %s", typeName(w), typeName(r))
+	}
+	if w.Type == TypeNull {
+		if v.IsValid() {
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+	v = alloc(v)
+	switch w.Type {
+	case TypeBoolean:
+		b, err := d.readN(1)
+		if err != nil {
+			return err
+		}
+		return setValue(v, b[0] != 0)
+	case TypeInt, TypeLong:
+		n, err := d.readLong()
+		if err != nil {
+			return err
+		}
+		switch r.Type {
+		case TypeFloat:
+			return setValue(v, float32(n))
+		case TypeDouble:
+			return setValue(v, float64(n))
+		case TypeInt:
+			return setValue(v, int32(n))
+		}
+		return setValue(v, n)
+	case TypeFloat:
+		b, err := d.readN(4)
+		if err != nil {
+			return err
+		}
+		f := math.Float32frombits(binary.LittleEndian.Uint32(b))
+		if r.Type == TypeDouble {
+			return setValue(v, float64(f))
+		}
+		return setValue(v, f)
+	case TypeDouble:
+		b, err := d.readN(8)
+		if err != nil {
+			return err
+		}
+		return setValue(v, math.Float64frombits(binary.LittleEndian.Uint64(b)))
+	case TypeBytes, TypeString:
+		b, err := d.readBytes()
+		if err != nil {
+			return err
+		}
+		if r.Type == TypeString {
+			return setValue(v, string(b))
+		}
+		return setValue(v, append([]byte(nil), b...))
+	case TypeFixed:
+		b, err := d.readN(w.Size)
+		if err != nil {
+			return err
+		}
+		return setValue(v, append([]byte(nil), b...))
+	case TypeEnum:
+		i, err := d.readLong()
+		if err != nil {
+			return err
+		}
+		if i < 0 || i >= int64(len(w.Symbols)) {
+			return fmt.Errorf("avro: invalid index %d of enum %s", i, w.Name)
+		}
+		sym := w.Symbols[i]
+		if !hasSymbol(r, sym) {
+			if r.Default == "" {
+				return fmt.Errorf("avro: %q is not a symbol of reader enum %s", sym, r.Name)
+			}
+			sym = r.Default
+		}
+		return setValue(v, sym)
+	case TypeArray:
+		return d.decodeArray(w, r, v)
+	case TypeMap:
+		return d.decodeMap(w, r, v)
+	case TypeRecord:
+		return d.decodeRecord(w, r, v)
+	}
+	return fmt.Errorf("avro: unsupported type %s", w.Type)
+}
+
+func (d *decoder) decodeArray(w, r *Schema, v reflect.Value) error {
+	generic := v.IsValid() && v.Kind() == reflect.Interface
+	var items []interface{}
+	if v.IsValid() && !generic {
+		if v.Kind() != reflect.Slice {
+			return fmt.Errorf("avro: cannot decode array into %s", v.Type())
+		}
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+	}
+	for {
+		n, err := d.readBlockCount()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		for i := int64(0); i < n; i++ {
+			switch {
+			case !v.IsValid():
+				err = d.decode(w.Items, r.Items, reflect.Value{})
+			case generic:
+				var item interface{}
+				err = d.decode(w.Items, r.Items, reflect.ValueOf(&item).Elem())
+				items = append(items, item)
+			default:
+				item := reflect.New(v.Type().Elem()).Elem()
+				if err = d.decode(w.Items, r.Items, item); err == nil {
+					v.Set(reflect.Append(v, item))
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if generic {
+		if items == nil {
+			items = []interface{}{}
+		}
+		v.Set(reflect.ValueOf(items))
+	}
+	return nil
+}
+
+func (d *decoder) decodeMap(w, r *Schema, v reflect.Value) error {
+	if v.IsValid() {
+		if v.Kind() == reflect.Interface {
+			m := make(map[string]interface{})
+			v.Set(reflect.ValueOf(m))
+			v = reflect.ValueOf(m)
+		} else if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("avro: cannot decode map into %s", v.Type())
+		} else if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+	}
+	for {
+		n, err := d.readBlockCount()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		for i := int64(0); i < n; i++ {
+			k, err := d.readBytes()
+			if err != nil {
+				return err
+			}
+			if !v.IsValid() {
+				if err = d.decode(w.Values, r.Values, reflect.Value{}); err != nil {
+					return err
+				}
+				continue
+			}
+			item := reflect.New(v.Type().Elem()).Elem()
+			if err = d.decode(w.Values, r.Values, item); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(string(k)).Convert(v.Type().Key()), item)
+		}
+	}
+}
+
+func (d *decoder) decodeRecord(w, r *Schema, v reflect.Value) error {
+	var (
+		structIdx map[string][]int
+		m         reflect.Value
+	)
+	if v.IsValid() {
+		switch v.Kind() {
+		case reflect.Struct:
+			structIdx = structFields(v.Type())
+		case reflect.Interface:
+			mm := make(map[string]interface{}, len(r.Fields))
+			v.Set(reflect.ValueOf(mm))
+			m = reflect.ValueOf(mm)
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return fmt.Errorf("avro: cannot decode record %s into %s", r.Name, v.Type())
+			}
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			m = v
+		default:
+			return fmt.Errorf("avro: cannot decode record %s into %s", r.Name, v.Type())
+		}
+	}
+	target := func(f *Field) (reflect.Value, func()) {
+		switch {
+		case !v.IsValid():
+			return reflect.Value{}, nil
+		case structIdx != nil:
+			if i, ok := structIdx[strings.ToLower(f.Name)]; ok {
+				return fieldByIndex(v, i), nil
+			}
+			return reflect.Value{}, nil
+		default:
+			item := reflect.New(m.Type().Elem()).Elem()
+			return item, func() {
+				m.SetMapIndex(reflect.ValueOf(f.Name).Convert(m.Type().Key()), item)
+			}
+		}
+	}
+	seen := make(map[*Field]bool, len(r.Fields))
+	for _, wf := range w.Fields {
+		rf := r.field(wf.Name, wf.Aliases)
+		if rf == nil {
+			// skip the field that the reader does not know
+			if err := d.decode(wf.Type, wf.Type, reflect.Value{}); err != nil {
+				return err
+			}
+			continue
+		}
+		seen[rf] = true
+		fv, done := target(rf)
+		if err := d.decode(wf.Type, rf.Type, fv); err != nil {
+			return fmt.Errorf("%s.%s: %w", r.Name, rf.Name, err)
+		}
+		if done != nil {
+			done()
+		}
+	}
+	// fill the reader fields that the writer does not have
+	for _, rf := range r.Fields {
+		if seen[rf] {
+			continue
+		}
+		if !rf.HasDefault {
+			return fmt.Errorf("avro: missing field %s.%s without default", r.Name, rf.Name)
+		}
+		fv, done := target(rf)
+		if fv.IsValid() {
+			if err := setDefault(rf, fv); err != nil {
+				return fmt.Errorf("%s.%s: %w", r.Name, rf.Name, err)
+			}
+		}
+		if done != nil {
+			done()
+		}
+	}
+	return nil
+}
+
+// setDefault sets the JSON default value of the field by encoding it and decoding it back.
+func setDefault(f *Field, v reflect.Value) error {
+	t := f.Type
+	if t.Type == TypeUnion {
+		t = t.Union[0]
+	}
+	e := &encoder{}
+	if err := e.encode(t, reflect.ValueOf(f.Default)); err != nil {
+		return err
+	}
+	return (&decoder{buf: e.buf}).decode(t, t, v)
+}
+
+// resolveUnion returns the first branch of reader union that matches the writer schema.
+func resolveUnion(w, r *Schema) *Schema {
+	for _, b := range r.Union {
+		if b.Type == w.Type && (!w.isNamed() || b.matchName(w)) {
+			return b
+		}
+	}
+	for _, b := range r.Union {
+		if compatible(w, b) {
+			return b
+		}
+	}
+	return nil
+}
+
+// compatible reports whether the data of writer schema can be read as reader schema.
+func compatible(w, r *Schema) bool {
+	switch w.Type {
+	case TypeInt:
+		return r.Type == TypeInt || r.Type == TypeLong || r.Type == TypeFloat || r.Type == TypeDouble
+	case TypeLong:
+		return r.Type == TypeLong || r.Type == TypeFloat || r.Type == TypeDouble
+	case TypeFloat:
+		return r.Type == TypeFloat || r.Type == TypeDouble
+	case TypeString, TypeBytes:
+		return r.Type == TypeString || r.Type == TypeBytes
+	case TypeRecord, TypeEnum:
+		return r.Type == w.Type && r.matchName(w)
+	case TypeFixed:
+		return r.Type == w.Type && r.matchName(w) && r.Size == w.Size
+	}
+	return w.Type == r.Type
+}
+
+func hasSymbol(s *Schema, sym string) bool {
+	for _, v := range s.Symbols {
+		if v == sym {
+			return true
+		}
+	}
+	return false
+}
+
+func typeName(s *Schema) string {
+	if s.isNamed() {
+		return s.Type + " " + s.Name
+	}
+	return s.Type
+}
+
+// alloc allocates the nil pointers, returns the settable value.
+func alloc(v reflect.Value) reflect.Value {
+	for v.IsValid() && v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 {
+			v = alloc(v)
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// setValue sets the decoded value x to v, with the kind conversion.
+func setValue(v reflect.Value, x interface{}) error {
+	if !v.IsValid() {
+		return nil
+	}
+	xv := reflect.ValueOf(x)
+	if v.Kind() == reflect.Interface {
+		v.Set(xv)
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := toInt64(xv); ok && xv.Kind() != reflect.Float32 && xv.Kind() != reflect.Float64 {
+			if v.OverflowInt(n) {
+				return fmt.Errorf("avro: %d overflows %s", n, v.Type())
+			}
+			v.SetInt(n)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, ok := toInt64(xv); ok && n >= 0 && xv.Kind() != reflect.Float32 && xv.Kind() != reflect.Float64 {
+			if v.OverflowUint(uint64(n)) {
+				return fmt.Errorf("avro: %d overflows %s", n, v.Type())
+			}
+			v.SetUint(uint64(n))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, ok := toFloat64(xv); ok {
+			v.SetFloat(f)
+			return nil
+		}
+	case reflect.String:
+		switch t := x.(type) {
+		case string:
+			v.SetString(t)
+			return nil
+		case []byte:
+			v.SetString(string(t))
+			return nil
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			switch t := x.(type) {
+			case string:
+				v.SetBytes([]byte(t))
+				return nil
+			case []byte:
+				v.SetBytes(t)
+				return nil
+			}
+		}
+	case reflect.Array:
+		if b, ok := x.([]byte); ok && v.Type().Elem().Kind() == reflect.Uint8 && v.Len() == len(b) {
+			reflect.Copy(v, reflect.ValueOf(b))
+			return nil
+		}
+	case reflect.Bool:
+		if b, ok := x.(bool); ok {
+			v.SetBool(b)
+			return nil
+		}
+	}
+	if xv.Type().AssignableTo(v.Type()) {
+		v.Set(xv)
+		return nil
+	}
+	return fmt.Errorf("avro: cannot set %T into %s", x, v.Type())
+}
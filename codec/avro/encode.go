@@ -0,0 +1,349 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package avro
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Encode returns the avro binary encoding of v with the schema.
+// NOTE:
+//  A record can be a struct (field name is matched by `avro` tag or case-insensitive name) or a map[string]interface{};
+//  An enum can be a string symbol or an integer index.
+func Encode(s *Schema, v interface{}) ([]byte, error) {
+	e := &encoder{buf: make([]byte, 0, 64)}
+	if err := e.encode(s, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) writeLong(n int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutVarint(b[:], n)]...)
+}
+
+func (e *encoder) writeBytes(b []byte) {
+	e.writeLong(int64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func (e *encoder) encode(s *Schema, v reflect.Value) error {
+	v = indirect(v)
+	if s.Type == TypeUnion {
+		return e.encodeUnion(s, v)
+	}
+	if !v.IsValid() {
+		if s.Type == TypeNull {
+			return nil
+		}
+		return fmt.Errorf("avro: cannot encode nil as %s", s.Type)
+	}
+	switch s.Type {
+	case TypeNull:
+		return nil
+	case TypeBoolean:
+		if v.Kind() != reflect.Bool {
+			break
+		}
+		if v.Bool() {
+			e.buf = append(e.buf, 1)
+		} else {
+			e.buf = append(e.buf, 0)
+		}
+		return nil
+	case TypeInt, TypeLong:
+		n, ok := toInt64(v)
+		if !ok {
+			break
+		}
+		if s.Type == TypeInt && (n < math.MinInt32 || n > math.MaxInt32) {
+			return fmt.Errorf("avro: %d overflows int", n)
+		}
+		e.writeLong(n)
+		return nil
+	case TypeFloat, TypeDouble:
+		f, ok := toFloat64(v)
+		if !ok {
+			break
+		}
+		var b [8]byte
+		if s.Type == TypeFloat {
+			binary.LittleEndian.PutUint32(b[:], math.Float32bits(float32(f)))
+			e.buf = append(e.buf, b[:4]...)
+		} else {
+			binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+			e.buf = append(e.buf, b[:]...)
+		}
+		return nil
+	case TypeBytes, TypeString:
+		switch {
+		case v.Kind() == reflect.String:
+			e.writeLong(int64(v.Len()))
+			e.buf = append(e.buf, v.String()...)
+			return nil
+		case isBytes(v):
+			e.writeBytes(bytesOf(v))
+			return nil
+		}
+	case TypeFixed:
+		var b []byte
+		switch {
+		case isBytes(v) || (v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8):
+			b = bytesOf(v)
+		case v.Kind() == reflect.String:
+			// e.g. the default value from JSON
+			b = []byte(v.String())
+		default:
+			return fmt.Errorf("avro: cannot encode %s as %s", v.Type(), s.Type)
+		}
+		if len(b) != s.Size {
+			return fmt.Errorf("avro: fixed %s requires %d bytes, got %d", s.Name, s.Size, len(b))
+		}
+		e.buf = append(e.buf, b...)
+		return nil
+	case TypeEnum:
+		if v.Kind() == reflect.String {
+			for i, sym := range s.Symbols {
+				if sym == v.String() {
+					e.writeLong(int64(i))
+					return nil
+				}
+			}
+			return fmt.Errorf("avro: %q is not a symbol of enum %s", v.String(), s.Name)
+		}
+		if n, ok := toInt64(v); ok {
+			if n < 0 || n >= int64(len(s.Symbols)) {
+				return fmt.Errorf("avro: %d is out of enum %s", n, s.Name)
+			}
+			e.writeLong(n)
+			return nil
+		}
+	case TypeArray:
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			break
+		}
+		if n := v.Len(); n > 0 {
+			e.writeLong(int64(n))
+			for i := 0; i < n; i++ {
+				if err := e.encode(s.Items, v.Index(i)); err != nil {
+					return err
+				}
+			}
+		}
+		e.writeLong(0)
+		return nil
+	case TypeMap:
+		if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if n := v.Len(); n > 0 {
+			e.writeLong(int64(n))
+			iter := v.MapRange()
+			for iter.Next() {
+				e.writeLong(int64(iter.Key().Len()))
+				e.buf = append(e.buf, iter.Key().String()...)
+				if err := e.encode(s.Values, iter.Value()); err != nil {
+					return err
+				}
+			}
+		}
+		e.writeLong(0)
+		return nil
+	case TypeRecord:
+		return e.encodeRecord(s, v)
+	}
+	return fmt.Errorf("avro: cannot encode %s as %s", v.Type(), s.Type)
+}
+
+func (e *encoder) encodeUnion(s *Schema, v reflect.Value) error {
+	for i, b := range s.Union {
+		if matchValue(b, v) {
+			e.writeLong(int64(i))
+			return e.encode(b, v)
+		}
+	}
+	if v.IsValid() {
+		return fmt.Errorf("avro: %s does not match any branch of union", v.Type())
+	}
+	return fmt.Errorf("avro: nil does not match any branch of union")
+}
+
+// matchValue reports whether the value can be encoded by the union branch.
+func matchValue(s *Schema, v reflect.Value) bool {
+	if !v.IsValid() {
+		return s.Type == TypeNull
+	}
+	switch s.Type {
+	case TypeBoolean:
+		return v.Kind() == reflect.Bool
+	case TypeInt, TypeLong:
+		_, ok := toInt64(v)
+		return ok
+	case TypeFloat, TypeDouble:
+		_, ok := toFloat64(v)
+		return ok
+	case TypeString:
+		return v.Kind() == reflect.String
+	case TypeBytes:
+		return isBytes(v)
+	case TypeFixed:
+		return (isBytes(v) || v.Kind() == reflect.Array) && v.Len() == s.Size
+	case TypeEnum:
+		return v.Kind() == reflect.String
+	case TypeArray:
+		return (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && !isBytes(v)
+	case TypeMap:
+		return v.Kind() == reflect.Map
+	case TypeRecord:
+		return v.Kind() == reflect.Struct || v.Kind() == reflect.Map
+	}
+	return false
+}
+
+func (e *encoder) encodeRecord(s *Schema, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		idx := structFields(v.Type())
+		for _, f := range s.Fields {
+			if i, ok := idx[strings.ToLower(f.Name)]; ok {
+				if err := e.encode(f.Type, v.FieldByIndex(i)); err != nil {
+					return fmt.Errorf("%s.%s: %w", s.Name, f.Name, err)
+				}
+				continue
+			}
+			if err := e.encodeDefault(s, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		for _, f := range s.Fields {
+			fv := v.MapIndex(reflect.ValueOf(f.Name).Convert(v.Type().Key()))
+			if fv.IsValid() {
+				if err := e.encode(f.Type, fv); err != nil {
+					return fmt.Errorf("%s.%s: %w", s.Name, f.Name, err)
+				}
+				continue
+			}
+			if err := e.encodeDefault(s, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("avro: cannot encode %s as record %s", v.Type(), s.Name)
+}
+
+func (e *encoder) encodeDefault(s *Schema, f *Field) error {
+	if !f.HasDefault {
+		return fmt.Errorf("avro: missing field %s.%s without default", s.Name, f.Name)
+	}
+	t := f.Type
+	if t.Type == TypeUnion {
+		// the default value of union corresponds to the first branch
+		e.writeLong(0)
+		t = t.Union[0]
+	}
+	return e.encode(t, reflect.ValueOf(f.Default))
+}
+
+var structFieldsCache sync.Map // map[reflect.Type]map[string][]int
+
+// structFields returns the lower-case avro field names and indexes of struct fields.
+func structFields(t reflect.Type) map[string][]int {
+	if m, ok := structFieldsCache.Load(t); ok {
+		return m.(map[string][]int)
+	}
+	m := make(map[string][]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name := sf.Name
+		if tag, ok := sf.Tag.Lookup("avro"); ok {
+			if tag == "-" {
+				continue
+			}
+			name = tag
+		}
+		m[strings.ToLower(name)] = sf.Index
+	}
+	structFieldsCache.Store(t, m)
+	return m
+}
+
+func toInt64(v reflect.Value) (int64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := v.Uint()
+		return int64(u), u <= math.MaxInt64
+	case reflect.Float32, reflect.Float64:
+		// e.g. the default value from JSON
+		f := v.Float()
+		return int64(f), f == math.Trunc(f)
+	}
+	return 0, false
+}
+
+func toFloat64(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	}
+	return 0, false
+}
+
+func isBytes(v reflect.Value) bool {
+	return v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8
+}
+
+func bytesOf(v reflect.Value) []byte {
+	if v.Kind() == reflect.Array {
+		b := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(b), v)
+		return b
+	}
+	return v.Bytes()
+}
@@ -0,0 +1,141 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRegistryTimeout the default timeout of the requests to the schema registry
+var DefaultRegistryTimeout = 10 * time.Second
+
+// Registry is a schema registry client.
+// The writer schema is registered when marshaling,
+// and its id is carried with the data to resolve it when unmarshaling.
+type Registry interface {
+	// Register registers the schema under the subject, and returns the schema id.
+	Register(subject, schema string) (id int32, err error)
+	// GetSchema returns the schema by id.
+	GetSchema(id int32) (schema string, err error)
+}
+
+// NewMemoryRegistry creates an in-process schema registry.
+// NOTE: It can only be used when the peers share the same process, such as tests.
+func NewMemoryRegistry() Registry {
+	return &memoryRegistry{
+		ids:     make(map[string]int32),
+		schemas: make(map[int32]string),
+	}
+}
+
+type memoryRegistry struct {
+	ids     map[string]int32
+	schemas map[int32]string
+	mu      sync.RWMutex
+}
+
+func (m *memoryRegistry) Register(_, schema string) (int32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id, ok := m.ids[schema]; ok {
+		return id, nil
+	}
+	id := int32(len(m.schemas) + 1)
+	m.ids[schema] = id
+	m.schemas[id] = schema
+	return id, nil
+}
+
+func (m *memoryRegistry) GetSchema(id int32) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	schema, ok := m.schemas[id]
+	if !ok {
+		return "", fmt.Errorf("avro: schema %d not found", id)
+	}
+	return schema, nil
+}
+
+// NewConfluentRegistry creates a client of Confluent Schema Registry REST API,
+// e.g. NewConfluentRegistry("http://localhost:8081", nil).
+// NOTE: If client is nil, a client with the timeout of DefaultRegistryTimeout is used.
+func NewConfluentRegistry(baseURL string, client *http.Client) Registry {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultRegistryTimeout}
+	}
+	return &confluentRegistry{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  client,
+	}
+}
+
+type confluentRegistry struct {
+	baseURL string
+	client  *http.Client
+}
+
+const confluentContentType = "application/vnd.schemaregistry.v1+json"
+
+func (c *confluentRegistry) Register(subject, schema string) (int32, error) {
+	body, _ := json.Marshal(map[string]string{"schema": schema})
+	resp, err := c.client.Post(
+		c.baseURL+"/subjects/"+url.PathEscape(subject)+"/versions",
+		confluentContentType,
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return 0, err
+	}
+	var r struct {
+		ID int32 `json:"id"`
+	}
+	if err = decodeResponse(resp, &r); err != nil {
+		return 0, err
+	}
+	return r.ID, nil
+}
+
+func (c *confluentRegistry) GetSchema(id int32) (string, error) {
+	resp, err := c.client.Get(fmt.Sprintf("%s/schemas/ids/%d", c.baseURL, id))
+	if err != nil {
+		return "", err
+	}
+	var r struct {
+		Schema string `json:"schema"`
+	}
+	if err = decodeResponse(resp, &r); err != nil {
+		return "", err
+	}
+	return r.Schema, nil
+}
+
+func decodeResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var r struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&r)
+		return fmt.Errorf("avro: schema registry: %s %s", resp.Status, r.Message)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
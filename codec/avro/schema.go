@@ -0,0 +1,288 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Avro schema types
+const (
+	TypeNull    = "null"
+	TypeBoolean = "boolean"
+	TypeInt     = "int"
+	TypeLong    = "long"
+	TypeFloat   = "float"
+	TypeDouble  = "double"
+	TypeBytes   = "bytes"
+	TypeString  = "string"
+	TypeRecord  = "record"
+	TypeEnum    = "enum"
+	TypeArray   = "array"
+	TypeMap     = "map"
+	TypeUnion   = "union"
+	TypeFixed   = "fixed"
+)
+
+type (
+	// Schema a parsed avro schema.
+	Schema struct {
+		Type    string
+		Name    string // full name, only for record, enum and fixed
+		Aliases []string
+		Fields  []*Field  // only for record
+		Symbols []string  // only for enum
+		Default string    // only for enum
+		Items   *Schema   // only for array
+		Values  *Schema   // only for map
+		Union   []*Schema // only for union
+		Size    int       // only for fixed
+		source  string
+	}
+	// Field a record field.
+	Field struct {
+		Name       string
+		Aliases    []string
+		Type       *Schema
+		Default    interface{}
+		HasDefault bool
+	}
+)
+
+// String returns the JSON text of schema.
+func (s *Schema) String() string {
+	return s.source
+}
+
+// field returns the field by name or alias.
+func (s *Schema) field(name string, aliases []string) *Field {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	for _, f := range s.Fields {
+		for _, a := range f.Aliases {
+			if a == name {
+				return f
+			}
+		}
+		for _, a := range aliases {
+			if a == f.Name {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) isNamed() bool {
+	switch s.Type {
+	case TypeRecord, TypeEnum, TypeFixed:
+		return true
+	}
+	return false
+}
+
+// matchName reports whether the named writer schema w matches s by name or alias.
+func (s *Schema) matchName(w *Schema) bool {
+	if shortName(s.Name) == shortName(w.Name) {
+		return true
+	}
+	for _, a := range s.Aliases {
+		if shortName(a) == shortName(w.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func shortName(name string) string {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// Parse parses the avro schema from JSON text.
+func Parse(schema string) (*Schema, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(schema), &v); err != nil {
+		return nil, fmt.Errorf("avro: invalid schema JSON: %s", err.Error())
+	}
+	p := &parser{names: make(map[string]*Schema)}
+	s, err := p.parse(v, "")
+	if err != nil {
+		return nil, err
+	}
+	s.source = schema
+	return s, nil
+}
+
+// MustParse parses the avro schema from JSON text, panics if error.
+func MustParse(schema string) *Schema {
+	s, err := Parse(schema)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+type parser struct {
+	names map[string]*Schema
+}
+
+func (p *parser) parse(v interface{}, namespace string) (*Schema, error) {
+	switch t := v.(type) {
+	case string:
+		return p.parseName(t, namespace)
+	case []interface{}:
+		s := &Schema{Type: TypeUnion}
+		for _, b := range t {
+			branch, err := p.parse(b, namespace)
+			if err != nil {
+				return nil, err
+			}
+			if branch.Type == TypeUnion {
+				return nil, fmt.Errorf("avro: union may not immediately contain other unions")
+			}
+			s.Union = append(s.Union, branch)
+		}
+		return s, nil
+	case map[string]interface{}:
+		return p.parseComplex(t, namespace)
+	default:
+		return nil, fmt.Errorf("avro: invalid schema: %v", v)
+	}
+}
+
+func (p *parser) parseName(name, namespace string) (*Schema, error) {
+	switch name {
+	case TypeNull, TypeBoolean, TypeInt, TypeLong, TypeFloat, TypeDouble, TypeBytes, TypeString:
+		return &Schema{Type: name}, nil
+	}
+	if s, ok := p.names[fullName(name, namespace)]; ok {
+		return s, nil
+	}
+	if s, ok := p.names[name]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("avro: unknown type: %s", name)
+}
+
+func (p *parser) parseComplex(m map[string]interface{}, namespace string) (*Schema, error) {
+	typ, _ := m["type"].(string)
+	if typ == "" {
+		// e.g. {"type": {"type": "array", ...}}
+		if t, ok := m["type"]; ok {
+			return p.parse(t, namespace)
+		}
+		return nil, fmt.Errorf("avro: missing type: %v", m)
+	}
+	s := &Schema{Type: typ}
+	switch typ {
+	case TypeRecord, "error", TypeEnum, TypeFixed:
+		if typ == "error" {
+			s.Type = TypeRecord
+		}
+		name, _ := m["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("avro: missing name of %s", typ)
+		}
+		if ns, ok := m["namespace"].(string); ok && !strings.Contains(name, ".") {
+			namespace = ns
+		}
+		s.Name = fullName(name, namespace)
+		if i := strings.LastIndexByte(s.Name, '.'); i >= 0 {
+			namespace = s.Name[:i]
+		}
+		s.Aliases = toStrings(m["aliases"])
+		if _, ok := p.names[s.Name]; ok {
+			return nil, fmt.Errorf("avro: redefined type: %s", s.Name)
+		}
+		// register before parsing fields for recursive types
+		p.names[s.Name] = s
+	}
+	switch s.Type {
+	case TypeRecord:
+		fields, _ := m["fields"].([]interface{})
+		for _, f := range fields {
+			fm, ok := f.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("avro: invalid field of %s: %v", s.Name, f)
+			}
+			field := &Field{Aliases: toStrings(fm["aliases"])}
+			field.Name, _ = fm["name"].(string)
+			if field.Name == "" {
+				return nil, fmt.Errorf("avro: missing field name of %s", s.Name)
+			}
+			var err error
+			field.Type, err = p.parse(fm["type"], namespace)
+			if err != nil {
+				return nil, err
+			}
+			field.Default, field.HasDefault = fm["default"]
+			s.Fields = append(s.Fields, field)
+		}
+	case TypeEnum:
+		s.Symbols = toStrings(m["symbols"])
+		if len(s.Symbols) == 0 {
+			return nil, fmt.Errorf("avro: missing symbols of %s", s.Name)
+		}
+		s.Default, _ = m["default"].(string)
+	case TypeFixed:
+		size, ok := m["size"].(float64)
+		if !ok || size < 0 {
+			return nil, fmt.Errorf("avro: invalid size of %s", s.Name)
+		}
+		s.Size = int(size)
+	case TypeArray:
+		items, err := p.parse(m["items"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		s.Items = items
+	case TypeMap:
+		values, err := p.parse(m["values"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		s.Values = values
+	default:
+		// primitive type with attributes, e.g. logical types
+		return p.parseName(typ, namespace)
+	}
+	return s, nil
+}
+
+func fullName(name, namespace string) string {
+	if namespace == "" || strings.Contains(name, ".") {
+		return name
+	}
+	return namespace + "." + name
+}
+
+func toStrings(v interface{}) []string {
+	a, _ := v.([]interface{})
+	r := make([]string, 0, len(a))
+	for _, s := range a {
+		if s, ok := s.(string); ok {
+			r = append(r, s)
+		}
+	}
+	return r
+}
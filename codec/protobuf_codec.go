@@ -16,6 +16,7 @@ package codec
 
 import (
 	"fmt"
+	"reflect"
 
 	"github.com/gogo/protobuf/proto"
 )
@@ -54,6 +55,16 @@ func (ProtoCodec) Unmarshal(data []byte, v interface{}) error {
 	return ProtoUnmarshal(data, v)
 }
 
+var protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+// CheckType checks whether the type implements proto.Message.
+func (ProtoCodec) CheckType(t reflect.Type) error {
+	if !checkImplements(t, protoMessageType) {
+		return fmt.Errorf("protobuf codec: %s does not implement proto.Message", t)
+	}
+	return nil
+}
+
 var (
 	// PbEmptyStruct empty struct for protobuf
 	PbEmptyStruct = new(PbEmpty)
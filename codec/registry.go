@@ -0,0 +1,87 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Registry the scoped codecs, e.g. of a peer, with the global ones registered by Reg as the fallback,
+// so that the codecs of the same id in the different scopes do not clobber each other.
+// NOTE:
+//  The nil *Registry is the global one;
+//  Concurrent safe.
+type Registry struct {
+	mu      sync.RWMutex
+	idMap   map[byte]Codec
+	nameMap map[string]Codec
+}
+
+// NewRegistry creates a new scoped codec registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		idMap:   make(map[byte]Codec),
+		nameMap: make(map[string]Codec),
+	}
+}
+
+// Reg registers Codec to the registry, which shadows the global one of the same id or name.
+// NOTE: Panic if the id or name is registered to the registry already.
+func (r *Registry) Reg(codec Codec) {
+	if r == nil {
+		Reg(codec)
+		return
+	}
+	if codec.ID() == NilCodecID {
+		panic(fmt.Sprintf("codec id can not be %d", NilCodecID))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.idMap[codec.ID()]; ok {
+		panic(fmt.Sprintf("multi-register codec id: %d", codec.ID()))
+	}
+	if _, ok := r.nameMap[codec.Name()]; ok {
+		panic("multi-register codec name: " + codec.Name())
+	}
+	r.idMap[codec.ID()] = codec
+	r.nameMap[codec.Name()] = codec
+}
+
+// Get returns Codec by id, from the registry or the global ones.
+func (r *Registry) Get(codecID byte) (Codec, error) {
+	if r != nil {
+		r.mu.RLock()
+		codec, ok := r.idMap[codecID]
+		r.mu.RUnlock()
+		if ok {
+			return codec, nil
+		}
+	}
+	return Get(codecID)
+}
+
+// GetByName returns Codec by name, from the registry or the global ones.
+func (r *Registry) GetByName(codecName string) (Codec, error) {
+	if r != nil {
+		r.mu.RLock()
+		codec, ok := r.nameMap[codecName]
+		r.mu.RUnlock()
+		if ok {
+			return codec, nil
+		}
+	}
+	return GetByName(codecName)
+}
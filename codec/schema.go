@@ -0,0 +1,56 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec
+
+import (
+	"reflect"
+)
+
+// TypeChecker is an optional interface of Codec,
+// it checks whether the codec can represent the type.
+type TypeChecker interface {
+	// CheckType returns an error if the values of type t cannot be
+	// encoded or decoded by the codec.
+	// NOTE: For decoding, t is the pointer type of the receiver.
+	CheckType(t reflect.Type) error
+}
+
+// CheckType checks whether the codec can represent the type.
+// NOTE: Returns nil if the codec does not implement TypeChecker.
+func CheckType(codecID byte, t reflect.Type) error {
+	c, err := Get(codecID)
+	if err != nil {
+		return err
+	}
+	if checker, ok := c.(TypeChecker); ok {
+		return checker.CheckType(t)
+	}
+	return nil
+}
+
+var (
+	emptyStructType    = reflect.TypeOf(struct{}{})
+	emptyStructPtrType = reflect.TypeOf(&struct{}{})
+)
+
+// checkImplements checks whether t implements iface,
+// the interface types and empty struct types are allowed.
+func checkImplements(t, iface reflect.Type) bool {
+	if t == nil || t.Kind() == reflect.Interface ||
+		t == emptyStructType || t == emptyStructPtrType {
+		return true
+	}
+	return t.Implements(iface)
+}
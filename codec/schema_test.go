@@ -0,0 +1,22 @@
+package codec
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckType(t *testing.T) {
+	assert.NoError(t, CheckType(ID_PROTOBUF, reflect.TypeOf(new(PbEmpty))))
+	assert.NoError(t, CheckType(ID_PROTOBUF, reflect.TypeOf(struct{}{})))
+	assert.NoError(t, CheckType(ID_PROTOBUF, reflect.TypeOf((*interface{})(nil)).Elem()))
+	assert.Error(t, CheckType(ID_PROTOBUF, reflect.TypeOf(new(ThriftEmpty))))
+	assert.Error(t, CheckType(ID_PROTOBUF, reflect.TypeOf(map[string]int{})))
+
+	assert.NoError(t, CheckType(ID_THRIFT, reflect.TypeOf(new(ThriftEmpty))))
+	assert.Error(t, CheckType(ID_THRIFT, reflect.TypeOf(new(PbEmpty))))
+
+	assert.NoError(t, CheckType(ID_JSON, reflect.TypeOf(map[string]int{})))
+	assert.Error(t, CheckType(0, reflect.TypeOf(map[string]int{})))
+}
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"reflect"
 
 	"git.apache.org/thrift.git/lib/go/thrift"
 )
@@ -56,6 +57,16 @@ func (ThriftCodec) Unmarshal(data []byte, v interface{}) error {
 	return ThriftUnmarshal(data, v)
 }
 
+var thriftStructType = reflect.TypeOf((*thrift.TStruct)(nil)).Elem()
+
+// CheckType checks whether the type implements thrift.TStruct.
+func (ThriftCodec) CheckType(t reflect.Type) error {
+	if !checkImplements(t, thriftStructType) {
+		return fmt.Errorf("thrift codec: %s does not implement thrift.TStruct", t)
+	}
+	return nil
+}
+
 var (
 	// ThriftEmptyStruct empty struct for thrift
 	ThriftEmptyStruct = new(ThriftEmpty)
@@ -15,7 +15,13 @@
 package codec
 
 import (
+	"bytes"
 	"encoding/xml"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
 )
 
 // xml codec name and id
@@ -41,13 +47,213 @@ func (XMLCodec) ID() byte {
 	return ID_XML
 }
 
+// XMLRootName is the root element name of the types that have no name,
+// such as maps and anonymous structs.
+var XMLRootName = "root"
+
 // Marshal returns the XML encoding of v.
+// NOTE:
+//  The map (key must be string kind) is encoded as <root><key>value</key>...</root>, sorted by key;
+//  The root element name of map and anonymous struct is XMLRootName.
 func (XMLCodec) Marshal(v interface{}) ([]byte, error) {
-	return xml.Marshal(v)
+	if v == nil {
+		return []byte{}, nil
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return []byte{}, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Map && !(rv.Kind() == reflect.Struct && rv.Type().Name() == "" && !hasXMLName(rv.Type())) {
+		return xml.Marshal(v)
+	}
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	if err := encodeXMLElement(enc, XMLRootName, rv); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func hasXMLName(t reflect.Type) bool {
+	_, ok := t.FieldByName("XMLName")
+	return ok
+}
+
+func encodeXMLElement(enc *xml.Encoder, name string, v reflect.Value) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("xml codec: unsupported map key type: %s", v.Type().Key())
+		}
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			if !isXMLName(k.String()) {
+				return fmt.Errorf("xml codec: map key %q is not a valid XML element name", k.String())
+			}
+			if err := encodeXMLElement(enc, k.String(), v.MapIndex(k)); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeXMLElement(enc, name, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return enc.EncodeElement(v.Interface(), start)
+}
+
+// isXMLName reports whether s is a valid XML element name without namespace prefix,
+// the names starting with "xml" are reserved.
+func isXMLName(s string) bool {
+	if s == "" || strings.HasPrefix(strings.ToLower(s), "xml") {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i > 0 && (r == '-' || r == '.' || unicode.IsDigit(r)):
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 // Unmarshal parses the XML-encoded data and stores the result
 // in the value pointed to by v.
+// NOTE:
+//  If v is *map[string]interface{} or *interface{}, the child elements of root are decoded as map,
+//  the leaf element is string, the nested element is map[string]interface{},
+//  and the repeated elements are []interface{};
+//  If v is *map[string]string, only the leaf elements are allowed;
+//  The attributes and the text of the root element are not supported for map, and return error.
 func (XMLCodec) Unmarshal(data []byte, v interface{}) error {
+	switch m := v.(type) {
+	case *map[string]interface{}:
+		r, err := decodeXMLMap(data)
+		if err != nil {
+			return err
+		}
+		*m = r
+		return nil
+	case *interface{}:
+		r, err := decodeXMLMap(data)
+		if err != nil {
+			return err
+		}
+		*m = r
+		return nil
+	case *map[string]string:
+		r, err := decodeXMLMap(data)
+		if err != nil {
+			return err
+		}
+		if *m == nil {
+			*m = make(map[string]string, len(r))
+		}
+		for k, x := range r {
+			s, ok := x.(string)
+			if !ok {
+				return fmt.Errorf("xml codec: element <%s> is not a leaf, cannot stored in map[string]string", k)
+			}
+			(*m)[k] = s
+		}
+		return nil
+	}
 	return xml.Unmarshal(data, v)
 }
+
+func decodeXMLMap(data []byte) (map[string]interface{}, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			if len(start.Attr) > 0 {
+				return nil, fmt.Errorf("xml codec: the attributes of element <%s> cannot be decoded as map", start.Name.Local)
+			}
+			r, err := decodeXMLNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			switch x := r.(type) {
+			case map[string]interface{}:
+				return x, nil
+			case string:
+				if strings.TrimSpace(x) != "" {
+					return nil, fmt.Errorf("xml codec: the text of root element <%s> cannot be decoded as map", start.Name.Local)
+				}
+			}
+			return map[string]interface{}{}, nil
+		}
+	}
+}
+
+// decodeXMLNode decodes the content of the element whose start token has been read.
+func decodeXMLNode(dec *xml.Decoder) (interface{}, error) {
+	var (
+		text     []byte
+		children map[string]interface{}
+	)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			text = append(text, t...)
+		case xml.StartElement:
+			if len(t.Attr) > 0 {
+				return nil, fmt.Errorf("xml codec: the attributes of element <%s> cannot be decoded as map", t.Name.Local)
+			}
+			child, err := decodeXMLNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			if children == nil {
+				children = make(map[string]interface{})
+			}
+			key := t.Name.Local
+			switch old := children[key].(type) {
+			case nil:
+				children[key] = child
+			case []interface{}:
+				children[key] = append(old, child)
+			default:
+				children[key] = []interface{}{old, child}
+			}
+		case xml.EndElement:
+			if children != nil {
+				return children, nil
+			}
+			return string(text), nil
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXMLMap(t *testing.T) {
+	c := new(XMLCodec)
+	b, err := c.Marshal(map[string]interface{}{
+		"b": 2,
+		"a": "x<y",
+		"c": map[string]string{"d": "4"},
+		"e": []int{5, 6},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `<root><a>x&lt;y</a><b>2</b><c><d>4</d></c><e>5</e><e>6</e></root>`, string(b))
+
+	var m map[string]interface{}
+	assert.NoError(t, c.Unmarshal(b, &m))
+	assert.Equal(t, map[string]interface{}{
+		"a": "x<y",
+		"b": "2",
+		"c": map[string]interface{}{"d": "4"},
+		"e": []interface{}{"5", "6"},
+	}, m)
+
+	var ms map[string]string
+	assert.Error(t, c.Unmarshal(b, &ms))
+	assert.NoError(t, c.Unmarshal([]byte(`<xml><a>1</a><b>2</b></xml>`), &ms))
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, ms)
+
+	var i interface{}
+	assert.NoError(t, c.Unmarshal([]byte(`<xml></xml>`), &i))
+	assert.Equal(t, map[string]interface{}{}, i)
+
+	_, err = c.Marshal(map[string]interface{}{"a b": 1})
+	assert.Error(t, err)
+	_, err = c.Marshal(map[string]int{"1a": 1})
+	assert.Error(t, err)
+	assert.Error(t, c.Unmarshal([]byte(`<xml>text</xml>`), &m))
+	assert.Error(t, c.Unmarshal([]byte(`<xml id="1"><a>1</a></xml>`), &m))
+	assert.Error(t, c.Unmarshal([]byte(`<xml><a id="1">1</a></xml>`), &m))
+}
+
+func TestXMLAnonymousStruct(t *testing.T) {
+	c := new(XMLCodec)
+	b, err := c.Marshal(&struct {
+		Name string `xml:"name"`
+		Age  int    `xml:"age,attr"`
+	}{"andeya", 18})
+	assert.NoError(t, err)
+	assert.Equal(t, `<root age="18"><name>andeya</name></root>`, string(b))
+
+	type Named struct {
+		Name string `xml:"name"`
+	}
+	b, err = c.Marshal(Named{"andeya"})
+	assert.NoError(t, err)
+	assert.Equal(t, `<Named><name>andeya</name></Named>`, string(b))
+
+	var v struct {
+		Name string `xml:"name"`
+	}
+	assert.NoError(t, c.Unmarshal(b, &v))
+	assert.Equal(t, "andeya", v.Name)
+}
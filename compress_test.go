@@ -0,0 +1,54 @@
+package erpc_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andeya/erpc/v7/xfer/gzip"
+)
+
+type autoCompressCall struct {
+	erpc.CallCtx
+}
+
+// Filters returns the transfer filters of the call.
+func (c *autoCompressCall) Filters(arg *string) (int, *erpc.Status) {
+	return c.Input().XferPipe().Len(), nil
+}
+
+func TestAutoCompress(t *testing.T) {
+	gzip.Reg('z', "gzip-auto", 5)
+	cfg := erpc.PeerConfig{CompressFilter: "gzip-auto", AutoCompressBytes: 100}
+	srv, cli, sess := erpc.NewPipePeerPair(cfg, cfg)
+	defer srv.Close()
+	defer cli.Close()
+	srv.RouteCall(new(autoCompressCall))
+
+	small, big := strings.Repeat("a", 10), strings.Repeat("a", 1000)
+	cases := []struct {
+		arg     string
+		setting []erpc.MessageSetting
+		filters int
+	}{
+		{small, nil, 0},
+		{big, nil, 1},
+		{big, []erpc.MessageSetting{erpc.WithAutoCompress(0)}, 0},
+		{small, []erpc.MessageSetting{erpc.WithAutoCompress(5)}, 1},
+		// already compressed
+		{big, []erpc.MessageSetting{erpc.WithXferPipe('z')}, 1},
+	}
+	for i, c := range cases {
+		var filters int
+		callCmd := sess.Call("/auto_compress_call/filters", c.arg, &filters, c.setting...)
+		if stat := callCmd.Status(); !stat.OK() {
+			t.Fatal(stat)
+		}
+		if filters != c.filters {
+			t.Errorf("case %d: filters %d, expect %d", i, filters, c.filters)
+		}
+		// the body is restored after writing
+		if body, ok := callCmd.Output().Body().(string); !ok || body != c.arg {
+			t.Errorf("case %d: body %v is not restored", i, callCmd.Output().Body())
+		}
+	}
+}
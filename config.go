@@ -19,11 +19,14 @@ import (
 	"math"
 	"net"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/andeya/cfgo"
 	"github.com/andeya/erpc/v7/codec"
+	"github.com/andeya/erpc/v7/kcp"
 	"github.com/andeya/erpc/v7/socket"
+	quicgo "github.com/lucas-clemente/quic-go"
 )
 
 // PeerConfig peer config
@@ -41,9 +44,65 @@ type PeerConfig struct {
 	DefaultBodyCodec  string        `yaml:"default_body_codec"   ini:"default_body_codec"   comment:"Default body codec type id"`
 	DefaultSessionAge time.Duration `yaml:"default_session_age"  ini:"default_session_age"  comment:"Default session max age, if less than or equal to 0, no time limit; ns,µs,ms,s,m,h"`
 	DefaultContextAge time.Duration `yaml:"default_context_age"  ini:"default_context_age"  comment:"Default CALL or PUSH context max age, if less than or equal to 0, no time limit; ns,µs,ms,s,m,h"`
+	MaxIdleDuration   time.Duration `yaml:"max_idle_duration"    ini:"max_idle_duration"    comment:"Maximum duration of the sessions without any message read or written, and without the pending calls and the active handlers, beyond which idle_mode is applied; separate from default_session_age; if less than or equal to 0, no detection; ns,µs,ms,s,m,h"`
+	IdleMode          string        `yaml:"idle_mode"            ini:"idle_mode"            comment:"Policy of the idle session; close: emit EventSessionIdle and close the session, the default; event: only emit EventSessionIdle"`
+	PingInterval      time.Duration `yaml:"ping_interval"        ini:"ping_interval"        comment:"Interval of the application pings of each session, updating the liveness of the session and emitting EventLivenessChanged; the remote peer must support the pings; if less than or equal to 0, no automatic ping; ns,µs,ms,s,m,h"`
+	PingTimeout       time.Duration `yaml:"ping_timeout"         ini:"ping_timeout"         comment:"Maximum duration of waiting for the pong of each ping, default ping_interval; ns,µs,ms,s,m,h"`
+	PingDeadAfter     int           `yaml:"ping_dead_after"      ini:"ping_dead_after"      comment:"Number of the consecutive failed pings, after which the session is dead, and suspect before it; if less than or equal to 0, default 3"`
 	SlowCometDuration time.Duration `yaml:"slow_comet_duration"  ini:"slow_comet_duration"  comment:"Slow operation alarm threshold; ns,µs,ms,s ..."`
 	PrintDetail       bool          `yaml:"print_detail"         ini:"print_detail"         comment:"Is print body and metadata or not"`
 	CountTime         bool          `yaml:"count_time"           ini:"count_time"           comment:"Is count cost time or not"`
+	HandlerWorkers    int           `yaml:"handler_workers"      ini:"handler_workers"      comment:"Number of workers that run handlers in order of message priority; if less than or equal to 0, use the global goroutine pool"`
+	MaxConnections    int           `yaml:"max_connections"      ini:"max_connections"      comment:"Maximum number of connections accepted by the listeners at the same time; if less than or equal to 0, no limit; for server role"`
+	AcceptRateLimit   int           `yaml:"accept_rate_limit"    ini:"accept_rate_limit"    comment:"Maximum number of connections accepted per second; if less than or equal to 0, no limit; for server role"`
+	RejectWithStatus  bool          `yaml:"reject_with_status"   ini:"reject_with_status"   comment:"Is respond with a busy status before closing the rejected connection or not, instead of closing it immediately; for server role"`
+	ProxyProtocol     bool          `yaml:"proxy_protocol"       ini:"proxy_protocol"       comment:"Is read the HAProxy PROXY protocol v1/v2 header of the accepted connections or not; only for tcp, tcp4, tcp6, unix and unixpacket; for server role"`
+	ProxyTrustedCIDRs string        `yaml:"proxy_trusted_cidrs"  ini:"proxy_trusted_cidrs"  comment:"Comma-separated CIDRs of the trusted proxies that are allowed to send the PROXY header; required if proxy_protocol is true; for server role"`
+	HandoffSessions   bool          `yaml:"handoff_sessions"     ini:"handoff_sessions"     comment:"Is pass the accepted plain tcp and unix sessions to the new process on Reboot or not, instead of closing them; only for the stateless protocols, e.g. the default raw protocol; for server role"`
+	FlushInterval     time.Duration `yaml:"flush_interval"       ini:"flush_interval"       comment:"Maximum delay of coalescing the small messages into one write, to reduce the syscalls of the high-throughput PUSH; if less than or equal to 0, write immediately; the buffered message is reported sent before flushed, and the connection is closed if the delayed flush fails; ns,µs,ms,s"`
+	CompressFilter    string        `yaml:"compress_filter"      ini:"compress_filter"      comment:"Name of the registered compression transfer filter of the auto compression, e.g. gzip; required if auto_compress_bytes>0"`
+	AutoCompressBytes int           `yaml:"auto_compress_bytes"  ini:"auto_compress_bytes"  comment:"Default threshold of the encoded body size, at least which the message is compressed by compress_filter; if less than or equal to 0, only the messages with WithAutoCompress"`
+	FragmentSize      int           `yaml:"fragment_size"        ini:"fragment_size"        comment:"Maximum body size of each frame of the messages written, the larger encoded body is split into the continuation frames reassembled by the remote peer; enabled after the remote peer agrees at the handshake, only for the protocols carrying the extensions, e.g. the default raw protocol; if less than or equal to 0, never fragment"`
+	MaxReassemblySize int           `yaml:"max_reassembly_size"  ini:"max_reassembly_size"  comment:"Maximum body size of each message reassembled from the continuation frames read, the larger one is discarded with a bad message status; if less than or equal to 0, the read limit"`
+	ReadLimit         uint32        `yaml:"read_limit"           ini:"read_limit"           comment:"Maximum size of each message read by the sessions of the peer, the smallest of it, the global SetReadLimit, Session.SetReadLimit and RouteReadLimit applies; if 0, only the global SetReadLimit and Session.SetReadLimit"`
+	MaxMetaCount      int           `yaml:"max_meta_count"       ini:"max_meta_count"       comment:"Maximum number of the metadata pairs of each CALL and PUSH read, the one exceeding any metadata limit is rejected with CodeMetaTooLarge before decoding the body; if less than or equal to 0, no limit"`
+	MaxMetaKeySize    int           `yaml:"max_meta_key_size"    ini:"max_meta_key_size"    comment:"Maximum size of each metadata key of the CALL and PUSH read; if less than or equal to 0, no limit"`
+	MaxMetaValueSize  int           `yaml:"max_meta_value_size"  ini:"max_meta_value_size"  comment:"Maximum size of each metadata value of the CALL and PUSH read; if less than or equal to 0, no limit"`
+	Seq64             bool          `yaml:"seq64"                ini:"seq64"                comment:"Is use the 64-bit seq negotiated at the handshake or not, so the long-lived session never reuses the seq of a pending call; when the remote peer does not support it, keep the 32-bit seq"`
+	AdmissionQueue    int           `yaml:"admission_queue"      ini:"admission_queue"      comment:"Maximum number of the received messages queued when the global goroutine pool is saturated, the CALL and PUSH over it are shed with a retry-after status; if less than or equal to 0, drop them; only if handler_workers<=0"`
+	MaxQueueDelay     time.Duration `yaml:"max_queue_delay"      ini:"max_queue_delay"      comment:"Maximum queueing delay of the admission queue, the CALL and PUSH waiting longer are shed with a retry-after status; if less than or equal to 0, no limit; ns,µs,ms,s"`
+	ReadBps           int64         `yaml:"read_bps"             ini:"read_bps"             comment:"Maximum total bytes per second read by the sessions of the peer; if less than or equal to 0, no limit; can be changed by SetBandwidth at runtime"`
+	WriteBps          int64         `yaml:"write_bps"            ini:"write_bps"            comment:"Maximum total bytes per second written by the sessions of the peer; if less than or equal to 0, no limit; can be changed by SetBandwidth at runtime"`
+	SessionReadBps    int64         `yaml:"session_read_bps"     ini:"session_read_bps"     comment:"Default maximum bytes per second read by each session; if less than or equal to 0, no limit; can be changed by Session.SetBandwidth at runtime"`
+	SessionWriteBps   int64         `yaml:"session_write_bps"    ini:"session_write_bps"    comment:"Default maximum bytes per second written by each session; if less than or equal to 0, no limit; can be changed by Session.SetBandwidth at runtime"`
+	SlowConsumerQueue int           `yaml:"slow_consumer_queue"  ini:"slow_consumer_queue"  comment:"Number of the messages waiting to be written to a session, above which for slow_consumer_time the session is a slow consumer; if less than or equal to 0, no detection"`
+	SlowConsumerTime  time.Duration `yaml:"slow_consumer_time"   ini:"slow_consumer_time"   comment:"Duration the write queue of a session stays above slow_consumer_queue before the slow consumer policy is applied, default 10s; ns,µs,ms,s"`
+	SlowConsumerMode  string        `yaml:"slow_consumer_mode"   ini:"slow_consumer_mode"   comment:"Policy of the slow consumer; log: log a warning, the default; event: also emit EventSlowConsumer; close: also close the session, failing the pending calls with the slow consumer status"`
+	SocketKeepAlive   time.Duration `yaml:"socket_keep_alive"    ini:"socket_keep_alive"    comment:"Period between the TCP keepalives of the sessions of the peer; if less than 0, disable the keepalive; if 0, use the global SetSocketKeepAlive and SetSocketKeepAlivePeriod; ns,µs,ms,s,m,h"`
+	SocketReadBuffer  int           `yaml:"socket_read_buffer"   ini:"socket_read_buffer"   comment:"Size of the operating system's receive buffer of the sessions of the peer; if less than or equal to 0, use the global SetSocketReadBuffer"`
+	SocketWriteBuffer int           `yaml:"socket_write_buffer"  ini:"socket_write_buffer"  comment:"Size of the operating system's transmit buffer of the sessions of the peer; if less than or equal to 0, use the global SetSocketWriteBuffer"`
+	SocketNoDelay     int           `yaml:"socket_no_delay"      ini:"socket_no_delay"      comment:"Is disable the Nagle's algorithm of the sessions of the peer or not; if greater than 0, send the data as soon as possible; if less than 0, delay it; if 0, use the global SetSocketNoDelay"`
+	ReusePort         int           `yaml:"reuse_port"           ini:"reuse_port"           comment:"Number of the listeners of each tcp listening address bound by SO_REUSEPORT, each with its own accept loop, and the other processes can bind the address too; the listeners are not inherited on Reboot; if less than or equal to 0, disabled; for server role"`
+	TCPFastOpen       int           `yaml:"tcp_fast_open"        ini:"tcp_fast_open"        comment:"Maximum length of the pending TCP Fast Open requests of the tcp listeners, where supported; if less than or equal to 0, disabled; for server role"`
+	KCPNoDelay        bool          `yaml:"kcp_no_delay"         ini:"kcp_no_delay"         comment:"Is enable the nodelay mode of the KCP sessions or not, which lowers the minimum RTO; only for kcp"`
+	KCPInterval       int           `yaml:"kcp_interval"         ini:"kcp_interval"         comment:"Internal update interval of the KCP sessions in milliseconds, in [10,5000]; if less than or equal to 0, default 100; only for kcp"`
+	KCPResend         int           `yaml:"kcp_resend"           ini:"kcp_resend"           comment:"Number of the ACK skips triggering the fast retransmission of the KCP sessions; if less than or equal to 0, disabled; only for kcp"`
+	KCPNoCongestion   bool          `yaml:"kcp_no_congestion"    ini:"kcp_no_congestion"    comment:"Is disable the congestion control of the KCP sessions or not; only for kcp"`
+	KCPSndWnd         int           `yaml:"kcp_snd_wnd"          ini:"kcp_snd_wnd"          comment:"Send window size of the KCP sessions in packets; if less than or equal to 0, default 32; only for kcp"`
+	KCPRcvWnd         int           `yaml:"kcp_rcv_wnd"          ini:"kcp_rcv_wnd"          comment:"Receive window size of the KCP sessions in packets; if less than or equal to 0, default 32; only for kcp"`
+	KCPMTU            int           `yaml:"kcp_mtu"              ini:"kcp_mtu"              comment:"Maximum transmission unit of the KCP sessions; if less than or equal to 0, default 1400; only for kcp"`
+	KCPDataShards     int           `yaml:"kcp_data_shards"      ini:"kcp_data_shards"      comment:"Number of the FEC data shards of the KCP sessions, default 10; if less than 0, no FEC; only for kcp"`
+	KCPParityShards   int           `yaml:"kcp_parity_shards"    ini:"kcp_parity_shards"    comment:"Number of the FEC parity shards of the KCP sessions, default 3; if less than 0, no FEC; only for kcp"`
+	KCPKey            string        `yaml:"kcp_key"              ini:"kcp_key"              comment:"Pre-shared key of the AES encryption of the KCP packets, the same on both sides; if empty, no encryption; only for kcp"`
+	QUICIdleTimeout   time.Duration `yaml:"quic_idle_timeout"   ini:"quic_idle_timeout"    comment:"Maximum duration of the QUIC connections without any network activity before closed; if less than or equal to 0, default 30s; only for quic"`
+	QUICKeepAlive     int           `yaml:"quic_keep_alive"     ini:"quic_keep_alive"      comment:"Is send the keep-alive packets of the QUIC connections to avoid the idle timeout or not; if greater than 0, enabled; if less than 0, disabled; if 0, enabled for server role and disabled for client role; only for quic"`
+	QUICMaxStreams    int64         `yaml:"quic_max_streams"    ini:"quic_max_streams"     comment:"Maximum number of the concurrent bidirectional streams opened by the remote of each QUIC connection, the session uses one; if less than or equal to 0, default 100; only for quic"`
+	QUIC0RTT          bool          `yaml:"quic_0rtt"           ini:"quic_0rtt"            comment:"Is enable the 0-RTT resumption of the QUIC connections or not, the dials after the first one to the same server send data without waiting for the handshake; the 0-RTT data can be replayed by the attackers; only for quic"`
+	QUICDatagrams     bool          `yaml:"quic_datagrams"      ini:"quic_datagrams"       comment:"Is enable the unreliable DATAGRAM support of the QUIC connections or not, used by the PUSH with WithDatagram when both sides enabled it; only for quic"`
+	RedialPending     bool          `yaml:"redial_pending"      ini:"redial_pending"       comment:"Is resend the calls waiting for the reply by the new connection after redialed, instead of failing them, e.g. when the client migrates to a new network path; the calls may be handled twice by the server; for client role"`
+	NegotiateCodec    bool          `yaml:"negotiate_codec"     ini:"negotiate_codec"      comment:"Is negotiate the default body codec of the session at the handshake or not, the client proposes its DefaultBodyCodec, and the server confirms it if supported, otherwise its own; when the remote peer does not support it, keep the peer defaults"`
+	LogLevel          string        `yaml:"log_level"           ini:"log_level"            comment:"Level of the global logger; OFF, PRINT, CRITICAL, ERROR, WARNING, NOTICE, INFO, DEBUG or TRACE; if empty, not changed"`
+	Clock             Clock         `yaml:"-"                    ini:"-"                    comment:"The source of the time of the session age, context age, heartbeat and redial timers, default SystemClock; not serializable"`
 
 	localAddr         net.Addr
 	listenAddr        net.Addr
@@ -66,6 +125,8 @@ func (p *PeerConfig) LocalAddr() net.Addr {
 }
 
 // Reload Bi-directionally synchronizes config between YAML file and memory.
+// NOTE:
+//  It applies to the running peer by Peer.Reload.
 func (p *PeerConfig) Reload(bind cfgo.BindFunc) error {
 	err := bind()
 	if err != nil {
@@ -102,9 +163,101 @@ func (p *PeerConfig) check() (err error) {
 	if p.RedialInterval <= 0 {
 		p.RedialInterval = time.Millisecond * 100
 	}
+	// NOTE: The compress_filter is got from the filters of the peer by NewPeer, see WithXferFilters.
+	if p.CompressFilter == "" && p.AutoCompressBytes > 0 {
+		return errors.New("Invalid compress_filter config, it is required if auto_compress_bytes>0")
+	}
+	switch p.SlowConsumerMode {
+	case "":
+		p.SlowConsumerMode = SlowConsumerLog
+	case SlowConsumerLog, SlowConsumerEvent, SlowConsumerClose:
+	default:
+		return errors.New("Invalid slow_consumer_mode config, it must be one of log, event and close: " + p.SlowConsumerMode)
+	}
+	switch p.IdleMode {
+	case "":
+		p.IdleMode = IdleClose
+	case IdleClose, IdleEvent:
+	default:
+		return errors.New("Invalid idle_mode config, it must be one of close and event: " + p.IdleMode)
+	}
+	if p.PingTimeout <= 0 {
+		p.PingTimeout = p.PingInterval
+	}
+	if p.PingDeadAfter <= 0 {
+		p.PingDeadAfter = defaultPingDeadAfter
+	}
+	if p.SlowConsumerTime <= 0 {
+		p.SlowConsumerTime = defaultSlowConsumerTime
+	}
+	if _, ok := parseLoggerLevel(p.LogLevel); p.LogLevel != "" && !ok {
+		return errors.New("Invalid log_level config, it must be one of OFF, PRINT, CRITICAL, ERROR, WARNING, NOTICE, INFO, DEBUG and TRACE: " + p.LogLevel)
+	}
+	if p.ProxyProtocol {
+		if asQUIC(p.Network) != "" || asKCP(p.Network) != "" {
+			return errors.New("Invalid proxy_protocol config, the PROXY protocol is not supported for " + p.Network)
+		}
+		if _, err = parseProxyTrustedCIDRs(p.proxyTrustedCIDRs()); err != nil {
+			return errors.New("Invalid proxy_trusted_cidrs config: " + err.Error())
+		}
+	}
 	return nil
 }
 
+// the default FEC shards of the KCP sessions
+const (
+	kcpDataShards   = 10
+	kcpParityShards = 3
+)
+
+func (p *PeerConfig) kcpConfig() kcp.Config {
+	cfg := kcp.Config{
+		NoDelay:      p.KCPNoDelay,
+		Interval:     p.KCPInterval,
+		Resend:       p.KCPResend,
+		NoCongestion: p.KCPNoCongestion,
+		SndWnd:       p.KCPSndWnd,
+		RcvWnd:       p.KCPRcvWnd,
+		MTU:          p.KCPMTU,
+		DataShards:   p.KCPDataShards,
+		ParityShards: p.KCPParityShards,
+		Key:          p.KCPKey,
+	}
+	if cfg.DataShards == 0 {
+		cfg.DataShards = kcpDataShards
+	}
+	if cfg.ParityShards == 0 {
+		cfg.ParityShards = kcpParityShards
+	}
+	if cfg.DataShards < 0 || cfg.ParityShards < 0 {
+		cfg.DataShards, cfg.ParityShards = 0, 0
+	}
+	return cfg
+}
+
+// quicConfig returns the QUIC config of the listeners if server is true, otherwise of the dialer.
+func (p *PeerConfig) quicConfig(server bool) *quicgo.Config {
+	cfg := &quicgo.Config{
+		MaxIdleTimeout:  p.QUICIdleTimeout,
+		KeepAlive:       p.QUICKeepAlive > 0 || (server && p.QUICKeepAlive == 0),
+		EnableDatagrams: p.QUICDatagrams,
+	}
+	if p.QUICIdleTimeout < 0 {
+		cfg.MaxIdleTimeout = 0
+	}
+	if p.QUICMaxStreams > 0 {
+		cfg.MaxIncomingStreams = p.QUICMaxStreams
+	}
+	return cfg
+}
+
+func (p *PeerConfig) proxyTrustedCIDRs() []string {
+	if p.ProxyTrustedCIDRs == "" {
+		return nil
+	}
+	return strings.Split(p.ProxyTrustedCIDRs, ",")
+}
+
 func (p *PeerConfig) newAddr(port string) (net.Addr, error) {
 	switch p.Network {
 	default:
@@ -183,17 +336,29 @@ var GetReadLimit = socket.MessageSizeLimit
 
 // SetReadLimit sets max message size.
 // If maxSize<=0, set it to 1GB.
+// NOTE: The smallest of it, PeerConfig.ReadLimit, Session.SetReadLimit and RouteReadLimit applies.
 //  func SetReadLimit(maxMessageSize uint32)
 var SetReadLimit = socket.SetMessageSizeLimit
 
+// GetExtensionsLimit gets the encoded size upper limit of message header extensions.
+//  GetExtensionsLimit() uint32
+var GetExtensionsLimit = socket.ExtensionsSizeLimit
+
+// SetExtensionsLimit sets the encoded size upper limit of message header extensions.
+// If maxSize<=0, set it to 4096; if maxSize>65535, set it to 65535.
+//  func SetExtensionsLimit(maxSize uint32)
+var SetExtensionsLimit = socket.SetExtensionsSizeLimit
+
 // SetSocketKeepAlive sets whether the operating system should send
 // keepalive messages on the connection.
 // NOTE: If have not called the function, the system defaults are used.
+// The default of the peers, overridden by PeerConfig.SocketKeepAlive.
 //  func SetSocketKeepAlive(keepalive bool)
 var SetSocketKeepAlive = socket.SetKeepAlive
 
 // SetSocketKeepAlivePeriod sets period between keep alives.
 // NOTE: if d<0, don't change the value.
+// The default of the peers, overridden by PeerConfig.SocketKeepAlive.
 //  func SetSocketKeepAlivePeriod(d time.Duration)
 var SetSocketKeepAlivePeriod = socket.SetKeepAlivePeriod
 
@@ -206,6 +371,7 @@ var SocketReadBuffer = socket.ReadBuffer
 // SetSocketReadBuffer sets the size of the operating system's
 // receive buffer associated with the connection.
 // NOTE: if bytes<0, don't change the value.
+// The default of the peers, overridden by PeerConfig.SocketReadBuffer.
 //  func SetSocketReadBuffer(bytes int)
 var SetSocketReadBuffer = socket.SetReadBuffer
 
@@ -218,6 +384,7 @@ var SocketWriteBuffer = socket.WriteBuffer
 // SetSocketWriteBuffer sets the size of the operating system's
 // transmit buffer associated with the connection.
 // NOTE: if bytes<0, don't change the value.
+// The default of the peers, overridden by PeerConfig.SocketWriteBuffer.
 //  func SetSocketWriteBuffer(bytes int)
 var SetSocketWriteBuffer = socket.SetWriteBuffer
 
@@ -225,5 +392,6 @@ var SetSocketWriteBuffer = socket.SetWriteBuffer
 // packet transmission in hopes of sending fewer packets (Nagle's
 // algorithm).  The default is true (no delay), meaning that data is
 // sent as soon as possible after a Write.
+// The default of the peers, overridden by PeerConfig.SocketNoDelay.
 //  func SetSocketNoDelay(noDelay bool)
 var SetSocketNoDelay = socket.SetNoDelay
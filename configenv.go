@@ -0,0 +1,154 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BindEnv sets the fields of the config by the environment variables, named by the prefix and the upper yaml tag,
+// e.g. ERPC_LISTEN_PORT of the prefix ERPC.
+// NOTE:
+//  The unset or empty variables are ignored;
+//  The precedence from low to high is the defaults in code, the YAML or ini file, the environment and the flags,
+//  i.e. bind them in that order, e.g. cfgo.MustReg, BindEnv, BindFlags and then flag.Parse;
+//  The durations are parsed by time.ParseDuration, e.g. 10s.
+func (p *PeerConfig) BindEnv(prefix string) error {
+	if prefix != "" && !strings.HasSuffix(prefix, "_") {
+		prefix += "_"
+	}
+	return rangeConfigFields(p, func(name string, field reflect.Value, _ string) error {
+		key := strings.ToUpper(prefix + name)
+		s, ok := os.LookupEnv(key)
+		if !ok || s == "" {
+			return nil
+		}
+		if err := setConfigField(field, s); err != nil {
+			return fmt.Errorf("invalid environment variable %s=%q: %v", key, s, err)
+		}
+		p.checked = false
+		return nil
+	})
+}
+
+// BindFlags defines the flags of the fields of the config in the flag set, named by the prefix and the yaml tag
+// with the hyphens, e.g. -erpc-listen-port of the prefix erpc, and the config is set by the flags passed to fs.Parse.
+// NOTE:
+//  The flags not passed keep the fields, see BindEnv for the precedence;
+//  The usages are the comment tags.
+func (p *PeerConfig) BindFlags(fs *flag.FlagSet, prefix string) {
+	if prefix != "" && !strings.HasSuffix(prefix, "-") {
+		prefix += "-"
+	}
+	rangeConfigFields(p, func(name string, field reflect.Value, usage string) error {
+		name = prefix + strings.Replace(name, "_", "-", -1)
+		if field.Kind() == reflect.Bool {
+			fs.Var(&boolConfigFlag{configFlag{p: p, v: field}}, name, usage)
+		} else {
+			fs.Var(&configFlag{p: p, v: field}, name, usage)
+		}
+		return nil
+	})
+}
+
+// rangeConfigFields calls fn with the yaml name of each serializable field of the config.
+func rangeConfigFields(p *PeerConfig, fn func(name string, field reflect.Value, usage string) error) error {
+	v := reflect.ValueOf(p).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("yaml")
+		if f.PkgPath != "" || name == "" || name == "-" {
+			continue
+		}
+		if err := fn(name, v.Field(i), f.Tag.Get("comment")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setConfigField(field reflect.Value, s string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// configFlag the flag.Value of a field of PeerConfig.
+type configFlag struct {
+	p *PeerConfig
+	v reflect.Value
+}
+
+func (c *configFlag) String() string {
+	if c == nil || !c.v.IsValid() {
+		return ""
+	}
+	return fmt.Sprint(c.v.Interface())
+}
+
+func (c *configFlag) Set(s string) error {
+	if err := setConfigField(c.v, s); err != nil {
+		return err
+	}
+	c.p.checked = false
+	return nil
+}
+
+type boolConfigFlag struct {
+	configFlag
+}
+
+func (*boolConfigFlag) IsBoolFlag() bool {
+	return true
+}
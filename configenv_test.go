@@ -0,0 +1,38 @@
+package erpc
+
+import (
+	"flag"
+	"testing"
+	"time"
+)
+
+func TestBindEnvAndFlags(t *testing.T) {
+	t.Setenv("ERPC_LISTEN_PORT", "9000")
+	t.Setenv("ERPC_DIAL_TIMEOUT", "3s")
+	t.Setenv("ERPC_PRINT_DETAIL", "true")
+	t.Setenv("ERPC_NETWORK", "")
+	cfg := PeerConfig{Network: "tcp4", ListenPort: 8000, RedialTimes: 2}
+	if err := cfg.BindEnv("ERPC"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ListenPort != 9000 || cfg.DialTimeout != 3*time.Second || !cfg.PrintDetail || cfg.Network != "tcp4" {
+		t.Fatalf("env: %+v", cfg)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.BindFlags(fs, "erpc")
+	if err := fs.Parse([]string{"-erpc-listen-port=9001", "-erpc-count-time", "-erpc-slow-comet-duration", "1m"}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ListenPort != 9001 || !cfg.CountTime || cfg.SlowCometDuration != time.Minute || cfg.RedialTimes != 2 {
+		t.Fatalf("flags: %+v", cfg)
+	}
+	if cfg.ListenAddr().String() != "0.0.0.0:9001" {
+		t.Fatalf("listen addr: %s", cfg.ListenAddr())
+	}
+
+	t.Setenv("ERPC_LISTEN_PORT", "70000")
+	if err := cfg.BindEnv("ERPC"); err == nil {
+		t.Fatal("expect the out of range port failed")
+	}
+}
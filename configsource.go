@@ -0,0 +1,197 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// the config formats of PeerConfig.Load
+const (
+	ConfigYAML = "yaml"
+	ConfigJSON = "json"
+	ConfigTOML = "toml"
+)
+
+// Load sets the fields of the config from the flat document of the format, keyed by the yaml tags,
+// e.g. {"network": "tcp", "listen_port": 9090, "dial_timeout": "10s"} in JSON.
+// NOTE:
+//  The format is one of ConfigYAML, ConfigJSON and ConfigTOML, the TOML tables and arrays are not supported;
+//  The durations are the strings parsed by time.ParseDuration, or the integers of nanoseconds;
+//  The unknown keys are reported as errors, and the absent fields are kept.
+func (p *PeerConfig) Load(r io.Reader, format string) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var values map[string]interface{}
+	switch strings.ToLower(format) {
+	case ConfigYAML, "yml":
+		err = yaml.Unmarshal(b, &values)
+	case ConfigJSON:
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		err = dec.Decode(&values)
+	case ConfigTOML:
+		values, err = parseFlatTOML(b)
+	default:
+		return fmt.Errorf("unsupported config format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s config: %v", format, err)
+	}
+	fields := make(map[string]reflect.Value, len(values))
+	rangeConfigFields(p, func(name string, field reflect.Value, _ string) error {
+		fields[name] = field
+		return nil
+	})
+	for key, value := range values {
+		field, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("unknown config key %q", key)
+		}
+		var s string
+		switch v := value.(type) {
+		case nil:
+			continue
+		case string:
+			s = v
+		case json.Number, int, int64, uint64, bool:
+			s = fmt.Sprint(v)
+			if field.Type() == durationType {
+				s += "ns"
+			}
+		default:
+			return fmt.Errorf("invalid config %s: unsupported value %v", key, value)
+		}
+		if err = setConfigField(field, s); err != nil {
+			return fmt.Errorf("invalid config %s=%v: %v", key, value, err)
+		}
+	}
+	p.checked = false
+	return nil
+}
+
+// LoadFile sets the fields of the config from the file, whose format is by the extension,
+// i.e. .yaml, .yml, .json or .toml, see Load.
+func (p *PeerConfig) LoadFile(name string) error {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	return p.Load(bytes.NewReader(b), strings.TrimPrefix(filepath.Ext(name), "."))
+}
+
+// parseFlatTOML parses the key/value pairs of the TOML document without the tables and arrays.
+func parseFlatTOML(b []byte) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			return nil, fmt.Errorf("line %d: the tables are not supported", n)
+		}
+		i := strings.IndexByte(line, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key := strings.Trim(strings.TrimSpace(line[:i]), `"'`)
+		value, err := parseTOMLValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %q", n, key)
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+func parseTOMLValue(s string) (interface{}, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty value")
+	}
+	switch s[0] {
+	case '"':
+		end := closingQuote(s)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		if err := checkTOMLComment(s[end+1:]); err != nil {
+			return nil, err
+		}
+		return strconv.Unquote(s[:end+1])
+	case '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		if err := checkTOMLComment(s[end+2:]); err != nil {
+			return nil, err
+		}
+		return s[1 : end+1], nil
+	case '[', '{':
+		return nil, fmt.Errorf("the arrays and inline tables are not supported")
+	}
+	if i := strings.IndexByte(s, '#'); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	n, err := strconv.ParseInt(strings.Replace(s, "_", "", -1), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %s", s)
+	}
+	return n, nil
+}
+
+// closingQuote returns the index of the quote closing the basic string, -1 if unterminated.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func checkTOMLComment(rest string) error {
+	if rest = strings.TrimSpace(rest); rest != "" && rest[0] != '#' {
+		return fmt.Errorf("unexpected %s after the value", rest)
+	}
+	return nil
+}
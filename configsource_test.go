@@ -0,0 +1,43 @@
+package erpc
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	docs := map[string]string{
+		ConfigJSON: `{"network": "tcp4", "listen_port": 9090, "dial_timeout": "3s", "redial_interval": 1000000, "print_detail": true, "kcp_key": "a\"b"}`,
+		ConfigYAML: "network: tcp4\nlisten_port: 9090\ndial_timeout: 3s\nredial_interval: 1000000\nprint_detail: true\nkcp_key: 'a\"b'\n",
+		ConfigTOML: "# peer\nnetwork = \"tcp4\" # comment\nlisten_port = 9_090\ndial_timeout = '3s'\nredial_interval = 1000000\nprint_detail = true\nkcp_key = \"a\\\"b\"\n",
+	}
+	for format, doc := range docs {
+		cfg := PeerConfig{RedialTimes: 2}
+		if err := cfg.Load(strings.NewReader(doc), format); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if cfg.Network != "tcp4" || cfg.ListenPort != 9090 || cfg.DialTimeout != 3*time.Second ||
+			cfg.RedialInterval != time.Millisecond || !cfg.PrintDetail || cfg.KCPKey != `a"b` || cfg.RedialTimes != 2 {
+			t.Fatalf("%s: %+v", format, cfg)
+		}
+	}
+
+	var cfg PeerConfig
+	if err := cfg.Load(strings.NewReader(`{"listen_prot": 9090}`), ConfigJSON); err == nil {
+		t.Fatal("expect the unknown key failed")
+	}
+	if err := cfg.Load(strings.NewReader("[peer]\nlisten_port = 9090\n"), ConfigTOML); err == nil {
+		t.Fatal("expect the table failed")
+	}
+
+	name := filepath.Join(t.TempDir(), "peer.toml")
+	if err := ioutil.WriteFile(name, []byte(docs[ConfigTOML]), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.LoadFile(name); err != nil || cfg.ListenPort != 9090 {
+		t.Fatalf("port: %d, err: %v", cfg.ListenPort, err)
+	}
+}
@@ -16,8 +16,10 @@ package erpc
 
 import (
 	"context"
+	"net"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/andeya/erpc/v7/codec"
@@ -73,6 +75,10 @@ type (
 		ServiceMethod() string
 		// ResetServiceMethod resets the input message service method.
 		ResetServiceMethod(string)
+		// Deadline returns the deadline of the caller's context, converted to the local clock when received.
+		Deadline() (deadline time.Time, ok bool)
+		// TraceContext returns the trace context of the input message, set by WithTraceContext.
+		TraceContext() (TraceContext, bool)
 	}
 	// ReadCtx context method set for reading message.
 	ReadCtx interface {
@@ -83,6 +89,11 @@ type (
 		StatusOK() bool
 		// Status returns the handle status.
 		Status() *Status
+		// ReplyDirectly skips the handler, and replies the CALL with the body encoded by the bodyCodec, e.g. the cached reply.
+		// NOTE:
+		//  It is used by the plugins after reading the header or the body, before the handler is executed;
+		//  The PUSH has no reply, so the body is ignored.
+		ReplyDirectly(body interface{}, bodyCodec byte)
 	}
 	// PushCtx context method set for handling the pushed message.
 	// For example:
@@ -112,8 +123,15 @@ type (
 		AddMeta(key, value string)
 		// SetMeta sets the header metadata 'key=value' for reply message.
 		SetMeta(key, value string)
+		// AddTrailer adds the trailer metadata 'key=value' framed after the reply body.
+		// Multiple values for the same key may be added.
+		AddTrailer(key, value string)
+		// SetTrailer sets the trailer metadata 'key=value' framed after the reply body.
+		SetTrailer(key, value string)
 		// AddXferPipe appends transfer filter pipe of reply message.
 		AddXferPipe(filterID ...byte)
+		// Progress emits the intermediate progress of the call to the caller, received by CallCmd.OnProgress.
+		Progress(percent int, note string) *Status
 	}
 	// UnknownPushCtx context method set for handling the unknown pushed message.
 	UnknownPushCtx interface {
@@ -172,6 +190,18 @@ type handlerCtx struct {
 	pluginContainer *PluginContainer
 	stat            *Status
 	context         context.Context
+	// handlerCancel cancels the handler's context of the call
+	handlerCancel context.CancelFunc
+	// batchReply captures the reply of the batch item, instead of writing it
+	batchReply func(Message) *Status
+	// withBinding the cached setting of binding the input body, to reset the input without allocation
+	withBinding MessageSetting
+	// skipHandler whether the handler is skipped by ReplyDirectly
+	skipHandler bool
+	// expireAt the unix nanoseconds of the expiry of the received CALL or PUSH by WithTTL, 0 means no TTL
+	expireAt int64
+	// deadline the unix nanoseconds of the caller's deadline by MetaDeadline, 0 means no deadline
+	deadline int64
 }
 
 var (
@@ -182,17 +212,21 @@ var (
 // newReadHandleCtx creates a handlerCtx for one request/response or push.
 func newReadHandleCtx() *handlerCtx {
 	c := new(handlerCtx)
-	c.input = socket.NewMessage()
-	c.input.SetNewBody(c.binding)
+	c.withBinding = socket.WithNewBody(c.binding)
+	c.input = socket.NewMessage(c.withBinding)
 	c.output = socket.NewMessage()
 	return c
 }
 
 func (c *handlerCtx) reInit(s *session) {
 	c.sess = s
+	withRegistries := s.peer.withRegistries()
+	withRegistries(c.input)
+	withRegistries(c.output)
+	// NOTE: the swap is created lazily, if no custom data of the session
 	count := s.socket.SwapLen()
-	c.swap = goutil.RwMap(count)
 	if count > 0 {
+		c.swap = goutil.RwMap(count)
 		s.socket.Swap().Range(func(key, value interface{}) bool {
 			c.swap.Store(key, value)
 			return true
@@ -210,7 +244,12 @@ func (c *handlerCtx) clean() {
 	c.pluginContainer = nil
 	c.stat = nil
 	c.context = nil
-	c.input.Reset(socket.WithNewBody(c.binding))
+	c.handlerCancel = nil
+	c.batchReply = nil
+	c.skipHandler = false
+	c.expireAt = 0
+	c.deadline = 0
+	c.input.Reset(c.withBinding)
 	c.output.Reset()
 }
 
@@ -236,9 +275,21 @@ func (c *handlerCtx) Output() Message {
 
 // Swap returns custom data swap of context.
 func (c *handlerCtx) Swap() goutil.Map {
+	if c.swap == nil {
+		c.swap = goutil.RwMap()
+	}
 	return c.swap
 }
 
+// ReplyDirectly skips the handler, and replies the CALL with the body encoded by the bodyCodec.
+func (c *handlerCtx) ReplyDirectly(body interface{}, bodyCodec byte) {
+	c.skipHandler = true
+	if c.input.Mtype() == TypeCall {
+		c.output.SetBody(body)
+		c.output.SetBodyCodec(bodyCodec)
+	}
+}
+
 // Seq returns the input message sequence.
 func (c *handlerCtx) Seq() int32 {
 	return c.input.Seq()
@@ -276,15 +327,39 @@ func (c *handlerCtx) CopyMeta() *utils.Args {
 
 // AddMeta adds the header metadata 'key=value' for reply message.
 // Multiple values for the same key may be added.
+// NOTE: The reserved key of MetaReservedPrefix is ignored.
 func (c *handlerCtx) AddMeta(key, value string) {
+	if IsReservedMeta(key) {
+		Warnf("ignored the reserved metadata key: %s", key)
+		return
+	}
 	c.output.Meta().Add(key, value)
 }
 
 // SetMeta sets the header metadata 'key=value' for reply message.
+// NOTE: The reserved key of MetaReservedPrefix is ignored.
 func (c *handlerCtx) SetMeta(key, value string) {
+	if IsReservedMeta(key) {
+		Warnf("ignored the reserved metadata key: %s", key)
+		return
+	}
 	c.output.Meta().Set(key, value)
 }
 
+// AddTrailer adds the trailer metadata 'key=value' framed after the reply body.
+// Multiple values for the same key may be added.
+// NOTE:
+//  The plugins can also set them by ctx.Output().Trailer() in PreWriteReply, after the body is produced;
+//  Only supported by the raw proto and the h2 proto.
+func (c *handlerCtx) AddTrailer(key, value string) {
+	c.output.Trailer().Add(key, value)
+}
+
+// SetTrailer sets the trailer metadata 'key=value' framed after the reply body.
+func (c *handlerCtx) SetTrailer(key, value string) {
+	c.output.Trailer().Set(key, value)
+}
+
 // GetBodyCodec gets the body codec type of the input message.
 func (c *handlerCtx) GetBodyCodec() byte {
 	return c.input.BodyCodec()
@@ -331,13 +406,52 @@ func (c *handlerCtx) setContext(ctx context.Context) {
 // Be executed synchronously when reading message
 func (c *handlerCtx) binding(header Header) (body interface{}) {
 	c.start = c.sess.timeNow()
-	c.pluginContainer = c.sess.peer.pluginContainer
+	c.pluginContainer = c.sess.withPlugins(c.sess.peer.pluginContainer)
 	switch header.Mtype() {
 	case TypeReply:
 		return c.bindReply(header)
 	case TypePush:
+		if !c.bindMetaLimits(header) {
+			return nil
+		}
+		switch header.ServiceMethod() {
+		case CancelServiceMethod:
+			c.bindCancel(header)
+			return nil
+		case BusyServiceMethod:
+			Warnf("rejected by the server %s: %s", c.sess.RemoteAddr().String(), header.Status().String())
+			return nil
+		case AckServiceMethod:
+			c.sess.ackPush(header.Meta().Peek(MetaAckSeq))
+			return nil
+		case Seq64ServiceMethod:
+			c.sess.handleSeq64(header)
+			return nil
+		case CodecServiceMethod:
+			c.sess.handleCodec(header)
+			return nil
+		case FragmentServiceMethod:
+			c.sess.handleFragment(header)
+			return nil
+		case DialMetaServiceMethod:
+			c.sess.handleDialMeta(header)
+			return nil
+		case PingServiceMethod:
+			c.sess.handlePing(header)
+			return nil
+		case ProgressServiceMethod:
+			c.sess.handleProgress(header)
+			return nil
+		}
+		c.bindTTL(header)
+		c.bindDeadline(header)
 		return c.bindPush(header)
 	case TypeCall:
+		if !c.bindMetaLimits(header) {
+			return nil
+		}
+		c.bindTTL(header)
+		c.bindDeadline(header)
 		return c.bindCall(header)
 	default:
 		c.stat = statCodeMtypeNotAllowed
@@ -375,7 +489,7 @@ E:
 	c.output.SetStatus(statCodeMtypeNotAllowed)
 	Errorf(logFormatDisconnected,
 		c.input.Mtype(), c.IP(), c.input.ServiceMethod(), c.input.Seq(),
-		messageLogBytes(c.input, c.sess.peer.printDetail))
+		messageLogBytes(c.input, atomic.LoadInt32(&c.sess.peer.printDetail) != 0))
 	go c.sess.Close()
 }
 
@@ -398,7 +512,7 @@ func (c *handlerCtx) bindPush(header Header) interface{} {
 	}
 
 	// reset plugin container
-	c.pluginContainer = c.handler.pluginContainer
+	c.pluginContainer = c.sess.withPlugins(c.handler.pluginContainer)
 
 	c.arg = c.handler.NewArgValue()
 	c.input.SetBody(c.arg.Interface())
@@ -411,13 +525,13 @@ func (c *handlerCtx) bindPush(header Header) interface{} {
 }
 
 func (c *handlerCtx) recordCost() {
-	c.cost = time.Duration(c.sess.timeNow() - c.start)
+	c.cost = c.sess.peer.costSince(c.start)
 }
 
 // handlePush handles push.
 func (c *handlerCtx) handlePush() {
 	if age := c.sess.ContextAge(); age > 0 {
-		ctxTimout, _ := context.WithTimeout(context.Background(), age)
+		ctxTimout, _ := ClockWithTimeout(c.sess.peer.clock, context.Background(), age)
 		c.setContext(ctxTimout)
 	}
 	defer func() {
@@ -428,21 +542,53 @@ func (c *handlerCtx) handlePush() {
 		if enablePrintRunLog() {
 			c.sess.printRunLog(c.RealIP(), c.cost, c.input, nil, typePushHandle)
 		}
+		if len(c.input.Meta().Peek(MetaPushAck)) > 0 {
+			c.sess.sendPushAck(GetSeq64(c.input))
+		}
 	}()
 	if c.stat.OK() && c.handler != nil {
-		if c.pluginContainer.postReadPushBody(c) == nil {
-			if c.handler.isUnknown {
-				c.handler.unknownHandleFunc(c)
-			} else {
-				c.handler.handleFunc(c, c.arg)
-			}
+		if c.stat = c.checkExpired(); c.stat.OK() && c.pluginContainer.postReadPushBody(c) == nil {
+			c.runHandler()
 		}
 	}
 	if !c.stat.OK() {
+		c.sess.stats.add(cntErrors, 1)
 		Warnf("%s", c.stat.String())
 	}
 }
 
+// runHandler executes the handler, and turns its panic into the handling status,
+// so that the subsequent plugins and logging still work.
+func (c *handlerCtx) runHandler() {
+	if c.skipHandler {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			c.output.SetBody(nil)
+			c.sess.peer.events.emit(Event{
+				Type:          EventHandlerPanic,
+				Session:       c.sess,
+				Network:       c.sess.peer.network,
+				Addr:          c.sess.RemoteAddr().String(),
+				ServiceMethod: c.input.ServiceMethod(),
+				Panic:         p,
+			})
+			if stat := c.pluginContainer.postHandlePanic(c, p); !stat.OK() {
+				c.stat = stat
+				return
+			}
+			Errorf("panic:%v\n%s", p, goutil.PanicTrace(2))
+			c.stat = statInternalServerError.Copy(p)
+		}
+	}()
+	if c.handler.isUnknown {
+		c.handler.unknownHandleFunc(c)
+	} else {
+		c.handler.handleFunc(c, c.arg)
+	}
+}
+
 func (c *handlerCtx) bindCall(header Header) interface{} {
 	c.stat = c.pluginContainer.postReadCallHeader(c)
 	if !c.stat.OK() {
@@ -454,15 +600,23 @@ func (c *handlerCtx) bindCall(header Header) interface{} {
 		return nil
 	}
 
-	var ok bool
-	c.handler, ok = c.sess.getCallHandler(header.ServiceMethod())
-	if !ok {
-		c.stat = statNotFound
-		return nil
+	if header.ServiceMethod() == BatchServiceMethod {
+		if c.batchReply != nil {
+			c.stat = statBadMessage.Copy("nested batch call")
+			return nil
+		}
+		c.handler = newBatchHandler(c.sess.peer.pluginContainer)
+	} else {
+		var ok bool
+		c.handler, ok = c.sess.getCallHandler(header.ServiceMethod())
+		if !ok {
+			c.stat = statNotFound
+			return nil
+		}
 	}
 
 	// reset plugin container
-	c.pluginContainer = c.handler.pluginContainer
+	c.pluginContainer = c.sess.withPlugins(c.handler.pluginContainer)
 
 	if c.handler.isUnknown {
 		c.input.SetBody(new([]byte))
@@ -476,9 +630,42 @@ func (c *handlerCtx) bindCall(header Header) interface{} {
 		return nil
 	}
 
+	// the handler's context can be canceled by the caller
+	ctx, cancel := context.WithCancel(c.input.Context())
+	socket.WithContext(ctx)(c.input)
+	c.handlerCancel = cancel
+	if c.batchReply == nil {
+		// the batch item is canceled with the batch call
+		c.sess.handlerCancels.Store(GetSeq64(header), cancel)
+	}
+
 	return c.input.Body()
 }
 
+// releaseHandlerCancel removes the cancel function of the call handler and releases its context,
+// whether the call is handled or rejected before handling.
+func (c *handlerCtx) releaseHandlerCancel() {
+	if c.handlerCancel == nil {
+		return
+	}
+	if c.batchReply == nil {
+		c.sess.handlerCancels.Delete(GetSeq64(c.input))
+	}
+	c.handlerCancel()
+	c.handlerCancel = nil
+}
+
+// bindCancel cancels the context of the call handler, by the cancellation notice from the caller.
+func (c *handlerCtx) bindCancel(header Header) {
+	seq, err := parseSeq(header.Meta().Peek(MetaCancelSeq))
+	if err != nil {
+		return
+	}
+	if cancel, ok := c.sess.handlerCancels.LoadAndDelete(seq); ok {
+		cancel.(context.CancelFunc)()
+	}
+}
+
 // handleCall handles and replies call.
 func (c *handlerCtx) handleCall() {
 	var writed bool
@@ -493,18 +680,22 @@ func (c *handlerCtx) handleCall() {
 			}
 		}
 		c.recordCost()
+		c.pluginContainer.postHandleCall(c)
 		if enablePrintRunLog() {
 			c.sess.printRunLog(c.RealIP(), c.cost, c.input, c.output, typeCallHandle)
 		}
 	}()
 
 	c.output.SetMtype(TypeReply)
-	c.output.SetSeq(c.input.Seq())
+	setSeq64(c.output, GetSeq64(c.input))
 	c.output.SetServiceMethod(c.input.ServiceMethod())
 	c.output.XferPipe().AppendFrom(c.input.XferPipe())
+	if priority := c.input.Meta().Peek(MetaPriority); len(priority) > 0 {
+		c.output.Meta().Set(MetaPriority, string(priority))
+	}
 
 	if age := c.sess.ContextAge(); age > 0 {
-		ctxTimout, _ := context.WithTimeout(c.input.Context(), age)
+		ctxTimout, _ := ClockWithTimeout(c.sess.peer.clock, c.input.Context(), age)
 		c.setContext(ctxTimout)
 		socket.WithContext(ctxTimout)(c.output)
 	}
@@ -512,17 +703,32 @@ func (c *handlerCtx) handleCall() {
 	if c.stat.OK() {
 		c.stat = c.output.Status()
 	}
+	if c.stat.OK() {
+		c.stat = c.checkExpired()
+	}
 
 	// handle call
 	if c.stat.OK() {
 		c.stat = c.pluginContainer.postReadCallBody(c)
 		if c.stat.OK() {
-			if c.handler.isUnknown {
-				c.handler.unknownHandleFunc(c)
-			} else {
-				c.handler.handleFunc(c, c.arg)
-			}
+			c.runHandler()
+		}
+	}
+	if !c.stat.OK() {
+		c.sess.stats.add(cntErrors, 1)
+	}
+
+	// the caller has canceled the call, no reply needed
+	if c.batchReply != nil {
+		if c.input.Context().Err() == context.Canceled {
+			writed = true
+			return
 		}
+	} else if cancel, ok := c.sess.handlerCancels.LoadAndDelete(GetSeq64(c.input)); ok {
+		defer cancel.(context.CancelFunc)()
+	} else if c.input.Context().Err() == context.Canceled {
+		writed = true
+		return
 	}
 
 	// reply call
@@ -550,7 +756,7 @@ func (c *handlerCtx) ReplyBodyCodec() byte {
 	}
 	id, ok := GetAcceptBodyCodec(c.input.Meta())
 	if ok {
-		if _, err := codec.Get(id); err == nil {
+		if _, err := c.sess.peer.codecs.Get(id); err == nil {
 			c.output.SetBodyCodec(id)
 			return id
 		}
@@ -569,10 +775,15 @@ func (c *handlerCtx) setReplyBodyCodec(hasError bool) {
 
 func (c *handlerCtx) writeReply(stat *Status) *Status {
 	if !stat.OK() {
+		stat = localizeStatus(stat, c.input.Meta())
 		c.output.SetStatus(stat)
+		setStatusDetails(c.output.Meta(), stat)
 		c.output.SetBody(nil)
 		c.output.SetBodyCodec(codec.NilCodecID)
 	}
+	if c.batchReply != nil {
+		return c.batchReply(c.output)
+	}
 	serviceMethod := c.output.ServiceMethod()
 	c.output.SetServiceMethod("")
 	_, stat = c.sess.write(c.output)
@@ -581,15 +792,23 @@ func (c *handlerCtx) writeReply(stat *Status) *Status {
 }
 
 func (c *handlerCtx) bindReply(header Header) interface{} {
-	_callCmd, ok := c.sess.callCmdMap.Load(header.Seq())
+	callCmd, ok := c.sess.callCmdMap.Load(GetSeq64(header))
 	if !ok {
 		Warnf("not found call cmd: %v", c.input)
 		return nil
 	}
-	c.callCmd = _callCmd.(*callCmd)
+	c.callCmd = callCmd
 
 	// unlock: handleReply
 	c.callCmd.mu.Lock()
+	select {
+	case <-c.callCmd.doneChan:
+		// canceled before the reply
+		c.callCmd.mu.Unlock()
+		c.callCmd = nil
+		return nil
+	default:
+	}
 	c.input.SetServiceMethod(c.callCmd.output.ServiceMethod())
 	c.swap = c.callCmd.swap
 	c.callCmd.inputBodyCodec = c.GetBodyCodec()
@@ -622,9 +841,13 @@ func (c *handlerCtx) handleReply() {
 			Errorf("panic:%v\n%s", p, goutil.PanicTrace(2))
 		}
 		c.callCmd.result = c.input.Body()
+		if c.input.Trailer().Len() > 0 {
+			c.callCmd.trailerMeta = utils.AcquireArgs()
+			c.input.Trailer().CopyTo(c.callCmd.trailerMeta)
+		}
 		c.stat = c.callCmd.stat
 		c.callCmd.done()
-		c.callCmd.cost = time.Duration(c.sess.timeNow() - c.callCmd.start)
+		c.callCmd.cost = c.sess.peer.costSince(c.callCmd.start)
 		if enablePrintRunLog() {
 			c.sess.printRunLog(c.RealIP(), c.callCmd.cost, c.input, c.callCmd.output, typeCallLaunch)
 		}
@@ -632,7 +855,11 @@ func (c *handlerCtx) handleReply() {
 		c.callCmd.mu.Unlock()
 	}()
 	if c.callCmd.stat.OK() {
-		stat := c.input.Status()
+		// NOTE: the reply failed to read, e.g. corrupted, is not trusted.
+		stat := c.stat
+		if stat.OK() {
+			stat = getStatusDetails(c.input.Meta(), c.input.Status())
+		}
 		if stat.OK() {
 			stat = c.pluginContainer.postReadReplyBody(c)
 		}
@@ -703,30 +930,62 @@ type (
 		//  Inside, <-Done() is automatically called and blocked,
 		//  until the call is completed!
 		InputMeta() *utils.Args
+		// TrailerMeta returns the trailer metadata of input message, framed after the reply body.
+		// NOTE:
+		//  Inside, <-Done() is automatically called and blocked,
+		//  until the call is completed!
+		//  Without the trailers, it is a shared empty value, do not modify it!
+		TrailerMeta() *utils.Args
+		// OnProgress registers the callback of the progress notifications of the call, emitted by CallCtx.Progress.
+		// NOTE: fn is called in order by the reading goroutine of the session, so it must be fast and not block.
+		OnProgress(fn ProgressFunc)
 		// CostTime returns the called cost time.
 		// If PeerConfig.CountTime=false, always returns 0.
 		// NOTE:
 		//  Inside, <-Done() is automatically called and blocked,
 		//  until the call is completed!
 		CostTime() time.Duration
+		// Then registers the continuation called in a new goroutine after the call is completed.
+		Then(fn func(CallCmd))
+		// Wait waits for the call to complete until the context is done,
+		// if the context is done first, the call is canceled.
+		Wait(ctx context.Context) *Status
+	}
+	// CallCanceler the call command that can be canceled, e.g. the CallCmd returned by Session.
+	// NOTE: Use the type assertion, e.g. if c, ok := callCmd.(CallCanceler); ok { c.Cancel() }
+	CallCanceler interface {
+		// Cancel cancels the call if it has not been replied,
+		// and notifies the remote peer to cancel the handler's context.
+		// NOTE: The call is completed with CodeCallCanceled.
+		Cancel()
 	}
 	callCmd struct {
-		start          int64
-		cost           time.Duration
-		sess           *session
-		output         Message
-		result         interface{}
-		stat           *Status
-		inputMeta      *utils.Args
-		swap           goutil.Map
-		mu             sync.Mutex
-		callCmdChan    chan<- CallCmd // Send itself to the public channel when call is complete.
-		doneChan       chan struct{}  // Strobes when call is complete.
-		inputBodyCodec byte
+		start           int64
+		cost            time.Duration
+		sess            *session
+		output          Message
+		result          interface{}
+		stat            *Status
+		inputMeta       *utils.Args
+		trailerMeta     *utils.Args
+		swap            goutil.Map
+		mu              sync.Mutex
+		callCmdChan     chan<- CallCmd // Send itself to the public channel when call is complete.
+		doneChan        chan struct{}  // Strobes when call is complete.
+		conn            net.Conn       // the connection the call is written to
+		progressMu      sync.Mutex     // guards the progress, apart from mu locked during the reply
+		progressFunc    ProgressFunc
+		progressNote    string
+		progressPercent int
+		progressed      bool
+		inputBodyCodec  byte
 	}
 )
 
-var _ WriteCtx = new(callCmd)
+var (
+	_ WriteCtx     = new(callCmd)
+	_ CallCanceler = new(callCmd)
+)
 
 // TracePeer trace back the peer.
 func (c *callCmd) TracePeer() (Peer, bool) {
@@ -825,6 +1084,23 @@ func (c *callCmd) InputMeta() *utils.Args {
 	return c.inputMeta
 }
 
+// TrailerMeta returns the trailer metadata of input message, framed after the reply body.
+// NOTE:
+//  Inside, <-Done() is automatically called and blocked,
+//  until the call is completed!
+//  Without the trailers, it is a shared empty value, do not modify it!
+func (c *callCmd) TrailerMeta() *utils.Args {
+	<-c.Done()
+	if c.trailerMeta == nil {
+		return emptyTrailer
+	}
+	return c.trailerMeta
+}
+
+// emptyTrailer the shared trailer metadata of the replies without the trailers,
+// not to allocate one for each reply.
+var emptyTrailer = new(utils.Args)
+
 // CostTime returns the called cost time.
 // If PeerConfig.CountTime=false, always returns 0.
 // NOTE:
@@ -836,24 +1112,82 @@ func (c *callCmd) CostTime() time.Duration {
 }
 
 func (c *callCmd) done() {
-	c.sess.callCmdMap.Delete(c.output.Seq())
+	c.sess.callCmdMap.Delete(GetSeq64(c.output))
 	c.callCmdChan <- c
 	close(c.doneChan)
 	// free count call-launch
 	c.sess.graceCallCmdWaitGroup.Done()
 }
 
-func (c *callCmd) cancel(reason string) {
-	c.sess.callCmdMap.Delete(c.output.Seq())
-	if reason != "" {
-		c.stat = statConnClosed.Copy(reason)
-	} else {
-		c.stat = statConnClosed
+func (c *callCmd) cancel(stat *Status) {
+	c.sess.callCmdMap.Delete(GetSeq64(c.output))
+	c.stat = stat
+	c.callCmdChan <- c
+	close(c.doneChan)
+	// free count call-launch
+	c.sess.graceCallCmdWaitGroup.Done()
+}
+
+// Cancel cancels the call if it has not been replied,
+// and notifies the remote peer to cancel the handler's context.
+// NOTE: The call is completed with CodeCallCanceled.
+func (c *callCmd) Cancel() {
+	c.abort(context.Canceled)
+}
+
+// Then registers the continuation called in a new goroutine after the call is completed.
+func (c *callCmd) Then(fn func(CallCmd)) {
+	go func() {
+		<-c.doneChan
+		fn(c)
+	}()
+}
+
+// Wait waits for the call to complete until the context is done,
+// if the context is done first, the call is canceled.
+func (c *callCmd) Wait(ctx context.Context) *Status {
+	select {
+	case <-c.doneChan:
+	case <-ctx.Done():
+		c.abort(ctx.Err())
 	}
+	<-c.doneChan
+	return c.stat
+}
+
+// watchContext cancels the call if the context is done before the reply.
+func (c *callCmd) watchContext(ctxDone <-chan struct{}) {
+	select {
+	case <-c.doneChan:
+	case <-ctxDone:
+		c.abort(c.output.Context().Err())
+	}
+}
+
+func (c *callCmd) abort(err error) {
+	c.mu.Lock()
+	select {
+	case <-c.doneChan:
+		c.mu.Unlock()
+		return
+	default:
+	}
+	seq := GetSeq64(c.output)
+	// only the pending call on the live session needs the notice
+	notify := !c.hasReply() && c.sess.getStatus() == statusOk
+	c.sess.callCmdMap.Delete(seq)
+	c.stat = statCallCanceled.Copy(err)
 	c.callCmdChan <- c
 	close(c.doneChan)
 	// free count call-launch
 	c.sess.graceCallCmdWaitGroup.Done()
+	c.mu.Unlock()
+	if !notify {
+		return
+	}
+	if stat := c.sess.RawPush(CancelServiceMethod, nil, WithSetMeta(MetaCancelSeq, formatSeq(seq))); !stat.OK() {
+		Debugf("notify the call cancellation: %s", stat.String())
+	}
 }
 
 // if callCmd.inputMeta!=nil, means the callCmd is replyed.
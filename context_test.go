@@ -0,0 +1,42 @@
+package erpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCallThenAndWait(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{ListenPort: 9102})
+	srv.RouteCallFunc(batch_call)
+	go srv.ListenAndServe()
+	defer srv.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(":9102")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var result int
+	callCmd := sess.AsyncCall("/batch/call", 2, &result, nil)
+	replied := make(chan int, 1)
+	callCmd.Then(func(c erpc.CallCmd) {
+		r, _ := c.Reply()
+		replied <- *r.(*int)
+	})
+	select {
+	case r := <-replied:
+		if r != 4 {
+			t.Fatalf("got %d", r)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if stat = sess.AsyncCall("/batch/call", 3, &result, nil).Wait(ctx); !stat.OK() || result != 6 {
+		t.Fatalf("stat: %v, result: %d", stat, result)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"bytes"
+	"net"
+
+	"github.com/andeya/erpc/v7/socket"
+	"github.com/andeya/goutil"
+)
+
+// MetaDatagram the key of the flag of the PUSH sent by the unreliable datagram
+const MetaDatagram = "X-Datagram"
+
+// WithDatagram sends the PUSH by the unreliable QUIC DATAGRAM frame,
+// which is not blocked by the lost packets of the stream, but may be lost or reordered.
+// NOTE:
+//  Only if both sides enabled PeerConfig.QUICDatagrams;
+//  Otherwise, or if the message does not fit in one QUIC packet, it is sent by the stream as usual;
+//  It has no effect on the other message types.
+func WithDatagram() MessageSetting {
+	return socket.WithSetMeta(MetaDatagram, "1")
+}
+
+// datagramConn the connection supporting the unreliable datagrams, e.g. *quic.Conn
+type datagramConn interface {
+	SupportsDatagrams() bool
+	SendDatagram([]byte) error
+	ReceiveDatagram() ([]byte, error)
+}
+
+// writeDatagram sends the PUSH with WithDatagram by one datagram,
+// and returns false if it should be sent by the stream.
+func (s *session) writeDatagram(conn net.Conn, message Message) bool {
+	if message.Mtype() != TypePush || len(message.Meta().Peek(MetaDatagram)) == 0 {
+		return false
+	}
+	dc, ok := conn.(datagramConn)
+	if !ok || !dc.SupportsDatagrams() {
+		return false
+	}
+	var buf bytes.Buffer
+	if err := s.GetProtoFunc()(&buf).Pack(message); err != nil {
+		return false
+	}
+	if err := dc.SendDatagram(buf.Bytes()); err != nil {
+		Debugf("send datagram error, fall back to the stream: %s", err.Error())
+		return false
+	}
+	s.stats.addMessage(message.Mtype(), message.Size(), true)
+	s.markActive(true)
+	s.peer.taps.capture(s, message, TapOutbound)
+	return true
+}
+
+// startReadDatagrams reads and handles the PUSH of the datagrams until the connection is closed.
+func (s *session) startReadDatagrams(conn net.Conn) {
+	dc, ok := conn.(datagramConn)
+	if !ok {
+		return
+	}
+	AnywayGo(func() {
+		defer func() {
+			if p := recover(); p != nil {
+				Errorf("panic:%v\n%s", p, goutil.PanicTrace(2))
+			}
+		}()
+		if !dc.SupportsDatagrams() {
+			return
+		}
+		withContext := socket.WithContext(nil)
+		for s.goonRead() {
+			b, err := dc.ReceiveDatagram()
+			if err != nil {
+				return
+			}
+			var ctx = s.peer.getContext(s, false)
+			withContext(ctx.input)
+			if s.peer.pluginContainer.preReadHeader(ctx) != nil {
+				s.peer.putContext(ctx, false)
+				continue
+			}
+			// only the PUSH is allowed, since the others can not be lost
+			err = s.GetProtoFunc()(bytes.NewBuffer(b)).Unpack(ctx.input)
+			if err != nil || ctx.input.Mtype() != TypePush || !s.goonRead() {
+				if err != nil {
+					Debugf("read datagram error: %s", err.Error())
+					s.stats.add(cntErrors, 1)
+				}
+				s.peer.putContext(ctx, false)
+				continue
+			}
+			s.stats.addMessage(TypePush, ctx.input.Size(), false)
+			s.markActive(false)
+			s.peer.taps.capture(s, ctx.input, TapInbound)
+			s.stats.addActiveHandlers(1)
+			s.graceCtxWaitGroup.Add(1)
+			if !s.peer.goHandle(ctx, func() {
+				defer s.peer.putContext(ctx, true)
+				defer s.stats.addActiveHandlers(-1)
+				ctx.handle()
+			}) {
+				s.stats.addActiveHandlers(-1)
+				s.peer.putContext(ctx, true)
+			}
+		}
+	})
+}
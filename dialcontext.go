@@ -0,0 +1,146 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/andeya/erpc/v7/utils"
+)
+
+// DialMetaServiceMethod the service method of the metadata sent at the end of the dial handshake,
+// it is a PUSH handled by the framework, and the old peer not supporting it logs it as the unknown PUSH.
+const DialMetaServiceMethod = "/erpc/dial_meta"
+
+type (
+	// DialOption the per-dial option of Peer.DialContext
+	DialOption  func(*dialOptions)
+	dialOptions struct {
+		tlsConfig  *tls.Config
+		protoFuncs []ProtoFunc
+		localAddr  string
+		meta       *utils.Args
+		plugins    []Plugin
+	}
+)
+
+// WithDialTLSConfig dials by the TLS config, overriding the one of the peer.
+func WithDialTLSConfig(tlsConfig *tls.Config) DialOption {
+	return func(o *dialOptions) {
+		o.tlsConfig = tlsConfig
+	}
+}
+
+// WithDialProtoFunc dials by the socket communication protocol.
+func WithDialProtoFunc(protoFunc ...ProtoFunc) DialOption {
+	return func(o *dialOptions) {
+		o.protoFuncs = protoFunc
+	}
+}
+
+// WithDialLocalAddr binds the local address "ip:port" of the dial, overriding PeerConfig.LocalIP,
+// the port 0 means a random one.
+func WithDialLocalAddr(addr string) DialOption {
+	return func(o *dialOptions) {
+		o.localAddr = addr
+	}
+}
+
+// WithDialMeta sets the metadata sent at the end of the dial handshake, after the PostDialPlugin plugins,
+// and sent again at each redial. The remote peer gets it by GetDialMeta.
+func WithDialMeta(key, value string) DialOption {
+	return func(o *dialOptions) {
+		if o.meta == nil {
+			o.meta = new(utils.Args)
+		}
+		o.meta.Set(key, value)
+	}
+}
+
+// GetDialMeta returns the metadata sent by WithDialMeta (client role) or received from the remote peer (server role),
+// or nil if none.
+// NOTE: The returned value is read only.
+func GetDialMeta(sess CtxSession) *utils.Args {
+	s, ok := sess.(*session)
+	if !ok {
+		return nil
+	}
+	meta, _ := s.dialMeta.Load().(*utils.Args)
+	return meta
+}
+
+// dialer returns the dialer with the options, or the base one without the overrides.
+func (o *dialOptions) dialer(base *Dialer) (*Dialer, error) {
+	if o.tlsConfig == nil && o.localAddr == "" {
+		return base, nil
+	}
+	d := *base
+	if o.tlsConfig != nil {
+		d.tlsConfig = o.tlsConfig
+	}
+	if o.localAddr != "" {
+		host, port, err := net.SplitHostPort(o.localAddr)
+		if err != nil {
+			return nil, err
+		}
+		cfg := PeerConfig{Network: base.network, LocalIP: host}
+		if d.localAddr, err = cfg.newAddr(port); err != nil {
+			return nil, err
+		}
+	}
+	return &d, nil
+}
+
+// interruptByContext interrupts the handshake on the connection when the context is done,
+// and stop waits for the watching to exit.
+func interruptByContext(ctx context.Context, conn net.Conn) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	done, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// sendDialMeta sends the metadata of WithDialMeta in the handshake.
+func (s *session) sendDialMeta() *Status {
+	meta, _ := s.dialMeta.Load().(*utils.Args)
+	if meta == nil || meta.Len() == 0 {
+		return nil
+	}
+	return s.PreSend(TypePush, DialMetaServiceMethod, nil, nil, func(m Message) {
+		meta.CopyTo(m.Meta())
+	})
+}
+
+// handleDialMeta stores the metadata of the dial handshake of the remote peer.
+func (s *session) handleDialMeta(header Header) {
+	meta := new(utils.Args)
+	header.Meta().CopyTo(meta)
+	s.dialMeta.Store(meta)
+}
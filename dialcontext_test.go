@@ -0,0 +1,80 @@
+package erpc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func dial_meta(ctx CallCtx, _ *struct{}) (string, *Status) {
+	return string(GetDialMeta(ctx.Session()).Peek("token")), nil
+}
+
+// hangDialPlugin waits for the handshake reply that never comes.
+type hangDialPlugin struct{}
+
+func (hangDialPlugin) Name() string { return "hang-dial" }
+
+func (hangDialPlugin) PostDial(sess PreSession, _ bool) *Status {
+	return sess.PreReceive(func(Header) interface{} { return nil }).Status()
+}
+
+func TestDialContext(t *testing.T) {
+	srv := NewPeer(PeerConfig{ListenPort: 9126})
+	defer srv.Close()
+	srv.SetTLSConfig(GenerateTLSConfigForServer())
+	srv.RouteCallFunc(dial_meta)
+	go srv.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := NewPeer(PeerConfig{RedialTimes: 1})
+	defer cli.Close()
+	sess, stat := cli.DialContext(context.Background(), ":9126",
+		WithDialTLSConfig(GenerateTLSConfigForClient()),
+		WithDialLocalAddr("127.0.0.1:0"),
+		WithDialMeta("token", "abc"),
+	)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	if addr := sess.LocalAddr().String(); !strings.HasPrefix(addr, "127.0.0.1:") {
+		t.Fatalf("local addr: %s", addr)
+	}
+	var reply string
+	if stat = sess.Call("/dial/meta", nil, &reply).Status(); !stat.OK() || reply != "abc" {
+		t.Fatalf("reply: %q, stat: %v", reply, stat)
+	}
+	// sent again at the redial
+	sess.Migrate()
+	time.Sleep(200 * time.Millisecond)
+	if stat = sess.Call("/dial/meta", nil, &reply).Status(); !stat.OK() || reply != "abc" {
+		t.Fatalf("reply: %q, stat: %v", reply, stat)
+	}
+
+	// canceled while retrying
+	cli2 := NewPeer(PeerConfig{RedialTimes: -1, RedialInterval: 50 * time.Millisecond})
+	defer cli2.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, stat = cli2.DialContext(ctx, ":9127"); stat.Code() != CodeDialFailed {
+		t.Fatalf("stat: %v, expect dial failed", stat)
+	}
+	if cost := time.Since(start); cost > time.Second {
+		t.Fatalf("cost: %v", cost)
+	}
+
+	// canceled in the handshake
+	cli3 := NewPeer(PeerConfig{}, hangDialPlugin{})
+	defer cli3.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if _, stat = cli3.DialContext(ctx, ":9126", WithDialTLSConfig(GenerateTLSConfigForClient())); stat.Code() != CodeDialFailed {
+		t.Fatalf("stat: %v, expect dial failed", stat)
+	}
+	if cost := time.Since(start); cost > time.Second {
+		t.Fatalf("cost: %v", cost)
+	}
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/andeya/erpc/v7/kcp"
 	"github.com/andeya/erpc/v7/quic"
+	quicgo "github.com/lucas-clemente/quic-go"
 )
 
 // Dialer dial-up connection
@@ -32,6 +33,11 @@ type Dialer struct {
 	dialTimeout    time.Duration
 	redialInterval time.Duration
 	redialTimes    int32
+	clock          Clock
+	kcpConfig      kcp.Config
+	quicConfig     *quicgo.Config
+	quicEarly      bool
+	quicSessions   tls.ClientSessionCache // the TLS sessions resumed by the 0-RTT dials
 }
 
 // NewDialer creates a dialer.
@@ -45,6 +51,8 @@ func NewDialer(localAddr net.Addr, tlsConfig *tls.Config,
 		dialTimeout:    dialTimeout,
 		redialInterval: redialInterval,
 		redialTimes:    redialTimes,
+		kcpConfig:      defaultKCPConfig,
+		clock:          SystemClock,
 	}
 }
 
@@ -80,14 +88,19 @@ func (d *Dialer) RedialTimes() int32 {
 
 // Dial dials the connection, and try again if it fails.
 func (d *Dialer) Dial(addr string) (net.Conn, error) {
-	return d.dialWithRetry(addr, "", nil)
+	return d.dialWithRetry(context.Background(), addr, "", nil)
+}
+
+// DialContext dials the connection, and try again if it fails, until the context is done.
+func (d *Dialer) DialContext(ctx context.Context, addr string) (net.Conn, error) {
+	return d.dialWithRetry(ctx, addr, "", nil)
 }
 
 // dialWithRetry dials the connection, and try again if it fails.
 // NOTE:
 //  sessID is not empty only when the disconnection is redialing
-func (d *Dialer) dialWithRetry(addr, sessID string, fn func(conn net.Conn) error) (net.Conn, error) {
-	conn, err := d.dialOne(addr)
+func (d *Dialer) dialWithRetry(ctx context.Context, addr, sessID string, fn func(conn net.Conn) error) (net.Conn, error) {
+	conn, err := d.dialOne(ctx, addr)
 	if err == nil {
 		if fn == nil {
 			return conn, nil
@@ -99,13 +112,17 @@ func (d *Dialer) dialWithRetry(addr, sessID string, fn func(conn net.Conn) error
 	}
 	redialTimes := d.newRedialCounter()
 	for redialTimes.Next() {
-		time.Sleep(d.redialInterval)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ClockAfter(d.clock, d.redialInterval):
+		}
 		if sessID == "" {
 			Debugf("trying to redial... (network:%s, addr:%s)", d.network, addr)
 		} else {
 			Debugf("trying to redial... (network:%s, addr:%s, id:%s)", d.network, addr, sessID)
 		}
-		conn, err = d.dialOne(addr)
+		conn, err = d.dialOne(ctx, addr)
 		if err == nil {
 			if fn == nil {
 				return conn, nil
@@ -119,15 +136,12 @@ func (d *Dialer) dialWithRetry(addr, sessID string, fn func(conn net.Conn) error
 	return nil, err
 }
 
-const (
-	dataShards   = 10
-	parityShards = 3
-)
-
 // dialOne dials the connection once.
-func (d *Dialer) dialOne(addr string) (net.Conn, error) {
+func (d *Dialer) dialOne(ctx context.Context, addr string) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if network := asQUIC(d.network); network != "" {
-		ctx := context.Background()
 		if d.dialTimeout > 0 {
 			ctx, _ = context.WithTimeout(ctx, d.dialTimeout)
 		}
@@ -135,20 +149,27 @@ func (d *Dialer) dialOne(addr string) (net.Conn, error) {
 		if tlsConf == nil {
 			tlsConf = GenerateTLSConfigForClient()
 		}
-		return quic.DialAddrContext(ctx, network, d.localAddr.(*FakeAddr).udpAddr, addr, tlsConf, nil)
+		if d.quicEarly {
+			if tlsConf.ClientSessionCache == nil {
+				tlsConf = tlsConf.Clone()
+				tlsConf.ClientSessionCache = d.quicSessions
+			}
+			return quic.DialAddrEarlyContext(ctx, network, d.localAddr.(*FakeAddr).udpAddr, addr, tlsConf, d.quicConfig)
+		}
+		return quic.DialAddrContext(ctx, network, d.localAddr.(*FakeAddr).udpAddr, addr, tlsConf, d.quicConfig)
 	}
 
 	if network := asKCP(d.network); network != "" {
-		return kcp.DialAddrContext(network, d.localAddr.(*FakeAddr).udpAddr, addr, d.tlsConfig, dataShards, parityShards)
+		return kcp.DialAddrConfig(network, d.localAddr.(*FakeAddr).udpAddr, addr, d.tlsConfig, d.kcpConfig)
 	}
 	dialer := &net.Dialer{
 		LocalAddr: d.localAddr,
 		Timeout:   d.dialTimeout,
 	}
 	if d.tlsConfig != nil {
-		return tls.DialWithDialer(dialer, d.network, addr, d.tlsConfig)
+		return (&tls.Dialer{NetDialer: dialer, Config: d.tlsConfig}).DialContext(ctx, d.network, addr)
 	}
-	return dialer.Dial(d.network, addr)
+	return dialer.DialContext(ctx, d.network, addr)
 }
 
 // newRedialCounter creates a new redial counter.
@@ -0,0 +1,350 @@
+// Package erpcbench is the reusable benchmark of the erpc calls with the configurable concurrency, payload size,
+// body codec, protocol and transport, reporting the latency percentiles by the HdrHistogram-like histogram.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package erpcbench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/codec"
+	"github.com/gogo/protobuf/proto"
+)
+
+// ServiceMethod the service method of the echo route of the benchmark server.
+const ServiceMethod = "/erpcbench/echo"
+
+// Payload the message of the benchmark calls.
+type Payload struct {
+	Data []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty" xml:"data"`
+}
+
+// Reset implements proto.Message.
+func (m *Payload) Reset() { *m = Payload{} }
+
+// String implements proto.Message.
+func (m *Payload) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage implements proto.Message.
+func (*Payload) ProtoMessage() {}
+
+// ServerConfig the config of the benchmark server.
+type ServerConfig struct {
+	// Network the network, default tcp
+	Network string
+	// Addr the listen address, default 127.0.0.1:0, i.e. a random port of the loopback
+	Addr string
+	// Delay mocks the business processing of each call, 0 means runtime.Gosched()
+	Delay time.Duration
+	// Options the options of the server peer, e.g. erpc.WithProtoFunc
+	Options []erpc.Plugin
+	// Tune modifies the config of the server peer
+	Tune func(*erpc.PeerConfig)
+}
+
+// Server the benchmark server echoing the calls of ServiceMethod.
+type Server struct {
+	erpc.Peer
+	addr string
+}
+
+type erpcbench struct {
+	erpc.CallCtx
+}
+
+func (e *erpcbench) Echo(arg *[]byte) ([]byte, *erpc.Status) {
+	if d, ok := e.Swap().Load(delayKey{}); ok && d.(time.Duration) > 0 {
+		time.Sleep(d.(time.Duration))
+	} else {
+		runtime.Gosched()
+	}
+	return *arg, nil
+}
+
+type delayKey struct{}
+
+// delayPlugin sets the delay of the echo route.
+type delayPlugin time.Duration
+
+func (delayPlugin) Name() string { return "erpcbench-delay" }
+
+func (d delayPlugin) PreReadCallBody(ctx erpc.ReadCtx) *erpc.Status {
+	ctx.Swap().Store(delayKey{}, time.Duration(d))
+	return nil
+}
+
+// NewServer creates and starts the benchmark server.
+// NOTE:
+//  The echo route replies the raw body with the codec of the call, i.e. the server does not decode the body;
+//  The route is ServiceMethod by the default service method mapper.
+func NewServer(cfg ServerConfig) (*Server, error) {
+	if cfg.Network == "" {
+		cfg.Network = "tcp"
+	}
+	if cfg.Addr == "" {
+		cfg.Addr = "127.0.0.1:0"
+	}
+	laddr, err := erpc.NewFakeAddr2(cfg.Network, cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	peerConfig := erpc.PeerConfig{Network: cfg.Network}
+	if cfg.Tune != nil {
+		cfg.Tune(&peerConfig)
+	}
+	peer := erpc.NewPeer(peerConfig, cfg.Options...)
+	peer.RouteCall(new(erpcbench), delayPlugin(cfg.Delay))
+	lis, err := erpc.NewInheritedListener(laddr, peer.TLSConfig())
+	if err != nil {
+		peer.Close()
+		return nil, err
+	}
+	go peer.ServeListener(lis)
+	return &Server{Peer: peer, addr: lis.Addr().String()}, nil
+}
+
+// Addr returns the listen address of the server.
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// Config the config of a benchmark run.
+type Config struct {
+	// Network the network, default tcp
+	Network string
+	// Addr the address of the server, empty means starting a local server by NewServer
+	Addr string
+	// ProtoFunc the protocol, default erpc.DefaultProtoFunc()
+	ProtoFunc erpc.ProtoFunc
+	// BodyCodec the body codec name, default protobuf
+	BodyCodec string
+	// Concurrency the number of the concurrent callers, default 1
+	Concurrency int
+	// Sessions the number of the sessions shared by the callers, default 1
+	Sessions int
+	// Requests the total number of the calls, default 10000, ignored if Duration>0
+	Requests int
+	// Duration the duration of the run
+	Duration time.Duration
+	// PayloadSize the size of the data of the payload, default 128
+	PayloadSize int
+	// Warmup the number of the calls of each caller before measuring, default 5
+	Warmup int
+	// SignificantDigits the significant digits of the latency histogram, default 3
+	SignificantDigits int
+	// Seed the seed of the payload data, for the reproducible runs
+	Seed int64
+	// Options the options of the client peer, e.g. erpc.WithPlugins
+	Options []erpc.Plugin
+	// Tune modifies the config of the client peer and the local server peer
+	Tune func(*erpc.PeerConfig)
+}
+
+func (c *Config) withDefault() error {
+	if c.Network == "" {
+		c.Network = "tcp"
+	}
+	if c.ProtoFunc == nil {
+		c.ProtoFunc = erpc.DefaultProtoFunc()
+	}
+	if c.BodyCodec == "" {
+		c.BodyCodec = codec.NAME_PROTOBUF
+	}
+	if _, err := codec.GetByName(c.BodyCodec); err != nil {
+		return err
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = 1
+	}
+	if c.Sessions <= 0 {
+		c.Sessions = 1
+	}
+	if c.Sessions > c.Concurrency {
+		c.Sessions = c.Concurrency
+	}
+	if c.Requests <= 0 {
+		c.Requests = 10000
+	}
+	if c.PayloadSize < 0 {
+		return errors.New("erpcbench: negative payload size")
+	}
+	if c.PayloadSize == 0 {
+		c.PayloadSize = 128
+	}
+	if c.Warmup < 0 {
+		c.Warmup = 0
+	} else if c.Warmup == 0 {
+		c.Warmup = 5
+	}
+	return nil
+}
+
+// Result the result of a benchmark run.
+type Result struct {
+	// Config the config of the run, with the defaults
+	Config Config
+	// Requests the number of the measured calls
+	Requests uint64
+	// Errors the number of the failed calls
+	Errors uint64
+	// FirstError the first error of the failed calls
+	FirstError *erpc.Status
+	// Elapsed the duration of the measured calls
+	Elapsed time.Duration
+	// Latency the latency histogram of the successful calls
+	Latency *Histogram
+}
+
+// TPS returns the throughput of the calls per second.
+func (r *Result) TPS() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Elapsed.Seconds()
+}
+
+// WriteReport writes the human-readable report of the result.
+func (r *Result) WriteReport(w io.Writer) error {
+	c := r.Config
+	_, err := fmt.Fprintf(w, "network: %s, codec: %s, concurrency: %d, sessions: %d, payload: %d bytes\n"+
+		"requests: %d, errors: %d, elapsed: %s, throughput: %.0f TPS\n",
+		c.Network, c.BodyCodec, c.Concurrency, c.Sessions, c.PayloadSize,
+		r.Requests, r.Errors, r.Elapsed, r.TPS())
+	if err != nil {
+		return err
+	}
+	if r.FirstError != nil {
+		if _, err = fmt.Fprintf(w, "first error: %s\n", r.FirstError.String()); err != nil {
+			return err
+		}
+	}
+	return r.Latency.WritePercentiles(w)
+}
+
+// newPayload returns the call argument and the reply of the codec.
+func newPayload(codecName string, data []byte) (arg interface{}, newReply func() interface{}) {
+	if codecName == codec.NAME_PLAIN {
+		return string(data), func() interface{} { return new(string) }
+	}
+	return &Payload{Data: data}, func() interface{} { return new(Payload) }
+}
+
+// Run runs the benchmark until the requests are done, the duration elapses or ctx is done.
+func Run(ctx context.Context, cfg Config) (*Result, error) {
+	if err := cfg.withDefault(); err != nil {
+		return nil, err
+	}
+	if cfg.Addr == "" {
+		srv, err := NewServer(ServerConfig{Network: cfg.Network, Tune: cfg.Tune, Options: []erpc.Plugin{erpc.WithProtoFunc(cfg.ProtoFunc)}})
+		if err != nil {
+			return nil, err
+		}
+		defer srv.Close()
+		cfg.Addr = srv.Addr()
+	}
+	peerConfig := erpc.PeerConfig{Network: cfg.Network, DefaultBodyCodec: cfg.BodyCodec}
+	if cfg.Tune != nil {
+		cfg.Tune(&peerConfig)
+	}
+	cli := erpc.NewPeer(peerConfig, append([]erpc.Plugin{erpc.WithProtoFunc(cfg.ProtoFunc)}, cfg.Options...)...)
+	defer cli.Close()
+	sessions := make([]erpc.Session, cfg.Sessions)
+	for i := range sessions {
+		sess, stat := cli.Dial(cfg.Addr)
+		if !stat.OK() {
+			return nil, stat.Cause()
+		}
+		sessions[i] = sess
+	}
+
+	data := make([]byte, cfg.PayloadSize)
+	rand.New(rand.NewSource(cfg.Seed)).Read(data)
+	arg, newReply := newPayload(cfg.BodyCodec, data)
+
+	// warmup
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func(sess erpc.Session) {
+			defer wg.Done()
+			for j := 0; j < cfg.Warmup; j++ {
+				sess.Call(ServiceMethod, arg, newReply())
+			}
+		}(sessions[i%len(sessions)])
+	}
+	wg.Wait()
+
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+	var (
+		remain     = int64(cfg.Requests)
+		requests   uint64
+		errs       uint64
+		mu         sync.Mutex
+		firstError *erpc.Status
+		latency    = NewHistogram(cfg.SignificantDigits)
+	)
+	start := time.Now()
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func(sess erpc.Session) {
+			defer wg.Done()
+			h := NewHistogram(cfg.SignificantDigits)
+			reply := newReply()
+			for ctx.Err() == nil {
+				if cfg.Duration <= 0 && atomic.AddInt64(&remain, -1) < 0 {
+					break
+				}
+				t := time.Now()
+				stat := sess.Call(ServiceMethod, arg, reply).Status()
+				d := time.Since(t)
+				atomic.AddUint64(&requests, 1)
+				if !stat.OK() {
+					if atomic.AddUint64(&errs, 1) == 1 {
+						mu.Lock()
+						firstError = stat
+						mu.Unlock()
+					}
+					continue
+				}
+				h.RecordDuration(d)
+			}
+			mu.Lock()
+			latency.Merge(h)
+			mu.Unlock()
+		}(sessions[i%len(sessions)])
+	}
+	wg.Wait()
+	return &Result{
+		Config:     cfg,
+		Requests:   requests,
+		Errors:     errs,
+		FirstError: firstError,
+		Elapsed:    time.Since(start),
+		Latency:    latency,
+	}, nil
+}
@@ -0,0 +1,38 @@
+package erpcbench
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	for _, codec := range []string{"protobuf", "json", "plain"} {
+		res, err := Run(context.Background(), Config{BodyCodec: codec, Concurrency: 4, Sessions: 2, Requests: 200, PayloadSize: 1000})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Requests != 200 || res.Errors != 0 || res.Latency.Count() != 200 || res.TPS() <= 0 {
+			t.Fatalf("%s: requests: %d, errors: %d, first error: %v", codec, res.Requests, res.Errors, res.FirstError)
+		}
+		var buf bytes.Buffer
+		if err = res.WriteReport(&buf); err != nil || !strings.Contains(buf.String(), "codec: "+codec) {
+			t.Fatalf("report: %s, err: %v", buf.String(), err)
+		}
+	}
+
+	srv, err := NewServer(ServerConfig{Delay: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	res, err := Run(context.Background(), Config{Addr: srv.Addr(), Duration: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Requests == 0 || res.Requests > 25 || res.Latency.Min() < int64(10*time.Millisecond) {
+		t.Fatalf("requests: %d, errors: %d %v, min latency: %s", res.Requests, res.Errors, res.FirstError, time.Duration(res.Latency.Min()))
+	}
+}
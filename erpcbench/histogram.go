@@ -0,0 +1,249 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpcbench
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Histogram the latency histogram of the log-linear buckets like HdrHistogram,
+// which records the values in the fixed memory with the bounded relative error.
+// NOTE:
+//  The relative error of the recorded values is at most 10^-significantDigits;
+//  It is not safe for the concurrent use, i.e. each worker records its own histogram, which are merged by Merge.
+type Histogram struct {
+	digits  int
+	subBits uint // log2 of the number of the sub buckets
+	counts  []uint64
+	count   uint64
+	min     int64
+	max     int64
+	sum     float64
+}
+
+// NewHistogram creates a histogram of the significant digits in [1,5], default 3.
+func NewHistogram(significantDigits int) *Histogram {
+	if significantDigits < 1 || significantDigits > 5 {
+		significantDigits = 3
+	}
+	subBits := uint(bits.Len64(uint64(2*math.Pow10(significantDigits)) - 1))
+	return &Histogram{digits: significantDigits, subBits: subBits, min: math.MaxInt64}
+}
+
+// SignificantDigits returns the significant digits of the recorded values.
+func (h *Histogram) SignificantDigits() int {
+	return h.digits
+}
+
+func (h *Histogram) index(v int64) int {
+	subCount := int64(1) << h.subBits
+	if v < subCount {
+		return int(v)
+	}
+	exp := uint(bits.Len64(uint64(v))) - h.subBits
+	half := subCount >> 1
+	return int(subCount + int64(exp-1)*half + (v>>exp - half))
+}
+
+// bucketRange returns the lowest and the highest values of the bucket.
+func (h *Histogram) bucketRange(idx int) (lowest, highest int64) {
+	subCount := 1 << h.subBits
+	if idx < subCount {
+		return int64(idx), int64(idx)
+	}
+	half := subCount >> 1
+	k := idx - subCount
+	exp := uint(k/half + 1)
+	lowest = int64(k%half+half) << exp
+	return lowest, lowest + 1<<exp - 1
+}
+
+// Record records the value, and the negative value is recorded as 0.
+func (h *Histogram) Record(v int64) {
+	h.RecordN(v, 1)
+}
+
+// RecordDuration records the duration in nanoseconds.
+func (h *Histogram) RecordDuration(d time.Duration) {
+	h.RecordN(int64(d), 1)
+}
+
+// RecordN records the value n times.
+func (h *Histogram) RecordN(v int64, n uint64) {
+	if n == 0 {
+		return
+	}
+	if v < 0 {
+		v = 0
+	}
+	idx := h.index(v)
+	if idx >= len(h.counts) {
+		counts := make([]uint64, idx+1, idx+1+idx/2)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[idx] += n
+	h.count += n
+	h.sum += float64(v) * float64(n)
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// Merge adds the recorded values of the other histogram.
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil || other.count == 0 {
+		return
+	}
+	if other.subBits == h.subBits {
+		if len(other.counts) > len(h.counts) {
+			counts := make([]uint64, len(other.counts))
+			copy(counts, h.counts)
+			h.counts = counts
+		}
+		for i, n := range other.counts {
+			h.counts[i] += n
+		}
+		h.count += other.count
+		h.sum += other.sum
+		if other.min < h.min {
+			h.min = other.min
+		}
+		if other.max > h.max {
+			h.max = other.max
+		}
+		return
+	}
+	// NOTE: the precision is the lower one of the two histograms
+	for i, n := range other.counts {
+		if n > 0 {
+			lowest, highest := other.bucketRange(i)
+			h.RecordN(lowest+(highest-lowest)/2, n)
+		}
+	}
+}
+
+// Reset clears the recorded values.
+func (h *Histogram) Reset() {
+	h.counts = h.counts[:0]
+	h.count, h.sum, h.min, h.max = 0, 0, math.MaxInt64, 0
+}
+
+// Count returns the number of the recorded values.
+func (h *Histogram) Count() uint64 {
+	return h.count
+}
+
+// Min returns the min recorded value.
+func (h *Histogram) Min() int64 {
+	if h.count == 0 {
+		return 0
+	}
+	return h.min
+}
+
+// Max returns the max recorded value.
+func (h *Histogram) Max() int64 {
+	return h.max
+}
+
+// Mean returns the mean of the recorded values.
+func (h *Histogram) Mean() float64 {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / float64(h.count)
+}
+
+// StdDev returns the standard deviation of the recorded values, by the bucket values.
+func (h *Histogram) StdDev() float64 {
+	if h.count == 0 {
+		return 0
+	}
+	mean := h.Mean()
+	var sq float64
+	for i, n := range h.counts {
+		if n > 0 {
+			lowest, highest := h.bucketRange(i)
+			d := float64(lowest+(highest-lowest)/2) - mean
+			sq += d * d * float64(n)
+		}
+	}
+	return math.Sqrt(sq / float64(h.count))
+}
+
+// ValueAtPercentile returns the value that the percentile in [0,100] of the recorded values are less than or equal to.
+// NOTE: The value is the highest one equivalent to the bucket, i.e. within the relative error, and at most Max.
+func (h *Histogram) ValueAtPercentile(percentile float64) int64 {
+	if h.count == 0 {
+		return 0
+	}
+	if percentile >= 100 {
+		return h.max
+	}
+	if percentile < 0 {
+		percentile = 0
+	}
+	target := uint64(math.Ceil(percentile / 100 * float64(h.count)))
+	if target == 0 {
+		target = 1
+	}
+	var total uint64
+	for i, n := range h.counts {
+		total += n
+		if total >= target {
+			_, highest := h.bucketRange(i)
+			if highest > h.max {
+				return h.max
+			}
+			if highest < h.min {
+				return h.min
+			}
+			return highest
+		}
+	}
+	return h.max
+}
+
+// Percentile returns ValueAtPercentile as the duration.
+func (h *Histogram) Percentile(percentile float64) time.Duration {
+	return time.Duration(h.ValueAtPercentile(percentile))
+}
+
+// defaultPercentiles the percentiles of the report
+var defaultPercentiles = []float64{50, 75, 90, 99, 99.9, 99.99, 100}
+
+// WritePercentiles writes the percentile distribution of the durations, like the HdrHistogram output.
+func (h *Histogram) WritePercentiles(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "%10s %14s %12s\n", "Percentile", "Value", "TotalCount"); err != nil {
+		return err
+	}
+	for _, p := range defaultPercentiles {
+		target := uint64(math.Ceil(p / 100 * float64(h.count)))
+		if _, err := fmt.Fprintf(w, "%9.3f%% %14s %12d\n", p, h.Percentile(p), target); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "#[Mean = %s, StdDeviation = %s]\n#[Max = %s, Total count = %d]\n",
+		time.Duration(h.Mean()), time.Duration(h.StdDev()), time.Duration(h.max), h.count)
+	return err
+}
@@ -0,0 +1,54 @@
+package erpcbench
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram(3)
+	for v := int64(1); v <= 1000000; v++ {
+		h.Record(v)
+	}
+	if h.Count() != 1000000 || h.Min() != 1 || h.Max() != 1000000 || h.Mean() != 500000.5 {
+		t.Fatalf("count: %d, min: %d, max: %d, mean: %f", h.Count(), h.Min(), h.Max(), h.Mean())
+	}
+	for _, p := range []float64{0, 1, 50, 90, 99, 99.9, 99.99} {
+		expect := math.Max(1, math.Ceil(p/100*1000000))
+		got := float64(h.ValueAtPercentile(p))
+		if math.Abs(got-expect)/expect > 0.001 {
+			t.Fatalf("p%v: expect %v, got %v", p, expect, got)
+		}
+	}
+	if h.ValueAtPercentile(100) != 1000000 {
+		t.Fatalf("p100: %d", h.ValueAtPercentile(100))
+	}
+	if sd := h.StdDev(); math.Abs(sd-288675)/288675 > 0.001 {
+		t.Fatalf("stddev: %f", sd)
+	}
+
+	// the small values are exact
+	a, b := NewHistogram(2), NewHistogram(2)
+	a.RecordN(7, 3)
+	b.Record(100000)
+	a.Merge(b)
+	if a.Count() != 4 || a.ValueAtPercentile(75) != 7 || a.Max() != 100000 {
+		t.Fatalf("count: %d, p75: %d, max: %d", a.Count(), a.ValueAtPercentile(75), a.Max())
+	}
+	// the merge of the different precisions
+	h.Merge(a)
+	if h.Count() != 1000004 || h.Min() != 1 {
+		t.Fatalf("count: %d, min: %d", h.Count(), h.Min())
+	}
+
+	var buf bytes.Buffer
+	if err := a.WritePercentiles(&buf); err != nil || !strings.Contains(buf.String(), "Total count = 4") {
+		t.Fatalf("report: %s, err: %v", buf.String(), err)
+	}
+	a.Reset()
+	if a.Count() != 0 || a.ValueAtPercentile(50) != 0 || a.Min() != 0 {
+		t.Fatal("expect the empty histogram after Reset")
+	}
+}
@@ -0,0 +1,400 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpcbench
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+// histogramJSON the file format of the histogram, with the sparse buckets.
+type histogramJSON struct {
+	SignificantDigits int         `json:"significant_digits"`
+	Count             uint64      `json:"count"`
+	Min               int64       `json:"min"`
+	Max               int64       `json:"max"`
+	Sum               float64     `json:"sum"`
+	Buckets           [][2]uint64 `json:"buckets"` // [index, count]
+}
+
+// MarshalJSON implements json.Marshaler.
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	v := histogramJSON{
+		SignificantDigits: h.digits,
+		Count:             h.count,
+		Min:               h.Min(),
+		Max:               h.max,
+		Sum:               h.sum,
+		Buckets:           [][2]uint64{},
+	}
+	for i, n := range h.counts {
+		if n > 0 {
+			v.Buckets = append(v.Buckets, [2]uint64{uint64(i), n})
+		}
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (h *Histogram) UnmarshalJSON(b []byte) error {
+	var v histogramJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*h = *NewHistogram(v.SignificantDigits)
+	var count uint64
+	for _, bucket := range v.Buckets {
+		idx, n := int(bucket[0]), bucket[1]
+		if idx < 0 || idx > h.index(math.MaxInt64) {
+			return fmt.Errorf("erpcbench: bad histogram bucket index %d", bucket[0])
+		}
+		if idx >= len(h.counts) {
+			counts := make([]uint64, idx+1)
+			copy(counts, h.counts)
+			h.counts = counts
+		}
+		h.counts[idx] += n
+		count += n
+	}
+	if count != v.Count {
+		return fmt.Errorf("erpcbench: histogram count %d mismatches the buckets %d", v.Count, count)
+	}
+	h.count, h.sum, h.max = v.Count, v.Sum, v.Max
+	if count > 0 {
+		h.min = v.Min
+	}
+	return nil
+}
+
+// Record the latency distributions of a run, keyed by the service methods or the names of the benchmark runs,
+// which is written to the file to compare the runs for the regression gating.
+type Record struct {
+	// Label the label of the run, e.g. the commit
+	Label string `json:"label,omitempty"`
+	// Time the time when the record is taken
+	Time time.Time `json:"time"`
+	// Latencies the latency histograms of the successful calls
+	Latencies map[string]*Histogram `json:"latencies"`
+	// Errors the numbers of the failed calls
+	Errors map[string]uint64 `json:"errors,omitempty"`
+}
+
+// NewRecord creates an empty record.
+func NewRecord(label string) *Record {
+	return &Record{
+		Label:     label,
+		Time:      time.Now(),
+		Latencies: make(map[string]*Histogram),
+	}
+}
+
+// Add merges the histogram and the number of the failed calls into the name.
+func (r *Record) Add(name string, latency *Histogram, errs uint64) {
+	h, ok := r.Latencies[name]
+	if !ok {
+		h = NewHistogram(latency.SignificantDigits())
+		r.Latencies[name] = h
+	}
+	h.Merge(latency)
+	if errs > 0 {
+		if r.Errors == nil {
+			r.Errors = make(map[string]uint64)
+		}
+		r.Errors[name] += errs
+	}
+}
+
+// WriteTo writes the record as JSON.
+func (r *Record) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// WriteFile writes the record to the file.
+func (r *Record) WriteFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if _, err = r.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadRecord reads the record written by Record.WriteTo.
+func ReadRecord(rd io.Reader) (*Record, error) {
+	r := new(Record)
+	if err := json.NewDecoder(rd).Decode(r); err != nil {
+		return nil, fmt.Errorf("erpcbench: bad record: %w", err)
+	}
+	if r.Latencies == nil {
+		r.Latencies = make(map[string]*Histogram)
+	}
+	return r, nil
+}
+
+// ReadRecordFile reads the record file written by Record.WriteFile.
+func ReadRecordFile(filename string) (*Record, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadRecord(f)
+}
+
+// Record returns the record of the result, named like "tcp/protobuf/c16/128B".
+func (r *Result) Record(label string) *Record {
+	record := NewRecord(label)
+	record.Add(r.Name(), r.Latency, r.Errors)
+	return record
+}
+
+// Name returns the name of the run by the network, codec, concurrency and payload size, e.g. "tcp/protobuf/c16/128B".
+func (r *Result) Name() string {
+	c := r.Config
+	return fmt.Sprintf("%s/%s/c%d/%dB", c.Network, c.BodyCodec, c.Concurrency, c.PayloadSize)
+}
+
+// Recorder the plugin recording the latencies of the calls launched by the peer, per service method.
+// NOTE:
+//  The latency is from PreWriteCall to PostReadReplyBody, i.e. including the encoding and the decoding;
+//  The calls replied with the error status are counted by PostReadReplyHeader, without the latencies;
+//  It is safe for the concurrent use.
+type Recorder struct {
+	digits    int
+	mu        sync.Mutex
+	latencies map[string]*Histogram
+	errors    map[string]uint64
+}
+
+// NewRecorder creates a recorder plugin of the significant digits of the histograms, default 3.
+func NewRecorder(significantDigits int) *Recorder {
+	return &Recorder{
+		digits:    significantDigits,
+		latencies: make(map[string]*Histogram),
+		errors:    make(map[string]uint64),
+	}
+}
+
+var (
+	_ erpc.PreWriteCallPlugin        = (*Recorder)(nil)
+	_ erpc.PostReadReplyHeaderPlugin = (*Recorder)(nil)
+	_ erpc.PostReadReplyBodyPlugin   = (*Recorder)(nil)
+)
+
+type recordStartKey struct{}
+
+// Name returns the plugin name.
+func (*Recorder) Name() string { return "erpcbench-recorder" }
+
+// PreWriteCall stores the start time of the call.
+func (*Recorder) PreWriteCall(ctx erpc.WriteCtx) *erpc.Status {
+	ctx.Swap().Store(recordStartKey{}, time.Now())
+	return nil
+}
+
+// PostReadReplyHeader counts the call replied with the error status.
+func (r *Recorder) PostReadReplyHeader(ctx erpc.ReadCtx) *erpc.Status {
+	if _, ok := ctx.Swap().Load(recordStartKey{}); ok && !ctx.Input().Status().OK() {
+		r.mu.Lock()
+		r.errors[ctx.ServiceMethod()]++
+		r.mu.Unlock()
+	}
+	return nil
+}
+
+// PostReadReplyBody records the latency of the successful call.
+func (r *Recorder) PostReadReplyBody(ctx erpc.ReadCtx) *erpc.Status {
+	v, ok := ctx.Swap().Load(recordStartKey{})
+	if !ok {
+		return nil
+	}
+	d := time.Since(v.(time.Time))
+	name := ctx.ServiceMethod()
+	r.mu.Lock()
+	h, ok := r.latencies[name]
+	if !ok {
+		h = NewHistogram(r.digits)
+		r.latencies[name] = h
+	}
+	h.RecordDuration(d)
+	r.mu.Unlock()
+	return nil
+}
+
+// Record returns the snapshot of the recorded latencies.
+func (r *Recorder) Record(label string) *Record {
+	record := NewRecord(label)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, h := range r.latencies {
+		record.Add(name, h, 0)
+	}
+	for name, n := range r.errors {
+		record.Add(name, NewHistogram(r.digits), n)
+	}
+	return record
+}
+
+// Reset clears the recorded latencies.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.latencies = make(map[string]*Histogram)
+	r.errors = make(map[string]uint64)
+	r.mu.Unlock()
+}
+
+// CompareOptions the options of Compare.
+type CompareOptions struct {
+	// Percentile the compared percentile, default 99
+	Percentile float64
+	// Threshold the max ratio of the increase of the percentile latency, default 0.1, i.e. 10%
+	Threshold float64
+	// MinCount the min number of the latencies of both runs to compare, default 1;
+	// the fewer ones are skipped, since the high percentiles of them are not stable
+	MinCount uint64
+}
+
+// Delta the comparison of a name of the two records.
+type Delta struct {
+	// Name the service method or the name of the benchmark run
+	Name string
+	// Base the percentile latency of the base record
+	Base time.Duration
+	// Current the percentile latency of the current record
+	Current time.Duration
+	// Ratio the ratio of the change, e.g. 0.2 means 20% slower
+	Ratio float64
+	// Regressed whether the ratio exceeds the threshold
+	Regressed bool
+	// Skipped the reason why it is not compared, e.g. missing in the current record
+	Skipped string
+}
+
+// Comparison the result of Compare.
+type Comparison struct {
+	Options CompareOptions
+	Deltas  []Delta
+}
+
+// Compare compares the percentile latencies of the current record with the base one, by the sorted names.
+// NOTE:
+//  The names missing in either record are skipped, not regressed;
+//  The zero base latency is regressed only if the current one is not zero.
+func Compare(base, current *Record, opt CompareOptions) *Comparison {
+	if opt.Percentile <= 0 || opt.Percentile > 100 {
+		opt.Percentile = 99
+	}
+	if opt.Threshold <= 0 {
+		opt.Threshold = 0.1
+	}
+	if opt.MinCount == 0 {
+		opt.MinCount = 1
+	}
+	names := make(map[string]struct{}, len(base.Latencies))
+	for name := range base.Latencies {
+		names[name] = struct{}{}
+	}
+	for name := range current.Latencies {
+		names[name] = struct{}{}
+	}
+	c := &Comparison{Options: opt, Deltas: make([]Delta, 0, len(names))}
+	for name := range names {
+		d := Delta{Name: name}
+		b, cur := base.Latencies[name], current.Latencies[name]
+		switch {
+		case b == nil:
+			d.Current = cur.Percentile(opt.Percentile)
+			d.Skipped = "missing in the base"
+		case cur == nil:
+			d.Base = b.Percentile(opt.Percentile)
+			d.Skipped = "missing in the current"
+		default:
+			d.Base, d.Current = b.Percentile(opt.Percentile), cur.Percentile(opt.Percentile)
+			if b.Count() < opt.MinCount || cur.Count() < opt.MinCount {
+				d.Skipped = fmt.Sprintf("fewer than %d latencies", opt.MinCount)
+				break
+			}
+			if d.Base > 0 {
+				d.Ratio = float64(d.Current-d.Base) / float64(d.Base)
+				d.Regressed = d.Ratio > opt.Threshold
+			} else if d.Current > 0 {
+				d.Ratio = math.Inf(1)
+				d.Regressed = true
+			}
+		}
+		c.Deltas = append(c.Deltas, d)
+	}
+	sort.Slice(c.Deltas, func(i, j int) bool { return c.Deltas[i].Name < c.Deltas[j].Name })
+	return c
+}
+
+// Regressed returns the regressed deltas.
+func (c *Comparison) Regressed() []Delta {
+	var a []Delta
+	for _, d := range c.Deltas {
+		if d.Regressed {
+			a = append(a, d)
+		}
+	}
+	return a
+}
+
+// Err returns the error listing the regressed names, nil if none is regressed.
+func (c *Comparison) Err() error {
+	regressed := c.Regressed()
+	if len(regressed) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("p%v latency regressed beyond %.1f%%:", c.Options.Percentile, c.Options.Threshold*100)
+	for _, d := range regressed {
+		msg += fmt.Sprintf(" %s(%s -> %s)", d.Name, d.Base, d.Current)
+	}
+	return errors.New(msg)
+}
+
+// WriteReport writes the comparison table.
+func (c *Comparison) WriteReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "name\tbase p%v\tcurrent p%v\tchange\tresult\n", c.Options.Percentile, c.Options.Percentile)
+	for _, d := range c.Deltas {
+		result := "ok"
+		switch {
+		case d.Skipped != "":
+			result = "skipped: " + d.Skipped
+		case d.Regressed:
+			result = "REGRESSED"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%+.1f%%\t%s\n", d.Name, d.Base, d.Current, d.Ratio*100, result)
+	}
+	return tw.Flush()
+}
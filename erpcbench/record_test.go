@@ -0,0 +1,93 @@
+package erpcbench
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+func TestRecord(t *testing.T) {
+	h := NewHistogram(2)
+	for v := int64(1); v <= 10000; v++ {
+		h.Record(v * 1000)
+	}
+	record := NewRecord("base")
+	record.Add("a", h, 3)
+	filename := filepath.Join(t.TempDir(), "base.json")
+	if err := record.WriteFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadRecordFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := got.Latencies["a"]
+	if got.Label != "base" || got.Errors["a"] != 3 || g.Count() != h.Count() || g.SignificantDigits() != 2 ||
+		g.Min() != h.Min() || g.Max() != h.Max() || g.Mean() != h.Mean() || g.Percentile(99) != h.Percentile(99) {
+		t.Fatalf("bad record: %+v", got)
+	}
+	if _, err = ReadRecord(strings.NewReader(`{"latencies":{"a":{"count":2,"buckets":[[1,1]]}}}`)); err == nil {
+		t.Fatal("expect the error of the mismatched count")
+	}
+
+	// the current one is 20% slower at p99
+	slow := NewHistogram(2)
+	for v := int64(1); v <= 10000; v++ {
+		slow.Record(v * 1200)
+	}
+	current := NewRecord("current")
+	current.Add("a", slow, 0)
+	current.Add("b", slow, 0)
+	c := Compare(got, current, CompareOptions{})
+	if len(c.Deltas) != 2 || len(c.Regressed()) != 1 || c.Deltas[1].Skipped == "" || c.Err() == nil {
+		t.Fatalf("bad comparison: %+v", c.Deltas)
+	}
+	if d := c.Deltas[0]; d.Ratio < 0.15 || d.Ratio > 0.25 {
+		t.Fatalf("bad ratio: %+v", d)
+	}
+	var buf bytes.Buffer
+	if err = c.WriteReport(&buf); err != nil || !strings.Contains(buf.String(), "REGRESSED") {
+		t.Fatalf("report: %s, err: %v", buf.String(), err)
+	}
+	if c = Compare(got, current, CompareOptions{Threshold: 0.3}); c.Err() != nil {
+		t.Fatal(c.Err())
+	}
+	if c = Compare(got, current, CompareOptions{MinCount: 20000}); c.Err() != nil || c.Deltas[0].Skipped == "" {
+		t.Fatalf("expect skipped: %+v", c.Deltas)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	srv, err := NewServer(ServerConfig{Delay: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	recorder := NewRecorder(3)
+	cli := erpc.NewPeer(erpc.PeerConfig{}, recorder)
+	defer cli.Close()
+	sess, stat := cli.Dial(srv.Addr())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	for i := 0; i < 10; i++ {
+		var reply Payload
+		if stat = sess.Call(ServiceMethod, &Payload{Data: []byte("x")}, &reply).Status(); !stat.OK() {
+			t.Fatal(stat)
+		}
+	}
+	sess.Call("/erpcbench/missing", &Payload{}, new(Payload))
+	record := recorder.Record("run")
+	h := record.Latencies[ServiceMethod]
+	if h == nil || h.Count() != 10 || h.Min() < int64(5*time.Millisecond) || record.Errors["/erpcbench/missing"] != 1 {
+		t.Fatalf("bad record: %+v, errors: %v", record.Latencies, record.Errors)
+	}
+	recorder.Reset()
+	if len(recorder.Record("").Latencies) != 0 {
+		t.Fatal("expect the reset recorder empty")
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpctest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+// Clock a fake erpc.Clock which only moves by Advance, to fast-forward the timeouts instead of sleeping.
+// e.g. erpc.NewPeer(erpc.PeerConfig{Clock: clock})
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*clockTimer
+}
+
+type clockTimer struct {
+	clock *Clock
+	at    time.Time
+	f     func()
+}
+
+var _ erpc.Clock = (*Clock)(nil)
+
+// NewClock creates a fake clock at the start time.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc calls f in its own goroutine when the clock is advanced over the duration.
+func (c *Clock) AfterFunc(d time.Duration, f func()) erpc.Timer {
+	c.mu.Lock()
+	t := &clockTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	c.mu.Unlock()
+	if d <= 0 {
+		c.Advance(0)
+	}
+	return t
+}
+
+// Stop prevents the timer from firing, and reports whether it is stopped before firing.
+func (t *clockTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, x := range c.timers {
+		if x == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Advance moves the clock forward by the duration, and fires the due timers in order.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due, pending []*clockTimer
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	c.timers = pending
+	c.mu.Unlock()
+	sort.SliceStable(due, func(i, j int) bool { return due[i].at.Before(due[j].at) })
+	for _, t := range due {
+		go t.f()
+	}
+}
+
+// Timers returns the number of the pending timers.
+func (c *Clock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// WaitTimers waits until there are at least n pending timers, e.g. the sleeping goroutines,
+// and reports whether the number is reached in the real timeout.
+func (c *Clock) WaitTimers(n int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for c.Timers() < n {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
@@ -0,0 +1,293 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpctest
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/codec"
+	"github.com/andeya/erpc/v7/utils"
+	"github.com/andeya/goutil"
+)
+
+// inputCtx the common part of the fake contexts.
+type inputCtx struct {
+	erpc.Logger
+	sess  *Session
+	input erpc.Message
+	swap  goutil.Map
+}
+
+func newInputCtx(mtype byte, serviceMethod string, args interface{}, setting []erpc.MessageSetting) inputCtx {
+	input := erpc.GetMessage(setting...)
+	input.SetMtype(mtype)
+	input.SetServiceMethod(serviceMethod)
+	input.SetBody(args)
+	if input.BodyCodec() == codec.NilCodecID {
+		input.SetBodyCodec(erpc.DefaultBodyCodec().ID())
+	}
+	return inputCtx{
+		Logger: erpc.GetLogger(),
+		sess:   NewSession("erpctest-session"),
+		input:  input,
+		swap:   goutil.RwMap(),
+	}
+}
+
+// Peer returns nil, the fake context has no peer.
+func (c *inputCtx) Peer() erpc.Peer {
+	return nil
+}
+
+// Session returns the fake session.
+func (c *inputCtx) Session() erpc.CtxSession {
+	return c.sess
+}
+
+// FakeSession returns the fake session, to check the pushes and calls sent by the handler.
+func (c *inputCtx) FakeSession() *Session {
+	return c.sess
+}
+
+// SetSession sets the fake session, e.g. shared by the contexts.
+func (c *inputCtx) SetSession(sess *Session) {
+	c.sess = sess
+}
+
+// IP returns the remote addr.
+func (c *inputCtx) IP() string {
+	return c.sess.RemoteAddr().String()
+}
+
+// RealIP returns the the current real remote addr.
+func (c *inputCtx) RealIP() string {
+	if realIP := c.PeekMeta(erpc.MetaRealIP); len(realIP) > 0 {
+		return string(realIP)
+	}
+	return c.IP()
+}
+
+// Swap returns custom data swap of context.
+func (c *inputCtx) Swap() goutil.Map {
+	return c.swap
+}
+
+// Context returns the context of the input message, set by erpc.WithContext.
+func (c *inputCtx) Context() context.Context {
+	return c.input.Context()
+}
+
+// Seq returns the input message sequence.
+func (c *inputCtx) Seq() int32 {
+	return c.input.Seq()
+}
+
+// PeekMeta peeks the header metadata for the input message.
+func (c *inputCtx) PeekMeta(key string) []byte {
+	return c.input.Meta().Peek(key)
+}
+
+// VisitMeta calls f for each existing metadata.
+func (c *inputCtx) VisitMeta(f func(key, value []byte)) {
+	c.input.Meta().VisitAll(f)
+}
+
+// CopyMeta returns the input message metadata copy.
+func (c *inputCtx) CopyMeta() *utils.Args {
+	dst := utils.AcquireArgs()
+	c.input.Meta().CopyTo(dst)
+	return dst
+}
+
+// ServiceMethod returns the input message service method.
+func (c *inputCtx) ServiceMethod() string {
+	return c.input.ServiceMethod()
+}
+
+// ResetServiceMethod resets the input message service method.
+func (c *inputCtx) ResetServiceMethod(serviceMethod string) {
+	c.input.SetServiceMethod(serviceMethod)
+}
+
+// Deadline returns the deadline of the input message context, set by erpc.WithContext.
+func (c *inputCtx) Deadline() (time.Time, bool) {
+	return c.input.Context().Deadline()
+}
+
+// TraceContext returns the trace context of the input message, set by erpc.WithTraceContext.
+func (c *inputCtx) TraceContext() (erpc.TraceContext, bool) {
+	tc, err := erpc.ParseTraceContext(string(c.PeekMeta(erpc.MetaTraceParent)))
+	return tc, err == nil
+}
+
+// GetBodyCodec gets the body codec type of the input message.
+func (c *inputCtx) GetBodyCodec() byte {
+	return c.input.BodyCodec()
+}
+
+// PushCtx a fake erpc.PushCtx.
+type PushCtx struct {
+	inputCtx
+}
+
+var _ erpc.PushCtx = (*PushCtx)(nil)
+
+// NewPushCtx creates a fake context of handling the PUSH,
+// the input metadata, body codec and context can be set by the settings.
+func NewPushCtx(serviceMethod string, args interface{}, setting ...erpc.MessageSetting) *PushCtx {
+	return &PushCtx{inputCtx: newInputCtx(erpc.TypePush, serviceMethod, args, setting)}
+}
+
+// CallCtx a fake erpc.CallCtx, recording the reply metadata.
+type CallCtx struct {
+	inputCtx
+	output erpc.Message
+}
+
+var _ erpc.CallCtx = (*CallCtx)(nil)
+
+// NewCallCtx creates a fake context of handling the CALL,
+// the input metadata, body codec and context can be set by the settings.
+func NewCallCtx(serviceMethod string, args interface{}, setting ...erpc.MessageSetting) *CallCtx {
+	c := &CallCtx{inputCtx: newInputCtx(erpc.TypeCall, serviceMethod, args, setting)}
+	c.output = erpc.GetMessage()
+	c.output.SetMtype(erpc.TypeReply)
+	c.output.SetServiceMethod(serviceMethod)
+	return c
+}
+
+// Input returns the input message.
+func (c *CallCtx) Input() erpc.Message {
+	return c.input
+}
+
+// Output returns the reply message.
+func (c *CallCtx) Output() erpc.Message {
+	return c.output
+}
+
+// ReplyBodyCodec initializes and returns the reply message body codec id.
+func (c *CallCtx) ReplyBodyCodec() byte {
+	id := c.output.BodyCodec()
+	if id != codec.NilCodecID {
+		return id
+	}
+	if id, ok := erpc.GetAcceptBodyCodec(c.input.Meta()); ok {
+		if _, err := codec.Get(id); err == nil {
+			c.output.SetBodyCodec(id)
+			return id
+		}
+	}
+	id = c.input.BodyCodec()
+	c.output.SetBodyCodec(id)
+	return id
+}
+
+// SetBodyCodec sets the body codec for reply message.
+func (c *CallCtx) SetBodyCodec(bodyCodec byte) {
+	c.output.SetBodyCodec(bodyCodec)
+}
+
+// AddMeta adds the header metadata 'key=value' for reply message.
+func (c *CallCtx) AddMeta(key, value string) {
+	if erpc.IsReservedMeta(key) {
+		return
+	}
+	c.output.Meta().Add(key, value)
+}
+
+// SetMeta sets the header metadata 'key=value' for reply message.
+func (c *CallCtx) SetMeta(key, value string) {
+	if erpc.IsReservedMeta(key) {
+		return
+	}
+	c.output.Meta().Set(key, value)
+}
+
+// AddTrailer adds the trailer metadata 'key=value' for reply message.
+func (c *CallCtx) AddTrailer(key, value string) {
+	c.output.Trailer().Add(key, value)
+}
+
+// SetTrailer sets the trailer metadata 'key=value' for reply message.
+func (c *CallCtx) SetTrailer(key, value string) {
+	c.output.Trailer().Set(key, value)
+}
+
+// AddXferPipe appends transfer filter pipe of reply message.
+func (c *CallCtx) AddXferPipe(filterID ...byte) {
+	c.output.XferPipe().Append(filterID...)
+}
+
+// Progress records the progress notification as a push of the fake session, see AssertPushed.
+func (c *CallCtx) Progress(percent int, note string) *erpc.Status {
+	return c.sess.Push(erpc.ProgressServiceMethod, nil,
+		erpc.WithSetMeta(erpc.MetaProgress, strconv.Itoa(percent)),
+		erpc.WithSetMeta(erpc.MetaProgressNote, note),
+	)
+}
+
+// ReplyMeta returns the reply metadata value of the key.
+func (c *CallCtx) ReplyMeta(key string) string {
+	return string(c.output.Meta().Peek(key))
+}
+
+// AssertReplyMeta fails the test if the reply metadata value of the key is not the expected one.
+func AssertReplyMeta(t testing.TB, ctx *CallCtx, key, value string) {
+	t.Helper()
+	if got := ctx.ReplyMeta(key); got != value {
+		t.Fatalf("erpctest: reply metadata %s: got %q, expect %q", key, got, value)
+	}
+}
+
+// AssertPushed fails the test if the session has not sent the PUSH of the service method,
+// and returns the last one.
+func AssertPushed(t testing.TB, sess *Session, serviceMethod string) Sent {
+	t.Helper()
+	pushes := sess.Pushes()
+	for i := len(pushes) - 1; i >= 0; i-- {
+		if pushes[i].ServiceMethod == serviceMethod {
+			return pushes[i]
+		}
+	}
+	t.Fatalf("erpctest: %s is not pushed, the pushes: %v", serviceMethod, serviceMethods(pushes))
+	return Sent{}
+}
+
+// AssertCalled fails the test if the session has not sent the CALL of the service method,
+// and returns the last one.
+func AssertCalled(t testing.TB, sess *Session, serviceMethod string) Sent {
+	t.Helper()
+	calls := sess.Calls()
+	for i := len(calls) - 1; i >= 0; i-- {
+		if calls[i].ServiceMethod == serviceMethod {
+			return calls[i]
+		}
+	}
+	t.Fatalf("erpctest: %s is not called, the calls: %v", serviceMethod, serviceMethods(calls))
+	return Sent{}
+}
+
+func serviceMethods(sents []Sent) []string {
+	a := make([]string, len(sents))
+	for i, s := range sents {
+		a[i] = s.ServiceMethod
+	}
+	return a
+}
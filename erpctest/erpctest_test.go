@@ -0,0 +1,89 @@
+package erpctest
+
+import (
+	"testing"
+
+	"github.com/andeya/erpc/v7"
+)
+
+type Home struct {
+	erpc.CallCtx
+}
+
+// Test replies the arg, and notifies the caller.
+func (h *Home) Test(arg *map[string]string) (map[string]interface{}, *erpc.Status) {
+	h.SetMeta("handled", "true")
+	if stat := h.Session().Push("/notify/done", *arg, erpc.WithSetMeta("peer_id", string(h.PeekMeta("peer_id")))); !stat.OK() {
+		return nil, stat
+	}
+	return map[string]interface{}{"arg": *arg, "ip": h.RealIP()}, nil
+}
+
+type Notify struct {
+	erpc.PushCtx
+}
+
+// Done saves the pushed arg into the session swap.
+func (n *Notify) Done(arg *string) *erpc.Status {
+	n.Session().Swap().Store("done", *arg)
+	return nil
+}
+
+func TestCallCtx(t *testing.T) {
+	ctx := NewCallCtx("/home/test", nil, erpc.WithSetMeta("peer_id", "110"), erpc.WithRealIP("1.2.3.4"))
+	h := &Home{CallCtx: ctx}
+	result, stat := h.Test(&map[string]string{"author": "andeya"})
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	if result["ip"] != "1.2.3.4" {
+		t.Fatalf("ip: %v", result["ip"])
+	}
+	AssertReplyMeta(t, ctx, "handled", "true")
+	push := AssertPushed(t, ctx.FakeSession(), "/notify/done")
+	if push.Meta["peer_id"] != "110" {
+		t.Fatalf("push meta: %v", push.Meta)
+	}
+	if id := ctx.ReplyBodyCodec(); id != erpc.DefaultBodyCodec().ID() {
+		t.Fatalf("reply body codec: %d", id)
+	}
+
+	// the closed session
+	ctx.FakeSession().Close()
+	if _, stat = h.Test(&map[string]string{}); stat.Code() != erpc.CodeConnClosed {
+		t.Fatalf("expect conn closed, got %v", stat)
+	}
+}
+
+func TestPushCtx(t *testing.T) {
+	sess := NewSession("agent-1")
+	ctx := NewPushCtx("/notify/done", nil)
+	ctx.SetSession(sess)
+	n := &Notify{PushCtx: ctx}
+	if stat := n.Done(new(string)); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if _, ok := sess.Swap().Load("done"); !ok {
+		t.Fatal("not saved in the swap")
+	}
+	if ctx.IP() != "agent-1" {
+		t.Fatalf("ip: %s", ctx.IP())
+	}
+}
+
+func TestSessionCall(t *testing.T) {
+	sess := NewSession("agent-1")
+	sess.CallFunc = func(serviceMethod string, args, result interface{}, setting ...erpc.MessageSetting) *erpc.Status {
+		*result.(*int) = args.(int) * 2
+		return nil
+	}
+	var n int
+	if stat := sess.Call("/math/double", 21, &n).Status(); !stat.OK() || n != 42 {
+		t.Fatalf("n: %d, stat: %v", n, stat)
+	}
+	AssertCalled(t, sess, "/math/double")
+	sess.Reset()
+	if len(sess.Calls()) != 0 {
+		t.Fatal("not reset")
+	}
+}
@@ -0,0 +1,350 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpctest
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+// Conditions the simulated network conditions of the connections.
+type Conditions struct {
+	// Latency the one-way delay of the written bytes
+	Latency time.Duration
+	// Jitter the random extra delay in [0,Jitter); the stream keeps the order of the bytes
+	Jitter time.Duration
+	// Bandwidth the max bytes per second written by each connection, the writes block for it; if <=0, no limit
+	Bandwidth int64
+	// LossRate the probability of dropping a packet, only for the packet connections, e.g. of kcp
+	LossRate float64
+	// ReorderRate the probability of delaying a packet behind the next ones, only for the packet connections
+	ReorderRate float64
+	// DisconnectAfter disconnects the stream connection abruptly after the duration since it is wrapped; if <=0, never
+	DisconnectAfter time.Duration
+	// DisconnectAfterBytes disconnects the stream connection abruptly after the bytes are written, in the middle of a frame; if <=0, never
+	DisconnectAfterBytes int64
+}
+
+// NetSim the simulator of the network conditions around the real or in-memory connections,
+// to verify the redial, heartbeat and timeout logic deterministically.
+// NOTE:
+//  It is also a plugin, which wraps the connections of the sessions accepted and dialed (redialed) by the peer;
+//  The delays are measured by the clock, e.g. the fake Clock, and the random source is seeded, for the deterministic runs;
+//  Only the writes are simulated, i.e. wrap both ends of a connection for the conditions of both directions.
+type NetSim struct {
+	clock  erpc.Clock
+	mu     sync.RWMutex
+	cond   Conditions
+	randMu sync.Mutex
+	rand   *rand.Rand
+	connMu sync.Mutex
+	conns  map[*Conn]struct{}
+}
+
+var (
+	_ erpc.PostAcceptPlugin = (*NetSim)(nil)
+	_ erpc.PostDialPlugin   = (*NetSim)(nil)
+)
+
+// NewNetSim creates a simulator of the conditions, the random seed, and the clock, nil means erpc.SystemClock.
+func NewNetSim(cond Conditions, seed int64, clock erpc.Clock) *NetSim {
+	if clock == nil {
+		clock = erpc.SystemClock
+	}
+	return &NetSim{
+		clock: clock,
+		cond:  cond,
+		rand:  rand.New(rand.NewSource(seed)),
+		conns: make(map[*Conn]struct{}),
+	}
+}
+
+// Name returns the plugin name.
+func (n *NetSim) Name() string {
+	return "netsim"
+}
+
+// PostAccept wraps the connection of the accepted session.
+func (n *NetSim) PostAccept(sess erpc.PreSession) *erpc.Status {
+	sess.ModifySocket(func(conn net.Conn) (net.Conn, erpc.ProtoFunc) {
+		return n.Conn(conn), nil
+	})
+	return nil
+}
+
+// PostDial wraps the connection of the dialed or redialed session.
+func (n *NetSim) PostDial(sess erpc.PreSession, _ bool) *erpc.Status {
+	return n.PostAccept(sess)
+}
+
+// SetConditions changes the conditions of the following writes at runtime.
+func (n *NetSim) SetConditions(cond Conditions) {
+	n.mu.Lock()
+	n.cond = cond
+	n.mu.Unlock()
+}
+
+// Conditions returns the current conditions.
+func (n *NetSim) Conditions() Conditions {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.cond
+}
+
+// Disconnect disconnects all the stream connections abruptly, e.g. to trigger the redial.
+func (n *NetSim) Disconnect() {
+	n.connMu.Lock()
+	conns := make([]*Conn, 0, len(n.conns))
+	for c := range n.conns {
+		conns = append(conns, c)
+	}
+	n.connMu.Unlock()
+	for _, c := range conns {
+		c.Disconnect()
+	}
+}
+
+func (n *NetSim) float64() float64 {
+	n.randMu.Lock()
+	defer n.randMu.Unlock()
+	return n.rand.Float64()
+}
+
+// delay returns the latency with the jitter.
+func (n *NetSim) delay(cond *Conditions) time.Duration {
+	d := cond.Latency
+	if cond.Jitter > 0 {
+		n.randMu.Lock()
+		d += time.Duration(n.rand.Int63n(int64(cond.Jitter)))
+		n.randMu.Unlock()
+	}
+	return d
+}
+
+// transmit returns the transmission time of the bytes by the bandwidth.
+func transmit(cond *Conditions, size int) time.Duration {
+	if cond.Bandwidth <= 0 {
+		return 0
+	}
+	return time.Duration(int64(size) * int64(time.Second) / cond.Bandwidth)
+}
+
+// Listener wraps the connections accepted by the listener.
+func (n *NetSim) Listener(lis net.Listener) net.Listener {
+	return &simListener{Listener: lis, sim: n}
+}
+
+type simListener struct {
+	net.Listener
+	sim *NetSim
+}
+
+func (l *simListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.sim.Conn(conn), nil
+}
+
+// Conn the stream connection with the simulated conditions of the writes.
+type Conn struct {
+	net.Conn
+	sim     *NetSim
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []delivery
+	txEnd   time.Time // the end of the transmission of the written bytes
+	lastAt  time.Time // the delivery time of the last written bytes
+	written int64
+	closing bool
+	closed  bool
+	timer   erpc.Timer
+}
+
+type delivery struct {
+	data []byte
+	at   time.Time
+	cut  bool // disconnects after delivering it
+}
+
+// Conn wraps the stream connection.
+func (n *NetSim) Conn(conn net.Conn) *Conn {
+	c := &Conn{Conn: conn, sim: n}
+	c.cond = sync.NewCond(&c.mu)
+	if d := n.Conditions().DisconnectAfter; d > 0 {
+		c.timer = n.clock.AfterFunc(d, c.Disconnect)
+	}
+	n.connMu.Lock()
+	n.conns[c] = struct{}{}
+	n.connMu.Unlock()
+	go c.deliver()
+	return c
+}
+
+// Write queues the bytes delivered after the latency, and blocks for the bandwidth.
+func (c *Conn) Write(b []byte) (int, error) {
+	cond := c.sim.Conditions()
+	c.mu.Lock()
+	if c.closing || c.closed {
+		c.mu.Unlock()
+		return 0, net.ErrClosed
+	}
+	now := c.sim.clock.Now()
+	start := c.txEnd
+	if start.Before(now) {
+		start = now
+	}
+	c.txEnd = start.Add(transmit(&cond, len(b)))
+	at := c.txEnd.Add(c.sim.delay(&cond))
+	if at.Before(c.lastAt) {
+		at = c.lastAt
+	}
+	c.lastAt = at
+	data, cut := b, false
+	if limit := cond.DisconnectAfterBytes; limit > 0 && c.written+int64(len(b)) >= limit {
+		data, cut = b[:limit-c.written], true
+		c.closing = true
+	}
+	c.written += int64(len(data))
+	c.queue = append(c.queue, delivery{data: append([]byte(nil), data...), at: at, cut: cut})
+	c.cond.Signal()
+	txEnd := c.txEnd
+	c.mu.Unlock()
+	if wait := txEnd.Sub(now); wait > 0 {
+		erpc.ClockSleep(c.sim.clock, wait)
+	}
+	if cut {
+		return len(data), net.ErrClosed
+	}
+	return len(b), nil
+}
+
+func (c *Conn) deliver() {
+	for {
+		c.mu.Lock()
+		for len(c.queue) == 0 && !c.closed && !c.closing {
+			c.cond.Wait()
+		}
+		if c.closed {
+			c.mu.Unlock()
+			return
+		}
+		if len(c.queue) == 0 {
+			// closed by Close after delivering the written bytes
+			c.mu.Unlock()
+			c.close()
+			return
+		}
+		d := c.queue[0]
+		c.queue = c.queue[1:]
+		c.mu.Unlock()
+		if wait := d.at.Sub(c.sim.clock.Now()); wait > 0 {
+			erpc.ClockSleep(c.sim.clock, wait)
+		}
+		if c.isClosed() {
+			return
+		}
+		if _, err := c.Conn.Write(d.data); err != nil || d.cut {
+			c.Disconnect()
+			return
+		}
+	}
+}
+
+func (c *Conn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// Close closes the connection after delivering the written bytes in the background, like the kernel.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	c.closing = true
+	c.cond.Signal()
+	c.mu.Unlock()
+	return nil
+}
+
+// Disconnect closes the connection abruptly, and drops the bytes not delivered.
+func (c *Conn) Disconnect() {
+	c.close()
+}
+
+func (c *Conn) close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.queue = nil
+	c.cond.Signal()
+	c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.sim.connMu.Lock()
+	delete(c.sim.conns, c)
+	c.sim.connMu.Unlock()
+	return c.Conn.Close()
+}
+
+// PacketConn wraps the packet connection, e.g. the UDP connection under kcp.
+func (n *NetSim) PacketConn(pc net.PacketConn) net.PacketConn {
+	return &simPacketConn{PacketConn: pc, sim: n}
+}
+
+type simPacketConn struct {
+	net.PacketConn
+	sim   *NetSim
+	mu    sync.Mutex
+	txEnd time.Time
+}
+
+// WriteTo sends the packet after the latency, and may drop or reorder it.
+func (p *simPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	cond := p.sim.Conditions()
+	if cond.LossRate > 0 && p.sim.float64() < cond.LossRate {
+		return len(b), nil
+	}
+	p.mu.Lock()
+	now := p.sim.clock.Now()
+	start := p.txEnd
+	if start.Before(now) {
+		start = now
+	}
+	p.txEnd = start.Add(transmit(&cond, len(b)))
+	txEnd := p.txEnd
+	p.mu.Unlock()
+	delay := txEnd.Sub(now) + p.sim.delay(&cond)
+	if cond.ReorderRate > 0 && p.sim.float64() < cond.ReorderRate {
+		// behind the packets sent in the next latency
+		delay += cond.Latency + cond.Jitter + time.Millisecond
+	}
+	data := append([]byte(nil), b...)
+	if delay <= 0 {
+		return p.PacketConn.WriteTo(data, addr)
+	}
+	p.sim.clock.AfterFunc(delay, func() {
+		p.PacketConn.WriteTo(data, addr)
+	})
+	return len(b), nil
+}
@@ -0,0 +1,142 @@
+package erpctest
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+func readAsync(conn net.Conn, n int) <-chan []byte {
+	ch := make(chan []byte, 1)
+	go func() {
+		b := make([]byte, n)
+		n, _ := io.ReadFull(conn, b)
+		ch <- b[:n]
+	}()
+	return ch
+}
+
+func TestNetSimConn(t *testing.T) {
+	clock := NewClock(time.Unix(0, 0))
+	sim := NewNetSim(Conditions{Latency: 50 * time.Millisecond, Bandwidth: 1000}, 1, clock)
+	a, b := net.Pipe()
+	conn := sim.Conn(a)
+	defer conn.Close()
+
+	// the write blocks for the bandwidth: 100 bytes of 1000 B/s
+	written := make(chan struct{})
+	go func() {
+		conn.Write(make([]byte, 100))
+		close(written)
+	}()
+	got := readAsync(b, 100)
+	if !clock.WaitTimers(2, time.Second) {
+		t.Fatal("expect the timers of the transmission and the delivery")
+	}
+	clock.Advance(99 * time.Millisecond)
+	select {
+	case <-written:
+		t.Fatal("expect the write blocked by the bandwidth")
+	case <-got:
+		t.Fatal("expect the bytes delayed by the latency")
+	case <-time.After(50 * time.Millisecond):
+	}
+	clock.Advance(time.Millisecond)
+	<-written
+	select {
+	case <-got:
+		t.Fatal("expect the bytes delayed by the latency")
+	case <-time.After(50 * time.Millisecond):
+	}
+	clock.Advance(50 * time.Millisecond)
+	if p := <-got; len(p) != 100 {
+		t.Fatalf("expect 100 bytes delivered, got %d", len(p))
+	}
+
+	// disconnected in the middle of the write
+	sim.SetConditions(Conditions{DisconnectAfterBytes: 104})
+	got = readAsync(b, 10)
+	if _, err := conn.Write([]byte("0123456789")); err == nil {
+		t.Fatal("expect the error of the disconnected write")
+	}
+	if p := <-got; string(p) != "0123" {
+		t.Fatalf("expect the bytes before the disconnection, got %q", p)
+	}
+}
+
+func TestNetSimPacketConn(t *testing.T) {
+	sim := NewNetSim(Conditions{Latency: 20 * time.Millisecond, ReorderRate: 1}, 1, nil)
+	recv, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recv.Close()
+	send, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer send.Close()
+	pc := sim.PacketConn(send)
+	pc.WriteTo([]byte("a"), recv.LocalAddr())
+	sim.SetConditions(Conditions{Latency: 20 * time.Millisecond})
+	pc.WriteTo([]byte("b"), recv.LocalAddr())
+	sim.SetConditions(Conditions{LossRate: 1})
+	pc.WriteTo([]byte("c"), recv.LocalAddr())
+	var order string
+	buf := make([]byte, 8)
+	recv.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	for {
+		n, _, err := recv.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		order += string(buf[:n])
+	}
+	if order != "ba" {
+		t.Fatalf("expect the reordered packets without the lost one, got %q", order)
+	}
+}
+
+type Sim struct {
+	erpc.CallCtx
+}
+
+func (s *Sim) Echo(arg *string) (string, *erpc.Status) {
+	return *arg, nil
+}
+
+func TestNetSimPlugin(t *testing.T) {
+	sim := NewNetSim(Conditions{Latency: 30 * time.Millisecond}, 1, nil)
+	srv := erpc.NewPeer(erpc.PeerConfig{}, sim)
+	defer srv.Close()
+	srv.RouteCall(new(Sim))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	cli := erpc.NewPeer(erpc.PeerConfig{RedialTimes: 3, RedialInterval: 10 * time.Millisecond})
+	defer cli.Close()
+	sess, stat := cli.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var reply string
+	start := time.Now()
+	if stat = sess.Call("/sim/echo", "hi", &reply).Status(); !stat.OK() || reply != "hi" {
+		t.Fatalf("reply: %q, stat: %v", reply, stat)
+	}
+	if cost := time.Since(start); cost < 30*time.Millisecond {
+		t.Fatalf("expect the reply delayed by the latency, cost %s", cost)
+	}
+
+	// redialed after the disconnection
+	sim.Disconnect()
+	time.Sleep(100 * time.Millisecond)
+	if stat = sess.Call("/sim/echo", "again", &reply).Status(); !stat.OK() || reply != "again" {
+		t.Fatalf("reply: %q, stat: %v", reply, stat)
+	}
+}
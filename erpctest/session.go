@@ -0,0 +1,338 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package erpctest provides the fake Session, CallCtx and PushCtx with the assertion helpers,
+// so that the business handlers can be unit tested without standing up the peers.
+package erpctest
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/goutil"
+)
+
+// Sent a PUSH or CALL sent by the fake session.
+type Sent struct {
+	ServiceMethod string
+	Args          interface{}
+	// Meta the metadata set by the message settings, the last value of each key
+	Meta      map[string]string
+	BodyCodec byte
+}
+
+// Session a fake erpc.Session recording the sent pushes and calls.
+type Session struct {
+	erpc.Logger
+	// CallFunc handles the calls, and fills the result, default replies nothing
+	CallFunc func(serviceMethod string, args, result interface{}, setting ...erpc.MessageSetting) *erpc.Status
+	// PushFunc handles the pushes, default returns nil
+	PushFunc   func(serviceMethod string, args interface{}, setting ...erpc.MessageSetting) *erpc.Status
+	mu         sync.Mutex
+	id         string
+	local      net.Addr
+	remote     net.Addr
+	swap       goutil.Map
+	pushes     []Sent
+	calls      []Sent
+	closeCh    chan struct{}
+	closeOnce  sync.Once
+	sessionAge time.Duration
+	contextAge time.Duration
+	bodyCodec  byte
+	plugins    []erpc.Plugin
+}
+
+var _ erpc.Session = (*Session)(nil)
+
+// NewSession creates a fake session with the id, which is also the remote address.
+func NewSession(id string) *Session {
+	return &Session{
+		Logger:  erpc.GetLogger(),
+		id:      id,
+		local:   Addr("erpctest"),
+		remote:  Addr(id),
+		swap:    goutil.RwMap(),
+		closeCh: make(chan struct{}),
+	}
+}
+
+// Addr a fake network address.
+type Addr string
+
+// Network returns "erpctest".
+func (Addr) Network() string { return "erpctest" }
+
+// String returns the address.
+func (a Addr) String() string { return string(a) }
+
+// Peer returns nil, the fake session has no peer.
+func (s *Session) Peer() erpc.Peer {
+	return nil
+}
+
+// ID returns the session id.
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+// SetID sets the session id.
+func (s *Session) SetID(newID string) {
+	s.mu.Lock()
+	s.id = newID
+	s.mu.Unlock()
+}
+
+// LocalAddr returns the local network address.
+func (s *Session) LocalAddr() net.Addr {
+	return s.local
+}
+
+// RemoteAddr returns the remote network address.
+func (s *Session) RemoteAddr() net.Addr {
+	return s.remote
+}
+
+// SetRemoteAddr sets the remote network address, e.g. for the handlers checking the IP.
+func (s *Session) SetRemoteAddr(addr net.Addr) {
+	s.remote = addr
+}
+
+// Swap returns custom data swap of the session.
+func (s *Session) Swap() goutil.Map {
+	return s.swap
+}
+
+// CloseNotify returns a channel that closes when the session is closed.
+func (s *Session) CloseNotify() <-chan struct{} {
+	return s.closeCh
+}
+
+// Health reports whether the session is not closed.
+func (s *Session) Health() bool {
+	select {
+	case <-s.closeCh:
+		return false
+	default:
+		return true
+	}
+}
+
+// Close closes the session.
+func (s *Session) Close() error {
+	s.closeOnce.Do(func() { close(s.closeCh) })
+	return nil
+}
+
+// Stats returns the zero statistics.
+func (s *Session) Stats() erpc.Stats {
+	return erpc.Stats{}
+}
+
+// LastRead returns the zero time, the fake session has no connection.
+func (s *Session) LastRead() time.Time {
+	return time.Time{}
+}
+
+// LastWrite returns the zero time, the fake session has no connection.
+func (s *Session) LastWrite() time.Time {
+	return time.Time{}
+}
+
+// Ping returns immediately, the fake session has no remote peer.
+func (s *Session) Ping(ctx context.Context) (time.Duration, *erpc.Status) {
+	return 0, nil
+}
+
+// Liveness returns erpc.LivenessHealthy, the fake session has no remote peer.
+func (s *Session) Liveness() erpc.Liveness {
+	return erpc.LivenessHealthy
+}
+
+// RTT returns 0, the fake session has no remote peer.
+func (s *Session) RTT() time.Duration {
+	return 0
+}
+
+// ClockSkew returns false, the fake session has no remote peer.
+func (s *Session) ClockSkew() (time.Duration, bool) {
+	return 0, false
+}
+
+// Seq64 returns false, the fake session has no seq.
+func (s *Session) Seq64() bool {
+	return false
+}
+
+// SetBandwidth does nothing, the fake session has no socket.
+func (s *Session) SetBandwidth(readBps, writeBps int64) {}
+
+// SetReadLimit does nothing, the fake session has no socket.
+func (s *Session) SetReadLimit(maxSize uint32) {}
+
+// ReadLimit returns 0, the fake session has no socket.
+func (s *Session) ReadLimit() uint32 {
+	return 0
+}
+
+// SetDefaultBodyCodec records the default body codec.
+func (s *Session) SetDefaultBodyCodec(codecID byte) error {
+	s.mu.Lock()
+	s.bodyCodec = codecID
+	s.mu.Unlock()
+	return nil
+}
+
+// DefaultBodyCodec returns the default body codec set by SetDefaultBodyCodec.
+func (s *Session) DefaultBodyCodec() byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bodyCodec
+}
+
+// Migrate does nothing, the fake session has no connection.
+func (s *Session) Migrate() *erpc.Status {
+	return nil
+}
+
+// AppendPlugins records the plugins, which are not executed by the fake session.
+func (s *Session) AppendPlugins(plugins ...erpc.Plugin) error {
+	s.mu.Lock()
+	s.plugins = append(s.plugins, plugins...)
+	s.mu.Unlock()
+	return nil
+}
+
+// Plugins returns the plugins recorded by AppendPlugins.
+func (s *Session) Plugins() []erpc.Plugin {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.plugins
+}
+
+// AsyncCall records the call, and handles it by CallFunc immediately.
+func (s *Session) AsyncCall(serviceMethod string, args interface{}, result interface{}, callCmdChan chan<- erpc.CallCmd, setting ...erpc.MessageSetting) erpc.CallCmd {
+	callCmd := s.Call(serviceMethod, args, result, setting...)
+	if callCmdChan != nil {
+		callCmdChan <- callCmd
+	}
+	return callCmd
+}
+
+// Call records the call, and handles it by CallFunc.
+// NOTE: The call of the closed session fails with erpc.CodeConnClosed.
+func (s *Session) Call(serviceMethod string, args interface{}, result interface{}, setting ...erpc.MessageSetting) erpc.CallCmd {
+	if !s.Health() {
+		return erpc.NewFakeCallCmd(serviceMethod, args, result, erpc.NewStatus(erpc.CodeConnClosed, erpc.CodeText(erpc.CodeConnClosed), ""))
+	}
+	s.mu.Lock()
+	s.calls = append(s.calls, newSent(serviceMethod, args, setting))
+	s.mu.Unlock()
+	var stat *erpc.Status
+	if s.CallFunc != nil {
+		stat = s.CallFunc(serviceMethod, args, result, setting...)
+	}
+	return erpc.NewFakeCallCmd(serviceMethod, args, result, stat)
+}
+
+// CallBatch records and handles the calls one by one.
+func (s *Session) CallBatch(items []erpc.BatchItem, setting ...erpc.MessageSetting) []erpc.CallCmd {
+	callCmds := make([]erpc.CallCmd, len(items))
+	for i, item := range items {
+		itemSetting := append(setting[:len(setting):len(setting)], item.Setting...)
+		callCmds[i] = s.Call(item.ServiceMethod, item.Arg, item.Result, itemSetting...)
+	}
+	return callCmds
+}
+
+// Push records the push, and handles it by PushFunc.
+// NOTE: The push of the closed session fails with erpc.CodeConnClosed.
+func (s *Session) Push(serviceMethod string, args interface{}, setting ...erpc.MessageSetting) *erpc.Status {
+	if !s.Health() {
+		return erpc.NewStatus(erpc.CodeConnClosed, erpc.CodeText(erpc.CodeConnClosed), "")
+	}
+	s.mu.Lock()
+	s.pushes = append(s.pushes, newSent(serviceMethod, args, setting))
+	s.mu.Unlock()
+	if s.PushFunc != nil {
+		return s.PushFunc(serviceMethod, args, setting...)
+	}
+	return nil
+}
+
+// PushReliable records the push as Push, it is acknowledged once sent.
+func (s *Session) PushReliable(serviceMethod string, args interface{}, _ erpc.PushReliableOptions, setting ...erpc.MessageSetting) *erpc.Status {
+	return s.Push(serviceMethod, args, setting...)
+}
+
+// SessionAge returns the session max age.
+func (s *Session) SessionAge() time.Duration {
+	return s.sessionAge
+}
+
+// ContextAge returns CALL or PUSH context max age.
+func (s *Session) ContextAge() time.Duration {
+	return s.contextAge
+}
+
+// SetSessionAge sets the session max age.
+func (s *Session) SetSessionAge(duration time.Duration) {
+	s.sessionAge = duration
+}
+
+// SetContextAge sets CALL or PUSH context max age.
+func (s *Session) SetContextAge(duration time.Duration) {
+	s.contextAge = duration
+}
+
+// Pushes returns the recorded pushes in order.
+func (s *Session) Pushes() []Sent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Sent(nil), s.pushes...)
+}
+
+// Calls returns the recorded calls in order.
+func (s *Session) Calls() []Sent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Sent(nil), s.calls...)
+}
+
+// Reset clears the recorded pushes and calls.
+func (s *Session) Reset() {
+	s.mu.Lock()
+	s.pushes, s.calls = nil, nil
+	s.mu.Unlock()
+}
+
+func newSent(serviceMethod string, args interface{}, setting []erpc.MessageSetting) Sent {
+	m := erpc.GetMessage(setting...)
+	defer erpc.PutMessage(m)
+	sent := Sent{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Meta:          make(map[string]string, m.Meta().Len()),
+		BodyCodec:     m.BodyCodec(),
+	}
+	m.Meta().VisitAll(func(k, v []byte) {
+		sent.Meta[string(k)] = string(v)
+	})
+	return sent
+}
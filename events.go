@@ -0,0 +1,212 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType the type of peer lifecycle event
+type EventType uint8
+
+// Peer lifecycle event types
+const (
+	EventSessionAccepted EventType = iota + 1
+	EventSessionDialed
+	EventSessionClosed
+	EventDialFailed
+	EventRedialStarted
+	EventRedialSucceeded
+	EventRedialFailed
+	EventListenerStarted
+	EventListenerStopped
+	EventHandlerPanic
+	EventSlowConsumer
+	EventPathChanged
+	EventConfigReloaded
+	EventSessionIdle
+	EventLivenessChanged
+)
+
+var eventTypeText = map[EventType]string{
+	EventSessionAccepted: "session accepted",
+	EventSessionDialed:   "session dialed",
+	EventSessionClosed:   "session closed",
+	EventDialFailed:      "dial failed",
+	EventRedialStarted:   "redial started",
+	EventRedialSucceeded: "redial succeeded",
+	EventRedialFailed:    "redial failed",
+	EventListenerStarted: "listener started",
+	EventListenerStopped: "listener stopped",
+	EventHandlerPanic:    "handler panic",
+	EventSlowConsumer:    "slow consumer",
+	EventPathChanged:     "path changed",
+	EventConfigReloaded:  "config reloaded",
+	EventSessionIdle:     "session idle",
+	EventLivenessChanged: "liveness changed",
+}
+
+// String returns the event type text.
+func (t EventType) String() string {
+	if s, ok := eventTypeText[t]; ok {
+		return s
+	}
+	return "unknown event"
+}
+
+// Event a peer lifecycle event
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Session the session of the event, nil for the dial failed and listener events
+	Session BaseSession
+	// Network the network of the dial or listener
+	Network string
+	// Addr the remote address for the session and dial events, or the listening address
+	Addr string
+	// Err the cause of the dial failed, redial failed, listener stopped, slow consumer and session idle events,
+	// and of the failed ping of the liveness changed event
+	Err error
+	// ServiceMethod the service method of the handler panic event
+	ServiceMethod string
+	// Panic the recovered value of the handler panic event
+	Panic interface{}
+	// OldPath the "local->remote" addresses of the old connection of the path changed event,
+	// and the new ones are of the Session
+	OldPath string
+	// Liveness the new liveness of the session of the liveness changed event
+	Liveness Liveness
+	// Restart the changed fields of PeerConfig of the config reloaded event, which require restarting the peer
+	Restart []string
+}
+
+// eventBus dispatches the lifecycle events of a peer.
+type eventBus struct {
+	// dropped the number of the events dropped by the channels of Events
+	dropped uint64
+	// lastDropLog the unix second of the last logged drop
+	lastDropLog int64
+	mu          sync.RWMutex
+	handlers    []func(Event)
+	count       int32
+}
+
+// on registers the event handler.
+func (b *eventBus) on(fn func(Event)) {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, fn)
+	atomic.StoreInt32(&b.count, int32(len(b.handlers)))
+	b.mu.Unlock()
+}
+
+func (b *eventBus) emit(e Event) {
+	if atomic.LoadInt32(&b.count) == 0 {
+		return
+	}
+	e.Time = time.Now()
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+	for _, fn := range handlers {
+		b.call(fn, e)
+	}
+}
+
+func (b *eventBus) call(fn func(Event), e Event) {
+	defer func() {
+		if p := recover(); p != nil {
+			Errorf("event handler panic:%v", p)
+		}
+	}()
+	fn(e)
+}
+
+// OnEvent registers the callback of the peer lifecycle events.
+// NOTE:
+//  The callback is called synchronously in the goroutine of the event,
+//  and must not block;
+//  The events of closing and redialing a session are emitted after the session lock is released,
+//  e.g. the redial started event is emitted after the redialing is finished.
+func (p *peer) OnEvent(fn func(Event)) {
+	p.events.on(fn)
+}
+
+// eventsBufferSize the buffer size of the channel returned by Events
+const eventsBufferSize = 256
+
+// Events returns a channel that receives the peer lifecycle events.
+// NOTE:
+//  Each call returns a new channel;
+//  The event is dropped when the channel buffer is full.
+func (p *peer) Events() <-chan Event {
+	ch := make(chan Event, eventsBufferSize)
+	p.events.on(func(e Event) {
+		select {
+		case ch <- e:
+		default:
+			// log the first drop of each second only
+			if n := atomic.AddUint64(&p.events.dropped, 1); atomic.SwapInt64(&p.events.lastDropLog, e.Time.Unix()) != e.Time.Unix() {
+				Warnf("event dropped: %s, total dropped: %d", e.Type, n)
+			}
+		}
+	})
+	return ch
+}
+
+// DroppedEvents returns the number of the events dropped by the full channels returned by Events.
+func (p *peer) DroppedEvents() uint64 {
+	return atomic.LoadUint64(&p.events.dropped)
+}
+
+func (p *peer) emitSessionEvent(typ EventType, sess *session) {
+	p.events.emit(p.sessionEvent(typ, sess))
+}
+
+func (p *peer) sessionEvent(typ EventType, sess *session) Event {
+	return Event{
+		Type:    typ,
+		Session: sess,
+		Network: p.network,
+		Addr:    sess.RemoteAddr().String(),
+	}
+}
+
+// emitLocked defers the event emitted while holding the session lock, until unlock,
+// so that the event handlers can use the session, e.g. close it.
+func (s *session) emitLocked(e Event) {
+	s.lockedEvents = append(s.lockedEvents, e)
+}
+
+// unlock releases the session lock, then emits the deferred events.
+func (s *session) unlock() {
+	events := s.lockedEvents
+	s.lockedEvents = nil
+	s.lock.Unlock()
+	for _, e := range events {
+		s.peer.events.emit(e)
+	}
+}
+
+func (p *peer) emitListenerEvent(typ EventType, network string, addr net.Addr, err error) {
+	p.events.emit(Event{
+		Type:    typ,
+		Network: network,
+		Addr:    addr.String(),
+		Err:     err,
+	})
+}
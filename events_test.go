@@ -0,0 +1,77 @@
+package erpc_test
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{ListenPort: 9104})
+	srv.RouteCallFunc(panic_call)
+	srvEvents := srv.Events()
+	go srv.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	var cliEvents = make(chan erpc.Event, 16)
+	cli.OnEvent(func(e erpc.Event) {
+		// the session can be used in the callback
+		if sess, ok := e.Session.(erpc.Session); ok && e.Type == erpc.EventSessionClosed {
+			sess.Close()
+		}
+		cliEvents <- e
+	})
+	if _, stat := cli.Dial(":9999"); stat.OK() {
+		t.Fatal("dial :9999: expect error!")
+	}
+	sess, stat := cli.Dial(":9104")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	sess.Call("/panic/call", nil, nil)
+	sess.Close()
+	cli.Close()
+	time.Sleep(100 * time.Millisecond)
+	srv.Close()
+
+	expect := func(events <-chan erpc.Event, types ...erpc.EventType) {
+		for _, typ := range types {
+			select {
+			case e := <-events:
+				if e.Type != typ {
+					t.Fatalf("expect %s event, got %s: %+v", typ, e.Type, e)
+				}
+				if typ == erpc.EventHandlerPanic && (e.ServiceMethod != "/panic/call" || e.Panic != "panic_call") {
+					t.Fatalf("bad panic event: %+v", e)
+				}
+			case <-time.After(3 * time.Second):
+				t.Fatalf("expect %s event: timeout", typ)
+			}
+		}
+	}
+	expect(cliEvents, erpc.EventDialFailed, erpc.EventSessionDialed, erpc.EventSessionClosed)
+	expect(srvEvents, erpc.EventListenerStarted, erpc.EventSessionAccepted, erpc.EventHandlerPanic, erpc.EventSessionClosed, erpc.EventListenerStopped)
+}
+
+func TestEventsDropped(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{ListenPort: 9115})
+	srv.Events()
+	go srv.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	// the event channel is not read, the events after the first ones are dropped
+	for i := 0; i < 300; i++ {
+		sess, stat := cli.Dial(":9115")
+		if !stat.OK() {
+			t.Fatal(stat)
+		}
+		sess.Close()
+	}
+	time.Sleep(200 * time.Millisecond)
+	srv.Close()
+	if n := srv.DroppedEvents(); n == 0 {
+		t.Fatal("expect dropped events")
+	}
+}
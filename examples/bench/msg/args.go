@@ -57,3 +57,8 @@ func CheckArgs(c, n int) (int, int, error) {
 	}
 	return c, n, nil
 }
+
+// ReleaseBody resets the message, so that the handler arg is reused by the pool of erpc.
+func (m *BenchmarkMessage) ReleaseBody() {
+	m.Reset()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os/exec"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/plugin/auth"
+)
+
+//go:generate go build $GOFILE
+
+func main() {
+	defer erpc.FlushLogger()
+	cli := erpc.NewPeer(
+		erpc.PeerConfig{RedialTimes: -1, RedialInterval: time.Second},
+		auth.NewBearerPlugin(func(sess auth.Session, fn auth.SendOnce) *erpc.Status {
+			var ret string
+			return fn("agent-1", &ret)
+		}),
+	)
+	defer cli.Close()
+	// the agent is commanded by the server
+	cli.RouteCall(new(Cmd))
+	_, stat := cli.Dial(":9090")
+	if !stat.OK() {
+		erpc.Fatalf("%v", stat)
+	}
+	select {}
+}
+
+// Cmd the command handler called by the server
+type Cmd struct {
+	erpc.CallCtx
+}
+
+// allowedCommands the commands the server may run on the agent, never the arbitrary ones from the remote
+var allowedCommands = map[string][]string{
+	"uptime":   {"uptime"},
+	"hostname": {"hostname"},
+}
+
+// Exec handles '/cmd/exec' message, running the allowlisted command of the name
+func (c *Cmd) Exec(name *string) (string, *erpc.Status) {
+	argv, ok := allowedCommands[*name]
+	if !ok {
+		return "", erpc.NewStatus(erpc.CodeBadMessage, "command not allowed", *name)
+	}
+	out, err := exec.CommandContext(c.Context(), argv[0], argv[1:]...).Output()
+	if err != nil {
+		return "", erpc.NewStatus(1, "exec failed", err.Error())
+	}
+	return string(out), nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/plugin/auth"
+)
+
+//go:generate go build $GOFILE
+
+func main() {
+	defer erpc.FlushLogger()
+	srv := erpc.NewPeer(
+		erpc.PeerConfig{ListenPort: 9090},
+		// the session id is the agent name, kept across the redials of the agent
+		auth.NewCheckerPlugin(func(sess auth.Session, fn auth.RecvOnce) (interface{}, *erpc.Status) {
+			var name string
+			if stat := fn(&name); !stat.OK() {
+				return nil, stat
+			}
+			sess.SetID(name)
+			return "ok", nil
+		}),
+	)
+	go command(srv, "agent-1")
+	srv.ListenAndServe()
+}
+
+// command calls the connected agent every 3s.
+func command(srv erpc.Peer, agentName string) {
+	for {
+		time.Sleep(time.Second * 3)
+		var output string
+		stat := srv.CallSession(agentName, "/cmd/exec", "uptime", &output,
+			erpc.WithSessionWait(time.Second*10),
+		).Status()
+		if !stat.OK() {
+			erpc.Warnf("exec on %s: %v", agentName, stat)
+			continue
+		}
+		erpc.Printf("exec on %s: %s", agentName, output)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import "golang.org/x/sys/unix"
+
+// setFastOpen enables TCP Fast Open of the listener, the max length of the pending requests is by the system.
+func setFastOpen(fd uintptr, qlen int) error {
+	if qlen <= 0 {
+		return nil
+	}
+	return unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_FASTOPEN, 1)
+}
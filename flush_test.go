@@ -0,0 +1,51 @@
+package erpc_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var flushPushes int32
+
+type flushPush struct {
+	erpc.PushCtx
+}
+
+func (p *flushPush) Count(arg *int) *erpc.Status {
+	atomic.AddInt32(&flushPushes, 1)
+	return nil
+}
+
+type flushCall struct {
+	erpc.CallCtx
+}
+
+func (c *flushCall) Echo(arg *string) (string, *erpc.Status) {
+	return *arg, nil
+}
+
+func TestFlushInterval(t *testing.T) {
+	cfg := erpc.PeerConfig{FlushInterval: 5 * time.Millisecond}
+	srv, cli, sess := erpc.NewPipePeerPair(cfg, cfg)
+	defer srv.Close()
+	defer cli.Close()
+	srv.RoutePush(new(flushPush))
+	srv.RouteCall(new(flushCall))
+	for i := 0; i < 100; i++ {
+		if stat := sess.Push("/flush_push/count", i); !stat.OK() {
+			t.Fatal(stat)
+		}
+	}
+	var result string
+	if stat := sess.Call("/flush_call/echo", "x", &result).Status(); !stat.OK() || result != "x" {
+		t.Fatal(stat, result)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for atomic.LoadInt32(&flushPushes) < 100 {
+		if time.Now().After(deadline) {
+			t.Fatalf("pushes: %d", atomic.LoadInt32(&flushPushes))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
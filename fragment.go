@@ -0,0 +1,71 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"github.com/andeya/erpc/v7/socket"
+)
+
+const (
+	// FragmentServiceMethod the service method of the fragmentation negotiation,
+	// it is a PUSH handled by the framework, and the old peer not supporting it logs it as the unknown PUSH.
+	FragmentServiceMethod = "/erpc/fragment"
+	// MetaFragment the key of the fragmentation negotiation, "syn" by the client, and "ack" by the server
+	MetaFragment = "X-Fragment"
+)
+
+// negotiateFragment requests the remote peer to reassemble the frames,
+// if PeerConfig.FragmentSize or PeerConfig.MaxReassemblySize is set.
+// NOTE:
+//  Each side fragments the messages written by its own FragmentSize only after the agreement;
+//  Only for the protocols carrying the ExtFragment extension, see ExtensionsCarrier.
+func (s *session) negotiateFragment() {
+	if s.peer.fragmentSize <= 0 && s.peer.maxReassemblySize <= 0 {
+		return
+	}
+	if !s.carryExtensions() {
+		Warnf("fragmentation disabled (addr:%s, id:%s): the protocol does not carry the extensions", s.RemoteAddr().String(), s.ID())
+		return
+	}
+	if stat := s.RawPush(FragmentServiceMethod, nil, WithSetMeta(MetaFragment, "syn"), s.withTime()); !stat.OK() {
+		Debugf("negotiate fragmentation: %s", stat.String())
+	}
+}
+
+// handleFragment handles the fragmentation negotiation.
+// NOTE: The request is not acknowledged if the protocol does not carry the ExtFragment extension.
+func (s *session) handleFragment(header Header) {
+	if !s.carryExtensions() {
+		return
+	}
+	switch string(header.Meta().Peek(MetaFragment)) {
+	case "syn":
+		if stat := s.RawPush(FragmentServiceMethod, nil, WithSetMeta(MetaFragment, "ack"), s.withTimeEcho(header)); !stat.OK() {
+			Debugf("acknowledge fragmentation: %s", stat.String())
+			return
+		}
+		s.enableFragment()
+	case "ack":
+		s.observeSkew(header)
+		s.enableFragment()
+	}
+}
+
+// enableFragment fragments the messages written by PeerConfig.FragmentSize.
+func (s *session) enableFragment() {
+	if s.peer.fragmentSize > 0 {
+		s.socket.(socket.UnsafeSocket).SetFragmentSize(s.peer.fragmentSize)
+	}
+}
@@ -14,7 +14,9 @@ require (
 	github.com/tidwall/evio v1.0.8
 	github.com/tidwall/gjson v1.14.1
 	github.com/xtaci/kcp-go/v5 v5.5.12
+	golang.org/x/net v0.0.0-20210428140749-89ef3d95e781
 	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
@@ -40,11 +42,10 @@ require (
 	github.com/tjfoc/gmsm v1.0.1 // indirect
 	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9 // indirect
 	golang.org/x/mod v0.4.2 // indirect
-	golang.org/x/net v0.0.0-20210428140749-89ef3d95e781 // indirect
+	golang.org/x/text v0.3.6 // indirect
 	golang.org/x/tools v0.1.1 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 	google.golang.org/protobuf v1.26.0 // indirect
 	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -106,7 +106,7 @@ func SetShutdown(timeout time.Duration, firstSweep, beforeExiting func() error)
 	}
 	FirstSweep = func() error {
 		setParentLaddrList()
-		return errors.Merge(firstSweep(), inherit_net.SetInherited(), quic.SetInherited())
+		return errors.Merge(firstSweep(), inherit_net.SetInherited(), quic.SetInherited(), setHandoffSessions())
 	}
 	BeforeExiting = func() error {
 		return errors.Merge(shutdown(), beforeExiting())
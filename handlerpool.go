@@ -0,0 +1,130 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"fmt"
+	"sync"
+)
+
+// handlerPool is a named worker pool isolated from the global goroutine pool.
+type handlerPool struct {
+	*workerPool
+	name          string
+	maxGoroutines int
+	maxQueue      int
+}
+
+// handlerPools the named handler pools of a peer.
+type handlerPools struct {
+	m  map[string]*handlerPool
+	mu sync.Mutex
+}
+
+func newHandlerPools() *handlerPools {
+	return &handlerPools{m: make(map[string]*handlerPool)}
+}
+
+// get returns the pool of the name, and creates it by the spec for the first time.
+func (ps *handlerPools) get(spec *handlerPool) (*handlerPool, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	pool, ok := ps.m[spec.name]
+	if !ok {
+		pool = &handlerPool{
+			workerPool:    newWorkerPool(spec.maxGoroutines, spec.maxQueue),
+			name:          spec.name,
+			maxGoroutines: spec.maxGoroutines,
+			maxQueue:      spec.maxQueue,
+		}
+		ps.m[spec.name] = pool
+		return pool, nil
+	}
+	if pool.maxGoroutines != spec.maxGoroutines || pool.maxQueue != spec.maxQueue {
+		return nil, fmt.Errorf("WithHandlerPool: pool %q already exists with maxGoroutines=%d and maxQueue=%d, conflicts with maxGoroutines=%d and maxQueue=%d",
+			spec.name, pool.maxGoroutines, pool.maxQueue, spec.maxGoroutines, spec.maxQueue)
+	}
+	return pool, nil
+}
+
+// queued returns the number of the functions waiting in all pools.
+func (ps *handlerPools) queued() int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	var n int
+	for _, pool := range ps.m {
+		n += pool.queued()
+	}
+	return n
+}
+
+// stop stops all pools.
+func (ps *handlerPools) stop() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for _, pool := range ps.m {
+		pool.stop()
+	}
+}
+
+// HandlerPoolSpec the spec of the named worker pool selected by SelectHandlerPoolPlugin.
+// NOTE: The pool is created for the first time like WithHandlerPool, shared with the routes of the same name.
+type HandlerPoolSpec struct {
+	// Name the name of the pool
+	Name string
+	// MaxGoroutines the goroutine limit of the pool, must be greater than 0
+	MaxGoroutines int
+	// MaxQueue the queue length of the pool, unlimited if <=0
+	MaxQueue int
+}
+
+// WithHandlerPool returns a plugin that executes the handlers of the route
+// in the named worker pool, with independent goroutine limit and queue length.
+// Routes of the same peer using the same name share the pool, so a slow handler cannot
+// exhaust the shared goroutine pool and starve latency-sensitive routes.
+// NOTE:
+//  The queue is unlimited if maxQueue is not set or <=0;
+//  When the queue is full, the message is rejected with CodeServiceUnavailable;
+//  The pool is created for each peer, and stopped when the peer is closed;
+//  The registration fails if the same name is used with different parameters in a peer.
+// Example:
+//  peer.RouteCall(new(Report), erpc.WithHandlerPool("heavy", 32))
+func WithHandlerPool(name string, maxGoroutines int, maxQueue ...int) Plugin {
+	if maxGoroutines <= 0 {
+		Fatalf("WithHandlerPool: maxGoroutines of pool %q must be greater than 0", name)
+	}
+	spec := &handlerPool{name: name, maxGoroutines: maxGoroutines}
+	if len(maxQueue) > 0 && maxQueue[0] > 0 {
+		spec.maxQueue = maxQueue[0]
+	}
+	return &handlerPoolPlugin{spec: spec}
+}
+
+type handlerPoolPlugin struct {
+	spec *handlerPool
+}
+
+var _ PostRegPlugin = (*handlerPoolPlugin)(nil)
+
+func (p *handlerPoolPlugin) Name() string {
+	return "handler-pool:" + p.spec.name
+}
+
+// PostReg marks the handler with the pool spec,
+// and the router replaces it with the pool of the peer.
+func (p *handlerPoolPlugin) PostReg(h *Handler) error {
+	h.pool = p.spec
+	return nil
+}
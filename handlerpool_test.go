@@ -0,0 +1,71 @@
+package erpc_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func heavy_call(ctx erpc.CallCtx, arg *int) (int, *erpc.Status) {
+	time.Sleep(time.Duration(*arg) * time.Millisecond)
+	return *arg, nil
+}
+
+func light_call(ctx erpc.CallCtx, arg *int) (int, *erpc.Status) {
+	return *arg, nil
+}
+
+func TestWithHandlerPool(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{
+		ListenPort: 9095,
+	})
+	defer srv.Close()
+	srv.RouteCallFunc(heavy_call, erpc.WithHandlerPool("heavy", 1, 1))
+	srv.RouteCallFunc(light_call)
+	go srv.ListenAndServe()
+	time.Sleep(time.Second)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(":9095")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		codes []int32
+	)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var reply int
+			stat := sess.Call("/heavy/call", 500, &reply).Status()
+			mu.Lock()
+			codes = append(codes, stat.Code())
+			mu.Unlock()
+		}()
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// the shared pool is not occupied by the heavy route
+	start := time.Now()
+	var reply int
+	stat = sess.Call("/light/call", 1, &reply).Status()
+	assert.True(t, stat.OK(), stat)
+	assert.Equal(t, 1, reply)
+	assert.True(t, time.Since(start) < 300*time.Millisecond)
+
+	wg.Wait()
+	assert.ElementsMatch(t, []int32{erpc.CodeOK, erpc.CodeOK, erpc.CodeServiceUnavailable}, codes)
+
+	// the pools are isolated per peer
+	srv2 := erpc.NewPeer(erpc.PeerConfig{})
+	defer srv2.Close()
+	srv2.RouteCallFunc(heavy_call, erpc.WithHandlerPool("heavy", 2))
+}
@@ -0,0 +1,262 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andeya/erpc/v7/socket"
+	"github.com/andeya/goutil"
+	"github.com/andeya/goutil/graceful"
+)
+
+// parentSessionsKey the environment variable of the sessions passed to the new process on Reboot
+const parentSessionsKey = "LISTEN_PARENT_SESSIONS"
+
+// handoffRecord the session passed to the new process.
+type handoffRecord struct {
+	ID      string `json:"id"`
+	Network string `json:"network"`
+	Local   string `json:"local"`
+	Remote  string `json:"remote"`
+}
+
+var (
+	errHandoffUnsupported = errors.New("the session can not be handed off")
+	errHandoffNotBoundary = errors.New("the session is not stopped at the message boundary")
+)
+
+// handoff stops reading the session at the message boundary, waits for the handlers to reply,
+// then closes it in this process, and returns the duplicated file of the connection.
+// NOTE: The calls sent by the session and waiting for the reply are canceled.
+func (s *session) handoff() (*os.File, *handoffRecord, error) {
+	conn, ok := s.getConn().(interface {
+		net.Conn
+		File() (*os.File, error)
+	})
+	if !ok || !s.checkStatus(statusOk) || !s.peer.isListening(conn.LocalAddr()) {
+		return nil, nil, errHandoffUnsupported
+	}
+	if _, ok = s.socket.(socket.UnsafeSocket); !ok {
+		return nil, nil, errHandoffUnsupported
+	}
+	s.handoffCh = make(chan bool, 1)
+	atomic.StoreInt32(&s.handingOff, 1)
+	// interrupt the reading
+	s.socket.SetReadDeadline(time.Now())
+	select {
+	case ready := <-s.handoffCh:
+		if !ready {
+			return nil, nil, errHandoffNotBoundary
+		}
+	case <-s.CloseNotify():
+		return nil, nil, errHandoffNotBoundary
+	}
+	s.graceCtxWait()
+	s.socket.(socket.UnsafeSocket).Flush()
+	f, err := conn.File()
+	if err == nil {
+		err = s.Close()
+	} else {
+		s.Close()
+	}
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+		return nil, nil, err
+	}
+	return f, &handoffRecord{
+		ID:      s.ID(),
+		Network: conn.LocalAddr().Network(),
+		Local:   conn.LocalAddr().String(),
+		Remote:  conn.RemoteAddr().String(),
+	}, nil
+}
+
+// stopReadForHandoff reports to the handoff whether the read loop is stopped at the message boundary,
+// and returns true if the session is handed off.
+func (s *session) stopReadForHandoff(err error) bool {
+	if atomic.LoadInt32(&s.handingOff) == 0 {
+		return false
+	}
+	ne, ok := err.(net.Error)
+	ready := ok && ne.Timeout() && s.checkStatus(statusOk) && s.socket.(socket.UnsafeSocket).ReadBoundary()
+	s.handoffCh <- ready
+	return ready
+}
+
+// isListening reports whether the local address of the connection is one of the listeners.
+func (p *peer) isListening(localAddr net.Addr) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for lis := range p.listeners {
+		if sameListenAddr(lis.Addr(), localAddr.Network(), localAddr.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameListenAddr reports whether the local address of the connection is the listening address.
+func sameListenAddr(lisAddr net.Addr, network, localAddr string) bool {
+	if lisAddr.Network() != network {
+		return false
+	}
+	lisHost, lisPort, err := net.SplitHostPort(lisAddr.String())
+	if err != nil {
+		// unix socket path
+		return lisAddr.String() == localAddr
+	}
+	host, port, err := net.SplitHostPort(localAddr)
+	if err != nil || port != lisPort {
+		return false
+	}
+	ip := net.ParseIP(lisHost)
+	return ip == nil || ip.IsUnspecified() || ip.Equal(net.ParseIP(host))
+}
+
+// setHandoffSessions hands off the sessions of the peers with PeerConfig.HandoffSessions,
+// and adds their files to be inherited by the new process.
+// NOTE: The files are after the inherited listeners of inherit_net and quic.
+func setHandoffSessions() error {
+	peers.rwmu.RLock()
+	var list []*peer
+	for p := range peers.list {
+		if p.handoffSessions {
+			list = append(list, p)
+		}
+	}
+	peers.rwmu.RUnlock()
+	type result struct {
+		f   *os.File
+		rec *handoffRecord
+	}
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results []result
+	)
+	for _, p := range list {
+		p.sessHub.rangeCallback(func(sess *session) bool {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				f, rec, err := sess.handoff()
+				if err != nil {
+					if err != errHandoffUnsupported {
+						Warnf("handoff session %s: %s", sess.ID(), err.Error())
+					}
+					return
+				}
+				mu.Lock()
+				results = append(results, result{f, rec})
+				mu.Unlock()
+			}()
+			return true
+		})
+	}
+	wg.Wait()
+	files := make([]*os.File, len(results))
+	records := make([]*handoffRecord, len(results))
+	for i, r := range results {
+		files[i], records[i] = r.f, r.rec
+	}
+	b, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	graceful.AddInherited(files, []*graceful.Env{
+		{K: parentSessionsKey, V: goutil.BytesToString(b)},
+	})
+	if len(files) > 0 {
+		Infof("handoff %d sessions to the new process", len(files))
+	}
+	return nil
+}
+
+// inheritedSession the session passed by the parent process.
+type inheritedSession struct {
+	rec  *handoffRecord
+	conn net.Conn
+}
+
+var inheritedSessions struct {
+	once sync.Once
+	mu   sync.Mutex
+	list []*inheritedSession
+}
+
+// inheritSessions opens the connections of the sessions passed by the parent process.
+func inheritSessions() {
+	var records []*handoffRecord
+	if err := json.Unmarshal(goutil.StringToBytes(os.Getenv(parentSessionsKey)), &records); err != nil || len(records) == 0 {
+		return
+	}
+	// the files are after the inherited listeners
+	fdStart := 3
+	for _, key := range []string{"LISTEN_FDS", "LISTEN_QUIC_FDS"} {
+		n, _ := strconv.Atoi(os.Getenv(key))
+		fdStart += n
+	}
+	for i, rec := range records {
+		f := os.NewFile(uintptr(fdStart+i), "session")
+		conn, err := net.FileConn(f)
+		f.Close()
+		if err != nil {
+			Warnf("inherit session %s: %s", rec.ID, err.Error())
+			continue
+		}
+		if conn.RemoteAddr() == nil || conn.RemoteAddr().String() != rec.Remote {
+			Warnf("inherit session %s: the connection is not from %s", rec.ID, rec.Remote)
+			conn.Close()
+			continue
+		}
+		inheritedSessions.list = append(inheritedSessions.list, &inheritedSession{rec: rec, conn: conn})
+	}
+}
+
+// resumeSessions serves the sessions passed by the parent process, which were accepted by the listener.
+func (p *peer) resumeSessions(lis net.Listener, protoFunc []ProtoFunc) {
+	inheritedSessions.once.Do(inheritSessions)
+	inheritedSessions.mu.Lock()
+	var resumed []*inheritedSession
+	list := inheritedSessions.list[:0]
+	for _, is := range inheritedSessions.list {
+		if sameListenAddr(lis.Addr(), is.rec.Network, is.rec.Local) {
+			resumed = append(resumed, is)
+		} else {
+			list = append(list, is)
+		}
+	}
+	inheritedSessions.list = list
+	inheritedSessions.mu.Unlock()
+	for _, is := range resumed {
+		sess := newSession(p, is.conn, protoFunc)
+		sess.socket.SetID(is.rec.ID)
+		Infof("resume ok (network:%s, addr:%s, id:%s)", is.rec.Network, sess.RemoteAddr().String(), sess.ID())
+		p.sessHub.set(sess)
+		sess.changeStatus(statusOk)
+		p.emitSessionEvent(EventSessionAccepted, sess)
+		AnywayGo(sess.startReadAndHandle)
+	}
+}
@@ -0,0 +1,104 @@
+package erpc
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+type handoffCall struct {
+	CallCtx
+}
+
+// Port returns the local port of the server.
+func (h *handoffCall) Port(*struct{}) (string, *Status) {
+	_, port, _ := net.SplitHostPort(h.Session().LocalAddr().String())
+	return port, nil
+}
+
+func TestSameListenAddr(t *testing.T) {
+	for _, c := range []struct {
+		lis, network, local string
+		same                bool
+	}{
+		{"[::]:9119", "tcp", "127.0.0.1:9119", true},
+		{"0.0.0.0:9119", "tcp", "127.0.0.1:9119", true},
+		{"127.0.0.1:9119", "tcp", "127.0.0.1:9119", true},
+		{"127.0.0.1:9119", "tcp", "127.0.0.2:9119", false},
+		{"127.0.0.1:9119", "tcp", "127.0.0.1:9120", false},
+		{"127.0.0.1:9119", "unix", "127.0.0.1:9119", false},
+	} {
+		lisAddr, _ := NewFakeAddr2("tcp", c.lis)
+		if same := sameListenAddr(lisAddr, c.network, c.local); same != c.same {
+			t.Errorf("%s %s %s: expect %v, got %v", c.lis, c.network, c.local, c.same, same)
+		}
+	}
+	unixAddr := &net.UnixAddr{Net: "unix", Name: "/tmp/erpc.sock"}
+	if !sameListenAddr(unixAddr, "unix", "/tmp/erpc.sock") {
+		t.Error("the same socket file: expect true")
+	}
+}
+
+func TestHandoff(t *testing.T) {
+	srv := NewPeer(PeerConfig{ListenPort: 9119, HandoffSessions: true})
+	srv.RouteCall(new(handoffCall))
+	go srv.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := NewPeer(PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(":9119")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var port string
+	if stat = sess.Call("/handoff_call/port", nil, &port).Status(); !stat.OK() || port != "9119" {
+		t.Fatalf("port: %s, stat: %v", port, stat)
+	}
+
+	// hand off the server session, as the parent process does on Reboot
+	var srvSess *session
+	srv.RangeSession(func(s Session) bool {
+		srvSess = s.(*session)
+		return false
+	})
+	f, rec, err := srvSess.handoff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.ID != srvSess.ID() {
+		t.Fatalf("record id: %s, expect: %s", rec.ID, srvSess.ID())
+	}
+	if srv.CountSession() != 0 {
+		t.Fatalf("the handed off session is still in the old peer")
+	}
+	srv.Close()
+	conn, err := net.FileConn(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// resume the session, as the new process does
+	inheritedSessions.once.Do(func() {})
+	inheritedSessions.mu.Lock()
+	inheritedSessions.list = append(inheritedSessions.list, &inheritedSession{rec: rec, conn: conn})
+	inheritedSessions.mu.Unlock()
+	srv2 := NewPeer(PeerConfig{ListenPort: 9119})
+	defer srv2.Close()
+	srv2.RouteCall(new(handoffCall))
+	go srv2.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+	if _, ok := srv2.GetSession(rec.ID); !ok {
+		t.Fatalf("the session %s is not resumed", rec.ID)
+	}
+	for i := 0; i < 3; i++ {
+		port = ""
+		if stat = sess.Call("/handoff_call/port", nil, &port).Status(); !stat.OK() || port != "9119" {
+			t.Fatalf("after handoff: port: %s, stat: %v", port, stat)
+		}
+	}
+	if !sess.Health() {
+		t.Fatal("the client session is broken by the handoff")
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+type (
+	// HedgingPolicy the policy of hedging a call.
+	HedgingPolicy struct {
+		// Delay the waiting duration before sending the next duplicate call
+		Delay time.Duration
+		// MaxAttempts the max number of calls, including the first one
+		MaxAttempts int
+	}
+	// AsyncCaller the object used to call asynchronously, e.g. Session.
+	AsyncCaller interface {
+		AsyncCall(serviceMethod string, arg interface{}, result interface{}, callCmdChan chan<- CallCmd, setting ...MessageSetting) CallCmd
+	}
+	hedgingKey    struct{}
+	hedgeAttempt  struct{}
+	hedgedCallCmd struct {
+		CallCmd
+		result interface{}
+	}
+)
+
+// WithHedging sets the hedging policy of the call:
+// if the call has not been replied within delay, a duplicate call is sent by another caller,
+// the first reply wins and the others are canceled.
+// NOTE:
+//  Only for idempotent calls;
+//  It takes effect in the callers having multiple sessions, e.g. HedgeCall and mixer/multiclient.
+func WithHedging(delay time.Duration, maxAttempts int) MessageSetting {
+	policy := HedgingPolicy{Delay: delay, MaxAttempts: maxAttempts}
+	return func(m Message) {
+		WithContext(context.WithValue(m.Context(), hedgingKey{}, policy))(m)
+	}
+}
+
+// GetHedgingPolicy returns the hedging policy set by WithHedging.
+func GetHedgingPolicy(setting ...MessageSetting) (HedgingPolicy, bool) {
+	m := GetMessage(setting...)
+	policy, ok := m.Context().Value(hedgingKey{}).(HedgingPolicy)
+	PutMessage(m)
+	return policy, ok && policy.MaxAttempts > 1
+}
+
+// HedgeCall sends the call by the caller of the first attempt, and hedges it by the hedging policy.
+// The next returns the caller of the attempt, and false if there is no more caller.
+// NOTE:
+//  If the result is a pointer, each attempt decodes the reply into a new object,
+//  and the winner's is copied to the result;
+//  If no hedging policy is set, it is the same as a normal call.
+func HedgeCall(next func(attempt int) (AsyncCaller, bool), serviceMethod string, arg interface{}, result interface{}, setting ...MessageSetting) CallCmd {
+	caller, ok := next(0)
+	if !ok {
+		return NewFakeCallCmd(serviceMethod, arg, result, NewStatus(CodeWrongConn, CodeText(CodeWrongConn), "no caller"))
+	}
+	policy, ok := GetHedgingPolicy(setting...)
+	if !ok {
+		callCmd := caller.AsyncCall(serviceMethod, arg, result, make(chan CallCmd, 1), setting...)
+		<-callCmd.Done()
+		return callCmd
+	}
+
+	m := GetMessage(setting...)
+	ctx, cancel := context.WithCancel(context.WithValue(m.Context(), hedgeAttempt{}, true))
+	PutMessage(m)
+	defer cancel()
+	attemptSetting := make([]MessageSetting, len(setting)+1)
+	copy(attemptSetting, setting)
+	attemptSetting[len(setting)] = WithContext(ctx)
+
+	var (
+		callCmdChan = make(chan CallCmd, policy.MaxAttempts)
+		results     = make(map[CallCmd]reflect.Value, policy.MaxAttempts)
+		attempts    int
+		pending     int
+	)
+	launch := func(caller AsyncCaller) {
+		r := reflect.ValueOf(result)
+		if r.Kind() == reflect.Ptr && !r.IsNil() {
+			r = reflect.New(r.Type().Elem())
+		}
+		attemptResult := result
+		if r.IsValid() {
+			attemptResult = r.Interface()
+		}
+		callCmd := caller.AsyncCall(serviceMethod, arg, attemptResult, callCmdChan, attemptSetting...)
+		results[callCmd] = r
+		attempts++
+		pending++
+	}
+	launchNext := func() bool {
+		if attempts >= policy.MaxAttempts {
+			return false
+		}
+		caller, ok := next(attempts)
+		if !ok {
+			return false
+		}
+		launch(caller)
+		return true
+	}
+
+	launch(caller)
+	timer := time.NewTimer(policy.Delay)
+	defer timer.Stop()
+	for {
+		select {
+		case callCmd := <-callCmdChan:
+			pending--
+			// sender errors, try the others, except the canceled calls
+			if code := callCmd.Status().Code(); code >= 100 && code < 200 && code != CodeCallCanceled {
+				if pending > 0 || launchNext() {
+					continue
+				}
+			}
+			if r := results[callCmd]; r.Kind() == reflect.Ptr && !r.IsNil() && r.Interface() != result {
+				reflect.ValueOf(result).Elem().Set(r.Elem())
+			}
+			return &hedgedCallCmd{CallCmd: callCmd, result: result}
+		case <-timer.C:
+			if launchNext() {
+				timer.Reset(policy.Delay)
+			}
+		}
+	}
+}
+
+// Reply returns the call reply.
+func (c *hedgedCallCmd) Reply() (interface{}, *Status) {
+	_, stat := c.CallCmd.Reply()
+	return c.result, stat
+}
+
+// Then registers the continuation called in a new goroutine.
+func (c *hedgedCallCmd) Then(fn func(CallCmd)) {
+	go fn(c)
+}
+
+// isHedgeAttempt reports whether the context is of the call sent by HedgeCall,
+// which is canceled once another attempt wins.
+func isHedgeAttempt(ctx context.Context) bool {
+	b, _ := ctx.Value(hedgeAttempt{}).(bool)
+	return b
+}
@@ -0,0 +1,109 @@
+package erpc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type hedgingCall struct {
+	CallCtx
+}
+
+// Sleep sleeps only on the server of port 9098.
+func (h *hedgingCall) Sleep(ms *int) (string, *Status) {
+	addr := h.Session().LocalAddr().String()
+	if strings.HasSuffix(addr, ":9098") {
+		time.Sleep(time.Duration(*ms) * time.Millisecond)
+	}
+	return addr, nil
+}
+
+var handlerCanceled = make(chan error, 1)
+
+// Wait waits for the cancellation by the caller.
+func (h *hedgingCall) Wait(*struct{}) (string, *Status) {
+	select {
+	case <-h.Context().Done():
+		handlerCanceled <- h.Context().Err()
+	case <-time.After(time.Second):
+		handlerCanceled <- nil
+	}
+	return "", nil
+}
+
+func TestHedgeCall(t *testing.T) {
+	var sessions []Session
+	cli := NewPeer(PeerConfig{})
+	defer cli.Close()
+	var srvs []Peer
+	for _, port := range []uint16{9098, 9099} {
+		srv := NewPeer(PeerConfig{ListenPort: port})
+		srvs = append(srvs, srv)
+		srv.RouteCall(new(hedgingCall))
+		go srv.ListenAndServe()
+		defer srv.Close()
+	}
+	time.Sleep(200 * time.Millisecond)
+	for _, addr := range []string{":9098", ":9099"} {
+		sess, stat := cli.Dial(addr)
+		if !stat.OK() {
+			t.Fatal(stat)
+		}
+		sessions = append(sessions, sess)
+	}
+	next := func(attempt int) (AsyncCaller, bool) {
+		if attempt >= len(sessions) {
+			return nil, false
+		}
+		return sessions[attempt], true
+	}
+
+	// the context of a normal call does not cancel waiting for the reply
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var result string
+	stat := sessions[0].Call("/hedging_call/sleep", 300, &result, WithContext(ctx)).Status()
+	assert.True(t, stat.OK(), stat)
+
+	// the context is done before the reply
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	stat = sessions[0].AsyncCall("/hedging_call/sleep", 300, &result, nil).Wait(ctx)
+	assert.Equal(t, CodeCallCanceled, stat.Code())
+
+	// the handler is canceled by the caller
+	callCmd := sessions[0].AsyncCall("/hedging_call/wait", nil, &result, nil)
+	time.Sleep(50 * time.Millisecond)
+	callCmd.(CallCanceler).Cancel()
+	<-callCmd.Done()
+	assert.Equal(t, CodeCallCanceled, callCmd.Status().Code())
+	assert.Equal(t, context.Canceled, <-handlerCanceled)
+
+	// the second attempt wins
+	start := time.Now()
+	callCmd = HedgeCall(next, "/hedging_call/sleep", 300, &result, WithHedging(50*time.Millisecond, 2))
+	assert.True(t, callCmd.StatusOK(), callCmd.Status())
+	assert.Less(t, int64(time.Since(start)), int64(250*time.Millisecond))
+	reply, _ := callCmd.Reply()
+	assert.Equal(t, &result, reply)
+	assert.True(t, strings.HasSuffix(result, ":9099"), result)
+
+	// no hedging
+	callCmd = HedgeCall(next, "/hedging_call/sleep", 10, &result)
+	assert.True(t, callCmd.StatusOK(), callCmd.Status())
+
+	// the cancel functions of the handlers are released
+	time.Sleep(400 * time.Millisecond)
+	for _, srv := range srvs {
+		srv.RangeSession(func(sess Session) bool {
+			n := 0
+			sess.(*session).handlerCancels.Range(func(_, _ interface{}) bool { n++; return true })
+			assert.Equal(t, 0, n)
+			return true
+		})
+	}
+}
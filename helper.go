@@ -21,9 +21,11 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
 	"math/big"
 	"net"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -163,12 +165,30 @@ func (f *fakeCallCmd) InputMeta() *utils.Args {
 	return f.inputMeta
 }
 
+// TrailerMeta returns the trailer metadata of input message, the shared empty value.
+func (f *fakeCallCmd) TrailerMeta() *utils.Args {
+	return emptyTrailer
+}
+
+// OnProgress does nothing, the fake call has no progress.
+func (f *fakeCallCmd) OnProgress(ProgressFunc) {}
+
 // CostTime returns the called cost time.
 // If PeerConfig.CountTime=false, always returns 0.
 func (f *fakeCallCmd) CostTime() time.Duration {
 	return 0
 }
 
+// Then registers the continuation called in a new goroutine.
+func (f *fakeCallCmd) Then(fn func(CallCmd)) {
+	go fn(f)
+}
+
+// Wait returns the call status.
+func (f *fakeCallCmd) Wait(context.Context) *Status {
+	return f.stat
+}
+
 // NewTLSConfigFromFile creates a new TLS config.
 func NewTLSConfigFromFile(tlsCertFile, tlsKeyFile string, insecureSkipVerifyForClient ...bool) (*tls.Config, error) {
 	cert, err := tls.LoadX509KeyPair(tlsCertFile, tlsKeyFile)
@@ -335,3 +355,32 @@ func (f *FakeAddr) Host() string {
 func (f *FakeAddr) Port() string {
 	return f.port
 }
+
+// ParseCIDRs parses the CIDR list, the single IP such as "10.0.0.1" is also accepted,
+// and the blank items are skipped.
+func ParseCIDRs(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", s)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// The policies of the idle session, see PeerConfig.IdleMode.
+const (
+	// IdleClose emits EventSessionIdle and closes the session
+	IdleClose = "close"
+	// IdleEvent only emits EventSessionIdle
+	IdleEvent = "event"
+)
+
+// maxIdleCheck the max interval of checking the idle sessions
+const maxIdleCheck = time.Second
+
+// idleMonitor checks the last read and write times of the sessions periodically,
+// and applies the policy to the sessions idle beyond PeerConfig.MaxIdleDuration.
+type idleMonitor struct {
+	peer     *peer
+	maxIdle  time.Duration
+	mode     string
+	interval time.Duration
+}
+
+// newIdleMonitor returns nil if the detection is disabled.
+func newIdleMonitor(p *peer, cfg *PeerConfig) *idleMonitor {
+	if cfg.MaxIdleDuration <= 0 {
+		return nil
+	}
+	m := &idleMonitor{
+		peer:     p,
+		maxIdle:  cfg.MaxIdleDuration,
+		mode:     cfg.IdleMode,
+		interval: cfg.MaxIdleDuration / 4,
+	}
+	if m.interval > maxIdleCheck {
+		m.interval = maxIdleCheck
+	}
+	return m
+}
+
+func (m *idleMonitor) start() {
+	m.peer.clock.AfterFunc(m.interval, m.check)
+}
+
+func (m *idleMonitor) check() {
+	select {
+	case <-m.peer.closeCh:
+		return
+	default:
+	}
+	now := m.peer.clock.Now()
+	m.peer.sessHub.rangeCallback(func(sess *session) bool {
+		m.checkSession(sess, now)
+		return true
+	})
+	m.start()
+}
+
+// checkSession applies the policy once when the session has been idle for the max idle duration,
+// and resets the detection after any message is read or written.
+// NOTE:
+//  The session with the pending calls or the active handlers is not idle, e.g. waiting for a slow handler;
+//  The idleApplied field of the session is only accessed here.
+func (m *idleMonitor) checkSession(sess *session, now time.Time) {
+	idle := now.Sub(sess.lastActive())
+	if idle < m.maxIdle || sess.callCmdMap.Len() > 0 || atomic.LoadInt64(&sess.stats.activeHandlers) > 0 {
+		sess.idleApplied = false
+		return
+	}
+	if sess.idleApplied {
+		return
+	}
+	sess.idleApplied = true
+	err := fmt.Errorf("idle for %v exceeds %v", idle, m.maxIdle)
+	Infof("idle session: session(%s) %s, %s", sess.ID(), sess.RemoteAddr().String(), err)
+	e := m.peer.sessionEvent(EventSessionIdle, sess)
+	e.Err = err
+	m.peer.events.emit(e)
+	if m.mode == IdleClose {
+		go sess.Close()
+	}
+}
+
+// markActive records the time of the message read or written by the peer clock.
+func (s *session) markActive(sent bool) {
+	now := s.peer.clock.Now().UnixNano()
+	if sent {
+		atomic.StoreInt64(&s.lastWrite, now)
+	} else {
+		atomic.StoreInt64(&s.lastRead, now)
+	}
+}
+
+// lastActive returns the later one of the last read and write times.
+func (s *session) lastActive() time.Time {
+	r, w := atomic.LoadInt64(&s.lastRead), atomic.LoadInt64(&s.lastWrite)
+	if w > r {
+		r = w
+	}
+	return time.Unix(0, r)
+}
+
+// LastRead returns the time of the last message read by the session, or of the start of the reading.
+func (s *session) LastRead() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&s.lastRead))
+}
+
+// LastWrite returns the time of the last message written by the session, or of the creation of the session.
+func (s *session) LastWrite() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&s.lastWrite))
+}
@@ -0,0 +1,124 @@
+package erpc_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/erpctest"
+)
+
+func TestMaxIdleDuration(t *testing.T) {
+	clock := erpctest.NewClock(time.Now())
+	srv := erpc.NewPeer(erpc.PeerConfig{MaxIdleDuration: time.Minute, Clock: clock})
+	defer srv.Close()
+	events := srv.Events()
+	release := make(chan struct{})
+	srv.RouteCallFunc(func(ctx erpc.CallCtx, arg *string) (string, *erpc.Status) {
+		if *arg == "slow" {
+			<-release
+		}
+		return *arg, nil
+	})
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := erpc.ConnectPipe(srv, cli)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	advance := func(d time.Duration) {
+		clock.Advance(d)
+		if !clock.WaitTimers(1, time.Second) {
+			t.Fatal("the idle check is not rearmed")
+		}
+	}
+	expectIdle := func(expect bool) {
+		for {
+			select {
+			case e := <-events:
+				if e.Type != erpc.EventSessionIdle {
+					continue
+				}
+				if !expect {
+					t.Fatalf("unexpected idle event: %v", e.Err)
+				}
+				return
+			case <-time.After(100 * time.Millisecond):
+				if expect {
+					t.Fatal("expect the idle event")
+				}
+				return
+			}
+		}
+	}
+	if !clock.WaitTimers(1, time.Second) {
+		t.Fatal("the idle check is not armed")
+	}
+
+	advance(50 * time.Second)
+	var reply string
+	if stat = sess.Call("/func1", "hello", &reply).Status(); !stat.OK() {
+		t.Fatal(stat)
+	}
+	var srvSess erpc.Session
+	srv.RangeSession(func(s erpc.Session) bool {
+		srvSess = s
+		return false
+	})
+	if !srvSess.LastRead().Equal(clock.Now()) || !srvSess.LastWrite().Equal(clock.Now()) {
+		t.Fatalf("last read: %v, last write: %v, now: %v", srvSess.LastRead(), srvSess.LastWrite(), clock.Now())
+	}
+	advance(50 * time.Second)
+	expectIdle(false)
+
+	// the session waiting for the slow handler is not idle
+	cmd := sess.AsyncCall("/func1", "slow", &reply, make(chan erpc.CallCmd, 1))
+	time.Sleep(50 * time.Millisecond)
+	advance(2 * time.Minute)
+	expectIdle(false)
+	close(release)
+	<-cmd.Done()
+	if !cmd.Status().OK() || srv.CountSession() != 1 {
+		t.Fatalf("stat: %v, sessions: %d", cmd.Status(), srv.CountSession())
+	}
+	// the handler is still active until the reply is written
+	for i := 0; srvSess.Stats().ActiveHandlers > 0; i++ {
+		if i == 100 {
+			t.Fatal("the handler is still active")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	advance(2 * time.Minute)
+	expectIdle(true)
+	select {
+	case <-srvSess.CloseNotify():
+	case <-time.After(time.Second):
+		t.Fatal("expect the idle session closed")
+	}
+}
+
+func TestIdleModeEvent(t *testing.T) {
+	clock := erpctest.NewClock(time.Now())
+	srv := erpc.NewPeer(erpc.PeerConfig{MaxIdleDuration: time.Minute, IdleMode: erpc.IdleEvent, Clock: clock})
+	defer srv.Close()
+	events := srv.Events()
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	if _, stat := erpc.ConnectPipe(srv, cli); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if !clock.WaitTimers(1, time.Second) {
+		t.Fatal("the idle check is not armed")
+	}
+	clock.Advance(2 * time.Minute)
+	for e := range events {
+		if e.Type == erpc.EventSessionIdle {
+			break
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if srv.CountSession() != 1 {
+		t.Fatal("expect the idle session kept by the event mode")
+	}
+}
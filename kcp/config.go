@@ -0,0 +1,66 @@
+package kcp
+
+import (
+	"crypto/sha256"
+
+	kcp "github.com/xtaci/kcp-go/v5"
+)
+
+// Config the tuning parameters of the KCP sessions.
+// NOTE: The zero value of each field keeps the default of kcp-go, i.e. no FEC and no encryption.
+type Config struct {
+	// NoDelay is enable the nodelay mode or not, which lowers the minimum RTO
+	NoDelay bool
+	// Interval the internal update interval in milliseconds, in [10,5000], default 100
+	Interval int
+	// Resend the number of the ACK skips triggering the fast retransmission, default 0 means disabled
+	Resend int
+	// NoCongestion is disable the congestion control or not
+	NoCongestion bool
+	// SndWnd the send window size in packets, default 32
+	SndWnd int
+	// RcvWnd the receive window size in packets, default 32
+	RcvWnd int
+	// MTU the maximum transmission unit, default 1400
+	MTU int
+	// DataShards the number of the data shards of the FEC, 0 means no FEC
+	DataShards int
+	// ParityShards the number of the parity shards of the FEC
+	ParityShards int
+	// Key the pre-shared key of the AES encryption of the packets, derived to 256 bits by sha256; empty means no encryption
+	Key string
+}
+
+// blockCrypt returns the AES block crypt of the key, or nil if no key.
+func (c *Config) blockCrypt() (kcp.BlockCrypt, error) {
+	if c.Key == "" {
+		return nil, nil
+	}
+	key := sha256.Sum256([]byte(c.Key))
+	return kcp.NewAESBlockCrypt(key[:])
+}
+
+// apply sets the tuning parameters to the session.
+func (c *Config) apply(sess *kcp.UDPSession) {
+	nodelay, interval, nc := -1, -1, -1
+	if c.NoDelay {
+		nodelay = 1
+	}
+	if c.Interval > 0 {
+		interval = c.Interval
+	}
+	if c.NoCongestion {
+		nc = 1
+	}
+	resend := -1
+	if c.Resend > 0 {
+		resend = c.Resend
+	}
+	sess.SetNoDelay(nodelay, interval, resend, nc)
+	if c.SndWnd > 0 || c.RcvWnd > 0 {
+		sess.SetWindowSize(c.SndWnd, c.RcvWnd)
+	}
+	if c.MTU > 0 {
+		sess.SetMtu(c.MTU)
+	}
+}
@@ -16,11 +16,18 @@ import (
 // It returns an inherited net.Listener for the matching network and address, or
 // creates a new one using net.Listen.
 func InheritedListen(network, laddr string, tlsConf *tls.Config, dataShards, parityShards int) (net.Listener, error) {
+	return InheritedListenConfig(network, laddr, tlsConf, Config{DataShards: dataShards, ParityShards: parityShards})
+}
+
+// InheritedListenConfig announces on the local network address laddr with the tuning parameters of the sessions.
+// It returns an inherited net.Listener for the matching network and address, or
+// creates a new one using net.Listen.
+func InheritedListenConfig(network, laddr string, tlsConf *tls.Config, cfg Config) (net.Listener, error) {
 	udpAddr, err := net.ResolveUDPAddr(network, laddr)
 	if err != nil {
 		return nil, err
 	}
-	return globalInheritKCP.InheritedListen(network, udpAddr, tlsConf, dataShards, parityShards)
+	return globalInheritKCP.InheritedListen(network, udpAddr, tlsConf, cfg)
 }
 
 // SetInherited adds the files and envs to be inherited by the new process.
@@ -100,7 +107,7 @@ func (n *inheritKCP) inherit() error {
 // InheritedListen announces on the local network address laddr.
 // It returns an inherited net.Listener for the matching address,
 // or creates a new one.
-func (n *inheritKCP) InheritedListen(network string, udpAddr *net.UDPAddr, tlsConf *tls.Config, dataShards, parityShards int) (*Listener, error) {
+func (n *inheritKCP) InheritedListen(network string, udpAddr *net.UDPAddr, tlsConf *tls.Config, cfg Config) (*Listener, error) {
 	if err := n.inherit(); err != nil {
 		return nil, err
 	}
@@ -125,9 +132,9 @@ func (n *inheritKCP) InheritedListen(network string, udpAddr *net.UDPAddr, tlsCo
 	var l *Listener
 	var err error
 	if udpConn == nil {
-		l, err = ListenUDPAddr(network, udpAddr, tlsConf, dataShards, parityShards)
+		l, err = ListenUDPAddrConfig(network, udpAddr, tlsConf, cfg)
 	} else {
-		l, err = Listen(udpConn, tlsConf, dataShards, parityShards)
+		l, err = ListenConfig(udpConn, tlsConf, cfg)
 	}
 	if err != nil {
 		return nil, err
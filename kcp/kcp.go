@@ -16,6 +16,17 @@ type (
 // It uses a new UDP connection and closes this connection when the KCP session is closed.
 // The hostname for SNI is taken from the given address.
 func DialAddrContext(network string, laddr *net.UDPAddr, raddr string, tlsConf *tls.Config, dataShards, parityShards int) (net.Conn, error) {
+	return DialAddrConfig(network, laddr, raddr, tlsConf, Config{DataShards: dataShards, ParityShards: parityShards})
+}
+
+// DialAddrConfig establishes a new KCP connection to a server with the tuning parameters.
+// It uses a new UDP connection and closes this connection when the KCP session is closed.
+// The hostname for SNI is taken from the given address.
+func DialAddrConfig(network string, laddr *net.UDPAddr, raddr string, tlsConf *tls.Config, cfg Config) (net.Conn, error) {
+	block, err := cfg.blockCrypt()
+	if err != nil {
+		return nil, err
+	}
 	host, port, err := net.SplitHostPort(raddr)
 	if err != nil {
 		return nil, err
@@ -31,10 +42,12 @@ func DialAddrContext(network string, laddr *net.UDPAddr, raddr string, tlsConf *
 	if err != nil {
 		return nil, err
 	}
-	conn, err := kcp.NewConn2(addr, nil, dataShards, parityShards, udpConn)
+	conn, err := kcp.NewConn2(addr, block, cfg.DataShards, cfg.ParityShards, udpConn)
 	if err != nil {
+		udpConn.Close()
 		return nil, err
 	}
+	cfg.apply(conn)
 	if tlsConf != nil {
 		return tls.Client(conn, tlsConf), nil
 	}
@@ -46,16 +59,18 @@ type Listener struct {
 	*kcp.Listener
 	tlsConf *tls.Config
 	conn    net.PacketConn
+	cfg     Config
 }
 
 var _ net.Listener = (*Listener)(nil)
 
 // Accept implements the Accept method in the Listener interface; it waits for the next call and returns a generic Conn.
 func (l *Listener) Accept() (net.Conn, error) {
-	conn, err := l.Listener.Accept()
+	conn, err := l.Listener.AcceptKCP()
 	if err != nil {
 		return nil, err
 	}
+	l.cfg.apply(conn)
 	if l.tlsConf == nil {
 		return conn, nil
 	}
@@ -78,19 +93,37 @@ func ListenAddr(network, addr string, tlsConf *tls.Config, dataShards, paritySha
 
 // ListenUDPAddr announces on the local network address udpAddr.
 func ListenUDPAddr(network string, udpAddr *net.UDPAddr, tlsConf *tls.Config, dataShards, parityShards int) (*Listener, error) {
+	return ListenUDPAddrConfig(network, udpAddr, tlsConf, Config{DataShards: dataShards, ParityShards: parityShards})
+}
+
+// ListenUDPAddrConfig announces on the local network address udpAddr with the tuning parameters of the sessions.
+func ListenUDPAddrConfig(network string, udpAddr *net.UDPAddr, tlsConf *tls.Config, cfg Config) (*Listener, error) {
 	var conn net.PacketConn
 	conn, err := net.ListenUDP(network, udpAddr)
 	if err != nil {
 		return nil, err
 	}
-	return Listen(conn, tlsConf, dataShards, parityShards)
+	lis, err := ListenConfig(conn, tlsConf, cfg)
+	if err != nil {
+		conn.Close()
+	}
+	return lis, err
 }
 
 // Listen listens for KCP connections on a given net.PacketConn.
 func Listen(conn net.PacketConn, tlsConf *tls.Config, dataShards, parityShards int) (*Listener, error) {
-	lis, err := kcp.ServeConn(nil, dataShards, parityShards, conn)
+	return ListenConfig(conn, tlsConf, Config{DataShards: dataShards, ParityShards: parityShards})
+}
+
+// ListenConfig listens for KCP connections on a given net.PacketConn with the tuning parameters of the sessions.
+func ListenConfig(conn net.PacketConn, tlsConf *tls.Config, cfg Config) (*Listener, error) {
+	block, err := cfg.blockCrypt()
+	if err != nil {
+		return nil, err
+	}
+	lis, err := kcp.ServeConn(block, cfg.DataShards, cfg.ParityShards, conn)
 	if err != nil {
 		return nil, err
 	}
-	return &Listener{Listener: lis, tlsConf: tlsConf, conn: conn}, nil
+	return &Listener{Listener: lis, tlsConf: tlsConf, conn: conn, cfg: cfg}, nil
 }
@@ -0,0 +1,55 @@
+package erpc
+
+import (
+	"testing"
+	"time"
+)
+
+func kcp_echo(ctx CallCtx, arg *string) (string, *Status) {
+	return *arg, nil
+}
+
+func TestKCPConfig(t *testing.T) {
+	srv := NewPeer(PeerConfig{
+		Network:         "kcp",
+		ListenPort:      9123,
+		KCPNoDelay:      true,
+		KCPInterval:     10,
+		KCPResend:       2,
+		KCPNoCongestion: true,
+		KCPSndWnd:       256,
+		KCPRcvWnd:       256,
+		KCPDataShards:   -1,
+		KCPKey:          "secret",
+	})
+	defer srv.Close()
+	srv.RouteCallFunc(kcp_echo)
+	go srv.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := NewPeer(PeerConfig{Network: "kcp", KCPNoDelay: true, KCPInterval: 10, KCPDataShards: -1, KCPKey: "secret"})
+	defer cli.Close()
+	sess, stat := cli.Dial(":9123")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var reply string
+	if stat = sess.Call("/kcp/echo", "hello", &reply).Status(); !stat.OK() || reply != "hello" {
+		t.Fatalf("reply: %q, stat: %v", reply, stat)
+	}
+
+	// the packets of the wrong key are dropped
+	wrong := NewPeer(PeerConfig{Network: "kcp", KCPDataShards: -1, KCPKey: "wrong"})
+	defer wrong.Close()
+	sess, stat = wrong.Dial(":9123")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	cmd := sess.AsyncCall("/kcp/echo", "hello", &reply, make(chan CallCmd, 1))
+	select {
+	case <-cmd.Done():
+		t.Fatalf("expect the call of the wrong key dropped, got %v", cmd.Status())
+	case <-time.After(500 * time.Millisecond):
+		cmd.(CallCanceler).Cancel()
+	}
+}
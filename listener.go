@@ -22,12 +22,20 @@ import (
 	"github.com/andeya/erpc/v7/kcp"
 	"github.com/andeya/erpc/v7/quic"
 	"github.com/andeya/goutil/graceful/inherit_net"
+	quicgo "github.com/lucas-clemente/quic-go"
 )
 
 var testTLSConfig = GenerateTLSConfigForServer()
 
 // NewInheritedListener creates a inherited listener.
 func NewInheritedListener(addr net.Addr, tlsConfig *tls.Config) (lis net.Listener, err error) {
+	return newInheritedListener(addr, tlsConfig, defaultKCPConfig, nil, false)
+}
+
+// defaultKCPConfig the KCP config of NewInheritedListener
+var defaultKCPConfig = kcp.Config{DataShards: kcpDataShards, ParityShards: kcpParityShards}
+
+func newInheritedListener(addr net.Addr, tlsConfig *tls.Config, kcpConfig kcp.Config, quicConfig *quicgo.Config, quicEarly bool) (lis net.Listener, err error) {
 	laddr := addr.String()
 	network := addr.Network()
 	var host, port string
@@ -49,10 +57,14 @@ func NewInheritedListener(addr net.Addr, tlsConfig *tls.Config) (lis net.Listene
 		if tlsConfig == nil {
 			tlsConfig = testTLSConfig
 		}
-		lis, err = quic.InheritedListen(_network, laddr, tlsConfig, nil)
+		if quicEarly {
+			lis, err = quic.InheritedListenEarly(_network, laddr, tlsConfig, quicConfig)
+		} else {
+			lis, err = quic.InheritedListen(_network, laddr, tlsConfig, quicConfig)
+		}
 
 	} else if _network := asKCP(network); _network != "" {
-		lis, err = kcp.InheritedListen(_network, laddr, tlsConfig, dataShards, parityShards)
+		lis, err = kcp.InheritedListenConfig(_network, laddr, tlsConfig, kcpConfig)
 
 	} else {
 		lis, err = inherit_net.Listen(network, laddr)
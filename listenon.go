@@ -0,0 +1,129 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+
+	"github.com/andeya/erpc/v7/kcp"
+	"github.com/andeya/erpc/v7/quic"
+)
+
+var errListenOnServing = errors.New("ListenOn must be called before ListenAndServe")
+
+// ListenOn adds a listening address served by ListenAndServe, besides the configured one.
+// NOTE:
+//  The network is one of tcp, tcp4, tcp6, unix, unixpacket, kcp or quic,
+//  and the address of unix and unixpacket is the socket file path;
+//  All the listeners share the router, plugins and TLS config of the peer;
+//  The PROXY protocol is only read on the tcp and unix listeners;
+//  It must be called before ListenAndServe.
+func (p *peer) ListenOn(network, addr string) error {
+	var laddr net.Addr
+	switch network {
+	case "tcp", "tcp4", "tcp6", "kcp", "quic":
+		a, err := NewFakeAddr2(network, addr)
+		if err != nil {
+			return err
+		}
+		laddr = a
+	case "unix", "unixpacket":
+		if addr == "" {
+			return errors.New("ListenOn: empty socket file path")
+		}
+		laddr = &FakeAddr{network: network, addr: addr, host: addr}
+	default:
+		return errors.New("ListenOn: invalid network " + network + ", refer to the following: tcp, tcp4, tcp6, unix, unixpacket, kcp or quic")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.serving {
+		return errListenOnServing
+	}
+	p.extraListenAddrs = append(p.extraListenAddrs, laddr)
+	return nil
+}
+
+// listen listens on the address, and wraps the listener by wrapListener.
+func (p *peer) listen(addr net.Addr) (net.Listener, error) {
+	if p.proxyTrusted == nil || asQUIC(addr.Network()) != "" || asKCP(addr.Network()) != "" {
+		return newInheritedListener(addr, p.withALPN(p.tlsConfig), p.kcpConfig, p.quicConfig, p.quicEarly)
+	}
+	lis, err := NewInheritedListener(addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	return p.wrapListener(lis)
+}
+
+// wrapListener reads the PROXY header before the TLS handshake if the PROXY protocol is enabled,
+// and serves TLS if the TLS config is set.
+// NOTE: The kcp and quic listeners are returned as is.
+func (p *peer) wrapListener(lis net.Listener) (net.Listener, error) {
+	switch lis.(type) {
+	case *quic.Listener, *kcp.Listener:
+		return lis, nil
+	}
+	if p.proxyTrusted != nil {
+		var err error
+		if lis, err = NewProxyProtoListener(lis, p.proxyTrusted...); err != nil {
+			return nil, err
+		}
+	}
+	if p.tlsConfig != nil {
+		lis = tls.NewListener(lis, p.withALPN(p.tlsConfig))
+	}
+	return lis, nil
+}
+
+// ServeListener serves the listener created externally,
+// e.g. the socket activated by systemd (see SystemdListeners) or passed by the parent process,
+// sharing the router and plugins of the peer.
+// NOTE:
+//  The listener must not serve TLS or the PROXY protocol itself,
+//  they are applied by the TLS config and PeerConfig.ProxyProtocol of the peer;
+//  The listener is closed when the peer is closed;
+//  It blocks until the listener is stopped, and can be called for multiple listeners concurrently.
+func (p *peer) ServeListener(lis net.Listener, protoFunc ...ProtoFunc) error {
+	lis, err := p.wrapListener(lis)
+	if err != nil {
+		return err
+	}
+	return p.serveListener(lis, protoFunc...)
+}
+
+// serveListeners serves the listeners concurrently,
+// and returns the first error after all of them are stopped.
+func (p *peer) serveListeners(lises []net.Listener, protoFunc ...ProtoFunc) error {
+	if len(lises) == 1 {
+		return p.serveListener(lises[0], protoFunc...)
+	}
+	errCh := make(chan error, len(lises))
+	for _, lis := range lises {
+		lis := lis
+		go func() {
+			errCh <- p.serveListener(lis, protoFunc...)
+		}()
+	}
+	var err error
+	for range lises {
+		if e := <-errCh; err == nil {
+			err = e
+		}
+	}
+	return err
+}
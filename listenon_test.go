@@ -0,0 +1,88 @@
+package erpc_test
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListenOn(t *testing.T) {
+	sockFile := filepath.Join(t.TempDir(), "erpc.sock")
+	srv := erpc.NewPeer(erpc.PeerConfig{ListenPort: 9116})
+	srv.RouteCallFunc(batch_call)
+	if err := srv.ListenOn("tcp", "127.0.0.1:9117"); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.ListenOn("unix", sockFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.ListenOn("sctp", ":9118"); err == nil {
+		t.Fatal("invalid network: expect error!")
+	}
+	go srv.ListenAndServe()
+	defer srv.Close()
+	time.Sleep(200 * time.Millisecond)
+	if err := srv.ListenOn("tcp", ":9118"); err == nil {
+		t.Fatal("ListenOn after ListenAndServe: expect error!")
+	}
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	for _, addr := range []struct{ network, addr string }{
+		{"tcp", "127.0.0.1:9116"},
+		{"tcp", "127.0.0.1:9117"},
+		{"unix", sockFile},
+	} {
+		conn, err := net.Dial(addr.network, addr.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sess, stat := cli.ServeConn(conn)
+		if !stat.OK() {
+			t.Fatal(stat)
+		}
+		var result int
+		if stat = sess.Call("/batch/call", 1, &result).Status(); !stat.OK() || result != 2 {
+			t.Fatalf("%s %s: result: %d, stat: %v", addr.network, addr.addr, result, stat)
+		}
+	}
+}
+
+func TestServeListener(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{})
+	srv.RouteCallFunc(batch_call)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.ServeListener(lis) }()
+	time.Sleep(100 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var result int
+	if stat = sess.Call("/batch/call", 1, &result).Status(); !stat.OK() || result != 2 {
+		t.Fatalf("result: %d, stat: %v", result, stat)
+	}
+	srv.Close()
+	select {
+	case err = <-errCh:
+		if err != erpc.ErrListenClosed {
+			t.Fatalf("expect ErrListenClosed, got %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("the listener is not stopped")
+	}
+
+	// not activated by systemd
+	listeners, _, err := erpc.SystemdListeners()
+	if err != nil || listeners != nil {
+		t.Fatalf("listeners: %v, err: %v", listeners, err)
+	}
+}
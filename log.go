@@ -21,6 +21,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/andeya/goutil/graceful"
@@ -91,7 +92,7 @@ var loggerLevelMap = map[LoggerLevel]string{
 	TRACE:    "TRACE",
 }
 
-var loggerLevel = DEBUG
+var loggerLevel = int32(DEBUG) // atomic, can be changed at runtime
 
 func (l LoggerLevel) String() string {
 	s, ok := loggerLevelMap[l]
@@ -195,7 +196,7 @@ func SetLoggerOutputter(outputter LoggerOutputter) (flusher func() error) {
 func SetLoggerLevel(level string) (flusher func() error) {
 	for k, v := range loggerLevelMap {
 		if v == level {
-			loggerLevel = k
+			atomic.StoreInt32(&loggerLevel, int32(k))
 			return FlushLogger
 		}
 	}
@@ -203,6 +204,16 @@ func SetLoggerLevel(level string) (flusher func() error) {
 	return FlushLogger
 }
 
+// parseLoggerLevel returns the level of the case-insensitive string.
+func parseLoggerLevel(level string) (LoggerLevel, bool) {
+	for k, v := range loggerLevelMap {
+		if strings.EqualFold(v, level) {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
 // SetLoggerLevel2 sets the logger's level by number.
 func SetLoggerLevel2(level LoggerLevel) (flusher func() error) {
 	_, ok := loggerLevelMap[level]
@@ -210,18 +221,18 @@ func SetLoggerLevel2(level LoggerLevel) (flusher func() error) {
 		log.Printf("Unknown level number: %d", level)
 		return FlushLogger
 	}
-	loggerLevel = level
+	atomic.StoreInt32(&loggerLevel, int32(level))
 	return FlushLogger
 }
 
 // GetLoggerLevel gets the logger's level.
 func GetLoggerLevel() LoggerLevel {
-	return loggerLevel
+	return LoggerLevel(atomic.LoadInt32(&loggerLevel))
 }
 
 // EnableLoggerLevel returns if can print the level of log.
 func EnableLoggerLevel(level LoggerLevel) bool {
-	if level <= loggerLevel {
+	if level <= GetLoggerLevel() {
 		return level != OFF
 	}
 	return false
@@ -239,6 +250,14 @@ func loggerOutput(loggerLevel LoggerLevel, format string, a ...interface{}) {
 	loggerOutputter.Output(3, goutil.StringToBytes(fmt.Sprintf(format, a...)), loggerLevel)
 }
 
+// loggerOutputDepth is loggerOutput with the calldepth, for the wrapped callers.
+func loggerOutputDepth(calldepth int, loggerLevel LoggerLevel, format string, a ...interface{}) {
+	if !EnableLoggerLevel(loggerLevel) {
+		return
+	}
+	loggerOutputter.Output(calldepth, goutil.StringToBytes(fmt.Sprintf(format, a...)), loggerLevel)
+}
+
 // ************ global logger functions ************
 
 // Printf formats according to a format specifier and writes to standard output.
@@ -370,11 +389,15 @@ func (globalLogger) Tracef(format string, a ...interface{}) {
 // Printf formats according to a format specifier and writes to standard output.
 // It returns the number of bytes written and any write error encountered.
 func (s *session) Printf(format string, a ...interface{}) {
-	loggerOutput(PRINT, format, a...)
+	s.peer.logf(PRINT, format, a...)
 }
 
 // Fatalf is equivalent to l.Criticalf followed by a call to os.Exit(1).
 func (s *session) Fatalf(format string, a ...interface{}) {
+	if l := s.peer.logger; l != nil {
+		l.Fatalf(format, a...)
+		return
+	}
 	loggerOutput(CRITICAL, format, a...)
 	loggerOutputter.Flush()
 	os.Exit(1)
@@ -382,6 +405,10 @@ func (s *session) Fatalf(format string, a ...interface{}) {
 
 // Panicf is equivalent to l.Criticalf followed by a call to panic().
 func (s *session) Panicf(format string, a ...interface{}) {
+	if l := s.peer.logger; l != nil {
+		l.Panicf(format, a...)
+		return
+	}
 	loggerOutput(CRITICAL, format, a...)
 	loggerOutputter.Flush()
 	panic(fmt.Sprintf(format, a...))
@@ -389,37 +416,37 @@ func (s *session) Panicf(format string, a ...interface{}) {
 
 // Criticalf logs a message using CRITICAL as log level.
 func (s *session) Criticalf(format string, a ...interface{}) {
-	loggerOutput(CRITICAL, format, a...)
+	s.peer.logf(CRITICAL, format, a...)
 }
 
 // Errorf logs a message using ERROR as log level.
 func (s *session) Errorf(format string, a ...interface{}) {
-	loggerOutput(ERROR, format, a...)
+	s.peer.logf(ERROR, format, a...)
 }
 
 // Warnf logs a message using WARNING as log level.
 func (s *session) Warnf(format string, a ...interface{}) {
-	loggerOutput(WARNING, format, a...)
+	s.peer.logf(WARNING, format, a...)
 }
 
 // Noticef logs a message using NOTICE as log level.
 func (s *session) Noticef(format string, a ...interface{}) {
-	loggerOutput(NOTICE, format, a...)
+	s.peer.logf(NOTICE, format, a...)
 }
 
 // Infof logs a message using INFO as log level.
 func (s *session) Infof(format string, a ...interface{}) {
-	loggerOutput(INFO, format, a...)
+	s.peer.logf(INFO, format, a...)
 }
 
 // Debugf logs a message using DEBUG as log level.
 func (s *session) Debugf(format string, a ...interface{}) {
-	loggerOutput(DEBUG, format, a...)
+	s.peer.logf(DEBUG, format, a...)
 }
 
 // Tracef logs a message using TRACE as log level.
 func (s *session) Tracef(format string, a ...interface{}) {
-	loggerOutput(TRACE, format, a...)
+	s.peer.logf(TRACE, format, a...)
 }
 
 // ************ *handlerCtx Pure Logger Methods ************
@@ -427,11 +454,15 @@ func (s *session) Tracef(format string, a ...interface{}) {
 // Printf formats according to a format specifier and writes to standard output.
 // It returns the number of bytes written and any write error encountered.
 func (c *handlerCtx) Printf(format string, a ...interface{}) {
-	loggerOutput(PRINT, format, a...)
+	c.sess.peer.logf(PRINT, format, a...)
 }
 
 // Fatalf is equivalent to l.Criticalf followed by a call to os.Exit(1).
 func (c *handlerCtx) Fatalf(format string, a ...interface{}) {
+	if l := c.sess.peer.logger; l != nil {
+		l.Fatalf(format, a...)
+		return
+	}
 	loggerOutput(CRITICAL, format, a...)
 	loggerOutputter.Flush()
 	os.Exit(1)
@@ -439,6 +470,10 @@ func (c *handlerCtx) Fatalf(format string, a ...interface{}) {
 
 // Panicf is equivalent to l.Criticalf followed by a call to panic().
 func (c *handlerCtx) Panicf(format string, a ...interface{}) {
+	if l := c.sess.peer.logger; l != nil {
+		l.Panicf(format, a...)
+		return
+	}
 	loggerOutput(CRITICAL, format, a...)
 	loggerOutputter.Flush()
 	panic(fmt.Sprintf(format, a...))
@@ -446,37 +481,37 @@ func (c *handlerCtx) Panicf(format string, a ...interface{}) {
 
 // Criticalf logs a message using CRITICAL as log level.
 func (c *handlerCtx) Criticalf(format string, a ...interface{}) {
-	loggerOutput(CRITICAL, format, a...)
+	c.sess.peer.logf(CRITICAL, format, a...)
 }
 
 // Errorf logs a message using ERROR as log level.
 func (c *handlerCtx) Errorf(format string, a ...interface{}) {
-	loggerOutput(ERROR, format, a...)
+	c.sess.peer.logf(ERROR, format, a...)
 }
 
 // Warnf logs a message using WARNING as log level.
 func (c *handlerCtx) Warnf(format string, a ...interface{}) {
-	loggerOutput(WARNING, format, a...)
+	c.sess.peer.logf(WARNING, format, a...)
 }
 
 // Noticef logs a message using NOTICE as log level.
 func (c *handlerCtx) Noticef(format string, a ...interface{}) {
-	loggerOutput(NOTICE, format, a...)
+	c.sess.peer.logf(NOTICE, format, a...)
 }
 
 // Infof logs a message using INFO as log level.
 func (c *handlerCtx) Infof(format string, a ...interface{}) {
-	loggerOutput(INFO, format, a...)
+	c.sess.peer.logf(INFO, format, a...)
 }
 
 // Debugf logs a message using DEBUG as log level.
 func (c *handlerCtx) Debugf(format string, a ...interface{}) {
-	loggerOutput(DEBUG, format, a...)
+	c.sess.peer.logf(DEBUG, format, a...)
 }
 
 // Tracef logs a message using TRACE as log level.
 func (c *handlerCtx) Tracef(format string, a ...interface{}) {
-	loggerOutput(TRACE, format, a...)
+	c.sess.peer.logf(TRACE, format, a...)
 }
 
 // ************ *callCmd Pure Logger Methods ************
@@ -484,11 +519,15 @@ func (c *handlerCtx) Tracef(format string, a ...interface{}) {
 // Printf formats according to a format specifier and writes to standard output.
 // It returns the number of bytes written and any write error encountered.
 func (c *callCmd) Printf(format string, a ...interface{}) {
-	loggerOutput(PRINT, format, a...)
+	c.sess.peer.logf(PRINT, format, a...)
 }
 
 // Fatalf is equivalent to l.Criticalf followed by a call to os.Exit(1).
 func (c *callCmd) Fatalf(format string, a ...interface{}) {
+	if l := c.sess.peer.logger; l != nil {
+		l.Fatalf(format, a...)
+		return
+	}
 	loggerOutput(CRITICAL, format, a...)
 	loggerOutputter.Flush()
 	os.Exit(1)
@@ -496,6 +535,10 @@ func (c *callCmd) Fatalf(format string, a ...interface{}) {
 
 // Panicf is equivalent to l.Criticalf followed by a call to panic().
 func (c *callCmd) Panicf(format string, a ...interface{}) {
+	if l := c.sess.peer.logger; l != nil {
+		l.Panicf(format, a...)
+		return
+	}
 	loggerOutput(CRITICAL, format, a...)
 	loggerOutputter.Flush()
 	panic(fmt.Sprintf(format, a...))
@@ -503,35 +546,35 @@ func (c *callCmd) Panicf(format string, a ...interface{}) {
 
 // Criticalf logs a message using CRITICAL as log level.
 func (c *callCmd) Criticalf(format string, a ...interface{}) {
-	loggerOutput(CRITICAL, format, a...)
+	c.sess.peer.logf(CRITICAL, format, a...)
 }
 
 // Errorf logs a message using ERROR as log level.
 func (c *callCmd) Errorf(format string, a ...interface{}) {
-	loggerOutput(ERROR, format, a...)
+	c.sess.peer.logf(ERROR, format, a...)
 }
 
 // Warnf logs a message using WARNING as log level.
 func (c *callCmd) Warnf(format string, a ...interface{}) {
-	loggerOutput(WARNING, format, a...)
+	c.sess.peer.logf(WARNING, format, a...)
 }
 
 // Noticef logs a message using NOTICE as log level.
 func (c *callCmd) Noticef(format string, a ...interface{}) {
-	loggerOutput(NOTICE, format, a...)
+	c.sess.peer.logf(NOTICE, format, a...)
 }
 
 // Infof logs a message using INFO as log level.
 func (c *callCmd) Infof(format string, a ...interface{}) {
-	loggerOutput(INFO, format, a...)
+	c.sess.peer.logf(INFO, format, a...)
 }
 
 // Debugf logs a message using DEBUG as log level.
 func (c *callCmd) Debugf(format string, a ...interface{}) {
-	loggerOutput(DEBUG, format, a...)
+	c.sess.peer.logf(DEBUG, format, a...)
 }
 
 // Tracef logs a message using TRACE as log level.
 func (c *callCmd) Tracef(format string, a ...interface{}) {
-	loggerOutput(TRACE, format, a...)
+	c.sess.peer.logf(TRACE, format, a...)
 }
@@ -47,6 +47,9 @@ type (
 	Proto = socket.Proto
 	// ProtoFunc function used to create a custom Proto interface.
 	ProtoFunc = socket.ProtoFunc
+	// ExtensionsCarrier the optional interface of the Proto carrying the extensions of the messages,
+	// required by the framework features on the extensions, e.g. the fragmentation and the 64-bit seq.
+	ExtensionsCarrier = socket.ExtensionsCarrier
 	// IOWithReadBuffer implements buffered I/O with buffered reader.
 	IOWithReadBuffer = socket.IOWithReadBuffer
 )
@@ -58,6 +61,8 @@ type (
 	Header = socket.Header
 	// Body message body interface
 	Body = socket.Body
+	// Extensions binary header extensions in TLV(type-length-value) format.
+	Extensions = socket.Extensions
 	// NewBodyFunc creates a new body by header.
 	NewBodyFunc = socket.NewBodyFunc
 	// MessageSetting is a pipe function type for setting message.
@@ -65,10 +70,31 @@ type (
 )
 
 const (
+	// MetaBinarySuffix the suffix of the metadata keys whose values are binary, case-insensitive,
+	// the raw proto sends them without the urlencoding.
+	MetaBinarySuffix = socket.MetaBinarySuffix
 	// MetaRealIP real IP metadata key
 	MetaRealIP = "X-Real-IP"
 	// MetaAcceptBodyCodec the key of body codec that the sender wishes to accept
 	MetaAcceptBodyCodec = "X-Accept-Body-Codec"
+	// MetaCancelSeq the sequence of the canceled call, in the cancellation notice
+	MetaCancelSeq = "X-Cancel-Seq"
+	// CancelServiceMethod the service method of the call cancellation notice,
+	// it is a PUSH handled by the framework.
+	CancelServiceMethod = "/erpc/cancel"
+	// BusyServiceMethod the service method of the busy notice,
+	// it is a PUSH sent before the server rejects the connection.
+	BusyServiceMethod = "/erpc/busy"
+	// BatchServiceMethod the service method of the batch call,
+	// it is a CALL whose body frames the calls of the items, see Session.CallBatch.
+	BatchServiceMethod = "/erpc/batch"
+	// MetaPushAck the key of the PUSH that requests an acknowledgement, see Session.PushReliable
+	MetaPushAck = "X-Push-Ack"
+	// MetaAckSeq the sequence of the acknowledged PUSH, in the acknowledgement
+	MetaAckSeq = "X-Ack-Seq"
+	// AckServiceMethod the service method of the PUSH acknowledgement,
+	// it is a PUSH handled by the framework.
+	AckServiceMethod = "/erpc/ack"
 )
 
 var (
@@ -98,18 +124,16 @@ var (
 	// SUGGEST: max len ≤ 255!
 	//  func WithServiceMethod(serviceMethod string) MessageSetting
 	WithServiceMethod = socket.WithServiceMethod
-	// WithAddMeta adds 'key=value' metadata argument.
-	// Multiple values for the same key may be added.
-	// SUGGEST: urlencoded string max len ≤ 65535!
-	//  func WithAddMeta(key, value string) MessageSetting
-	WithAddMeta = socket.WithAddMeta
-	// WithSetMeta sets 'key=value' metadata argument.
-	// SUGGEST: urlencoded string max len ≤ 65535!
-	//  func WithSetMeta(key, value string) MessageSetting
-	WithSetMeta = socket.WithSetMeta
+	// IsBinaryMeta returns whether the metadata key has the MetaBinarySuffix, e.g. 'token-bin'.
+	//  func IsBinaryMeta(key string) bool
+	IsBinaryMeta = socket.IsBinaryMeta
 	// WithDelMeta deletes metadata argument.
 	//   func WithDelMeta(key string) MessageSetting
 	WithDelMeta = socket.WithDelMeta
+	// WithExtension sets the binary header extension.
+	// NOTE: Panic if the type is 0 or the size of extensions exceeds limit.
+	//  func WithExtension(typ byte, value []byte) MessageSetting
+	WithExtension = socket.WithExtension
 	// WithBodyCodec sets the body codec.
 	//  func WithBodyCodec(bodyCodec byte) MessageSetting
 	WithBodyCodec = socket.WithBodyCodec
@@ -125,6 +149,11 @@ var (
 	// SUGGEST: The length can not be bigger than 255!
 	//  func WithXferPipe(filterID ...byte) MessageSetting
 	WithXferPipe = socket.WithXferPipe
+	// WithAutoCompress sets the threshold of the auto compression of the message,
+	// i.e. the compression filter PeerConfig.CompressFilter is applied only when the encoded body is at least minBytes.
+	// NOTE: If minBytes<=0, never compress it automatically, overriding PeerConfig.AutoCompressBytes.
+	//  func WithAutoCompress(minBytes int) MessageSetting
+	WithAutoCompress = socket.WithAutoCompress
 )
 
 // WithRealIP sets the real IP to metadata.
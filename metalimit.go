@@ -0,0 +1,66 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"fmt"
+
+	"github.com/andeya/erpc/v7/utils"
+)
+
+// statMetaTooLarge the status of the CALL or PUSH whose metadata exceeds the limits, see PeerConfig.MaxMetaCount
+var statMetaTooLarge = NewStatus(CodeMetaTooLarge, CodeText(CodeMetaTooLarge), "")
+
+// metaLimits the limits of the metadata of the CALL and PUSH read, <=0 means no limit.
+type metaLimits struct {
+	count     int
+	keySize   int
+	valueSize int
+}
+
+func newMetaLimits(cfg *PeerConfig) metaLimits {
+	return metaLimits{
+		count:     cfg.MaxMetaCount,
+		keySize:   cfg.MaxMetaKeySize,
+		valueSize: cfg.MaxMetaValueSize,
+	}
+}
+
+// check returns the metadata too large status if the metadata exceeds the limits.
+func (l metaLimits) check(meta *utils.Args) *Status {
+	if l.count > 0 && meta.Len() > l.count {
+		return statMetaTooLarge.Copy(fmt.Sprintf("metadata count %d > %d", meta.Len(), l.count))
+	}
+	if l.keySize <= 0 && l.valueSize <= 0 {
+		return nil
+	}
+	var stat *Status
+	meta.VisitAll(func(key, value []byte) {
+		switch {
+		case stat != nil:
+		case l.keySize > 0 && len(key) > l.keySize:
+			stat = statMetaTooLarge.Copy(fmt.Sprintf("metadata key size %d > %d", len(key), l.keySize))
+		case l.valueSize > 0 && len(value) > l.valueSize:
+			stat = statMetaTooLarge.Copy(fmt.Sprintf("metadata value size %d of %q > %d", len(value), key, l.valueSize))
+		}
+	})
+	return stat
+}
+
+// bindMetaLimits checks the metadata of the received CALL or PUSH before decoding its body.
+func (c *handlerCtx) bindMetaLimits(header Header) bool {
+	c.stat = c.sess.peer.metaLimits.check(header.Meta())
+	return c.stat.OK()
+}
@@ -0,0 +1,68 @@
+package erpc_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+func TestMetaLimits(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{MaxMetaCount: 3, MaxMetaKeySize: 8, MaxMetaValueSize: 16})
+	defer srv.Close()
+	srv.RouteCallFunc(func(ctx erpc.CallCtx, arg *string) (string, *erpc.Status) {
+		return *arg, nil
+	})
+	pushed := make(chan string, 2)
+	srv.RoutePushFunc(func(ctx erpc.PushCtx, arg *string) *erpc.Status {
+		pushed <- *arg
+		return nil
+	})
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := erpc.ConnectPipe(srv, cli)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	call := func(setting ...erpc.MessageSetting) *erpc.Status {
+		var reply string
+		return sess.Call("/func1", "hello", &reply, setting...).Status()
+	}
+
+	if stat = call(erpc.WithSetMeta("a", "1"), erpc.WithSetMeta("b", "2")); !stat.OK() {
+		t.Fatal(stat)
+	}
+	for _, setting := range [][]erpc.MessageSetting{
+		{erpc.WithSetMeta("a", "1"), erpc.WithSetMeta("b", "2"), erpc.WithSetMeta("c", "3"), erpc.WithSetMeta("d", "4")},
+		{erpc.WithSetMeta("long-key-1", "1")},
+		{erpc.WithSetMeta("a", strings.Repeat("v", 17))},
+	} {
+		if stat = call(setting...); stat.Code() != erpc.CodeMetaTooLarge {
+			t.Fatalf("expect the metadata too large, got %v", stat)
+		}
+	}
+
+	// the PUSH exceeding the limits is dropped without executing the handler
+	if stat = sess.Push("/func2", "large", erpc.WithSetMeta("a", strings.Repeat("v", 17))); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if stat = sess.Push("/func2", "small", erpc.WithSetMeta("a", "1")); !stat.OK() {
+		t.Fatal(stat)
+	}
+	select {
+	case arg := <-pushed:
+		if arg != "small" {
+			t.Fatalf("pushed: %q", arg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the PUSH is not handled")
+	}
+
+	if erpc.CodeName(erpc.CodeMetaTooLarge) != "META_TOO_LARGE" ||
+		erpc.CodeToHTTP(erpc.CodeMetaTooLarge) != http.StatusRequestHeaderFieldsTooLarge ||
+		erpc.CodeFromHTTP(http.StatusRequestHeaderFieldsTooLarge) != erpc.CodeMetaTooLarge {
+		t.Fatal("code mappings")
+	}
+}
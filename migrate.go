@@ -0,0 +1,58 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+var statMigrateUnsupported = NewStatus(CodeInvalidOp, CodeText(CodeInvalidOp), "the session can not migrate without redialing, set PeerConfig.RedialTimes")
+
+// Migrate moves the session to the current network path by redialing,
+// e.g. after the mobile client switched from WiFi to cellular,
+// then EventPathChanged is emitted after EventRedialSucceeded.
+// NOTE:
+//  Only for the client role with PeerConfig.RedialTimes!=0;
+//  It closes the connection and returns immediately, the session redials asynchronously;
+//  The calls waiting for the reply are resent by the new connection if PeerConfig.RedialPending, otherwise they fail;
+//  The QUIC connection migration is not supported by the quic-go in use, so the QUIC session migrates by redialing too.
+func (s *session) Migrate() *Status {
+	if s.redialForClientLocked == nil {
+		return statMigrateUnsupported
+	}
+	if !s.checkStatus(statusOk) {
+		return statConnClosed
+	}
+	atomic.StoreInt32(&s.migrating, 1)
+	if conn := s.getConn(); conn != nil {
+		conn.Close()
+	}
+	return nil
+}
+
+// pathChanged returns whether the session is redialed from another local IP or to another remote address,
+// regardless of the local port.
+func pathChanged(oldLocal, oldRemote string, sess *session) bool {
+	if sess.RemoteAddr().String() != oldRemote {
+		return true
+	}
+	oldIP, _, err := net.SplitHostPort(oldLocal)
+	if err != nil {
+		return false
+	}
+	ip, _, err := net.SplitHostPort(sess.LocalAddr().String())
+	return err == nil && ip != oldIP
+}
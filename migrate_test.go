@@ -0,0 +1,90 @@
+package erpc
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var migrateCalls int32
+
+func migrate_slow(ctx CallCtx, arg *string) (string, *Status) {
+	atomic.AddInt32(&migrateCalls, 1)
+	time.Sleep(200 * time.Millisecond)
+	return *arg, nil
+}
+
+func TestMigrate(t *testing.T) {
+	atomic.StoreInt32(&migrateCalls, 0)
+	srv := NewPeer(PeerConfig{ListenPort: 9125})
+	defer srv.Close()
+	srv.RouteCallFunc(migrate_slow)
+	go srv.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := NewPeer(PeerConfig{RedialTimes: 3, RedialPending: true})
+	defer cli.Close()
+	paths := make(chan Event, 1)
+	cli.OnEvent(func(e Event) {
+		if e.Type == EventPathChanged {
+			paths <- e
+		}
+	})
+	sess, stat := cli.Dial(":9125")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	oldPath := sess.LocalAddr().String() + "->" + sess.RemoteAddr().String()
+	var reply string
+	cmd := sess.AsyncCall("/migrate/slow", "pending", &reply, make(chan CallCmd, 1))
+	time.Sleep(50 * time.Millisecond)
+	if stat = sess.Migrate(); !stat.OK() {
+		t.Fatal(stat)
+	}
+	select {
+	case e := <-paths:
+		if e.OldPath != oldPath || e.Session != sess {
+			t.Fatalf("event: %+v, old path: %s", e, oldPath)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no path changed event")
+	}
+	// the pending call is resent by the new connection
+	<-cmd.Done()
+	if stat = cmd.Status(); !stat.OK() || reply != "pending" {
+		t.Fatalf("reply: %q, stat: %v", reply, stat)
+	}
+	if n := atomic.LoadInt32(&migrateCalls); n != 2 {
+		t.Fatalf("calls: %d, expect 2", n)
+	}
+
+	// the pending call fails without RedialPending
+	cli2 := NewPeer(PeerConfig{RedialTimes: 3})
+	defer cli2.Close()
+	sess, stat = cli2.Dial(":9125")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	cmd = sess.AsyncCall("/migrate/slow", "pending", &reply, make(chan CallCmd, 1))
+	time.Sleep(50 * time.Millisecond)
+	sess.Migrate()
+	<-cmd.Done()
+	if stat = cmd.Status(); stat.Code() != CodeConnClosed {
+		t.Fatalf("stat: %v, expect conn closed", stat)
+	}
+	// the session is redialed
+	if stat = sess.Call("/migrate/slow", "redialed", &reply).Status(); !stat.OK() || reply != "redialed" {
+		t.Fatalf("reply: %q, stat: %v", reply, stat)
+	}
+
+	// only with redialing
+	cli3 := NewPeer(PeerConfig{})
+	defer cli3.Close()
+	sess, stat = cli3.Dial(":9125")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	if stat = sess.Migrate(); stat.Code() != CodeInvalidOp {
+		t.Fatalf("stat: %v, expect invalid op", stat)
+	}
+}
@@ -0,0 +1,518 @@
+// Package cluster is an optional cluster layer, where the server peers gossip the sessions they host,
+// so that a PUSH to a session works regardless of which node the client is connected to.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cluster
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	mrand "math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/codec"
+)
+
+// Config the cluster config
+type Config struct {
+	// NodeID the unique id of the node, default random
+	NodeID string
+	// ListenAddr the address listened for the inter-node links, e.g. ":9190"
+	ListenAddr string
+	// AdvertiseAddr the address of the node told to the others, default the listened address
+	AdvertiseAddr string
+	// Seeds the inter-node addresses of some nodes to join the cluster
+	Seeds []string
+	// GossipInterval the interval of gossiping with a random node, default 1s
+	GossipInterval time.Duration
+	// NodeTimeout the node is removed if its state is not updated in the duration, default 10 gossip intervals
+	NodeTimeout time.Duration
+	// TLSConfig the TLS config of the inter-node links, used by both the listener and the dialer, optional
+	TLSConfig *tls.Config
+	// Plugins the plugins of the inter-node peer, e.g. the pair of auth.NewHMACBearerPlugin and
+	// auth.NewHMACCheckerPlugin with the shared key of the cluster, optional
+	Plugins []erpc.Plugin
+}
+
+// NodeState the gossiped state of a node.
+type NodeState struct {
+	ID      string `json:"id"`
+	Addr    string `json:"addr"`
+	Version int64  `json:"version"`
+	// Sessions the hosted session ids and their labels
+	Sessions map[string][]string `json:"sessions"`
+}
+
+type member struct {
+	state *NodeState
+	seen  time.Time
+}
+
+// Cluster the cluster layer of the local server peer.
+type Cluster struct {
+	local    erpc.Peer
+	node     erpc.Peer // for the inter-node links
+	seeds    []string
+	interval time.Duration
+	timeout  time.Duration
+
+	mu      sync.RWMutex
+	self    NodeState
+	members map[string]*member // node id -> member, excluding self
+	labels  map[string][]string
+	links   map[string]erpc.Session // node addr -> link
+
+	closeCh   chan struct{}
+	closeOnce sync.Once
+}
+
+const (
+	gossipServiceMethod  = "/cluster/gossip"
+	forwardServiceMethod = "/cluster/forward"
+)
+
+// clusters the node peer -> *Cluster
+var clusters sync.Map
+
+// New creates the cluster layer of the local server peer, and joins the cluster by the seeds.
+// NOTE:
+//  Any peer reaching Config.ListenAddr can push to any session of the cluster and change its membership,
+//  so the inter-node port must not be exposed without Config.TLSConfig and the authentication Config.Plugins.
+func New(local erpc.Peer, cfg Config) (*Cluster, error) {
+	if cfg.NodeID == "" {
+		cfg.NodeID = newID()
+	}
+	if cfg.GossipInterval <= 0 {
+		cfg.GossipInterval = time.Second
+	}
+	if cfg.NodeTimeout <= 0 {
+		cfg.NodeTimeout = cfg.GossipInterval * 10
+	}
+	lis, err := net.Listen("tcp", cfg.ListenAddr)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AdvertiseAddr == "" {
+		cfg.AdvertiseAddr = lis.Addr().String()
+	}
+	c := &Cluster{
+		local:    local,
+		node:     erpc.NewPeer(erpc.PeerConfig{}, cfg.Plugins...),
+		seeds:    cfg.Seeds,
+		interval: cfg.GossipInterval,
+		timeout:  cfg.NodeTimeout,
+		self: NodeState{
+			ID:      cfg.NodeID,
+			Addr:    cfg.AdvertiseAddr,
+			Version: time.Now().UnixNano(),
+		},
+		members: make(map[string]*member),
+		labels:  make(map[string][]string),
+		links:   make(map[string]erpc.Session),
+		closeCh: make(chan struct{}),
+	}
+	if cfg.TLSConfig != nil {
+		c.node.SetTLSConfig(cfg.TLSConfig)
+	}
+	clusters.Store(c.node, c)
+	group := c.node.SubRoute("/cluster")
+	group.RouteCallFunc((*nodeCall).gossip)
+	group.RouteCallFunc((*nodeCall).forward)
+	go c.node.ServeListener(lis)
+	go c.run()
+	return c, nil
+}
+
+// NodeID returns the id of the local node.
+func (c *Cluster) NodeID() string {
+	return c.self.ID
+}
+
+// Nodes returns the ids of the alive nodes, including the local one.
+func (c *Cluster) Nodes() []string {
+	c.mu.RLock()
+	ids := make([]string, 0, len(c.members)+1)
+	ids = append(ids, c.self.ID)
+	for id := range c.members {
+		ids = append(ids, id)
+	}
+	c.mu.RUnlock()
+	sort.Strings(ids)
+	return ids
+}
+
+// SetLabels sets the labels of the local session, gossiped to the other nodes, see PushToLabel.
+// NOTE: The labels are removed when the session is closed.
+func (c *Cluster) SetLabels(sessionID string, labels ...string) {
+	c.mu.Lock()
+	c.labels[sessionID] = append([]string(nil), labels...)
+	c.mu.Unlock()
+}
+
+// Locate returns the id of the node hosting the session.
+func (c *Cluster) Locate(sessionID string) (nodeID string, ok bool) {
+	if _, ok = c.local.GetSession(sessionID); ok {
+		return c.self.ID, true
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for id, m := range c.members {
+		if _, ok = m.state.Sessions[sessionID]; ok {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// PushToSession sends a PUSH to the session by the id, on the node hosting it.
+// NOTE:
+//  The session hosted by the other node is known after the gossip of it;
+//  If the session is not found, the status code is erpc.CodeSessionNotFound.
+func (c *Cluster) PushToSession(sessionID, serviceMethod string, args interface{}, setting ...erpc.MessageSetting) *erpc.Status {
+	if sess, ok := c.local.GetSession(sessionID); ok {
+		return sess.Push(serviceMethod, args, setting...)
+	}
+	nodeID, ok := c.Locate(sessionID)
+	if !ok {
+		return erpc.NewStatus(erpc.CodeSessionNotFound, erpc.CodeText(erpc.CodeSessionNotFound), sessionID)
+	}
+	fwd, stat := newForward(serviceMethod, args, setting)
+	if !stat.OK() {
+		return stat
+	}
+	fwd.SessionID = sessionID
+	return c.forwardTo(nodeID, fwd)
+}
+
+// PushToLabel sends a PUSH to all the sessions with the label in the cluster,
+// and returns the first failure status.
+func (c *Cluster) PushToLabel(label, serviceMethod string, args interface{}, setting ...erpc.MessageSetting) *erpc.Status {
+	var first *erpc.Status
+	for _, id := range c.localSessionsByLabel(label) {
+		if sess, ok := c.local.GetSession(id); ok {
+			if stat := sess.Push(serviceMethod, args, setting...); !stat.OK() && first == nil {
+				first = stat
+			}
+		}
+	}
+	var nodeIDs []string
+	c.mu.RLock()
+	for id, m := range c.members {
+		if hasLabel(m.state.Sessions, label) {
+			nodeIDs = append(nodeIDs, id)
+		}
+	}
+	c.mu.RUnlock()
+	if len(nodeIDs) == 0 {
+		return first
+	}
+	fwd, stat := newForward(serviceMethod, args, setting)
+	if !stat.OK() {
+		return stat
+	}
+	fwd.Label = label
+	for _, id := range nodeIDs {
+		if stat = c.forwardTo(id, fwd); !stat.OK() && first == nil {
+			first = stat
+		}
+	}
+	return first
+}
+
+// Close leaves the cluster, and closes the inter-node links.
+// NOTE: The local peer is not closed.
+func (c *Cluster) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closeCh)
+		clusters.Delete(c.node)
+	})
+	return c.node.Close()
+}
+
+func (c *Cluster) run() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.gossipOnce()
+		select {
+		case <-c.closeCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// gossipOnce exchanges the node states with a random node.
+func (c *Cluster) gossipOnce() {
+	c.refreshSelf()
+	c.expire()
+	addr, ok := c.pickAddr()
+	if !ok {
+		return
+	}
+	link, stat := c.link(addr)
+	if !stat.OK() {
+		erpc.Debugf("cluster: gossip with %s: %s", addr, stat.String())
+		return
+	}
+	var states []*NodeState
+	if stat = link.Call(gossipServiceMethod, c.states(), &states).Status(); !stat.OK() {
+		erpc.Debugf("cluster: gossip with %s: %s", addr, stat.String())
+		return
+	}
+	c.merge(states)
+}
+
+// refreshSelf snapshots the local sessions, and bumps the version as the heartbeat.
+func (c *Cluster) refreshSelf() {
+	sessions := make(map[string][]string, c.local.CountSession())
+	c.local.RangeSession(func(sess erpc.Session) bool {
+		sessions[sess.ID()] = nil
+		return true
+	})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, labels := range c.labels {
+		if _, ok := sessions[id]; ok {
+			sessions[id] = labels
+		} else {
+			delete(c.labels, id)
+		}
+	}
+	c.self.Sessions = sessions
+	c.self.Version++
+}
+
+func (c *Cluster) expire() {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, m := range c.members {
+		if now.Sub(m.seen) > c.timeout {
+			delete(c.members, id)
+			if link, ok := c.links[m.state.Addr]; ok {
+				delete(c.links, m.state.Addr)
+				go link.Close()
+			}
+			erpc.Infof("cluster: node %s(%s) is removed", id, m.state.Addr)
+		}
+	}
+}
+
+func (c *Cluster) pickAddr() (string, bool) {
+	c.mu.RLock()
+	addrs := make([]string, 0, len(c.members)+len(c.seeds))
+	for _, m := range c.members {
+		addrs = append(addrs, m.state.Addr)
+	}
+	c.mu.RUnlock()
+	if len(addrs) == 0 {
+		for _, seed := range c.seeds {
+			if seed != c.self.Addr {
+				addrs = append(addrs, seed)
+			}
+		}
+	}
+	if len(addrs) == 0 {
+		return "", false
+	}
+	return addrs[mrand.Intn(len(addrs))], true
+}
+
+func (c *Cluster) link(addr string) (erpc.Session, *erpc.Status) {
+	c.mu.RLock()
+	link, ok := c.links[addr]
+	c.mu.RUnlock()
+	if ok && link.Health() {
+		return link, nil
+	}
+	link, stat := c.node.Dial(addr)
+	if !stat.OK() {
+		return nil, stat
+	}
+	c.mu.Lock()
+	if old, ok := c.links[addr]; ok && old != link {
+		go old.Close()
+	}
+	c.links[addr] = link
+	c.mu.Unlock()
+	return link, nil
+}
+
+// states returns the states of all the known nodes.
+func (c *Cluster) states() []*NodeState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	self := c.self
+	states := make([]*NodeState, 0, len(c.members)+1)
+	states = append(states, &self)
+	for _, m := range c.members {
+		states = append(states, m.state)
+	}
+	return states
+}
+
+// merge keeps the newer states.
+func (c *Cluster) merge(states []*NodeState) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, st := range states {
+		if st == nil || st.ID == c.self.ID || st.Addr == "" {
+			continue
+		}
+		m, ok := c.members[st.ID]
+		if !ok {
+			erpc.Infof("cluster: node %s(%s) is joined", st.ID, st.Addr)
+			c.members[st.ID] = &member{state: st, seen: now}
+		} else if st.Version > m.state.Version {
+			m.state, m.seen = st, now
+		}
+	}
+}
+
+func (c *Cluster) localSessionsByLabel(label string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var ids []string
+	for id, labels := range c.labels {
+		for _, l := range labels {
+			if l == label {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+func hasLabel(sessions map[string][]string, label string) bool {
+	for _, labels := range sessions {
+		for _, l := range labels {
+			if l == label {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Forward the PUSH forwarded to the node hosting the sessions.
+type Forward struct {
+	SessionID     string   `json:"session_id,omitempty"`
+	Label         string   `json:"label,omitempty"`
+	ServiceMethod string   `json:"service_method"`
+	BodyCodec     byte     `json:"body_codec"`
+	Body          []byte   `json:"body"`
+	Meta          []string `json:"meta,omitempty"` // key, value pairs
+}
+
+func newForward(serviceMethod string, args interface{}, setting []erpc.MessageSetting) (*Forward, *erpc.Status) {
+	m := erpc.GetMessage(setting...)
+	defer erpc.PutMessage(m)
+	fwd := &Forward{ServiceMethod: serviceMethod, BodyCodec: m.BodyCodec()}
+	if fwd.BodyCodec == codec.NilCodecID {
+		fwd.BodyCodec = erpc.DefaultBodyCodec().ID()
+	}
+	var err error
+	if fwd.Body, err = codec.Marshal(fwd.BodyCodec, args); err != nil {
+		return nil, erpc.NewStatus(erpc.CodeBadMessage, erpc.CodeText(erpc.CodeBadMessage), err.Error())
+	}
+	m.Meta().VisitAll(func(k, v []byte) {
+		fwd.Meta = append(fwd.Meta, string(k), string(v))
+	})
+	return fwd, nil
+}
+
+func (f *Forward) setting() []erpc.MessageSetting {
+	setting := []erpc.MessageSetting{erpc.WithBodyCodec(f.BodyCodec)}
+	for i := 0; i+1 < len(f.Meta); i += 2 {
+		setting = append(setting, erpc.WithAddMeta(f.Meta[i], f.Meta[i+1]))
+	}
+	return setting
+}
+
+func (c *Cluster) forwardTo(nodeID string, fwd *Forward) *erpc.Status {
+	c.mu.RLock()
+	m, ok := c.members[nodeID]
+	c.mu.RUnlock()
+	if !ok {
+		return erpc.NewStatus(erpc.CodeSessionNotFound, erpc.CodeText(erpc.CodeSessionNotFound), "node "+nodeID+" is removed")
+	}
+	link, stat := c.link(m.state.Addr)
+	if !stat.OK() {
+		return stat
+	}
+	return link.Call(forwardServiceMethod, fwd, nil).Status()
+}
+
+type nodeCall struct {
+	erpc.CallCtx
+}
+
+func (n *nodeCall) cluster() (*Cluster, *erpc.Status) {
+	c, ok := clusters.Load(n.Peer())
+	if !ok {
+		return nil, erpc.NewStatus(erpc.CodeServiceUnavailable, erpc.CodeText(erpc.CodeServiceUnavailable), "the cluster is closed")
+	}
+	return c.(*Cluster), nil
+}
+
+// gossip merges the node states of the caller, and replies the known ones.
+func (n *nodeCall) gossip(states *[]*NodeState) ([]*NodeState, *erpc.Status) {
+	c, stat := n.cluster()
+	if !stat.OK() {
+		return nil, stat
+	}
+	c.merge(*states)
+	return c.states(), nil
+}
+
+// forward pushes the forwarded message to the local sessions.
+func (n *nodeCall) forward(fwd *Forward) (*struct{}, *erpc.Status) {
+	c, stat := n.cluster()
+	if !stat.OK() {
+		return nil, stat
+	}
+	if fwd.SessionID != "" {
+		sess, ok := c.local.GetSession(fwd.SessionID)
+		if !ok {
+			return nil, erpc.NewStatus(erpc.CodeSessionNotFound, erpc.CodeText(erpc.CodeSessionNotFound), fwd.SessionID)
+		}
+		return nil, sess.Push(fwd.ServiceMethod, fwd.Body, fwd.setting()...)
+	}
+	var first *erpc.Status
+	for _, id := range c.localSessionsByLabel(fwd.Label) {
+		if sess, ok := c.local.GetSession(id); ok {
+			if stat = sess.Push(fwd.ServiceMethod, fwd.Body, fwd.setting()...); !stat.OK() && first == nil {
+				first = stat
+			}
+		}
+	}
+	return nil, first
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,134 @@
+package cluster
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/plugin/auth"
+)
+
+var received = make(chan string, 10)
+
+type msg struct {
+	erpc.PushCtx
+}
+
+// Recv receives the pushed message.
+func (m *msg) Recv(text *string) *erpc.Status {
+	received <- *text
+	return nil
+}
+
+func newNode(t *testing.T, seeds ...string) (erpc.Peer, *Cluster, string) {
+	return newNodeConfig(t, Config{Seeds: seeds})
+}
+
+func newNodeConfig(t *testing.T, cfg Config) (erpc.Peer, *Cluster, string) {
+	srv := erpc.NewPeer(erpc.PeerConfig{})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	cfg.ListenAddr = "127.0.0.1:0"
+	cfg.GossipInterval = 20 * time.Millisecond
+	c, err := New(srv, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, c, lis.Addr().String()
+}
+
+func TestCluster(t *testing.T) {
+	srvA, a, _ := newNode(t)
+	defer srvA.Close()
+	defer a.Close()
+	srvB, b, addrB := newNode(t, a.self.Addr)
+	defer srvB.Close()
+	defer b.Close()
+
+	// the client is connected to the node B
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	cli.RoutePush(new(msg))
+	sess, stat := cli.Dial(addrB)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	sessID := sess.LocalAddr().String()
+	b.SetLabels(sessID, "room-1")
+	time.Sleep(300 * time.Millisecond)
+	if nodes := a.Nodes(); len(nodes) != 2 {
+		t.Fatalf("nodes of A: %v", nodes)
+	}
+	if nodeID, ok := a.Locate(sessID); !ok || nodeID != b.NodeID() {
+		t.Fatalf("locate: %s %v, expect %s", nodeID, ok, b.NodeID())
+	}
+
+	// push by the node A
+	if stat = a.PushToSession(sessID, "/msg/recv", "hello"); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if stat = a.PushToLabel("room-1", "/msg/recv", "hi room"); !stat.OK() {
+		t.Fatal(stat)
+	}
+	for _, expect := range []string{"hello", "hi room"} {
+		select {
+		case text := <-received:
+			if text != expect {
+				t.Fatalf("received: %q, expect %q", text, expect)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("not received %q", expect)
+		}
+	}
+	if stat = a.PushToSession("not-found", "/msg/recv", "hello"); stat.Code() != erpc.CodeSessionNotFound {
+		t.Fatalf("expect session not found, got %v", stat)
+	}
+
+	// the session is removed from the gossip after closed
+	sess.Close()
+	time.Sleep(300 * time.Millisecond)
+	if _, ok := a.Locate(sessID); ok {
+		t.Fatal("the closed session is still located")
+	}
+}
+
+func TestClusterAuth(t *testing.T) {
+	key := []byte("cluster-secret")
+	newConfig := func(id string, seeds ...string) Config {
+		keys := func(string) ([]byte, bool) { return key, true }
+		return Config{
+			NodeID:  id,
+			Seeds:   seeds,
+			Plugins: []erpc.Plugin{auth.NewHMACBearerPlugin(id, key), auth.NewHMACCheckerPlugin(keys)},
+		}
+	}
+	srvA, a, _ := newNodeConfig(t, newConfig("a"))
+	defer srvA.Close()
+	defer a.Close()
+	srvB, b, _ := newNodeConfig(t, newConfig("b", a.self.Addr))
+	defer srvB.Close()
+	defer b.Close()
+	time.Sleep(300 * time.Millisecond)
+	if nodes := a.Nodes(); len(nodes) != 2 {
+		t.Fatalf("nodes of A: %v", nodes)
+	}
+
+	// the unauthenticated peer can not gossip
+	evil := erpc.NewPeer(erpc.PeerConfig{})
+	defer evil.Close()
+	sess, stat := evil.Dial(a.self.Addr)
+	if stat.OK() {
+		stat = sess.Call(gossipServiceMethod, []*NodeState{{ID: "evil", Addr: "127.0.0.1:1"}}, new([]*NodeState)).Status()
+	}
+	if stat.OK() {
+		t.Fatal("expect the unauthenticated gossip failed")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if nodes := a.Nodes(); len(nodes) != 2 {
+		t.Fatalf("nodes of A: %v", nodes)
+	}
+}
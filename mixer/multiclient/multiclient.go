@@ -88,13 +88,49 @@ func (c *MultiClient) AsyncCall(
 // Call sends a message and receives reply.
 // NOTE:
 // If the arg is []byte or *[]byte type, it can automatically fill in the body codec name;
-// If the session is a client role and PeerConfig.RedialTimes>0, it is automatically re-called once after a failure.
+// If the session is a client role and PeerConfig.RedialTimes>0, it is automatically re-called once after a failure;
+// If erpc.WithHedging is set, the duplicate calls are sent by the other sessions hired from the pool.
 func (c *MultiClient) Call(uri string, arg interface{}, result interface{}, setting ...erpc.MessageSetting) erpc.CallCmd {
+	if _, ok := erpc.GetHedgingPolicy(setting...); ok {
+		return c.hedgeCall(uri, arg, result, setting...)
+	}
 	callCmd := c.AsyncCall(uri, arg, result, make(chan erpc.CallCmd, 1), setting...)
 	<-callCmd.Done()
 	return callCmd
 }
 
+// hedgeCall sends each attempt by a different session,
+// the hired sessions are kept until the hedging is completed, so that the pool does not return them again.
+func (c *MultiClient) hedgeCall(uri string, arg interface{}, result interface{}, setting ...erpc.MessageSetting) erpc.CallCmd {
+	var hired []erpc.Session
+	defer func() {
+		for _, sess := range hired {
+			c.pool.Fire(sess)
+		}
+	}()
+	next := func(attempt int) (erpc.AsyncCaller, bool) {
+		_sess, err := c.pool.Hire()
+		if err != nil {
+			if attempt == 0 {
+				// reports the error by the fake call command
+				return c, true
+			}
+			return nil, false
+		}
+		sess := _sess.(erpc.Session)
+		for _, s := range hired {
+			if s == sess {
+				// no other session in the pool
+				c.pool.Fire(sess)
+				return nil, false
+			}
+		}
+		hired = append(hired, sess)
+		return sess, true
+	}
+	return erpc.HedgeCall(next, uri, arg, result, setting...)
+}
+
 // Push sends a message, but do not receives reply.
 // NOTE:
 // If the arg is []byte or *[]byte type, it can automatically fill in the body codec name;
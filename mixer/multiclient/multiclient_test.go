@@ -1,6 +1,8 @@
 package multiclient_test
 
 import (
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -57,3 +59,48 @@ func TestMultiClient(t *testing.T) {
 	cli.Close()
 	time.Sleep(time.Second * 3)
 }
+
+var (
+	slowCalls int32
+	callersMu sync.Mutex
+	callers   = make(map[string]bool)
+)
+
+// Slow sleeps on the first call only, and records the callers.
+func (p *P) Slow(*struct{}) (string, *erpc.Status) {
+	callersMu.Lock()
+	callers[p.RealIP()] = true
+	callersMu.Unlock()
+	if atomic.AddInt32(&slowCalls, 1) == 1 {
+		time.Sleep(500 * time.Millisecond)
+	}
+	return "", nil
+}
+
+func TestMultiClientHedging(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{
+		ListenPort: 9114,
+	})
+	srv.RouteCall(new(P))
+	go srv.ListenAndServe()
+	defer srv.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := multiclient.New(erpc.NewPeer(erpc.PeerConfig{}), ":9114", 2, time.Second*5)
+	defer cli.Close()
+	start := time.Now()
+	stat := cli.Call("/p/slow", nil, nil, erpc.WithHedging(50*time.Millisecond, 3)).Status()
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	if cost := time.Since(start); cost > 300*time.Millisecond {
+		t.Fatalf("hedging: cost %v", cost)
+	}
+	callersMu.Lock()
+	n := len(callers)
+	callersMu.Unlock()
+	// the attempts are sent by different sessions, up to the quota
+	if n != 2 {
+		t.Fatalf("hedging: got %d sessions", n)
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+// Config the NATS server connection config.
+type Config struct {
+	// Addr the server address, e.g. "127.0.0.1:4222" or "nats://127.0.0.1:4222"
+	Addr  string
+	Name  string
+	User  string
+	Pass  string
+	Token string
+	// Timeout the timeout of dialing and handshake, default 10s
+	Timeout time.Duration
+}
+
+// Conn a NATS client connection, for core publish and subscribe.
+// NOTE: It does not reconnect after disconnected, and TLS is not supported.
+type Conn struct {
+	conn       net.Conn
+	r          *bufio.Reader
+	wMu        sync.Mutex
+	mu         sync.Mutex
+	nextSid    int
+	subs       map[int]*subscription
+	maxPayload int
+	closed     bool
+	err        error
+	done       chan struct{}
+}
+
+type subscription struct {
+	handler func(subject, reply string, data []byte)
+	sid     int
+}
+
+// ErrConnClosed the NATS connection is closed.
+var ErrConnClosed = errors.New("nats: connection closed")
+
+// Connect connects to the NATS server.
+func Connect(cfg Config) (*Conn, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	addr := strings.TrimPrefix(cfg.Addr, "nats://")
+	conn, err := net.DialTimeout("tcp", addr, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{
+		conn:       conn,
+		r:          bufio.NewReader(conn),
+		subs:       make(map[int]*subscription),
+		maxPayload: 1 << 20,
+		done:       make(chan struct{}),
+	}
+	conn.SetDeadline(time.Now().Add(cfg.Timeout))
+	if err = c.handshake(cfg); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *Conn) handshake(cfg Config) error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("nats: unexpected %q", line)
+	}
+	var info struct {
+		MaxPayload int  `json:"max_payload"`
+		TLS        bool `json:"tls_required"`
+	}
+	if err = json.Unmarshal([]byte(line[5:]), &info); err != nil {
+		return err
+	}
+	if info.TLS {
+		return errors.New("nats: TLS is not supported")
+	}
+	if info.MaxPayload > 0 {
+		c.maxPayload = info.MaxPayload
+	}
+	if cfg.Name == "" {
+		cfg.Name = "erpc"
+	}
+	opts, _ := json.Marshal(map[string]interface{}{
+		"verbose":    false,
+		"pedantic":   false,
+		"name":       cfg.Name,
+		"lang":       "go",
+		"protocol":   1,
+		"user":       cfg.User,
+		"pass":       cfg.Pass,
+		"auth_token": cfg.Token,
+	})
+	if _, err = fmt.Fprintf(c.conn, "CONNECT %s\r\nPING\r\n", opts); err != nil {
+		return err
+	}
+	for {
+		line, err = c.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats: %s", line)
+		}
+	}
+}
+
+func (c *Conn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *Conn) readLoop() {
+	err := c.doRead()
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	closed := c.closed
+	c.mu.Unlock()
+	if !closed {
+		erpc.Warnf("nats: disconnected: %v", err)
+	}
+	c.Close()
+}
+
+func (c *Conn) doRead() error {
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			args := strings.Fields(line[4:])
+			if len(args) != 3 && len(args) != 4 {
+				return fmt.Errorf("nats: bad %q", line)
+			}
+			n, err := strconv.Atoi(args[len(args)-1])
+			if err != nil {
+				return fmt.Errorf("nats: bad %q", line)
+			}
+			sid, _ := strconv.Atoi(args[1])
+			var reply string
+			if len(args) == 4 {
+				reply = args[2]
+			}
+			data := make([]byte, n+2)
+			if _, err = io.ReadFull(c.r, data); err != nil {
+				return err
+			}
+			c.mu.Lock()
+			sub := c.subs[sid]
+			c.mu.Unlock()
+			if sub != nil {
+				sub.handler(args[0], reply, data[:n])
+			}
+		case line == "PING":
+			if err = c.write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			erpc.Warnf("nats: %s", line)
+		}
+	}
+}
+
+func (c *Conn) write(b []byte) error {
+	c.wMu.Lock()
+	defer c.wMu.Unlock()
+	_, err := c.conn.Write(b)
+	return err
+}
+
+// Publish publishes the data to the subject, with an optional reply subject.
+func (c *Conn) Publish(subject, reply string, data []byte) error {
+	if len(data) > c.maxPayload {
+		return fmt.Errorf("nats: payload %d exceeds max %d", len(data), c.maxPayload)
+	}
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return ErrConnClosed
+	}
+	b := make([]byte, 0, len(subject)+len(reply)+len(data)+24)
+	b = append(b, "PUB "...)
+	b = append(b, subject...)
+	if reply != "" {
+		b = append(b, ' ')
+		b = append(b, reply...)
+	}
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(len(data)), 10)
+	b = append(b, "\r\n"...)
+	b = append(b, data...)
+	b = append(b, "\r\n"...)
+	return c.write(b)
+}
+
+// Subscribe subscribes the subject with an optional queue group, and returns the unsubscribe function.
+// NOTE: The handler is called in the reading goroutine, and must not block.
+func (c *Conn) Subscribe(subject, queue string, handler func(subject, reply string, data []byte)) (func() error, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrConnClosed
+	}
+	c.nextSid++
+	sub := &subscription{sid: c.nextSid, handler: handler}
+	c.subs[sub.sid] = sub
+	c.mu.Unlock()
+	var args = subject
+	if queue != "" {
+		args += " " + queue
+	}
+	if err := c.write([]byte(fmt.Sprintf("SUB %s %d\r\n", args, sub.sid))); err != nil {
+		return nil, err
+	}
+	return func() error {
+		c.mu.Lock()
+		_, ok := c.subs[sub.sid]
+		delete(c.subs, sub.sid)
+		c.mu.Unlock()
+		if !ok {
+			return nil
+		}
+		return c.write([]byte(fmt.Sprintf("UNSUB %d\r\n", sub.sid)))
+	}, nil
+}
+
+// Done returns a channel that is closed when the connection is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	c.mu.Unlock()
+	return c.conn.Close()
+}
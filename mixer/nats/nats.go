@@ -0,0 +1,382 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nats carries erpc sessions over NATS subjects,
+// so that the services can run without opening direct TCP listeners.
+//
+// Each session has a subject on both sides, a CALL is published as a request
+// with the caller's subject as the reply subject, the REPLY is published to it,
+// and a PUSH is a plain publish.
+package nats
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+// frame header: {1 byte message type}{4 bytes sequence}
+// the message type 0 is for control frames with {1 byte control code}
+const frameHeaderLen = 5
+
+const (
+	ctrlConnect byte = 'C'
+	ctrlAccept  byte = 'A'
+	ctrlClose   byte = 'X'
+)
+
+// ErrTimeout dial timeout
+var ErrTimeout = errors.New("nats: dial timeout")
+
+// MaxReadBuffer the max bytes of the received messages waiting to be read by a session,
+// the messages exceeding it are dropped, like the slow consumers of NATS.
+var MaxReadBuffer = 16 << 20
+
+// Serve serves the erpc sessions on the subject until the NATS connection is closed.
+// NOTE: If queue is not empty, the servers in the same queue group share the new sessions.
+func Serve(peer erpc.Peer, nc *Conn, subject, queue string) error {
+	lis, err := Listen(nc, subject, queue)
+	if err != nil {
+		return err
+	}
+	defer lis.Close()
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if err == ErrConnClosed {
+				return nil
+			}
+			return err
+		}
+		if _, stat := peer.ServeConn(conn, NewProtoFunc()); !stat.OK() {
+			erpc.Warnf("nats: serve session: %s", stat.String())
+		}
+	}
+}
+
+// DialSession creates a session to the server on the subject.
+// NOTE: The session does not redial after disconnected.
+func DialSession(peer erpc.Peer, nc *Conn, subject string) (erpc.Session, *erpc.Status) {
+	conn, err := Dial(nc, subject, 0)
+	if err != nil {
+		return nil, erpc.NewStatus(erpc.CodeDialFailed, erpc.CodeText(erpc.CodeDialFailed), err.Error())
+	}
+	return peer.ServeConn(conn, NewProtoFunc())
+}
+
+// Listen announces on the subject, and returns the listener of sessions.
+// NOTE: The accepted connections must be used with the ProtoFunc of NewProtoFunc.
+func Listen(nc *Conn, subject, queue string) (net.Listener, error) {
+	l := &listener{
+		nc:      nc,
+		subject: subject,
+		conns:   make(chan *conn, 64),
+		done:    make(chan struct{}),
+	}
+	unsub, err := nc.Subscribe(subject, queue, l.onConnect)
+	if err != nil {
+		return nil, err
+	}
+	l.unsub = unsub
+	return l, nil
+}
+
+type listener struct {
+	nc      *Conn
+	unsub   func() error
+	conns   chan *conn
+	done    chan struct{}
+	subject string
+	once    sync.Once
+}
+
+func (l *listener) onConnect(_, reply string, data []byte) {
+	if reply == "" || len(data) < frameHeaderLen+1 || data[0] != 0 || data[frameHeaderLen] != ctrlConnect {
+		return
+	}
+	c, err := newConn(l.nc, l.subject+"."+newID(), reply)
+	if err != nil {
+		erpc.Warnf("nats: accept: %v", err)
+		return
+	}
+	if err = c.sendControl(ctrlAccept, []byte(c.localSubject)); err != nil {
+		c.Close()
+		erpc.Warnf("nats: accept: %v", err)
+		return
+	}
+	select {
+	case l.conns <- c:
+	default:
+		erpc.Warnf("nats: accept queue is full, reject %s", reply)
+		c.Close()
+	}
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, erpc.ErrListenClosed
+	case <-l.nc.Done():
+		return nil, ErrConnClosed
+	}
+}
+
+func (l *listener) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.done)
+		err = l.unsub()
+	})
+	return err
+}
+
+func (l *listener) Addr() net.Addr {
+	return addr(l.subject)
+}
+
+// Dial connects to the server on the subject.
+// NOTE:
+//  If timeout<=0, it is 10s;
+//  The connection must be used with the ProtoFunc of NewProtoFunc.
+func Dial(nc *Conn, subject string, timeout time.Duration) (net.Conn, error) {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	c, err := newConn(nc, "_INBOX."+newID(), "")
+	if err != nil {
+		return nil, err
+	}
+	var hdr [frameHeaderLen + 1]byte
+	hdr[frameHeaderLen] = ctrlConnect
+	if err = nc.Publish(subject, c.localSubject, hdr[:]); err != nil {
+		c.Close()
+		return nil, err
+	}
+	select {
+	case <-c.accepted:
+		return c, nil
+	case <-time.After(timeout):
+		c.Close()
+		return nil, ErrTimeout
+	}
+}
+
+// conn a session connection over NATS subjects.
+type conn struct {
+	nc            *Conn
+	unsub         func() error
+	localSubject  string
+	remoteSubject string
+	accepted      chan struct{}
+
+	mu          sync.Mutex
+	cond        *sync.Cond
+	buf         bytes.Buffer
+	replies     map[int32]string // seq of received call -> reply subject
+	closed      bool
+	readTimeout time.Time
+	timer       *time.Timer
+}
+
+func newConn(nc *Conn, localSubject, remoteSubject string) (*conn, error) {
+	c := &conn{
+		nc:            nc,
+		localSubject:  localSubject,
+		remoteSubject: remoteSubject,
+		accepted:      make(chan struct{}),
+		replies:       make(map[int32]string),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	unsub, err := nc.Subscribe(localSubject, "", c.onMessage)
+	if err != nil {
+		return nil, err
+	}
+	c.unsub = unsub
+	go func() {
+		<-nc.Done()
+		c.shutdown()
+	}()
+	return c, nil
+}
+
+func (c *conn) onMessage(_, reply string, data []byte) {
+	if len(data) < frameHeaderLen {
+		return
+	}
+	mtype := data[0]
+	seq := int32(binary.BigEndian.Uint32(data[1:]))
+	payload := data[frameHeaderLen:]
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if mtype == 0 {
+		if len(payload) == 0 {
+			return
+		}
+		switch payload[0] {
+		case ctrlAccept:
+			if c.remoteSubject == "" {
+				c.remoteSubject = string(payload[1:])
+				close(c.accepted)
+			}
+		case ctrlClose:
+			c.closed = true
+			c.cond.Broadcast()
+		}
+		return
+	}
+	if c.closed {
+		return
+	}
+	if c.buf.Len()+len(payload) > MaxReadBuffer {
+		erpc.Warnf("nats: read buffer of %s is full, drop the message seq %d", c.localSubject, seq)
+		return
+	}
+	if reply != "" && (mtype == erpc.TypeCall || mtype == erpc.TypeAuthCall) {
+		c.replies[seq] = reply
+	}
+	c.buf.Write(payload)
+	c.cond.Broadcast()
+}
+
+// send publishes the packed message.
+func (c *conn) send(mtype byte, seq int32, data []byte) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return io.ErrClosedPipe
+	}
+	subject, reply := c.remoteSubject, ""
+	switch mtype {
+	case erpc.TypeReply, erpc.TypeAuthReply:
+		if s, ok := c.replies[seq]; ok {
+			subject = s
+			delete(c.replies, seq)
+		}
+	case erpc.TypeCall, erpc.TypeAuthCall:
+		reply = c.localSubject
+	}
+	c.mu.Unlock()
+	frame := make([]byte, frameHeaderLen+len(data))
+	frame[0] = mtype
+	binary.BigEndian.PutUint32(frame[1:], uint32(seq))
+	copy(frame[frameHeaderLen:], data)
+	return c.nc.Publish(subject, reply, frame)
+}
+
+func (c *conn) sendControl(code byte, data []byte) error {
+	frame := make([]byte, frameHeaderLen+1+len(data))
+	frame[frameHeaderLen] = code
+	copy(frame[frameHeaderLen+1:], data)
+	return c.nc.Publish(c.remoteSubject, "", frame)
+}
+
+// Read reads the packed messages.
+func (c *conn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.buf.Len() == 0 {
+		if c.closed {
+			return 0, io.EOF
+		}
+		if !c.readTimeout.IsZero() && !time.Now().Before(c.readTimeout) {
+			return 0, timeoutError{}
+		}
+		c.cond.Wait()
+	}
+	return c.buf.Read(b)
+}
+
+// Write is not supported, the messages are sent by the protocol of NewProtoFunc.
+func (c *conn) Write(b []byte) (int, error) {
+	return 0, errors.New("nats: use the protocol of NewProtoFunc")
+}
+
+func (c *conn) Close() error {
+	c.mu.Lock()
+	notify := !c.closed && c.remoteSubject != ""
+	c.mu.Unlock()
+	if notify {
+		c.sendControl(ctrlClose, nil)
+	}
+	c.shutdown()
+	return c.unsub()
+}
+
+func (c *conn) shutdown() {
+	c.mu.Lock()
+	c.closed = true
+	c.replies = make(map[int32]string)
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.cond.Broadcast()
+	c.mu.Unlock()
+}
+
+func (c *conn) LocalAddr() net.Addr  { return addr(c.localSubject) }
+func (c *conn) RemoteAddr() net.Addr { return addr(c.remoteSubject) }
+
+func (c *conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readTimeout = t
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if !t.IsZero() {
+		c.timer = time.AfterFunc(time.Until(t), func() {
+			c.mu.Lock()
+			c.cond.Broadcast()
+			c.mu.Unlock()
+		})
+	}
+	c.cond.Broadcast()
+	return nil
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+type addr string
+
+func (addr) Network() string  { return "nats" }
+func (a addr) String() string { return string(a) }
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "nats: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func newID() string {
+	var b [12]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
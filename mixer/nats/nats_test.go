@@ -0,0 +1,204 @@
+package nats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+// server is a minimal NATS server for testing.
+type server struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	subs []*sub
+}
+
+type sub struct {
+	conn    net.Conn
+	subject string
+	queue   string
+	sid     string
+}
+
+func newServer(t *testing.T) *server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *server) write(conn net.Conn, b []byte) {
+	s.mu.Lock()
+	conn.Write(b)
+	s.mu.Unlock()
+}
+
+func (s *server) serve(conn net.Conn) {
+	defer conn.Close()
+	s.write(conn, []byte(`INFO {"max_payload":1048576}`+"\r\n"))
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		switch args[0] {
+		case "PING":
+			s.write(conn, []byte("PONG\r\n"))
+		case "SUB":
+			x := &sub{conn: conn, subject: args[1], sid: args[len(args)-1]}
+			if len(args) == 4 {
+				x.queue = args[2]
+			}
+			s.mu.Lock()
+			s.subs = append(s.subs, x)
+			s.mu.Unlock()
+		case "UNSUB":
+			s.mu.Lock()
+			for i, x := range s.subs {
+				if x.conn == conn && x.sid == args[1] {
+					s.subs = append(s.subs[:i], s.subs[i+1:]...)
+					break
+				}
+			}
+			s.mu.Unlock()
+		case "PUB":
+			n, _ := strconv.Atoi(args[len(args)-1])
+			data := make([]byte, n+2)
+			if _, err = io.ReadFull(r, data); err != nil {
+				return
+			}
+			var reply string
+			if len(args) == 4 {
+				reply = " " + args[2]
+			}
+			s.mu.Lock()
+			queues := make(map[string]bool)
+			for _, x := range s.subs {
+				if x.subject != args[1] || (x.queue != "" && queues[x.queue]) {
+					continue
+				}
+				queues[x.queue] = x.queue != ""
+				fmt.Fprintf(x.conn, "MSG %s %s%s %d\r\n%s", args[1], x.sid, reply, n, data)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+type Home struct {
+	erpc.CallCtx
+}
+
+func (h *Home) Test(arg *map[string]string) (map[string]interface{}, *erpc.Status) {
+	h.Session().Push("/push/test", map[string]string{"your_id": (*arg)["author"]})
+	return map[string]interface{}{"arg": *arg}, nil
+}
+
+type Push struct {
+	erpc.PushCtx
+}
+
+var pushed = make(chan string, 1)
+
+func (p *Push) Test(arg *map[string]string) *erpc.Status {
+	pushed <- (*arg)["your_id"]
+	return nil
+}
+
+func TestNATS(t *testing.T) {
+	s := newServer(t)
+	defer s.ln.Close()
+
+	srvConn, err := Connect(Config{Addr: s.ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := erpc.NewPeer(erpc.PeerConfig{})
+	srv.RouteCall(new(Home))
+	go Serve(srv, srvConn, "erpc.test", "servers")
+
+	cliConn, err := Connect(Config{Addr: s.ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cliConn.Close()
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	cli.RoutePush(new(Push))
+	time.Sleep(100 * time.Millisecond)
+	sess, stat := DialSession(cli, cliConn, "erpc.test")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var result interface{}
+	stat = sess.Call("/home/test",
+		map[string]string{"author": "henrylee2cn"},
+		&result,
+	).Status()
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	t.Logf("result: %v", result)
+	select {
+	case id := <-pushed:
+		if id != "henrylee2cn" {
+			t.Fatalf("push: got %q", id)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("push timeout")
+	}
+
+	srv.Close()
+	time.Sleep(100 * time.Millisecond)
+	if sess.Health() {
+		t.Fatal("the session should be closed after the server closed")
+	}
+	srvConn.Close()
+}
+
+func TestConnBuffer(t *testing.T) {
+	c := &conn{replies: make(map[int32]string)}
+	c.cond = sync.NewCond(&c.mu)
+	defer func(n int) { MaxReadBuffer = n }(MaxReadBuffer)
+	MaxReadBuffer = 10
+
+	frame := func(seq byte, n int) []byte {
+		b := make([]byte, frameHeaderLen+n)
+		b[0], b[4] = erpc.TypeCall, seq
+		return b
+	}
+	c.onMessage("", "reply.1", frame(1, 8))
+	// exceeds the limit and is dropped without the reply subject
+	c.onMessage("", "reply.2", frame(2, 8))
+	if c.buf.Len() != 8 || len(c.replies) != 1 {
+		t.Fatalf("got buf %d, replies %d", c.buf.Len(), len(c.replies))
+	}
+	c.shutdown()
+	c.onMessage("", "reply.3", frame(3, 1))
+	if c.buf.Len() != 8 || len(c.replies) != 0 {
+		t.Fatalf("after close: got buf %d, replies %d", c.buf.Len(), len(c.replies))
+	}
+}
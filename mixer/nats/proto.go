@@ -0,0 +1,86 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/socket"
+)
+
+// NewProtoFunc is creation function of the protocol over NATS subjects,
+// it publishes each message packed by the inner protocol as a NATS message.
+// NOTE: If inner is not specified, the default protocol is used.
+func NewProtoFunc(inner ...erpc.ProtoFunc) erpc.ProtoFunc {
+	innerFunc := erpc.DefaultProtoFunc()
+	if len(inner) > 0 && inner[0] != nil {
+		innerFunc = inner[0]
+	}
+	return func(rw erpc.IOWithReadBuffer) erpc.Proto {
+		p := &natsProto{rw: rw}
+		p.inner = innerFunc(&splitRW{Reader: rw, Writer: &p.wbuf})
+		return p
+	}
+}
+
+type natsProto struct {
+	inner erpc.Proto
+	rw    erpc.IOWithReadBuffer
+	wbuf  bytes.Buffer
+	wMu   sync.Mutex
+}
+
+type splitRW struct {
+	io.Reader
+	io.Writer
+}
+
+var errNotNATSConn = errors.New("nats: the connection is not over NATS")
+
+// Version returns the protocol's id and name.
+func (p *natsProto) Version() (byte, string) {
+	return p.inner.Version()
+}
+
+// Pack writes the Message into the connection.
+func (p *natsProto) Pack(m erpc.Message) error {
+	r, ok := p.rw.(interface{ Raw() net.Conn })
+	if !ok {
+		return errNotNATSConn
+	}
+	c, ok := r.Raw().(*conn)
+	if !ok {
+		return errNotNATSConn
+	}
+	p.wMu.Lock()
+	defer p.wMu.Unlock()
+	p.wbuf.Reset()
+	if err := p.inner.Pack(m); err != nil {
+		return err
+	}
+	return c.send(m.Mtype(), m.Seq(), p.wbuf.Bytes())
+}
+
+// Unpack reads bytes from the connection to the Message.
+func (p *natsProto) Unpack(m erpc.Message) error {
+	return p.inner.Unpack(m)
+}
+
+var _ socket.Proto = (*natsProto)(nil)
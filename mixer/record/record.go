@@ -0,0 +1,244 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package record captures the frames of the sessions to files,
+// and replays them against the handlers by a loopback transport,
+// for the regression tests and debugging the protocol issues from the production captures.
+package record
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+// Direction the direction of the frame, from the view of the recorded side.
+type Direction byte
+
+const (
+	// In the frame read from the connection
+	In Direction = 'I'
+	// Out the frame written to the connection
+	Out Direction = 'O'
+)
+
+func (d Direction) String() string {
+	switch d {
+	case In:
+		return "in"
+	case Out:
+		return "out"
+	default:
+		return "unknown"
+	}
+}
+
+// Frame a chunk of bytes read from or written to the connection once.
+type Frame struct {
+	Dir Direction
+	// Offset the duration since the connection is recorded
+	Offset time.Duration
+	Data   []byte
+}
+
+// frame header: direction(1) + offset(8) + length(4)
+const frameHeaderSize = 13
+
+// MaxFrameSize the maximum size of a frame read from the capture.
+var MaxFrameSize = 64 << 20
+
+// ErrBadCapture the capture is broken.
+var ErrBadCapture = errors.New("record: bad capture")
+
+// WriteFrame writes the frame to the capture.
+func WriteFrame(w io.Writer, f Frame) error {
+	var h [frameHeaderSize]byte
+	h[0] = byte(f.Dir)
+	binary.BigEndian.PutUint64(h[1:9], uint64(f.Offset))
+	binary.BigEndian.PutUint32(h[9:], uint32(len(f.Data)))
+	if _, err := w.Write(h[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(f.Data)
+	return err
+}
+
+// ReadFrames reads all the frames of the capture.
+func ReadFrames(r io.Reader) ([]Frame, error) {
+	br := bufio.NewReader(r)
+	var frames []Frame
+	var h [frameHeaderSize]byte
+	for {
+		if _, err := io.ReadFull(br, h[:]); err != nil {
+			if err == io.EOF {
+				return frames, nil
+			}
+			return frames, ErrBadCapture
+		}
+		f := Frame{
+			Dir:    Direction(h[0]),
+			Offset: time.Duration(binary.BigEndian.Uint64(h[1:9])),
+		}
+		n := binary.BigEndian.Uint32(h[9:])
+		if (f.Dir != In && f.Dir != Out) || int64(n) > int64(MaxFrameSize) {
+			return frames, ErrBadCapture
+		}
+		f.Data = make([]byte, n)
+		if _, err := io.ReadFull(br, f.Data); err != nil {
+			return frames, ErrBadCapture
+		}
+		frames = append(frames, f)
+	}
+}
+
+// ReadFile reads all the frames of the capture file.
+func ReadFile(name string) ([]Frame, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadFrames(file)
+}
+
+// Conn a connection recording its frames.
+type Conn struct {
+	net.Conn
+	mu     sync.Mutex
+	w      io.Writer
+	start  time.Time
+	err    error
+	closed bool
+}
+
+// NewConn wraps the connection to record its frames to w.
+// NOTE:
+//  Record under the TLS layer captures the encrypted bytes, which can not be replayed;
+//  If writing the capture fails, the recording stops, and the connection is not affected.
+func NewConn(conn net.Conn, w io.Writer) *Conn {
+	return &Conn{Conn: conn, w: w, start: time.Now()}
+}
+
+// Read reads data from the connection, and records it.
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.record(In, b[:n])
+	}
+	return n, err
+}
+
+// Write writes data to the connection, and records it.
+func (c *Conn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.record(Out, b[:n])
+	}
+	return n, err
+}
+
+// Close closes the connection, and the capture if it is an io.Closer.
+func (c *Conn) Close() error {
+	err := c.Conn.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return err
+	}
+	c.closed = true
+	if closer, ok := c.w.(io.Closer); ok {
+		if e := closer.Close(); e != nil {
+			erpc.Warnf("record: close the capture of %s: %v", c.RemoteAddr().String(), e)
+		}
+	}
+	return err
+}
+
+func (c *Conn) record(dir Direction, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || c.err != nil {
+		return
+	}
+	c.err = WriteFrame(c.w, Frame{Dir: dir, Offset: time.Since(c.start), Data: data})
+	if c.err != nil {
+		erpc.Warnf("record: stop recording %s: %v", c.RemoteAddr().String(), c.err)
+	}
+}
+
+// Listener a listener recording the frames of the accepted connections.
+type Listener struct {
+	net.Listener
+	newCapture func(conn net.Conn) (io.WriteCloser, error)
+}
+
+// NewListener wraps the listener to record the frames of each accepted connection
+// to the capture created by newCapture, e.g. DirCapture.
+// NOTE: If newCapture fails, the connection is not recorded.
+func NewListener(lis net.Listener, newCapture func(conn net.Conn) (io.WriteCloser, error)) *Listener {
+	return &Listener{Listener: lis, newCapture: newCapture}
+}
+
+// Accept waits for and returns the next recorded connection.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	w, err := l.newCapture(conn)
+	if err != nil {
+		erpc.Warnf("record: create the capture of %s: %v", conn.RemoteAddr().String(), err)
+		return conn, nil
+	}
+	return NewConn(conn, w), nil
+}
+
+// DirCapture returns the function creating the capture file named with the time and remote address in the directory.
+func DirCapture(dir string) func(conn net.Conn) (io.WriteCloser, error) {
+	return func(conn net.Conn) (io.WriteCloser, error) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		remote := strings.NewReplacer(":", "_", "/", "_", "[", "", "]", "").Replace(conn.RemoteAddr().String())
+		name := fmt.Sprintf("%s-%s.erpcrec", time.Now().Format("20060102T150405.000000000"), remote)
+		file, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		return &bufferedFile{Writer: bufio.NewWriter(file), file: file}, nil
+	}
+}
+
+type bufferedFile struct {
+	*bufio.Writer
+	file *os.File
+}
+
+func (f *bufferedFile) Close() error {
+	err := f.Flush()
+	if e := f.file.Close(); err == nil {
+		err = e
+	}
+	return err
+}
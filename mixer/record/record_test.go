@@ -0,0 +1,119 @@
+package record
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+var pushed int32
+
+type Home struct {
+	erpc.CallCtx
+}
+
+// Echo replies the arg.
+func (h *Home) Echo(arg *string) (string, *erpc.Status) {
+	return "echo: " + *arg, nil
+}
+
+func notify(ctx erpc.PushCtx, _ *string) *erpc.Status {
+	atomic.AddInt32(&pushed, 1)
+	return nil
+}
+
+type capture struct {
+	bytes.Buffer
+	closed chan struct{}
+}
+
+func (c *capture) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func newServer() erpc.Peer {
+	srv := erpc.NewPeer(erpc.PeerConfig{})
+	srv.RouteCall(new(Home))
+	srv.RoutePushFunc(notify)
+	return srv
+}
+
+func TestRecordReplay(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &capture{closed: make(chan struct{})}
+	srv := newServer()
+	defer srv.Close()
+	go srv.ServeListener(NewListener(lis, func(net.Conn) (io.WriteCloser, error) {
+		return c, nil
+	}))
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var result string
+	for _, arg := range []string{"a", "b"} {
+		if stat = sess.Call("/home/echo", arg, &result).Status(); !stat.OK() {
+			t.Fatal(stat)
+		}
+	}
+	if stat = sess.Push("/notify", "c"); !stat.OK() {
+		t.Fatal(stat)
+	}
+	time.Sleep(100 * time.Millisecond)
+	sess.Close()
+	select {
+	case <-c.closed:
+	case <-time.After(time.Second):
+		t.Fatal("the capture is not closed")
+	}
+
+	frames, err := ReadFrames(&c.Buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recorded []byte
+	for _, f := range frames {
+		if f.Dir == Out {
+			recorded = append(recorded, f.Data...)
+		}
+	}
+	if len(recorded) == 0 {
+		t.Fatal("no output is recorded")
+	}
+
+	// replay against a new server
+	atomic.StoreInt32(&pushed, 0)
+	srv2 := newServer()
+	defer srv2.Close()
+	output, err := Replay(srv2, frames, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replayed []byte
+	for _, f := range output {
+		replayed = append(replayed, f.Data...)
+	}
+	if !bytes.Equal(replayed, recorded) {
+		t.Fatalf("replayed:\n%q\nrecorded:\n%q", replayed, recorded)
+	}
+	if n := atomic.LoadInt32(&pushed); n != 1 {
+		t.Fatalf("pushed: %d", n)
+	}
+
+	// the broken capture
+	if _, err = ReadFrames(bytes.NewReader([]byte{'X', 0})); err != ErrBadCapture {
+		t.Fatalf("expect ErrBadCapture, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package record
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+// DefaultReplayTimeout the default duration of waiting for each recorded output in Replay.
+var DefaultReplayTimeout = 5 * time.Second
+
+// Replay replays the captured frames against the handlers of the peer, by a loopback connection,
+// and returns the frames written by the peer.
+// The input frames are fed in the recorded order, and before each one, the peer is waited for
+// to write as many bytes as the output frames recorded before it, so the replay is deterministic.
+// NOTE:
+//  Replay the capture of the same side, e.g. the server capture against the server peer;
+//  The connection reads io.EOF after all the input frames, then the session is closed;
+//  If the output is not written in the timeout (default DefaultReplayTimeout), ErrReplayTimeout is returned.
+func Replay(peer erpc.Peer, frames []Frame, timeout time.Duration, protoFunc ...erpc.ProtoFunc) ([]Frame, error) {
+	if timeout <= 0 {
+		timeout = DefaultReplayTimeout
+	}
+	conn := newReplayConn()
+	sess, stat := peer.ServeConn(conn, protoFunc...)
+	if !stat.OK() {
+		return nil, stat.Cause()
+	}
+	var err error
+	var expected int
+	for _, f := range frames {
+		if f.Dir == Out {
+			expected += len(f.Data)
+			continue
+		}
+		if err = conn.waitWritten(expected, timeout); err != nil {
+			break
+		}
+		if err = conn.feed(f.Data, timeout); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = conn.waitWritten(expected, timeout)
+	}
+	conn.closeInput()
+	select {
+	case <-sess.CloseNotify():
+	case <-time.After(timeout):
+		sess.Close()
+	}
+	return conn.output(), err
+}
+
+// ErrReplayTimeout the peer does not read or write as recorded in the timeout.
+var ErrReplayTimeout = errors.New("record: replay timeout")
+
+// replayConn the loopback connection of replaying.
+type replayConn struct {
+	in        chan []byte
+	inOnce    sync.Once
+	pending   []byte
+	mu        sync.Mutex
+	frames    []Frame
+	written   int
+	writtenCh chan struct{} // closed and renewed on each write
+	start     time.Time
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newReplayConn() *replayConn {
+	return &replayConn{
+		in:        make(chan []byte),
+		writtenCh: make(chan struct{}),
+		start:     time.Now(),
+		closed:    make(chan struct{}),
+	}
+}
+
+func (c *replayConn) feed(data []byte, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case c.in <- data:
+		return nil
+	case <-c.closed:
+		return net.ErrClosed
+	case <-timer.C:
+		return ErrReplayTimeout
+	}
+}
+
+func (c *replayConn) closeInput() {
+	c.inOnce.Do(func() { close(c.in) })
+}
+
+func (c *replayConn) waitWritten(n int, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		c.mu.Lock()
+		written, ch := c.written, c.writtenCh
+		c.mu.Unlock()
+		if written >= n {
+			return nil
+		}
+		select {
+		case <-ch:
+		case <-c.closed:
+			return fmt.Errorf("record: the connection is closed after written %d of %d bytes", written, n)
+		case <-timer.C:
+			return ErrReplayTimeout
+		}
+	}
+}
+
+func (c *replayConn) output() []Frame {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.frames
+}
+
+// Read reads the fed input frames.
+func (c *replayConn) Read(b []byte) (int, error) {
+	if len(c.pending) == 0 {
+		select {
+		case data, ok := <-c.in:
+			if !ok {
+				return 0, io.EOF
+			}
+			c.pending = data
+		case <-c.closed:
+			return 0, net.ErrClosed
+		}
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write collects the output frames.
+func (c *replayConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	c.mu.Lock()
+	c.frames = append(c.frames, Frame{Dir: Out, Offset: time.Since(c.start), Data: append([]byte(nil), b...)})
+	c.written += len(b)
+	close(c.writtenCh)
+	c.writtenCh = make(chan struct{})
+	c.mu.Unlock()
+	return len(b), nil
+}
+
+func (c *replayConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *replayConn) LocalAddr() net.Addr                { return replayAddr{} }
+func (c *replayConn) RemoteAddr() net.Addr               { return replayAddr{} }
+func (c *replayConn) SetDeadline(t time.Time) error      { return nil }
+func (c *replayConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *replayConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type replayAddr struct{}
+
+func (replayAddr) Network() string { return "replay" }
+func (replayAddr) String() string  { return "replay" }
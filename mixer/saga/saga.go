@@ -0,0 +1,190 @@
+// Package saga is a small coordinator of the distributed transactions across peers,
+// by the begin/confirm/cancel call conventions of the participants.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package saga
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+const (
+	// MetaSagaID the metadata key of the correlation id of the saga, in the calls of all its steps
+	MetaSagaID = "X-Saga-ID"
+	// MetaSagaStep the metadata key of the index of the step in the saga, from 0
+	MetaSagaStep = "X-Saga-Step"
+)
+
+// The suffixes of the participant service methods, e.g. "/payment/begin" of the route "/payment"
+const (
+	BeginSuffix   = "/begin"
+	ConfirmSuffix = "/confirm"
+	CancelSuffix  = "/cancel"
+)
+
+const (
+	// DefaultRetries the default retry times of the failed confirm and cancel calls
+	DefaultRetries = 3
+	// DefaultRetryInterval the default interval between the retries
+	DefaultRetryInterval = 100 * time.Millisecond
+)
+
+var (
+	// StatConfirmFailed the status of the saga whose confirm calls failed after the retries, to be repaired by hand
+	StatConfirmFailed = erpc.NewStatus(erpc.CodeInternalServerError, "Saga Confirm Failed", "")
+	// StatCancelFailed the status of the saga whose compensating cancel calls failed after the retries, to be repaired by hand
+	StatCancelFailed = erpc.NewStatus(erpc.CodeInternalServerError, "Saga Cancel Failed", "")
+)
+
+// Caller the peer session calling the participant, e.g. erpc.Session or *multiclient.MultiClient.
+type Caller interface {
+	Call(serviceMethod string, args interface{}, result interface{}, setting ...erpc.MessageSetting) erpc.CallCmd
+}
+
+// Step the participant of the saga.
+type Step struct {
+	// Caller the session of the participant peer
+	Caller Caller
+	// Route the route prefix of the participant, whose begin, confirm and cancel service methods
+	// are Route+BeginSuffix, Route+ConfirmSuffix and Route+CancelSuffix, e.g. the ones of peer.RouteCall(new(Payment))
+	Route string
+	// Arg the argument of the begin, confirm and cancel calls
+	Arg interface{}
+	// Result the result of the begin call, optional
+	Result interface{}
+	// Setting the settings of the calls, optional
+	Setting []erpc.MessageSetting
+}
+
+// Config the coordinator config
+type Config struct {
+	// Retries the retry times of the failed confirm and cancel calls, default DefaultRetries
+	Retries int
+	// RetryInterval the interval between the retries, default DefaultRetryInterval
+	RetryInterval time.Duration
+}
+
+// Coordinator the saga coordinator.
+// NOTE:
+//  The begin calls reserve the resources in order, e.g. freeze the payment,
+//  if all succeed, the confirm calls commit them, otherwise the cancel calls compensate the begun ones in reverse order;
+//  The failed begin step is also canceled, since it may have reserved partially,
+//  so the cancel of the participant must allow the step never begun, and both confirm and cancel must be idempotent;
+//  The confirm and cancel calls are retried, and use the background context, not canceled by the ctx of Run.
+type Coordinator struct {
+	retries       int
+	retryInterval time.Duration
+}
+
+// New creates a saga coordinator.
+func New(cfg Config) *Coordinator {
+	if cfg.Retries <= 0 {
+		cfg.Retries = DefaultRetries
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = DefaultRetryInterval
+	}
+	return &Coordinator{
+		retries:       cfg.Retries,
+		retryInterval: cfg.RetryInterval,
+	}
+}
+
+// Run runs the saga of the steps, and returns its correlation id.
+// NOTE:
+//  If a begin call fails, its status is returned after the compensations,
+//  or StatCancelFailed if some compensation failed;
+//  If some confirm call fails, StatConfirmFailed is returned.
+func (c *Coordinator) Run(ctx context.Context, steps ...*Step) (id string, stat *erpc.Status) {
+	id = newID()
+	for i, step := range steps {
+		setting := withSaga(ctx, id, i, step.Setting)
+		stat = step.Caller.Call(step.Route+BeginSuffix, step.Arg, step.Result, setting...).Status()
+		if stat.OK() {
+			continue
+		}
+		if failed := c.finish(id, steps[:i+1], CancelSuffix); len(failed) > 0 {
+			return id, StatCancelFailed.Copy(fmt.Sprintf("saga %s: begin %s: %s, cancel failed: %s", id, step.Route, stat.String(), strings.Join(failed, ", ")))
+		}
+		return id, stat
+	}
+	if failed := c.finish(id, steps, ConfirmSuffix); len(failed) > 0 {
+		return id, StatConfirmFailed.Copy(fmt.Sprintf("saga %s: confirm failed: %s", id, strings.Join(failed, ", ")))
+	}
+	return id, nil
+}
+
+// finish calls the confirm of the steps in order, or the cancel in reverse order, with the retries,
+// and returns the descriptions of the failed ones.
+func (c *Coordinator) finish(id string, steps []*Step, suffix string) (failed []string) {
+	for k := range steps {
+		i := k
+		if suffix == CancelSuffix {
+			i = len(steps) - 1 - k
+		}
+		step := steps[i]
+		setting := withSaga(context.Background(), id, i, step.Setting)
+		var stat *erpc.Status
+		for n := 0; n <= c.retries; n++ {
+			if n > 0 {
+				time.Sleep(c.retryInterval)
+			}
+			if stat = step.Caller.Call(step.Route+suffix, step.Arg, nil, setting...).Status(); stat.OK() {
+				break
+			}
+		}
+		if !stat.OK() {
+			erpc.Errorf("saga %s: %s%s: %s", id, step.Route, suffix, stat.String())
+			failed = append(failed, step.Route+suffix+": "+stat.String())
+		}
+	}
+	return failed
+}
+
+func withSaga(ctx context.Context, id string, step int, setting []erpc.MessageSetting) []erpc.MessageSetting {
+	return append(setting[:len(setting):len(setting)],
+		erpc.WithContext(ctx),
+		erpc.WithSetMeta(MetaSagaID, id),
+		erpc.WithSetMeta(MetaSagaStep, strconv.Itoa(step)),
+	)
+}
+
+func newID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// ID returns the correlation id of the saga in the participant handler, empty if not in a saga.
+func ID(ctx erpc.CallCtx) string {
+	return string(ctx.PeekMeta(MetaSagaID))
+}
+
+// StepIndex returns the index of the step in the saga in the participant handler, -1 if not in a saga.
+func StepIndex(ctx erpc.CallCtx) int {
+	i, err := strconv.Atoi(string(ctx.PeekMeta(MetaSagaStep)))
+	if err != nil {
+		return -1
+	}
+	return i
+}
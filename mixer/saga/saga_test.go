@@ -0,0 +1,101 @@
+package saga
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/andeya/erpc/v7"
+)
+
+var (
+	logMu sync.Mutex
+	log   []string
+)
+
+func record(ctx erpc.CallCtx, route string) {
+	logMu.Lock()
+	log = append(log, fmt.Sprintf("%s:%d", route, StepIndex(ctx)))
+	logMu.Unlock()
+}
+
+type Order struct{ erpc.CallCtx }
+
+func (o *Order) Begin(arg *int) (string, *erpc.Status) {
+	record(o, o.ServiceMethod())
+	return "order-" + ID(o), nil
+}
+
+func (o *Order) Confirm(arg *int) (bool, *erpc.Status) {
+	record(o, o.ServiceMethod())
+	return true, nil
+}
+
+func (o *Order) Cancel(arg *int) (bool, *erpc.Status) {
+	record(o, o.ServiceMethod())
+	return true, nil
+}
+
+type Payment struct{ erpc.CallCtx }
+
+func (p *Payment) Begin(amount *int) (bool, *erpc.Status) {
+	record(p, p.ServiceMethod())
+	if *amount > 100 {
+		return false, erpc.NewStatus(402, "Insufficient Balance", "")
+	}
+	return true, nil
+}
+
+func (p *Payment) Confirm(amount *int) (bool, *erpc.Status) {
+	record(p, p.ServiceMethod())
+	return true, nil
+}
+
+func (p *Payment) Cancel(amount *int) (bool, *erpc.Status) {
+	record(p, p.ServiceMethod())
+	return true, nil
+}
+
+func TestSaga(t *testing.T) {
+	orderSrv := erpc.NewPeer(erpc.PeerConfig{})
+	defer orderSrv.Close()
+	orderSrv.RouteCall(new(Order))
+	paymentSrv := erpc.NewPeer(erpc.PeerConfig{})
+	defer paymentSrv.Close()
+	paymentSrv.RouteCall(new(Payment))
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	orderSess, stat := erpc.ConnectPipe(orderSrv, cli)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	paymentSess, stat := erpc.ConnectPipe(paymentSrv, cli)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	run := func(amount int) (string, string, *erpc.Status) {
+		logMu.Lock()
+		log = nil
+		logMu.Unlock()
+		var orderID string
+		id, stat := New(Config{}).Run(context.Background(),
+			&Step{Caller: orderSess, Route: "/order", Arg: 1, Result: &orderID},
+			&Step{Caller: paymentSess, Route: "/payment", Arg: amount},
+		)
+		if orderID != "order-"+id {
+			t.Fatalf("order id: %q, saga id: %q", orderID, id)
+		}
+		logMu.Lock()
+		defer logMu.Unlock()
+		return id, strings.Join(log, " "), stat
+	}
+
+	if _, got, stat := run(10); !stat.OK() || got != "/order/begin:0 /payment/begin:1 /order/confirm:0 /payment/confirm:1" {
+		t.Fatalf("log: %s, stat: %v", got, stat)
+	}
+	if _, got, stat := run(1000); stat.Code() != 402 || got != "/order/begin:0 /payment/begin:1 /payment/cancel:1 /order/cancel:0" {
+		t.Fatalf("log: %s, stat: %v", got, stat)
+	}
+}
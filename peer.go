@@ -15,17 +15,22 @@
 package erpc
 
 import (
+	"context"
 	"crypto/tls"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/andeya/erpc/v7/codec"
 	"github.com/andeya/erpc/v7/kcp"
 	"github.com/andeya/erpc/v7/quic"
+	"github.com/andeya/erpc/v7/socket"
+	"github.com/andeya/erpc/v7/xfer"
 	"github.com/andeya/goutil"
 	"github.com/andeya/goutil/coarsetime"
 	"github.com/andeya/goutil/errors"
+	quicgo "github.com/lucas-clemente/quic-go"
 )
 
 type (
@@ -39,14 +44,50 @@ type (
 		GetSession(sessionID string) (Session, bool)
 		// RangeSession ranges all sessions. If fn returns false, stop traversing.
 		RangeSession(fn func(sess Session) bool)
+		// Clock returns the clock of the timers, see PeerConfig.Clock.
+		Clock() Clock
+		// CallSession sends a CALL to the session by the id, and waits for the reply.
+		// NOTE: The session is waited for by WithSessionWait, if it is not connected.
+		CallSession(sessionID, serviceMethod string, args, result interface{}, setting ...MessageSetting) CallCmd
+		// PushSession sends a PUSH to the session by the id.
+		// NOTE: The session is waited for by WithSessionWait, if it is not connected.
+		PushSession(sessionID, serviceMethod string, args interface{}, setting ...MessageSetting) *Status
 		// SetTLSConfig sets the TLS config.
 		SetTLSConfig(tlsConfig *tls.Config)
+		// RegisterALPN registers the ProtoFunc used for the TLS connections that negotiated the ALPN protocol.
+		RegisterALPN(protocol string, protoFunc ProtoFunc)
 		// SetTLSConfigFromFile sets the TLS config from file.
 		SetTLSConfigFromFile(tlsCertFile, tlsKeyFile string, insecureSkipVerifyForClient ...bool) error
 		// TLSConfig returns the TLS config.
 		TLSConfig() *tls.Config
 		// PluginContainer returns the global plugin container.
 		PluginContainer() *PluginContainer
+		// Codecs returns the body codec registry of the peer, with the global codecs as the fallback.
+		Codecs() *codec.Registry
+		// XferFilters returns the transfer filter registry of the peer, with the global filters as the fallback.
+		XferFilters() *xfer.Registry
+		// AddTLSCertificate adds the server certificate selected by the TLS SNI host.
+		AddTLSCertificate(hostPattern string, cert tls.Certificate)
+		// Stats returns the snapshot of the peer statistics.
+		Stats() Stats
+		// OnEvent registers the callback of the peer lifecycle events.
+		OnEvent(fn func(Event))
+		// Events returns a channel that receives the peer lifecycle events.
+		Events() <-chan Event
+		// DroppedEvents returns the number of the events dropped by the full channels returned by Events.
+		DroppedEvents() uint64
+		// SetBandwidth sets the maximum total bytes per second read and written by the sessions at runtime.
+		// NOTE: If readBps<=0 or writeBps<=0, no limit of it.
+		SetBandwidth(readBps, writeBps int64)
+		// Reload applies the config to the running peer without reconnecting the sessions,
+		// and returns the changed fields that require restarting the peer.
+		Reload(cfg PeerConfig) (restart []string, err error)
+		// Start validates the plugins, and executes the InitPlugins and the StartPlugins once,
+		// which is executed by ListenAndServe, ServeListener and ListenOn automatically.
+		Start() error
+		// Tap streams the copies of the messages matching the filter read and written by the sessions,
+		// until cancel is called, which closes the channel.
+		Tap(filter TapFilter) (copies <-chan MessageCopy, cancel func())
 	}
 	// EarlyPeer the communication peer that has just been created
 	EarlyPeer interface {
@@ -55,6 +96,8 @@ type (
 		Router() *Router
 		// SubRoute adds handler group.
 		SubRoute(pathPrefix string, plugin ...Plugin) *SubRouter
+		// SNIRouter returns the isolated router for the sessions whose TLS SNI host matches the host pattern.
+		SNIRouter(hostPattern string) *Router
 		// RouteCall registers CALL handlers, and returns the paths.
 		RouteCall(ctrlStruct interface{}, plugin ...Plugin) []string
 		// RouteCallFunc registers CALL handler, and returns the path.
@@ -71,10 +114,17 @@ type (
 	// Peer the communication peer which is server or client role
 	Peer interface {
 		EarlyPeer
+		// ListenOn adds a listening address served by ListenAndServe, besides the configured one.
+		ListenOn(network, addr string) error
 		// ListenAndServe turns on the listening service.
 		ListenAndServe(protoFunc ...ProtoFunc) error
+		// ServeListener serves the listener created externally, e.g. by systemd socket activation.
+		ServeListener(lis net.Listener, protoFunc ...ProtoFunc) error
 		// Dial connects with the peer of the destination address.
 		Dial(addr string, protoFunc ...ProtoFunc) (Session, *Status)
+		// DialContext connects with the peer of the destination address, until the context is done,
+		// with the per-dial options overriding the peer settings, e.g. WithDialTLSConfig.
+		DialContext(ctx context.Context, addr string, opts ...DialOption) (Session, *Status)
 		// ServeConn serves the connection and returns a session.
 		// NOTE:
 		//  Not support automatically redials after disconnection;
@@ -98,17 +148,60 @@ type peer struct {
 	defaultSessionAge time.Duration // Default session max age, if less than or equal to 0, no time limit
 	defaultContextAge time.Duration // Default CALL or PUSH context max age, if less than or equal to 0, no time limit
 	tlsConfig         *tls.Config
-	slowCometDuration time.Duration
-	timeNow           func() int64
+	slowCometDuration int64           // atomic, the slow operation alarm threshold, can be changed by Reload
+	flushInterval     time.Duration   // Maximum delay of coalescing the small messages into one write
+	seq64             bool            // Is negotiate the 64-bit seq or not
+	negotiateCodec    bool            // Is negotiate the default body codec of the session or not
+	compressFilter    xfer.XferFilter // the compression filter of the auto compression, nil means disabled
+	autoCompressBytes int             // the default threshold of the auto compression
+	fragmentSize      int             // the max body size of a frame written, <=0 means never fragment
+	maxReassemblySize int             // the max body size reassembled from the frames read, <=0 means the read limit
+	readLimit         uint32          // the max size of the messages read by the sessions, 0 means the global one
+	metaLimits        metaLimits      // the limits of the metadata of the CALL and PUSH read
+	protoFunc         ProtoFunc       // the default protoFunc set by WithProtoFunc, nil means the global one
+	logger            Logger          // the logger set by WithLogger, nil means the global logger
+	codecs            *codec.Registry // the body codecs of the peer, see WithCodecs
+	xferFilters       *xfer.Registry  // the transfer filters of the peer, see WithXferFilters
+	clock             Clock
 	mu                sync.Mutex
 	network           string
 	defaultBodyCodec  byte
-	printDetail       bool
-	countTime         bool
+	printDetail       int32               // atomic, can be changed by Reload
+	countTime         int32               // atomic, can be changed by Reload
+	handlerPool       *workerPool         // schedules handlers by message priority; nil means the global goroutine pool
+	admission         *admissionQueue     // queues the handlers when the global goroutine pool is saturated; nil means disabled
+	readLimiter       *socket.RateLimiter // the total read bandwidth of the sessions
+	writeLimiter      *socket.RateLimiter // the total write bandwidth of the sessions
+	sessionReadBps    int64               // atomic, the default read bandwidth of each session
+	sessionWriteBps   int64               // atomic, the default write bandwidth of each session
+	config            PeerConfig          // the checked config, updated by Reload
+	lifecycle         pluginLifecycle
+	taps              tapHub
+	reloadMu          sync.Mutex
+	stats             stats
+	events            eventBus
+	sniHosts          sniHosts
+	alpn              alpnProtos
+	slowConsumer      *slowConsumerMonitor // nil means the slow consumer detection is disabled
+	idle              *idleMonitor         // nil means the idle detection is disabled
+	pinger            *pingMonitor         // nil means the automatic pings are disabled
+	pingDeadAfter     int32                // the number of the consecutive failed pings of the dead session
+	socketOptions     socket.Options
+	kcpConfig         kcp.Config
+	quicConfig        *quicgo.Config
+	quicEarly         bool
+	redialPending     bool
 
 	// only for server role
-	listenAddr net.Addr
-	listeners  map[net.Listener]struct{}
+	listenAddr       net.Addr
+	extraListenAddrs []net.Addr // added by ListenOn
+	serving          bool
+	listeners        map[net.Listener]struct{}
+	acceptLimiter    *acceptLimiter
+	proxyTrusted     []string // nil means the PROXY protocol is disabled
+	handoffSessions  bool     // pass the sessions to the new process on Reboot
+	reusePort        int      // the number of the listeners of each tcp address by SO_REUSEPORT
+	tcpFastOpen      int      // the max length of the pending TCP Fast Open requests
 
 	// only for client role
 	dialer *Dialer
@@ -118,6 +211,7 @@ type peer struct {
 func NewPeer(cfg PeerConfig, globalLeftPlugin ...Plugin) Peer {
 	doPrintPid()
 	pluginContainer := newPluginContainer()
+	globalLeftPlugin, opts := splitPeerOptions(globalLeftPlugin)
 	pluginContainer.AppendLeft(globalLeftPlugin...)
 	pluginContainer.preNewPeer(&cfg)
 	if err := cfg.check(); err != nil {
@@ -125,36 +219,100 @@ func NewPeer(cfg PeerConfig, globalLeftPlugin ...Plugin) Peer {
 	}
 
 	var p = &peer{
-		router:            newRouter(pluginContainer),
+		router:            newRouter(pluginContainer, newHandlerPools()),
 		pluginContainer:   pluginContainer,
 		sessHub:           newSessionHub(),
 		defaultSessionAge: cfg.DefaultSessionAge,
 		defaultContextAge: cfg.DefaultContextAge,
 		closeCh:           make(chan struct{}),
-		slowCometDuration: cfg.slowCometDuration,
+		slowCometDuration: int64(cfg.slowCometDuration),
+		flushInterval:     cfg.FlushInterval,
+		seq64:             cfg.Seq64,
+		negotiateCodec:    cfg.NegotiateCodec,
+		autoCompressBytes: cfg.AutoCompressBytes,
+		fragmentSize:      cfg.FragmentSize,
+		maxReassemblySize: cfg.MaxReassemblySize,
+		readLimit:         cfg.ReadLimit,
+		metaLimits:        newMetaLimits(&cfg),
 		network:           cfg.Network,
 		listenAddr:        cfg.listenAddr,
-		printDetail:       cfg.PrintDetail,
-		countTime:         cfg.CountTime,
+		printDetail:       boolToInt32(cfg.PrintDetail),
+		countTime:         boolToInt32(cfg.CountTime),
 		listeners:         make(map[net.Listener]struct{}),
+		acceptLimiter:     newAcceptLimiter(&cfg),
+		readLimiter:       socket.NewRateLimiter(cfg.ReadBps),
+		writeLimiter:      socket.NewRateLimiter(cfg.WriteBps),
+		sessionReadBps:    cfg.SessionReadBps,
+		sessionWriteBps:   cfg.SessionWriteBps,
+		kcpConfig:         cfg.kcpConfig(),
+		quicConfig:        cfg.quicConfig(true),
+		quicEarly:         cfg.QUIC0RTT,
+		redialPending:     cfg.RedialPending,
+		pingDeadAfter:     int32(cfg.PingDeadAfter),
+		config:            cfg,
+		codecs:            codec.NewRegistry(),
+		xferFilters:       xfer.NewRegistry(),
+		socketOptions: socket.Options{
+			KeepAlive:   cfg.SocketKeepAlive,
+			ReadBuffer:  cfg.SocketReadBuffer,
+			WriteBuffer: cfg.SocketWriteBuffer,
+			NoDelay:     cfg.SocketNoDelay,
+		},
 		dialer: &Dialer{
 			network:        cfg.Network,
 			dialTimeout:    cfg.DialTimeout,
 			localAddr:      cfg.localAddr,
 			redialInterval: cfg.RedialInterval,
 			redialTimes:    cfg.RedialTimes,
+			kcpConfig:      cfg.kcpConfig(),
+			quicConfig:     cfg.quicConfig(false),
+			quicEarly:      cfg.QUIC0RTT,
 		},
 	}
+	if cfg.QUIC0RTT {
+		p.dialer.quicSessions = tls.NewLRUClientSessionCache(0)
+	}
+	for _, o := range opts {
+		o.apply(p)
+	}
 
-	if c, err := codec.GetByName(cfg.DefaultBodyCodec); err != nil {
+	if c, err := p.codecs.GetByName(cfg.DefaultBodyCodec); err != nil {
 		Fatalf("%v", err)
 	} else {
 		p.defaultBodyCodec = c.ID()
 	}
-	if p.countTime {
-		p.timeNow = func() int64 { return time.Now().UnixNano() }
+	if cfg.HandlerWorkers > 0 {
+		p.handlerPool = newWorkerPool(cfg.HandlerWorkers)
 	} else {
-		p.timeNow = func() int64 { return 0 }
+		p.admission = newAdmissionQueue(cfg.AdmissionQueue, cfg.MaxQueueDelay)
+	}
+	setLogLevel(cfg.LogLevel)
+	if cfg.ProxyProtocol {
+		p.proxyTrusted = append([]string{}, cfg.proxyTrustedCIDRs()...)
+	}
+	p.handoffSessions = cfg.HandoffSessions
+	p.reusePort = cfg.ReusePort
+	p.tcpFastOpen = cfg.TCPFastOpen
+	if cfg.CompressFilter != "" {
+		var err error
+		if p.compressFilter, err = p.xferFilters.GetByName(cfg.CompressFilter); err != nil {
+			Fatalf("Invalid compress_filter config: %v", err)
+		}
+	}
+	if cfg.Clock != nil {
+		p.clock = cfg.Clock
+	} else {
+		p.clock = SystemClock
+	}
+	p.dialer.clock = p.clock
+	if p.slowConsumer = newSlowConsumerMonitor(p, &cfg); p.slowConsumer != nil {
+		p.slowConsumer.start()
+	}
+	if p.idle = newIdleMonitor(p, &cfg); p.idle != nil {
+		p.idle.start()
+	}
+	if p.pinger = newPingMonitor(p, &cfg); p.pinger != nil {
+		p.pinger.start()
 	}
 	addPeer(p)
 	p.pluginContainer.postNewPeer(p)
@@ -166,6 +324,21 @@ func (p *peer) PluginContainer() *PluginContainer {
 	return p.pluginContainer
 }
 
+// Codecs returns the body codec registry of the peer, with the global codecs as the fallback.
+func (p *peer) Codecs() *codec.Registry {
+	return p.codecs
+}
+
+// XferFilters returns the transfer filter registry of the peer, with the global filters as the fallback.
+func (p *peer) XferFilters() *xfer.Registry {
+	return p.xferFilters
+}
+
+// withRegistries returns the message setting of the registries of the peer.
+func (p *peer) withRegistries() MessageSetting {
+	return socket.WithRegistries(p.codecs, p.xferFilters)
+}
+
 // TLSConfig returns the TLS config.
 func (p *peer) TLSConfig() *tls.Config {
 	return p.tlsConfig
@@ -174,7 +347,7 @@ func (p *peer) TLSConfig() *tls.Config {
 // SetTLSConfig sets the TLS config.
 func (p *peer) SetTLSConfig(tlsConfig *tls.Config) {
 	p.tlsConfig = tlsConfig
-	p.dialer.tlsConfig = tlsConfig
+	p.dialer.tlsConfig = p.withALPN(tlsConfig)
 }
 
 // SetTLSConfigFromFile sets the TLS config from file.
@@ -186,6 +359,13 @@ func (p *peer) SetTLSConfigFromFile(tlsCertFile, tlsKeyFile string, insecureSkip
 	return err
 }
 
+// SetBandwidth sets the maximum total bytes per second read and written by the sessions at runtime.
+// NOTE: If readBps<=0 or writeBps<=0, no limit of it.
+func (p *peer) SetBandwidth(readBps, writeBps int64) {
+	p.readLimiter.SetRate(readBps)
+	p.writeLimiter.SetRate(writeBps)
+}
+
 // GetSession gets the session by id.
 func (p *peer) GetSession(sessionID string) (Session, bool) {
 	return p.sessHub.get(sessionID)
@@ -199,6 +379,11 @@ func (p *peer) RangeSession(fn func(sess Session) bool) {
 	})
 }
 
+// Clock returns the clock of the timers, see PeerConfig.Clock.
+func (p *peer) Clock() Clock {
+	return p.clock
+}
+
 // CountSession returns the number of sessions.
 func (p *peer) CountSession() int {
 	return p.sessHub.len()
@@ -206,36 +391,84 @@ func (p *peer) CountSession() int {
 
 // Dial connects with the peer of the destination address.
 func (p *peer) Dial(addr string, protoFunc ...ProtoFunc) (Session, *Status) {
+	return p.DialContext(context.Background(), addr, WithDialProtoFunc(protoFunc...))
+}
+
+// DialContext connects with the peer of the destination address, until the context is done.
+// NOTE: The context only bounds the dial and handshake, not the redialing after disconnection.
+func (p *peer) DialContext(ctx context.Context, addr string, opts ...DialOption) (Session, *Status) {
+	o := new(dialOptions)
+	for _, fn := range opts {
+		if fn != nil {
+			fn(o)
+		}
+	}
+	dialer, err := o.dialer(p.dialer)
+	if err != nil {
+		p.events.emit(Event{Type: EventDialFailed, Network: p.network, Addr: addr, Err: err})
+		return nil, statDialFailed.Copy(err)
+	}
+	protoFunc := p.withProtoFunc(o.protoFuncs)
 	var sess = newSession(p, nil, protoFunc)
-	_, err := p.dialer.dialWithRetry(addr, "", func(conn net.Conn) error {
-		sess.socket.Reset(conn, protoFunc...)
+	if o.meta != nil {
+		sess.dialMeta.Store(o.meta)
+	}
+	if err = sess.AppendPlugins(o.plugins...); err != nil {
+		return nil, statDialFailed.Copy(err)
+	}
+	// the rejection of the PostDial plugins is returned as is, e.g. the typed status of the auth handshake
+	var rejected *Status
+	_, err = dialer.dialWithRetry(ctx, addr, "", func(conn net.Conn) error {
+		stop := interruptByContext(ctx, conn)
+		sess.socket.Reset(conn, p.selectALPN(conn, protoFunc)...)
 		sess.socket.SetID(sess.LocalAddr().String())
-		if stat := p.pluginContainer.postDial(sess, false); !stat.OK() {
+		rejected = sess.withPlugins(p.pluginContainer).postDial(sess, false)
+		stat := rejected
+		if stat.OK() {
+			stat = sess.sendDialMeta()
+		}
+		stop()
+		if !stat.OK() {
 			conn.Close()
 			return stat.Cause()
 		}
+		if err := ctx.Err(); err != nil {
+			conn.Close()
+			return err
+		}
 		return nil
 	})
 	if err != nil {
+		p.events.emit(Event{Type: EventDialFailed, Network: p.network, Addr: addr, Err: err})
+		if !rejected.OK() && ctx.Err() == nil {
+			return nil, rejected
+		}
 		return nil, statDialFailed.Copy(err)
 	}
 
 	// create redial func
-	if p.dialer.RedialTimes() != 0 {
+	if dialer.RedialTimes() != 0 {
 		sess.redialForClientLocked = func() bool {
 			oldID := sess.ID()
 			oldIP := sess.LocalAddr().String()
+			oldRemote := sess.RemoteAddr().String()
 			oldConn := sess.getConn()
+			migrating := atomic.SwapInt32(&sess.migrating, 0) == 1
+			sess.emitLocked(p.sessionEvent(EventRedialStarted, sess))
 
-			_, err := p.dialer.dialWithRetry(addr, oldID, func(conn net.Conn) error {
-				sess.socket.Reset(conn, protoFunc...)
+			_, err := dialer.dialWithRetry(context.Background(), addr, oldID, func(conn net.Conn) error {
+				sess.socket.Reset(conn, p.selectALPN(conn, protoFunc)...)
 				if oldIP == oldID {
 					sess.socket.SetID(sess.LocalAddr().String())
 				} else {
 					sess.socket.SetID(oldID)
 				}
 				sess.changeStatus(statusPreparing)
-				if stat := p.pluginContainer.postDial(sess, true); !stat.OK() {
+				stat := sess.withPlugins(p.pluginContainer).postDial(sess, true)
+				if stat.OK() {
+					stat = sess.sendDialMeta()
+				}
+				if !stat.OK() {
 					conn.Close()
 					sess.changeStatus(statusRedialing)
 					return stat.Cause()
@@ -247,16 +480,29 @@ func (p *peer) Dial(addr string, protoFunc ...ProtoFunc) (Session, *Status) {
 				sess.closeLocked()
 				sess.tryChangeStatus(statusRedialFailed, statusRedialing)
 				Errorf("redial fail (network:%s, addr:%s, id:%s): %s", p.network, addr, oldID, err.Error())
+				sess.emitLocked(Event{Type: EventRedialFailed, Session: sess, Network: p.network, Addr: addr, Err: err})
 				return false
 			}
 
 			if oldConn != nil {
 				oldConn.Close()
 			}
+			// NOTE: The new connection may be accepted by an old peer, so negotiate the 64-bit seq and the fragmentation again.
+			atomic.StoreInt32(&sess.seq64, 0)
+			sess.socket.(socket.UnsafeSocket).SetFragmentSize(0)
 			sess.changeStatus(statusOk)
 			AnywayGo(sess.startReadAndHandle)
+			AnywayGo(sess.negotiateSeq64)
+			AnywayGo(sess.negotiateCodec)
+			AnywayGo(sess.negotiateFragment)
 			p.sessHub.set(sess)
 			Infof("redial ok (network:%s, addr:%s, id:%s)", p.network, addr, sess.ID())
+			sess.emitLocked(p.sessionEvent(EventRedialSucceeded, sess))
+			if migrating || pathChanged(oldIP, oldRemote, sess) {
+				e := p.sessionEvent(EventPathChanged, sess)
+				e.OldPath = oldIP + "->" + oldRemote
+				sess.emitLocked(e)
+			}
 			return true
 		}
 	}
@@ -264,7 +510,11 @@ func (p *peer) Dial(addr string, protoFunc ...ProtoFunc) (Session, *Status) {
 	Infof("dial ok (network:%s, addr:%s, id:%s)", p.network, addr, sess.ID())
 	sess.changeStatus(statusOk)
 	AnywayGo(sess.startReadAndHandle)
+	sess.negotiateSeq64()
+	sess.negotiateCodec()
+	sess.negotiateFragment()
 	p.sessHub.set(sess)
+	p.emitSessionEvent(EventSessionDialed, sess)
 	return sess, nil
 }
 
@@ -286,6 +536,7 @@ func (p *peer) ServeConn(conn net.Conn, protoFunc ...ProtoFunc) (Session, *Statu
 		}
 		network = "kcp"
 	}
+	protoFunc = p.withProtoFunc(protoFunc)
 	var sess = newSession(p, conn, protoFunc)
 	if stat := p.pluginContainer.postAccept(sess); !stat.OK() {
 		sess.Close()
@@ -295,6 +546,7 @@ func (p *peer) ServeConn(conn net.Conn, protoFunc ...ProtoFunc) (Session, *Statu
 	sess.changeStatus(statusOk)
 	AnywayGo(sess.startReadAndHandle)
 	p.sessHub.set(sess)
+	p.emitSessionEvent(EventSessionAccepted, sess)
 	return sess, nil
 }
 
@@ -303,9 +555,21 @@ var ErrListenClosed = errors.New("listener is closed")
 
 // serveListener serves the listener.
 // NOTE: The caller ensures that the listener supports graceful shutdown.
-func (p *peer) serveListener(lis net.Listener, protoFunc ...ProtoFunc) error {
+func (p *peer) serveListener(lis net.Listener, protoFunc ...ProtoFunc) (err error) {
 	defer lis.Close()
+	if err = p.Start(); err != nil {
+		return err
+	}
+	protoFunc = p.withProtoFunc(protoFunc)
+	p.mu.Lock()
+	select {
+	case <-p.closeCh:
+		p.mu.Unlock()
+		return ErrListenClosed
+	default:
+	}
 	p.listeners[lis] = struct{}{}
+	p.mu.Unlock()
 
 	network := lis.Addr().Network()
 	switch lis.(type) {
@@ -319,6 +583,11 @@ func (p *peer) serveListener(lis net.Listener, protoFunc ...ProtoFunc) error {
 	Printf("listen and serve (network:%s, addr:%s)", network, addr)
 
 	p.pluginContainer.postListen(lis.Addr())
+	p.emitListenerEvent(EventListenerStarted, network, lis.Addr(), nil)
+	defer func() {
+		p.emitListenerEvent(EventListenerStopped, network, lis.Addr(), err)
+	}()
+	p.resumeSessions(lis, protoFunc)
 
 	var (
 		tempDelay time.Duration // how long to sleep on accept failure
@@ -350,7 +619,12 @@ func (p *peer) serveListener(lis net.Listener, protoFunc ...ProtoFunc) error {
 			return e
 		}
 		tempDelay = 0
+		if stat := p.acceptLimiter.acquire(); !stat.OK() {
+			AnywayGo(func() { p.acceptLimiter.reject(conn, stat, protoFunc...) })
+			continue
+		}
 		AnywayGo(func() {
+			defer p.acceptLimiter.release()
 			if c, ok := conn.(*tls.Conn); ok {
 				if p.defaultSessionAge > 0 {
 					c.SetReadDeadline(coarsetime.CeilingTimeNow().Add(p.defaultSessionAge))
@@ -363,7 +637,10 @@ func (p *peer) serveListener(lis net.Listener, protoFunc ...ProtoFunc) error {
 					return
 				}
 			}
-			var sess = newSession(p, conn, protoFunc)
+			var sess = newSession(p, conn, p.selectALPN(conn, protoFunc))
+			if c, ok := conn.(*tls.Conn); ok {
+				p.routeBySNI(sess, c)
+			}
 			if stat := p.pluginContainer.postAccept(sess); !stat.OK() {
 				sess.Close()
 				return
@@ -371,18 +648,40 @@ func (p *peer) serveListener(lis net.Listener, protoFunc ...ProtoFunc) error {
 			Infof("accept ok (network:%s, addr:%s, id:%s)", network, sess.RemoteAddr().String(), sess.ID())
 			p.sessHub.set(sess)
 			sess.changeStatus(statusOk)
+			p.emitSessionEvent(EventSessionAccepted, sess)
 			sess.startReadAndHandle()
 		})
 	}
 }
 
-// ListenAndServe turns on the listening service.
+// ListenAndServe turns on the listening service,
+// on the configured address and the addresses added by ListenOn.
+// NOTE: It returns the first error after all the listeners are stopped.
 func (p *peer) ListenAndServe(protoFunc ...ProtoFunc) error {
-	lis, err := NewInheritedListener(p.listenAddr, p.tlsConfig)
-	if err != nil {
-		Fatalf("%v", err)
+	p.mu.Lock()
+	p.serving = true
+	addrs := append([]net.Addr{p.listenAddr}, p.extraListenAddrs...)
+	p.mu.Unlock()
+	lises := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		var addrLises []net.Listener
+		var err error
+		if isTCP(addr.Network()) && (p.reusePort > 0 || p.tcpFastOpen > 0) {
+			addrLises, err = p.listenTCP(addr)
+		} else {
+			var lis net.Listener
+			lis, err = p.listen(addr)
+			addrLises = []net.Listener{lis}
+		}
+		if err != nil {
+			for _, lis := range lises {
+				lis.Close()
+			}
+			Fatalf("%v", err)
+		}
+		lises = append(lises, addrLises...)
 	}
-	return p.serveListener(lis, protoFunc...)
+	return p.serveListeners(lises, protoFunc...)
 }
 
 // Close closes peer.
@@ -393,7 +692,13 @@ func (p *peer) Close() (err error) {
 		}
 	}()
 	close(p.closeCh)
+	p.mu.Lock()
+	listeners := make([]net.Listener, 0, len(p.listeners))
 	for lis := range p.listeners {
+		listeners = append(listeners, lis)
+	}
+	p.mu.Unlock()
+	for _, lis := range listeners {
 		if _, ok := lis.(*quic.Listener); !ok {
 			lis.Close()
 		}
@@ -414,14 +719,65 @@ func (p *peer) Close() (err error) {
 		err = errors.Merge(err, <-errCh)
 	}
 	close(errCh)
-	for lis := range p.listeners {
+	for _, lis := range listeners {
 		if qlis, ok := lis.(*quic.Listener); ok {
 			err = errors.Merge(err, qlis.Close())
 		}
 	}
+	if p.handlerPool != nil {
+		p.handlerPool.stop()
+	}
+	if p.admission != nil {
+		p.admission.stop()
+	}
+	p.router.pools.stop()
+	err = errors.Merge(err, p.stopPlugins())
 	return err
 }
 
+// goHandle executes the message handling function,
+// in the worker pool selected by SelectHandlerPoolPlugin,
+// or in the worker pool of the handler if it is set by WithHandlerPool,
+// or in order of message priority if PeerConfig.HandlerWorkers>0,
+// or in the admission queue if the global goroutine pool is saturated and PeerConfig.AdmissionQueue>0.
+// Returns false if insufficient resources.
+func (p *peer) goHandle(ctx *handlerCtx, fn func()) bool {
+	if ctx.pluginContainer != nil {
+		if spec := ctx.pluginContainer.selectHandlerPool(ctx); spec != nil && spec.MaxGoroutines > 0 {
+			pool := &handlerPool{name: spec.Name, maxGoroutines: spec.MaxGoroutines}
+			if spec.MaxQueue > 0 {
+				pool.maxQueue = spec.MaxQueue
+			}
+			pool, err := p.router.pools.get(pool)
+			if err == nil {
+				return submitHandlerPool(pool, ctx, fn)
+			}
+			Errorf("SelectHandlerPool: %s", err.Error())
+		}
+	}
+	if h := ctx.handler; h != nil && h.pool != nil {
+		return submitHandlerPool(h.pool, ctx, fn)
+	}
+	if p.handlerPool == nil {
+		if p.admission != nil {
+			return p.admission.submit(ctx, fn)
+		}
+		return Go(fn)
+	}
+	return p.handlerPool.submit(GetPriority(ctx.input.Meta()), fn)
+}
+
+func submitHandlerPool(pool *handlerPool, ctx *handlerCtx, fn func()) bool {
+	if pool.submit(GetPriority(ctx.input.Meta()), fn) {
+		return true
+	}
+	// NOTE: reject it quickly, without occupying the isolated pool
+	if ctx.stat.OK() {
+		ctx.stat = statServiceUnavailable.Copy("handler pool is full: " + pool.name)
+	}
+	return Go(fn)
+}
+
 var ctxPool = sync.Pool{
 	New: func() interface{} {
 		return newReadHandleCtx()
@@ -440,6 +796,8 @@ func (p *peer) getContext(s *session, withWg bool) *handlerCtx {
 }
 
 func (p *peer) putContext(ctx *handlerCtx, withWg bool) {
+	ctx.releaseHandlerCancel()
+	ctx.releaseBody()
 	if withWg {
 		// count get context
 		ctx.sess.graceCtxWaitGroup.Done()
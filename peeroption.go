@@ -0,0 +1,145 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"crypto/tls"
+
+	"github.com/andeya/erpc/v7/codec"
+	"github.com/andeya/erpc/v7/xfer"
+)
+
+// PeerOption the option of NewPeer to construct the peer in code, which is passed along with the plugins,
+// instead of mutating the globals shared by the peers, e.g. SetDefaultProtoFunc.
+//  e.g. erpc.NewPeer(cfg, erpc.WithPlugins(p1, p2), erpc.WithTLS(tlsConfig), erpc.WithProtoFunc(f), erpc.WithLogger(l))
+// NOTE:
+//  It implements Plugin only to be passed to NewPeer, and is not added to the plugin container.
+type PeerOption struct {
+	name    string
+	plugins []Plugin
+	apply   func(*peer)
+}
+
+// Name returns the option name.
+func (o *PeerOption) Name() string {
+	return "peer-option:" + o.name
+}
+
+// WithPlugins adds the global plugins to the peer, in the order of the options.
+func WithPlugins(plugins ...Plugin) *PeerOption {
+	return &PeerOption{name: "plugins", plugins: plugins}
+}
+
+// WithTLS sets the TLS config of the peer, the same as Peer.SetTLSConfig.
+func WithTLS(tlsConfig *tls.Config) *PeerOption {
+	return &PeerOption{name: "tls", apply: func(p *peer) {
+		p.SetTLSConfig(tlsConfig)
+	}}
+}
+
+// WithProtoFunc sets the default socket communication protocol of the peer, instead of SetDefaultProtoFunc,
+// which is used by Dial, DialContext, ListenAndServe, ServeListener and ServeConn without protoFunc.
+func WithProtoFunc(protoFunc ProtoFunc) *PeerOption {
+	return &PeerOption{name: "proto", apply: func(p *peer) {
+		p.protoFunc = protoFunc
+	}}
+}
+
+// WithLogger sets the logger of the sessions and the contexts of the peer, instead of the global logger,
+// i.e. the Logger methods of Session, CallCtx, PushCtx and CallCmd, and the run logs of the messages.
+// NOTE:
+//  The peer-wide logs, e.g. of listening, are still written by the global logger.
+func WithLogger(logger Logger) *PeerOption {
+	return &PeerOption{name: "logger", apply: func(p *peer) {
+		p.logger = logger
+	}}
+}
+
+// WithCodecs registers the body codecs to the peer, instead of codec.Reg,
+// which shadow the global ones of the same id or name only in the peer, e.g. for PeerConfig.DefaultBodyCodec.
+// NOTE: The codecs can also be registered by Peer.Codecs().Reg later.
+func WithCodecs(codecs ...codec.Codec) *PeerOption {
+	return &PeerOption{name: "codecs", apply: func(p *peer) {
+		for _, c := range codecs {
+			p.codecs.Reg(c)
+		}
+	}}
+}
+
+// WithXferFilters registers the transfer filters to the peer, instead of xfer.Reg,
+// which shadow the global ones of the same id or name only in the peer, e.g. for PeerConfig.CompressFilter.
+// NOTE: The filters can also be registered by Peer.XferFilters().Reg later.
+func WithXferFilters(filters ...xfer.XferFilter) *PeerOption {
+	return &PeerOption{name: "xfer-filters", apply: func(p *peer) {
+		for _, f := range filters {
+			p.xferFilters.Reg(f)
+		}
+	}}
+}
+
+// splitPeerOptions returns the plugins expanded by WithPlugins, and the other options.
+func splitPeerOptions(plugins []Plugin) ([]Plugin, []*PeerOption) {
+	var (
+		ps   = make([]Plugin, 0, len(plugins))
+		opts []*PeerOption
+	)
+	for _, plugin := range plugins {
+		o, ok := plugin.(*PeerOption)
+		if !ok || o == nil {
+			ps = append(ps, plugin)
+			continue
+		}
+		ps = append(ps, o.plugins...)
+		if o.apply != nil {
+			opts = append(opts, o)
+		}
+	}
+	return ps, opts
+}
+
+// withProtoFunc returns the protoFunc, or the default one of the peer set by WithProtoFunc if empty.
+func (p *peer) withProtoFunc(protoFunc []ProtoFunc) []ProtoFunc {
+	if len(protoFunc) == 0 && p.protoFunc != nil {
+		return []ProtoFunc{p.protoFunc}
+	}
+	return protoFunc
+}
+
+// logf writes the log by the logger set by WithLogger, or the global logger.
+func (p *peer) logf(level LoggerLevel, format string, a ...interface{}) {
+	l := p.logger
+	if l == nil {
+		loggerOutputDepth(4, level, format, a...)
+		return
+	}
+	switch level {
+	case PRINT:
+		l.Printf(format, a...)
+	case CRITICAL:
+		l.Criticalf(format, a...)
+	case ERROR:
+		l.Errorf(format, a...)
+	case WARNING:
+		l.Warnf(format, a...)
+	case NOTICE:
+		l.Noticef(format, a...)
+	case INFO:
+		l.Infof(format, a...)
+	case DEBUG:
+		l.Debugf(format, a...)
+	case TRACE:
+		l.Tracef(format, a...)
+	}
+}
@@ -0,0 +1,97 @@
+package erpc
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/andeya/erpc/v7/socket"
+)
+
+type optionLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *optionLogger) logf(format string, a ...interface{}) {
+	l.mu.Lock()
+	l.lines = append(l.lines, fmt.Sprintf(format, a...))
+	l.mu.Unlock()
+}
+
+func (l *optionLogger) has(s string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range l.lines {
+		if strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *optionLogger) Printf(format string, a ...interface{})    { l.logf(format, a...) }
+func (l *optionLogger) Fatalf(format string, a ...interface{})    { l.logf(format, a...) }
+func (l *optionLogger) Panicf(format string, a ...interface{})    { l.logf(format, a...) }
+func (l *optionLogger) Criticalf(format string, a ...interface{}) { l.logf(format, a...) }
+func (l *optionLogger) Errorf(format string, a ...interface{})    { l.logf(format, a...) }
+func (l *optionLogger) Warnf(format string, a ...interface{})     { l.logf(format, a...) }
+func (l *optionLogger) Noticef(format string, a ...interface{})   { l.logf(format, a...) }
+func (l *optionLogger) Infof(format string, a ...interface{})     { l.logf(format, a...) }
+func (l *optionLogger) Debugf(format string, a ...interface{})    { l.logf(format, a...) }
+func (l *optionLogger) Tracef(format string, a ...interface{})    { l.logf(format, a...) }
+
+type optionPlugin string
+
+func (p optionPlugin) Name() string { return string(p) }
+
+func option_greet(ctx CallCtx, arg *string) (string, *Status) {
+	ctx.Infof("greet %s", *arg)
+	return "hello " + *arg, nil
+}
+
+func TestPeerOption(t *testing.T) {
+	var protos int32
+	protoFunc := func(rw socket.IOWithReadBuffer) socket.Proto {
+		atomic.AddInt32(&protos, 1)
+		return socket.DefaultProtoFunc()(rw)
+	}
+	l := new(optionLogger)
+	srv := NewPeer(PeerConfig{},
+		optionPlugin("a"),
+		WithPlugins(optionPlugin("b"), optionPlugin("c")),
+		WithProtoFunc(protoFunc),
+		WithLogger(l),
+	)
+	defer srv.Close()
+	srv.RouteCallFunc(option_greet)
+	var names []string
+	for _, plugin := range srv.PluginContainer().GetAll() {
+		names = append(names, plugin.Name())
+	}
+	if strings.Join(names, ",") != "a,b,c" {
+		t.Fatalf("plugins: %v", names)
+	}
+
+	cli := NewPeer(PeerConfig{}, WithProtoFunc(protoFunc))
+	defer cli.Close()
+	sess, stat := ConnectPipe(srv, cli)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var reply string
+	if stat = sess.Call("/option/greet", "erpc", &reply).Status(); !stat.OK() || reply != "hello erpc" {
+		t.Fatalf("reply: %q, stat: %v", reply, stat)
+	}
+	if n := atomic.LoadInt32(&protos); n != 2 {
+		t.Fatalf("expect the proto of both sessions by WithProtoFunc, got %d", n)
+	}
+	if !l.has("greet erpc") {
+		t.Fatalf("expect the context log by WithLogger, got %q", l.lines)
+	}
+	if !l.has("/option/greet") {
+		t.Fatalf("expect the run log by WithLogger, got %q", l.lines)
+	}
+}
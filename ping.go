@@ -0,0 +1,198 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// PingServiceMethod the service method of the application ping and pong,
+	// it is a PUSH handled by the framework, and the old peer not supporting it logs it as the unknown PUSH.
+	PingServiceMethod = "/erpc/ping"
+	// MetaPing the key of the id of the ping
+	MetaPing = "X-Ping"
+	// MetaPong the key of the id of the ping answered by the pong
+	MetaPong = "X-Pong"
+)
+
+// Liveness the liveness state of a session by the application pings, see Session.Liveness.
+type Liveness int32
+
+// The liveness states.
+const (
+	// LivenessHealthy the last ping is answered, or no ping has failed yet
+	LivenessHealthy Liveness = iota
+	// LivenessSuspect the last pings failed, but fewer than PeerConfig.PingDeadAfter
+	LivenessSuspect
+	// LivenessDead at least PeerConfig.PingDeadAfter consecutive pings failed
+	LivenessDead
+)
+
+var livenessText = map[Liveness]string{
+	LivenessHealthy: "healthy",
+	LivenessSuspect: "suspect",
+	LivenessDead:    "dead",
+}
+
+// String returns the liveness text.
+func (l Liveness) String() string {
+	if s, ok := livenessText[l]; ok {
+		return s
+	}
+	return "unknown liveness"
+}
+
+// defaultPingDeadAfter the default number of the consecutive failed pings of the dead session
+const defaultPingDeadAfter = 3
+
+// Ping sends a ping to the remote peer and waits for the pong until ctx is done,
+// returns the round-trip time by the peer clock.
+// NOTE:
+//  The pong is answered by the framework of the remote peer when reading the ping, not by a handler;
+//  The result updates Session.Liveness and Session.RTT, except when the session is closed.
+func (s *session) Ping(ctx context.Context) (rtt time.Duration, stat *Status) {
+	id := strconv.FormatUint(atomic.AddUint64(&s.pingID, 1), 10)
+	pongCh := make(chan struct{})
+	s.pings.Store(id, pongCh)
+	defer s.pings.Delete(id)
+	start := s.peer.clock.Now()
+	if stat = s.RawPush(PingServiceMethod, nil, WithSetMeta(MetaPing, id), s.withTime()); !stat.OK() {
+		if !IsConnError(stat) || s.Health() {
+			s.observePing(stat)
+		}
+		return 0, stat
+	}
+	select {
+	case <-pongCh:
+		rtt = s.peer.clock.Now().Sub(start)
+		s.observeRTT(rtt)
+		s.observePing(nil)
+		return rtt, nil
+	case <-s.CloseNotify():
+		return 0, statConnClosed
+	case <-ctx.Done():
+		stat = statAckTimeout.Copy(fmt.Sprintf("ping %s: %v", id, ctx.Err()))
+		s.observePing(stat)
+		return 0, stat
+	}
+}
+
+// handlePing answers the ping, or wakes up the Ping waiting for the pong.
+func (s *session) handlePing(header Header) {
+	if id := header.Meta().Peek(MetaPing); len(id) > 0 {
+		if stat := s.RawPush(PingServiceMethod, nil, WithSetMeta(MetaPong, string(id)), s.withTimeEcho(header)); !stat.OK() {
+			Debugf("answer the ping: %s", stat.String())
+		}
+		return
+	}
+	if pongCh, ok := s.pings.LoadAndDelete(string(header.Meta().Peek(MetaPong))); ok {
+		s.observeSkew(header)
+		close(pongCh.(chan struct{}))
+	}
+}
+
+// observeRTT updates the smoothed round-trip time like TCP, i.e. srtt = 7/8*srtt + 1/8*rtt.
+func (s *session) observeRTT(rtt time.Duration) {
+	for {
+		old := atomic.LoadInt64(&s.rtt)
+		srtt := int64(rtt)
+		if old > 0 {
+			srtt = old - old/8 + int64(rtt)/8
+		}
+		if atomic.CompareAndSwapInt64(&s.rtt, old, srtt) {
+			return
+		}
+	}
+}
+
+// observePing transits the liveness by the result of a ping, and emits EventLivenessChanged if changed.
+func (s *session) observePing(stat *Status) {
+	next := LivenessHealthy
+	if stat.OK() {
+		atomic.StoreInt32(&s.pingFailures, 0)
+	} else if n := atomic.AddInt32(&s.pingFailures, 1); n >= s.peer.pingDeadAfter {
+		next = LivenessDead
+	} else {
+		next = LivenessSuspect
+	}
+	if old := Liveness(atomic.SwapInt32(&s.liveness, int32(next))); old != next {
+		Infof("session(%s) %s liveness: %s -> %s", s.ID(), s.RemoteAddr().String(), old, next)
+		e := s.peer.sessionEvent(EventLivenessChanged, s)
+		e.Liveness = next
+		if stat != nil {
+			e.Err = stat.Cause()
+		}
+		s.peer.events.emit(e)
+	}
+}
+
+// Liveness returns the liveness state of the session by the results of the pings.
+func (s *session) Liveness() Liveness {
+	return Liveness(atomic.LoadInt32(&s.liveness))
+}
+
+// RTT returns the smoothed round-trip time of the pings, 0 if no ping is answered.
+func (s *session) RTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.rtt))
+}
+
+// pingMonitor pings the sessions periodically, see PeerConfig.PingInterval.
+type pingMonitor struct {
+	peer     *peer
+	interval time.Duration
+	timeout  time.Duration
+}
+
+// newPingMonitor returns nil if the automatic pings are disabled.
+func newPingMonitor(p *peer, cfg *PeerConfig) *pingMonitor {
+	if cfg.PingInterval <= 0 {
+		return nil
+	}
+	return &pingMonitor{
+		peer:     p,
+		interval: cfg.PingInterval,
+		timeout:  cfg.PingTimeout,
+	}
+}
+
+func (m *pingMonitor) start() {
+	m.peer.clock.AfterFunc(m.interval, m.check)
+}
+
+func (m *pingMonitor) check() {
+	select {
+	case <-m.peer.closeCh:
+		return
+	default:
+	}
+	m.peer.sessHub.rangeCallback(func(sess *session) bool {
+		// NOTE: Skip the session whose last ping is still waiting for the pong.
+		if sess.Health() && atomic.CompareAndSwapInt32(&sess.pinging, 0, 1) {
+			go func() {
+				defer atomic.StoreInt32(&sess.pinging, 0)
+				ctx, cancel := ClockWithTimeout(m.peer.clock, context.Background(), m.timeout)
+				defer cancel()
+				sess.Ping(ctx)
+			}()
+		}
+		return true
+	})
+	m.start()
+}
@@ -0,0 +1,100 @@
+package erpc_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/erpctest"
+)
+
+func TestPing(t *testing.T) {
+	srv, cli, sess := erpc.NewPipePeerPair(erpc.PeerConfig{}, erpc.PeerConfig{})
+	defer srv.Close()
+	defer cli.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		rtt, stat := sess.Ping(ctx)
+		if !stat.OK() || rtt <= 0 {
+			t.Fatalf("rtt: %v, stat: %v", rtt, stat)
+		}
+	}
+	if sess.RTT() <= 0 || sess.Liveness() != erpc.LivenessHealthy {
+		t.Fatalf("rtt: %v, liveness: %v", sess.RTT(), sess.Liveness())
+	}
+}
+
+func TestPingLiveness(t *testing.T) {
+	// the remote peer never answers the pings
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+	clock := erpctest.NewClock(time.Now())
+	cli := erpc.NewPeer(erpc.PeerConfig{
+		PingInterval:  time.Second,
+		PingTimeout:   500 * time.Millisecond,
+		PingDeadAfter: 2,
+		Clock:         clock,
+	})
+	defer cli.Close()
+	events := cli.Events()
+	sess, stat := cli.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	expectLiveness := func(expect erpc.Liveness) {
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case e := <-events:
+				if e.Type != erpc.EventLivenessChanged {
+					continue
+				}
+				if e.Liveness != expect || e.Err == nil || sess.Liveness() != expect {
+					t.Fatalf("expect %v, got %v: %v", expect, e.Liveness, e.Err)
+				}
+				return
+			case <-timeout:
+				t.Fatalf("expect the liveness changed to %v", expect)
+			}
+		}
+	}
+	waitTimers := func(n int) {
+		if !clock.WaitTimers(n, time.Second) {
+			t.Fatalf("expect %d timers, got %d", n, clock.Timers())
+		}
+	}
+
+	waitTimers(1)
+	clock.Advance(time.Second)
+	waitTimers(2) // the next check and the ping timeout
+	clock.Advance(500 * time.Millisecond)
+	expectLiveness(erpc.LivenessSuspect)
+	waitTimers(1)
+	clock.Advance(500 * time.Millisecond)
+	waitTimers(2)
+	clock.Advance(500 * time.Millisecond)
+	expectLiveness(erpc.LivenessDead)
+
+	ctx, cancel := erpc.ClockWithTimeout(clock, context.Background(), time.Minute)
+	defer cancel()
+	go clock.Advance(time.Minute)
+	if _, stat = sess.Ping(ctx); stat.Code() != erpc.CodeAckTimeout {
+		t.Fatalf("expect the ping timeout, got %v", stat)
+	}
+}
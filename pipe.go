@@ -0,0 +1,106 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"net"
+	"strconv"
+	"sync/atomic"
+)
+
+// NewPipePeerPair creates the server and client peers connected by an in-memory pipe,
+// and returns the client session, for the handler unit tests without binding ports or sleeping.
+// NOTE:
+//  The plugins are of the server peer, use ConnectPipe to connect the custom peers;
+//  The peers should be closed after testing.
+func NewPipePeerPair(serverCfg, clientCfg PeerConfig, globalLeftPlugin ...Plugin) (server, client Peer, sess Session) {
+	server = NewPeer(serverCfg, globalLeftPlugin...)
+	client = NewPeer(clientCfg)
+	sess, stat := ConnectPipe(server, client)
+	if !stat.OK() {
+		Fatalf("%v", stat)
+	}
+	return server, client, sess
+}
+
+var pipeCount uint64
+
+// ConnectPipe connects the client peer to the server peer by an in-memory pipe (net.Pipe),
+// and returns the client session.
+// NOTE:
+//  The server end is served like ServeConn with the PostAccept plugins, concurrently with the client end
+//  served like Dial with the PostDial plugins, so the handshake plugins work, but without redialing;
+//  The server session id is unique as "pipe-client:<n>" by default.
+func ConnectPipe(server, client Peer, protoFunc ...ProtoFunc) (Session, *Status) {
+	cli, ok := client.(*peer)
+	if !ok {
+		return nil, NewStatus(CodeWrongConn, "not support the client peer", "")
+	}
+	n := strconv.FormatUint(atomic.AddUint64(&pipeCount, 1), 10)
+	serverAddr, clientAddr := pipeAddr("pipe-server:"+n), pipeAddr("pipe-client:"+n)
+	c1, c2 := net.Pipe()
+	accepted := make(chan *Status, 1)
+	go func() {
+		_, stat := server.ServeConn(&pipeConn{Conn: c1, local: serverAddr, remote: clientAddr}, protoFunc...)
+		if !stat.OK() {
+			c1.Close()
+		}
+		accepted <- stat
+	}()
+	return cli.dialPipe(&pipeConn{Conn: c2, local: clientAddr, remote: serverAddr}, protoFunc, accepted)
+}
+
+// dialPipe serves the client end of the pipe like Dial, after the server end is accepted.
+func (p *peer) dialPipe(conn net.Conn, protoFunc []ProtoFunc, accepted <-chan *Status) (Session, *Status) {
+	protoFunc = p.withProtoFunc(protoFunc)
+	var sess = newSession(p, conn, protoFunc)
+	sess.socket.SetID(sess.LocalAddr().String())
+	stat := sess.withPlugins(p.pluginContainer).postDial(sess, false)
+	if stat.OK() {
+		stat = sess.sendDialMeta()
+	}
+	if !stat.OK() {
+		conn.Close()
+		<-accepted
+		return nil, stat
+	}
+	if stat = <-accepted; !stat.OK() {
+		conn.Close()
+		return nil, stat
+	}
+	Infof("dial ok (network:pipe, addr:%s, id:%s)", sess.RemoteAddr().String(), sess.ID())
+	sess.changeStatus(statusOk)
+	AnywayGo(sess.startReadAndHandle)
+	sess.negotiateSeq64()
+	sess.negotiateCodec()
+	sess.negotiateFragment()
+	p.sessHub.set(sess)
+	p.emitSessionEvent(EventSessionDialed, sess)
+	return sess, nil
+}
+
+// pipeConn the net.Pipe connection with the unique addresses.
+type pipeConn struct {
+	net.Conn
+	local, remote pipeAddr
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return c.local }
+func (c *pipeConn) RemoteAddr() net.Addr { return c.remote }
+
+type pipeAddr string
+
+func (pipeAddr) Network() string  { return "pipe" }
+func (a pipeAddr) String() string { return string(a) }
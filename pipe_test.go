@@ -0,0 +1,93 @@
+package erpc_test
+
+import (
+	"testing"
+
+	"github.com/andeya/erpc/v7/plugin/auth"
+)
+
+type pipeHome struct {
+	erpc.CallCtx
+}
+
+// Echo replies the arg with the session id.
+func (h *pipeHome) Echo(arg *string) (string, *erpc.Status) {
+	return *arg + "@" + h.Session().ID(), nil
+}
+
+func TestPipePeerPair(t *testing.T) {
+	for _, arg := range []string{"a", "b", "c"} {
+		arg := arg
+		t.Run(arg, func(t *testing.T) {
+			t.Parallel()
+			srv, cli, sess := erpc.NewPipePeerPair(erpc.PeerConfig{}, erpc.PeerConfig{})
+			defer srv.Close()
+			defer cli.Close()
+			srv.RouteCall(new(pipeHome))
+			var result string
+			if stat := sess.Call("/pipe_home/echo", arg, &result).Status(); !stat.OK() {
+				t.Fatal(stat)
+			}
+			if result != arg+"@"+sess.LocalAddr().String() {
+				t.Fatalf("result: %q", result)
+			}
+		})
+	}
+}
+
+func TestConnectPipe(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{})
+	defer srv.Close()
+	srv.RouteCall(new(pipeHome))
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	for i := 0; i < 2; i++ {
+		if _, stat := erpc.ConnectPipe(srv, cli); !stat.OK() {
+			t.Fatal(stat)
+		}
+	}
+	if n := srv.CountSession(); n != 2 {
+		t.Fatalf("sessions: %d", n)
+	}
+}
+
+func TestConnectPipeHandshake(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{}, auth.NewCheckerPlugin(func(sess auth.Session, fn auth.RecvOnce) (interface{}, *erpc.Status) {
+		var token string
+		if stat := fn(&token); !stat.OK() {
+			return nil, stat
+		}
+		if token != "token" {
+			return nil, erpc.NewStatus(erpc.CodeUnauthorized, "bad token", "")
+		}
+		sess.SetID("user-1")
+		return "ok", nil
+	}))
+	defer srv.Close()
+	srv.RouteCall(new(pipeHome))
+	newClient := func(token string) erpc.Peer {
+		return erpc.NewPeer(erpc.PeerConfig{}, auth.NewBearerPlugin(func(sess auth.Session, fn auth.SendOnce) *erpc.Status {
+			var ret string
+			return fn(token, &ret)
+		}))
+	}
+	cli := newClient("token")
+	defer cli.Close()
+	sess, stat := erpc.ConnectPipe(srv, cli)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var result string
+	if stat = sess.Call("/pipe_home/echo", "a", &result).Status(); !stat.OK() || result != "a@user-1" {
+		t.Fatalf("result: %q, stat: %v", result, stat)
+	}
+
+	bad := newClient("bad")
+	defer bad.Close()
+	if _, stat = erpc.ConnectPipe(srv, bad); stat.OK() {
+		t.Fatal("expect the handshake rejected")
+	}
+	if n := srv.CountSession(); n != 1 {
+		t.Fatalf("sessions: %d", n)
+	}
+}
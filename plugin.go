@@ -138,6 +138,26 @@ type (
 		Plugin
 		PostReadReplyBody(ReadCtx) *Status
 	}
+	// PostHandlePanicPlugin is executed after the CALL or PUSH handler panics.
+	// NOTE: The first not-OK returned status is used as the handling status.
+	PostHandlePanicPlugin interface {
+		Plugin
+		PostHandlePanic(ctx ReadCtx, recovered interface{}) *Status
+	}
+	// PostHandleCallPlugin is executed after the CALL is handled and replied,
+	// or after it is handled without reply, e.g. canceled by the caller.
+	// NOTE: It is executed once for each CALL reaching the handling, i.e. PostReadCallBody is executed or the CALL is rejected before.
+	PostHandleCallPlugin interface {
+		Plugin
+		PostHandleCall(WriteCtx) *Status
+	}
+	// SelectHandlerPoolPlugin is executed after reading the CALL or PUSH message, before the handling,
+	// to select the named worker pool of the message, e.g. by the tenant.
+	// NOTE: The first non-nil spec is used, which overrides the pool of the handler set by WithHandlerPool.
+	SelectHandlerPoolPlugin interface {
+		Plugin
+		SelectHandlerPool(ReadCtx) *HandlerPoolSpec
+	}
 	// PostDisconnectPlugin is executed after disconnection.
 	PostDisconnectPlugin interface {
 		Plugin
@@ -227,7 +247,7 @@ func (p *PluginContainer) refresh() {
 		}
 		m[plugin.Name()] = true
 	}
-	p.pluginSingleContainer.plugins = allPlugins
+	p.pluginSingleContainer.plugins = sortPlugins(allPlugins)
 }
 
 // pluginSingleContainer plugins container.
@@ -618,6 +638,43 @@ func (p *pluginSingleContainer) postReadReplyBody(ctx ReadCtx) *Status {
 	return nil
 }
 
+// PostHandlePanic executes the defined plugins after the handler panics.
+func (p *pluginSingleContainer) postHandlePanic(ctx ReadCtx, recovered interface{}) *Status {
+	for _, plugin := range p.plugins {
+		if _plugin, ok := plugin.(PostHandlePanicPlugin); ok {
+			if stat := _plugin.PostHandlePanic(ctx, recovered); !stat.OK() {
+				return stat
+			}
+		}
+	}
+	return nil
+}
+
+// PostHandleCall executes the defined plugins after the CALL is handled.
+func (p *pluginSingleContainer) postHandleCall(ctx WriteCtx) {
+	var stat *Status
+	for _, plugin := range p.plugins {
+		if _plugin, ok := plugin.(PostHandleCallPlugin); ok {
+			if stat = _plugin.PostHandleCall(ctx); !stat.OK() {
+				Errorf("[PostHandleCallPlugin:%s] %s", plugin.Name(), stat.String())
+				return
+			}
+		}
+	}
+}
+
+// selectHandlerPool executes the defined plugins to select the handler pool of the message.
+func (p *pluginSingleContainer) selectHandlerPool(ctx ReadCtx) *HandlerPoolSpec {
+	for _, plugin := range p.plugins {
+		if _plugin, ok := plugin.(SelectHandlerPoolPlugin); ok {
+			if spec := _plugin.SelectHandlerPool(ctx); spec != nil {
+				return spec
+			}
+		}
+	}
+	return nil
+}
+
 // PostDisconnect executes the defined plugins after disconnection.
 func (p *pluginSingleContainer) postDisconnect(sess BaseSession) *Status {
 	var stat *Status
@@ -0,0 +1,316 @@
+// Package audit is a plugin that records the security-relevant events to an append-only sink with the hash chaining.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package audit
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/plugin/auth"
+	"github.com/andeya/erpc/v7/plugin/rbac"
+)
+
+// the builtin event types
+const (
+	EventAuthSuccess  = "auth.success"
+	EventAuthFailure  = "auth.failure"
+	EventCall         = "call"
+	EventConfigChange = "config.change"
+)
+
+// Event the security-relevant event
+type Event struct {
+	Type          string            `json:"type"`
+	Subject       string            `json:"subject,omitempty"`
+	Session       string            `json:"session,omitempty"`
+	RemoteAddr    string            `json:"remote_addr,omitempty"`
+	ServiceMethod string            `json:"service_method,omitempty"`
+	Code          int32             `json:"code,omitempty"`
+	Msg           string            `json:"msg,omitempty"`
+	Fields        map[string]string `json:"fields,omitempty"`
+}
+
+// Record the event recorded in the chain, whose hash covers the previous hash and all the other fields,
+// so that any modification, insertion or deletion of the records breaks the chain.
+type Record struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Event
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+}
+
+// Sink the append-only backend of the records.
+// NOTE:
+//  It is called serially in the order of the chain;
+//  If it implements Tailer, the chain is continued from the last record.
+type Sink interface {
+	Write(rec *Record) error
+}
+
+// Tailer returns the last record of the sink, nil if empty.
+type Tailer interface {
+	Last() (*Record, error)
+}
+
+// Config the audit config
+type Config struct {
+	// Sink the backend of the records, required
+	Sink Sink
+	// Key the HMAC key of the chain hashes, so that the chain cannot be recomputed without it, optional
+	Key []byte
+	// Subject gets the subject of the CALL, default the rbac identity or the auth handshake identity of the session
+	Subject func(erpc.WriteCtx) string
+	// IgnoreAuthFailures whether not to record the CALL of any route replied with the 401 or 403 status
+	IgnoreAuthFailures bool
+}
+
+// Logger the audit logger, also a plugin recording the CALL of the audited routes and the authentication failures.
+type Logger struct {
+	sink       Sink
+	key        []byte
+	subject    func(erpc.WriteCtx) string
+	authFailed bool
+	mu         sync.Mutex
+	seq        uint64
+	lastHash   string
+	routesMu   sync.RWMutex
+	routes     map[string][]string
+}
+
+var _ erpc.PostHandleCallPlugin = (*Logger)(nil)
+
+// New creates an audit logger, continuing the chain of the sink if it is a Tailer.
+func New(cfg Config) (*Logger, error) {
+	if cfg.Sink == nil {
+		return nil, fmt.Errorf("audit: nil sink")
+	}
+	if cfg.Subject == nil {
+		cfg.Subject = sessionSubject
+	}
+	l := &Logger{
+		sink:       cfg.Sink,
+		key:        cfg.Key,
+		subject:    cfg.Subject,
+		authFailed: !cfg.IgnoreAuthFailures,
+		routes:     make(map[string][]string),
+	}
+	if t, ok := cfg.Sink.(Tailer); ok {
+		last, err := t.Last()
+		if err != nil {
+			return nil, fmt.Errorf("audit: %v", err)
+		}
+		if last != nil {
+			l.seq, l.lastHash = last.Seq, last.Hash
+		}
+	}
+	return l, nil
+}
+
+// Name returns the plugin name.
+func (l *Logger) Name() string {
+	return "audit"
+}
+
+// Log records the event.
+// NOTE:
+//  The record failed to write is not chained, and the error is returned.
+func (l *Logger) Log(e Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rec := &Record{Seq: l.seq + 1, Time: time.Now().UTC(), Event: e, PrevHash: l.lastHash}
+	rec.Hash = hashRecord(l.key, rec)
+	if err := l.sink.Write(rec); err != nil {
+		erpc.Errorf("audit: write record %d: %s", rec.Seq, err.Error())
+		return err
+	}
+	l.seq, l.lastHash = rec.Seq, rec.Hash
+	return nil
+}
+
+// Auth records the authentication result of the session.
+func (l *Logger) Auth(sess auth.Session, subject string, stat *erpc.Status) error {
+	e := Event{Type: EventAuthSuccess, Subject: subject, RemoteAddr: sess.RemoteAddr().String()}
+	if s, ok := sess.(interface{ ID() string }); ok {
+		e.Session = s.ID()
+	}
+	if !stat.OK() {
+		e.Type, e.Code, e.Msg = EventAuthFailure, stat.Code(), stat.Msg()
+	}
+	return l.Log(e)
+}
+
+// WrapChecker returns the checker of the auth plugin, which records the result of the checker,
+// with the subject of the returned string or fmt.Stringer.
+func (l *Logger) WrapChecker(checker auth.Checker) auth.Checker {
+	return func(sess auth.Session, fn auth.RecvOnce) (interface{}, *erpc.Status) {
+		ret, stat := checker(sess, fn)
+		var subject string
+		switch r := ret.(type) {
+		case string:
+			subject = r
+		case fmt.Stringer:
+			subject = r.String()
+		}
+		l.Auth(sess, subject, stat)
+		return ret, stat
+	}
+}
+
+// ConfigChange records the change of the config item.
+func (l *Logger) ConfigChange(subject, name string, from, to interface{}) error {
+	return l.Log(Event{
+		Type:    EventConfigChange,
+		Subject: subject,
+		Fields:  map[string]string{"name": name, "from": fmt.Sprint(from), "to": fmt.Sprint(to)},
+	})
+}
+
+// Audit returns the route plugin, which records every CALL of the route group with the tags.
+//  e.g. srv.SubRoute("/admin", l.Audit("privileged"))
+func (l *Logger) Audit(tags ...string) erpc.Plugin {
+	return &auditPlugin{l: l, tags: tags}
+}
+
+type auditPlugin struct {
+	l    *Logger
+	tags []string
+}
+
+var _ erpc.PostRegPlugin = (*auditPlugin)(nil)
+
+func (a *auditPlugin) Name() string {
+	return "audit-route:" + strings.Join(a.tags, ",")
+}
+
+func (a *auditPlugin) PostReg(h *erpc.Handler) error {
+	a.l.routesMu.Lock()
+	a.l.routes[h.Name()] = append(a.l.routes[h.Name()], a.tags...)
+	a.l.routesMu.Unlock()
+	return nil
+}
+
+// PostHandleCall records the CALL of the audited routes, and the CALL replied with the 401 or 403 status.
+// NOTE:
+//  It is registered to the peer, so that the CALL rejected before routing is also seen.
+func (l *Logger) PostHandleCall(ctx erpc.WriteCtx) *erpc.Status {
+	serviceMethod := ctx.Output().ServiceMethod()
+	l.routesMu.RLock()
+	tags, audited := l.routes[serviceMethod]
+	l.routesMu.RUnlock()
+	stat := ctx.Status()
+	typ := EventCall
+	if !audited {
+		if !l.authFailed || (stat.Code() != erpc.CodeUnauthorized && stat.Code() != rbac.CodeForbidden) {
+			return nil
+		}
+		typ = EventAuthFailure
+	}
+	e := Event{
+		Type:          typ,
+		Subject:       l.subject(ctx),
+		Session:       ctx.Session().ID(),
+		RemoteAddr:    ctx.RealIP(),
+		ServiceMethod: serviceMethod,
+		Code:          stat.Code(),
+	}
+	if !stat.OK() {
+		e.Msg = stat.Msg()
+	}
+	if len(tags) > 0 {
+		e.Fields = map[string]string{"tags": strings.Join(tags, ",")}
+	}
+	l.Log(e)
+	return nil
+}
+
+func sessionSubject(ctx erpc.WriteCtx) string {
+	swap := ctx.Session().Swap()
+	if v, ok := swap.Load(rbac.DefaultSwapKey); ok {
+		if id, _ := v.(*rbac.Identity); id != nil {
+			return id.Subject
+		}
+	}
+	if v, ok := swap.Load(auth.SwapIdentity); ok {
+		s, _ := v.(string)
+		return s
+	}
+	return ""
+}
+
+func hashRecord(key []byte, rec *Record) string {
+	r := *rec
+	r.Hash = ""
+	b, _ := json.Marshal(&r)
+	var h hash.Hash
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify verifies the chain of the JSON lines records, and returns the number of them.
+// NOTE:
+//  The error reports the first broken record, e.g. modified, inserted or deleted.
+func Verify(r io.Reader, key []byte) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var n int
+	var prev *Record
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		rec := new(Record)
+		if err := json.Unmarshal(line, rec); err != nil {
+			return n, fmt.Errorf("audit: record %d: %v", n+1, err)
+		}
+		if prev != nil && (rec.Seq != prev.Seq+1 || rec.PrevHash != prev.Hash) {
+			return n, fmt.Errorf("audit: record %d: broken chain after seq %d", rec.Seq, prev.Seq)
+		}
+		if !hmac.Equal([]byte(rec.Hash), []byte(hashRecord(key, rec))) {
+			return n, fmt.Errorf("audit: record %d: hash mismatch", rec.Seq)
+		}
+		prev = rec
+		n++
+	}
+	return n, scanner.Err()
+}
+
+// VerifyFile verifies the chain of the records file, see Verify.
+func VerifyFile(name string, key []byte) (int, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return Verify(f, key)
+}
@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+func admin_reset(ctx erpc.CallCtx, arg *string) (string, *erpc.Status) {
+	return "ok", nil
+}
+
+func secret(ctx erpc.CallCtx, arg *string) (string, *erpc.Status) {
+	return "", erpc.NewStatus(erpc.CodeUnauthorized, "Unauthorized", "")
+}
+
+func ping(ctx erpc.CallCtx, arg *string) (string, *erpc.Status) {
+	return "pong", nil
+}
+
+func TestAudit(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "audit.log")
+	key := []byte("chain-key")
+	sink, err := NewFileSink(name, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := New(Config{Sink: sink, Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := erpc.NewPeer(erpc.PeerConfig{}, l)
+	srv.RouteCallFunc(admin_reset, l.Audit("privileged"))
+	srv.RouteCallFunc(secret)
+	srv.RouteCallFunc(ping)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	time.Sleep(100 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var reply string
+	for _, uri := range []string{"/admin/reset", "/secret", "/ping"} {
+		sess.Call(uri, "x", &reply)
+	}
+	if err = l.ConfigChange("admin", "rate", 10, 20); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+	sink.Close()
+
+	if n, err := VerifyFile(name, key); err != nil || n != 3 {
+		t.Fatalf("n: %d, err: %v", n, err)
+	}
+	if _, err := VerifyFile(name, []byte("wrong")); err == nil {
+		t.Fatal("expect the wrong key failed")
+	}
+
+	// the chain is continued after reopening
+	sink, err = NewFileSink(name, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l, err = New(Config{Sink: sink, Key: key}); err != nil {
+		t.Fatal(err)
+	}
+	l.Log(Event{Type: EventAuthSuccess, Subject: "alice"})
+	sink.Close()
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	for i, typ := range []string{EventCall, EventAuthFailure, EventConfigChange, EventAuthSuccess} {
+		if !strings.Contains(lines[i], `"type":"`+typ+`"`) {
+			t.Fatalf("line %d: %s", i, lines[i])
+		}
+	}
+	if !strings.Contains(lines[0], `"tags":"privileged"`) {
+		t.Fatalf("tags: %s", lines[0])
+	}
+	if n, err := VerifyFile(name, key); err != nil || n != 4 {
+		t.Fatalf("n: %d, err: %v", n, err)
+	}
+
+	// the tampered and the deleted records are detected
+	tampered := strings.Replace(string(b), `"subject":"alice"`, `"subject":"mallory"`, 1)
+	if _, err = Verify(strings.NewReader(tampered), key); err == nil {
+		t.Fatal("expect the tampered record detected")
+	}
+	deleted := strings.Join(append(lines[:1:1], lines[2:]...), "\n")
+	if _, err = Verify(strings.NewReader(deleted), key); err == nil {
+		t.Fatal("expect the deleted record detected")
+	}
+}
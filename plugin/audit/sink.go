@@ -0,0 +1,141 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// SinkFunc the function as a Sink
+type SinkFunc func(rec *Record) error
+
+// Write writes the record.
+func (f SinkFunc) Write(rec *Record) error {
+	return f(rec)
+}
+
+// FileSink the sink appending the records to a file as the JSON lines.
+type FileSink struct {
+	mu   sync.Mutex
+	f    *os.File
+	sync bool
+}
+
+var _ Tailer = (*FileSink)(nil)
+
+// NewFileSink opens the file in the append-only mode, creating it if not exists.
+// NOTE:
+//  If sync, the file is synced after each record, so that no acknowledged record is lost by a crash.
+func NewFileSink(name string, sync bool) (*FileSink, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{f: f, sync: sync}, nil
+}
+
+// Write appends the record.
+func (s *FileSink) Write(rec *Record) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err = s.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if s.sync {
+		return s.f.Sync()
+	}
+	return nil
+}
+
+// Last returns the last record of the file, nil if empty.
+func (s *FileSink) Last() (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(s.f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var last []byte
+	for scanner.Scan() {
+		if b := scanner.Bytes(); len(b) > 0 {
+			last = append(last[:0], b...)
+		}
+	}
+	if err := scanner.Err(); err != nil || last == nil {
+		return nil, err
+	}
+	rec := new(Record)
+	if err := json.Unmarshal(last, rec); err != nil {
+		return nil, fmt.Errorf("last record: %v", err)
+	}
+	return rec, nil
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	return s.f.Close()
+}
+
+// NewWebhookSink creates a sink posting each record as JSON to the URL, which must reply 2xx.
+// NOTE:
+//  If client is nil, a client with 10s timeout is used.
+func NewWebhookSink(url string, client *http.Client) Sink {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return SinkFunc(func(rec *Record) error {
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Post(url, "application/json", bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(ioutil.Discard, resp.Body)
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("webhook: %s", resp.Status)
+		}
+		return nil
+	})
+}
+
+// MultiSink writes the record to all the sinks, and is failed if any one fails.
+func MultiSink(sinks ...Sink) Sink {
+	return SinkFunc(func(rec *Record) error {
+		var first error
+		for _, s := range sinks {
+			if err := s.Write(rec); err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
+	})
+}
@@ -0,0 +1,43 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"encoding/json"
+	"log/syslog"
+)
+
+// NewSyslogSink creates a sink writing each record as JSON to the syslog,
+// the authentication failures at the warning priority and the others at the notice priority.
+//  e.g. NewSyslogSink("", "", "erpc-audit") for the local syslog
+func NewSyslogSink(network, raddr, tag string) (Sink, error) {
+	w, err := syslog.Dial(network, raddr, syslog.LOG_NOTICE|syslog.LOG_AUTH, tag)
+	if err != nil {
+		return nil, err
+	}
+	return SinkFunc(func(rec *Record) error {
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		if rec.Type == EventAuthFailure {
+			return w.Warning(string(b))
+		}
+		return w.Notice(string(b))
+	}), nil
+}
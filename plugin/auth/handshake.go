@@ -0,0 +1,249 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/codec"
+)
+
+// the handshake status codes, see RegisterCode
+const (
+	CodeUnknownIdentity  int32 = 1401
+	CodeBadProof         int32 = 1402
+	CodeServerUnverified int32 = 1403
+	CodeHandshakeFailed  int32 = 1404
+)
+
+func init() {
+	for _, c := range []struct {
+		code int32
+		name string
+		text string
+	}{
+		{CodeUnknownIdentity, "AUTH_UNKNOWN_IDENTITY", "Unknown Identity"},
+		{CodeBadProof, "AUTH_BAD_PROOF", "Bad Proof"},
+		{CodeServerUnverified, "AUTH_SERVER_UNVERIFIED", "Server Unverified"},
+		{CodeHandshakeFailed, "AUTH_HANDSHAKE_FAILED", "Handshake Failed"},
+	} {
+		erpc.RegisterCode(c.code, c.name, c.text)
+		erpc.RegisterHTTPCode(c.code, 401)
+		erpc.RegisterGRPCCode(c.code, erpc.GRPCUnauthenticated)
+	}
+	// restore the reverse mappings of 401 and Unauthenticated
+	erpc.RegisterHTTPCode(erpc.CodeUnauthorized, 401)
+	erpc.RegisterGRPCCode(erpc.CodeUnauthorized, erpc.GRPCUnauthenticated)
+}
+
+var (
+	// StatUnknownIdentity the client identity is unknown to the server
+	StatUnknownIdentity = erpc.NewStatusByCodeText(CodeUnknownIdentity, "", false)
+	// StatBadProof the client proof mismatches the key of its identity
+	StatBadProof = erpc.NewStatusByCodeText(CodeBadProof, "", false)
+	// StatServerUnverified the server proof mismatches the key of the client, i.e. the server is not trusted
+	StatServerUnverified = erpc.NewStatusByCodeText(CodeServerUnverified, "", false)
+	// StatHandshakeFailed the handshake messages are unexpected, malformed or timed out
+	StatHandshakeFailed = erpc.NewStatusByCodeText(CodeHandshakeFailed, "", false)
+)
+
+const (
+	// HMACServiceMethod the service method of the HMAC handshake messages
+	HMACServiceMethod = "/auth/hmac"
+	// SwapIdentity the session Swap key of the client identity authenticated by the handshake
+	SwapIdentity = "erpc-auth-identity"
+	// DefaultHandshakeTimeout the default timeout of each message of the handshake
+	DefaultHandshakeTimeout = 10 * time.Second
+	nonceSize               = 32
+)
+
+// KeyFunc looks up the shared secret of the client identity, ok=false if unknown.
+type KeyFunc func(id string) (key []byte, ok bool)
+
+type (
+	hmacHello struct {
+		ID          string `json:"id"`
+		ClientNonce []byte `json:"client_nonce"`
+	}
+	hmacChallenge struct {
+		ServerNonce []byte `json:"server_nonce"`
+		ServerProof []byte `json:"server_proof"`
+	}
+	hmacResponse struct {
+		ClientProof []byte `json:"client_proof"`
+	}
+)
+
+// hmacProof returns the proof of the side, which binds the identity and both nonces.
+func hmacProof(key []byte, side, id string, clientNonce, serverNonce []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(side))
+	mac.Write([]byte{0})
+	mac.Write([]byte(id))
+	mac.Write([]byte{0})
+	mac.Write(clientNonce)
+	mac.Write(serverNonce)
+	return mac.Sum(nil)
+}
+
+func newNonce() ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	_, err := rand.Read(nonce)
+	return nonce, err
+}
+
+// NewHMACBearerPlugin creates a plugin of the client, which authenticates the session by the HMAC handshake
+// with the mutual nonces, so that both sides prove the knowledge of the shared key without sending it:
+//  client -> server: AUTH_CALL {id, client_nonce}
+//  server -> client: AUTH_REPLY {server_nonce, server_proof=HMAC(key, "server", id, client_nonce, server_nonce)}
+//  client -> server: AUTH_CALL {client_proof=HMAC(key, "client", id, client_nonce, server_nonce)}
+//  server -> client: AUTH_REPLY with the status
+// NOTE:
+//  The session is closed if the handshake fails, with the typed status, e.g. StatServerUnverified;
+//  It is also done after redialing.
+func NewHMACBearerPlugin(id string, key []byte) erpc.Plugin {
+	return &hmacBearerPlugin{id: id, key: key, timeout: DefaultHandshakeTimeout}
+}
+
+// NewHMACCheckerPlugin creates a plugin of the server, which authenticates the sessions by the HMAC handshake,
+// see NewHMACBearerPlugin.
+// NOTE:
+//  No routes are reachable before the handshake completes, since the session is not served until PostAccept returns;
+//  The authenticated client identity is stored in the session Swap by SwapIdentity.
+func NewHMACCheckerPlugin(keys KeyFunc) erpc.Plugin {
+	return &hmacCheckerPlugin{keys: keys, timeout: DefaultHandshakeTimeout}
+}
+
+type hmacBearerPlugin struct {
+	id      string
+	key     []byte
+	timeout time.Duration
+}
+
+type hmacCheckerPlugin struct {
+	keys    KeyFunc
+	timeout time.Duration
+}
+
+var (
+	_ erpc.PostDialPlugin   = (*hmacBearerPlugin)(nil)
+	_ erpc.PostAcceptPlugin = (*hmacCheckerPlugin)(nil)
+)
+
+func (h *hmacBearerPlugin) Name() string {
+	return "auth-hmac-bearer"
+}
+
+func (h *hmacCheckerPlugin) Name() string {
+	return "auth-hmac-checker"
+}
+
+// receive receives the handshake message of the mtype in the timeout.
+func receive(sess erpc.PreSession, mtype byte, body interface{}, timeout time.Duration) *erpc.Status {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	input := sess.PreReceive(func(header erpc.Header) interface{} {
+		if header.Mtype() != mtype || header.ServiceMethod() != HMACServiceMethod {
+			return nil
+		}
+		return body
+	}, ctx)
+	if !input.StatusOK() {
+		if input.Mtype() == mtype {
+			// the failure replied by the peer
+			return input.Status()
+		}
+		return StatHandshakeFailed.Copy(input.Status().Cause())
+	}
+	if input.Mtype() != mtype || input.ServiceMethod() != HMACServiceMethod {
+		return StatHandshakeFailed.Copy("unexpected message: " + erpc.TypeText(input.Mtype()) + " " + input.ServiceMethod())
+	}
+	return nil
+}
+
+func send(sess erpc.PreSession, mtype byte, body interface{}, stat *erpc.Status) *erpc.Status {
+	return sess.PreSend(mtype, HMACServiceMethod, body, stat, erpc.WithBodyCodec(codec.ID_JSON))
+}
+
+func (h *hmacBearerPlugin) PostDial(sess erpc.PreSession, _ bool) *erpc.Status {
+	clientNonce, err := newNonce()
+	if err != nil {
+		return StatHandshakeFailed.Copy(err)
+	}
+	if stat := send(sess, erpc.TypeAuthCall, &hmacHello{ID: h.id, ClientNonce: clientNonce}, nil); !stat.OK() {
+		return stat
+	}
+	var challenge hmacChallenge
+	if stat := receive(sess, erpc.TypeAuthReply, &challenge, h.timeout); !stat.OK() {
+		return stat
+	}
+	if len(challenge.ServerNonce) != nonceSize ||
+		!hmac.Equal(challenge.ServerProof, hmacProof(h.key, "server", h.id, clientNonce, challenge.ServerNonce)) {
+		// NOTE: The client proof is not sent to the untrusted server.
+		send(sess, erpc.TypeAuthCall, &hmacResponse{}, StatServerUnverified)
+		return StatServerUnverified
+	}
+	resp := &hmacResponse{ClientProof: hmacProof(h.key, "client", h.id, clientNonce, challenge.ServerNonce)}
+	if stat := send(sess, erpc.TypeAuthCall, resp, nil); !stat.OK() {
+		return stat
+	}
+	return receive(sess, erpc.TypeAuthReply, nil, h.timeout)
+}
+
+func (h *hmacCheckerPlugin) PostAccept(sess erpc.PreSession) *erpc.Status {
+	stat := h.check(sess)
+	// the failure is replied before the session is closed
+	send(sess, erpc.TypeAuthReply, nil, stat)
+	return stat
+}
+
+func (h *hmacCheckerPlugin) check(sess erpc.PreSession) *erpc.Status {
+	var hello hmacHello
+	if stat := receive(sess, erpc.TypeAuthCall, &hello, h.timeout); !stat.OK() {
+		return stat
+	}
+	if len(hello.ClientNonce) != nonceSize {
+		return StatHandshakeFailed.Copy("invalid client nonce")
+	}
+	key, ok := h.keys(hello.ID)
+	if !ok {
+		return StatUnknownIdentity.Copy(hello.ID)
+	}
+	serverNonce, err := newNonce()
+	if err != nil {
+		return StatHandshakeFailed.Copy(err)
+	}
+	challenge := &hmacChallenge{
+		ServerNonce: serverNonce,
+		ServerProof: hmacProof(key, "server", hello.ID, hello.ClientNonce, serverNonce),
+	}
+	if stat := send(sess, erpc.TypeAuthReply, challenge, nil); !stat.OK() {
+		return stat
+	}
+	var resp hmacResponse
+	if stat := receive(sess, erpc.TypeAuthCall, &resp, h.timeout); !stat.OK() {
+		return stat
+	}
+	if !hmac.Equal(resp.ClientProof, hmacProof(key, "client", hello.ID, hello.ClientNonce, serverNonce)) {
+		return StatBadProof
+	}
+	sess.Swap().Store(SwapIdentity, hello.ID)
+	return nil
+}
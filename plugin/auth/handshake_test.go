@@ -0,0 +1,76 @@
+package auth_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/plugin/auth"
+)
+
+type whoami struct {
+	erpc.CallCtx
+}
+
+func (w *whoami) Get(*struct{}) (string, *erpc.Status) {
+	id, _ := w.Swap().Load(auth.SwapIdentity)
+	return id.(string), nil
+}
+
+func TestHMACHandshake(t *testing.T) {
+	if erpc.CodeToHTTP(auth.CodeBadProof) != 401 || erpc.CodeFromHTTP(401) != erpc.CodeUnauthorized ||
+		erpc.CodeToGRPC(auth.CodeBadProof) != erpc.GRPCUnauthenticated {
+		t.Fatal("code mappings")
+	}
+	keys := map[string][]byte{"alice": []byte("alice-secret")}
+	srv := erpc.NewPeer(erpc.PeerConfig{}, auth.NewHMACCheckerPlugin(func(id string) ([]byte, bool) {
+		key, ok := keys[id]
+		return key, ok
+	}))
+	defer srv.Close()
+	srv.RouteCall(new(whoami))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	time.Sleep(100 * time.Millisecond)
+	addr := lis.Addr().String()
+
+	cases := []struct {
+		id   string
+		key  string
+		code int32
+	}{
+		{"alice", "alice-secret", erpc.CodeOK},
+		{"alice", "wrong", auth.CodeServerUnverified},
+		{"bob", "bob-secret", auth.CodeUnknownIdentity},
+	}
+	for _, c := range cases {
+		cli := erpc.NewPeer(erpc.PeerConfig{}, auth.NewHMACBearerPlugin(c.id, []byte(c.key)))
+		sess, stat := cli.Dial(addr)
+		if stat.Code() != c.code {
+			t.Fatalf("%s: expect code %d, got %v", c.id, c.code, stat)
+		}
+		if stat.OK() {
+			var id string
+			if stat = sess.Call("/whoami/get", nil, &id).Status(); !stat.OK() || id != c.id {
+				t.Fatalf("id: %q, stat: %v", id, stat)
+			}
+		}
+		cli.Close()
+	}
+
+	// the routes are unreachable without the handshake
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(addr)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var id string
+	if stat = sess.Call("/whoami/get", nil, &id).Status(); stat.OK() {
+		t.Fatalf("expect the call rejected, got %q", id)
+	}
+}
@@ -0,0 +1,230 @@
+// Package baggage is a plugin that propagates the context values of the calls to the downstream hops by the metadata.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package baggage
+
+import (
+	"context"
+	"net/url"
+	"sort"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/goutil"
+)
+
+const (
+	// MetaBaggage the metadata key of the baggage, encoded as the URL query, e.g. "tenant=a&user=b"
+	MetaBaggage = "X-Baggage"
+	// DefaultMaxBytes the default max bytes of the encoded baggage
+	DefaultMaxBytes = 4096
+	// DefaultMaxItems the default max number of the baggage items
+	DefaultMaxItems = 64
+)
+
+// Key the typed key of the baggage item.
+// For example:
+//  const TenantKey baggage.Key = "tenant"
+//  ctx = TenantKey.With(ctx, "a")
+//  tenant := TenantKey.Value(ctx)
+type Key string
+
+// With returns a copy of ctx with the baggage item of the key.
+func (k Key) With(ctx context.Context, value string) context.Context {
+	return With(ctx, string(k), value)
+}
+
+// Value returns the baggage item of the key, "" if none.
+func (k Key) Value(ctx context.Context) string {
+	v, _ := Get(ctx, string(k))
+	return v
+}
+
+type ctxKey struct{}
+
+// With returns a copy of ctx with the baggage item, which is sent to the downstream hops
+// by the calls and the pushes of erpc.WithContext(ctx).
+func With(ctx context.Context, key, value string) context.Context {
+	old := FromContext(ctx)
+	b := make(map[string]string, len(old)+1)
+	for k, v := range old {
+		b[k] = v
+	}
+	b[key] = value
+	return context.WithValue(ctx, ctxKey{}, b)
+}
+
+// Get returns the baggage item of ctx.
+func Get(ctx context.Context, key string) (string, bool) {
+	v, ok := FromContext(ctx)[key]
+	return v, ok
+}
+
+// FromContext returns the baggage items of ctx.
+// NOTE:
+//  The returned map must not be modified.
+func FromContext(ctx context.Context) map[string]string {
+	b, _ := ctx.Value(ctxKey{}).(map[string]string)
+	return b
+}
+
+// Config the baggage propagation config
+type Config struct {
+	// Allow the keys of the baggage items that are propagated, empty means all
+	Allow []string
+	// MaxBytes the max bytes of the encoded baggage, the items over it are dropped, default DefaultMaxBytes
+	MaxBytes int
+	// MaxItems the max number of the baggage items, the ones over it are dropped, default DefaultMaxItems
+	MaxItems int
+}
+
+// New creates a plugin that attaches the received baggage to the handler context,
+// and sends the baggage of the message context in the metadata of the CALL and the PUSH.
+// NOTE:
+//  The limits and the allowlist apply in both directions, so the untrusted callers cannot inject the others.
+func New(cfg Config) erpc.Plugin {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DefaultMaxBytes
+	}
+	if cfg.MaxItems <= 0 {
+		cfg.MaxItems = DefaultMaxItems
+	}
+	p := &baggagePlugin{maxBytes: cfg.MaxBytes, maxItems: cfg.MaxItems}
+	if len(cfg.Allow) > 0 {
+		p.allow = make(map[string]bool, len(cfg.Allow))
+		for _, k := range cfg.Allow {
+			p.allow[k] = true
+		}
+	}
+	return p
+}
+
+type baggagePlugin struct {
+	allow    map[string]bool
+	maxBytes int
+	maxItems int
+}
+
+var (
+	_ erpc.PreWriteCallPlugin       = (*baggagePlugin)(nil)
+	_ erpc.PreWritePushPlugin       = (*baggagePlugin)(nil)
+	_ erpc.PostReadCallHeaderPlugin = (*baggagePlugin)(nil)
+	_ erpc.PostReadPushHeaderPlugin = (*baggagePlugin)(nil)
+)
+
+func (p *baggagePlugin) Name() string {
+	return "baggage"
+}
+
+func (p *baggagePlugin) PreWriteCall(ctx erpc.WriteCtx) *erpc.Status {
+	p.inject(ctx.Output())
+	return nil
+}
+
+func (p *baggagePlugin) PreWritePush(ctx erpc.WriteCtx) *erpc.Status {
+	p.inject(ctx.Output())
+	return nil
+}
+
+func (p *baggagePlugin) PostReadCallHeader(ctx erpc.ReadCtx) *erpc.Status {
+	p.extract(ctx.Input())
+	return nil
+}
+
+func (p *baggagePlugin) PostReadPushHeader(ctx erpc.ReadCtx) *erpc.Status {
+	p.extract(ctx.Input())
+	return nil
+}
+
+// inject sets the allowed baggage of the message context to the metadata.
+func (p *baggagePlugin) inject(output erpc.Message) {
+	b := FromContext(output.Context())
+	if len(b) == 0 {
+		return
+	}
+	if s := p.encode(b); s != "" {
+		output.Meta().Set(MetaBaggage, s)
+	}
+}
+
+// extract attaches the allowed baggage of the metadata to the message context.
+func (p *baggagePlugin) extract(input erpc.Message) {
+	s := input.Meta().Peek(MetaBaggage)
+	if len(s) == 0 {
+		return
+	}
+	values, err := url.ParseQuery(goutil.BytesToString(s))
+	if err != nil {
+		return
+	}
+	b := make(map[string]string, len(values))
+	for k, v := range values {
+		if len(v) > 0 && p.allowed(k) {
+			b[k] = v[0]
+		}
+	}
+	if len(b) == 0 {
+		return
+	}
+	if len(b) > p.maxItems || len(s) > p.maxBytes {
+		// drops the items over the limits, the same as the ones encoded by the sender
+		b = p.decode(p.encode(b))
+	}
+	erpc.WithContext(context.WithValue(input.Context(), ctxKey{}, b))(input)
+}
+
+func (p *baggagePlugin) allowed(key string) bool {
+	return p.allow == nil || p.allow[key]
+}
+
+// encode encodes the allowed items in the key order within the limits.
+func (p *baggagePlugin) encode(b map[string]string) string {
+	keys := make([]string, 0, len(b))
+	for k := range b {
+		if p.allowed(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var buf []byte
+	n := 0
+	for _, k := range keys {
+		if n >= p.maxItems {
+			break
+		}
+		item := url.QueryEscape(k) + "=" + url.QueryEscape(b[k])
+		size := len(item)
+		if len(buf) > 0 {
+			size++
+		}
+		if len(buf)+size > p.maxBytes {
+			continue
+		}
+		if len(buf) > 0 {
+			buf = append(buf, '&')
+		}
+		buf = append(buf, item...)
+		n++
+	}
+	return string(buf)
+}
+
+func (p *baggagePlugin) decode(s string) map[string]string {
+	values, _ := url.ParseQuery(s)
+	b := make(map[string]string, len(values))
+	for k, v := range values {
+		b[k] = v[0]
+	}
+	return b
+}
@@ -0,0 +1,79 @@
+package baggage
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+const tenantKey Key = "tenant"
+
+func serve(t *testing.T, p erpc.Peer) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.ServeListener(lis)
+	return lis.Addr().String()
+}
+
+// echo replies the received baggage.
+func echo(ctx erpc.CallCtx, _ *int) (map[string]string, *erpc.Status) {
+	return FromContext(ctx.Context()), nil
+}
+
+var backendSess erpc.Session
+
+// forward calls the backend with the handler context.
+func forward(ctx erpc.CallCtx, _ *int) (map[string]string, *erpc.Status) {
+	if tenantKey.Value(ctx.Context()) != "a" {
+		return nil, erpc.NewStatus(erpc.CodeBadMessage, "no tenant", "")
+	}
+	var reply map[string]string
+	stat := backendSess.Call("/echo", 1, &reply, erpc.WithContext(ctx.Context())).Status()
+	return reply, stat
+}
+
+func TestBaggage(t *testing.T) {
+	// backend replies the received baggage
+	backend := erpc.NewPeer(erpc.PeerConfig{}, New(Config{}))
+	defer backend.Close()
+	backend.RouteCallFunc(echo)
+	backendAddr := serve(t, backend)
+
+	// mid forwards the call to the backend, allowing only the tenant
+	mid := erpc.NewPeer(erpc.PeerConfig{}, New(Config{Allow: []string{"tenant", "big"}, MaxBytes: 64}))
+	defer mid.Close()
+	var stat *erpc.Status
+	backendSess, stat = mid.Dial(backendAddr)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	mid.RouteCallFunc(forward)
+	midAddr := serve(t, mid)
+	time.Sleep(100 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{}, New(Config{}))
+	defer cli.Close()
+	sess, stat := cli.Dial(midAddr)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	ctx := tenantKey.With(context.Background(), "a")
+	ctx = With(ctx, "user", "b")
+	ctx = With(ctx, "big", strings.Repeat("x", 100))
+	if v, ok := Get(ctx, "user"); !ok || v != "b" {
+		t.Fatalf("user: %q", v)
+	}
+	var reply map[string]string
+	if stat = sess.Call("/forward", 1, &reply, erpc.WithContext(ctx)).Status(); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if len(reply) != 1 || reply["tenant"] != "a" {
+		t.Fatalf("baggage: %v", reply)
+	}
+}
@@ -0,0 +1,185 @@
+// Package cache is a plugin that caches the CALL replies of the cacheable routes.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/codec"
+)
+
+// MetaCache the metadata key of the reply served from the cache, whose value is "hit"
+const MetaCache = "X-Cache"
+
+const (
+	// DefaultTTL the default time to live of the cached replies
+	DefaultTTL = time.Minute
+	// DefaultMaxEntries the default maximum number of the cached replies of the in-memory backend
+	DefaultMaxEntries = 10000
+)
+
+// swapKey the swap key of the cache key of the missed CALL, to store its reply
+const swapKey = "erpc-cache-key"
+
+// Backend the storage of the cached replies, e.g. NewLRU and NewRedis.
+// NOTE:
+//  It must be safe for concurrent use;
+//  The cache is best-effort, the failed Get is taken as a miss, and the failed Set is only logged.
+type Backend interface {
+	// Get returns the value of the key, ok is false if it is absent or expired.
+	Get(key string) (value []byte, ok bool, err error)
+	// Set sets the value of the key, which expires after the ttl.
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// Config the cache config
+type Config struct {
+	// TTL the time to live of the cached replies, default DefaultTTL
+	TTL time.Duration
+	// MaxEntries the maximum number of the cached replies of the default in-memory backend, default DefaultMaxEntries
+	MaxEntries int
+	// Backend the storage of the cached replies, default NewLRU(MaxEntries)
+	Backend Backend
+	// ServiceMethods the cacheable routes, if empty, all the routes the plugin is registered with are cacheable
+	ServiceMethods []string
+}
+
+// Cache the response caching plugin, which replies the CALL from the cache without executing the handler,
+// keyed by the service method and the hash of the argument.
+// NOTE:
+//  Register it with the cacheable routes, e.g. peer.RouteCall(new(Home), cache.New(cfg)),
+//  or with the peer and list the cacheable routes in Config.ServiceMethods;
+//  Only the OK replies are cached, only with the body and its codec, not the metadata;
+//  The argument is encoded again by the input body codec to be hashed, so the codec should be deterministic.
+type Cache struct {
+	ttl            time.Duration
+	backend        Backend
+	serviceMethods map[string]bool
+	hits           uint64
+	misses         uint64
+}
+
+var (
+	_ erpc.PostReadCallBodyPlugin = (*Cache)(nil)
+	_ erpc.PreWriteReplyPlugin    = (*Cache)(nil)
+)
+
+// New creates a response caching plugin.
+func New(cfg Config) *Cache {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = DefaultMaxEntries
+	}
+	if cfg.Backend == nil {
+		cfg.Backend = NewLRU(cfg.MaxEntries)
+	}
+	c := &Cache{
+		ttl:     cfg.TTL,
+		backend: cfg.Backend,
+	}
+	if len(cfg.ServiceMethods) > 0 {
+		c.serviceMethods = make(map[string]bool, len(cfg.ServiceMethods))
+		for _, serviceMethod := range cfg.ServiceMethods {
+			c.serviceMethods[serviceMethod] = true
+		}
+	}
+	return c
+}
+
+// Name returns the plugin name.
+func (c *Cache) Name() string {
+	return "cache"
+}
+
+// PostReadCallBody replies the CALL from the cache if hit, otherwise remembers the key to store the reply.
+func (c *Cache) PostReadCallBody(ctx erpc.ReadCtx) *erpc.Status {
+	serviceMethod := ctx.ServiceMethod()
+	if c.serviceMethods != nil && !c.serviceMethods[serviceMethod] {
+		return nil
+	}
+	key, err := cacheKey(ctx)
+	if err != nil {
+		ctx.Debugf("cache: the key of %s: %v", serviceMethod, err)
+		return nil
+	}
+	value, ok, err := c.backend.Get(key)
+	if err != nil {
+		ctx.Warnf("cache: get %s: %v", serviceMethod, err)
+	}
+	if ok && len(value) > 0 {
+		atomic.AddUint64(&c.hits, 1)
+		ctx.ReplyDirectly(value[1:], value[0])
+		if w, ok := ctx.(erpc.WriteCtx); ok {
+			w.Output().Meta().Set(MetaCache, "hit")
+		}
+		return nil
+	}
+	atomic.AddUint64(&c.misses, 1)
+	ctx.Swap().Store(swapKey, key)
+	return nil
+}
+
+// PreWriteReply stores the OK reply of the missed CALL.
+func (c *Cache) PreWriteReply(ctx erpc.WriteCtx) *erpc.Status {
+	key, ok := ctx.Swap().Load(swapKey)
+	if !ok || !ctx.StatusOK() {
+		return nil
+	}
+	output := ctx.Output()
+	body, err := output.MarshalBody()
+	if err != nil {
+		return nil
+	}
+	// reuse the encoded body, instead of encoding it again by the socket
+	output.SetBody(body)
+	value := make([]byte, 1+len(body))
+	value[0] = output.BodyCodec()
+	copy(value[1:], body)
+	if err = c.backend.Set(key.(string), value, c.ttl); err != nil {
+		ctx.Warnf("cache: set %s: %v", output.ServiceMethod(), err)
+	}
+	return nil
+}
+
+// Hits returns the number of the CALLs replied from the cache.
+func (c *Cache) Hits() uint64 {
+	return atomic.LoadUint64(&c.hits)
+}
+
+// Misses returns the number of the cacheable CALLs not found in the cache.
+func (c *Cache) Misses() uint64 {
+	return atomic.LoadUint64(&c.misses)
+}
+
+// cacheKey returns the service method and the hash of the argument, the input body codec and the accepted reply codec.
+func cacheKey(ctx erpc.ReadCtx) (string, error) {
+	input := ctx.Input()
+	arg, err := codec.Marshal(input.BodyCodec(), input.Body())
+	if err != nil {
+		return "", err
+	}
+	acceptCodec, _ := erpc.GetAcceptBodyCodec(input.Meta())
+	h := sha256.New()
+	h.Write([]byte{input.BodyCodec(), acceptCodec})
+	h.Write(arg)
+	return ctx.ServiceMethod() + "#" + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,188 @@
+package cache_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/plugin/cache"
+)
+
+var handled int32
+
+type home struct {
+	erpc.CallCtx
+}
+
+func (h *home) Get(arg *string) (string, *erpc.Status) {
+	atomic.AddInt32(&handled, 1)
+	return "hello " + *arg, nil
+}
+
+func (h *home) Set(arg *string) (string, *erpc.Status) {
+	atomic.AddInt32(&handled, 1)
+	return *arg, nil
+}
+
+func testCache(t *testing.T, backend cache.Backend) {
+	atomic.StoreInt32(&handled, 0)
+	c := cache.New(cache.Config{
+		TTL:            200 * time.Millisecond,
+		Backend:        backend,
+		ServiceMethods: []string{"/home/get"},
+	})
+	srv := erpc.NewPeer(erpc.PeerConfig{})
+	defer srv.Close()
+	srv.RouteCall(new(home), c)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	time.Sleep(100 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	call := func(serviceMethod, arg, expect, cached string) {
+		var reply string
+		callCmd := sess.Call(serviceMethod, arg, &reply)
+		if !callCmd.StatusOK() {
+			t.Fatal(callCmd.Status())
+		}
+		if reply != expect {
+			t.Fatalf("reply: %q, expect: %q", reply, expect)
+		}
+		if got := string(callCmd.InputMeta().Peek(cache.MetaCache)); got != cached {
+			t.Fatalf("%s %s: cache meta %q, expect %q", serviceMethod, arg, got, cached)
+		}
+	}
+	call("/home/get", "a", "hello a", "")
+	call("/home/get", "a", "hello a", "hit")
+	call("/home/get", "b", "hello b", "")
+	call("/home/set", "a", "a", "")
+	call("/home/set", "a", "a", "")
+	if n := atomic.LoadInt32(&handled); n != 4 {
+		t.Fatalf("handled: %d, expect 4", n)
+	}
+	if c.Hits() != 1 || c.Misses() != 2 {
+		t.Fatalf("hits: %d, misses: %d", c.Hits(), c.Misses())
+	}
+	// expired
+	time.Sleep(300 * time.Millisecond)
+	call("/home/get", "a", "hello a", "")
+	if n := atomic.LoadInt32(&handled); n != 5 {
+		t.Fatalf("handled: %d, expect 5", n)
+	}
+}
+
+func TestLRU(t *testing.T) {
+	testCache(t, nil)
+
+	l := cache.NewLRU(2)
+	l.Set("a", []byte("1"), time.Minute)
+	l.Set("b", []byte("2"), time.Minute)
+	l.Get("a")
+	l.Set("c", []byte("3"), time.Minute)
+	if _, ok, _ := l.Get("b"); ok {
+		t.Fatal("b should be evicted as the least recently used")
+	}
+	if v, ok, _ := l.Get("a"); !ok || string(v) != "1" {
+		t.Fatalf("a: %q, %v", v, ok)
+	}
+	if l.Len() != 2 {
+		t.Fatalf("len: %d", l.Len())
+	}
+}
+
+func TestRedis(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go serveFakeRedis(lis)
+	r := cache.NewRedis(cache.RedisConfig{Addr: lis.Addr().String()})
+	defer r.Close()
+	testCache(t, r)
+}
+
+// serveFakeRedis serves the GET and SET PX commands in memory.
+func serveFakeRedis(lis net.Listener) {
+	var mu sync.Mutex
+	type entry struct {
+		value    []byte
+		expireAt time.Time
+	}
+	data := make(map[string]entry)
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			for {
+				args, err := readCommand(r)
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				switch string(args[0]) {
+				case "GET":
+					e, ok := data[string(args[1])]
+					if !ok || time.Now().After(e.expireAt) {
+						io.WriteString(conn, "$-1\r\n")
+					} else {
+						io.WriteString(conn, "$"+strconv.Itoa(len(e.value))+"\r\n"+string(e.value)+"\r\n")
+					}
+				case "SET":
+					ms, _ := strconv.Atoi(string(args[4]))
+					data[string(args[1])] = entry{value: args[2], expireAt: time.Now().Add(time.Duration(ms) * time.Millisecond)}
+					io.WriteString(conn, "+OK\r\n")
+				default:
+					io.WriteString(conn, "-ERR unknown command\r\n")
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+}
+
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	readLine := func() (string, error) {
+		line, err := r.ReadString('\n')
+		if len(line) < 2 {
+			return "", io.ErrUnexpectedEOF
+		}
+		return line[:len(line)-2], err
+	}
+	line, err := readLine()
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(line[1:])
+	args := make([][]byte, n)
+	for i := range args {
+		if line, err = readLine(); err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(line[1:])
+		b := make([]byte, size+2)
+		if _, err = io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = b[:size]
+	}
+	return args, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU the in-memory backend, which evicts the least recently used entry over the max entries.
+type LRU struct {
+	maxEntries int
+	mu         sync.Mutex
+	ll         *list.List
+	items      map[string]*list.Element
+}
+
+type lruEntry struct {
+	key      string
+	value    []byte
+	expireAt time.Time
+}
+
+var _ Backend = (*LRU)(nil)
+
+// NewLRU creates an in-memory backend of at most maxEntries entries,
+// if maxEntries<=0, use DefaultMaxEntries.
+func NewLRU(maxEntries int) *LRU {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	return &LRU{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value of the key, ok is false if it is absent or expired.
+func (l *LRU) Get(key string) ([]byte, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := e.Value.(*lruEntry)
+	if !time.Now().Before(entry.expireAt) {
+		l.remove(e)
+		return nil, false, nil
+	}
+	l.ll.MoveToFront(e)
+	return entry.value, true, nil
+}
+
+// Set sets the value of the key, which expires after the ttl.
+func (l *LRU) Set(key string, value []byte, ttl time.Duration) error {
+	expireAt := time.Now().Add(ttl)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.items[key]; ok {
+		entry := e.Value.(*lruEntry)
+		entry.value = value
+		entry.expireAt = expireAt
+		l.ll.MoveToFront(e)
+		return nil
+	}
+	l.items[key] = l.ll.PushFront(&lruEntry{key: key, value: value, expireAt: expireAt})
+	for l.ll.Len() > l.maxEntries {
+		l.remove(l.ll.Back())
+	}
+	return nil
+}
+
+// Len returns the number of the entries, including the expired ones not evicted yet.
+func (l *LRU) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ll.Len()
+}
+
+func (l *LRU) remove(e *list.Element) {
+	l.ll.Remove(e)
+	delete(l.items, e.Value.(*lruEntry).key)
+}
@@ -0,0 +1,222 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// RedisConfig the config of the redis backend
+type RedisConfig struct {
+	// Addr the address of the redis server, e.g. "127.0.0.1:6379"
+	Addr string
+	// Password the password of the AUTH command, if any
+	Password string
+	// DB the database selected by the SELECT command
+	DB int
+	// KeyPrefix the prefix of the keys, default "erpc:cache:"
+	KeyPrefix string
+	// PoolSize the maximum number of the idle connections, default 8
+	PoolSize int
+	// Timeout the timeout of dialing and each command, default 3s
+	Timeout time.Duration
+}
+
+// Redis the redis backend, speaking the RESP protocol over a pool of connections, with no dependencies.
+type Redis struct {
+	cfg  RedisConfig
+	pool chan *redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+var _ Backend = (*Redis)(nil)
+
+// NewRedis creates a redis backend, which dials lazily.
+func NewRedis(cfg RedisConfig) *Redis {
+	if cfg.KeyPrefix == "" {
+		cfg.KeyPrefix = "erpc:cache:"
+	}
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = 8
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 3 * time.Second
+	}
+	return &Redis{
+		cfg:  cfg,
+		pool: make(chan *redisConn, cfg.PoolSize),
+	}
+}
+
+// Get returns the value of the key by the GET command.
+func (r *Redis) Get(key string) ([]byte, bool, error) {
+	reply, err := r.do("GET", r.cfg.KeyPrefix+key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected reply of GET: %v", reply)
+	}
+	return value, true, nil
+}
+
+// Set sets the value of the key by the SET command with the PX option.
+func (r *Redis) Set(key string, value []byte, ttl time.Duration) error {
+	ms := int64(ttl / time.Millisecond)
+	if ms <= 0 {
+		ms = 1
+	}
+	_, err := r.do("SET", r.cfg.KeyPrefix+key, value, "PX", strconv.FormatInt(ms, 10))
+	return err
+}
+
+// Close closes the idle connections.
+func (r *Redis) Close() error {
+	for {
+		select {
+		case c := <-r.pool:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (r *Redis) do(args ...interface{}) (interface{}, error) {
+	c, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.do(r.cfg.Timeout, args...)
+	if _, ok := err.(redisError); err != nil && !ok {
+		// the connection state is unknown
+		c.Close()
+		return nil, err
+	}
+	r.put(c)
+	return reply, err
+}
+
+func (r *Redis) get() (*redisConn, error) {
+	select {
+	case c := <-r.pool:
+		return c, nil
+	default:
+	}
+	conn, err := net.DialTimeout("tcp", r.cfg.Addr, r.cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: conn, r: bufio.NewReader(conn)}
+	if r.cfg.Password != "" {
+		if _, err = c.do(r.cfg.Timeout, "AUTH", r.cfg.Password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if r.cfg.DB != 0 {
+		if _, err = c.do(r.cfg.Timeout, "SELECT", strconv.Itoa(r.cfg.DB)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (r *Redis) put(c *redisConn) {
+	select {
+	case r.pool <- c:
+	default:
+		c.Close()
+	}
+}
+
+// redisError the error reply of the redis server, after which the connection is still usable.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func (c *redisConn) do(timeout time.Duration, args ...interface{}) (interface{}, error) {
+	c.SetDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		var b []byte
+		switch a := arg.(type) {
+		case string:
+			b = []byte(a)
+		case []byte:
+			b = a
+		}
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(b)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, b...)
+		buf = append(buf, '\r', '\n')
+	}
+	if _, err := c.Write(buf); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// readReply reads a reply of the simple string, error, integer or bulk string, a nil bulk string is returned as nil.
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: invalid reply line")
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return string(line[1:]), nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(string(line[1:]), 10, 64)
+	case '$':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err = io.ReadFull(c.r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+	return nil, fmt.Errorf("redis: unsupported reply type %q", line[0])
+}
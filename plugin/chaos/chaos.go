@@ -0,0 +1,291 @@
+// Package chaos is a plugin that injects the faults by the probabilistic rules per route, to test the client resilience.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package chaos
+
+import (
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+// The swap keys of the plugin
+const (
+	swapConn    = "erpc-chaos-conn"    // the connection of the session, closed abruptly
+	swapLatency = "erpc-chaos-latency" // the latency injected before writing the reply
+)
+
+// StatClosed the status of the CALL or PUSH, whose session is closed abruptly by the rule
+var StatClosed = erpc.NewStatus(erpc.CodeConnClosed, "Closed By Chaos", "")
+
+// StatDropped the status of the PUSH dropped by the rule
+var StatDropped = erpc.NewStatus(erpc.CodeServiceUnavailable, "Dropped By Chaos", "")
+
+// Rule the fault injection rule of the routes.
+type Rule struct {
+	// ServiceMethod the service method, or the prefix ending with "*", e.g. "/user/*"; empty or "*" matches all
+	ServiceMethod string
+	// Probability the probability of injecting the faults to a matched message, in (0,1]; 0 means 1
+	Probability float64
+	// Latency the latency injected before writing the reply of the CALL, or the PUSH sent by the peer
+	Latency time.Duration
+	// Jitter the random extra latency in [0,Jitter)
+	Jitter time.Duration
+	// Status the status replied to the CALL instead of handling it
+	Status *erpc.Status
+	// DropPush drops the PUSH received by the peer without handling it
+	DropPush bool
+	// CloseSession closes the connection of the session abruptly when the CALL or PUSH is received
+	CloseSession bool
+}
+
+func (r *Rule) match(serviceMethod string) bool {
+	p := r.ServiceMethod
+	if p == "" || p == "*" {
+		return true
+	}
+	if strings.HasSuffix(p, "*") {
+		return strings.HasPrefix(serviceMethod, p[:len(p)-1])
+	}
+	return p == serviceMethod
+}
+
+// Stats the counters of the injected faults.
+type Stats struct {
+	Latencies     uint64
+	Statuses      uint64
+	DroppedPushes uint64
+	Closes        uint64
+}
+
+// Chaos the fault injection plugin, which injects the faults of the first rule matching the route of the message.
+// NOTE:
+//  It is enabled by default, and can be toggled by Enable and Disable at runtime;
+//  The rules can be replaced by SetRules at runtime;
+//  Never register it on the production peers.
+type Chaos struct {
+	enabled int32
+	mu      sync.RWMutex
+	rules   []Rule
+	randMu  sync.Mutex
+	rand    *rand.Rand
+	stats   Stats
+}
+
+var (
+	_ erpc.PostAcceptPlugin         = (*Chaos)(nil)
+	_ erpc.PostDialPlugin           = (*Chaos)(nil)
+	_ erpc.PostReadCallHeaderPlugin = (*Chaos)(nil)
+	_ erpc.PostReadPushHeaderPlugin = (*Chaos)(nil)
+	_ erpc.PreWriteReplyPlugin      = (*Chaos)(nil)
+	_ erpc.PreWritePushPlugin       = (*Chaos)(nil)
+)
+
+// New creates a fault injection plugin of the rules.
+func New(rules ...Rule) *Chaos {
+	c := &Chaos{enabled: 1, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	c.SetRules(rules...)
+	return c
+}
+
+// Name returns the plugin name.
+func (c *Chaos) Name() string {
+	return "chaos"
+}
+
+// Enable enables the fault injection.
+func (c *Chaos) Enable() {
+	atomic.StoreInt32(&c.enabled, 1)
+}
+
+// Disable disables the fault injection.
+func (c *Chaos) Disable() {
+	atomic.StoreInt32(&c.enabled, 0)
+}
+
+// Enabled returns whether the fault injection is enabled.
+func (c *Chaos) Enabled() bool {
+	return atomic.LoadInt32(&c.enabled) == 1
+}
+
+// SetRules replaces the rules.
+func (c *Chaos) SetRules(rules ...Rule) {
+	rules = append([]Rule(nil), rules...)
+	c.mu.Lock()
+	c.rules = rules
+	c.mu.Unlock()
+}
+
+// Rules returns the copy of the rules.
+func (c *Chaos) Rules() []Rule {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Rule(nil), c.rules...)
+}
+
+// Seed sets the seed of the random source, for the reproducible injections.
+func (c *Chaos) Seed(seed int64) {
+	c.randMu.Lock()
+	c.rand = rand.New(rand.NewSource(seed))
+	c.randMu.Unlock()
+}
+
+// Stats returns the counters of the injected faults.
+func (c *Chaos) Stats() Stats {
+	return Stats{
+		Latencies:     atomic.LoadUint64(&c.stats.Latencies),
+		Statuses:      atomic.LoadUint64(&c.stats.Statuses),
+		DroppedPushes: atomic.LoadUint64(&c.stats.DroppedPushes),
+		Closes:        atomic.LoadUint64(&c.stats.Closes),
+	}
+}
+
+// PostAccept keeps the connection of the session to close it abruptly.
+func (c *Chaos) PostAccept(sess erpc.PreSession) *erpc.Status {
+	sess.ModifySocket(func(conn net.Conn) (net.Conn, erpc.ProtoFunc) {
+		sess.Swap().Store(swapConn, conn)
+		return nil, nil
+	})
+	return nil
+}
+
+// PostDial keeps the connection of the session to close it abruptly.
+func (c *Chaos) PostDial(sess erpc.PreSession, _ bool) *erpc.Status {
+	return c.PostAccept(sess)
+}
+
+// PostReadCallHeader injects the faults of the CALL.
+func (c *Chaos) PostReadCallHeader(ctx erpc.ReadCtx) *erpc.Status {
+	r, ok := c.pick(ctx.ServiceMethod())
+	if !ok {
+		return nil
+	}
+	if r.CloseSession && c.close(ctx.Session()) {
+		return StatClosed
+	}
+	if latency := c.latency(&r); latency > 0 {
+		ctx.Swap().Store(swapLatency, latency)
+	}
+	if r.Status != nil {
+		atomic.AddUint64(&c.stats.Statuses, 1)
+		return r.Status
+	}
+	return nil
+}
+
+// PostReadPushHeader injects the faults of the PUSH received.
+func (c *Chaos) PostReadPushHeader(ctx erpc.ReadCtx) *erpc.Status {
+	r, ok := c.pick(ctx.ServiceMethod())
+	if !ok {
+		return nil
+	}
+	if r.CloseSession && c.close(ctx.Session()) {
+		return StatClosed
+	}
+	if r.DropPush {
+		atomic.AddUint64(&c.stats.DroppedPushes, 1)
+		return StatDropped
+	}
+	return nil
+}
+
+// PreWriteReply injects the latency of the CALL reply.
+func (c *Chaos) PreWriteReply(ctx erpc.WriteCtx) *erpc.Status {
+	if v, ok := ctx.Swap().Load(swapLatency); ok {
+		ctx.Swap().Delete(swapLatency)
+		sleep(ctx, v.(time.Duration))
+	}
+	return nil
+}
+
+// PreWritePush injects the latency of the PUSH sent.
+func (c *Chaos) PreWritePush(ctx erpc.WriteCtx) *erpc.Status {
+	r, ok := c.pick(ctx.Output().ServiceMethod())
+	if !ok {
+		return nil
+	}
+	if latency := c.latency(&r); latency > 0 {
+		sleep(ctx, latency)
+	}
+	return nil
+}
+
+// pick returns the first rule matching the service method, if the faults are injected by its probability.
+func (c *Chaos) pick(serviceMethod string) (Rule, bool) {
+	if !c.Enabled() {
+		return Rule{}, false
+	}
+	c.mu.RLock()
+	var r *Rule
+	for i := range c.rules {
+		if c.rules[i].match(serviceMethod) {
+			r = &c.rules[i]
+			break
+		}
+	}
+	c.mu.RUnlock()
+	if r == nil {
+		return Rule{}, false
+	}
+	if r.Probability > 0 && r.Probability < 1 && c.float64() >= r.Probability {
+		return Rule{}, false
+	}
+	return *r, true
+}
+
+func (c *Chaos) float64() float64 {
+	c.randMu.Lock()
+	defer c.randMu.Unlock()
+	return c.rand.Float64()
+}
+
+func (c *Chaos) latency(r *Rule) time.Duration {
+	latency := r.Latency
+	if r.Jitter > 0 {
+		c.randMu.Lock()
+		latency += time.Duration(c.rand.Int63n(int64(r.Jitter)))
+		c.randMu.Unlock()
+	}
+	if latency > 0 {
+		atomic.AddUint64(&c.stats.Latencies, 1)
+	}
+	return latency
+}
+
+// close closes the connection of the session abruptly, without the graceful shutdown.
+func (c *Chaos) close(sess erpc.CtxSession) bool {
+	v, ok := sess.Swap().Load(swapConn)
+	if !ok {
+		return false
+	}
+	v.(net.Conn).Close()
+	atomic.AddUint64(&c.stats.Closes, 1)
+	return true
+}
+
+// sleep sleeps the latency, until the context of the message is done.
+func sleep(ctx erpc.WriteCtx, latency time.Duration) {
+	t := time.NewTimer(latency)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Context().Done():
+	}
+}
@@ -0,0 +1,109 @@
+package chaos_test
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/plugin/chaos"
+)
+
+type api struct {
+	erpc.CallCtx
+}
+
+func (a *api) Slow(*int) (string, *erpc.Status)  { return "slow", nil }
+func (a *api) Fail(*int) (string, *erpc.Status)  { return "fail", nil }
+func (a *api) Flaky(*int) (string, *erpc.Status) { return "flaky", nil }
+func (a *api) Close(*int) (string, *erpc.Status) { return "close", nil }
+
+var pushes int32
+
+type event struct {
+	erpc.PushCtx
+}
+
+func (e *event) Drop(*int) *erpc.Status {
+	atomic.AddInt32(&pushes, 1)
+	return nil
+}
+
+func TestChaos(t *testing.T) {
+	c := chaos.New(
+		chaos.Rule{ServiceMethod: "/api/slow", Latency: 100 * time.Millisecond},
+		chaos.Rule{ServiceMethod: "/api/fail", Status: erpc.NewStatus(erpc.CodeServiceUnavailable, "injected", "")},
+		chaos.Rule{ServiceMethod: "/api/flaky", Probability: 0.5, Status: erpc.NewStatus(erpc.CodeServiceUnavailable, "injected", "")},
+		chaos.Rule{ServiceMethod: "/event/*", DropPush: true},
+		chaos.Rule{ServiceMethod: "/api/close", CloseSession: true},
+	)
+	atomic.StoreInt32(&pushes, 0)
+	c.Seed(1)
+	srv := erpc.NewPeer(erpc.PeerConfig{}, c)
+	defer srv.Close()
+	srv.RouteCall(new(api))
+	srv.RoutePush(new(event))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var reply string
+
+	start := time.Now()
+	if stat = sess.Call("/api/slow", 1, &reply).Status(); !stat.OK() || reply != "slow" {
+		t.Fatalf("reply: %q, stat: %v", reply, stat)
+	}
+	if cost := time.Since(start); cost < 100*time.Millisecond {
+		t.Fatalf("expect the injected latency, cost %s", cost)
+	}
+	if stat = sess.Call("/api/fail", 1, &reply).Status(); stat.Code() != erpc.CodeServiceUnavailable {
+		t.Fatalf("expect the injected status, got %v", stat)
+	}
+	var failed int
+	for i := 0; i < 100; i++ {
+		if !sess.Call("/api/flaky", 1, &reply).Status().OK() {
+			failed++
+		}
+	}
+	if failed < 30 || failed > 70 {
+		t.Fatalf("expect about half of the calls failed, got %d", failed)
+	}
+	for i := 0; i < 3; i++ {
+		sess.Push("/event/drop", 1)
+	}
+	for i := 0; c.Stats().DroppedPushes < 3 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// toggled at runtime
+	c.Disable()
+	if stat = sess.Call("/api/fail", 1, &reply).Status(); !stat.OK() || reply != "fail" {
+		t.Fatalf("reply: %q, stat: %v", reply, stat)
+	}
+	sess.Push("/event/drop", 1)
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&pushes); n != 1 {
+		t.Fatalf("expect only the push after Disable handled, got %d", n)
+	}
+	c.Enable()
+
+	if stat = sess.Call("/api/close", 1, &reply).Status(); stat.OK() {
+		t.Fatal("expect the call of the closed session failed")
+	}
+	select {
+	case <-sess.CloseNotify():
+	case <-time.After(time.Second):
+		t.Fatal("expect the session closed abruptly")
+	}
+	if s := c.Stats(); s.Latencies != 1 || s.Statuses != uint64(1+failed) || s.DroppedPushes != 3 || s.Closes != 1 {
+		t.Fatalf("stats: %+v", s)
+	}
+}
@@ -0,0 +1,227 @@
+// Package concurrency is a plugin that limits the in-flight CALL handlers adaptively by the latency gradient.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package concurrency
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+const (
+	// DefaultInitialLimit the default initial limit of the in-flight handlers
+	DefaultInitialLimit = 20
+	// DefaultMinLimit the default minimum limit of the in-flight handlers
+	DefaultMinLimit = 1
+	// DefaultMaxLimit the default maximum limit of the in-flight handlers
+	DefaultMaxLimit = 1000
+	// DefaultWindow the default minimum duration of the latency samples of each limit update
+	DefaultWindow = 100 * time.Millisecond
+	// DefaultTolerance the default ratio of the latency to the long-term one, below which the limit is not decreased
+	DefaultTolerance = 1.5
+	// DefaultSmoothing the default weight of the new limit in each update
+	DefaultSmoothing = 0.2
+	// longWindow the number of the updates of the long-term latency average
+	longWindow = 600
+	// minWindowSamples the minimum number of the latency samples of each limit update
+	minWindowSamples = 10
+)
+
+// swapKey the swap key of the admitted CALL, whose value is the start time
+const swapKey = "erpc-concurrency-start"
+
+// StatLimitExceeded the status replied to the CALL rejected by the limit
+var StatLimitExceeded = erpc.NewStatus(erpc.CodeServiceUnavailable, "Concurrency Limit Exceeded", "")
+
+// Config the adaptive concurrency limit config
+type Config struct {
+	// InitialLimit the initial limit of the in-flight handlers, default DefaultInitialLimit
+	InitialLimit int
+	// MinLimit the minimum limit of the in-flight handlers, default DefaultMinLimit
+	MinLimit int
+	// MaxLimit the maximum limit of the in-flight handlers, default DefaultMaxLimit
+	MaxLimit int
+	// Window the minimum duration of the latency samples of each limit update, default DefaultWindow
+	Window time.Duration
+	// Tolerance the ratio of the latency to the long-term one, below which the limit is not decreased, default DefaultTolerance
+	Tolerance float64
+	// Smoothing the weight of the new limit in each update, in (0,1], default DefaultSmoothing
+	Smoothing float64
+	// Status the status replied to the rejected CALL, default StatLimitExceeded
+	Status *erpc.Status
+}
+
+// Limiter the adaptive concurrency limit plugin of the CALL handlers, in the gradient style:
+// the limit grows while the latency keeps close to the long-term average,
+// and shrinks by the ratio of them when the latency grows by the queueing under overload.
+// NOTE:
+//  Register it with the peer to limit all the handlers, or with the routes sharing the limit;
+//  The CALL over the limit is replied with Config.Status without handling;
+//  The latency is measured from PostReadCallBody to PostHandleCall, i.e. the handling and the reply writing.
+type Limiter struct {
+	minLimit  float64
+	maxLimit  float64
+	window    time.Duration
+	tolerance float64
+	smoothing float64
+	stat      *erpc.Status
+
+	mu          sync.Mutex
+	limit       float64
+	inflight    int
+	rejected    uint64
+	windowStart time.Time
+	windowSum   time.Duration
+	windowCount int
+	longRTT     float64 // the long-term average latency, in ns
+}
+
+var (
+	_ erpc.PostReadCallBodyPlugin = (*Limiter)(nil)
+	_ erpc.PostHandleCallPlugin   = (*Limiter)(nil)
+)
+
+// New creates an adaptive concurrency limit plugin.
+func New(cfg Config) *Limiter {
+	if cfg.MinLimit <= 0 {
+		cfg.MinLimit = DefaultMinLimit
+	}
+	if cfg.MaxLimit <= 0 {
+		cfg.MaxLimit = DefaultMaxLimit
+	}
+	if cfg.MaxLimit < cfg.MinLimit {
+		cfg.MaxLimit = cfg.MinLimit
+	}
+	if cfg.InitialLimit <= 0 {
+		cfg.InitialLimit = DefaultInitialLimit
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultWindow
+	}
+	if cfg.Tolerance < 1 {
+		cfg.Tolerance = DefaultTolerance
+	}
+	if cfg.Smoothing <= 0 || cfg.Smoothing > 1 {
+		cfg.Smoothing = DefaultSmoothing
+	}
+	if cfg.Status == nil {
+		cfg.Status = StatLimitExceeded
+	}
+	l := &Limiter{
+		minLimit:  float64(cfg.MinLimit),
+		maxLimit:  float64(cfg.MaxLimit),
+		window:    cfg.Window,
+		tolerance: cfg.Tolerance,
+		smoothing: cfg.Smoothing,
+		stat:      cfg.Status,
+	}
+	l.limit = l.clamp(float64(cfg.InitialLimit))
+	return l
+}
+
+// Name returns the plugin name.
+func (l *Limiter) Name() string {
+	return "concurrency"
+}
+
+// PostReadCallBody admits the CALL under the limit, or rejects it with Config.Status.
+func (l *Limiter) PostReadCallBody(ctx erpc.ReadCtx) *erpc.Status {
+	l.mu.Lock()
+	if l.inflight >= int(l.limit) {
+		l.rejected++
+		l.mu.Unlock()
+		return l.stat
+	}
+	l.inflight++
+	l.mu.Unlock()
+	ctx.Swap().Store(swapKey, time.Now())
+	return nil
+}
+
+// PostHandleCall releases the admitted CALL, and samples its latency.
+func (l *Limiter) PostHandleCall(ctx erpc.WriteCtx) *erpc.Status {
+	start, ok := ctx.Swap().Load(swapKey)
+	if !ok {
+		return nil
+	}
+	ctx.Swap().Delete(swapKey)
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sample(now, now.Sub(start.(time.Time)))
+	l.inflight--
+	return nil
+}
+
+// sample adds the latency sample, and updates the limit at the end of the window.
+func (l *Limiter) sample(now time.Time, rtt time.Duration) {
+	if l.windowCount == 0 {
+		l.windowStart = now
+	}
+	l.windowSum += rtt
+	l.windowCount++
+	if l.windowCount < minWindowSamples || now.Sub(l.windowStart) < l.window {
+		return
+	}
+	shortRTT := float64(l.windowSum) / float64(l.windowCount)
+	l.windowSum, l.windowCount = 0, 0
+	if shortRTT <= 0 {
+		return
+	}
+	if l.longRTT == 0 {
+		l.longRTT = shortRTT
+	} else {
+		l.longRTT += (shortRTT - l.longRTT) / longWindow
+		// recover quickly from the overload, instead of taking the high latency as the normal one
+		if l.longRTT/shortRTT > 2 {
+			l.longRTT *= 0.95
+		}
+	}
+	gradient := math.Max(0.5, math.Min(1, l.tolerance*l.longRTT/shortRTT))
+	newLimit := l.limit*gradient + math.Sqrt(l.limit)
+	// the limit is not grown by the light load
+	if float64(l.inflight) < l.limit/2 && newLimit > l.limit {
+		return
+	}
+	l.limit = l.clamp(l.limit*(1-l.smoothing) + newLimit*l.smoothing)
+}
+
+func (l *Limiter) clamp(limit float64) float64 {
+	return math.Max(l.minLimit, math.Min(l.maxLimit, limit))
+}
+
+// Limit returns the current limit of the in-flight handlers.
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// Inflight returns the number of the in-flight handlers.
+func (l *Limiter) Inflight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight
+}
+
+// Rejected returns the number of the CALLs rejected by the limit.
+func (l *Limiter) Rejected() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rejected
+}
@@ -0,0 +1,95 @@
+package concurrency
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+func TestGradient(t *testing.T) {
+	l := New(Config{InitialLimit: 10, MaxLimit: 100})
+	now := time.Now()
+	run := func(rtt time.Duration, windows int) {
+		for i := 0; i < windows; i++ {
+			now = now.Add(DefaultWindow)
+			for j := 0; j < minWindowSamples; j++ {
+				// keep the load heavy
+				l.inflight = int(l.limit)
+				l.sample(now, rtt)
+			}
+		}
+		l.inflight = 0
+	}
+	run(10*time.Millisecond, 50)
+	grown := l.Limit()
+	if grown <= 10 {
+		t.Fatalf("limit: %d, expect grown by the steady latency", grown)
+	}
+	run(100*time.Millisecond, 10)
+	if shrunk := l.Limit(); shrunk > grown/2 {
+		t.Fatalf("limit: %d, expect shrunk from %d by the latency growth", shrunk, grown)
+	}
+
+	// the light load does not grow the limit
+	limit := l.Limit()
+	for i := 0; i < 20; i++ {
+		now = now.Add(DefaultWindow)
+		for j := 0; j < minWindowSamples; j++ {
+			l.sample(now, 10*time.Millisecond)
+		}
+	}
+	if l.Limit() > limit {
+		t.Fatalf("limit: %d, expect not grown from %d by the light load", l.Limit(), limit)
+	}
+}
+
+type slow struct {
+	erpc.CallCtx
+}
+
+func (s *slow) Sleep(d *int) (int, *erpc.Status) {
+	time.Sleep(time.Duration(*d) * time.Millisecond)
+	return *d, nil
+}
+
+func TestReject(t *testing.T) {
+	l := New(Config{InitialLimit: 2, MaxLimit: 2})
+	srv := erpc.NewPeer(erpc.PeerConfig{}, l)
+	defer srv.Close()
+	srv.RouteCall(new(slow))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	time.Sleep(100 * time.Millisecond)
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var cmds []erpc.CallCmd
+	for i := 0; i < 3; i++ {
+		cmds = append(cmds, sess.AsyncCall("/slow/sleep", 200, new(int), make(chan erpc.CallCmd, 1)))
+	}
+	var rejected int
+	for _, cmd := range cmds {
+		<-cmd.Done()
+		if cmd.Status().Code() == erpc.CodeServiceUnavailable {
+			rejected++
+		} else if !cmd.StatusOK() {
+			t.Fatal(cmd.Status())
+		}
+	}
+	if rejected != 1 || l.Rejected() != 1 {
+		t.Fatalf("rejected: %d, %d", rejected, l.Rejected())
+	}
+	// released after the reply is written
+	time.Sleep(50 * time.Millisecond)
+	if n := l.Inflight(); n != 0 {
+		t.Fatalf("inflight: %d, expect released", n)
+	}
+}
@@ -0,0 +1,260 @@
+// Package debug is the pprof profiles and the runtime debug routes of the peer, served through the same port.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package debug
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+// The debug routes, registered by NewPlugin.
+const (
+	ServiceMethodProfile    = "/erpc/debug/profile"
+	ServiceMethodGoroutines = "/erpc/debug/goroutines"
+	ServiceMethodSessions   = "/erpc/debug/sessions"
+	ServiceMethodRoutes     = "/erpc/debug/routes"
+)
+
+// MetaToken the metadata key of the token of the debug routes, see Config.Token.
+const MetaToken = "X-Debug-Token"
+
+// DefaultMaxSeconds the default max seconds of the CPU profiling.
+const DefaultMaxSeconds = 30
+
+var (
+	// StatUnauthorized the token of the debug routes is missing or wrong
+	StatUnauthorized = erpc.NewStatus(erpc.CodeUnauthorized, "Debug Unauthorized", "")
+	// StatUnknownProfile the profile name is unknown
+	StatUnknownProfile = erpc.NewStatus(erpc.CodeBadMessage, "Unknown Profile", "")
+	// StatProfiling the CPU profiling is in progress, by another call or the process itself
+	StatProfiling = erpc.NewStatus(erpc.CodeServiceUnavailable, "CPU Profiling In Progress", "")
+)
+
+// Config the config of the debug routes.
+// NOTE: One of Token and Authorize is required, the routes expose the internals of the process.
+type Config struct {
+	// Token the token required in the MetaToken metadata of the calls, see WithToken
+	Token string
+	// Authorize authorizes the calls instead of Token, e.g. by the session identity of plugin/auth;
+	// the not-OK status is replied
+	Authorize func(erpc.ReadCtx) *erpc.Status
+	// MaxSeconds the max seconds of the CPU profiling, default is DefaultMaxSeconds
+	MaxSeconds int
+}
+
+// ProfileArgs the arguments of the profile route.
+type ProfileArgs struct {
+	// Name the profile name, "cpu" or one of runtime/pprof, e.g. "heap", "goroutine", "allocs", "block", "mutex"
+	Name string `json:"name"`
+	// Seconds the duration of the CPU profiling, default is 1s
+	Seconds int `json:"seconds,omitempty"`
+	// Debug the format of the non-CPU profile, 0 means the binary format for `go tool pprof`
+	Debug int `json:"debug,omitempty"`
+}
+
+// SessionInfo a session of the peer.
+type SessionInfo struct {
+	ID         string     `json:"id"`
+	LocalAddr  string     `json:"local_addr"`
+	RemoteAddr string     `json:"remote_addr"`
+	Health     bool       `json:"health"`
+	Stats      erpc.Stats `json:"stats"`
+}
+
+// Routes the route table of the peer.
+type Routes struct {
+	Calls  []string `json:"calls"`
+	Pushes []string `json:"pushes"`
+}
+
+// NewPlugin creates a plugin that registers the debug routes with the auth.
+func NewPlugin(cfg Config) (erpc.Plugin, error) {
+	if cfg.Token == "" && cfg.Authorize == nil {
+		return nil, errors.New("debug: one of Token and Authorize is required")
+	}
+	if cfg.MaxSeconds <= 0 {
+		cfg.MaxSeconds = DefaultMaxSeconds
+	}
+	return &debugPlugin{cfg: cfg}, nil
+}
+
+type debugPlugin struct {
+	cfg Config
+}
+
+// cpuMu serializes the CPU profiling of the process.
+var cpuMu sync.Mutex
+
+var (
+	_ erpc.PostNewPeerPlugin      = (*debugPlugin)(nil)
+	_ erpc.PreReadCallBodyPlugin  = (*authPlugin)(nil)
+	_ erpc.PostReadCallBodyPlugin = (*authPlugin)(nil)
+)
+
+func (*debugPlugin) Name() string {
+	return "debug"
+}
+
+func (p *debugPlugin) PostNewPeer(peer erpc.EarlyPeer) error {
+	peer.SubRoute("/erpc", (*authPlugin)(p)).RouteCall(new(debug))
+	return nil
+}
+
+// authPlugin the route plugin of the debug routes authorizing the calls.
+type authPlugin debugPlugin
+
+func (*authPlugin) Name() string {
+	return "debug-auth"
+}
+
+// PreReadCallBody authorizes the calls of the debug routes, before reading the body.
+func (p *authPlugin) PreReadCallBody(ctx erpc.ReadCtx) *erpc.Status {
+	if p.cfg.Authorize != nil {
+		return p.cfg.Authorize(ctx)
+	}
+	token := ctx.PeekMeta(MetaToken)
+	if subtle.ConstantTimeCompare(token, []byte(p.cfg.Token)) != 1 {
+		return StatUnauthorized
+	}
+	return nil
+}
+
+// PostReadCallBody limits the seconds of the CPU profiling by Config.MaxSeconds.
+func (p *authPlugin) PostReadCallBody(ctx erpc.ReadCtx) *erpc.Status {
+	if args, ok := ctx.Input().Body().(*ProfileArgs); ok && args.Seconds > p.cfg.MaxSeconds {
+		args.Seconds = p.cfg.MaxSeconds
+	}
+	return nil
+}
+
+type debug struct {
+	erpc.CallCtx
+}
+
+// Profile replies the profile by the name.
+func (d *debug) Profile(args *ProfileArgs) ([]byte, *erpc.Status) {
+	var buf bytes.Buffer
+	if args.Name == "cpu" {
+		seconds := args.Seconds
+		if seconds <= 0 {
+			seconds = 1
+		}
+		cpuMu.Lock()
+		defer cpuMu.Unlock()
+		if err := pprof.StartCPUProfile(&buf); err != nil {
+			return nil, StatProfiling.Copy(err)
+		}
+		select {
+		case <-time.After(time.Duration(seconds) * time.Second):
+		case <-d.Context().Done():
+		}
+		pprof.StopCPUProfile()
+		return buf.Bytes(), nil
+	}
+	profile := pprof.Lookup(args.Name)
+	if profile == nil {
+		return nil, StatUnknownProfile.Copy(args.Name)
+	}
+	if err := profile.WriteTo(&buf, args.Debug); err != nil {
+		return nil, erpc.NewStatus(erpc.CodeInternalServerError, err.Error(), nil)
+	}
+	return buf.Bytes(), nil
+}
+
+// Goroutines replies the stack traces of all the goroutines.
+func (d *debug) Goroutines(*struct{}) (string, *erpc.Status) {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return string(buf[:n]), nil
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// Sessions replies the sessions of the peer sorted by id.
+func (d *debug) Sessions(*struct{}) ([]SessionInfo, *erpc.Status) {
+	var sessions []SessionInfo
+	d.Peer().RangeSession(func(sess erpc.Session) bool {
+		sessions = append(sessions, SessionInfo{
+			ID:         sess.ID(),
+			LocalAddr:  sess.LocalAddr().String(),
+			RemoteAddr: sess.RemoteAddr().String(),
+			Health:     sess.Health(),
+			Stats:      sess.Stats(),
+		})
+		return true
+	})
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions, nil
+}
+
+// Routes replies the route table of the peer.
+func (d *debug) Routes(*struct{}) (*Routes, *erpc.Status) {
+	r := &Routes{Calls: []string{}, Pushes: []string{}}
+	router := d.Peer().Router()
+	for _, h := range router.CallHandlers() {
+		r.Calls = append(r.Calls, h.Name())
+	}
+	for _, h := range router.PushHandlers() {
+		r.Pushes = append(r.Pushes, h.Name())
+	}
+	return r, nil
+}
+
+// WithToken sets the token of the debug routes, see Config.Token.
+func WithToken(token string) erpc.MessageSetting {
+	return erpc.WithSetMeta(MetaToken, token)
+}
+
+// Profile calls the profile route of the remote peer, e.g. Profile(sess, "heap", 0, debug.WithToken(token)),
+// and the reply can be analyzed by `go tool pprof`.
+// NOTE: The seconds is only for the "cpu" profile.
+func Profile(sess erpc.Session, name string, seconds int, setting ...erpc.MessageSetting) ([]byte, *erpc.Status) {
+	var reply []byte
+	stat := sess.Call(ServiceMethodProfile, &ProfileArgs{Name: name, Seconds: seconds}, &reply, setting...).Status()
+	return reply, stat
+}
+
+// Goroutines calls the goroutines route of the remote peer.
+func Goroutines(sess erpc.Session, setting ...erpc.MessageSetting) (string, *erpc.Status) {
+	var reply string
+	stat := sess.Call(ServiceMethodGoroutines, nil, &reply, setting...).Status()
+	return reply, stat
+}
+
+// Sessions calls the sessions route of the remote peer.
+func Sessions(sess erpc.Session, setting ...erpc.MessageSetting) ([]SessionInfo, *erpc.Status) {
+	var reply []SessionInfo
+	stat := sess.Call(ServiceMethodSessions, nil, &reply, setting...).Status()
+	return reply, stat
+}
+
+// GetRoutes calls the routes route of the remote peer.
+func GetRoutes(sess erpc.Session, setting ...erpc.MessageSetting) (*Routes, *erpc.Status) {
+	reply := new(Routes)
+	stat := sess.Call(ServiceMethodRoutes, nil, reply, setting...).Status()
+	return reply, stat
+}
@@ -0,0 +1,66 @@
+package debug_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/plugin/debug"
+)
+
+func TestDebug(t *testing.T) {
+	plugin, err := debug.NewPlugin(debug.Config{Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = debug.NewPlugin(debug.Config{}); err == nil {
+		t.Fatal("expect the auth required")
+	}
+	srv := erpc.NewPeer(erpc.PeerConfig{}, plugin)
+	defer srv.Close()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	if _, stat = debug.Goroutines(sess); stat.Code() != erpc.CodeUnauthorized {
+		t.Fatalf("expect unauthorized without the token, got %v", stat)
+	}
+	if _, stat = debug.Goroutines(sess, debug.WithToken("wrong")); stat.Code() != erpc.CodeUnauthorized {
+		t.Fatalf("expect unauthorized of the wrong token, got %v", stat)
+	}
+	token := debug.WithToken("secret")
+	dump, stat := debug.Goroutines(sess, token)
+	if !stat.OK() || !strings.Contains(dump, "goroutine") {
+		t.Fatalf("goroutines: %v", stat)
+	}
+	heap, stat := debug.Profile(sess, "heap", 0, token)
+	if !stat.OK() || len(heap) == 0 {
+		t.Fatalf("heap: %d bytes, stat: %v", len(heap), stat)
+	}
+	if _, stat = debug.Profile(sess, "unknown", 0, token); stat.Code() != erpc.CodeBadMessage {
+		t.Fatalf("expect the unknown profile, got %v", stat)
+	}
+	cpu, stat := debug.Profile(sess, "cpu", 1, token)
+	if !stat.OK() || len(cpu) == 0 {
+		t.Fatalf("cpu: %d bytes, stat: %v", len(cpu), stat)
+	}
+	sessions, stat := debug.Sessions(sess, token)
+	if !stat.OK() || len(sessions) != 1 || sessions[0].RemoteAddr != sess.LocalAddr().String() {
+		t.Fatalf("sessions: %+v, stat: %v", sessions, stat)
+	}
+	routes, stat := debug.GetRoutes(sess, token)
+	if !stat.OK() || strings.Join(routes.Calls, ",") != strings.Join([]string{
+		debug.ServiceMethodGoroutines, debug.ServiceMethodProfile, debug.ServiceMethodRoutes, debug.ServiceMethodSessions,
+	}, ",") {
+		t.Fatalf("routes: %+v, stat: %v", routes, stat)
+	}
+}
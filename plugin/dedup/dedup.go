@@ -0,0 +1,262 @@
+// Package dedup is a plugin that drops the duplicate messages replayed by the client retries.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dedup
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/goutil"
+)
+
+// MetaIdempotencyKey the metadata key of the idempotency key set by the client
+const MetaIdempotencyKey = "X-Idempotency-Key"
+
+const (
+	// DefaultWindow the default duration of remembering the seen messages
+	DefaultWindow = time.Minute
+	// DefaultCapacity the default maximum number of the remembered messages
+	DefaultCapacity = 100000
+)
+
+// CodeDuplicate the status code replied to the duplicate CALL
+const CodeDuplicate int32 = 409
+
+// StatDuplicate the status replied to the duplicate CALL
+var StatDuplicate = erpc.NewStatus(CodeDuplicate, "Duplicate Message", "")
+
+// WithIdempotencyKey sets the idempotency key of the message,
+// the messages with the same key are handled only once in the window.
+func WithIdempotencyKey(key string) erpc.MessageSetting {
+	return erpc.WithSetMeta(MetaIdempotencyKey, key)
+}
+
+// Config the deduplication config
+type Config struct {
+	// Window the duration of remembering the seen messages, default DefaultWindow
+	Window time.Duration
+	// Capacity the maximum number of the remembered messages, the oldest are forgotten first, default DefaultCapacity
+	Capacity int
+	// SharedKeys whether the idempotency keys are shared by all sessions,
+	// otherwise they are scoped by the session id like the seq
+	SharedKeys bool
+	// Status the status replied to the duplicate CALL, default StatDuplicate
+	Status *erpc.Status
+	// Memoize whether the reply of the first CALL with an idempotency key is stored in the window,
+	// and replied to its duplicates instead of Status
+	Memoize bool
+}
+
+type seen struct {
+	key string
+	at  time.Time
+}
+
+// memo the stored reply of the first CALL with an idempotency key.
+type memo struct {
+	done      bool
+	stat      *erpc.Status
+	body      []byte
+	bodyCodec byte
+}
+
+// swapKey the swap key of the idempotency key of the first CALL, to store its reply
+const swapKey = "erpc-dedup-key"
+
+// Deduplicator the deduplication plugin, tracking the (session, seq) pairs and the idempotency keys
+// of the CALL and PUSH messages in a sliding window.
+// NOTE:
+//  The duplicate PUSH is dropped, and the duplicate CALL is replied with Config.Status without handling;
+//  A message is remembered when its header is read, so it is not handled again even if the first handling fails;
+//  If Config.Memoize, the duplicate CALL with an idempotency key is replied with the stored reply of the first one,
+//  unless the first one is not replied yet, and the key failed by the server error (code>=500) is forgotten to be retried.
+type Deduplicator struct {
+	window     time.Duration
+	capacity   int
+	sharedKeys bool
+	stat       *erpc.Status
+	memoize    bool
+	mu         sync.Mutex
+	seen       map[string]time.Time
+	queue      []seen // in the order of seen
+	memos      map[string]*memo
+	dropped    uint64
+}
+
+var (
+	_ erpc.PostReadCallHeaderPlugin = (*Deduplicator)(nil)
+	_ erpc.PostReadPushHeaderPlugin = (*Deduplicator)(nil)
+	_ erpc.PreWriteReplyPlugin      = (*Deduplicator)(nil)
+)
+
+// New creates a deduplication plugin.
+func New(cfg Config) *Deduplicator {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultWindow
+	}
+	if cfg.Capacity <= 0 {
+		cfg.Capacity = DefaultCapacity
+	}
+	if cfg.Status == nil {
+		cfg.Status = StatDuplicate
+	}
+	return &Deduplicator{
+		window:     cfg.Window,
+		capacity:   cfg.Capacity,
+		sharedKeys: cfg.SharedKeys,
+		stat:       cfg.Status,
+		memoize:    cfg.Memoize,
+		seen:       make(map[string]time.Time),
+		memos:      make(map[string]*memo),
+	}
+}
+
+// Name returns the plugin name.
+func (d *Deduplicator) Name() string {
+	return "dedup"
+}
+
+// PostReadCallHeader replies the duplicate CALL with Config.Status, or the stored reply if Config.Memoize.
+func (d *Deduplicator) PostReadCallHeader(ctx erpc.ReadCtx) *erpc.Status {
+	dup, m := d.duplicate(ctx, d.memoize)
+	if !dup {
+		return nil
+	}
+	if m == nil {
+		return d.stat
+	}
+	if !m.stat.OK() {
+		return m.stat
+	}
+	ctx.ReplyDirectly(m.body, m.bodyCodec)
+	return nil
+}
+
+// PostReadPushHeader drops the duplicate PUSH.
+func (d *Deduplicator) PostReadPushHeader(ctx erpc.ReadCtx) *erpc.Status {
+	if dup, _ := d.duplicate(ctx, false); dup {
+		return d.stat
+	}
+	return nil
+}
+
+// PreWriteReply stores the reply of the first CALL with an idempotency key, if Config.Memoize.
+func (d *Deduplicator) PreWriteReply(ctx erpc.WriteCtx) *erpc.Status {
+	key, ok := ctx.Swap().Load(swapKey)
+	if !ok {
+		return nil
+	}
+	ctx.Swap().Delete(swapKey)
+	m := &memo{done: true, stat: ctx.Status()}
+	if m.stat.OK() {
+		output := ctx.Output()
+		body, err := output.MarshalBody()
+		if err != nil {
+			m.stat = erpc.NewStatus(erpc.CodeInternalServerError, erpc.CodeText(erpc.CodeInternalServerError), err)
+		} else {
+			// reuse the encoded body, instead of encoding it again by the socket
+			output.SetBody(body)
+			m.body = append([]byte{}, body...)
+			m.bodyCodec = output.BodyCodec()
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok = d.memos[key.(string)]; !ok {
+		return nil
+	}
+	if m.stat.Code() >= erpc.CodeInternalServerError {
+		delete(d.memos, key.(string))
+		delete(d.seen, key.(string))
+		return nil
+	}
+	d.memos[key.(string)] = m
+	return nil
+}
+
+// Dropped returns the number of the duplicate messages dropped.
+func (d *Deduplicator) Dropped() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dropped
+}
+
+// Len returns the number of the remembered messages.
+func (d *Deduplicator) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.seen)
+}
+
+// duplicate reports whether the message is seen, with the stored reply of its idempotency key if memoize.
+func (d *Deduplicator) duplicate(ctx erpc.ReadCtx, memoize bool) (bool, *memo) {
+	sessID := ctx.Session().ID()
+	keys := []string{"s\x00" + sessID + "\x00" + strconv.FormatInt(int64(ctx.Seq()), 10)}
+	if key := ctx.PeekMeta(MetaIdempotencyKey); len(key) > 0 {
+		if d.sharedKeys {
+			keys = append(keys, "k\x00"+goutil.BytesToString(key))
+		} else {
+			keys = append(keys, "k\x00"+sessID+"\x00"+goutil.BytesToString(key))
+		}
+	} else {
+		memoize = false
+	}
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.evict(now, len(keys))
+	for _, key := range keys {
+		if _, ok := d.seen[key]; ok {
+			d.dropped++
+			if memoize {
+				if m := d.memos[keys[1]]; m != nil && m.done {
+					return true, m
+				}
+			}
+			return true, nil
+		}
+	}
+	for _, key := range keys {
+		d.seen[key] = now
+		d.queue = append(d.queue, seen{key: key, at: now})
+	}
+	if memoize {
+		d.memos[keys[1]] = &memo{}
+		ctx.Swap().Store(swapKey, keys[1])
+	}
+	return false, nil
+}
+
+// evict forgets the messages out of the window, or over the capacity after adding n messages.
+func (d *Deduplicator) evict(now time.Time, n int) {
+	var i int
+	for ; i < len(d.queue); i++ {
+		if now.Sub(d.queue[i].at) < d.window && len(d.queue)-i+n <= d.capacity {
+			break
+		}
+		// the key may be forgotten and seen again
+		if at, ok := d.seen[d.queue[i].key]; ok && at.Equal(d.queue[i].at) {
+			delete(d.seen, d.queue[i].key)
+			delete(d.memos, d.queue[i].key)
+		}
+	}
+	for j := 0; j < i; j++ {
+		d.queue[j] = seen{}
+	}
+	d.queue = d.queue[i:]
+}
@@ -0,0 +1,159 @@
+package dedup
+
+import (
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+var handled int32
+
+type order struct {
+	erpc.CallCtx
+}
+
+// Create counts the handled calls.
+func (o *order) Create(id *int) (int32, *erpc.Status) {
+	return atomic.AddInt32(&handled, 1), nil
+}
+
+func notify(ctx erpc.PushCtx, _ *int) *erpc.Status {
+	atomic.AddInt32(&handled, 1)
+	return nil
+}
+
+func TestDedup(t *testing.T) {
+	d := New(Config{Window: 300 * time.Millisecond, Capacity: 8})
+	srv := erpc.NewPeer(erpc.PeerConfig{}, d)
+	defer srv.Close()
+	srv.RouteCall(new(order))
+	srv.RoutePushFunc(notify)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	time.Sleep(100 * time.Millisecond)
+
+	cli1 := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli1.Close()
+	sess, stat := cli1.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var n int32
+	if stat = sess.Call("/order/create", 1, &n, WithIdempotencyKey("order-1")).Status(); !stat.OK() || n != 1 {
+		t.Fatalf("n: %d, stat: %v", n, stat)
+	}
+	// the retry is not handled again
+	stat = sess.Call("/order/create", 1, &n, WithIdempotencyKey("order-1")).Status()
+	if stat.Code() != CodeDuplicate {
+		t.Fatalf("expect duplicate, got %v", stat)
+	}
+	if stat = sess.Push("/notify", 1, WithIdempotencyKey("order-1")); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if stat = sess.Call("/order/create", 2, &n, WithIdempotencyKey("order-2")).Status(); !stat.OK() || n != 2 {
+		t.Fatalf("n: %d, stat: %v", n, stat)
+	}
+	if d.Dropped() != 2 {
+		t.Fatalf("dropped: %d", d.Dropped())
+	}
+
+	// the keys are scoped by the session
+	cli2 := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli2.Close()
+	sess2, stat := cli2.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	if stat = sess2.Call("/order/create", 1, &n, WithIdempotencyKey("order-1")).Status(); !stat.OK() || n != 3 {
+		t.Fatalf("another session: n: %d, stat: %v", n, stat)
+	}
+
+	// forgotten out of the window
+	time.Sleep(400 * time.Millisecond)
+	if stat = sess.Call("/order/create", 1, &n, WithIdempotencyKey("order-1")).Status(); !stat.OK() || n != 4 {
+		t.Fatalf("out of the window: n: %d, stat: %v", n, stat)
+	}
+
+	// forgotten over the capacity
+	for i := 0; i < 10; i++ {
+		if stat = sess.Call("/order/create", i, &n, WithIdempotencyKey("batch-"+strconv.Itoa(i))).Status(); !stat.OK() {
+			t.Fatal(stat)
+		}
+	}
+	if l := d.Len(); l > 8 {
+		t.Fatalf("len: %d, expect <= 8", l)
+	}
+}
+
+type account struct {
+	erpc.CallCtx
+}
+
+// Debit counts the handled calls, and fails the negative amount by the server error.
+func (a *account) Debit(amount *int) (int32, *erpc.Status) {
+	n := atomic.AddInt32(&handled, 1)
+	if *amount < 0 {
+		return 0, erpc.NewStatus(erpc.CodeInternalServerError, "unavailable", "")
+	}
+	if *amount == 0 {
+		return 0, erpc.NewStatus(400, "zero amount", "")
+	}
+	return n, nil
+}
+
+func TestMemoize(t *testing.T) {
+	atomic.StoreInt32(&handled, 0)
+	d := New(Config{Window: time.Minute, Memoize: true})
+	srv := erpc.NewPeer(erpc.PeerConfig{}, d)
+	defer srv.Close()
+	srv.RouteCall(new(account))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	time.Sleep(100 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	// the retry gets the stored reply
+	for i := 0; i < 3; i++ {
+		var n int32
+		if stat = sess.Call("/account/debit", 10, &n, WithIdempotencyKey("debit-1")).Status(); !stat.OK() || n != 1 {
+			t.Fatalf("n: %d, stat: %v", n, stat)
+		}
+	}
+	// the client error is stored
+	for i := 0; i < 2; i++ {
+		var n int32
+		if stat = sess.Call("/account/debit", 0, &n, WithIdempotencyKey("debit-2")).Status(); stat.Code() != 400 {
+			t.Fatalf("expect 400, got %v", stat)
+		}
+	}
+	// the server error is forgotten to be retried
+	for i := 0; i < 2; i++ {
+		var n int32
+		if stat = sess.Call("/account/debit", -1, &n, WithIdempotencyKey("debit-3")).Status(); stat.Code() != erpc.CodeInternalServerError {
+			t.Fatalf("expect 500, got %v", stat)
+		}
+	}
+	if n := atomic.LoadInt32(&handled); n != 4 {
+		t.Fatalf("handled: %d, expect 4", n)
+	}
+	// without the idempotency key, nothing is stored
+	var n int32
+	if stat = sess.Call("/account/debit", 10, &n).Status(); !stat.OK() || n != 5 {
+		t.Fatalf("n: %d, stat: %v", n, stat)
+	}
+}
@@ -0,0 +1,301 @@
+// Package degrade is a plugin that sheds the lower criticality tiers of the routes first under overload.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package degrade
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/plugin/health"
+)
+
+// Criticality the criticality tier of the routes, the lower tiers are shed first under overload.
+type Criticality byte
+
+// the criticality tiers
+const (
+	Sheddable     Criticality = 0
+	SheddablePlus Criticality = 1
+	Critical      Criticality = 2 // default of the undeclared routes
+	CriticalPlus  Criticality = 3 // never shed
+)
+
+// String returns the name of the tier.
+func (c Criticality) String() string {
+	switch c {
+	case Sheddable:
+		return "sheddable"
+	case SheddablePlus:
+		return "sheddable_plus"
+	case Critical:
+		return "critical"
+	case CriticalPlus:
+		return "critical_plus"
+	}
+	return fmt.Sprintf("criticality(%d)", byte(c))
+}
+
+const (
+	// DefaultName the default name of the shedding state in the health report
+	DefaultName = "degrade"
+	// DefaultInterval the default interval of adjusting the shedding level
+	DefaultInterval = time.Second
+	// DefaultRecovery the default load, below which the shedding level is lowered
+	DefaultRecovery = 0.8
+)
+
+// swapKey the swap key of the measured CALL, whose value is the start time
+const swapKey = "erpc-degrade-start"
+
+// StatShed the status replied to the shed CALL
+var StatShed = erpc.NewStatus(erpc.CodeServiceUnavailable, "Shed By Overload", "")
+
+// Config the graceful degradation config
+type Config struct {
+	// Name the name of the shedding state in the health report, default DefaultName
+	Name string
+	// MaxInflight the number of the in-flight CALL handlers at which the peer is overloaded; if <=0, not measured
+	MaxInflight int
+	// TargetLatency the average CALL handling latency at which the peer is overloaded; if <=0, not measured
+	TargetLatency time.Duration
+	// Signal the custom load, e.g. by the CPU usage, the peer is overloaded if it is at least 1; optional
+	Signal func() float64
+	// Interval the interval of adjusting the shedding level by one tier, default DefaultInterval
+	Interval time.Duration
+	// Recovery the load below which the shedding level is lowered, in (0,1), default DefaultRecovery
+	Recovery float64
+	// Status the status replied to the shed CALL, default StatShed
+	Status *erpc.Status
+}
+
+// Controller the overload controller, which measures the load by the in-flight handlers, the latency and the custom signal,
+// raises the shedding level by one tier each interval under overload, and lowers it after the load recovers.
+// NOTE:
+//  Register it with the peer, and declare the criticality of the routes by Controller.Tier;
+//  The CALL and PUSH of the tiers below the shedding level are rejected with Config.Status, or dropped;
+//  The shedding state is reported in health.Report.States by Config.Name.
+type Controller struct {
+	maxInflight   int
+	targetLatency time.Duration
+	signal        func() float64
+	interval      time.Duration
+	recovery      float64
+	stat          *erpc.Status
+
+	mu          sync.Mutex
+	tiers       map[string]Criticality
+	level       Criticality // the tiers below it are shed
+	load        float64
+	inflight    int
+	latencySum  time.Duration
+	latencyN    int
+	lastAdjust  time.Time
+	shed        uint64
+	lastLatency time.Duration // the average latency of the last interval
+}
+
+var (
+	_ erpc.PostReadCallHeaderPlugin = (*Controller)(nil)
+	_ erpc.PostReadPushHeaderPlugin = (*Controller)(nil)
+	_ erpc.PostReadCallBodyPlugin   = (*Controller)(nil)
+	_ erpc.PostHandleCallPlugin     = (*Controller)(nil)
+)
+
+// New creates an overload controller plugin, and registers its state to the health report.
+func New(cfg Config) *Controller {
+	if cfg.Name == "" {
+		cfg.Name = DefaultName
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.Recovery <= 0 || cfg.Recovery >= 1 {
+		cfg.Recovery = DefaultRecovery
+	}
+	if cfg.Status == nil {
+		cfg.Status = StatShed
+	}
+	c := &Controller{
+		maxInflight:   cfg.MaxInflight,
+		targetLatency: cfg.TargetLatency,
+		signal:        cfg.Signal,
+		interval:      cfg.Interval,
+		recovery:      cfg.Recovery,
+		stat:          cfg.Status,
+		// the health route reports the shedding state, so it is never shed
+		tiers:      map[string]Criticality{health.ServiceMethod: CriticalPlus},
+		lastAdjust: time.Now(),
+	}
+	health.RegisterState(cfg.Name, c.State)
+	return c
+}
+
+// Name returns the plugin name.
+func (c *Controller) Name() string {
+	return "degrade"
+}
+
+// Tier returns a route plugin declaring the criticality of the routes.
+// Example:
+//  peer.RouteCall(new(Report), ctrl.Tier(degrade.Sheddable))
+func (c *Controller) Tier(tier Criticality) erpc.Plugin {
+	if tier > CriticalPlus {
+		tier = CriticalPlus
+	}
+	return &tierPlugin{c: c, tier: tier}
+}
+
+type tierPlugin struct {
+	c    *Controller
+	tier Criticality
+}
+
+var _ erpc.PostRegPlugin = (*tierPlugin)(nil)
+
+func (t *tierPlugin) Name() string {
+	return "degrade-tier:" + t.tier.String()
+}
+
+func (t *tierPlugin) PostReg(h *erpc.Handler) error {
+	t.c.mu.Lock()
+	t.c.tiers[h.Name()] = t.tier
+	t.c.mu.Unlock()
+	return nil
+}
+
+// PostReadCallHeader rejects the CALL of the shed tiers.
+func (c *Controller) PostReadCallHeader(ctx erpc.ReadCtx) *erpc.Status {
+	if c.shedding(ctx.ServiceMethod()) {
+		return c.stat
+	}
+	return nil
+}
+
+// PostReadPushHeader drops the PUSH of the shed tiers.
+func (c *Controller) PostReadPushHeader(ctx erpc.ReadCtx) *erpc.Status {
+	if c.shedding(ctx.ServiceMethod()) {
+		return c.stat
+	}
+	return nil
+}
+
+// PostReadCallBody measures the CALL to be handled.
+func (c *Controller) PostReadCallBody(ctx erpc.ReadCtx) *erpc.Status {
+	c.mu.Lock()
+	c.inflight++
+	c.mu.Unlock()
+	ctx.Swap().Store(swapKey, time.Now())
+	return nil
+}
+
+// PostHandleCall samples the latency of the handled CALL.
+func (c *Controller) PostHandleCall(ctx erpc.WriteCtx) *erpc.Status {
+	start, ok := ctx.Swap().Load(swapKey)
+	if !ok {
+		return nil
+	}
+	ctx.Swap().Delete(swapKey)
+	latency := time.Since(start.(time.Time))
+	c.mu.Lock()
+	c.inflight--
+	c.latencySum += latency
+	c.latencyN++
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Controller) shedding(serviceMethod string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.adjust(time.Now())
+	if c.level == 0 {
+		return false
+	}
+	tier, ok := c.tiers[serviceMethod]
+	if !ok {
+		tier = Critical
+	}
+	if tier >= c.level {
+		return false
+	}
+	c.shed++
+	return true
+}
+
+// adjust raises or lowers the shedding level by one tier at most once in each interval.
+func (c *Controller) adjust(now time.Time) {
+	if now.Sub(c.lastAdjust) < c.interval {
+		return
+	}
+	c.lastAdjust = now
+	var load float64
+	if c.maxInflight > 0 {
+		load = float64(c.inflight) / float64(c.maxInflight)
+	}
+	c.lastLatency = 0
+	if c.latencyN > 0 {
+		c.lastLatency = c.latencySum / time.Duration(c.latencyN)
+		c.latencySum, c.latencyN = 0, 0
+	}
+	if c.targetLatency > 0 {
+		load = math.Max(load, float64(c.lastLatency)/float64(c.targetLatency))
+	}
+	if c.signal != nil {
+		load = math.Max(load, c.signal())
+	}
+	c.load = load
+	switch {
+	case load >= 1 && c.level < CriticalPlus:
+		c.level++
+	case load < c.recovery && c.level > 0:
+		c.level--
+	}
+}
+
+// Level returns the shedding level, the tiers below which are shed; 0 means no shedding.
+func (c *Controller) Level() Criticality {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.adjust(time.Now())
+	return c.level
+}
+
+// Load returns the load measured at the last adjustment, the peer is overloaded if it is at least 1.
+func (c *Controller) Load() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.load
+}
+
+// Shed returns the number of the CALLs and PUSHes shed.
+func (c *Controller) Shed() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.shed
+}
+
+// State returns the shedding state reported in the health report, e.g. "shedding below critical, load 1.25".
+func (c *Controller) State() string {
+	level := c.Level()
+	load := c.Load()
+	if level == 0 {
+		return fmt.Sprintf("normal, load %.2f", load)
+	}
+	return fmt.Sprintf("shedding below %s, load %.2f", level, load)
+}
@@ -0,0 +1,108 @@
+package degrade_test
+
+import (
+	"math"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/plugin/degrade"
+	"github.com/andeya/erpc/v7/plugin/health"
+)
+
+type report struct {
+	erpc.CallCtx
+}
+
+func (r *report) Get(*int) (string, *erpc.Status) {
+	return "report", nil
+}
+
+type home struct {
+	erpc.CallCtx
+}
+
+func (h *home) Get(*int) (string, *erpc.Status) {
+	return "home", nil
+}
+
+type login struct {
+	erpc.CallCtx
+}
+
+func (l *login) Do(*int) (string, *erpc.Status) {
+	return "login", nil
+}
+
+func TestDegrade(t *testing.T) {
+	var load uint64 // float64 bits
+	ctrl := degrade.New(degrade.Config{
+		Interval: 100 * time.Millisecond,
+		Signal:   func() float64 { return math.Float64frombits(atomic.LoadUint64(&load)) },
+	})
+	defer health.UnregisterState(degrade.DefaultName)
+	srv := erpc.NewPeer(erpc.PeerConfig{}, ctrl, health.NewPlugin())
+	defer srv.Close()
+	srv.RouteCall(new(report), ctrl.Tier(degrade.Sheddable))
+	srv.RouteCall(new(home))
+	srv.RouteCall(new(login), ctrl.Tier(degrade.CriticalPlus))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	time.Sleep(100 * time.Millisecond)
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	expect := func(level degrade.Criticality, report, home, login bool) {
+		t.Helper()
+		if l := ctrl.Level(); l != level {
+			t.Fatalf("level: %s, expect %s", l, level)
+		}
+		for serviceMethod, ok := range map[string]bool{"/report/get": report, "/home/get": home, "/login/do": login} {
+			stat := sess.Call(serviceMethod, 1, new(string)).Status()
+			if ok != stat.OK() {
+				t.Fatalf("level %s: %s: %v", level, serviceMethod, stat)
+			}
+			if !ok && stat.Code() != erpc.CodeServiceUnavailable {
+				t.Fatalf("level %s: %s: expect shed, got %v", level, serviceMethod, stat)
+			}
+		}
+	}
+	expect(0, true, true, true)
+
+	// raise one tier each interval
+	atomic.StoreUint64(&load, math.Float64bits(2))
+	time.Sleep(110 * time.Millisecond)
+	expect(degrade.SheddablePlus, false, true, true)
+	time.Sleep(110 * time.Millisecond)
+	expect(degrade.Critical, false, true, true)
+	time.Sleep(110 * time.Millisecond)
+	expect(degrade.CriticalPlus, false, false, true)
+	time.Sleep(110 * time.Millisecond)
+	expect(degrade.CriticalPlus, false, false, true)
+
+	r, stat := health.CheckHealth(sess)
+	if !stat.OK() || !strings.HasPrefix(r.States[degrade.DefaultName], "shedding below critical_plus") {
+		t.Fatalf("stat: %v, report: %+v", stat, r)
+	}
+
+	// lower after the recovery
+	atomic.StoreUint64(&load, math.Float64bits(0.5))
+	time.Sleep(110 * time.Millisecond)
+	expect(degrade.Critical, false, true, true)
+	time.Sleep(110 * time.Millisecond)
+	expect(degrade.SheddablePlus, false, true, true)
+	time.Sleep(110 * time.Millisecond)
+	expect(0, true, true, true)
+	if ctrl.Shed() != 8 {
+		t.Fatalf("shed: %d", ctrl.Shed())
+	}
+}
@@ -0,0 +1,169 @@
+// Package dictcompress is a plugin that negotiates the compression dictionary per session.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dictcompress
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/xfer/dict"
+)
+
+// ServiceMethod the service method of the dictionary negotiation handshake
+const ServiceMethod = "/dict/negotiate"
+
+type (
+	// Args the negotiation request sent by the client at each dial.
+	Args struct {
+		// IDs the dictionary filter ids of the client, in the order of preference
+		IDs []byte `json:"ids"`
+	}
+	// Result the negotiation result replied by the server.
+	Result struct {
+		// ID the chosen dictionary filter id
+		ID byte `json:"id"`
+		// OK whether a dictionary is chosen
+		OK bool `json:"ok"`
+	}
+)
+
+// NewClientPlugin creates a dictcompress plugin for client,
+// which offers the dictionaries at each dial, and compresses by the one chosen by the server.
+// NOTE:
+//  If no filterIDs, offer all the registered dictionaries by dict.Reg;
+//  The message whose encoded body is at least minBytes is compressed, see erpc.PreSession.SetAutoCompress;
+//  The server must use the plugin created by NewServerPlugin.
+func NewClientPlugin(minBytes int, filterIDs ...byte) erpc.Plugin {
+	return &clientPlugin{minBytes: minBytes, filterIDs: filterIDs}
+}
+
+// NewServerPlugin creates a dictcompress plugin for server,
+// which chooses the first dictionary offered by the client that it also supports.
+// NOTE:
+//  If no filterIDs, support all the registered dictionaries by dict.Reg;
+//  The message whose encoded body is at least minBytes is compressed, see erpc.PreSession.SetAutoCompress;
+//  The client must use the plugin created by NewClientPlugin.
+func NewServerPlugin(minBytes int, filterIDs ...byte) erpc.Plugin {
+	return &serverPlugin{minBytes: minBytes, filterIDs: filterIDs}
+}
+
+func getIDs(filterIDs []byte) []byte {
+	if len(filterIDs) > 0 {
+		return filterIDs
+	}
+	return dict.IDs()
+}
+
+type clientPlugin struct {
+	minBytes  int
+	filterIDs []byte
+}
+
+var _ erpc.PostDialPlugin = new(clientPlugin)
+
+func (c *clientPlugin) Name() string {
+	return "dictcompress-client"
+}
+
+func (c *clientPlugin) PostDial(sess erpc.PreSession, isRedial bool) *erpc.Status {
+	args := Args{IDs: getIDs(c.filterIDs)}
+	stat := sess.PreSend(erpc.TypeCall, ServiceMethod, &args, nil)
+	if !stat.OK() {
+		return stat
+	}
+	var result Result
+	retMsg := sess.PreReceive(func(header erpc.Header) interface{} {
+		if header.Mtype() != erpc.TypeReply || header.ServiceMethod() != ServiceMethod {
+			return nil
+		}
+		return &result
+	})
+	if !retMsg.StatusOK() {
+		return retMsg.Status()
+	}
+	if retMsg.Mtype() != erpc.TypeReply || retMsg.ServiceMethod() != ServiceMethod {
+		return erpc.NewStatus(
+			erpc.CodeBadMessage,
+			erpc.CodeText(erpc.CodeBadMessage),
+			fmt.Sprintf("dictcompress message(1st) expect: REPLY %s, but received: %s %s",
+				ServiceMethod, erpc.TypeText(retMsg.Mtype()), retMsg.ServiceMethod()),
+		)
+	}
+	if !result.OK {
+		return nil
+	}
+	if bytes.IndexByte(args.IDs, result.ID) < 0 {
+		return erpc.NewStatus(erpc.CodeBadMessage, erpc.CodeText(erpc.CodeBadMessage),
+			fmt.Sprintf("dictcompress: the dictionary %d is not offered", result.ID))
+	}
+	return setAutoCompress(sess, c.minBytes, result.ID)
+}
+
+type serverPlugin struct {
+	minBytes  int
+	filterIDs []byte
+}
+
+var _ erpc.PostAcceptPlugin = new(serverPlugin)
+
+func (s *serverPlugin) Name() string {
+	return "dictcompress-server"
+}
+
+func (s *serverPlugin) PostAccept(sess erpc.PreSession) *erpc.Status {
+	var args Args
+	input := sess.PreReceive(func(header erpc.Header) interface{} {
+		if header.Mtype() != erpc.TypeCall || header.ServiceMethod() != ServiceMethod {
+			return nil
+		}
+		return &args
+	})
+	if !input.StatusOK() {
+		return input.Status()
+	}
+	if input.Mtype() != erpc.TypeCall || input.ServiceMethod() != ServiceMethod {
+		return erpc.NewStatus(
+			erpc.CodeBadMessage,
+			erpc.CodeText(erpc.CodeBadMessage),
+			fmt.Sprintf("dictcompress message(1st) expect: CALL %s, but received: %s %s",
+				ServiceMethod, erpc.TypeText(input.Mtype()), input.ServiceMethod()),
+		)
+	}
+	var result Result
+	supported := getIDs(s.filterIDs)
+	for _, id := range args.IDs {
+		if bytes.IndexByte(supported, id) >= 0 {
+			result = Result{ID: id, OK: true}
+			break
+		}
+	}
+	stat := sess.PreSend(erpc.TypeReply, ServiceMethod, &result, nil)
+	if !stat.OK() {
+		return stat
+	}
+	if !result.OK {
+		return nil
+	}
+	return setAutoCompress(sess, s.minBytes, result.ID)
+}
+
+func setAutoCompress(sess erpc.PreSession, minBytes int, id byte) *erpc.Status {
+	if err := sess.SetAutoCompress(minBytes, id); err != nil {
+		return erpc.NewStatus(erpc.CodeBadMessage, erpc.CodeText(erpc.CodeBadMessage), err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package dictcompress_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/plugin/dictcompress"
+	"github.com/andeya/erpc/v7/xfer/dict"
+)
+
+type echo struct {
+	erpc.CallCtx
+}
+
+// Filters returns the transfer filters of the call.
+func (e *echo) Filters(arg *string) ([]string, *erpc.Status) {
+	return e.Input().XferPipe().Names(), nil
+}
+
+func TestDictCompress(t *testing.T) {
+	d := strings.Repeat(`{"name":"erpc","kind":"dictionary"}`, 10)
+	dict.Reg('A', "dict-a", []byte(d), 6)
+	dict.Reg('B', "dict-b", []byte(d), 6)
+
+	srv := erpc.NewPeer(erpc.PeerConfig{}, dictcompress.NewServerPlugin(64, 'B'))
+	defer srv.Close()
+	srv.RouteCall(new(echo))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	time.Sleep(100 * time.Millisecond)
+
+	// offers A and B, and B is chosen
+	cli := erpc.NewPeer(erpc.PeerConfig{}, dictcompress.NewClientPlugin(64))
+	defer cli.Close()
+	sess, stat := cli.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var names []string
+	if stat = sess.Call("/echo/filters", strings.Repeat("x", 100), &names).Status(); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if len(names) != 1 || names[0] != "dict-b" {
+		t.Fatalf("filters: %v", names)
+	}
+	if stat = sess.Call("/echo/filters", "x", &names).Status(); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if len(names) != 0 {
+		t.Fatalf("filters: %v, expect not compressed", names)
+	}
+
+	// no common dictionary
+	cli2 := erpc.NewPeer(erpc.PeerConfig{}, dictcompress.NewClientPlugin(64, 'A'))
+	defer cli2.Close()
+	sess, stat = cli2.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	if stat = sess.Call("/echo/filters", strings.Repeat("x", 100), &names).Status(); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if len(names) != 0 {
+		t.Fatalf("filters: %v, expect not compressed", names)
+	}
+}
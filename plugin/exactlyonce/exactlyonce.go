@@ -0,0 +1,404 @@
+// Package exactlyonce is an opt-in layer of the exactly-once CALL semantics across reconnects and restarts,
+// combining the idempotency keys, the persistent replies, the client outbox and the acknowledgements.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package exactlyonce
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/codec"
+	"github.com/andeya/erpc/v7/plugin/dedup"
+)
+
+// AckServiceMethod the PUSH route of the acknowledgements of the replies received by the client,
+// whose body is the list of Ack
+const AckServiceMethod = "/erpc/exactlyonce/ack"
+
+const (
+	// DefaultRetention the default duration of keeping the unacknowledged replies
+	DefaultRetention = 24 * time.Hour
+	// DefaultHandlingTimeout the default max duration of the CALL of a key in handling
+	DefaultHandlingTimeout = 10 * time.Minute
+)
+
+// swapKey the swap key of the idempotency key of the handled CALL, to store its reply
+const swapKey = "erpc-exactlyonce-key"
+
+// ServerConfig the server config
+type ServerConfig struct {
+	// Store the store of the replies, default the in-memory one, see NewMemoryReplyStore
+	Store ReplyStore
+	// Retention the duration of keeping the unacknowledged replies, default DefaultRetention
+	Retention time.Duration
+	// HandlingTimeout the max duration of the CALL of a key in handling, after which its retry is handled again,
+	// e.g. the CALL dropped before the handling by the full handler queue, default DefaultHandlingTimeout
+	HandlingTimeout time.Duration
+	// SharedKeys whether the idempotency keys are shared by all sessions, e.g. the retries after the reconnect,
+	// otherwise they are scoped by the session id; they are always scoped by the service method
+	SharedKeys bool
+}
+
+// Server the server plugin handling the CALL of an idempotency key only once,
+// and replying its retries with the stored reply until the client acknowledges it.
+// NOTE:
+//  The keys are scoped by the service method and the session id, so the retries after the reconnect get the stored reply
+//  only if the session id is kept, e.g. set by the authentication, or ServerConfig.SharedKeys is enabled;
+//  The reply is stored before it is written, so the crash between the handling and the reply delivery is safe,
+//  but the crash during the handling still handles the retry again, unless the handler commits its effects
+//  and the reply in the same transaction of the store;
+//  The retry of the CALL in handling is replied with dedup.StatDuplicate, and the reply failed by
+//  the server error (code>=500) or not written (e.g. canceled by the caller) is not stored to be retried;
+//  The expiring timers are not persistent, the persistent store should expire the replies by itself after the restart;
+//  The times are of the peer clock, see erpc.PeerConfig.Clock.
+type Server struct {
+	store           ReplyStore
+	retention       time.Duration
+	handlingTimeout time.Duration
+	sharedKeys      bool
+	clock           erpc.Clock
+	mu              sync.Mutex
+	handling        map[string]time.Time // the start time of the handling of the scoped key
+	replayed        uint64
+}
+
+var (
+	_ erpc.PostNewPeerPlugin        = (*Server)(nil)
+	_ erpc.PostReadCallHeaderPlugin = (*Server)(nil)
+	_ erpc.PreWriteReplyPlugin      = (*Server)(nil)
+	_ erpc.PostHandleCallPlugin     = (*Server)(nil)
+)
+
+// NewServer creates a server plugin.
+func NewServer(cfg ServerConfig) *Server {
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryReplyStore()
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = DefaultRetention
+	}
+	if cfg.HandlingTimeout <= 0 {
+		cfg.HandlingTimeout = DefaultHandlingTimeout
+	}
+	return &Server{
+		store:           cfg.Store,
+		retention:       cfg.Retention,
+		handlingTimeout: cfg.HandlingTimeout,
+		sharedKeys:      cfg.SharedKeys,
+		clock:           erpc.SystemClock,
+		handling:        make(map[string]time.Time),
+	}
+}
+
+// Name returns the plugin name.
+func (s *Server) Name() string {
+	return "exactlyonce"
+}
+
+// servers the server plugins of the peers, to be found by the ack handler
+var servers sync.Map // erpc.Peer -> *Server
+
+// PostNewPeer registers the ack route, and uses the clock of the peer.
+func (s *Server) PostNewPeer(peer erpc.EarlyPeer) error {
+	s.clock = peer.Clock()
+	servers.Store(peer, s)
+	peer.SubRoute("/erpc/exactlyonce").RoutePushFunc((*ackPush).ack)
+	return nil
+}
+
+// PostReadCallHeader replies the retried CALL with the stored reply, or dedup.StatDuplicate if it is in handling.
+func (s *Server) PostReadCallHeader(ctx erpc.ReadCtx) *erpc.Status {
+	b := ctx.PeekMeta(dedup.MetaIdempotencyKey)
+	if len(b) == 0 {
+		return nil
+	}
+	key := s.scope(ctx.Session().ID(), ctx.ServiceMethod(), string(b))
+	now := s.clock.Now()
+	s.mu.Lock()
+	if start, ok := s.handling[key]; ok && now.Sub(start) < s.handlingTimeout {
+		s.mu.Unlock()
+		return dedup.StatDuplicate
+	}
+	s.handling[key] = now
+	s.mu.Unlock()
+	reply, ok, err := s.store.Load(key)
+	if err != nil || ok {
+		s.done(key, ok)
+	}
+	if err != nil {
+		return erpc.NewStatus(erpc.CodeInternalServerError, erpc.CodeText(erpc.CodeInternalServerError), err)
+	}
+	if ok {
+		if reply.Code != erpc.CodeOK {
+			return erpc.NewStatus(reply.Code, reply.Msg, reply.Cause)
+		}
+		ctx.ReplyDirectly(reply.Body, reply.BodyCodec)
+		return nil
+	}
+	ctx.Swap().Store(swapKey, key)
+	return nil
+}
+
+// PreWriteReply stores the reply of the handled CALL with an idempotency key, before it is written.
+func (s *Server) PreWriteReply(ctx erpc.WriteCtx) *erpc.Status {
+	key, ok := ctx.Swap().Load(swapKey)
+	if !ok {
+		return nil
+	}
+	ctx.Swap().Delete(swapKey)
+	defer s.done(key.(string), false)
+	stat := ctx.Status()
+	if stat.Code() >= erpc.CodeInternalServerError {
+		return nil
+	}
+	reply := &Reply{Key: key.(string), Code: stat.Code(), At: s.clock.Now()}
+	if stat.OK() {
+		output := ctx.Output()
+		body, err := output.MarshalBody()
+		if err != nil {
+			return erpc.NewStatus(erpc.CodeInternalServerError, erpc.CodeText(erpc.CodeInternalServerError), err)
+		}
+		// reuse the encoded body, instead of encoding it again by the socket
+		output.SetBody(body)
+		reply.Body = append([]byte{}, body...)
+		reply.BodyCodec = output.BodyCodec()
+	} else {
+		reply.Msg = stat.Msg()
+		if cause := stat.Cause(); cause != nil {
+			reply.Cause = cause.Error()
+		}
+	}
+	if err := s.store.Save(reply); err != nil {
+		erpc.Warnf("exactlyonce: store the reply of %s: %v", reply.Key, err)
+		return nil
+	}
+	s.clock.AfterFunc(s.retention, func() {
+		if err := s.store.Delete(reply.Key); err != nil {
+			erpc.Warnf("exactlyonce: expire the reply of %s: %v", reply.Key, err)
+		}
+	})
+	return nil
+}
+
+// PostHandleCall marks the CALL not in handling, if its reply is not written, e.g. canceled by the caller.
+func (s *Server) PostHandleCall(ctx erpc.WriteCtx) *erpc.Status {
+	if key, ok := ctx.Swap().Load(swapKey); ok {
+		ctx.Swap().Delete(swapKey)
+		s.done(key.(string), false)
+	}
+	return nil
+}
+
+// scope returns the key scoped by the service method, and by the session id unless ServerConfig.SharedKeys.
+func (s *Server) scope(sessID, serviceMethod, key string) string {
+	if s.sharedKeys {
+		return serviceMethod + "\x00" + key
+	}
+	return sessID + "\x00" + serviceMethod + "\x00" + key
+}
+
+// Replayed returns the number of the retried CALL replied with the stored reply.
+func (s *Server) Replayed() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.replayed
+}
+
+// done marks the CALL of the key not in handling.
+func (s *Server) done(key string, replayed bool) {
+	s.mu.Lock()
+	delete(s.handling, key)
+	if replayed {
+		s.replayed++
+	}
+	s.mu.Unlock()
+}
+
+type ackPush struct {
+	erpc.PushCtx
+}
+
+// Ack the acknowledgement of the reply received by the client.
+type Ack struct {
+	ServiceMethod string `json:"service_method"`
+	Key           string `json:"key"`
+}
+
+// ack deletes the stored replies acknowledged by the client.
+// NOTE: Without ServerConfig.SharedKeys, the replies of the other sessions are expired after the retention instead.
+func (a *ackPush) ack(acks *[]Ack) *erpc.Status {
+	v, ok := servers.Load(a.Peer())
+	if !ok {
+		return nil
+	}
+	s := v.(*Server)
+	for _, ack := range *acks {
+		key := s.scope(a.Session().ID(), ack.ServiceMethod, ack.Key)
+		if err := s.store.Delete(key); err != nil {
+			erpc.Warnf("exactlyonce: delete the acknowledged reply of %s: %v", ack.Key, err)
+		}
+	}
+	return nil
+}
+
+// Caller the peer session of the outbox calls, e.g. erpc.Session.
+type Caller interface {
+	Call(serviceMethod string, args interface{}, result interface{}, setting ...erpc.MessageSetting) erpc.CallCmd
+	Push(serviceMethod string, args interface{}, setting ...erpc.MessageSetting) *erpc.Status
+}
+
+// OutboxConfig the outbox config
+type OutboxConfig struct {
+	// Store the store of the pending calls, default the in-memory one, see NewMemoryOutboxStore
+	Store OutboxStore
+}
+
+// Outbox the client outbox, persisting the calls with the idempotency keys before sending them,
+// and keeping the ones without the reply to be flushed after the reconnect or restart.
+// NOTE:
+//  The argument is persisted in JSON, and the call is sent with the JSON body codec;
+//  The message settings are not persisted, pass them again to Flush;
+//  The call is kept if its reply is not received (i.e. the connection or timeout errors),
+//  or the server is still handling it, see Retryable.
+type Outbox struct {
+	store   OutboxStore
+	mu      sync.Mutex
+	sending map[string]struct{}
+	acks    []Ack // the acknowledgements failed to be sent
+}
+
+// NewOutbox creates a client outbox.
+func NewOutbox(cfg OutboxConfig) *Outbox {
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryOutboxStore()
+	}
+	return &Outbox{
+		store:   cfg.Store,
+		sending: make(map[string]struct{}),
+	}
+}
+
+// Call persists the call in the outbox and sends it, the call is deleted and acknowledged when the reply is received.
+// NOTE: If the returned status is Retryable, the call is kept in the outbox, and the result is delivered by Flush.
+func (o *Outbox) Call(caller Caller, serviceMethod string, arg interface{}, result interface{}, setting ...erpc.MessageSetting) *erpc.Status {
+	body, err := json.Marshal(arg)
+	if err != nil {
+		return erpc.NewStatus(erpc.CodeBadMessage, erpc.CodeText(erpc.CodeBadMessage), err)
+	}
+	entry := &Entry{Key: newKey(), ServiceMethod: serviceMethod, Arg: body, At: time.Now()}
+	if err = o.store.Put(entry); err != nil {
+		return erpc.NewStatus(erpc.CodeInternalServerError, erpc.CodeText(erpc.CodeInternalServerError), err)
+	}
+	o.mu.Lock()
+	o.sending[entry.Key] = struct{}{}
+	o.mu.Unlock()
+	return o.send(caller, entry, result, setting)
+}
+
+// Flush sends the acknowledgements failed to be sent and the pending calls in the order of their creation,
+// e.g. after the reconnect or restart, and calls fn with the encoded reply body of each replied call.
+// NOTE: It returns the number of the replied calls, and stops at the first Retryable status.
+func (o *Outbox) Flush(caller Caller, fn func(entry *Entry, reply []byte, stat *erpc.Status), setting ...erpc.MessageSetting) (int, *erpc.Status) {
+	o.mu.Lock()
+	acks := o.acks
+	o.acks = nil
+	o.mu.Unlock()
+	o.ack(caller, acks...)
+	entries, err := o.store.List()
+	if err != nil {
+		return 0, erpc.NewStatus(erpc.CodeInternalServerError, erpc.CodeText(erpc.CodeInternalServerError), err)
+	}
+	var n int
+	for _, entry := range entries {
+		o.mu.Lock()
+		_, ok := o.sending[entry.Key]
+		if !ok {
+			o.sending[entry.Key] = struct{}{}
+		}
+		o.mu.Unlock()
+		if ok {
+			continue
+		}
+		var reply []byte
+		stat := o.send(caller, entry, &reply, setting)
+		if Retryable(stat) {
+			return n, stat
+		}
+		n++
+		if fn != nil {
+			fn(entry, reply, stat)
+		}
+	}
+	return n, nil
+}
+
+// Pending returns the number of the pending calls.
+func (o *Outbox) Pending() (int, error) {
+	entries, err := o.store.List()
+	return len(entries), err
+}
+
+// send sends the call of the entry in sending, and deletes and acknowledges it if replied.
+func (o *Outbox) send(caller Caller, entry *Entry, result interface{}, setting []erpc.MessageSetting) *erpc.Status {
+	defer func() {
+		o.mu.Lock()
+		delete(o.sending, entry.Key)
+		o.mu.Unlock()
+	}()
+	setting = append(setting[:len(setting):len(setting)], erpc.WithBodyCodec(codec.ID_JSON), dedup.WithIdempotencyKey(entry.Key))
+	stat := caller.Call(entry.ServiceMethod, []byte(entry.Arg), result, setting...).Status()
+	if Retryable(stat) {
+		return stat
+	}
+	if err := o.store.Delete(entry.Key); err != nil {
+		erpc.Warnf("exactlyonce: delete the replied call of %s: %v", entry.Key, err)
+	}
+	o.ack(caller, Ack{ServiceMethod: entry.ServiceMethod, Key: entry.Key})
+	return stat
+}
+
+// ack sends the acknowledgements, and keeps them to be sent by Flush if failed.
+func (o *Outbox) ack(caller Caller, acks ...Ack) {
+	if len(acks) == 0 {
+		return
+	}
+	if stat := caller.Push(AckServiceMethod, acks); !stat.OK() {
+		o.mu.Lock()
+		o.acks = append(o.acks, acks...)
+		o.mu.Unlock()
+	}
+}
+
+// Retryable reports whether the reply of the call is not received, or the server is still handling it,
+// so the call is kept in the outbox.
+func Retryable(stat *erpc.Status) bool {
+	switch stat.Code() {
+	case erpc.CodeWrongConn, erpc.CodeConnClosed, erpc.CodeWriteFailed, erpc.CodeDialFailed,
+		erpc.CodeCallCanceled, erpc.CodeSessionNotFound, erpc.CodeHandleTimeout, dedup.CodeDuplicate:
+		return true
+	}
+	return false
+}
+
+func newKey() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,211 @@
+package exactlyonce
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/plugin/dedup"
+)
+
+// lossyCaller loses the reply of the first call, like the crash between the handling and the reply delivery.
+type lossyCaller struct {
+	erpc.Session
+	lost int32
+}
+
+func (c *lossyCaller) Call(serviceMethod string, args interface{}, result interface{}, setting ...erpc.MessageSetting) erpc.CallCmd {
+	cmd := c.Session.Call(serviceMethod, args, result, setting...)
+	if atomic.CompareAndSwapInt32(&c.lost, 0, 1) {
+		return lostCallCmd{cmd}
+	}
+	return cmd
+}
+
+type lostCallCmd struct {
+	erpc.CallCmd
+}
+
+func (lostCallCmd) Status() *erpc.Status {
+	return erpc.NewStatus(erpc.CodeConnClosed, erpc.CodeText(erpc.CodeConnClosed), "")
+}
+
+// cancelingCaller waits for the reply until the context is done, i.e. the caller cancels the call.
+type cancelingCaller struct {
+	erpc.Session
+	ctx context.Context
+}
+
+func (c *cancelingCaller) Call(serviceMethod string, args interface{}, result interface{}, setting ...erpc.MessageSetting) erpc.CallCmd {
+	cmd := c.Session.AsyncCall(serviceMethod, args, result, make(chan erpc.CallCmd, 1), setting...)
+	return waitCallCmd{cmd, c.ctx}
+}
+
+type waitCallCmd struct {
+	erpc.CallCmd
+	ctx context.Context
+}
+
+func (c waitCallCmd) Status() *erpc.Status {
+	return c.Wait(c.ctx)
+}
+
+func TestExactlyOnce(t *testing.T) {
+	replies := NewMemoryReplyStore()
+	var handled int32
+	var uri string
+	newServer := func() erpc.Peer {
+		srv := erpc.NewPeer(erpc.PeerConfig{}, NewServer(ServerConfig{Store: replies, SharedKeys: true}))
+		uri = srv.RouteCallFunc(func(ctx erpc.CallCtx, arg *int) (int, *erpc.Status) {
+			atomic.AddInt32(&handled, 1)
+			return *arg * 2, nil
+		})
+		return srv
+	}
+	srv := newServer()
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := erpc.ConnectPipe(srv, cli)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	outbox := NewOutbox(OutboxConfig{})
+
+	// replied
+	var result int
+	if stat = outbox.Call(sess, uri, 1, &result); !stat.OK() || result != 2 {
+		t.Fatalf("result: %d, stat: %v", result, stat)
+	}
+	if n, _ := outbox.Pending(); n != 0 {
+		t.Fatalf("pending: %d", n)
+	}
+
+	// the reply is lost, and the call is kept in the outbox
+	lossy := &lossyCaller{Session: sess}
+	if stat = outbox.Call(lossy, uri, 2, &result); !Retryable(stat) {
+		t.Fatalf("expect retryable, got %v", stat)
+	}
+	if n, _ := outbox.Pending(); n != 1 {
+		t.Fatalf("pending: %d", n)
+	}
+
+	// the server restarts with the same store, and the client reconnects
+	srv.Close()
+	srv = newServer()
+	defer srv.Close()
+	sess, stat = erpc.ConnectPipe(srv, cli)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var flushed string
+	n, stat := outbox.Flush(sess, func(entry *Entry, reply []byte, stat *erpc.Status) {
+		if !stat.OK() {
+			t.Fatal(stat)
+		}
+		flushed = string(reply)
+	})
+	if !stat.OK() || n != 1 || flushed != "4" {
+		t.Fatalf("flushed: %d %q, stat: %v", n, flushed, stat)
+	}
+	if h := atomic.LoadInt32(&handled); h != 2 {
+		t.Fatalf("handled: %d", h)
+	}
+	if n, _ := outbox.Pending(); n != 0 {
+		t.Fatalf("pending: %d", n)
+	}
+
+	// the acknowledged replies are deleted
+	for i := 0; replies.Len() > 0; i++ {
+		if i == 100 {
+			t.Fatalf("replies: %d", replies.Len())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCancelThenRetry(t *testing.T) {
+	var handled int32
+	started := make(chan struct{}, 1)
+	srv := erpc.NewPeer(erpc.PeerConfig{}, NewServer(ServerConfig{}))
+	defer srv.Close()
+	slow := srv.RouteCallFunc(func(ctx erpc.CallCtx, arg *int) (int, *erpc.Status) {
+		if atomic.AddInt32(&handled, 1) == 1 {
+			started <- struct{}{}
+			<-ctx.Context().Done()
+		}
+		return *arg * 2, nil
+	})
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := erpc.ConnectPipe(srv, cli)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	outbox := NewOutbox(OutboxConfig{})
+
+	// the caller cancels the call in handling, and its reply is not written
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	var result int
+	if stat = outbox.Call(&cancelingCaller{Session: sess, ctx: ctx}, slow, 1, &result); stat.Code() != erpc.CodeCallCanceled {
+		t.Fatalf("expect canceled, got %v", stat)
+	}
+
+	// the retry is handled again after the canceled handling ends, instead of the duplicate forever
+	var flushed string
+	for i := 0; flushed == ""; i++ {
+		if i == 100 {
+			t.Fatalf("flushed: %q, stat: %v", flushed, stat)
+		}
+		time.Sleep(10 * time.Millisecond)
+		_, stat = outbox.Flush(sess, func(entry *Entry, reply []byte, stat *erpc.Status) {
+			flushed = string(reply)
+		})
+		if !Retryable(stat) && !stat.OK() {
+			t.Fatal(stat)
+		}
+	}
+	if flushed != "2" || atomic.LoadInt32(&handled) != 2 {
+		t.Fatalf("flushed: %q, handled: %d", flushed, atomic.LoadInt32(&handled))
+	}
+}
+
+func TestKeyScope(t *testing.T) {
+	var handled int32
+	srv := erpc.NewPeer(erpc.PeerConfig{}, NewServer(ServerConfig{}))
+	defer srv.Close()
+	handler := func(ctx erpc.CallCtx, arg *int) (int, *erpc.Status) {
+		atomic.AddInt32(&handled, 1)
+		return *arg, nil
+	}
+	uris := []string{srv.RouteCallFunc(handler), srv.SubRoute("/other").RouteCallFunc(handler)}
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	call := func(sess erpc.Session, uri string) {
+		var result int
+		if stat := sess.Call(uri, 1, &result, dedup.WithIdempotencyKey("k1")).Status(); !stat.OK() {
+			t.Fatal(stat)
+		}
+	}
+	sess1, stat := erpc.ConnectPipe(srv, cli)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	sess2, stat := erpc.ConnectPipe(srv, cli)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	// the same key of the other service method or the other session is handled, and the retry is not
+	call(sess1, uris[0])
+	call(sess1, uris[0])
+	call(sess1, uris[1])
+	call(sess2, uris[0])
+	if h := atomic.LoadInt32(&handled); h != 3 {
+		t.Fatalf("handled: %d", h)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exactlyonce
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Reply the stored reply of the CALL of an idempotency key, whose Key is the scoped one, see ServerConfig.SharedKeys.
+type Reply struct {
+	Key       string    `json:"key"`
+	Code      int32     `json:"code"`
+	Msg       string    `json:"msg,omitempty"`
+	Cause     string    `json:"cause,omitempty"`
+	Body      []byte    `json:"body,omitempty"`
+	BodyCodec byte      `json:"body_codec,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// Entry the pending call in the outbox.
+type Entry struct {
+	Key           string          `json:"key"`
+	ServiceMethod string          `json:"service_method"`
+	Arg           json.RawMessage `json:"arg"`
+	At            time.Time       `json:"at"`
+}
+
+// ReplyStore the store of the replies of the server, e.g. NewMemoryReplyStore, or a persistent one.
+// NOTE:
+//  It must be safe for concurrent use;
+//  The saved and loaded replies must not be retained or modified by the store, i.e. copy them.
+type ReplyStore interface {
+	// Save creates or replaces the reply.
+	Save(reply *Reply) error
+	// Load returns the reply of the key, ok is false if it is absent.
+	Load(key string) (reply *Reply, ok bool, err error)
+	// Delete deletes the reply of the key.
+	Delete(key string) error
+}
+
+// OutboxStore the store of the pending calls of the client, e.g. NewMemoryOutboxStore, or a persistent one.
+// NOTE:
+//  It must be safe for concurrent use;
+//  The put and listed entries must not be retained or modified by the store, i.e. copy them.
+type OutboxStore interface {
+	// Put creates or replaces the entry.
+	Put(entry *Entry) error
+	// List returns all entries in the order of Entry.At.
+	List() ([]*Entry, error)
+	// Delete deletes the entry of the key.
+	Delete(key string) error
+}
+
+// MemoryReplyStore the in-memory store of the replies.
+type MemoryReplyStore struct {
+	mu      sync.RWMutex
+	replies map[string]Reply
+}
+
+var _ ReplyStore = (*MemoryReplyStore)(nil)
+
+// NewMemoryReplyStore creates an in-memory reply store.
+func NewMemoryReplyStore() *MemoryReplyStore {
+	return &MemoryReplyStore{replies: make(map[string]Reply)}
+}
+
+// Save creates or replaces the reply.
+func (s *MemoryReplyStore) Save(reply *Reply) error {
+	s.mu.Lock()
+	s.replies[reply.Key] = *reply
+	s.mu.Unlock()
+	return nil
+}
+
+// Load returns the reply of the key, ok is false if it is absent.
+func (s *MemoryReplyStore) Load(key string) (*Reply, bool, error) {
+	s.mu.RLock()
+	reply, ok := s.replies[key]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, false, nil
+	}
+	return &reply, true, nil
+}
+
+// Delete deletes the reply of the key.
+func (s *MemoryReplyStore) Delete(key string) error {
+	s.mu.Lock()
+	delete(s.replies, key)
+	s.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of the replies.
+func (s *MemoryReplyStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.replies)
+}
+
+// MemoryOutboxStore the in-memory store of the pending calls.
+type MemoryOutboxStore struct {
+	mu      sync.RWMutex
+	entries map[string]Entry
+}
+
+var _ OutboxStore = (*MemoryOutboxStore)(nil)
+
+// NewMemoryOutboxStore creates an in-memory outbox store.
+func NewMemoryOutboxStore() *MemoryOutboxStore {
+	return &MemoryOutboxStore{entries: make(map[string]Entry)}
+}
+
+// Put creates or replaces the entry.
+func (s *MemoryOutboxStore) Put(entry *Entry) error {
+	s.mu.Lock()
+	s.entries[entry.Key] = *entry
+	s.mu.Unlock()
+	return nil
+}
+
+// List returns all entries in the order of Entry.At.
+func (s *MemoryOutboxStore) List() ([]*Entry, error) {
+	s.mu.RLock()
+	entries := make([]*Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entry := entry
+		entries = append(entries, &entry)
+	}
+	s.mu.RUnlock()
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].At.Before(entries[j].At)
+	})
+	return entries, nil
+}
+
+// Delete deletes the entry of the key.
+func (s *MemoryOutboxStore) Delete(key string) error {
+	s.mu.Lock()
+	delete(s.entries, key)
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,175 @@
+// Package health is a health checking subsystem with the standardized route "/erpc/health".
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package health
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/andeya/erpc/v7"
+)
+
+// ServiceMethod the health checking service method
+const ServiceMethod = "/erpc/health"
+
+// Report the health report.
+type Report struct {
+	// Live whether the peer is alive, it is true if the peer can reply
+	Live bool `json:"live"`
+	// Ready whether the peer is ready to serve, it is true if all checks pass and not set to unready
+	Ready bool `json:"ready"`
+	// Checks the results of the checks, "ok" or the error text
+	Checks map[string]string `json:"checks,omitempty"`
+	// States the states of the subsystems not affecting the readiness, e.g. the shedding state under overload
+	States map[string]string `json:"states,omitempty"`
+}
+
+var (
+	checksMu sync.RWMutex
+	checks   = make(map[string]func() error)
+	states   = make(map[string]func() string)
+	unready  int32
+)
+
+// Register registers the readiness check of the subsystem.
+// NOTE: The check is called for each health checking, so it should return quickly.
+func Register(name string, check func() error) {
+	checksMu.Lock()
+	checks[name] = check
+	checksMu.Unlock()
+}
+
+// Unregister unregisters the check of the subsystem.
+func Unregister(name string) {
+	checksMu.Lock()
+	delete(checks, name)
+	checksMu.Unlock()
+}
+
+// RegisterState registers the state of the subsystem reported with the checks, not affecting the readiness.
+// NOTE: The state is called for each health checking, so it should return quickly.
+func RegisterState(name string, state func() string) {
+	checksMu.Lock()
+	states[name] = state
+	checksMu.Unlock()
+}
+
+// UnregisterState unregisters the state of the subsystem.
+func UnregisterState(name string) {
+	checksMu.Lock()
+	delete(states, name)
+	checksMu.Unlock()
+}
+
+// SetReady sets whether the peer is ready, e.g. set false before graceful shutdown.
+func SetReady(ready bool) {
+	if ready {
+		atomic.StoreInt32(&unready, 0)
+	} else {
+		atomic.StoreInt32(&unready, 1)
+	}
+}
+
+// Check runs the checks and returns the report.
+func Check() *Report {
+	checksMu.RLock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	fns := make([]func() error, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		fns[i] = checks[name]
+	}
+	stateFns := make(map[string]func() string, len(states))
+	for name, state := range states {
+		stateFns[name] = state
+	}
+	checksMu.RUnlock()
+	r := &Report{
+		Live:  true,
+		Ready: atomic.LoadInt32(&unready) == 0,
+	}
+	if len(names) > 0 {
+		r.Checks = make(map[string]string, len(names))
+	}
+	for i, name := range names {
+		if err := fns[i](); err != nil {
+			r.Checks[name] = err.Error()
+			r.Ready = false
+		} else {
+			r.Checks[name] = "ok"
+		}
+	}
+	if len(stateFns) > 0 {
+		r.States = make(map[string]string, len(stateFns))
+		for name, state := range stateFns {
+			r.States[name] = state()
+		}
+	}
+	return r
+}
+
+// NewPlugin creates a plugin that registers the health checking route.
+// NOTE: If the peer is not ready, the route replies CodeServiceUnavailable with the report as cause.
+func NewPlugin() erpc.Plugin {
+	return new(healthPlugin)
+}
+
+type healthPlugin struct{}
+
+var _ erpc.PostNewPeerPlugin = (*healthPlugin)(nil)
+
+func (*healthPlugin) Name() string {
+	return "health"
+}
+
+func (*healthPlugin) PostNewPeer(peer erpc.EarlyPeer) error {
+	peer.SubRoute("/erpc").RouteCallFunc((*healthCall).health)
+	return nil
+}
+
+type healthCall struct {
+	erpc.CallCtx
+}
+
+func (*healthCall) health(*struct{}) (*Report, *erpc.Status) {
+	r := Check()
+	if !r.Ready {
+		b, _ := json.Marshal(r)
+		return nil, erpc.NewStatus(erpc.CodeServiceUnavailable, erpc.CodeText(erpc.CodeServiceUnavailable), string(b))
+	}
+	return r, nil
+}
+
+// CheckHealth calls the health checking route of the remote peer,
+// the returned status is not OK if the remote peer is not ready.
+// NOTE: The report is nil if the calling failed.
+func CheckHealth(sess erpc.Session, setting ...erpc.MessageSetting) (*Report, *erpc.Status) {
+	r := new(Report)
+	stat := sess.Call(ServiceMethod, nil, r, setting...).Status()
+	if stat.OK() {
+		return r, stat
+	}
+	if stat.Code() == erpc.CodeServiceUnavailable && stat.Cause() != nil &&
+		json.Unmarshal([]byte(stat.Cause().Error()), r) == nil {
+		return r, stat
+	}
+	return nil, stat
+}
@@ -0,0 +1,44 @@
+package health
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+func TestHealth(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{ListenPort: 9098}, NewPlugin())
+	go srv.ListenAndServe()
+	defer srv.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(":9098")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+
+	var dbErr error
+	Register("db", func() error { return dbErr })
+	defer Unregister("db")
+	r, stat := CheckHealth(sess)
+	if !stat.OK() || !r.Live || !r.Ready || r.Checks["db"] != "ok" {
+		t.Fatalf("stat: %v, report: %+v", stat, r)
+	}
+
+	dbErr = errors.New("db is down")
+	r, stat = CheckHealth(sess)
+	if stat.Code() != erpc.CodeServiceUnavailable || r == nil || r.Ready || r.Checks["db"] != "db is down" {
+		t.Fatalf("stat: %v, report: %+v", stat, r)
+	}
+
+	dbErr = nil
+	SetReady(false)
+	defer SetReady(true)
+	if _, stat = CheckHealth(sess); stat.OK() {
+		t.Fatal("expect not ready")
+	}
+}
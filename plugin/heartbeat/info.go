@@ -19,7 +19,6 @@ import (
 	"time"
 
 	"github.com/andeya/goutil"
-	"github.com/andeya/goutil/coarsetime"
 )
 
 type swapKey byte
@@ -61,10 +60,10 @@ func (h *heartbeatInfo) getLast() time.Time {
 	return last
 }
 
-func initHeartbeatInfo(m goutil.Map, rate time.Duration) {
+func initHeartbeatInfo(m goutil.Map, rate time.Duration, now time.Time) {
 	m.Store(heartbeatSwapKey, &heartbeatInfo{
 		rate: rate,
-		last: coarsetime.CeilingTimeNow(),
+		last: now,
 	})
 }
 
@@ -78,12 +77,12 @@ func getHeartbeatInfo(m goutil.Map) (*heartbeatInfo, bool) {
 }
 
 // updateHeartbeatInfo updates heartbeat info of session.
-func updateHeartbeatInfo(m goutil.Map, rate time.Duration) (isFirst bool) {
+func updateHeartbeatInfo(m goutil.Map, rate time.Duration, now time.Time) (isFirst bool) {
 	info, ok := getHeartbeatInfo(m)
 	if !ok {
 		isFirst = true
 		if rate > 0 {
-			initHeartbeatInfo(m, rate)
+			initHeartbeatInfo(m, rate, now)
 		}
 		return
 	}
@@ -91,7 +90,7 @@ func updateHeartbeatInfo(m goutil.Map, rate time.Duration) (isFirst bool) {
 	if rate > 0 {
 		info.rate = rate
 	}
-	info.last = coarsetime.CeilingTimeNow()
+	info.last = now
 	info.mu.Unlock()
 	return
 }
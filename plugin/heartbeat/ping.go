@@ -22,7 +22,6 @@ import (
 	"time"
 
 	"github.com/andeya/erpc/v7"
-	"github.com/andeya/goutil/coarsetime"
 )
 
 const (
@@ -137,10 +136,11 @@ func (h *heartPing) Name() string {
 // PostNewPeer runs ping worker.
 func (h *heartPing) PostNewPeer(peer erpc.EarlyPeer) error {
 	rangeSession := peer.RangeSession
+	clock := peer.Clock()
 	go func() {
 		var isCall bool
 		for {
-			time.Sleep(h.getRate())
+			erpc.ClockSleep(clock, h.getRate())
 			isCall = h.isCall()
 			rangeSession(func(sess erpc.Session) bool {
 				if !sess.Health() {
@@ -151,7 +151,7 @@ func (h *heartPing) PostNewPeer(peer erpc.EarlyPeer) error {
 					return true
 				}
 				cp := info.elemCopy()
-				if cp.last.Add(cp.rate).After(coarsetime.CeilingTimeNow()) {
+				if cp.last.Add(cp.rate).After(clock.Now()) {
 					return true
 				}
 				if isCall {
@@ -174,7 +174,7 @@ func (h *heartPing) PostDial(sess erpc.PreSession, _ bool) *erpc.Status {
 // PostAccept initializes heartbeat information.
 func (h *heartPing) PostAccept(sess erpc.PreSession) *erpc.Status {
 	rate := h.getRate()
-	initHeartbeatInfo(sess.Swap(), rate)
+	initHeartbeatInfo(sess.Swap(), rate, sess.Peer().Clock().Now())
 	return nil
 }
 
@@ -228,5 +228,5 @@ func (h *heartPing) update(ctx erpc.PreCtx) {
 	if !sess.Health() {
 		return
 	}
-	updateHeartbeatInfo(sess.Swap(), h.getRate())
+	updateHeartbeatInfo(sess.Swap(), h.getRate(), ctx.Peer().Clock().Now())
 }
@@ -21,7 +21,6 @@ import (
 	"github.com/andeya/erpc/v7"
 	"github.com/andeya/goutil"
 
-	"github.com/andeya/goutil/coarsetime"
 )
 
 // NewPong returns a heartbeat receiver plugin.
@@ -64,18 +63,19 @@ func (h *heartPong) PostNewPeer(peer erpc.EarlyPeer) error {
 	peer.RouteCallFunc((*pongCall).heartbeat)
 	peer.RoutePushFunc((*pongPush).heartbeat)
 	rangeSession := peer.RangeSession
+	clock := peer.Clock()
 	const initial = time.Second*minRateSecond - 1
 	interval := initial
 	go func() {
 		for {
-			time.Sleep(interval)
+			erpc.ClockSleep(clock, interval)
 			rangeSession(func(sess erpc.Session) bool {
 				info, ok := getHeartbeatInfo(sess.Swap())
 				if !ok {
 					return true
 				}
 				cp := info.elemCopy()
-				if sess.Health() && cp.last.Add(cp.rate*2).Before(coarsetime.CeilingTimeNow()) {
+				if sess.Health() && cp.last.Add(cp.rate*2).Before(clock.Now()) {
 					sess.Close()
 				}
 				if cp.rate < interval || interval == initial {
@@ -107,7 +107,7 @@ func (h *heartPong) PostWritePush(ctx erpc.WriteCtx) *erpc.Status {
 	if !sess.Health() {
 		return nil
 	}
-	updateHeartbeatInfo(sess.Swap(), 0)
+	updateHeartbeatInfo(sess.Swap(), 0, ctx.Peer().Clock().Now())
 	return nil
 }
 
@@ -119,7 +119,7 @@ func (h *heartPong) update(ctx erpc.ReadCtx) {
 	if !sess.Health() {
 		return
 	}
-	updateHeartbeatInfo(sess.Swap(), 0)
+	updateHeartbeatInfo(sess.Swap(), 0, ctx.Peer().Clock().Now())
 }
 
 type pongCall struct {
@@ -127,7 +127,7 @@ type pongCall struct {
 }
 
 func (ctx *pongCall) heartbeat(_ *struct{}) (*struct{}, *erpc.Status) {
-	return nil, handelHeartbeat(ctx.Session(), ctx.PeekMeta)
+	return nil, handelHeartbeat(ctx.Session(), ctx.PeekMeta, ctx.Peer().Clock().Now())
 }
 
 type pongPush struct {
@@ -135,13 +135,13 @@ type pongPush struct {
 }
 
 func (ctx *pongPush) heartbeat(_ *struct{}) *erpc.Status {
-	return handelHeartbeat(ctx.Session(), ctx.PeekMeta)
+	return handelHeartbeat(ctx.Session(), ctx.PeekMeta, ctx.Peer().Clock().Now())
 }
 
-func handelHeartbeat(sess erpc.CtxSession, peekMeta func(string) []byte) *erpc.Status {
+func handelHeartbeat(sess erpc.CtxSession, peekMeta func(string) []byte, now time.Time) *erpc.Status {
 	rateStr := goutil.BytesToString(peekMeta(heartbeatMetaKey))
 	rateSecond := parseHeartbeatRateSecond(rateStr)
-	isFirst := updateHeartbeatInfo(sess.Swap(), time.Second*time.Duration(rateSecond))
+	isFirst := updateHeartbeatInfo(sess.Swap(), time.Second*time.Duration(rateSecond), now)
 	if isFirst && rateSecond == -1 {
 		return erpc.NewStatus(erpc.CodeBadMessage, "invalid heartbeat rate", rateStr)
 	}
@@ -0,0 +1,230 @@
+// Package ipfilter is a plugin that admits or rejects the connections by the CIDR lists of the remote IP.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ipfilter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+// Config the CIDR lists of the filter, the single IP such as "10.0.0.1" is also accepted.
+// NOTE:
+//  The deny list takes precedence over the allow list;
+//  If the allow list is empty, all IPs not denied are admitted.
+type Config struct {
+	Allow []string `json:"allow" yaml:"allow"`
+	Deny  []string `json:"deny" yaml:"deny"`
+}
+
+type rules struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// Filter the IP filter plugin, evaluated in PostAccept before any message is read.
+type Filter struct {
+	mu    sync.RWMutex
+	rules rules
+}
+
+var _ erpc.PostAcceptPlugin = (*Filter)(nil)
+
+// New creates an IP filter plugin.
+func New(cfg Config) (*Filter, error) {
+	f := new(Filter)
+	if err := f.Reload(cfg); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// NewFromFile creates an IP filter plugin from the rules file, see LoadFile.
+func NewFromFile(filename string) (*Filter, error) {
+	f := new(Filter)
+	if err := f.LoadFile(filename); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Name returns the plugin name.
+func (f *Filter) Name() string {
+	return "ipfilter"
+}
+
+// PostAccept rejects the connection if the remote IP is not admitted.
+func (f *Filter) PostAccept(sess erpc.PreSession) *erpc.Status {
+	ip := remoteIP(sess.RemoteAddr())
+	if f.Allowed(ip) {
+		return nil
+	}
+	erpc.Warnf("ipfilter: reject connection from %s", sess.RemoteAddr().String())
+	return erpc.NewStatus(erpc.CodeUnauthorized, erpc.CodeText(erpc.CodeUnauthorized), "ip is not allowed: "+ip.String())
+}
+
+// Allowed reports whether the IP is admitted.
+func (f *Filter) Allowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	f.mu.RLock()
+	r := f.rules
+	f.mu.RUnlock()
+	if contains(r.deny, ip) {
+		return false
+	}
+	return len(r.allow) == 0 || contains(r.allow, ip)
+}
+
+// Reload replaces the lists at runtime.
+// NOTE: The accepted connections are not affected.
+func (f *Filter) Reload(cfg Config) error {
+	var r rules
+	var err error
+	if r.allow, err = parseCIDRs(cfg.Allow); err != nil {
+		return err
+	}
+	if r.deny, err = parseCIDRs(cfg.Deny); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.rules = r
+	f.mu.Unlock()
+	return nil
+}
+
+// LoadFile reloads the lists from the rules file, one rule per line:
+//  allow 10.0.0.0/8
+//  deny 10.1.2.3
+//  # comment
+func (f *Filter) LoadFile(filename string) error {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	cfg, err := parseRules(b)
+	if err != nil {
+		return fmt.Errorf("ipfilter: %s: %v", filename, err)
+	}
+	return f.Reload(cfg)
+}
+
+// WatchFile reloads the rules file when it is modified, checking every interval,
+// and returns the function to stop watching.
+// NOTE:
+//  If interval<=0, it is 5s;
+//  The invalid file is logged and ignored, the previous lists are kept.
+func (f *Filter) WatchFile(filename string, interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	var modTime time.Time
+	if fi, err := os.Stat(filename); err == nil {
+		modTime = fi.ModTime()
+	}
+	done := make(chan struct{})
+	var once sync.Once
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			fi, err := os.Stat(filename)
+			if err != nil || fi.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = fi.ModTime()
+			if err = f.LoadFile(filename); err != nil {
+				erpc.Errorf("%v", err)
+			} else {
+				erpc.Infof("ipfilter: reloaded %s", filename)
+			}
+		}
+	}()
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+func parseRules(b []byte) (Config, error) {
+	var cfg Config
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return cfg, fmt.Errorf("line %d: invalid rule %q", n, line)
+		}
+		switch strings.ToLower(fields[0]) {
+		case "allow":
+			cfg.Allow = append(cfg.Allow, fields[1])
+		case "deny":
+			cfg.Deny = append(cfg.Deny, fields[1])
+		default:
+			return cfg, fmt.Errorf("line %d: invalid action %q", n, fields[0])
+		}
+	}
+	return cfg, s.Err()
+}
+
+func parseCIDRs(list []string) ([]*net.IPNet, error) {
+	nets, err := erpc.ParseCIDRs(list)
+	if err != nil {
+		return nil, fmt.Errorf("ipfilter: %v", err)
+	}
+	return nets, nil
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,82 @@
+package ipfilter
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+func TestAllowed(t *testing.T) {
+	f, err := New(Config{
+		Allow: []string{"10.0.0.0/8", "192.168.1.1", "::1"},
+		Deny:  []string{"10.1.0.0/16"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"10.0.0.1":    true,
+		"10.1.2.3":    false,
+		"192.168.1.1": true,
+		"192.168.1.2": false,
+		"::1":         true,
+	}
+	for ip, allowed := range cases {
+		if got := f.Allowed(net.ParseIP(ip)); got != allowed {
+			t.Errorf("Allowed(%s) = %v", ip, got)
+		}
+	}
+	if _, err = New(Config{Deny: []string{"10.0.0.0/33"}}); err == nil {
+		t.Fatal("invalid CIDR: expect error!")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ipfilter.rules")
+	if err := os.WriteFile(filename, []byte("# local only\nallow 127.0.0.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := f.WatchFile(filename, 50*time.Millisecond)
+	defer stop()
+
+	srv := erpc.NewPeer(erpc.PeerConfig{ListenPort: 9107}, f)
+	go srv.ListenAndServe()
+	defer srv.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial("127.0.0.1:9107")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if !sess.Health() {
+		t.Fatal("the allowed connection is rejected")
+	}
+
+	// reload from the modified file
+	time.Sleep(10 * time.Millisecond)
+	if err = os.WriteFile(filename, []byte("deny 127.0.0.0/8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(filename, time.Now(), time.Now().Add(time.Second))
+	time.Sleep(200 * time.Millisecond)
+	sess, stat = cli.Dial("127.0.0.1:9107")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	select {
+	case <-sess.CloseNotify():
+	case <-time.After(3 * time.Second):
+		t.Fatal("the denied connection is not rejected")
+	}
+}
@@ -0,0 +1,397 @@
+// Package jobs is a long-running job subsystem, whose handlers return the job ids immediately,
+// with the standardized routes "/erpc/jobs/status", "/erpc/jobs/result" and "/erpc/jobs/cancel".
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+// The job service methods
+const (
+	StatusServiceMethod = "/erpc/jobs/status"
+	ResultServiceMethod = "/erpc/jobs/result"
+	CancelServiceMethod = "/erpc/jobs/cancel"
+)
+
+// DefaultRetention the default duration of keeping the finished jobs in the store
+const DefaultRetention = 10 * time.Minute
+
+// The job states
+const (
+	StateRunning  = "running"
+	StateDone     = "done"
+	StateFailed   = "failed"
+	StateCanceled = "canceled"
+)
+
+// CodeNotFinished the status code of retrieving the result of the running job
+const CodeNotFinished int32 = 409
+
+var (
+	// StatNotFinished the status of retrieving the result of the running job
+	StatNotFinished = erpc.NewStatus(CodeNotFinished, "Job Not Finished", "")
+	// StatNotFound the status of the unknown or expired job
+	StatNotFound = erpc.NewStatus(erpc.CodeNotFound, "Job Not Found", "")
+	// StatCanceled the status of the canceled job
+	StatCanceled = erpc.NewStatus(erpc.CodeCallCanceled, "Job Canceled", "")
+)
+
+// Job the state of the job.
+type Job struct {
+	// ID the job id returned by Manager.Start
+	ID string `json:"id"`
+	// State the job state, e.g. StateRunning
+	State string `json:"state"`
+	// Percent the progress percent reported by the job
+	Percent int `json:"percent"`
+	// Note the progress note reported by the job
+	Note string `json:"note,omitempty"`
+	// Result the JSON encoding of the result of the done job, only replied by the result route
+	Result json.RawMessage `json:"result,omitempty"`
+	// Code the status code of the failed job
+	Code int32 `json:"code,omitempty"`
+	// Msg the status msg of the failed job
+	Msg string `json:"msg,omitempty"`
+	// Cause the status cause of the failed job
+	Cause string `json:"cause,omitempty"`
+	// CreatedAt the time of starting the job
+	CreatedAt time.Time `json:"created_at"`
+	// UpdatedAt the time of the last change of the job
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Finished returns whether the job is done, failed or canceled.
+func (j *Job) Finished() bool {
+	return j.State != StateRunning
+}
+
+// Status returns the status of the job, nil if it is running or done.
+func (j *Job) Status() *erpc.Status {
+	switch j.State {
+	case StateFailed:
+		return erpc.NewStatus(j.Code, j.Msg, j.Cause)
+	case StateCanceled:
+		return StatCanceled.Copy(j.Cause)
+	}
+	return nil
+}
+
+// Func the long-running work of the job, whose result is encoded by JSON.
+// NOTE:
+//  It should stop soon after the ctx is done by the cancellation;
+//  The progress is reported by the report function, got by the status route.
+type Func func(ctx context.Context, report func(percent int, note string)) (result interface{}, stat *erpc.Status)
+
+// Config the job manager config
+type Config struct {
+	// Store the store of the job states, default NewMemoryStore()
+	Store Store
+	// Retention the duration of keeping the finished jobs in the store, default DefaultRetention
+	Retention time.Duration
+}
+
+// Manager the job manager plugin, which runs the jobs in the gopool and registers the job routes.
+// NOTE:
+//  The job states are shared by the peers of a shared store, e.g. the status polling can reach any of them,
+//  but the running job is only interrupted by the cancellation reaching the peer running it;
+//  The state changes of a peer are serialized, and only the running job in the store is changed,
+//  i.e. its first end state wins, e.g. the cancellation or the finishing;
+//  The times of the jobs are of the peer clock, see erpc.PeerConfig.Clock.
+type Manager struct {
+	store     Store
+	retention time.Duration
+	clock     erpc.Clock
+	mu        sync.Mutex // serializes the state changes of the jobs
+	cancels   map[string]context.CancelFunc
+}
+
+var _ erpc.PostNewPeerPlugin = (*Manager)(nil)
+
+// New creates a job manager plugin.
+func New(cfg Config) *Manager {
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStore()
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = DefaultRetention
+	}
+	return &Manager{
+		store:     cfg.Store,
+		retention: cfg.Retention,
+		clock:     erpc.SystemClock,
+		cancels:   make(map[string]context.CancelFunc),
+	}
+}
+
+// Name returns the plugin name.
+func (m *Manager) Name() string {
+	return "jobs"
+}
+
+// managers the job managers of the peers, to be found by the route handlers
+var managers sync.Map // erpc.Peer -> *Manager
+
+// PostNewPeer registers the job routes, and uses the clock of the peer.
+func (m *Manager) PostNewPeer(peer erpc.EarlyPeer) error {
+	m.clock = peer.Clock()
+	managers.Store(peer, m)
+	group := peer.SubRoute("/erpc/jobs")
+	group.RouteCallFunc((*jobsCall).status)
+	group.RouteCallFunc((*jobsCall).result)
+	group.RouteCallFunc((*jobsCall).cancel)
+	return nil
+}
+
+// Start runs the job in the gopool, and returns its id immediately, e.g. as the reply of the handler.
+func (m *Manager) Start(fn Func) (id string, stat *erpc.Status) {
+	id = newID()
+	now := m.clock.Now()
+	job := &Job{ID: id, State: StateRunning, CreatedAt: now, UpdatedAt: now}
+	if err := m.store.Save(job); err != nil {
+		return "", erpc.NewStatus(erpc.CodeInternalServerError, "Job Store Failed", err.Error())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.mu.Lock()
+	m.cancels[id] = cancel
+	m.mu.Unlock()
+	if !erpc.Go(func() { m.run(ctx, job, fn) }) {
+		m.finish(ctx, job, nil, erpc.NewStatus(erpc.CodeServiceUnavailable, "Job Pool Full", ""))
+	}
+	return id, nil
+}
+
+func (m *Manager) run(ctx context.Context, job *Job, fn Func) {
+	var (
+		result interface{}
+		stat   *erpc.Status
+	)
+	defer func() {
+		if p := recover(); p != nil {
+			erpc.Errorf("job %s panic: %v", job.ID, p)
+			stat = erpc.NewStatus(erpc.CodeInternalServerError, "Job Panic", p)
+		}
+		m.finish(ctx, job, result, stat)
+	}()
+	result, stat = fn(ctx, func(percent int, note string) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if ctx.Err() != nil || !m.running(job.ID) {
+			return
+		}
+		job.Percent, job.Note, job.UpdatedAt = percent, note, m.clock.Now()
+		if err := m.store.Save(job); err != nil {
+			erpc.Warnf("job %s: %v", job.ID, err)
+		}
+	})
+}
+
+// running reports whether the stored job is running, it is the compare of the state changes under m.mu.
+// NOTE:
+//  The job failed to load is regarded as running, so that its end state is still recorded;
+//  The absent one is not, e.g. canceled and expired, so that it is not recorded again.
+func (m *Manager) running(id string) bool {
+	stored, ok, err := m.store.Load(id)
+	if err != nil {
+		erpc.Warnf("job %s: %v", id, err)
+		return true
+	}
+	return ok && stored.State == StateRunning
+}
+
+// finish records the end state of the job, unless it has been finished, e.g. canceled.
+func (m *Manager) finish(ctx context.Context, job *Job, result interface{}, stat *erpc.Status) {
+	var b []byte
+	if stat.OK() {
+		var err error
+		if b, err = json.Marshal(result); err != nil {
+			stat = erpc.NewStatus(erpc.CodeInternalServerError, "Job Result Encoding Failed", err.Error())
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	canceled := ctx.Err() != nil
+	if cancel, ok := m.cancels[job.ID]; ok {
+		delete(m.cancels, job.ID)
+		cancel()
+	}
+	if !m.running(job.ID) {
+		return
+	}
+	switch {
+	case canceled:
+		job.State = StateCanceled
+	case !stat.OK():
+		job.State, job.Code, job.Msg = StateFailed, stat.Code(), stat.Msg()
+		if cause := stat.Cause(); cause != nil {
+			job.Cause = cause.Error()
+		}
+	default:
+		job.State, job.Percent, job.Result = StateDone, 100, b
+	}
+	job.UpdatedAt = m.clock.Now()
+	if err := m.store.Save(job); err != nil {
+		erpc.Warnf("job %s: %v", job.ID, err)
+	}
+	m.expire(job.ID)
+}
+
+// expire deletes the finished job from the store after the retention.
+func (m *Manager) expire(id string) {
+	m.clock.AfterFunc(m.retention, func() {
+		if err := m.store.Delete(id); err != nil {
+			erpc.Warnf("job %s: %v", id, err)
+		}
+	})
+}
+
+func (m *Manager) load(id string) (*Job, *erpc.Status) {
+	job, ok, err := m.store.Load(id)
+	if err != nil {
+		return nil, erpc.NewStatus(erpc.CodeInternalServerError, "Job Store Failed", err.Error())
+	}
+	if !ok {
+		return nil, StatNotFound
+	}
+	return job, nil
+}
+
+type jobsCall struct {
+	erpc.CallCtx
+}
+
+func (j *jobsCall) manager() (*Manager, *erpc.Status) {
+	m, ok := managers.Load(j.Peer())
+	if !ok {
+		return nil, erpc.NewStatus(erpc.CodeServiceUnavailable, erpc.CodeText(erpc.CodeServiceUnavailable), "no job manager")
+	}
+	return m.(*Manager), nil
+}
+
+func (j *jobsCall) load(id string) (*Job, *erpc.Status) {
+	m, stat := j.manager()
+	if stat != nil {
+		return nil, stat
+	}
+	return m.load(id)
+}
+
+// status replies the job state without the result.
+func (j *jobsCall) status(id *string) (*Job, *erpc.Status) {
+	job, stat := j.load(*id)
+	if stat != nil {
+		return nil, stat
+	}
+	job.Result = nil
+	return job, nil
+}
+
+// result replies the job state with the result, or the status of the running, failed or canceled job.
+func (j *jobsCall) result(id *string) (*Job, *erpc.Status) {
+	job, stat := j.load(*id)
+	if stat != nil {
+		return nil, stat
+	}
+	if !job.Finished() {
+		return nil, StatNotFinished
+	}
+	if stat = job.Status(); stat != nil {
+		return nil, stat
+	}
+	return job, nil
+}
+
+// cancel cancels the running job, and replies the job state after the cancellation.
+func (j *jobsCall) cancel(id *string) (*Job, *erpc.Status) {
+	m, stat := j.manager()
+	if stat != nil {
+		return nil, stat
+	}
+	return m.cancel(*id)
+}
+
+// cancel cancels the running job, and returns the job state after the cancellation.
+// NOTE: The finished job is returned as it is, i.e. the cancellation loses the race with the finishing.
+func (m *Manager) cancel(id string) (*Job, *erpc.Status) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, stat := m.load(id)
+	if stat != nil {
+		return nil, stat
+	}
+	job.Result = nil
+	if job.Finished() {
+		return job, nil
+	}
+	// NOTE: cancel the running job first, so that it records no more state
+	if cancel, ok := m.cancels[id]; ok {
+		delete(m.cancels, id)
+		cancel()
+	}
+	job.State, job.UpdatedAt = StateCanceled, m.clock.Now()
+	if err := m.store.Save(job); err != nil {
+		return nil, erpc.NewStatus(erpc.CodeInternalServerError, "Job Store Failed", err.Error())
+	}
+	m.expire(id)
+	return job, nil
+}
+
+func newID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// GetStatus calls the status route of the remote peer, without the result.
+func GetStatus(sess erpc.Session, id string, setting ...erpc.MessageSetting) (*Job, *erpc.Status) {
+	job := new(Job)
+	if stat := sess.Call(StatusServiceMethod, id, job, setting...).Status(); !stat.OK() {
+		return nil, stat
+	}
+	return job, nil
+}
+
+// GetResult calls the result route of the remote peer, and decodes the result of the done job to result.
+// NOTE: It returns StatNotFinished if the job is running, or the status of the failed or canceled job.
+func GetResult(sess erpc.Session, id string, result interface{}, setting ...erpc.MessageSetting) (*Job, *erpc.Status) {
+	job := new(Job)
+	if stat := sess.Call(ResultServiceMethod, id, job, setting...).Status(); !stat.OK() {
+		return nil, stat
+	}
+	if result != nil {
+		if err := json.Unmarshal(job.Result, result); err != nil {
+			return job, erpc.NewStatus(erpc.CodeBadMessage, "Job Result Decoding Failed", err.Error())
+		}
+	}
+	return job, nil
+}
+
+// Cancel calls the cancel route of the remote peer, and returns the job state after the cancellation.
+// NOTE: Canceling the finished job does nothing.
+func Cancel(sess erpc.Session, id string, setting ...erpc.MessageSetting) (*Job, *erpc.Status) {
+	job := new(Job)
+	if stat := sess.Call(CancelServiceMethod, id, job, setting...).Status(); !stat.OK() {
+		return nil, stat
+	}
+	return job, nil
+}
@@ -0,0 +1,148 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/erpctest"
+)
+
+type report struct {
+	Rows int `json:"rows"`
+}
+
+func TestJobs(t *testing.T) {
+	m := New(Config{Retention: time.Minute})
+	srv := erpc.NewPeer(erpc.PeerConfig{}, m)
+	defer srv.Close()
+	step := make(chan struct{})
+	srv.RouteCallFunc(func(ctx erpc.CallCtx, rows *int) (string, *erpc.Status) {
+		return m.Start(func(ctx context.Context, progress func(int, string)) (interface{}, *erpc.Status) {
+			progress(50, "half")
+			select {
+			case <-step:
+				return &report{Rows: *rows}, nil
+			case <-ctx.Done():
+				return nil, erpc.NewStatus(erpc.CodeCallCanceled, "", ctx.Err())
+			}
+		})
+	})
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := erpc.ConnectPipe(srv, cli)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	start := func() string {
+		var id string
+		if stat := sess.Call("/func1", 42, &id).Status(); !stat.OK() || id == "" {
+			t.Fatalf("id: %q, stat: %v", id, stat)
+		}
+		return id
+	}
+	waitProgress := func(id string) {
+		for i := 0; i < 100; i++ {
+			job, stat := GetStatus(sess, id)
+			if !stat.OK() {
+				t.Fatal(stat)
+			}
+			if job.Percent == 50 {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("no progress")
+	}
+
+	// done
+	id := start()
+	waitProgress(id)
+	var r report
+	if _, stat = GetResult(sess, id, &r); stat.Code() != CodeNotFinished {
+		t.Fatalf("expect not finished, got %v", stat)
+	}
+	step <- struct{}{}
+	for i := 0; i < 100; i++ {
+		if _, stat = GetResult(sess, id, &r); stat.Code() != CodeNotFinished {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !stat.OK() || r.Rows != 42 {
+		t.Fatalf("result: %+v, stat: %v", r, stat)
+	}
+	if job, stat := GetStatus(sess, id); !stat.OK() || job.State != StateDone || job.Percent != 100 || job.Result != nil {
+		t.Fatalf("job: %+v, stat: %v", job, stat)
+	}
+
+	// canceled
+	id = start()
+	waitProgress(id)
+	if job, stat := Cancel(sess, id); !stat.OK() || job.State != StateCanceled {
+		t.Fatalf("job: %+v, stat: %v", job, stat)
+	}
+	if _, stat = GetResult(sess, id, &r); stat.Code() != erpc.CodeCallCanceled {
+		t.Fatalf("expect canceled, got %v", stat)
+	}
+
+	if _, stat = GetStatus(sess, "unknown"); stat.Code() != erpc.CodeNotFound {
+		t.Fatalf("expect not found, got %v", stat)
+	}
+}
+
+func TestCancelFinishRace(t *testing.T) {
+	clock := erpctest.NewClock(time.Now())
+	m := New(Config{Retention: time.Minute})
+	srv := erpc.NewPeer(erpc.PeerConfig{Clock: clock}, m)
+	defer srv.Close()
+	// load under the lock, after the state change is recorded and expiring
+	load := func(id string) *Job {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		job, stat := m.load(id)
+		if !stat.OK() {
+			t.Fatal(stat)
+		}
+		return job
+	}
+	for i := 0; i < 200; i++ {
+		release := make(chan struct{})
+		id, stat := m.Start(func(ctx context.Context, progress func(int, string)) (interface{}, *erpc.Status) {
+			<-release
+			return "ok", nil
+		})
+		if !stat.OK() {
+			t.Fatal(stat)
+		}
+		go close(release)
+		canceled, stat := m.cancel(id)
+		if !stat.OK() {
+			t.Fatal(stat)
+		}
+		// the first end state wins, and is not overwritten by the other one
+		job := load(id)
+		for j := 0; !job.Finished(); j++ {
+			if j == 100 {
+				t.Fatal("the job is not finished")
+			}
+			time.Sleep(time.Millisecond)
+			job = load(id)
+		}
+		if canceled.Finished() && job.State != canceled.State {
+			t.Fatalf("canceled: %s, stored: %s", canceled.State, job.State)
+		}
+		if !job.CreatedAt.Equal(clock.Now()) || !job.UpdatedAt.Equal(clock.Now()) {
+			t.Fatalf("created at: %v, updated at: %v, now: %v", job.CreatedAt, job.UpdatedAt, clock.Now())
+		}
+	}
+	// the finished jobs expire by the clock of the peer
+	clock.Advance(time.Minute)
+	for i := 0; m.store.(*MemoryStore).Len() > 0; i++ {
+		if i == 100 {
+			t.Fatalf("jobs: %d", m.store.(*MemoryStore).Len())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
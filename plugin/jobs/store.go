@@ -0,0 +1,77 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import "sync"
+
+// Store the store of the job states, e.g. NewMemoryStore, or a shared one of the peers.
+// NOTE:
+//  It must be safe for concurrent use;
+//  The saved and loaded jobs must not be retained or modified by the store, i.e. copy them.
+type Store interface {
+	// Save creates or replaces the job.
+	Save(job *Job) error
+	// Load returns the job of the id, ok is false if it is absent.
+	Load(id string) (job *Job, ok bool, err error)
+	// Delete deletes the job of the id.
+	Delete(id string) error
+}
+
+// MemoryStore the in-memory store of the job states of the peer.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	jobs map[string]Job
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]Job)}
+}
+
+// Save creates or replaces the job.
+func (s *MemoryStore) Save(job *Job) error {
+	s.mu.Lock()
+	s.jobs[job.ID] = *job
+	s.mu.Unlock()
+	return nil
+}
+
+// Load returns the job of the id, ok is false if it is absent.
+func (s *MemoryStore) Load(id string) (*Job, bool, error) {
+	s.mu.RLock()
+	job, ok := s.jobs[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, false, nil
+	}
+	return &job, true, nil
+}
+
+// Delete deletes the job of the id.
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	delete(s.jobs, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of the jobs.
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.jobs)
+}
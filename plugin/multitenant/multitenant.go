@@ -0,0 +1,289 @@
+// Package multitenant is a plugin that enforces the per-tenant quotas and routes the tenants to the dedicated worker pools.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package multitenant
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+const (
+	// MetaTenant the metadata key of the tenant id
+	MetaTenant = "X-Tenant"
+	// SwapTenant the swap key of the tenant id of the message, for the handlers and the other plugins
+	SwapTenant = "erpc-tenant"
+	// PoolPrefix the name prefix of the dedicated worker pools, followed by the tenant id
+	PoolPrefix = "tenant:"
+)
+
+// swapKey the swap key of the admitted CALL
+const swapKey = "erpc-multitenant-admitted"
+
+var (
+	// StatTenantRequired the status replied to the CALL without the tenant if Config.Required
+	StatTenantRequired = erpc.NewStatus(erpc.CodeUnauthorized, "Tenant Required", "")
+	// StatQuotaExceeded the status replied to the CALL over the quota of its tenant
+	StatQuotaExceeded = erpc.NewStatus(erpc.CodeServiceUnavailable, "Tenant Quota Exceeded", "")
+)
+
+// Quota the quota of a tenant
+type Quota struct {
+	// Rate the number of the CALL and PUSH per second, unlimited if <=0
+	Rate float64
+	// Burst the bucket size of the rate, default max(1,Rate)
+	Burst int
+	// MaxConcurrency the number of the in-flight CALL handlers, unlimited if <=0
+	MaxConcurrency int
+	// Workers the goroutines of the dedicated worker pool named PoolPrefix+tenant, no dedicated pool if <=0
+	Workers int
+	// MaxQueue the queue length of the dedicated worker pool, unlimited if <=0
+	MaxQueue int
+}
+
+// Config the multi-tenant config
+type Config struct {
+	// Extract extracts the tenant id of the message, optional;
+	// default from the session Swap by SessionSwapKey, then from the MetaTenant metadata
+	Extract func(erpc.ReadCtx) string
+	// SessionSwapKey the key of the tenant id in the session Swap, e.g. stored by the authentication, optional
+	SessionSwapKey string
+	// Required rejects the CALL and drops the PUSH without the tenant
+	Required bool
+	// Default the quota of the tenants not in Quotas
+	Default Quota
+	// Quotas the quotas by the tenant id
+	Quotas map[string]Quota
+}
+
+// Stats the metrics of a tenant
+type Stats struct {
+	Calls    uint64 // the admitted CALLs
+	Pushes   uint64 // the admitted PUSHes
+	Rejected uint64 // the rejected CALLs and the dropped PUSHes
+	Inflight int    // the in-flight CALL handlers
+}
+
+// Plugin the multi-tenant plugin.
+// NOTE:
+//  The quota is checked after reading the body, so the rejected CALL is replied without handling;
+//  The tenant is stored in the Swap of the handler context by SwapTenant, see Tenant;
+//  The state is kept for each tenant id seen, so extract the authenticated one instead of the forgeable metadata
+//  when the callers are untrusted.
+type Plugin struct {
+	extract        func(erpc.ReadCtx) string
+	sessionSwapKey string
+	required       bool
+	defaultQuota   Quota
+	quotas         map[string]Quota
+
+	mu      sync.Mutex
+	tenants map[string]*tenant
+}
+
+type tenant struct {
+	quota  Quota
+	tokens float64
+	last   time.Time
+	stats  Stats
+}
+
+var (
+	_ erpc.SelectHandlerPoolPlugin = (*Plugin)(nil)
+	_ erpc.PostReadCallBodyPlugin  = (*Plugin)(nil)
+	_ erpc.PostReadPushBodyPlugin  = (*Plugin)(nil)
+	_ erpc.PostHandleCallPlugin    = (*Plugin)(nil)
+)
+
+// New creates a multi-tenant plugin.
+func New(cfg Config) *Plugin {
+	quotas := make(map[string]Quota, len(cfg.Quotas))
+	for id, q := range cfg.Quotas {
+		quotas[id] = q
+	}
+	return &Plugin{
+		extract:        cfg.Extract,
+		sessionSwapKey: cfg.SessionSwapKey,
+		required:       cfg.Required,
+		defaultQuota:   cfg.Default,
+		quotas:         quotas,
+		tenants:        make(map[string]*tenant),
+	}
+}
+
+// Name returns the plugin name.
+func (p *Plugin) Name() string {
+	return "multitenant"
+}
+
+// Tenant returns the tenant id of the message, "" if none.
+func Tenant(ctx erpc.PreCtx) string {
+	id, _ := ctx.Swap().Load(SwapTenant)
+	s, _ := id.(string)
+	return s
+}
+
+// tenantOf extracts the tenant id of the message for the first time, and stores it in the Swap.
+func (p *Plugin) tenantOf(ctx erpc.ReadCtx) string {
+	if id, ok := ctx.Swap().Load(SwapTenant); ok {
+		return id.(string)
+	}
+	var id string
+	if p.extract != nil {
+		id = p.extract(ctx)
+	} else {
+		if p.sessionSwapKey != "" {
+			if v, ok := ctx.Session().Swap().Load(p.sessionSwapKey); ok {
+				id, _ = v.(string)
+			}
+		}
+		if id == "" {
+			id = string(ctx.PeekMeta(MetaTenant))
+		}
+	}
+	ctx.Swap().Store(SwapTenant, id)
+	return id
+}
+
+// getLocked returns the state of the tenant, and creates it for the first time.
+func (p *Plugin) getLocked(id string) *tenant {
+	t, ok := p.tenants[id]
+	if !ok {
+		q, ok := p.quotas[id]
+		if !ok {
+			q = p.defaultQuota
+		}
+		if q.Burst <= 0 {
+			q.Burst = int(q.Rate)
+			if q.Burst < 1 {
+				q.Burst = 1
+			}
+		}
+		t = &tenant{quota: q, tokens: float64(q.Burst)}
+		p.tenants[id] = t
+	}
+	return t
+}
+
+// takeLocked takes a token of the rate.
+func (t *tenant) takeLocked(now time.Time) bool {
+	if t.quota.Rate <= 0 {
+		return true
+	}
+	if !t.last.IsZero() {
+		t.tokens += now.Sub(t.last).Seconds() * t.quota.Rate
+		if burst := float64(t.quota.Burst); t.tokens > burst {
+			t.tokens = burst
+		}
+	}
+	t.last = now
+	if t.tokens < 1 {
+		return false
+	}
+	t.tokens--
+	return true
+}
+
+// SelectHandlerPool selects the dedicated worker pool of the tenant if its quota has Workers.
+func (p *Plugin) SelectHandlerPool(ctx erpc.ReadCtx) *erpc.HandlerPoolSpec {
+	id := p.tenantOf(ctx)
+	if id == "" {
+		return nil
+	}
+	q, ok := p.quotas[id]
+	if !ok {
+		q = p.defaultQuota
+	}
+	if q.Workers <= 0 {
+		return nil
+	}
+	return &erpc.HandlerPoolSpec{Name: PoolPrefix + id, MaxGoroutines: q.Workers, MaxQueue: q.MaxQueue}
+}
+
+// PostReadCallBody admits the CALL under the quota of its tenant.
+func (p *Plugin) PostReadCallBody(ctx erpc.ReadCtx) *erpc.Status {
+	id := p.tenantOf(ctx)
+	if id == "" && p.required {
+		return StatTenantRequired
+	}
+	p.mu.Lock()
+	t := p.getLocked(id)
+	if !t.takeLocked(time.Now()) || (t.quota.MaxConcurrency > 0 && t.stats.Inflight >= t.quota.MaxConcurrency) {
+		t.stats.Rejected++
+		p.mu.Unlock()
+		ctx.Warnf("tenant %q: %s %s", id, StatQuotaExceeded.Msg(), ctx.ServiceMethod())
+		return StatQuotaExceeded
+	}
+	t.stats.Calls++
+	t.stats.Inflight++
+	p.mu.Unlock()
+	ctx.Swap().Store(swapKey, true)
+	return nil
+}
+
+// PostHandleCall releases the admitted CALL.
+func (p *Plugin) PostHandleCall(ctx erpc.WriteCtx) *erpc.Status {
+	if _, ok := ctx.Swap().Load(swapKey); !ok {
+		return nil
+	}
+	ctx.Swap().Delete(swapKey)
+	id := Tenant(ctx)
+	p.mu.Lock()
+	p.getLocked(id).stats.Inflight--
+	p.mu.Unlock()
+	return nil
+}
+
+// PostReadPushBody drops the PUSH over the rate of its tenant.
+func (p *Plugin) PostReadPushBody(ctx erpc.ReadCtx) *erpc.Status {
+	id := p.tenantOf(ctx)
+	if id == "" && p.required {
+		return StatTenantRequired
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t := p.getLocked(id)
+	if !t.takeLocked(time.Now()) {
+		t.stats.Rejected++
+		return StatQuotaExceeded
+	}
+	t.stats.Pushes++
+	return nil
+}
+
+// Stats returns the metrics of the tenant.
+func (p *Plugin) Stats(id string) Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.tenants[id]; ok {
+		return t.stats
+	}
+	return Stats{}
+}
+
+// Tenants returns the tenant ids that have sent the messages, in order.
+func (p *Plugin) Tenants() []string {
+	p.mu.Lock()
+	ids := make([]string, 0, len(p.tenants))
+	for id := range p.tenants {
+		ids = append(ids, id)
+	}
+	p.mu.Unlock()
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,90 @@
+package multitenant
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func sleep(ctx erpc.CallCtx, ms *int) (string, *erpc.Status) {
+	time.Sleep(time.Duration(*ms) * time.Millisecond)
+	return Tenant(ctx), nil
+}
+
+func TestMultitenant(t *testing.T) {
+	mt := New(Config{
+		Required: true,
+		Quotas: map[string]Quota{
+			"a": {MaxConcurrency: 1},
+			"b": {Rate: 1},
+			"c": {Workers: 1, MaxQueue: 1},
+		},
+	})
+	srv := erpc.NewPeer(erpc.PeerConfig{}, mt)
+	defer srv.Close()
+	srv.RouteCallFunc(sleep)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	time.Sleep(100 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	call := func(tenant string, ms int) *erpc.Status {
+		var reply string
+		stat := sess.Call("/sleep", ms, &reply, erpc.WithSetMeta(MetaTenant, tenant)).Status()
+		if stat.OK() && reply != tenant {
+			t.Errorf("tenant: %q, expect %q", reply, tenant)
+		}
+		return stat
+	}
+	concurrent := func(tenant string, n int) []*erpc.Status {
+		var wg sync.WaitGroup
+		stats := make([]*erpc.Status, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				stats[i] = call(tenant, 300)
+			}(i)
+			time.Sleep(30 * time.Millisecond)
+		}
+		wg.Wait()
+		return stats
+	}
+
+	// the tenant is required
+	var reply string
+	stat = sess.Call("/sleep", 1, &reply).Status()
+	assert.Equal(t, erpc.CodeUnauthorized, stat.Code())
+
+	// the concurrency quota
+	stats := concurrent("a", 2)
+	assert.True(t, stats[0].OK(), stats[0])
+	assert.Equal(t, StatQuotaExceeded.Msg(), stats[1].Msg())
+	assert.Equal(t, Stats{Calls: 1, Rejected: 1}, mt.Stats("a"))
+
+	// the rate quota
+	assert.True(t, call("b", 1).OK())
+	assert.Equal(t, StatQuotaExceeded.Msg(), call("b", 1).Msg())
+
+	// the dedicated worker pool
+	stats = concurrent("c", 3)
+	assert.True(t, stats[0].OK(), stats[0])
+	assert.True(t, stats[1].OK(), stats[1])
+	assert.Equal(t, erpc.CodeServiceUnavailable, stats[2].Code())
+	assert.True(t, strings.Contains(stats[2].Cause().Error(), PoolPrefix+"c"), stats[2])
+
+	assert.Equal(t, []string{"a", "b", "c"}, mt.Tenants())
+}
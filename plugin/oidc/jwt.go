@@ -0,0 +1,202 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Claims the claims of the validated token.
+type Claims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	Scopes    []string
+	ExpiresAt time.Time
+	// Raw all the claims of the token
+	Raw map[string]interface{}
+}
+
+// HasAudience reports whether the token is for the audience.
+func (c *Claims) HasAudience(aud string) bool {
+	for _, a := range c.Audience {
+		if a == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScopes reports whether the token has all the scopes.
+func (c *Claims) HasScopes(scopes ...string) bool {
+	for _, s := range scopes {
+		found := false
+		for _, cs := range c.Scopes {
+			if cs == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Strings returns the claim as the string list, e.g. the roles, which is a string or an array of strings.
+func (c *Claims) Strings(name string) []string {
+	switch v := c.Raw[name].(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case []interface{}:
+		a := make([]string, 0, len(v))
+		for _, x := range v {
+			if s, ok := x.(string); ok {
+				a = append(a, s)
+			}
+		}
+		return a
+	}
+	return nil
+}
+
+var (
+	errMalformed   = errors.New("malformed token")
+	errSignature   = errors.New("invalid signature")
+	errExpired     = errors.New("token is expired")
+	errNotValidYet = errors.New("token is not valid yet")
+)
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// parseJWT parses the compact JWS, and returns the header, the claims and the signing input.
+func parseJWT(token string) (*jwtHeader, map[string]interface{}, []byte, []byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, nil, nil, errMalformed
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, nil, nil, errMalformed
+	}
+	var header jwtHeader
+	if err = json.Unmarshal(b, &header); err != nil {
+		return nil, nil, nil, nil, errMalformed
+	}
+	if b, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return nil, nil, nil, nil, errMalformed
+	}
+	var raw map[string]interface{}
+	if err = json.Unmarshal(b, &raw); err != nil {
+		return nil, nil, nil, nil, errMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, nil, nil, errMalformed
+	}
+	return &header, raw, []byte(parts[0] + "." + parts[1]), sig, nil
+}
+
+// algHash returns the hash of the asymmetric algorithm, the symmetric and "none" ones are not supported.
+func algHash(alg string) (crypto.Hash, error) {
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		return crypto.SHA256, nil
+	case "RS384", "PS384", "ES384":
+		return crypto.SHA384, nil
+	case "RS512", "PS512", "ES512":
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported algorithm %q", alg)
+}
+
+// verifySignature verifies the signature of the signing input by the public key.
+func verifySignature(alg string, key crypto.PublicKey, input, sig []byte) error {
+	hash, err := algHash(alg)
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write(input)
+	digest := h.Sum(nil)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[0] {
+		case 'R':
+			err = rsa.VerifyPKCS1v15(k, hash, digest, sig)
+		case 'P':
+			err = rsa.VerifyPSS(k, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		default:
+			return fmt.Errorf("algorithm %q mismatches the RSA key", alg)
+		}
+		if err != nil {
+			return errSignature
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if alg[0] != 'E' || len(sig) != 2*size {
+			return errSignature
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errSignature
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported key type %T", key)
+}
+
+// newClaims converts the raw claims, and checks the time of them with the leeway.
+func newClaims(raw map[string]interface{}, now time.Time, leeway time.Duration) (*Claims, error) {
+	c := &Claims{Raw: raw}
+	c.Issuer, _ = raw["iss"].(string)
+	c.Subject, _ = raw["sub"].(string)
+	c.Audience = c.Strings("aud")
+	if scope, ok := raw["scope"].(string); ok {
+		c.Scopes = strings.Fields(scope)
+	} else {
+		c.Scopes = c.Strings("scp")
+	}
+	exp, ok := raw["exp"].(float64)
+	if !ok {
+		return nil, errors.New("missing exp claim")
+	}
+	c.ExpiresAt = time.Unix(int64(exp), 0)
+	if now.After(c.ExpiresAt.Add(leeway)) {
+		return nil, errExpired
+	}
+	if nbf, ok := raw["nbf"].(float64); ok && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errNotValidYet
+	}
+	return c, nil
+}
@@ -0,0 +1,301 @@
+// Package oidc is a plugin that validates the OAuth2 bearer tokens issued by an OpenID Connect issuer.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/plugin/auth"
+	"github.com/andeya/erpc/v7/plugin/rbac"
+	"github.com/andeya/goutil"
+)
+
+const (
+	// MetaAuthorization the metadata key of the bearer token, e.g. "Bearer eyJ..."
+	MetaAuthorization = "X-Authorization"
+	// SwapClaims the session Swap key of the *Claims of the validated token
+	SwapClaims = "erpc-oidc-claims"
+	// DefaultRolesClaim the default claim of the roles of the identity
+	DefaultRolesClaim = "roles"
+	// DefaultCacheTTL the default duration of caching the JWKS
+	DefaultCacheTTL = time.Hour
+	// DefaultMinRefresh the default min interval of refreshing the JWKS on the unknown key id
+	DefaultMinRefresh = time.Minute
+	// DefaultLeeway the default leeway of the time claims
+	DefaultLeeway = time.Minute
+)
+
+var (
+	// StatUnauthenticated the status replied to the CALL with the invalid token, or without the token of the protected routes
+	StatUnauthenticated = erpc.NewStatus(erpc.CodeUnauthorized, "Invalid Token", "")
+	// StatInsufficientScope the status replied to the CALL whose token lacks the audience or the scopes of the route
+	StatInsufficientScope = erpc.NewStatus(rbac.CodeForbidden, "Insufficient Scope", "")
+)
+
+// Config the OIDC validation config
+type Config struct {
+	// Issuer the issuer URL, whose OpenID configuration is discovered by "/.well-known/openid-configuration", required
+	Issuer string
+	// JWKSURL the URL of the JWKS, default discovered by the issuer
+	JWKSURL string
+	// Audience the audience required by all the tokens, optional
+	Audience string
+	// Required requires the valid token for all the routes, otherwise only for the routes of Require
+	Required bool
+	// RolesClaim the claim mapped to the roles of the rbac.Identity, default DefaultRolesClaim
+	RolesClaim string
+	// CacheTTL the duration of caching the JWKS, default DefaultCacheTTL
+	CacheTTL time.Duration
+	// MinRefresh the min interval of refreshing the JWKS on the unknown key id, default DefaultMinRefresh
+	MinRefresh time.Duration
+	// Leeway the leeway of the exp and nbf claims, default DefaultLeeway
+	Leeway time.Duration
+	// Client the HTTP client of fetching the JWKS, default http.DefaultClient
+	Client *http.Client
+}
+
+// Rule the audience and the scopes required by the route group.
+type Rule struct {
+	// Audience the audience of the token, optional
+	Audience string
+	// Scopes the scopes of the token, all of them are required
+	Scopes []string
+}
+
+// Validator the OIDC token validation plugin.
+// NOTE:
+//  The token is carried by the MetaAuthorization metadata of the CALL and the PUSH,
+//  or at the handshake by Checker of the auth plugin;
+//  The valid token is cached by the session until it expires, and its claims are stored in the session Swap,
+//  by SwapClaims for *Claims and by rbac.DefaultSwapKey for *rbac.Identity, which maps the sub and the roles claims.
+type Validator struct {
+	issuer     string
+	audience   string
+	required   bool
+	rolesClaim string
+	leeway     time.Duration
+	keys       *keySet
+
+	mu    sync.RWMutex
+	rules map[string][]Rule
+}
+
+var (
+	_ erpc.PostReadCallHeaderPlugin = (*Validator)(nil)
+	_ erpc.PostReadPushHeaderPlugin = (*Validator)(nil)
+)
+
+// New creates an OIDC token validation plugin.
+func New(cfg Config) *Validator {
+	if cfg.Issuer == "" {
+		erpc.Fatalf("oidc: the issuer is required")
+	}
+	if cfg.RolesClaim == "" {
+		cfg.RolesClaim = DefaultRolesClaim
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = DefaultCacheTTL
+	}
+	if cfg.MinRefresh <= 0 {
+		cfg.MinRefresh = DefaultMinRefresh
+	}
+	if cfg.Leeway <= 0 {
+		cfg.Leeway = DefaultLeeway
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return &Validator{
+		issuer:     cfg.Issuer,
+		audience:   cfg.Audience,
+		required:   cfg.Required,
+		rolesClaim: cfg.RolesClaim,
+		leeway:     cfg.Leeway,
+		keys: &keySet{
+			issuer:     cfg.Issuer,
+			jwksURL:    cfg.JWKSURL,
+			client:     cfg.Client,
+			ttl:        cfg.CacheTTL,
+			minRefresh: cfg.MinRefresh,
+		},
+		rules: make(map[string][]Rule),
+	}
+}
+
+// Name returns the plugin name.
+func (v *Validator) Name() string {
+	return "oidc"
+}
+
+// Require returns a route plugin requiring the valid token with the audience and the scopes of the rule.
+// Example:
+//  peer.SubRoute("/order", v.Require(oidc.Rule{Audience: "orders", Scopes: []string{"order"}}))
+func (v *Validator) Require(rule Rule) erpc.Plugin {
+	return &requirePlugin{v: v, rule: rule}
+}
+
+type requirePlugin struct {
+	v    *Validator
+	rule Rule
+}
+
+var _ erpc.PostRegPlugin = (*requirePlugin)(nil)
+
+func (r *requirePlugin) Name() string {
+	return fmt.Sprintf("oidc-require:%s:%s", r.rule.Audience, strings.Join(r.rule.Scopes, ","))
+}
+
+func (r *requirePlugin) PostReg(h *erpc.Handler) error {
+	r.v.mu.Lock()
+	r.v.rules[h.Name()] = append(r.v.rules[h.Name()], r.rule)
+	r.v.mu.Unlock()
+	return nil
+}
+
+// Validate validates the token, and returns its claims.
+func (v *Validator) Validate(ctx context.Context, token string) (*Claims, error) {
+	header, raw, input, sig, err := parseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = algHash(header.Alg); err != nil {
+		return nil, err
+	}
+	key, err := v.keys.get(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err = verifySignature(header.Alg, key, input, sig); err != nil {
+		return nil, err
+	}
+	claims, err := newClaims(raw, time.Now(), v.leeway)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Issuer != v.issuer {
+		return nil, fmt.Errorf("issuer %q mismatches %q", claims.Issuer, v.issuer)
+	}
+	if v.audience != "" && !claims.HasAudience(v.audience) {
+		return nil, fmt.Errorf("token is not for the audience %q", v.audience)
+	}
+	return claims, nil
+}
+
+// Checker returns the checker of the auth plugin, which receives the token string at the handshake.
+// NOTE: The empty token is anonymous unless Config.Required.
+// Example:
+//  erpc.NewPeer(cfg, auth.NewCheckerPlugin(v.Checker()), v)
+func (v *Validator) Checker() auth.Checker {
+	return func(sess auth.Session, fn auth.RecvOnce) (interface{}, *erpc.Status) {
+		var token string
+		if stat := fn(&token); !stat.OK() {
+			return nil, stat
+		}
+		if len(token) >= 7 && strings.EqualFold(token[:7], "bearer ") {
+			token = token[7:]
+		}
+		if token == "" {
+			// anonymous, the token may be carried later by the metadata
+			if v.required {
+				return nil, StatUnauthenticated.Copy("missing token")
+			}
+			return nil, nil
+		}
+		claims, err := v.Validate(context.Background(), token)
+		if err != nil {
+			return nil, StatUnauthenticated.Copy(err)
+		}
+		v.store(sess.Swap(), token, claims)
+		return nil, nil
+	}
+}
+
+// PostReadCallHeader validates the token of the CALL.
+func (v *Validator) PostReadCallHeader(ctx erpc.ReadCtx) *erpc.Status {
+	return v.check(ctx)
+}
+
+// PostReadPushHeader validates the token of the PUSH.
+func (v *Validator) PostReadPushHeader(ctx erpc.ReadCtx) *erpc.Status {
+	return v.check(ctx)
+}
+
+// tokenSwapKey the session Swap key of the validated token
+const tokenSwapKey = "erpc-oidc-token"
+
+func (v *Validator) check(ctx erpc.ReadCtx) *erpc.Status {
+	v.mu.RLock()
+	rules, declared := v.rules[ctx.ServiceMethod()]
+	v.mu.RUnlock()
+	claims, stat := v.sessionClaims(ctx)
+	if !stat.OK() {
+		return stat
+	}
+	if claims == nil {
+		if declared || v.required {
+			return StatUnauthenticated
+		}
+		return nil
+	}
+	for _, rule := range rules {
+		if (rule.Audience != "" && !claims.HasAudience(rule.Audience)) || !claims.HasScopes(rule.Scopes...) {
+			return StatInsufficientScope
+		}
+	}
+	return nil
+}
+
+// sessionClaims validates the token of the message if it is new to the session,
+// and returns the claims of the session, nil if none or expired.
+func (v *Validator) sessionClaims(ctx erpc.ReadCtx) (*Claims, *erpc.Status) {
+	swap := ctx.Session().Swap()
+	if s := ctx.PeekMeta(MetaAuthorization); len(s) > 0 {
+		token := goutil.BytesToString(s)
+		if len(token) < 7 || !strings.EqualFold(token[:7], "bearer ") {
+			return nil, StatUnauthenticated.Copy("not a bearer token")
+		}
+		token = token[7:]
+		if old, ok := swap.Load(tokenSwapKey); !ok || old.(string) != token {
+			claims, err := v.Validate(ctx.Context(), token)
+			if err != nil {
+				return nil, StatUnauthenticated.Copy(err)
+			}
+			v.store(swap, token, claims)
+			return claims, nil
+		}
+	}
+	c, ok := swap.Load(SwapClaims)
+	if !ok {
+		return nil, nil
+	}
+	claims := c.(*Claims)
+	if time.Now().After(claims.ExpiresAt.Add(v.leeway)) {
+		return nil, StatUnauthenticated.Copy(errExpired)
+	}
+	return claims, nil
+}
+
+func (v *Validator) store(swap goutil.Map, token string, claims *Claims) {
+	swap.Store(tokenSwapKey, token)
+	swap.Store(SwapClaims, claims)
+	swap.Store(rbac.DefaultSwapKey, &rbac.Identity{Subject: claims.Subject, Roles: claims.Strings(v.rolesClaim)})
+}
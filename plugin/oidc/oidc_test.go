@@ -0,0 +1,178 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/plugin/auth"
+	"github.com/andeya/erpc/v7/plugin/rbac"
+	"github.com/stretchr/testify/assert"
+)
+
+// issuer a fake OIDC issuer with the rotatable keys.
+type issuer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    []map[string]string
+	fetches int
+}
+
+func newIssuer() *issuer {
+	iss := new(issuer)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": iss.URL, "jwks_uri": iss.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		iss.mu.Lock()
+		defer iss.mu.Unlock()
+		iss.fetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": iss.keys})
+	})
+	iss.Server = httptest.NewServer(mux)
+	return iss
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (iss *issuer) setKeys(keys map[string]crypto.Signer) {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.keys = nil
+	for kid, k := range keys {
+		switch pub := k.Public().(type) {
+		case *rsa.PublicKey:
+			iss.keys = append(iss.keys, map[string]string{"kty": "RSA", "kid": kid, "n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes())})
+		case *ecdsa.PublicKey:
+			iss.keys = append(iss.keys, map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(pub.X.FillBytes(make([]byte, 32))), "y": b64(pub.Y.FillBytes(make([]byte, 32)))})
+		}
+	}
+}
+
+func sign(kid string, key crypto.Signer, claims map[string]interface{}) string {
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := b64(header) + "." + b64(payload)
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(input))
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest.Sum(nil))
+	case *ecdsa.PrivateKey:
+		r, s, _ := ecdsa.Sign(rand.Reader, k, digest.Sum(nil))
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return input + "." + b64(sig)
+}
+
+func whoami(ctx erpc.CallCtx, _ *int) (string, *erpc.Status) {
+	id, _ := ctx.Session().Swap().Load(rbac.DefaultSwapKey)
+	return id.(*rbac.Identity).Subject, nil
+}
+
+func order_read(ctx erpc.CallCtx, _ *int) (string, *erpc.Status) {
+	return "ok", nil
+}
+
+func TestValidator(t *testing.T) {
+	iss := newIssuer()
+	defer iss.Close()
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	iss.setKeys(map[string]crypto.Signer{"k1": rsaKey})
+
+	v := New(Config{Issuer: iss.URL, Audience: "api", MinRefresh: 10 * time.Millisecond})
+	srv := erpc.NewPeer(erpc.PeerConfig{}, auth.NewCheckerPlugin(v.Checker(), erpc.WithBodyCodec('s')), v)
+	defer srv.Close()
+	srv.RouteCallFunc(whoami, v.Require(Rule{}))
+	srv.RouteCallFunc(order_read, v.Require(Rule{Scopes: []string{"order:read"}}))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	time.Sleep(100 * time.Millisecond)
+
+	claims := func(sub, scope string, exp time.Duration) map[string]interface{} {
+		return map[string]interface{}{"iss": iss.URL, "sub": sub, "aud": []string{"api"}, "scope": scope, "exp": time.Now().Add(exp).Unix(), "roles": "reader"}
+	}
+	dial := func(token string) erpc.Session {
+		cli := erpc.NewPeer(erpc.PeerConfig{}, auth.NewBearerPlugin(func(sess auth.Session, fn auth.SendOnce) *erpc.Status {
+			return fn(token, nil)
+		}, erpc.WithBodyCodec('s')))
+		t.Cleanup(func() { cli.Close() })
+		sess, stat := cli.Dial(lis.Addr().String())
+		if !stat.OK() {
+			t.Fatal(stat)
+		}
+		return sess
+	}
+	call := func(sess erpc.Session, uri, token string) (string, *erpc.Status) {
+		var reply string
+		var settings []erpc.MessageSetting
+		if token != "" {
+			settings = append(settings, erpc.WithSetMeta(MetaAuthorization, "Bearer "+token))
+		}
+		stat := sess.Call(uri, 1, &reply, settings...).Status()
+		return reply, stat
+	}
+
+	// the token at the handshake
+	sess := dial(sign("k1", rsaKey, claims("alice", "order:read", time.Hour)))
+	reply, stat := call(sess, "/whoami", "")
+	assert.True(t, stat.OK(), stat)
+	assert.Equal(t, "alice", reply)
+	_, stat = call(sess, "/order/read", "")
+	assert.True(t, stat.OK(), stat)
+
+	// the tokens by the metadata
+	sess = dial("")
+	_, stat = call(sess, "/whoami", "")
+	assert.Equal(t, erpc.CodeUnauthorized, stat.Code())
+	_, stat = call(sess, "/order/read", sign("k1", rsaKey, claims("bob", "order:write", time.Hour)))
+	assert.Equal(t, rbac.CodeForbidden, stat.Code())
+	reply, stat = call(sess, "/whoami", "")
+	assert.True(t, stat.OK(), stat)
+	assert.Equal(t, "bob", reply)
+	_, stat = call(sess, "/whoami", sign("k1", rsaKey, claims("bob", "", -2*time.Minute)))
+	assert.Equal(t, erpc.CodeUnauthorized, stat.Code())
+	wrong := claims("bob", "", time.Hour)
+	wrong["aud"] = "other"
+	_, stat = call(sess, "/whoami", sign("k1", rsaKey, wrong))
+	assert.Equal(t, erpc.CodeUnauthorized, stat.Code())
+
+	// the signature of the unknown key
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, stat = call(sess, "/whoami", sign("k1", otherKey, claims("eve", "", time.Hour)))
+	assert.Equal(t, erpc.CodeUnauthorized, stat.Code())
+
+	// the key rotation
+	iss.setKeys(map[string]crypto.Signer{"k2": ecKey})
+	time.Sleep(20 * time.Millisecond)
+	reply, stat = call(sess, "/whoami", sign("k2", ecKey, claims("carol", "", time.Hour)))
+	assert.True(t, stat.OK(), stat)
+	assert.Equal(t, "carol", reply)
+	iss.mu.Lock()
+	assert.Equal(t, 2, iss.fetches)
+	iss.mu.Unlock()
+}
@@ -0,0 +1,364 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/mixer/multiclient"
+	"github.com/andeya/erpc/v7/plugin/health"
+)
+
+type (
+	// GatewayConfig the gateway config
+	GatewayConfig struct {
+		Upstreams []Upstream
+		Routes    []Route
+	}
+	// Upstream a group of backend peers with the same services
+	Upstream struct {
+		Name  string
+		Addrs []string
+		// SessMaxQuota the max sessions of the pool for each address, default 8
+		SessMaxQuota int
+		// SessMaxIdleDuration the max idle duration of the pooled sessions, default 1min
+		SessMaxIdleDuration time.Duration
+		// Retries the max times of retrying on other addresses after the connection failed
+		Retries int
+		// HealthCheckInterval the interval of health checks, default 5s
+		HealthCheckInterval time.Duration
+		// HealthCheckMethod the service method called for health checks, default "/erpc/health" of plugin/health.
+		// For the default, the backend without the health plugin is healthy if it replies CodeNotFound.
+		HealthCheckMethod string
+		// HealthCheckTimeout the timeout of each health check, default 3s
+		HealthCheckTimeout time.Duration
+		// HashMetaKey if not empty, forwards by the consistent hash of the metadata value (or the real IP if empty),
+		// so that the messages with the same value are forwarded to the same backend.
+		HashMetaKey string
+		// HashReplicas the number of virtual nodes for each backend in the hash ring, default 100
+		HashReplicas int
+	}
+	// Route a route from the service method prefix to the upstream
+	Route struct {
+		// Prefix the service method prefix, the longest matched prefix wins
+		Prefix string
+		// Upstream the upstream name
+		Upstream string
+		// Rewrite replaces the prefix of the service method if not empty, e.g. "/"
+		Rewrite string
+		// SetMeta the metadata set to the forwarded messages
+		SetMeta map[string]string
+		// DelMeta the metadata deleted from the forwarded messages
+		DelMeta []string
+	}
+	// Gateway a reverse proxy fronting a fleet of backend peers,
+	// it selects the upstream by the service method prefix.
+	Gateway struct {
+		peer      erpc.Peer
+		upstreams map[string]*upstream
+		routes    []Route
+		closeOnce sync.Once
+		done      chan struct{}
+	}
+	upstream struct {
+		Upstream
+		backends []*backend
+		byAddr   map[string]*backend
+		ring     *HashRing
+		next     uint32
+	}
+	backend struct {
+		addr    string
+		client  *multiclient.MultiClient
+		healthy int32
+	}
+	gatewayForwarder struct {
+		route    Route
+		upstream *upstream
+		hashKey  string
+	}
+)
+
+// retryable codes, the message is not handled by the backend.
+var retryableCodes = map[int32]bool{
+	erpc.CodeWrongConn:   true,
+	erpc.CodeDialFailed:  true,
+	erpc.CodeWriteFailed: true,
+}
+
+// NewGateway creates a gateway, the peer is used to dial the backends.
+// NOTE: Use Gateway.Plugin() to front the backends by a server peer.
+func NewGateway(peer erpc.Peer, cfg GatewayConfig, protoFunc ...erpc.ProtoFunc) (*Gateway, error) {
+	g := &Gateway{
+		peer:      peer,
+		upstreams: make(map[string]*upstream, len(cfg.Upstreams)),
+		done:      make(chan struct{}),
+	}
+	for _, u := range cfg.Upstreams {
+		if _, ok := g.upstreams[u.Name]; ok {
+			return nil, fmt.Errorf("proxy: duplicate upstream %q", u.Name)
+		}
+		if len(u.Addrs) == 0 {
+			return nil, fmt.Errorf("proxy: upstream %q has no address", u.Name)
+		}
+		if u.SessMaxQuota <= 0 {
+			u.SessMaxQuota = 8
+		}
+		if u.SessMaxIdleDuration <= 0 {
+			u.SessMaxIdleDuration = time.Minute
+		}
+		if u.HealthCheckInterval <= 0 {
+			u.HealthCheckInterval = 5 * time.Second
+		}
+		if u.HealthCheckTimeout <= 0 {
+			u.HealthCheckTimeout = 3 * time.Second
+		}
+		if u.HealthCheckMethod == "" {
+			u.HealthCheckMethod = health.ServiceMethod
+		}
+		up := &upstream{Upstream: u, byAddr: make(map[string]*backend, len(u.Addrs))}
+		for _, addr := range u.Addrs {
+			b := &backend{
+				addr:    addr,
+				client:  multiclient.New(peer, addr, u.SessMaxQuota, u.SessMaxIdleDuration, protoFunc...),
+				healthy: 1,
+			}
+			up.backends = append(up.backends, b)
+			up.byAddr[addr] = b
+		}
+		if u.HashMetaKey != "" {
+			up.ring = NewHashRing(u.HashReplicas)
+			up.ring.Add(u.Addrs...)
+		}
+		g.upstreams[u.Name] = up
+	}
+	for _, r := range cfg.Routes {
+		if _, ok := g.upstreams[r.Upstream]; !ok {
+			g.Close()
+			return nil, fmt.Errorf("proxy: route %q has unknown upstream %q", r.Prefix, r.Upstream)
+		}
+		g.routes = append(g.routes, r)
+	}
+	sort.SliceStable(g.routes, func(i, j int) bool {
+		return len(g.routes[i].Prefix) > len(g.routes[j].Prefix)
+	})
+	for _, up := range g.upstreams {
+		go g.healthCheck(up)
+	}
+	return g, nil
+}
+
+// Plugin returns the proxy plugin forwarding the unknown calling and pushing to the upstreams.
+func (g *Gateway) Plugin() erpc.Plugin {
+	return NewPlugin(g.forwarder)
+}
+
+// Healthy returns the healthy addresses of the upstream.
+func (g *Gateway) Healthy(upstreamName string) []string {
+	up, ok := g.upstreams[upstreamName]
+	if !ok {
+		return nil
+	}
+	var addrs []string
+	for _, b := range up.backends {
+		if atomic.LoadInt32(&b.healthy) == 1 {
+			addrs = append(addrs, b.addr)
+		}
+	}
+	return addrs
+}
+
+// Close stops the health checks and closes the session pools.
+func (g *Gateway) Close() {
+	g.closeOnce.Do(func() {
+		close(g.done)
+		for _, up := range g.upstreams {
+			for _, b := range up.backends {
+				b.client.Close()
+			}
+		}
+	})
+}
+
+// Match returns the route matched the service method.
+func (g *Gateway) Match(serviceMethod string) (Route, bool) {
+	for _, r := range g.routes {
+		if strings.HasPrefix(serviceMethod, r.Prefix) {
+			return r, true
+		}
+	}
+	return Route{}, false
+}
+
+func (g *Gateway) forwarder(label *Label) Forwarder {
+	r, ok := g.Match(label.ServiceMethod)
+	if !ok {
+		return statusForwarder{erpc.CodeNotFound, "no gateway route"}
+	}
+	f := &gatewayForwarder{route: r, upstream: g.upstreams[r.Upstream]}
+	if f.upstream.ring != nil {
+		f.hashKey = stickyKey(label, f.upstream.HashMetaKey)
+	}
+	return f
+}
+
+func (g *Gateway) healthCheck(up *upstream) {
+	ticker := time.NewTicker(up.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.done:
+			return
+		case <-ticker.C:
+		}
+		for _, b := range up.backends {
+			up.setHealthy(b, g.check(up, b))
+		}
+	}
+}
+
+// check calls the health checking method by the session pool of the backend,
+// including the dialing, within the timeout.
+func (g *Gateway) check(up *upstream, b *backend) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), up.HealthCheckTimeout)
+	defer cancel()
+	done := make(chan *erpc.Status, 1)
+	go func() {
+		var result interface{}
+		done <- b.client.Call(up.HealthCheckMethod, nil, &result, erpc.WithContext(ctx)).Status()
+	}()
+	select {
+	case stat := <-done:
+		if stat.OK() {
+			return true
+		}
+		return stat.Code() == erpc.CodeNotFound && up.HealthCheckMethod == health.ServiceMethod
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// setHealthy marks the backend healthy or not, and rebalances the hash ring.
+func (up *upstream) setHealthy(b *backend, healthy bool) {
+	var v int32
+	if healthy {
+		v = 1
+	}
+	if atomic.SwapInt32(&b.healthy, v) == v {
+		return
+	}
+	if healthy {
+		if up.ring != nil {
+			up.ring.Add(b.addr)
+		}
+		erpc.Infof("proxy: upstream %q backend %s is up", up.Name, b.addr)
+	} else {
+		if up.ring != nil {
+			up.ring.Remove(b.addr)
+		}
+		erpc.Warnf("proxy: upstream %q backend %s is down", up.Name, b.addr)
+	}
+}
+
+// pick returns the backends in the order of trying, the healthy ones first.
+// NOTE: If the upstream has the hash ring, the backends of the hash key clockwise are returned.
+func (up *upstream) pick(hashKey string) []*backend {
+	if up.ring != nil {
+		addrs := up.ring.GetN(hashKey, up.Retries+1)
+		if len(addrs) > 0 {
+			backends := make([]*backend, len(addrs))
+			for i, addr := range addrs {
+				backends[i] = up.byAddr[addr]
+			}
+			return backends
+		}
+	}
+	n := len(up.backends)
+	start := int(atomic.AddUint32(&up.next, 1)) % n
+	healthy := make([]*backend, 0, n)
+	var unhealthy []*backend
+	for i := 0; i < n; i++ {
+		b := up.backends[(start+i)%n]
+		if atomic.LoadInt32(&b.healthy) == 1 {
+			healthy = append(healthy, b)
+		} else {
+			unhealthy = append(unhealthy, b)
+		}
+	}
+	backends := append(healthy, unhealthy...)
+	if max := up.Retries + 1; len(backends) > max {
+		backends = backends[:max]
+	}
+	return backends
+}
+
+func (f *gatewayForwarder) rewrite(uri string, setting []erpc.MessageSetting) (string, []erpc.MessageSetting) {
+	if f.route.Rewrite != "" {
+		uri = f.route.Rewrite + strings.TrimPrefix(uri, f.route.Prefix)
+	}
+	for _, k := range f.route.DelMeta {
+		setting = append(setting, erpc.WithDelMeta(k))
+	}
+	for k, v := range f.route.SetMeta {
+		setting = append(setting, erpc.WithSetMeta(k, v))
+	}
+	return uri, setting
+}
+
+func (f *gatewayForwarder) Call(uri string, arg interface{}, result interface{}, setting ...erpc.MessageSetting) erpc.CallCmd {
+	uri, setting = f.rewrite(uri, setting)
+	var callCmd erpc.CallCmd
+	for _, b := range f.upstream.pick(f.hashKey) {
+		callCmd = b.client.Call(uri, arg, result, setting...)
+		if !retryableCodes[callCmd.Status().Code()] {
+			break
+		}
+		f.upstream.setHealthy(b, false)
+	}
+	return callCmd
+}
+
+func (f *gatewayForwarder) Push(uri string, arg interface{}, setting ...erpc.MessageSetting) *erpc.Status {
+	uri, setting = f.rewrite(uri, setting)
+	var stat *erpc.Status
+	for _, b := range f.upstream.pick(f.hashKey) {
+		stat = b.client.Push(uri, arg, setting...)
+		if !retryableCodes[stat.Code()] {
+			break
+		}
+		f.upstream.setHealthy(b, false)
+	}
+	return stat
+}
+
+type statusForwarder struct {
+	code  int32
+	cause string
+}
+
+func (f statusForwarder) Call(uri string, arg interface{}, result interface{}, _ ...erpc.MessageSetting) erpc.CallCmd {
+	return erpc.NewFakeCallCmd(uri, arg, result, f.Push(uri, arg))
+}
+
+func (f statusForwarder) Push(uri string, arg interface{}, _ ...erpc.MessageSetting) *erpc.Status {
+	return erpc.NewStatus(f.code, erpc.CodeText(f.code), f.cause)
+}
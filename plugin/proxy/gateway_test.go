@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/plugin/health"
+)
+
+type Home struct {
+	erpc.CallCtx
+}
+
+func (h *Home) Test(arg *map[string]string) (map[string]string, *erpc.Status) {
+	return map[string]string{
+		"author": (*arg)["author"],
+		"tenant": string(h.PeekMeta("tenant")),
+		"secret": string(h.PeekMeta("secret")),
+	}, nil
+}
+
+func TestGateway(t *testing.T) {
+	backend := erpc.NewPeer(erpc.PeerConfig{ListenPort: 9098})
+	backend.RouteCall(new(Home))
+	go backend.ListenAndServe()
+	defer backend.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	gw, err := NewGateway(erpc.NewPeer(erpc.PeerConfig{}), GatewayConfig{
+		Upstreams: []Upstream{{
+			Name: "home",
+			// the first address is down
+			Addrs:   []string{"127.0.0.1:9099", "127.0.0.1:9098"},
+			Retries: 1,
+		}},
+		Routes: []Route{{
+			Prefix:   "/api/",
+			Upstream: "home",
+			Rewrite:  "/",
+			SetMeta:  map[string]string{"tenant": "t1"},
+			DelMeta:  []string{"secret"},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gw.Close()
+	srv := erpc.NewPeer(erpc.PeerConfig{ListenPort: 9100}, gw.Plugin())
+	go srv.ListenAndServe()
+	defer srv.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(":9100")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	for i := 0; i < 2; i++ {
+		var result map[string]string
+		stat = sess.Call("/api/home/test",
+			map[string]string{"author": "henrylee2cn"},
+			&result,
+			erpc.WithAddMeta("secret", "x"),
+		).Status()
+		if !stat.OK() {
+			t.Fatal(stat)
+		}
+		if result["author"] != "henrylee2cn" || result["tenant"] != "t1" || result["secret"] != "" {
+			t.Fatalf("got %v", result)
+		}
+	}
+	if addrs := gw.Healthy("home"); len(addrs) != 1 || addrs[0] != "127.0.0.1:9098" {
+		t.Fatalf("healthy: got %v", addrs)
+	}
+	stat = sess.Call("/other/test", nil, nil).Status()
+	if stat.Code() != erpc.CodeNotFound {
+		t.Fatalf("no route: got %v", stat)
+	}
+}
+
+func TestGatewayHealthCheck(t *testing.T) {
+	backend := erpc.NewPeer(erpc.PeerConfig{ListenPort: 9112}, health.NewPlugin())
+	go backend.ListenAndServe()
+	defer backend.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	gw, err := NewGateway(erpc.NewPeer(erpc.PeerConfig{}), GatewayConfig{
+		Upstreams: []Upstream{{
+			Name:                "home",
+			Addrs:               []string{"127.0.0.1:9113", "127.0.0.1:9112"},
+			HealthCheckInterval: 100 * time.Millisecond,
+			HealthCheckTimeout:  time.Second,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gw.Close()
+	time.Sleep(500 * time.Millisecond)
+	if addrs := gw.Healthy("home"); len(addrs) != 1 || addrs[0] != "127.0.0.1:9112" {
+		t.Fatalf("healthy: got %v", addrs)
+	}
+	health.SetReady(false)
+	defer health.SetReady(true)
+	time.Sleep(500 * time.Millisecond)
+	if addrs := gw.Healthy("home"); len(addrs) != 0 {
+		t.Fatalf("unready: got %v", addrs)
+	}
+}
+
+func TestHashRing(t *testing.T) {
+	ring := NewHashRing(0)
+	ring.Add("a", "b", "c")
+	keys := make([]string, 1000)
+	before := make(map[string]string, len(keys))
+	for i := range keys {
+		keys[i] = "user" + strconv.Itoa(i)
+		before[keys[i]], _ = ring.Get(keys[i])
+	}
+	if nodes := ring.GetN("user1", 5); len(nodes) != 3 || nodes[0] != before["user1"] {
+		t.Fatalf("GetN: got %v", nodes)
+	}
+	ring.Remove("b")
+	for _, k := range keys {
+		node, _ := ring.Get(k)
+		if before[k] != "b" && node != before[k] {
+			t.Fatalf("key %s moved from %s to %s", k, before[k], node)
+		}
+		if node == "b" {
+			t.Fatalf("key %s is on the removed node", k)
+		}
+	}
+	ring.Add("b")
+	for _, k := range keys {
+		if node, _ := ring.Get(k); node != before[k] {
+			t.Fatalf("key %s is not rebalanced back: %s", k, node)
+		}
+	}
+
+	fn := NewStickyForwarderFunc(ring, "user_id", func(node string) Forwarder {
+		return statusForwarder{cause: node}
+	})
+	label := &Label{RealIP: "127.0.0.1", peekMeta: func(key string) []byte {
+		if key == "user_id" {
+			return []byte("user1")
+		}
+		return nil
+	}}
+	if got := fn(label).Push("", nil).Cause().Error(); got != before["user1"] {
+		t.Fatalf("sticky: got %s", got)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/goutil"
+)
+
+// HashRing a consistent hash ring of the backend nodes,
+// only the keys of the changed nodes are moved when the members change.
+type HashRing struct {
+	mu       sync.RWMutex
+	replicas int
+	hash     func([]byte) uint32
+	keys     []uint32
+	nodes    map[uint32]string
+	members  map[string]struct{}
+}
+
+// NewHashRing creates a consistent hash ring.
+// NOTE:
+//  replicas is the number of virtual nodes for each node, default 100;
+//  If hash is not specified, crc32.ChecksumIEEE is used.
+func NewHashRing(replicas int, hash ...func([]byte) uint32) *HashRing {
+	if replicas <= 0 {
+		replicas = 100
+	}
+	r := &HashRing{
+		replicas: replicas,
+		hash:     crc32.ChecksumIEEE,
+		nodes:    make(map[uint32]string),
+		members:  make(map[string]struct{}),
+	}
+	if len(hash) > 0 && hash[0] != nil {
+		r.hash = hash[0]
+	}
+	return r
+}
+
+// Add adds the nodes to the ring.
+func (r *HashRing) Add(nodes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, node := range nodes {
+		if _, ok := r.members[node]; ok {
+			continue
+		}
+		r.members[node] = struct{}{}
+		for i := 0; i < r.replicas; i++ {
+			h := r.hash([]byte(strconv.Itoa(i) + node))
+			if _, ok := r.nodes[h]; ok {
+				continue
+			}
+			r.nodes[h] = node
+			r.keys = append(r.keys, h)
+		}
+	}
+	sort.Slice(r.keys, func(i, j int) bool { return r.keys[i] < r.keys[j] })
+}
+
+// Remove removes the nodes from the ring.
+func (r *HashRing) Remove(nodes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var changed bool
+	for _, node := range nodes {
+		if _, ok := r.members[node]; ok {
+			delete(r.members, node)
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	keys := r.keys[:0]
+	for _, h := range r.keys {
+		if _, ok := r.members[r.nodes[h]]; ok {
+			keys = append(keys, h)
+		} else {
+			delete(r.nodes, h)
+		}
+	}
+	r.keys = keys
+}
+
+// Members returns the nodes of the ring.
+func (r *HashRing) Members() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	members := make([]string, 0, len(r.members))
+	for node := range r.members {
+		members = append(members, node)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// Get returns the node of the key.
+func (r *HashRing) Get(key string) (string, bool) {
+	nodes := r.GetN(key, 1)
+	if len(nodes) == 0 {
+		return "", false
+	}
+	return nodes[0], true
+}
+
+// GetN returns at most n distinct nodes clockwise from the key,
+// the first one is the node of the key and the others are for failover.
+func (r *HashRing) GetN(key string, n int) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.keys) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(r.members) {
+		n = len(r.members)
+	}
+	h := r.hash(goutil.StringToBytes(key))
+	i := sort.Search(len(r.keys), func(i int) bool { return r.keys[i] >= h })
+	nodes := make([]string, 0, n)
+	for j := 0; len(nodes) < n && j < len(r.keys); j++ {
+		node := r.nodes[r.keys[(i+j)%len(r.keys)]]
+		if !containsString(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+func containsString(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// NewStickyForwarderFunc returns the function of selecting the forwarder by hashing the metadata key,
+// so that the calls and pushes with the same metadata value are forwarded to the same node.
+// NOTE: If the metadata is empty, the real IP is hashed instead.
+func NewStickyForwarderFunc(ring *HashRing, metaKey string, forwarder func(node string) Forwarder) func(*Label) Forwarder {
+	return func(label *Label) Forwarder {
+		node, ok := ring.Get(stickyKey(label, metaKey))
+		if !ok {
+			return statusForwarder{erpc.CodeServiceUnavailable, "no node in the hash ring"}
+		}
+		return forwarder(node)
+	}
+}
+
+func stickyKey(label *Label, metaKey string) string {
+	if v := label.PeekMeta(metaKey); len(v) > 0 {
+		return string(v)
+	}
+	return label.RealIP
+}
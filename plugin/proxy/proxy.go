@@ -17,11 +17,13 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/andeya/erpc/v7"
 	"github.com/andeya/goutil"
@@ -66,6 +68,7 @@ type (
 	// Label proxy label information
 	Label struct {
 		SessionID, RealIP, ServiceMethod string
+		peekMeta                         func(key string) []byte
 	}
 	proxy struct {
 		callForwarder func(*Label) CallForwarder
@@ -97,9 +100,8 @@ func (p *proxy) call(ctx erpc.UnknownCallCtx) (interface{}, *erpc.Status) {
 		settings = make([]erpc.MessageSetting, 0, 16)
 	)
 	label.SessionID = ctx.Session().ID()
-	ctx.VisitMeta(func(key, value []byte) {
-		settings = append(settings, erpc.WithAddMeta(string(key), string(value)))
-	})
+	settings, cancel := forwardMeta(ctx, settings)
+	defer cancel()
 	var (
 		result      []byte
 		realIPBytes = ctx.PeekMeta(erpc.MetaRealIP)
@@ -111,8 +113,12 @@ func (p *proxy) call(ctx erpc.UnknownCallCtx) (interface{}, *erpc.Status) {
 		label.RealIP = goutil.BytesToString(realIPBytes)
 	}
 	label.ServiceMethod = ctx.ServiceMethod()
+	label.peekMeta = ctx.PeekMeta
 	callcmd := p.callForwarder(&label).Call(label.ServiceMethod, ctx.InputBodyBytes(), &result, settings...)
 	callcmd.InputMeta().VisitAll(func(key, value []byte) {
+		if erpc.IsReservedMeta(goutil.BytesToString(key)) {
+			return
+		}
 		ctx.SetMeta(goutil.BytesToString(key), goutil.BytesToString(value))
 	})
 	stat := callcmd.Status()
@@ -129,9 +135,8 @@ func (p *proxy) push(ctx erpc.UnknownPushCtx) *erpc.Status {
 		settings = make([]erpc.MessageSetting, 0, 16)
 	)
 	label.SessionID = ctx.Session().ID()
-	ctx.VisitMeta(func(key, value []byte) {
-		settings = append(settings, erpc.WithAddMeta(string(key), string(value)))
-	})
+	settings, cancel := forwardMeta(ctx, settings)
+	defer cancel()
 	if realIPBytes := ctx.PeekMeta(erpc.MetaRealIP); len(realIPBytes) == 0 {
 		label.RealIP = ctx.IP()
 		settings = append(settings, erpc.WithAddMeta(erpc.MetaRealIP, label.RealIP))
@@ -139,6 +144,7 @@ func (p *proxy) push(ctx erpc.UnknownPushCtx) *erpc.Status {
 		label.RealIP = goutil.BytesToString(realIPBytes)
 	}
 	label.ServiceMethod = ctx.ServiceMethod()
+	label.peekMeta = ctx.PeekMeta
 	stat := p.pushForwarder(&label).Push(label.ServiceMethod, ctx.InputBodyBytes(), settings...)
 	if !stat.OK() && stat.Code() < 200 && stat.Code() > 99 {
 		stat.SetCode(erpc.CodeBadGateway)
@@ -147,6 +153,36 @@ func (p *proxy) push(ctx erpc.UnknownPushCtx) *erpc.Status {
 	return stat
 }
 
+// forwardMeta appends the settings of forwarding the input metadata,
+// the reserved ones are converted by the typed accessors, e.g. the deadline and the trace context.
+func forwardMeta(ctx interface {
+	VisitMeta(f func(key, value []byte))
+	TraceContext() (erpc.TraceContext, bool)
+	Deadline() (time.Time, bool)
+}, settings []erpc.MessageSetting) ([]erpc.MessageSetting, context.CancelFunc) {
+	ctx.VisitMeta(func(key, value []byte) {
+		if !erpc.IsReservedMeta(string(key)) {
+			settings = append(settings, erpc.WithAddMeta(string(key), string(value)))
+		}
+	})
+	if tc, ok := ctx.TraceContext(); ok {
+		settings = append(settings, erpc.WithTraceContext(tc))
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		c, cancel := context.WithDeadline(context.Background(), deadline)
+		return append(settings, erpc.WithContext(c)), cancel
+	}
+	return settings, func() {}
+}
+
+// PeekMeta peeks the metadata of the message being forwarded.
+func (l *Label) PeekMeta(key string) []byte {
+	if l.peekMeta == nil {
+		return nil
+	}
+	return l.peekMeta(key)
+}
+
 var peerName = filepath.Base(os.Args[0])
 var incr int64
 var mutex sync.Mutex
@@ -0,0 +1,162 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rbac
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// StaticPolicy the policy of the static grants of the roles and the subjects.
+// NOTE:
+//  A grant matches the permission if they are equal, or the grant is "*",
+//  or the grant ends with ":*" and is the prefix of the permission, e.g. "order:*" matches "order:read".
+type StaticPolicy struct {
+	// Roles the grants by the role
+	Roles map[string][]string `yaml:"roles"`
+	// Subjects the grants by the subject, optional
+	Subjects map[string][]string `yaml:"subjects"`
+}
+
+// NewStaticPolicy creates a static policy of the grants by the role.
+func NewStaticPolicy(roles map[string][]string) *StaticPolicy {
+	return &StaticPolicy{Roles: roles}
+}
+
+// ParseYAML parses the static policy from the YAML, e.g.
+//  roles:
+//    admin: ["*"]
+//    reader: ["order:read"]
+//  subjects:
+//    alice: ["order:write"]
+func ParseYAML(b []byte) (*StaticPolicy, error) {
+	p := new(StaticPolicy)
+	if err := yaml.UnmarshalStrict(b, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// LoadYAMLFile loads the static policy from the YAML file.
+func LoadYAMLFile(filename string) (*StaticPolicy, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseYAML(b)
+}
+
+// Authorize reports whether each permission is granted to the subject or one of the roles.
+func (p *StaticPolicy) Authorize(_ context.Context, req *Request) (bool, error) {
+	for _, perm := range req.Permissions {
+		if !p.granted(req.Identity, perm) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (p *StaticPolicy) granted(id *Identity, perm string) bool {
+	if matchGrants(p.Subjects[id.Subject], perm) {
+		return true
+	}
+	for _, role := range id.Roles {
+		if matchGrants(p.Roles[role], perm) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchGrants(grants []string, perm string) bool {
+	for _, g := range grants {
+		if g == "*" || g == perm || (strings.HasSuffix(g, ":*") && strings.HasPrefix(perm, g[:len(g)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// OPAPolicy the adapter of the Open Policy Agent, which queries the decision by the data API.
+// NOTE:
+//  The input is {"subject","roles","service_method","permissions"},
+//  and the result is allowed if it is true or {"allow":true}.
+type OPAPolicy struct {
+	// URL the URL of the data API of the decision, e.g. "http://127.0.0.1:8181/v1/data/erpc/authz"
+	URL string
+	// Client the HTTP client, default http.DefaultClient
+	Client *http.Client
+}
+
+type opaInput struct {
+	Subject       string   `json:"subject"`
+	Roles         []string `json:"roles"`
+	ServiceMethod string   `json:"service_method"`
+	Permissions   []string `json:"permissions"`
+}
+
+// Authorize queries the decision of the OPA.
+func (p *OPAPolicy) Authorize(ctx context.Context, req *Request) (bool, error) {
+	b, err := json.Marshal(map[string]opaInput{"input": {
+		Subject:       req.Identity.Subject,
+		Roles:         req.Identity.Roles,
+		ServiceMethod: req.ServiceMethod,
+		Permissions:   req.Permissions,
+	}})
+	if err != nil {
+		return false, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(b))
+	if err != nil {
+		return false, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("opa: %s", resp.Status)
+	}
+	var result struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+	var allow bool
+	if json.Unmarshal(result.Result, &allow) == nil {
+		return allow, nil
+	}
+	var obj struct {
+		Allow bool `json:"allow"`
+	}
+	if err = json.Unmarshal(result.Result, &obj); err != nil {
+		return false, fmt.Errorf("opa: unexpected result %s", result.Result)
+	}
+	return obj.Allow, nil
+}
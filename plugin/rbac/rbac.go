@@ -0,0 +1,206 @@
+// Package rbac is a plugin that authorizes the calls by the permissions declared by the routes.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rbac
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/andeya/erpc/v7"
+)
+
+// CodeForbidden the status code of the denied call, like the HTTP 403
+const CodeForbidden int32 = 403
+
+func init() {
+	erpc.RegisterCode(CodeForbidden, "FORBIDDEN", "Forbidden")
+	erpc.RegisterGRPCCode(CodeForbidden, erpc.GRPCPermissionDenied)
+}
+
+// DefaultSwapKey the default key of the authenticated identity in the session Swap
+const DefaultSwapKey = "erpc-rbac-identity"
+
+var (
+	// StatForbidden the status replied to the CALL denied by the policy
+	StatForbidden = erpc.NewStatus(CodeForbidden, "Forbidden", "")
+	// StatUnauthenticated the status replied to the CALL of the protected route without the identity
+	StatUnauthenticated = erpc.NewStatus(erpc.CodeUnauthorized, "Unauthenticated", "")
+)
+
+// Identity the authenticated identity of the session, stored in the session Swap by the authentication.
+type Identity struct {
+	// Subject the id of the user or the service
+	Subject string
+	// Roles the roles of the subject
+	Roles []string
+}
+
+// Request the authorization request of a call.
+type Request struct {
+	Identity      *Identity
+	ServiceMethod string
+	// Permissions the permissions declared by the route, all of them are required
+	Permissions []string
+}
+
+// Policy the source of the authorization decisions, e.g. NewStaticPolicy, PolicyFunc or OPAPolicy.
+type Policy interface {
+	Authorize(ctx context.Context, req *Request) (bool, error)
+}
+
+// PolicyFunc the callback policy
+type PolicyFunc func(ctx context.Context, req *Request) (bool, error)
+
+// Authorize calls f(ctx, req).
+func (f PolicyFunc) Authorize(ctx context.Context, req *Request) (bool, error) {
+	return f(ctx, req)
+}
+
+// Config the RBAC config
+type Config struct {
+	// Policy the policy authorizing the calls, required
+	Policy Policy
+	// SwapKey the key of the *Identity in the session Swap, default DefaultSwapKey
+	SwapKey string
+	// Identity gets the identity of the message instead of the session Swap, optional
+	Identity func(erpc.ReadCtx) *Identity
+	// DenyUndeclared denies the routes without the declared permissions, otherwise they are public
+	DenyUndeclared bool
+}
+
+// Authorizer the RBAC plugin.
+// NOTE:
+//  The CALL denied is replied with StatForbidden or StatUnauthenticated without handling, and the PUSH is dropped;
+//  The authentication, e.g. by the auth plugin, stores the *Identity in the session Swap after the handshake.
+type Authorizer struct {
+	policy         Policy
+	swapKey        string
+	identity       func(erpc.ReadCtx) *Identity
+	denyUndeclared bool
+
+	mu    sync.RWMutex
+	perms map[string][]string
+}
+
+var (
+	_ erpc.PostReadCallHeaderPlugin = (*Authorizer)(nil)
+	_ erpc.PostReadPushHeaderPlugin = (*Authorizer)(nil)
+)
+
+// New creates a RBAC plugin.
+func New(cfg Config) *Authorizer {
+	if cfg.Policy == nil {
+		erpc.Fatalf("rbac: the policy is required")
+	}
+	if cfg.SwapKey == "" {
+		cfg.SwapKey = DefaultSwapKey
+	}
+	return &Authorizer{
+		policy:         cfg.Policy,
+		swapKey:        cfg.SwapKey,
+		identity:       cfg.Identity,
+		denyUndeclared: cfg.DenyUndeclared,
+		perms:          make(map[string][]string),
+	}
+}
+
+// Name returns the plugin name.
+func (a *Authorizer) Name() string {
+	return "rbac"
+}
+
+// Require returns a route plugin declaring the permissions required by the routes.
+// Example:
+//  peer.RouteCall(new(Order), authz.Require("order:write"))
+func (a *Authorizer) Require(perms ...string) erpc.Plugin {
+	return &requirePlugin{a: a, perms: perms}
+}
+
+type requirePlugin struct {
+	a     *Authorizer
+	perms []string
+}
+
+var _ erpc.PostRegPlugin = (*requirePlugin)(nil)
+
+func (r *requirePlugin) Name() string {
+	return "rbac-require:" + strings.Join(r.perms, ",")
+}
+
+func (r *requirePlugin) PostReg(h *erpc.Handler) error {
+	r.a.mu.Lock()
+	r.a.perms[h.Name()] = append(r.a.perms[h.Name()], r.perms...)
+	r.a.mu.Unlock()
+	return nil
+}
+
+// PostReadCallHeader rejects the CALL denied by the policy.
+func (a *Authorizer) PostReadCallHeader(ctx erpc.ReadCtx) *erpc.Status {
+	return a.authorize(ctx)
+}
+
+// PostReadPushHeader drops the PUSH denied by the policy.
+func (a *Authorizer) PostReadPushHeader(ctx erpc.ReadCtx) *erpc.Status {
+	return a.authorize(ctx)
+}
+
+// Permissions returns the permissions declared by the route.
+func (a *Authorizer) Permissions(serviceMethod string) []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.perms[serviceMethod]
+}
+
+func (a *Authorizer) authorize(ctx erpc.ReadCtx) *erpc.Status {
+	serviceMethod := ctx.ServiceMethod()
+	a.mu.RLock()
+	perms, declared := a.perms[serviceMethod]
+	a.mu.RUnlock()
+	if !declared && !a.denyUndeclared {
+		return nil
+	}
+	id := a.getIdentity(ctx)
+	if id == nil {
+		return StatUnauthenticated
+	}
+	ok, err := a.policy.Authorize(ctx.Context(), &Request{Identity: id, ServiceMethod: serviceMethod, Permissions: perms})
+	if err != nil {
+		ctx.Errorf("rbac: authorize %q of %q: %s", serviceMethod, id.Subject, err.Error())
+		return StatForbidden.Copy(err)
+	}
+	if !ok {
+		return StatForbidden
+	}
+	return nil
+}
+
+func (a *Authorizer) getIdentity(ctx erpc.ReadCtx) *Identity {
+	if a.identity != nil {
+		return a.identity(ctx)
+	}
+	v, ok := ctx.Session().Swap().Load(a.swapKey)
+	if !ok {
+		return nil
+	}
+	switch id := v.(type) {
+	case *Identity:
+		return id
+	case Identity:
+		return &id
+	}
+	return nil
+}
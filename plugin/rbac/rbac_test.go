@@ -0,0 +1,146 @@
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func order_read(erpc.CallCtx, *int) (string, *erpc.Status) {
+	return "read", nil
+}
+
+func order_write(erpc.CallCtx, *int) (string, *erpc.Status) {
+	return "write", nil
+}
+
+func ping(erpc.CallCtx, *int) (string, *erpc.Status) {
+	return "pong", nil
+}
+
+// login stores the identity of the session received at the handshake, none if the subject is empty.
+type login struct{}
+
+func (login) Name() string { return "login" }
+
+func (login) PostAccept(sess erpc.PreSession) *erpc.Status {
+	input := sess.PreReceive(func(erpc.Header) interface{} { return new(Identity) })
+	if !input.StatusOK() {
+		return input.Status()
+	}
+	if id := input.Body().(*Identity); id.Subject != "" {
+		sess.Swap().Store(DefaultSwapKey, id)
+	}
+	return nil
+}
+
+const policyYAML = `
+roles:
+  reader: ["order:read"]
+  admin: ["order:*"]
+subjects:
+  bob: ["order:write"]
+`
+
+func serve(t *testing.T, policy Policy) (erpc.Peer, string) {
+	authz := New(Config{Policy: policy})
+	srv := erpc.NewPeer(erpc.PeerConfig{}, login{}, authz)
+	srv.RouteCallFunc(order_read, authz.Require("order:read"))
+	srv.RouteCallFunc(order_write, authz.Require("order:write"))
+	srv.RouteCallFunc(ping)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	time.Sleep(100 * time.Millisecond)
+	return srv, lis.Addr().String()
+}
+
+func dial(t *testing.T, addr string, id *Identity) erpc.Session {
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	t.Cleanup(func() { cli.Close() })
+	sess, stat := cli.Dial(addr)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	if id == nil {
+		id = new(Identity)
+	}
+	if stat = sess.Push("/login", id); !stat.OK() {
+		t.Fatal(stat)
+	}
+	return sess
+}
+
+func call(sess erpc.Session, uri string) int32 {
+	var reply string
+	return sess.Call(uri, 1, &reply).Status().Code()
+}
+
+func TestStaticPolicy(t *testing.T) {
+	policy, err := ParseYAML([]byte(policyYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParseYAML([]byte("role: {}"))
+	assert.Error(t, err)
+
+	srv, addr := serve(t, policy)
+	defer srv.Close()
+	assert.Equal(t, []string{"order:write"}, srv.PluginContainer().GetByName("rbac").(*Authorizer).Permissions("/order/write"))
+
+	reader := dial(t, addr, &Identity{Subject: "alice", Roles: []string{"reader"}})
+	assert.Equal(t, erpc.CodeOK, call(reader, "/order/read"))
+	assert.Equal(t, CodeForbidden, call(reader, "/order/write"))
+	assert.Equal(t, erpc.CodeOK, call(reader, "/ping"))
+	assert.Equal(t, "FORBIDDEN", erpc.CodeName(CodeForbidden))
+	assert.Equal(t, erpc.GRPCPermissionDenied, erpc.StatusToGRPC(StatForbidden))
+
+	bob := dial(t, addr, &Identity{Subject: "bob"})
+	assert.Equal(t, erpc.CodeOK, call(bob, "/order/write"))
+	assert.Equal(t, CodeForbidden, call(bob, "/order/read"))
+
+	admin := dial(t, addr, &Identity{Subject: "carol", Roles: []string{"admin"}})
+	assert.Equal(t, erpc.CodeOK, call(admin, "/order/read"))
+	assert.Equal(t, erpc.CodeOK, call(admin, "/order/write"))
+
+	anonymous := dial(t, addr, nil)
+	assert.Equal(t, erpc.CodeUnauthorized, call(anonymous, "/order/read"))
+}
+
+func TestOPAPolicy(t *testing.T) {
+	opa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input opaInput `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		allow := body.Input.Subject == "alice" && body.Input.ServiceMethod == "/order/read"
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": map[string]bool{"allow": allow}})
+	}))
+	defer opa.Close()
+
+	srv, addr := serve(t, &OPAPolicy{URL: opa.URL})
+	defer srv.Close()
+	alice := dial(t, addr, &Identity{Subject: "alice"})
+	assert.Equal(t, erpc.CodeOK, call(alice, "/order/read"))
+	assert.Equal(t, CodeForbidden, call(alice, "/order/write"))
+
+	// the callback policy
+	var got *Request
+	srv2, addr2 := serve(t, PolicyFunc(func(_ context.Context, req *Request) (bool, error) {
+		got = req
+		return true, nil
+	}))
+	defer srv2.Close()
+	sess := dial(t, addr2, &Identity{Subject: "bob"})
+	assert.Equal(t, erpc.CodeOK, call(sess, "/order/write"))
+	assert.Equal(t, &Request{Identity: &Identity{Subject: "bob"}, ServiceMethod: "/order/write", Permissions: []string{"order:write"}}, got)
+}
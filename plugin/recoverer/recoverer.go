@@ -0,0 +1,56 @@
+// Package recoverer is a plugin that recovers the panics of handlers,
+// replies 500-style status and reports them.
+package recoverer
+
+import (
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/goutil"
+)
+
+// Reporter reports the recovered panic of a handler, e.g. sends it to Sentry.
+type Reporter func(ctx erpc.ReadCtx, recovered interface{}, stack []byte)
+
+// New creates a panic recovery plugin.
+// NOTE:
+//  If withStack is true, the stack of the panic is tagged to the status,
+//  but it is not transferred to the remote peer;
+//  The reporter can be nil.
+func New(withStack bool, reporter Reporter) erpc.Plugin {
+	return &recoverPlugin{
+		withStack: withStack,
+		reporter:  reporter,
+	}
+}
+
+type recoverPlugin struct {
+	withStack bool
+	reporter  Reporter
+}
+
+var (
+	_ erpc.PostHandlePanicPlugin = new(recoverPlugin)
+)
+
+func (r *recoverPlugin) Name() string {
+	return "recoverer"
+}
+
+func (r *recoverPlugin) PostHandlePanic(ctx erpc.ReadCtx, recovered interface{}) (stat *erpc.Status) {
+	stack := goutil.PanicTrace(4)
+	erpc.Errorf("panic: %s %s(seq:%d): %v\n%s", ctx.IP(), ctx.ServiceMethod(), ctx.Seq(), recovered, stack)
+	stat = erpc.NewStatus(erpc.CodeInternalServerError, erpc.CodeText(erpc.CodeInternalServerError), recovered)
+	if r.withStack {
+		stat.TagStack(2)
+	}
+	if r.reporter != nil {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					erpc.Errorf("panic in recover reporter: %v", p)
+				}
+			}()
+			r.reporter(ctx, recovered, stack)
+		}()
+	}
+	return stat
+}
@@ -0,0 +1,49 @@
+package recoverer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/plugin/recoverer"
+)
+
+func panicCall(erpc.CallCtx, *string) (string, *erpc.Status) {
+	panic("something wrong")
+}
+
+func TestRecover(t *testing.T) {
+	var reported = make(chan interface{}, 1)
+	// Server
+	srv := erpc.NewPeer(
+		erpc.PeerConfig{ListenPort: 9090},
+		recoverer.New(true, func(ctx erpc.ReadCtx, recovered interface{}, stack []byte) {
+			t.Logf("report panic: %s %v", ctx.ServiceMethod(), recovered)
+			reported <- recovered
+		}),
+	)
+	srv.RouteCallFunc(panicCall)
+	go srv.ListenAndServe()
+	time.Sleep(1e9)
+
+	// Client
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	sess, stat := cli.Dial(":9090")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var result string
+	stat = sess.Call("/panic_call", "hi", &result).Status()
+	if stat.Code() != erpc.CodeInternalServerError {
+		t.Fatalf("expect code %d, got: %v", erpc.CodeInternalServerError, stat)
+	}
+	t.Logf("status: %v", stat)
+	select {
+	case r := <-reported:
+		if r != "something wrong" {
+			t.Fatalf("unexpected recovered value: %v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the reporter is not called")
+	}
+}
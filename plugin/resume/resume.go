@@ -0,0 +1,253 @@
+// Package resume is a plugin that resumes the logical session after the client redials.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package resume
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/goutil"
+)
+
+// ServiceMethod the service method of the resumption handshake
+const ServiceMethod = "/resume"
+
+// DefaultGracePeriod the default duration of keeping the state of the disconnected session
+const DefaultGracePeriod = time.Minute
+
+type (
+	// Args the resumption request sent by the client at each dial.
+	Args struct {
+		Token string `json:"token"`
+	}
+	// Result the resumption result replied by the server.
+	Result struct {
+		Token   string `json:"token"`
+		ID      string `json:"id"`
+		Resumed bool   `json:"resumed"`
+	}
+)
+
+// NewClientPlugin creates a resume plugin for client,
+// which sends the token issued by the server at each redial.
+// NOTE: The server must use the plugin created by NewServerPlugin.
+func NewClientPlugin(setting ...erpc.MessageSetting) erpc.Plugin {
+	return &clientPlugin{msgSetting: setting}
+}
+
+// NewServerPlugin creates a resume plugin for server,
+// which keeps the session id and Swap data of the disconnected session for the grace period,
+// and restores them to the new session that brings the token.
+// NOTE:
+//  If gracePeriod<=0, use DefaultGracePeriod;
+//  The labels and subscriptions of the session should be stored in the Swap to be resumed;
+//  The token is a bearer credential, use TLS on the untrusted network;
+//  The client must use the plugin created by NewClientPlugin.
+func NewServerPlugin(gracePeriod time.Duration, setting ...erpc.MessageSetting) erpc.Plugin {
+	if gracePeriod <= 0 {
+		gracePeriod = DefaultGracePeriod
+	}
+	return &serverPlugin{
+		gracePeriod: gracePeriod,
+		msgSetting:  setting,
+		tokens:      make(map[string]*state),
+		sessions:    make(map[interface{}]*state),
+	}
+}
+
+type clientPlugin struct {
+	msgSetting []erpc.MessageSetting
+	tokens     sync.Map // session -> token
+}
+
+var (
+	_ erpc.PostDialPlugin       = new(clientPlugin)
+	_ erpc.PostDisconnectPlugin = new(clientPlugin)
+)
+
+func (c *clientPlugin) Name() string {
+	return "resume-client"
+}
+
+func (c *clientPlugin) PostDial(sess erpc.PreSession, isRedial bool) *erpc.Status {
+	var args Args
+	if isRedial {
+		if token, ok := c.tokens.Load(sess); ok {
+			args.Token = token.(string)
+		}
+	}
+	stat := sess.PreSend(erpc.TypeCall, ServiceMethod, &args, nil, c.msgSetting...)
+	if !stat.OK() {
+		return stat
+	}
+	var result Result
+	retMsg := sess.PreReceive(func(header erpc.Header) interface{} {
+		if header.Mtype() != erpc.TypeReply || header.ServiceMethod() != ServiceMethod {
+			return nil
+		}
+		return &result
+	})
+	if !retMsg.StatusOK() {
+		return retMsg.Status()
+	}
+	if retMsg.Mtype() != erpc.TypeReply || retMsg.ServiceMethod() != ServiceMethod {
+		return erpc.NewStatus(
+			erpc.CodeBadMessage,
+			erpc.CodeText(erpc.CodeBadMessage),
+			fmt.Sprintf("resume message(1st) expect: REPLY %s, but received: %s %s",
+				ServiceMethod, erpc.TypeText(retMsg.Mtype()), retMsg.ServiceMethod()),
+		)
+	}
+	c.tokens.Store(sess, result.Token)
+	return nil
+}
+
+func (c *clientPlugin) PostDisconnect(sess erpc.BaseSession) *erpc.Status {
+	c.tokens.Delete(sess)
+	return nil
+}
+
+// state the resumable state of the logical session.
+type state struct {
+	token string
+	id    string
+	swap  goutil.Map
+	sess  interface{} // the connected session, nil means disconnected
+	timer *time.Timer
+}
+
+type serverPlugin struct {
+	gracePeriod time.Duration
+	msgSetting  []erpc.MessageSetting
+	mu          sync.Mutex
+	tokens      map[string]*state
+	sessions    map[interface{}]*state // the connected sessions
+}
+
+var (
+	_ erpc.PostAcceptPlugin     = new(serverPlugin)
+	_ erpc.PostDisconnectPlugin = new(serverPlugin)
+)
+
+func (s *serverPlugin) Name() string {
+	return "resume-server"
+}
+
+func (s *serverPlugin) PostAccept(sess erpc.PreSession) *erpc.Status {
+	var args Args
+	input := sess.PreReceive(func(header erpc.Header) interface{} {
+		if header.Mtype() != erpc.TypeCall || header.ServiceMethod() != ServiceMethod {
+			return nil
+		}
+		return &args
+	})
+	if !input.StatusOK() {
+		return input.Status()
+	}
+	if input.Mtype() != erpc.TypeCall || input.ServiceMethod() != ServiceMethod {
+		return erpc.NewStatus(
+			erpc.CodeBadMessage,
+			erpc.CodeText(erpc.CodeBadMessage),
+			fmt.Sprintf("resume message(1st) expect: CALL %s, but received: %s %s",
+				ServiceMethod, erpc.TypeText(input.Mtype()), input.ServiceMethod()),
+		)
+	}
+	st, old := s.claim(args.Token, sess)
+	if old != nil {
+		// the old connection is half-open, take over it
+		old.(interface{ Close() error }).Close()
+	}
+	result := Result{Token: st.token}
+	if st.swap != nil {
+		result.Resumed = true
+		swap := sess.Swap()
+		st.swap.Range(func(k, v interface{}) bool {
+			swap.Store(k, v)
+			return true
+		})
+		sess.SetID(st.id)
+	}
+	id := sess.(interface{ ID() string }).ID()
+	result.ID = id
+	stat := sess.PreSend(erpc.TypeReply, ServiceMethod, &result, nil, s.msgSetting...)
+	if !stat.OK() {
+		return stat
+	}
+	s.mu.Lock()
+	if st.sess == sess {
+		st.id, st.swap = id, sess.Swap()
+	}
+	s.mu.Unlock()
+	if result.Resumed {
+		sess.Infof("resume ok (addr:%s, id:%s)", sess.RemoteAddr().String(), id)
+	}
+	return nil
+}
+
+// claim binds the state of the token to the session, or a new state if the token is not found,
+// and returns the old session which is still connected.
+func (s *serverPlugin) claim(token string, sess erpc.PreSession) (*state, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.tokens[token]
+	if !ok {
+		st = &state{token: newToken()}
+		s.tokens[st.token] = st
+	}
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	old := st.sess
+	if old != nil {
+		delete(s.sessions, old)
+	}
+	st.sess = sess
+	s.sessions[sess] = st
+	return st, old
+}
+
+// PostDisconnect keeps the state of the session for the grace period.
+func (s *serverPlugin) PostDisconnect(sess erpc.BaseSession) *erpc.Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.sessions[sess]
+	if !ok {
+		return nil
+	}
+	delete(s.sessions, sess)
+	st.sess = nil
+	st.timer = time.AfterFunc(s.gracePeriod, func() {
+		s.mu.Lock()
+		if s.tokens[st.token] == st && st.sess == nil {
+			delete(s.tokens, st.token)
+		}
+		s.mu.Unlock()
+	})
+	return nil
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,75 @@
+package resume_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/plugin/resume"
+)
+
+type topic struct {
+	erpc.CallCtx
+}
+
+// Subscribe stores the topic in the Swap of the session.
+func (t *topic) Subscribe(name *string) (string, *erpc.Status) {
+	t.Session().Swap().Store("topic", *name)
+	return t.Session().ID(), nil
+}
+
+// Current returns the topic stored in the Swap of the session.
+func (t *topic) Current(*struct{}) (string, *erpc.Status) {
+	name, _ := t.Session().Swap().Load("topic")
+	s, _ := name.(string)
+	return s, nil
+}
+
+func TestResume(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{}, resume.NewServerPlugin(time.Second))
+	defer srv.Close()
+	srv.RouteCall(new(topic))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	time.Sleep(100 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{RedialTimes: 3}, resume.NewClientPlugin())
+	defer cli.Close()
+	sess, stat := cli.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var id string
+	if stat = sess.Call("/topic/subscribe", "news", &id).Status(); !stat.OK() {
+		t.Fatal(stat)
+	}
+
+	// break the connection, the client redials and resumes the session
+	srvSess, ok := srv.GetSession(id)
+	if !ok {
+		t.Fatalf("session %s not found", id)
+	}
+	srvSess.Close()
+	time.Sleep(300 * time.Millisecond)
+	var name string
+	if stat = sess.Call("/topic/current", nil, &name).Status(); !stat.OK() || name != "news" {
+		t.Fatalf("after redial: topic: %q, stat: %v", name, stat)
+	}
+	if _, ok = srv.GetSession(id); !ok {
+		t.Fatalf("the resumed session id is not %s", id)
+	}
+
+	// a new client gets a new logical session
+	sess2, stat := cli.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	name = ""
+	if stat = sess2.Call("/topic/current", nil, &name).Status(); !stat.OK() || name != "" {
+		t.Fatalf("new session: topic: %q, stat: %v", name, stat)
+	}
+}
@@ -0,0 +1,290 @@
+// Package signature is a plugin that signs the messages by HMAC with a shared secret, resisting the tampering and the replays.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/goutil"
+)
+
+// the metadata keys of the signature
+const (
+	MetaSignature = "X-Signature"
+	MetaKeyID     = "X-Signature-Key-Id"
+	MetaTimestamp = "X-Signature-Timestamp" // unix milliseconds
+	MetaNonce     = "X-Signature-Nonce"
+)
+
+const (
+	// DefaultWindow the default maximum difference between the signing time and the verifying time
+	DefaultWindow = 5 * time.Minute
+	// DefaultCapacity the default maximum number of the remembered nonces
+	DefaultCapacity = 100000
+)
+
+var (
+	// StatMissingSignature the status of the unsigned message, if Config.Required
+	StatMissingSignature = erpc.NewStatus(erpc.CodeUnauthorized, "Missing Signature", "")
+	// StatUnknownKey the status of the message signed by an unknown key
+	StatUnknownKey = erpc.NewStatus(erpc.CodeUnauthorized, "Unknown Signature Key", "")
+	// StatBadSignature the status of the message whose signature mismatches
+	StatBadSignature = erpc.NewStatus(erpc.CodeUnauthorized, "Bad Signature", "")
+	// StatStaleTimestamp the status of the message signed out of the freshness window
+	StatStaleTimestamp = erpc.NewStatus(erpc.CodeUnauthorized, "Stale Signature Timestamp", "")
+	// StatReplayedNonce the status of the message whose nonce is seen in the window
+	StatReplayedNonce = erpc.NewStatus(erpc.CodeUnauthorized, "Replayed Signature Nonce", "")
+	// StatNonceTableFull the status of the message verified when Config.Capacity nonces are remembered in twice the window,
+	// retryable after the oldest ones expire
+	StatNonceTableFull = erpc.NewStatus(erpc.CodeServiceUnavailable, "Signature Nonce Table Full", "")
+)
+
+// Config the signature config
+type Config struct {
+	// KeyID the id of Key sent by MetaKeyID, to select the key by Keys of the server
+	KeyID string
+	// Key the shared secret signing the sent CALL and PUSH, and verifying the received ones if Keys is nil;
+	// the sent messages are not signed if empty
+	Key []byte
+	// Keys looks up the shared secret by the key id of the received message, ok=false if unknown
+	Keys func(keyID string) (key []byte, ok bool)
+	// Required whether the unsigned CALL and PUSH are rejected, otherwise they are handled as usual
+	Required bool
+	// Window the maximum difference between the signing time and the verifying time, default DefaultWindow
+	Window time.Duration
+	// Capacity the maximum number of the remembered nonces, default DefaultCapacity;
+	// the messages are rejected by StatNonceTableFull while it is full, instead of forgetting the unexpired nonces
+	Capacity int
+}
+
+type nonceSeen struct {
+	nonce string
+	at    time.Time
+}
+
+// Signer the signature plugin, signing the sent CALL and PUSH by HMAC-SHA256 of the service method, body codec,
+// timestamp, nonce and body, and verifying the received ones with the freshness window and the nonce uniqueness.
+// NOTE:
+//  The rejected CALL is replied with the status, and the rejected PUSH is dropped;
+//  The nonces are remembered for twice the window, so that a replay is either stale or seen;
+//  Only the fields above are signed, the other metadata (e.g. the auth token or the tenant) is not covered,
+//  so do not trust it without TLS, or carry it in the body;
+//  It is registered after the plugins changing the body, e.g. plugin/secure, to sign the sent bytes.
+type Signer struct {
+	keyID    string
+	key      []byte
+	keys     func(string) ([]byte, bool)
+	required bool
+	window   time.Duration
+	capacity int
+	mu       sync.Mutex
+	seen     map[string]time.Time
+	queue    []nonceSeen // in the order of seen
+}
+
+var (
+	_ erpc.PreWriteCallPlugin     = (*Signer)(nil)
+	_ erpc.PreWritePushPlugin     = (*Signer)(nil)
+	_ erpc.PreReadCallBodyPlugin  = (*Signer)(nil)
+	_ erpc.PostReadCallBodyPlugin = (*Signer)(nil)
+	_ erpc.PreReadPushBodyPlugin  = (*Signer)(nil)
+	_ erpc.PostReadPushBodyPlugin = (*Signer)(nil)
+)
+
+// New creates a signature plugin.
+func New(cfg Config) *Signer {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultWindow
+	}
+	if cfg.Capacity <= 0 {
+		cfg.Capacity = DefaultCapacity
+	}
+	if cfg.Keys == nil {
+		key := cfg.Key
+		cfg.Keys = func(string) ([]byte, bool) { return key, len(key) > 0 }
+	}
+	return &Signer{
+		keyID:    cfg.KeyID,
+		key:      cfg.Key,
+		keys:     cfg.Keys,
+		required: cfg.Required,
+		window:   cfg.Window,
+		capacity: cfg.Capacity,
+		seen:     make(map[string]time.Time),
+	}
+}
+
+// Name returns the plugin name.
+func (s *Signer) Name() string {
+	return "signature"
+}
+
+// Sign returns the signature of the message fields.
+func Sign(key []byte, serviceMethod string, bodyCodec byte, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(serviceMethod))
+	mac.Write([]byte{0, bodyCodec, 0})
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{0})
+	mac.Write([]byte(nonce))
+	mac.Write([]byte{0})
+	mac.Write(body)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// PreWriteCall signs the CALL.
+func (s *Signer) PreWriteCall(ctx erpc.WriteCtx) *erpc.Status {
+	if len(s.key) == 0 {
+		return nil
+	}
+	output := ctx.Output()
+	body, err := output.MarshalBody()
+	if err != nil {
+		return erpc.NewStatus(erpc.CodeBadMessage, erpc.CodeText(erpc.CodeBadMessage), err)
+	}
+	// reuse the encoded body, instead of encoding it again by the socket
+	output.SetBody(body)
+	var b [16]byte
+	if _, err = rand.Read(b[:]); err != nil {
+		return erpc.NewStatus(erpc.CodeInternalServerError, erpc.CodeText(erpc.CodeInternalServerError), err)
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b[:])
+	timestamp := strconv.FormatInt(ctx.Peer().Clock().Now().UnixNano()/int64(time.Millisecond), 10)
+	meta := output.Meta()
+	if s.keyID != "" {
+		meta.Set(MetaKeyID, s.keyID)
+	}
+	meta.Set(MetaTimestamp, timestamp)
+	meta.Set(MetaNonce, nonce)
+	meta.Set(MetaSignature, Sign(s.key, output.ServiceMethod(), output.BodyCodec(), timestamp, nonce, body))
+	return nil
+}
+
+// PreWritePush signs the PUSH.
+func (s *Signer) PreWritePush(ctx erpc.WriteCtx) *erpc.Status {
+	return s.PreWriteCall(ctx)
+}
+
+// swapBody the swap key of the body receiver, which is replaced by the raw bytes until verified
+const swapBody = "erpc-signature-body"
+
+// PreReadCallBody reads the body of the signed CALL as the raw bytes, and rejects the unsigned one if Config.Required.
+func (s *Signer) PreReadCallBody(ctx erpc.ReadCtx) *erpc.Status {
+	if len(ctx.PeekMeta(MetaSignature)) == 0 {
+		if s.required {
+			return StatMissingSignature
+		}
+		return nil
+	}
+	input := ctx.Input()
+	ctx.Swap().Store(swapBody, input.Body())
+	input.SetBody(new([]byte))
+	return nil
+}
+
+// PostReadCallBody verifies the signed CALL, and then unmarshals the raw bytes to the body receiver.
+func (s *Signer) PostReadCallBody(ctx erpc.ReadCtx) *erpc.Status {
+	body, ok := ctx.Swap().Load(swapBody)
+	if !ok {
+		return nil
+	}
+	ctx.Swap().Delete(swapBody)
+	input := ctx.Input()
+	raw := *input.Body().(*[]byte)
+	if stat := s.verify(ctx, raw); !stat.OK() {
+		return stat
+	}
+	input.SetBody(body)
+	if err := input.UnmarshalBody(raw); err != nil {
+		return erpc.NewStatus(erpc.CodeBadMessage, erpc.CodeText(erpc.CodeBadMessage), err)
+	}
+	return nil
+}
+
+// PreReadPushBody reads the body of the signed PUSH as the raw bytes, and drops the unsigned one if Config.Required.
+func (s *Signer) PreReadPushBody(ctx erpc.ReadCtx) *erpc.Status {
+	return s.PreReadCallBody(ctx)
+}
+
+// PostReadPushBody verifies the signed PUSH, and then unmarshals the raw bytes to the body receiver.
+func (s *Signer) PostReadPushBody(ctx erpc.ReadCtx) *erpc.Status {
+	return s.PostReadCallBody(ctx)
+}
+
+func (s *Signer) verify(ctx erpc.ReadCtx, body []byte) *erpc.Status {
+	keyID := goutil.BytesToString(ctx.PeekMeta(MetaKeyID))
+	key, ok := s.keys(keyID)
+	if !ok {
+		return StatUnknownKey.Copy(keyID)
+	}
+	timestamp := string(ctx.PeekMeta(MetaTimestamp))
+	nonce := string(ctx.PeekMeta(MetaNonce))
+	sig := Sign(key, ctx.ServiceMethod(), ctx.Input().BodyCodec(), timestamp, nonce, body)
+	if !hmac.Equal([]byte(sig), ctx.PeekMeta(MetaSignature)) {
+		return StatBadSignature
+	}
+	ms, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return StatStaleTimestamp.Copy(err)
+	}
+	now := ctx.Peer().Clock().Now()
+	if d := now.Sub(time.Unix(0, ms*int64(time.Millisecond))); d > s.window || d < -s.window {
+		return StatStaleTimestamp.Copy(d.String())
+	}
+	if nonce == "" {
+		return StatReplayedNonce.Copy("empty nonce")
+	}
+	return s.remember(keyID+"\x00"+nonce, now)
+}
+
+// remember remembers the nonce, returns StatReplayedNonce if it is seen,
+// or StatNonceTableFull if the capacity is reached by the unexpired nonces.
+func (s *Signer) remember(nonce string, now time.Time) *erpc.Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var i int
+	for ; i < len(s.queue); i++ {
+		if now.Sub(s.queue[i].at) < 2*s.window {
+			break
+		}
+		delete(s.seen, s.queue[i].nonce)
+		s.queue[i] = nonceSeen{}
+	}
+	s.queue = s.queue[i:]
+	if _, ok := s.seen[nonce]; ok {
+		return StatReplayedNonce
+	}
+	if len(s.seen) >= s.capacity {
+		return StatNonceTableFull
+	}
+	s.seen[nonce] = now
+	s.queue = append(s.queue, nonceSeen{nonce: nonce, at: now})
+	return nil
+}
+
+// Len returns the number of the remembered nonces.
+func (s *Signer) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.seen)
+}
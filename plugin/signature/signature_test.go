@@ -0,0 +1,131 @@
+package signature
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+func echo(ctx erpc.CallCtx, arg *string) (string, *erpc.Status) {
+	return *arg, nil
+}
+
+// replay resends the signed metadata of the first CALL.
+type replay struct {
+	meta map[string]string
+}
+
+func (r *replay) Name() string { return "replay" }
+
+func (r *replay) PreWriteCall(ctx erpc.WriteCtx) *erpc.Status {
+	meta := ctx.Output().Meta()
+	if r.meta == nil {
+		r.meta = make(map[string]string)
+		for _, k := range []string{MetaTimestamp, MetaNonce, MetaSignature} {
+			r.meta[k] = string(meta.Peek(k))
+		}
+		return nil
+	}
+	for k, v := range r.meta {
+		meta.Set(k, v)
+	}
+	return nil
+}
+
+func TestSignature(t *testing.T) {
+	keys := map[string][]byte{"k1": []byte("secret")}
+	srv := erpc.NewPeer(erpc.PeerConfig{}, New(Config{
+		Required: true,
+		Window:   time.Second,
+		Keys: func(id string) ([]byte, bool) {
+			key, ok := keys[id]
+			return key, ok
+		},
+	}))
+	defer srv.Close()
+	srv.RouteCallFunc(echo)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	time.Sleep(100 * time.Millisecond)
+
+	call := func(cli erpc.Peer, arg string) (string, *erpc.Status) {
+		sess, stat := cli.Dial(lis.Addr().String())
+		if !stat.OK() {
+			t.Fatal(stat)
+		}
+		var reply string
+		stat = sess.Call("/echo", arg, &reply).Status()
+		return reply, stat
+	}
+
+	cli := erpc.NewPeer(erpc.PeerConfig{}, New(Config{KeyID: "k1", Key: []byte("secret")}))
+	defer cli.Close()
+	if reply, stat := call(cli, "hello"); !stat.OK() || reply != "hello" {
+		t.Fatalf("reply: %q, stat: %v", reply, stat)
+	}
+
+	cases := []struct {
+		name   string
+		plugin erpc.Plugin
+		msg    string
+	}{
+		{"unsigned", nil, StatMissingSignature.Msg()},
+		{"unknown key", New(Config{KeyID: "k2", Key: []byte("secret")}), StatUnknownKey.Msg()},
+		{"wrong key", New(Config{KeyID: "k1", Key: []byte("wrong")}), StatBadSignature.Msg()},
+	}
+	for _, c := range cases {
+		var plugins []erpc.Plugin
+		if c.plugin != nil {
+			plugins = append(plugins, c.plugin)
+		}
+		other := erpc.NewPeer(erpc.PeerConfig{}, plugins...)
+		if _, stat := call(other, "hello"); stat.Msg() != c.msg {
+			t.Fatalf("%s: expect %q, got %v", c.name, c.msg, stat)
+		}
+		other.Close()
+	}
+
+	// the replay of the same nonce is rejected, and it is stale after the window
+	r := new(replay)
+	replayer := erpc.NewPeer(erpc.PeerConfig{}, New(Config{KeyID: "k1", Key: []byte("secret")}), r)
+	defer replayer.Close()
+	if _, stat := call(replayer, "hello"); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if _, stat := call(replayer, "hello"); stat.Msg() != StatReplayedNonce.Msg() {
+		t.Fatalf("expect replayed, got %v", stat)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if _, stat := call(replayer, "hello"); stat.Msg() != StatStaleTimestamp.Msg() {
+		t.Fatalf("expect stale, got %v", stat)
+	}
+}
+
+func TestNonceTableFull(t *testing.T) {
+	s := New(Config{Window: time.Second, Capacity: 2})
+	now := time.Now()
+	for _, nonce := range []string{"a", "b"} {
+		if stat := s.remember(nonce, now); !stat.OK() {
+			t.Fatal(stat)
+		}
+	}
+	// the unexpired nonces are kept, and the new one is rejected as retryable
+	if stat := s.remember("c", now.Add(time.Second)); stat.Code() != erpc.CodeServiceUnavailable {
+		t.Fatalf("expect full, got %v", stat)
+	}
+	if stat := s.remember("a", now.Add(time.Second)); stat.Msg() != StatReplayedNonce.Msg() {
+		t.Fatalf("expect replayed, got %v", stat)
+	}
+	// accepted after the oldest ones expire
+	if stat := s.remember("c", now.Add(2*time.Second)); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if n := s.Len(); n != 1 {
+		t.Fatalf("len: %d", n)
+	}
+}
@@ -0,0 +1,164 @@
+// Package validator is a plugin that validates the decoded arguments before handling.
+package validator
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/andeya/erpc/v7"
+)
+
+type (
+	// Validator is implemented by the argument type that validates itself.
+	Validator interface {
+		Validate() error
+	}
+	// StructValidator validates a struct by its tags,
+	// e.g. *validator.Validate of github.com/go-playground/validator.
+	StructValidator interface {
+		Struct(s interface{}) error
+	}
+	// FieldError a validation error of the field.
+	FieldError struct {
+		Field   string `json:"field,omitempty"`
+		Rule    string `json:"rule,omitempty"`
+		Param   string `json:"param,omitempty"`
+		Message string `json:"message"`
+	}
+	// FieldErrors a list of field errors, it can be returned by Validator.Validate.
+	FieldErrors []FieldError
+)
+
+// Error implements error interface.
+func (f FieldErrors) Error() string {
+	a := make([]string, len(f))
+	for i, e := range f {
+		if e.Field != "" {
+			a[i] = e.Field + ": " + e.Message
+		} else {
+			a[i] = e.Message
+		}
+	}
+	return strings.Join(a, "; ")
+}
+
+// MsgInvalidArgument the message of the validation failed status.
+const MsgInvalidArgument = "Invalid Argument"
+
+// New creates a plugin that validates the CALL and PUSH arguments after reading body.
+// The argument is validated by the engine first (if not nil),
+// and then by its Validate method (if implements Validator).
+// If failed, returns erpc.CodeBadMessage status whose cause is FieldErrors JSON.
+// NOTE:
+//  It can be enabled per peer or per route.
+func New(engine StructValidator) erpc.Plugin {
+	return &validatorPlugin{engine: engine}
+}
+
+type validatorPlugin struct {
+	engine StructValidator
+}
+
+var (
+	_ erpc.PostReadCallBodyPlugin = new(validatorPlugin)
+	_ erpc.PostReadPushBodyPlugin = new(validatorPlugin)
+)
+
+func (v *validatorPlugin) Name() string {
+	return "validator"
+}
+
+func (v *validatorPlugin) PostReadCallBody(ctx erpc.ReadCtx) *erpc.Status {
+	return v.validate(ctx.Input().Body())
+}
+
+func (v *validatorPlugin) PostReadPushBody(ctx erpc.ReadCtx) *erpc.Status {
+	return v.validate(ctx.Input().Body())
+}
+
+func (v *validatorPlugin) validate(arg interface{}) *erpc.Status {
+	if arg == nil {
+		return nil
+	}
+	if v.engine != nil && isStruct(arg) {
+		if err := v.engine.Struct(arg); err != nil {
+			return newStatus(err)
+		}
+	}
+	if a, ok := arg.(Validator); ok {
+		if err := a.Validate(); err != nil {
+			return newStatus(err)
+		}
+	}
+	return nil
+}
+
+func isStruct(arg interface{}) bool {
+	t := reflect.TypeOf(arg)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// newStatus creates a validation failed status.
+func newStatus(err error) *erpc.Status {
+	b, _ := json.Marshal(toFieldErrors(err))
+	return erpc.NewStatus(erpc.CodeBadMessage, MsgInvalidArgument, string(b))
+}
+
+type fieldErrorLike interface {
+	Field() string
+	Tag() string
+	Param() string
+	Error() string
+}
+
+func toFieldErrors(err error) FieldErrors {
+	switch e := err.(type) {
+	case FieldErrors:
+		return e
+	case *FieldError:
+		return FieldErrors{*e}
+	}
+	// e.g. validator.ValidationErrors
+	if rv := reflect.ValueOf(err); rv.Kind() == reflect.Slice {
+		var errs FieldErrors
+		for i := 0; i < rv.Len(); i++ {
+			fe, ok := rv.Index(i).Interface().(fieldErrorLike)
+			if !ok {
+				errs = nil
+				break
+			}
+			errs = append(errs, FieldError{
+				Field:   fe.Field(),
+				Rule:    fe.Tag(),
+				Param:   fe.Param(),
+				Message: fe.Error(),
+			})
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+	}
+	return FieldErrors{{Message: err.Error()}}
+}
+
+// Error implements error interface.
+func (f *FieldError) Error() string {
+	return FieldErrors{*f}.Error()
+}
+
+// ParseFieldErrors parses the field errors from the validation failed status.
+// If it is not a validation failed status, returns nil.
+func ParseFieldErrors(stat *erpc.Status) FieldErrors {
+	if stat.Code() != erpc.CodeBadMessage || stat.Msg() != MsgInvalidArgument || stat.Cause() == nil {
+		return nil
+	}
+	var errs FieldErrors
+	if json.Unmarshal([]byte(stat.Cause().Error()), &errs) != nil {
+		return nil
+	}
+	return errs
+}
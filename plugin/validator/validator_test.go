@@ -0,0 +1,86 @@
+package validator_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/plugin/validator"
+	"github.com/stretchr/testify/assert"
+)
+
+type Arg struct {
+	Name string `validate:"required"`
+	Age  int
+}
+
+func (a *Arg) Validate() error {
+	if a.Age < 0 || a.Age > 150 {
+		return validator.FieldErrors{{Field: "Age", Rule: "range", Message: "out of range [0,150]"}}
+	}
+	return nil
+}
+
+type Home struct {
+	erpc.CallCtx
+}
+
+func (h *Home) Test(arg *Arg) (string, *erpc.Status) {
+	return "hello " + arg.Name, nil
+}
+
+// requiredEngine is a tiny tag-based engine in the style of go-playground/validator.
+type requiredEngine struct{}
+
+type fieldErr struct{ field string }
+
+func (f fieldErr) Field() string { return f.field }
+func (f fieldErr) Tag() string   { return "required" }
+func (f fieldErr) Param() string { return "" }
+func (f fieldErr) Error() string { return f.field + " is required" }
+
+type fieldErrs []fieldErr
+
+func (f fieldErrs) Error() string { return "validation failed" }
+
+func (requiredEngine) Struct(s interface{}) error {
+	v := reflect.ValueOf(s).Elem()
+	var errs fieldErrs
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("validate") == "required" && v.Field(i).IsZero() {
+			errs = append(errs, fieldErr{field: v.Type().Field(i).Name})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func TestValidator(t *testing.T) {
+	// Server
+	srv := erpc.NewPeer(erpc.PeerConfig{ListenPort: 9090})
+	srv.RouteCall(new(Home), validator.New(requiredEngine{}))
+	go srv.ListenAndServe()
+	time.Sleep(1e9)
+
+	// Client
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	sess, stat := cli.Dial(":9090")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var result string
+	stat = sess.Call("/home/test", &Arg{Name: "andeya", Age: 18}, &result).Status()
+	assert.True(t, stat.OK(), stat)
+	assert.Equal(t, "hello andeya", result)
+
+	stat = sess.Call("/home/test", &Arg{Age: 18}, &result).Status()
+	assert.Equal(t, erpc.CodeBadMessage, stat.Code())
+	assert.Equal(t, validator.FieldErrors{{Field: "Name", Rule: "required", Message: "Name is required"}}, validator.ParseFieldErrors(stat))
+
+	stat = sess.Call("/home/test", &Arg{Name: "andeya", Age: 200}, &result).Status()
+	assert.Equal(t, validator.FieldErrors{{Field: "Age", Rule: "range", Message: "out of range [0,150]"}}, validator.ParseFieldErrors(stat))
+	t.Logf("status: %v", stat)
+}
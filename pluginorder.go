@@ -0,0 +1,242 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/andeya/goutil/errors"
+)
+
+type (
+	// OrderedPlugin declares the order of the plugin in the container, and the plugins it conflicts with.
+	// NOTE:
+	//  The plugins without the declaration keep the order of appending;
+	//  The order is applied to all the hooks of the plugin.
+	OrderedPlugin interface {
+		Plugin
+		PluginOrder() PluginOrder
+	}
+	// PluginOrder the order declaration of the plugin.
+	PluginOrder struct {
+		// Priority the smaller is executed earlier, the plugins without the declaration are 0
+		Priority int
+		// After the names of the plugins that must be executed before it, which take precedence over Priority
+		After []string
+		// Conflicts the names of the plugins that cannot be used together with it,
+		// e.g. the ones hooking the same phase for the same purpose
+		Conflicts []string
+	}
+	// InitPlugin is executed by Peer.Start, before any StartPlugin.
+	InitPlugin interface {
+		Plugin
+		Init(Peer) error
+	}
+	// StartPlugin is executed by Peer.Start, after all the InitPlugins.
+	StartPlugin interface {
+		Plugin
+		Start() error
+	}
+	// StopPlugin is executed by Peer.Close in the reverse order, if the peer is started.
+	StopPlugin interface {
+		Plugin
+		Stop() error
+	}
+)
+
+// pluginOrder returns the order declaration of the plugin.
+func pluginOrder(plugin Plugin) PluginOrder {
+	if o, ok := plugin.(OrderedPlugin); ok {
+		return o.PluginOrder()
+	}
+	return PluginOrder{}
+}
+
+// sortPlugins sorts the plugins by PluginOrder, stable for the same priority.
+// NOTE: The plugins in a cycle of After are sorted only by priority, see PluginContainer.Validate.
+func sortPlugins(plugins []Plugin) []Plugin {
+	var ordered bool
+	for _, plugin := range plugins {
+		if _, ok := plugin.(OrderedPlugin); ok {
+			ordered = true
+			break
+		}
+	}
+	if !ordered {
+		return plugins
+	}
+	var (
+		n        = len(plugins)
+		orders   = make([]PluginOrder, n)
+		index    = make(map[string]int, n)
+		pending  = make([]int, n) // the number of the plugins not yet sorted that must be executed before it
+		next     = make([][]int, n)
+		done     = make([]bool, n)
+		sorted   = make([]Plugin, 0, n)
+		lessThan = func(i, j int) bool {
+			if orders[i].Priority != orders[j].Priority {
+				return orders[i].Priority < orders[j].Priority
+			}
+			return i < j
+		}
+	)
+	for i, plugin := range plugins {
+		orders[i] = pluginOrder(plugin)
+		index[plugin.Name()] = i
+	}
+	for i := range plugins {
+		for _, name := range orders[i].After {
+			if j, ok := index[name]; ok && j != i {
+				pending[i]++
+				next[j] = append(next[j], i)
+			}
+		}
+	}
+	for len(sorted) < n {
+		pick := -1
+		for i := 0; i < n; i++ {
+			if !done[i] && pending[i] == 0 && (pick < 0 || lessThan(i, pick)) {
+				pick = i
+			}
+		}
+		if pick < 0 {
+			// a cycle, sort the rest by priority
+			rest := make([]int, 0, n-len(sorted))
+			for i := 0; i < n; i++ {
+				if !done[i] {
+					rest = append(rest, i)
+				}
+			}
+			sort.SliceStable(rest, func(a, b int) bool { return lessThan(rest[a], rest[b]) })
+			for _, i := range rest {
+				sorted = append(sorted, plugins[i])
+			}
+			break
+		}
+		done[pick] = true
+		sorted = append(sorted, plugins[pick])
+		for _, i := range next[pick] {
+			pending[i]--
+		}
+	}
+	return sorted
+}
+
+// Validate checks the order declarations of the plugins,
+// i.e. the unknown or cyclic After plugins, and the conflicting plugins.
+// NOTE: It is executed by Peer.Start for the peer plugins.
+func (p *PluginContainer) Validate() error {
+	var (
+		plugins = p.GetAll()
+		index   = make(map[string]int, len(plugins))
+		errs    []string
+	)
+	for i, plugin := range plugins {
+		index[plugin.Name()] = i
+	}
+	for i, plugin := range plugins {
+		o := pluginOrder(plugin)
+		for _, name := range o.After {
+			j, ok := index[name]
+			if !ok {
+				errs = append(errs, "plugin "+plugin.Name()+" must be after the unknown plugin "+name)
+			} else if j > i {
+				errs = append(errs, "plugin "+plugin.Name()+" must be after "+name+", but they are in a cycle")
+			}
+		}
+		for _, name := range o.Conflicts {
+			if _, ok := index[name]; ok {
+				errs = append(errs, "plugin "+plugin.Name()+" conflicts with "+name)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New("invalid plugins: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// pluginLifecycle the Init, Start and Stop phases of the peer plugins.
+type pluginLifecycle struct {
+	mu      sync.Mutex
+	started []StopPlugin // the started plugins to stop, nil if the peer is not started
+	once    bool
+	err     error
+}
+
+// Start validates the peer plugins, and executes the InitPlugins and then the StartPlugins in order.
+// NOTE:
+//  It is executed only once, and by ListenAndServe, ServeListener and ListenOn automatically;
+//  If a plugin fails, the started StopPlugins are stopped in the reverse order, and the error is returned.
+func (p *peer) Start() error {
+	l := &p.lifecycle
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.once {
+		return l.err
+	}
+	l.once = true
+	l.err = p.startPlugins()
+	return l.err
+}
+
+func (p *peer) startPlugins() error {
+	if err := p.pluginContainer.Validate(); err != nil {
+		return err
+	}
+	plugins := p.pluginContainer.GetAll()
+	for _, plugin := range plugins {
+		if _plugin, ok := plugin.(InitPlugin); ok {
+			if err := _plugin.Init(p); err != nil {
+				return errors.Errorf("[InitPlugin:%s] %s", plugin.Name(), err.Error())
+			}
+		}
+	}
+	var started []StopPlugin
+	for _, plugin := range plugins {
+		if _plugin, ok := plugin.(StartPlugin); ok {
+			if err := _plugin.Start(); err != nil {
+				err = errors.Errorf("[StartPlugin:%s] %s", plugin.Name(), err.Error())
+				return errors.Merge(err, stopPlugins(started))
+			}
+		}
+		if _plugin, ok := plugin.(StopPlugin); ok {
+			started = append(started, _plugin)
+		}
+	}
+	p.lifecycle.started = started
+	return nil
+}
+
+// stopPlugins executes the StopPlugins of the started peer in the reverse order.
+func (p *peer) stopPlugins() error {
+	l := &p.lifecycle
+	l.mu.Lock()
+	started := l.started
+	l.started = nil
+	l.mu.Unlock()
+	return stopPlugins(started)
+}
+
+func stopPlugins(started []StopPlugin) (err error) {
+	for i := len(started) - 1; i >= 0; i-- {
+		if e := started[i].Stop(); e != nil {
+			err = errors.Merge(err, errors.Errorf("[StopPlugin:%s] %s", started[i].Name(), e.Error()))
+		}
+	}
+	return err
+}
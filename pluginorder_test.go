@@ -0,0 +1,104 @@
+package erpc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type lifecyclePlugin struct {
+	name      string
+	order     PluginOrder
+	log       *[]string
+	failStart bool
+}
+
+func (p *lifecyclePlugin) Name() string             { return p.name }
+func (p *lifecyclePlugin) PluginOrder() PluginOrder { return p.order }
+func (p *lifecyclePlugin) Init(Peer) error {
+	*p.log = append(*p.log, "init:"+p.name)
+	return nil
+}
+func (p *lifecyclePlugin) Start() error {
+	if p.failStart {
+		return errors.New("failed")
+	}
+	*p.log = append(*p.log, "start:"+p.name)
+	return nil
+}
+func (p *lifecyclePlugin) Stop() error {
+	*p.log = append(*p.log, "stop:"+p.name)
+	return nil
+}
+
+func pluginNames(plugins []Plugin) string {
+	names := make([]string, len(plugins))
+	for i, plugin := range plugins {
+		names[i] = plugin.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func TestPluginOrder(t *testing.T) {
+	var log []string
+	srv := NewPeer(PeerConfig{},
+		&lifecyclePlugin{name: "a", log: &log},
+		&lifecyclePlugin{name: "b", log: &log, order: PluginOrder{After: []string{"c"}}},
+		&lifecyclePlugin{name: "c", log: &log, order: PluginOrder{Priority: -1}},
+		&lifecyclePlugin{name: "d", log: &log, order: PluginOrder{Priority: 1}},
+	)
+	if names := pluginNames(srv.PluginContainer().GetAll()); names != "c,a,b,d" {
+		t.Fatalf("plugins: %s", names)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	const expect = "init:c,init:a,init:b,init:d,start:c,start:a,start:b,start:d,stop:d,stop:b,stop:a,stop:c"
+	if strings.Join(log, ",") != expect {
+		t.Fatalf("lifecycle: %v", log)
+	}
+
+	// the started plugins are stopped if one fails
+	log = nil
+	srv = NewPeer(PeerConfig{},
+		&lifecyclePlugin{name: "a", log: &log},
+		&lifecyclePlugin{name: "b", log: &log, failStart: true},
+		&lifecyclePlugin{name: "c", log: &log},
+	)
+	err := srv.Start()
+	if err == nil || !strings.Contains(err.Error(), "[StartPlugin:b] failed") {
+		t.Fatalf("start: %v", err)
+	}
+	if err2 := srv.ListenAndServe(); err2 != err {
+		t.Fatalf("expect the start error of ListenAndServe, got %v", err2)
+	}
+	srv.Close()
+	if strings.Join(log, ",") != "init:a,init:b,init:c,start:a,stop:a" {
+		t.Fatalf("lifecycle: %v", log)
+	}
+}
+
+func TestPluginValidate(t *testing.T) {
+	var log []string
+	srv := NewPeer(PeerConfig{},
+		&lifecyclePlugin{name: "a", log: &log, order: PluginOrder{After: []string{"b"}}},
+		&lifecyclePlugin{name: "b", log: &log, order: PluginOrder{After: []string{"a"}, Conflicts: []string{"c"}}},
+		&lifecyclePlugin{name: "c", log: &log, order: PluginOrder{After: []string{"x"}}},
+	)
+	defer srv.Close()
+	err := srv.PluginContainer().Validate()
+	if err == nil {
+		t.Fatal("expect the invalid plugins")
+	}
+	for _, s := range []string{"after the unknown plugin x", "they are in a cycle", "b conflicts with c"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Fatalf("expect %q in %v", s, err)
+		}
+	}
+	if err = srv.Start(); err == nil || len(log) != 0 {
+		t.Fatalf("expect the invalid plugins not started, got %v, %v", err, log)
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andeya/erpc/v7/socket"
+	"github.com/andeya/erpc/v7/utils"
+	"github.com/andeya/goutil"
+)
+
+// Message priority levels
+const (
+	PriorityLow    byte = 0
+	PriorityNormal byte = 1 // default
+	PriorityHigh   byte = 2
+	PriorityUrgent byte = 3
+)
+
+// MetaPriority the key of message priority level
+const MetaPriority = "X-Priority"
+
+// WithPriority sets the message priority level.
+// Messages with higher priority jump ahead of lower ones in the session write queue,
+// and in the handler worker pool of the receiver (see PeerConfig.HandlerWorkers).
+// The reply of a CALL inherits the priority of the CALL.
+// NOTE: The level greater than PriorityUrgent is treated as PriorityUrgent.
+func WithPriority(level byte) MessageSetting {
+	if level > PriorityUrgent {
+		level = PriorityUrgent
+	}
+	if level == PriorityNormal {
+		return socket.WithDelMeta(MetaPriority)
+	}
+	return socket.WithSetMeta(MetaPriority, strconv.FormatUint(uint64(level), 10))
+}
+
+// GetPriority gets the message priority level from metadata.
+// If not set or invalid, returns PriorityNormal.
+func GetPriority(meta *utils.Args) byte {
+	s := meta.Peek(MetaPriority)
+	if len(s) != 1 {
+		return PriorityNormal
+	}
+	b, err := strconv.ParseUint(goutil.BytesToString(s), 10, 8)
+	if err != nil || byte(b) > PriorityUrgent {
+		return PriorityNormal
+	}
+	return byte(b)
+}
+
+var priorityAging = int64(100 * time.Millisecond)
+
+// SetPriorityAging sets the waiting duration for which a queued message is
+// promoted by one priority level, to prevent starvation of low priority messages.
+// If agingDuration<=0, strict priority is used.
+// NOTE: the default is 100ms.
+func SetPriorityAging(agingDuration time.Duration) {
+	atomic.StoreInt64(&priorityAging, int64(agingDuration))
+}
+
+type (
+	// priorityQueue is a queue ordered by the effective priority,
+	// which is the level plus the promotion of waiting time; ties are FIFO.
+	// NOTE: not concurrent safe.
+	priorityQueue struct {
+		items []*priorityItem
+		seq   uint64
+	}
+	priorityItem struct {
+		level    byte
+		enqueued int64
+		seq      uint64
+		value    interface{}
+	}
+)
+
+func (q *priorityQueue) len() int {
+	return len(q.items)
+}
+
+func (q *priorityQueue) push(level byte, value interface{}) *priorityItem {
+	q.seq++
+	item := &priorityItem{
+		level:    level,
+		enqueued: time.Now().UnixNano(),
+		seq:      q.seq,
+		value:    value,
+	}
+	q.items = append(q.items, item)
+	return item
+}
+
+// pop removes and returns the item with the highest effective priority.
+func (q *priorityQueue) pop() *priorityItem {
+	if len(q.items) == 0 {
+		return nil
+	}
+	var (
+		aging = atomic.LoadInt64(&priorityAging)
+		now   = time.Now().UnixNano()
+		best  int
+	)
+	score := func(it *priorityItem) int64 {
+		if aging <= 0 {
+			return int64(it.level)
+		}
+		return int64(it.level) + (now-it.enqueued)/aging
+	}
+	bestScore := score(q.items[0])
+	for i, it := range q.items[1:] {
+		if sc := score(it); sc > bestScore {
+			best, bestScore = i+1, sc
+		}
+	}
+	item := q.items[best]
+	q.removeAt(best)
+	return item
+}
+
+func (q *priorityQueue) remove(item *priorityItem) bool {
+	for i, it := range q.items {
+		if it == item {
+			q.removeAt(i)
+			return true
+		}
+	}
+	return false
+}
+
+func (q *priorityQueue) removeAt(i int) {
+	copy(q.items[i:], q.items[i+1:])
+	q.items[len(q.items)-1] = nil
+	q.items = q.items[:len(q.items)-1]
+}
+
+// priorityMutex is a mutual exclusion lock that is handed over to
+// the waiter with the highest effective priority when unlocked.
+type priorityMutex struct {
+	mu      sync.Mutex
+	locked  bool
+	waiters priorityQueue
+}
+
+// waiting returns the number of the waiters.
+func (m *priorityMutex) waiting() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.waiters.len()
+}
+
+// Lock locks m with the priority level, or returns the error if ctx is done.
+func (m *priorityMutex) Lock(ctx context.Context, level byte) error {
+	m.mu.Lock()
+	if !m.locked {
+		m.locked = true
+		m.mu.Unlock()
+		return nil
+	}
+	ch := make(chan struct{})
+	item := m.waiters.push(level, ch)
+	m.mu.Unlock()
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		m.mu.Lock()
+		removed := m.waiters.remove(item)
+		m.mu.Unlock()
+		if !removed {
+			// the lock has been handed over
+			<-ch
+			m.Unlock()
+		}
+		return ctx.Err()
+	}
+}
+
+// Unlock unlocks m.
+func (m *priorityMutex) Unlock() {
+	m.mu.Lock()
+	if item := m.waiters.pop(); item != nil {
+		close(item.value.(chan struct{}))
+	} else {
+		m.locked = false
+	}
+	m.mu.Unlock()
+}
+
+// workerPool runs the submitted functions with a fixed number of goroutines,
+// in order of the effective priority.
+type workerPool struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    priorityQueue
+	maxQueue int // unlimited when <=0
+	stopped  bool
+}
+
+func newWorkerPool(size int, maxQueue ...int) *workerPool {
+	p := new(workerPool)
+	p.cond = sync.NewCond(&p.mu)
+	if len(maxQueue) > 0 {
+		p.maxQueue = maxQueue[0]
+	}
+	for i := 0; i < size; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// queued returns the number of the functions waiting in the queue.
+func (p *workerPool) queued() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queue.len()
+}
+
+// submit returns false if the pool has been stopped or the queue is full.
+func (p *workerPool) submit(level byte, fn func()) bool {
+	p.mu.Lock()
+	if p.stopped || (p.maxQueue > 0 && p.queue.len() >= p.maxQueue) {
+		p.mu.Unlock()
+		return false
+	}
+	p.queue.push(level, fn)
+	p.cond.Signal()
+	p.mu.Unlock()
+	return true
+}
+
+func (p *workerPool) work() {
+	for {
+		p.mu.Lock()
+		for p.queue.len() == 0 && !p.stopped {
+			p.cond.Wait()
+		}
+		item := p.queue.pop()
+		p.mu.Unlock()
+		if item == nil {
+			return
+		}
+		item.value.(func())()
+	}
+}
+
+// stop stops the pool after the queued functions are executed.
+func (p *workerPool) stop() {
+	p.mu.Lock()
+	p.stopped = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
@@ -0,0 +1,96 @@
+package erpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriorityMeta(t *testing.T) {
+	m := GetMessage(WithPriority(PriorityUrgent))
+	assert.Equal(t, PriorityUrgent, GetPriority(m.Meta()))
+	WithPriority(PriorityNormal)(m)
+	assert.Equal(t, 0, m.Meta().Len())
+	assert.Equal(t, PriorityNormal, GetPriority(m.Meta()))
+	WithSetMeta(MetaPriority, "9")(m)
+	assert.Equal(t, PriorityNormal, GetPriority(m.Meta()))
+	PutMessage(m)
+}
+
+func TestPriorityMutex(t *testing.T) {
+	defer SetPriorityAging(100 * time.Millisecond)
+	SetPriorityAging(0)
+
+	var (
+		m     priorityMutex
+		mu    sync.Mutex
+		order []byte
+		wg    sync.WaitGroup
+		ctx   = context.Background()
+	)
+	assert.NoError(t, m.Lock(ctx, PriorityNormal))
+	for _, level := range []byte{PriorityLow, PriorityNormal, PriorityUrgent, PriorityHigh} {
+		wg.Add(1)
+		go func(level byte) {
+			defer wg.Done()
+			m.Lock(ctx, level)
+			mu.Lock()
+			order = append(order, level)
+			mu.Unlock()
+			m.Unlock()
+		}(level)
+		time.Sleep(10 * time.Millisecond)
+	}
+	m.Unlock()
+	wg.Wait()
+	assert.Equal(t, []byte{PriorityUrgent, PriorityHigh, PriorityNormal, PriorityLow}, order)
+
+	// canceled waiter
+	assert.NoError(t, m.Lock(ctx, PriorityNormal))
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, m.Lock(cctx, PriorityUrgent))
+	m.Unlock()
+	assert.NoError(t, m.Lock(ctx, PriorityLow))
+	m.Unlock()
+}
+
+func TestPriorityAging(t *testing.T) {
+	defer SetPriorityAging(100 * time.Millisecond)
+	SetPriorityAging(10 * time.Millisecond)
+
+	var q priorityQueue
+	q.push(PriorityLow, "low")
+	time.Sleep(50 * time.Millisecond)
+	q.push(PriorityUrgent, "urgent")
+	assert.Equal(t, "low", q.pop().value)
+	assert.Equal(t, "urgent", q.pop().value)
+	assert.Nil(t, q.pop())
+}
+
+func TestWorkerPool(t *testing.T) {
+	defer SetPriorityAging(100 * time.Millisecond)
+	SetPriorityAging(0)
+
+	var (
+		p     = newWorkerPool(1)
+		block = make(chan struct{})
+		order []byte
+		wg    sync.WaitGroup
+	)
+	wg.Add(5)
+	p.submit(PriorityNormal, func() { <-block; wg.Done() })
+	time.Sleep(10 * time.Millisecond)
+	for _, level := range []byte{PriorityLow, PriorityHigh, PriorityNormal, PriorityUrgent} {
+		level := level
+		p.submit(level, func() { order = append(order, level); wg.Done() })
+	}
+	close(block)
+	wg.Wait()
+	p.stop()
+	assert.Equal(t, []byte{PriorityUrgent, PriorityHigh, PriorityNormal, PriorityLow}, order)
+	assert.False(t, p.submit(PriorityUrgent, func() {}))
+}
@@ -0,0 +1,105 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"strconv"
+
+	"github.com/andeya/goutil"
+)
+
+const (
+	// ProgressServiceMethod the service method of the progress notification of the call,
+	// it is a PUSH handled by the framework, see CallCtx.Progress.
+	ProgressServiceMethod = "/erpc/progress"
+	// MetaProgressSeq the sequence of the call in progress, in the progress notification
+	MetaProgressSeq = "X-Progress-Seq"
+	// MetaProgress the percent of the progress, in the progress notification
+	MetaProgress = "X-Progress"
+	// MetaProgressNote the note of the progress, in the progress notification
+	MetaProgressNote = "X-Progress-Note"
+)
+
+// ProgressFunc receives the progress of the call, see CallCmd.OnProgress.
+type ProgressFunc func(percent int, note string)
+
+// Progress emits the intermediate progress of the call to the caller, e.g. of the report generation,
+// received by CallCmd.OnProgress.
+// NOTE:
+//  The percent is limited to [0,100];
+//  It is sent before the reply in order, the one after the reply is dropped;
+//  It does nothing for the PUSH and the batch item.
+func (c *handlerCtx) Progress(percent int, note string) *Status {
+	if c.input.Mtype() != TypeCall || c.batchReply != nil {
+		return nil
+	}
+	switch {
+	case percent < 0:
+		percent = 0
+	case percent > 100:
+		percent = 100
+	}
+	setting := []MessageSetting{
+		WithSetMeta(MetaProgressSeq, formatSeq(GetSeq64(c.input))),
+		WithSetMeta(MetaProgress, strconv.Itoa(percent)),
+	}
+	if note != "" {
+		setting = append(setting, WithSetMeta(MetaProgressNote, note))
+	}
+	return c.sess.RawPush(ProgressServiceMethod, nil, setting...)
+}
+
+// handleProgress passes the progress notification to the pending call.
+func (s *session) handleProgress(header Header) {
+	meta := header.Meta()
+	seq, err := parseSeq(meta.Peek(MetaProgressSeq))
+	if err != nil {
+		return
+	}
+	cmd, ok := s.callCmdMap.Load(seq)
+	if !ok {
+		return
+	}
+	percent, err := strconv.Atoi(goutil.BytesToString(meta.Peek(MetaProgress)))
+	if err != nil {
+		return
+	}
+	cmd.progress(percent, string(meta.Peek(MetaProgressNote)))
+}
+
+// progress records the progress, and calls the ProgressFunc if registered.
+func (c *callCmd) progress(percent int, note string) {
+	c.progressMu.Lock()
+	defer c.progressMu.Unlock()
+	c.progressed = true
+	c.progressPercent = percent
+	c.progressNote = note
+	if c.progressFunc != nil {
+		c.progressFunc(percent, note)
+	}
+}
+
+// OnProgress registers the callback of the progress notifications of the call, emitted by CallCtx.Progress.
+// NOTE:
+//  If some progress has been received, fn is called with the latest one at once;
+//  fn is called in order by the reading goroutine of the session, so it must be fast and not block.
+func (c *callCmd) OnProgress(fn ProgressFunc) {
+	c.progressMu.Lock()
+	defer c.progressMu.Unlock()
+	c.progressFunc = fn
+	if c.progressed && fn != nil {
+		fn(c.progressPercent, c.progressNote)
+	}
+}
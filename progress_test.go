@@ -0,0 +1,45 @@
+package erpc_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/andeya/erpc/v7"
+)
+
+func TestProgress(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{})
+	defer srv.Close()
+	start := make(chan struct{})
+	srv.RouteCallFunc(func(ctx erpc.CallCtx, arg *string) (string, *erpc.Status) {
+		<-start
+		for _, percent := range []int{10, 50, 120} {
+			if stat := ctx.Progress(percent, fmt.Sprintf("step %d", percent)); !stat.OK() {
+				return "", stat
+			}
+		}
+		return *arg, nil
+	})
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := erpc.ConnectPipe(srv, cli)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var (
+		reply    string
+		progress []string
+	)
+	cmd := sess.AsyncCall("/func1", "report", &reply, nil)
+	cmd.OnProgress(func(percent int, note string) {
+		progress = append(progress, fmt.Sprintf("%d:%s", percent, note))
+	})
+	close(start)
+	<-cmd.Done()
+	if stat = cmd.Status(); !stat.OK() || reply != "report" {
+		t.Fatalf("reply: %q, stat: %v", reply, stat)
+	}
+	if got := fmt.Sprint(progress); got != "[10:step 10 50:step 50 100:step 120]" {
+		t.Fatalf("progress: %s", got)
+	}
+}
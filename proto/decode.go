@@ -0,0 +1,188 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package proto decodes the frames of the length-prefixed protocols (rawproto, jsonproto, pbproto)
+// with strict bounds, so the untrusted input can not allocate unbounded memory.
+package proto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/codec"
+)
+
+// Limits the strict bounds of decoding a frame, the zero field uses the default one.
+type Limits struct {
+	// MaxMessageSize the max size of the frame, checked before reading it, default 4MB
+	MaxMessageSize uint32
+	// MaxServiceMethodLen the max length of the service method, default 255
+	MaxServiceMethodLen int
+	// MaxMetaCount the max number of the metadata pairs, default 64
+	MaxMetaCount int
+	// MaxMetaSize the max total size of the metadata keys and values, default 8KB
+	MaxMetaSize int
+	// MaxExtensions the max number of the extensions, default 16
+	MaxExtensions int
+	// MaxNesting the max nesting depth of the JSON body, default 32
+	MaxNesting int
+}
+
+// DefaultLimits returns the default limits.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxMessageSize:      4 << 20,
+		MaxServiceMethodLen: 255,
+		MaxMetaCount:        64,
+		MaxMetaSize:         8 << 10,
+		MaxExtensions:       16,
+		MaxNesting:          32,
+	}
+}
+
+func (l Limits) withDefault() Limits {
+	d := DefaultLimits()
+	if l.MaxMessageSize == 0 {
+		l.MaxMessageSize = d.MaxMessageSize
+	}
+	if l.MaxServiceMethodLen <= 0 {
+		l.MaxServiceMethodLen = d.MaxServiceMethodLen
+	}
+	if l.MaxMetaCount <= 0 {
+		l.MaxMetaCount = d.MaxMetaCount
+	}
+	if l.MaxMetaSize <= 0 {
+		l.MaxMetaSize = d.MaxMetaSize
+	}
+	if l.MaxExtensions <= 0 {
+		l.MaxExtensions = d.MaxExtensions
+	}
+	if l.MaxNesting <= 0 {
+		l.MaxNesting = d.MaxNesting
+	}
+	return l
+}
+
+// ErrExceedLimits the error of the frame exceeding the decoding limits.
+var ErrExceedLimits = errors.New("proto: exceeds the decoding limits")
+
+// Decode reads one frame from r, and decodes it into a message by the protocol, raw protocol by default.
+// NOTE:
+//  The body is kept as the raw bytes, i.e. *[]byte, not unmarshalled;
+//  Only the protocols with the {4 bytes message length} prefix are supported, e.g. rawproto, jsonproto and pbproto;
+//  The message can be recycled by erpc.PutMessage.
+func Decode(r io.Reader, limits Limits, protoFunc ...erpc.ProtoFunc) (erpc.Message, error) {
+	limits = limits.withDefault()
+	var head [4]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(head[:])
+	if size > limits.MaxMessageSize {
+		return nil, fmt.Errorf("%w: message size %d > %d", ErrExceedLimits, size, limits.MaxMessageSize)
+	}
+	// NOTE: the length may or may not include the prefix itself, by the protocol.
+	rw := &frameReader{Reader: io.MultiReader(bytes.NewReader(head[:]), io.LimitReader(r, int64(size)))}
+	m := erpc.GetMessage(erpc.WithNewBody(func(erpc.Header) interface{} {
+		return new([]byte)
+	}))
+	if err := getProtoFunc(protoFunc)(rw).Unpack(m); err != nil {
+		erpc.PutMessage(m)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if err := limits.check(m); err != nil {
+		erpc.PutMessage(m)
+		return nil, err
+	}
+	return m, nil
+}
+
+func getProtoFunc(protoFunc []erpc.ProtoFunc) erpc.ProtoFunc {
+	if len(protoFunc) > 0 && protoFunc[0] != nil {
+		return protoFunc[0]
+	}
+	return erpc.DefaultProtoFunc()
+}
+
+func (l Limits) check(m erpc.Message) error {
+	if n := len(m.ServiceMethod()); n > l.MaxServiceMethodLen {
+		return fmt.Errorf("%w: service method length %d > %d", ErrExceedLimits, n, l.MaxServiceMethodLen)
+	}
+	if n := m.Meta().Len(); n > l.MaxMetaCount {
+		return fmt.Errorf("%w: metadata count %d > %d", ErrExceedLimits, n, l.MaxMetaCount)
+	}
+	var metaSize int
+	m.Meta().VisitAll(func(key, value []byte) {
+		metaSize += len(key) + len(value)
+	})
+	if metaSize > l.MaxMetaSize {
+		return fmt.Errorf("%w: metadata size %d > %d", ErrExceedLimits, metaSize, l.MaxMetaSize)
+	}
+	if n := m.Extensions().Len(); n > l.MaxExtensions {
+		return fmt.Errorf("%w: extensions count %d > %d", ErrExceedLimits, n, l.MaxExtensions)
+	}
+	if m.BodyCodec() == codec.ID_JSON {
+		if body, ok := m.Body().(*[]byte); ok && jsonNesting(*body) > l.MaxNesting {
+			return fmt.Errorf("%w: JSON body nesting > %d", ErrExceedLimits, l.MaxNesting)
+		}
+	}
+	return nil
+}
+
+// jsonNesting returns the max nesting depth of the JSON, without parsing it.
+func jsonNesting(b []byte) int {
+	var depth, max int
+	var inString, escaped bool
+	for _, c := range b {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if depth > max {
+				max = depth
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return max
+}
+
+// frameReader the read-only connection of one frame.
+type frameReader struct {
+	io.Reader
+}
+
+func (*frameReader) Write(p []byte) (int, error) {
+	return 0, errors.New("proto: the frame is read-only")
+}
@@ -0,0 +1,100 @@
+package proto_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/andeya/erpc/v7/proto"
+	"github.com/andeya/erpc/v7/proto/jsonproto"
+	"github.com/andeya/erpc/v7/proto/pbproto"
+)
+
+func pack(t testing.TB, protoFunc erpc.ProtoFunc, setting ...erpc.MessageSetting) []byte {
+	var buf bytes.Buffer
+	m := erpc.GetMessage(setting...)
+	defer erpc.PutMessage(m)
+	m.SetSeq(7)
+	m.SetMtype(erpc.TypeCall)
+	if err := protoFunc(&buf).Pack(m); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func seeds(f *testing.F, protoFunc erpc.ProtoFunc) {
+	f.Add(pack(f, protoFunc, erpc.WithServiceMethod("/a/b"), erpc.WithBody([]byte(`{"x":1}`))))
+	f.Add(pack(f, protoFunc, erpc.WithServiceMethod("/a/b"), erpc.WithAddMeta("k", "v"),
+		erpc.WithBodyCodec('j'), erpc.WithBody(map[string]int{"x": 1})))
+	f.Add([]byte{0, 0, 0, 0})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 1})
+}
+
+func fuzzDecode(f *testing.F, protoFunc erpc.ProtoFunc) {
+	seeds(f, protoFunc)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m, err := proto.Decode(bytes.NewReader(data), proto.Limits{MaxMessageSize: 1 << 16}, protoFunc)
+		if err == nil {
+			erpc.PutMessage(m)
+		}
+	})
+}
+
+func FuzzDecodeRaw(f *testing.F) {
+	fuzzDecode(f, erpc.DefaultProtoFunc())
+}
+
+func FuzzDecodeJSON(f *testing.F) {
+	fuzzDecode(f, jsonproto.NewJSONProtoFunc())
+}
+
+func FuzzDecodePb(f *testing.F) {
+	fuzzDecode(f, pbproto.NewPbProtoFunc())
+}
+
+func TestDecode(t *testing.T) {
+	for _, protoFunc := range []erpc.ProtoFunc{erpc.DefaultProtoFunc(), jsonproto.NewJSONProtoFunc(), pbproto.NewPbProtoFunc()} {
+		b := pack(t, protoFunc, erpc.WithServiceMethod("/a/b"), erpc.WithAddMeta("k", "v"), erpc.WithBody([]byte("body")))
+		m, err := proto.Decode(bytes.NewReader(b), proto.Limits{}, protoFunc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Seq() != 7 || m.ServiceMethod() != "/a/b" || string(m.Meta().Peek("k")) != "v" ||
+			string(*m.Body().(*[]byte)) != "body" {
+			t.Fatalf("bad message: %s", m)
+		}
+		erpc.PutMessage(m)
+
+		// truncated
+		_, err = proto.Decode(bytes.NewReader(b[:len(b)-1]), proto.Limits{}, protoFunc)
+		if err == nil {
+			t.Fatal("expect the error of the truncated frame")
+		}
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	cases := []struct {
+		name   string
+		frame  []byte
+		limits proto.Limits
+	}{
+		{"size", []byte{0x7f, 0xff, 0xff, 0xff}, proto.Limits{}},
+		{"service method", pack(t, erpc.DefaultProtoFunc(), erpc.WithServiceMethod("/"+strings.Repeat("a", 20))),
+			proto.Limits{MaxServiceMethodLen: 10}},
+		{"meta count", pack(t, erpc.DefaultProtoFunc(), erpc.WithAddMeta("a", "1"), erpc.WithAddMeta("b", "2")),
+			proto.Limits{MaxMetaCount: 1}},
+		{"meta size", pack(t, erpc.DefaultProtoFunc(), erpc.WithAddMeta("a", strings.Repeat("x", 100))),
+			proto.Limits{MaxMetaSize: 50}},
+		{"nesting", pack(t, erpc.DefaultProtoFunc(), erpc.WithBodyCodec('j'),
+			erpc.WithBody([]byte(strings.Repeat("[", 40)+strings.Repeat("]", 40)))),
+			proto.Limits{}},
+	}
+	for _, c := range cases {
+		_, err := proto.Decode(bytes.NewReader(c.frame), c.limits)
+		if !errors.Is(err, proto.ErrExceedLimits) {
+			t.Errorf("%s: expect ErrExceedLimits, got %v", c.name, err)
+		}
+	}
+}
@@ -0,0 +1,795 @@
+// Package h2proto is implemented HTTP/2 based socket communication protocol.
+//
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package h2proto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/codec"
+	"github.com/andeya/goutil"
+)
+
+// HTTP/2 header fields of erpc message
+const (
+	HeaderSeq           = "x-erpc-seq"
+	HeaderMtype         = "x-erpc-mtype"
+	HeaderServiceMethod = "x-erpc-service-method"
+	HeaderMeta          = "x-erpc-meta"
+	HeaderXfer          = "x-erpc-xfer"
+	HeaderExtensions    = "x-erpc-extensions"
+	// HeaderStatus is sent in the trailers of reply
+	HeaderStatus = "x-erpc-status"
+	// HeaderTrailer is sent in the trailers of reply, if the trailer metadata exist
+	HeaderTrailer = "x-erpc-trailer"
+)
+
+// ContentTypePrefix the content type prefix, followed by the body codec name,
+// e.g. application/erpc+json
+const ContentTypePrefix = "application/erpc+"
+
+// MaxConcurrentStreams the SETTINGS_MAX_CONCURRENT_STREAMS advertised to the remote peer,
+// namely the limit of the streams initiated by the remote peer that are being received or waiting for reply.
+// NOTE: The exceeded streams are refused by RST_STREAM.
+var MaxConcurrentStreams uint32 = 1000
+
+const (
+	frameHeaderLen      = 9
+	initialWindowSize   = 65535
+	initialMaxFrameSize = 16384
+	maxWindowSize       = 1<<31 - 1
+)
+
+// NewH2ProtoFunc is creation function of HTTP/2 socket protocol.
+// Each CALL or PUSH is sent as a POST request stream to the service method path,
+// and the REPLY is sent as the response of the stream, with the status in trailers.
+// NOTE:
+//  The client is the dialing side that sends the connection preface,
+//  e.g. sess, _ := peer.Dial(addr, h2proto.NewH2ProtoFunc(true))
+//  and peer.ListenAndServe(h2proto.NewH2ProtoFunc(false));
+//  For TLS, set the NextProtos of tls.Config to []string{"h2"};
+//  The service method must start with '/';
+//  Only client-initiated CALL and PUSH can traverse HTTP/2 proxies,
+//  the server-initiated ones use even stream ids that only erpc peers accept.
+func NewH2ProtoFunc(client bool) erpc.ProtoFunc {
+	return func(rw erpc.IOWithReadBuffer) erpc.Proto {
+		h := &h2proto{
+			id:              '2',
+			name:            "h2",
+			rw:              rw,
+			client:          client,
+			framer:          http2.NewFramer(rw, rw),
+			connWindow:      initialWindowSize,
+			initialWindow:   initialWindowSize,
+			maxFrameSize:    initialMaxFrameSize,
+			maxLocalStreams: math.MaxUint32,
+			maxPeerStreams:  MaxConcurrentStreams,
+			sendWindows:     make(map[uint32]int32),
+			replyStreams:    make(map[int32]uint32),
+			recvStreams:     make(map[uint32]*h2stream),
+		}
+		// it is the default SETTINGS_MAX_FRAME_SIZE that we advertised
+		h.framer.SetMaxReadFrameSize(initialMaxFrameSize)
+		h.framer.MaxHeaderListSize = erpc.GetReadLimit()
+		h.framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+		h.henc = hpack.NewEncoder(&h.hbuf)
+		h.cond = sync.NewCond(&h.mu)
+		if client {
+			h.nextStreamID = 1
+		} else {
+			h.nextStreamID = 2
+		}
+		return h
+	}
+}
+
+type h2proto struct {
+	rw        erpc.IOWithReadBuffer
+	framer    *http2.Framer
+	authority string
+	name      string
+	id        byte
+	client    bool
+
+	// write side of framer, guarded by wMu
+	wMu      sync.Mutex
+	henc     *hpack.Encoder
+	hbuf     bytes.Buffer
+	initOnce sync.Once
+	initErr  error
+
+	// flow control and streams, guarded by mu
+	mu            sync.Mutex
+	cond          *sync.Cond
+	connWindow    int32
+	initialWindow int32
+	maxFrameSize  uint32
+	nextStreamID  uint32
+	// the open streams, initiated by local or remote peer
+	sendWindows     map[uint32]int32
+	localStreams    uint32
+	maxLocalStreams uint32
+	peerStreams     uint32
+	maxPeerStreams  uint32
+	replyStreams    map[int32]uint32
+	err             error
+
+	// read side of framer, guarded by rMu
+	rMu            sync.Mutex
+	recvStreams    map[uint32]*h2stream
+	lastPeerStream uint32
+	prefaceReady   bool
+}
+
+type h2stream struct {
+	header  []hpack.HeaderField
+	trailer []hpack.HeaderField
+	body    bytes.Buffer
+	size    int
+}
+
+// Version returns the protocol's id and name.
+func (h *h2proto) Version() (byte, string) {
+	return h.id, h.name
+}
+
+// init sends the connection preface.
+// NOTE: The connection is ready only after the socket is created.
+func (h *h2proto) init() error {
+	h.initOnce.Do(func() {
+		if a, ok := h.rw.(interface{ RemoteAddr() net.Addr }); ok {
+			h.authority = a.RemoteAddr().String()
+		}
+		h.wMu.Lock()
+		defer h.wMu.Unlock()
+		if h.client {
+			if _, h.initErr = io.WriteString(h.rw, http2.ClientPreface); h.initErr != nil {
+				return
+			}
+		}
+		h.initErr = h.framer.WriteSettings(http2.Setting{ID: http2.SettingMaxConcurrentStreams, Val: h.maxPeerStreams})
+	})
+	return h.initErr
+}
+
+// Pack writes the Message into the connection.
+// NOTE: Make sure to write only once or there will be package contamination!
+func (h *h2proto) Pack(m erpc.Message) error {
+	if err := h.init(); err != nil {
+		return err
+	}
+	bodyBytes, err := m.MarshalBody()
+	if err != nil {
+		return err
+	}
+	bodyBytes, err = m.XferPipe().OnPack(bodyBytes)
+	if err != nil {
+		return err
+	}
+
+	var (
+		header   []hpack.HeaderField
+		streamID uint32
+		mtype    = m.Mtype()
+		isReply  = mtype == erpc.TypeReply || mtype == erpc.TypeAuthReply
+	)
+	if isReply {
+		h.mu.Lock()
+		streamID = h.replyStreams[m.Seq()]
+		delete(h.replyStreams, m.Seq())
+		h.mu.Unlock()
+		if streamID == 0 {
+			return fmt.Errorf("h2proto: no request stream for reply seq %d, or it is reset", m.Seq())
+		}
+		defer h.closeStream(streamID)
+		header = append(header, hpack.HeaderField{Name: ":status", Value: "200"})
+		if serviceMethod := m.ServiceMethod(); serviceMethod != "" {
+			header = append(header, hpack.HeaderField{Name: HeaderServiceMethod, Value: serviceMethod})
+		}
+	} else {
+		serviceMethod := m.ServiceMethod()
+		if !strings.HasPrefix(serviceMethod, "/") {
+			return fmt.Errorf("h2proto: service method must start with '/': %q", serviceMethod)
+		}
+		// honor the SETTINGS_MAX_CONCURRENT_STREAMS of the remote peer
+		h.mu.Lock()
+		for h.err == nil && h.localStreams >= h.maxLocalStreams {
+			h.cond.Wait()
+		}
+		if h.err != nil {
+			err := h.err
+			h.mu.Unlock()
+			return err
+		}
+		streamID = h.nextStreamID
+		h.nextStreamID += 2
+		h.sendWindows[streamID] = h.initialWindow
+		h.localStreams++
+		h.mu.Unlock()
+		header = append(header,
+			hpack.HeaderField{Name: ":method", Value: "POST"},
+			hpack.HeaderField{Name: ":scheme", Value: "http"},
+			hpack.HeaderField{Name: ":authority", Value: h.authority},
+			hpack.HeaderField{Name: ":path", Value: serviceMethod},
+			hpack.HeaderField{Name: "te", Value: "trailers"},
+		)
+		if !m.StatusOK() {
+			header = append(header, hpack.HeaderField{Name: HeaderStatus, Value: string(m.Status().EncodeQuery())})
+		}
+	}
+	header = append(header,
+		hpack.HeaderField{Name: "content-type", Value: contentType(m.BodyCodec())},
+		hpack.HeaderField{Name: HeaderSeq, Value: strconv.FormatInt(int64(m.Seq()), 10)},
+		hpack.HeaderField{Name: HeaderMtype, Value: strconv.Itoa(int(mtype))},
+	)
+	if m.Meta().Len() > 0 {
+		header = append(header, hpack.HeaderField{Name: HeaderMeta, Value: string(m.Meta().QueryString())})
+	}
+	if m.XferPipe().Len() > 0 {
+		header = append(header, hpack.HeaderField{Name: HeaderXfer, Value: base64.RawURLEncoding.EncodeToString(m.XferPipe().IDs())})
+	}
+	if ext := m.Extensions(); ext.Len() > 0 {
+		header = append(header, hpack.HeaderField{Name: HeaderExtensions, Value: base64.RawURLEncoding.EncodeToString(ext.AppendTo(nil))})
+	}
+
+	endStream := len(bodyBytes) == 0 && !isReply
+	size, err := h.writeHeaders(streamID, header, endStream)
+	if err != nil {
+		return err
+	}
+	if len(bodyBytes) > 0 {
+		n, err := h.writeData(streamID, bodyBytes, !isReply)
+		size += n
+		if err != nil {
+			return err
+		}
+	}
+	if isReply {
+		trailer := []hpack.HeaderField{{Name: HeaderStatus, Value: string(m.Status(true).EncodeQuery())}}
+		if m.Trailer().Len() > 0 {
+			trailer = append(trailer, hpack.HeaderField{Name: HeaderTrailer, Value: string(m.Trailer().QueryString())})
+		}
+		n, err := h.writeHeaders(streamID, trailer, true)
+		size += n
+		if err != nil {
+			return err
+		}
+	}
+	return m.SetSize(uint32(size))
+}
+
+// writeHeaders writes the HEADERS and CONTINUATION frames, and returns the written size.
+func (h *h2proto) writeHeaders(streamID uint32, fields []hpack.HeaderField, endStream bool) (int, error) {
+	h.mu.Lock()
+	maxFrameSize := int(h.maxFrameSize)
+	h.mu.Unlock()
+
+	h.wMu.Lock()
+	defer h.wMu.Unlock()
+	h.hbuf.Reset()
+	for _, f := range fields {
+		if err := h.henc.WriteField(f); err != nil {
+			return 0, err
+		}
+	}
+	block := h.hbuf.Bytes()
+	size := 0
+	first := true
+	for first || len(block) > 0 {
+		frag := block
+		if len(frag) > maxFrameSize {
+			frag = frag[:maxFrameSize]
+		}
+		block = block[len(frag):]
+		endHeaders := len(block) == 0
+		var err error
+		if first {
+			err = h.framer.WriteHeaders(http2.HeadersFrameParam{
+				StreamID:      streamID,
+				BlockFragment: frag,
+				EndStream:     endStream,
+				EndHeaders:    endHeaders,
+			})
+			first = false
+		} else {
+			err = h.framer.WriteContinuation(streamID, endHeaders, frag)
+		}
+		if err != nil {
+			return size, err
+		}
+		size += frameHeaderLen + len(frag)
+	}
+	return size, nil
+}
+
+// writeData writes the DATA frames under flow control, and returns the written size.
+func (h *h2proto) writeData(streamID uint32, data []byte, endStream bool) (int, error) {
+	size := 0
+	for len(data) > 0 {
+		h.mu.Lock()
+		for h.err == nil && h.isOpen(streamID) && (h.connWindow <= 0 || h.sendWindows[streamID] <= 0) {
+			h.cond.Wait()
+		}
+		if h.err != nil {
+			err := h.err
+			h.mu.Unlock()
+			return size, err
+		}
+		if !h.isOpen(streamID) {
+			h.mu.Unlock()
+			return size, errStreamReset
+		}
+		n := int(h.maxFrameSize)
+		if w := int(h.connWindow); n > w {
+			n = w
+		}
+		if w := int(h.sendWindows[streamID]); n > w {
+			n = w
+		}
+		if n > len(data) {
+			n = len(data)
+		}
+		h.connWindow -= int32(n)
+		h.sendWindows[streamID] -= int32(n)
+		h.mu.Unlock()
+
+		h.wMu.Lock()
+		err := h.framer.WriteData(streamID, endStream && n == len(data), data[:n])
+		h.wMu.Unlock()
+		if err != nil {
+			return size, err
+		}
+		size += frameHeaderLen + n
+		data = data[n:]
+	}
+	return size, nil
+}
+
+// Unpack reads bytes from the connection to the Message.
+// NOTE: Concurrent unsafe!
+func (h *h2proto) Unpack(m erpc.Message) error {
+	h.rMu.Lock()
+	defer h.rMu.Unlock()
+	err := h.unpack(m)
+	if err != nil {
+		h.mu.Lock()
+		if h.err == nil {
+			h.err = err
+		}
+		h.cond.Broadcast()
+		h.mu.Unlock()
+	}
+	return err
+}
+
+var (
+	errBadPreface  = errors.New("h2proto: bad connection preface")
+	errStreamReset = errors.New("h2proto: stream is reset")
+)
+
+func (h *h2proto) unpack(m erpc.Message) error {
+	if !h.client && !h.prefaceReady {
+		var preface [len(http2.ClientPreface)]byte
+		if _, err := io.ReadFull(h.rw, preface[:]); err != nil {
+			return err
+		}
+		if string(preface[:]) != http2.ClientPreface {
+			return errBadPreface
+		}
+		h.prefaceReady = true
+	}
+	if err := h.init(); err != nil {
+		return err
+	}
+	for {
+		f, err := h.framer.ReadFrame()
+		if err != nil {
+			if se, ok := err.(http2.StreamError); ok {
+				if err = h.resetStream(se.StreamID, se.Code); err != nil {
+					return err
+				}
+				continue
+			}
+			return h.goAway(err)
+		}
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if err = h.onSettings(f); err != nil {
+				return h.goAway(err)
+			}
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				h.wMu.Lock()
+				err = h.framer.WritePing(true, f.Data)
+				h.wMu.Unlock()
+				if err != nil {
+					return err
+				}
+			}
+		case *http2.WindowUpdateFrame:
+			if err = h.onWindowUpdate(f); err != nil {
+				return h.goAway(err)
+			}
+		case *http2.GoAwayFrame:
+			return io.EOF
+		case *http2.RSTStreamFrame:
+			h.removeStream(f.StreamID)
+		case *http2.PushPromiseFrame:
+			return h.goAway(http2.ConnectionError(http2.ErrCodeProtocol))
+		case *http2.MetaHeadersFrame:
+			if f.Truncated {
+				return errTooLarge
+			}
+			st, err := h.headersStream(f.StreamID)
+			if err != nil {
+				return err
+			}
+			if st == nil {
+				continue
+			}
+			st.size += frameHeaderLen + int(f.Length)
+			if err = checkSize(st.size); err != nil {
+				return err
+			}
+			if st.header == nil {
+				st.header = f.Fields
+			} else {
+				st.trailer = f.Fields
+			}
+			if f.StreamEnded() {
+				if ok, err := h.finish(f.StreamID, st, m); ok || err != nil {
+					return err
+				}
+			}
+		case *http2.DataFrame:
+			if err = h.refund(f.StreamID, f.Length, f.StreamEnded()); err != nil {
+				return err
+			}
+			st := h.recvStreams[f.StreamID]
+			if st == nil {
+				continue
+			}
+			st.body.Write(f.Data())
+			st.size += frameHeaderLen + int(f.Length)
+			if err = checkSize(st.size); err != nil {
+				return err
+			}
+			if f.StreamEnded() {
+				if ok, err := h.finish(f.StreamID, st, m); ok || err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// headersStream returns the receiving stream of the HEADERS frame,
+// or nil if the frame should be ignored, such as for the refused or reset streams.
+func (h *h2proto) headersStream(streamID uint32) (*h2stream, error) {
+	if st := h.recvStreams[streamID]; st != nil {
+		return st, nil
+	}
+	if !h.isPeerStream(streamID) {
+		// the response of the stream we initiated
+		h.mu.Lock()
+		open := h.isOpen(streamID)
+		h.mu.Unlock()
+		if !open {
+			return nil, nil
+		}
+		st := new(h2stream)
+		h.recvStreams[streamID] = st
+		return st, nil
+	}
+	if streamID <= h.lastPeerStream {
+		return nil, nil
+	}
+	h.lastPeerStream = streamID
+	h.mu.Lock()
+	refused := h.peerStreams >= h.maxPeerStreams
+	if !refused {
+		h.sendWindows[streamID] = h.initialWindow
+		h.peerStreams++
+	}
+	h.mu.Unlock()
+	if refused {
+		return nil, h.resetStream(streamID, http2.ErrCodeRefusedStream)
+	}
+	st := new(h2stream)
+	h.recvStreams[streamID] = st
+	return st, nil
+}
+
+// isPeerStream reports whether the stream is initiated by the remote peer.
+func (h *h2proto) isPeerStream(streamID uint32) bool {
+	// client-initiated streams use odd ids
+	return (streamID%2 == 1) != h.client
+}
+
+// isOpen reports whether the stream is open, the caller must hold mu.
+func (h *h2proto) isOpen(streamID uint32) bool {
+	_, ok := h.sendWindows[streamID]
+	return ok
+}
+
+// closeStream releases the open stream that is ended in both directions.
+func (h *h2proto) closeStream(streamID uint32) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.isOpen(streamID) {
+		return
+	}
+	delete(h.sendWindows, streamID)
+	if h.isPeerStream(streamID) {
+		h.peerStreams--
+	} else {
+		h.localStreams--
+	}
+	h.cond.Broadcast()
+}
+
+// removeStream removes the reset stream, the caller must hold rMu.
+func (h *h2proto) removeStream(streamID uint32) {
+	delete(h.recvStreams, streamID)
+	h.mu.Lock()
+	for seq, id := range h.replyStreams {
+		if id == streamID {
+			delete(h.replyStreams, seq)
+			break
+		}
+	}
+	h.mu.Unlock()
+	h.closeStream(streamID)
+}
+
+// resetStream sends RST_STREAM and removes the stream, the caller must hold rMu.
+func (h *h2proto) resetStream(streamID uint32, code http2.ErrCode) error {
+	h.removeStream(streamID)
+	h.wMu.Lock()
+	defer h.wMu.Unlock()
+	return h.framer.WriteRSTStream(streamID, code)
+}
+
+// goAway sends GOAWAY for the connection error before closing.
+func (h *h2proto) goAway(err error) error {
+	if code, ok := err.(http2.ConnectionError); ok {
+		h.wMu.Lock()
+		h.framer.WriteGoAway(h.lastPeerStream, http2.ErrCode(code), nil)
+		h.wMu.Unlock()
+	}
+	return err
+}
+
+var errTooLarge = errors.New("h2proto: size of message exceeds limit")
+
+func checkSize(size int) error {
+	if uint32(size) > erpc.GetReadLimit() {
+		return errTooLarge
+	}
+	return nil
+}
+
+func (h *h2proto) onSettings(f *http2.SettingsFrame) error {
+	if f.IsAck() {
+		return nil
+	}
+	h.mu.Lock()
+	err := f.ForeachSetting(func(s http2.Setting) error {
+		if err := s.Valid(); err != nil {
+			return err
+		}
+		switch s.ID {
+		case http2.SettingInitialWindowSize:
+			delta := int64(s.Val) - int64(h.initialWindow)
+			for id, w := range h.sendWindows {
+				if int64(w)+delta > maxWindowSize {
+					return http2.ConnectionError(http2.ErrCodeFlowControl)
+				}
+				h.sendWindows[id] = int32(int64(w) + delta)
+			}
+			h.initialWindow = int32(s.Val)
+		case http2.SettingMaxFrameSize:
+			h.maxFrameSize = s.Val
+		case http2.SettingMaxConcurrentStreams:
+			h.maxLocalStreams = s.Val
+		}
+		return nil
+	})
+	h.cond.Broadcast()
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	h.wMu.Lock()
+	defer h.wMu.Unlock()
+	return h.framer.WriteSettingsAck()
+}
+
+// onWindowUpdate increases the flow control window,
+// the window exceeding 2^31-1 is a connection error for the connection, or a stream error for the stream.
+func (h *h2proto) onWindowUpdate(f *http2.WindowUpdateFrame) error {
+	h.mu.Lock()
+	if f.StreamID == 0 {
+		if int64(h.connWindow)+int64(f.Increment) > maxWindowSize {
+			h.mu.Unlock()
+			return http2.ConnectionError(http2.ErrCodeFlowControl)
+		}
+		h.connWindow += int32(f.Increment)
+		h.cond.Broadcast()
+		h.mu.Unlock()
+		return nil
+	}
+	w, ok := h.sendWindows[f.StreamID]
+	overflow := ok && int64(w)+int64(f.Increment) > maxWindowSize
+	if ok && !overflow {
+		h.sendWindows[f.StreamID] += int32(f.Increment)
+		h.cond.Broadcast()
+	}
+	h.mu.Unlock()
+	if overflow {
+		return h.resetStream(f.StreamID, http2.ErrCodeFlowControl)
+	}
+	return nil
+}
+
+// refund returns the flow control window of the received data to the sender.
+func (h *h2proto) refund(streamID, length uint32, ended bool) error {
+	if length == 0 {
+		return nil
+	}
+	h.wMu.Lock()
+	defer h.wMu.Unlock()
+	if err := h.framer.WriteWindowUpdate(0, length); err != nil {
+		return err
+	}
+	if ended || h.recvStreams[streamID] == nil {
+		return nil
+	}
+	return h.framer.WriteWindowUpdate(streamID, length)
+}
+
+// finish converts the ended stream to the message.
+// If the stream is not an erpc message, such as the response of PUSH, returns false.
+func (h *h2proto) finish(streamID uint32, st *h2stream, m erpc.Message) (bool, error) {
+	delete(h.recvStreams, streamID)
+	var (
+		isResponse bool
+		seq        string
+		mtype      string
+	)
+	for _, f := range st.header {
+		switch f.Name {
+		case ":status":
+			isResponse = true
+		case HeaderMtype:
+			mtype = f.Value
+		}
+	}
+	if isResponse {
+		h.closeStream(streamID)
+		if mtype == "" {
+			// the response of PUSH
+			return false, nil
+		}
+	}
+	for _, f := range st.header {
+		switch f.Name {
+		case ":path":
+			m.SetServiceMethod(f.Value)
+		case HeaderServiceMethod:
+			m.SetServiceMethod(f.Value)
+		case HeaderSeq:
+			seq = f.Value
+		case "content-type":
+			m.SetBodyCodec(bodyCodec(f.Value))
+		case HeaderMeta:
+			m.Meta().Parse(f.Value)
+		case HeaderStatus:
+			m.Status(true).DecodeQuery(goutil.StringToBytes(f.Value))
+		case HeaderXfer:
+			ids, err := base64.RawURLEncoding.DecodeString(f.Value)
+			if err != nil {
+				return true, err
+			}
+			if err = m.XferPipe().Append(ids...); err != nil {
+				return true, err
+			}
+		case HeaderExtensions:
+			b, err := base64.RawURLEncoding.DecodeString(f.Value)
+			if err != nil {
+				return true, err
+			}
+			if err = m.Extensions().Decode(b); err != nil {
+				return true, err
+			}
+		}
+	}
+	for _, f := range st.trailer {
+		switch f.Name {
+		case HeaderStatus:
+			m.Status(true).DecodeQuery(goutil.StringToBytes(f.Value))
+		case HeaderTrailer:
+			m.Trailer().Parse(f.Value)
+		}
+	}
+	seqNum, err := strconv.ParseInt(seq, 10, 32)
+	if err != nil {
+		return true, fmt.Errorf("h2proto: bad %s: %q", HeaderSeq, seq)
+	}
+	m.SetSeq(int32(seqNum))
+	mtypeNum, err := strconv.ParseUint(mtype, 10, 8)
+	if err != nil {
+		return true, fmt.Errorf("h2proto: bad %s: %q", HeaderMtype, mtype)
+	}
+	m.SetMtype(byte(mtypeNum))
+
+	if !isResponse {
+		switch m.Mtype() {
+		case erpc.TypeCall, erpc.TypeAuthCall:
+			h.mu.Lock()
+			h.replyStreams[m.Seq()] = streamID
+			h.mu.Unlock()
+		default:
+			// close the stream by an empty response
+			h.closeStream(streamID)
+			if _, err = h.writeHeaders(streamID, []hpack.HeaderField{{Name: ":status", Value: "204"}}, true); err != nil {
+				return true, err
+			}
+		}
+	}
+	if err = m.SetSize(uint32(st.size)); err != nil {
+		return true, err
+	}
+	bodyBytes, err := m.XferPipe().OnUnpack(st.body.Bytes())
+	if err != nil {
+		return true, err
+	}
+	return true, m.UnmarshalBody(bodyBytes)
+}
+
+func contentType(codecID byte) string {
+	c, err := codec.Get(codecID)
+	if err != nil {
+		return ContentTypePrefix + strconv.Itoa(int(codecID))
+	}
+	return ContentTypePrefix + c.Name()
+}
+
+func bodyCodec(contentType string) byte {
+	if !strings.HasPrefix(contentType, ContentTypePrefix) {
+		return codec.NilCodecID
+	}
+	name := contentType[len(ContentTypePrefix):]
+	if c, err := codec.GetByName(name); err == nil {
+		return c.ID()
+	}
+	if id, err := strconv.ParseUint(name, 10, 8); err == nil {
+		return byte(id)
+	}
+	return codec.NilCodecID
+}
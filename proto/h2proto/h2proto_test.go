@@ -0,0 +1,143 @@
+package h2proto_test
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/proto/h2proto"
+	"github.com/andeya/erpc/v7/xfer/gzip"
+)
+
+type Home struct {
+	erpc.CallCtx
+}
+
+func (h *Home) Test(arg *map[string]string) (map[string]interface{}, *erpc.Status) {
+	h.Session().Push("/push/test", map[string]string{
+		"your_id": string(h.PeekMeta("peer_id")),
+	})
+	return map[string]interface{}{
+		"arg": *arg,
+	}, nil
+}
+
+func (h *Home) Big(arg *string) (string, *erpc.Status) {
+	return *arg + *arg, nil
+}
+
+func (h *Home) TestError(arg *map[string]string) (map[string]interface{}, *erpc.Status) {
+	return nil, erpc.NewStatus(1, "test error", "this is test:"+string(h.PeekMeta("peer_id")))
+}
+
+type Push struct {
+	erpc.PushCtx
+}
+
+func (p *Push) Test(arg *map[string]string) *erpc.Status {
+	pushed <- (*arg)["your_id"]
+	return nil
+}
+
+var pushed = make(chan string, 1)
+
+func TestH2Proto(t *testing.T) {
+	gzip.Reg('g', "gizp-5", 5)
+
+	// server
+	srv := erpc.NewPeer(erpc.PeerConfig{ListenPort: 9096})
+	srv.RouteCall(new(Home))
+	go srv.ListenAndServe(h2proto.NewH2ProtoFunc(false))
+	time.Sleep(1e9)
+
+	// client
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	cli.RoutePush(new(Push))
+	sess, stat := cli.Dial(":9096", h2proto.NewH2ProtoFunc(true))
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var result map[string]interface{}
+	stat = sess.Call("/home/test",
+		map[string]string{
+			"author": "andeya",
+		},
+		&result,
+		erpc.WithAddMeta("peer_id", "110"),
+		erpc.WithXferPipe('g'),
+	).Status()
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	t.Logf("result:%v", result)
+	select {
+	case id := <-pushed:
+		if id != "110" {
+			t.Fatalf("push: got %q", id)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("push: timeout")
+	}
+
+	// larger than the initial flow control window
+	big := strings.Repeat("x", 100<<10)
+	var bigResult string
+	stat = sess.Call("/home/big", big, &bigResult).Status()
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	if bigResult != big+big {
+		t.Fatalf("big: got %d bytes", len(bigResult))
+	}
+
+	stat = sess.Call("/home/test_error", map[string]string{}, nil, erpc.WithAddMeta("peer_id", "110")).Status()
+	if stat.Code() != 1 || stat.Cause().Error() != "this is test:110" {
+		t.Fatalf("test_error: got %v", stat)
+	}
+}
+
+func TestH2ProtoErrors(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{ListenPort: 9111})
+	srv.RouteCall(new(Home))
+	go srv.ListenAndServe(h2proto.NewH2ProtoFunc(false))
+	defer srv.Close()
+	time.Sleep(1e9)
+
+	// goAwayCode sends the frames after the preface, and returns the error code of GOAWAY.
+	goAwayCode := func(write func(*http2.Framer)) http2.ErrCode {
+		conn, err := net.Dial("tcp", ":9111")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(3 * time.Second))
+		io.WriteString(conn, http2.ClientPreface)
+		fr := http2.NewFramer(conn, conn)
+		fr.WriteSettings()
+		write(fr)
+		for {
+			f, err := fr.ReadFrame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g, ok := f.(*http2.GoAwayFrame); ok {
+				return g.ErrCode
+			}
+		}
+	}
+	if code := goAwayCode(func(fr *http2.Framer) {
+		fr.WriteSettings(http2.Setting{ID: http2.SettingMaxFrameSize, Val: 100})
+	}); code != http2.ErrCodeProtocol {
+		t.Fatalf("max frame size: got %v", code)
+	}
+	if code := goAwayCode(func(fr *http2.Framer) {
+		fr.WriteWindowUpdate(0, 1<<31-1)
+	}); code != http2.ErrCodeFlowControl {
+		t.Fatalf("window overflow: got %v", code)
+	}
+}
@@ -19,6 +19,7 @@ package jsonproto
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"io"
 	"strconv"
 	"sync"
@@ -50,6 +51,8 @@ type jsonproto struct {
 	id   byte
 }
 
+var errBadPackage = errors.New("json proto: bad package")
+
 // Version returns the protocol's id and name.
 func (j *jsonproto) Version() (byte, string) {
 	return j.id, j.name
@@ -142,6 +145,9 @@ func (j *jsonproto) Unpack(m erpc.Message) error {
 	// transfer pipe
 	var xferLen = bb.B[0]
 	bb.B = bb.B[1:]
+	if int(xferLen) > len(bb.B) {
+		return errBadPackage
+	}
 	if xferLen > 0 {
 		err = m.XferPipe().Append(bb.B[:xferLen]...)
 		if err != nil {
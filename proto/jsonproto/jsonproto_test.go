@@ -1,6 +1,8 @@
 package jsonproto_test
 
 import (
+	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -53,6 +55,35 @@ func TestJSONProto(t *testing.T) {
 	time.Sleep(3e9)
 }
 
+func TestJSONProtoFragment(t *testing.T) {
+	// the protocol does not carry the extensions, so the large bodies are never fragmented
+	srv := erpc.NewPeer(erpc.PeerConfig{FragmentSize: 64})
+	defer srv.Close()
+	srv.RouteCall(new(Home))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis, jsonproto.NewJSONProtoFunc())
+	time.Sleep(100 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{FragmentSize: 64})
+	defer cli.Close()
+	sess, stat := cli.Dial(lis.Addr().String(), jsonproto.NewJSONProtoFunc())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	author := strings.Repeat("andeya", 100)
+	var result map[string]interface{}
+	stat = sess.Call("/home/test", map[string]string{"author": author}, &result).Status()
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	if arg, _ := result["arg"].(map[string]interface{}); arg["author"] != author {
+		t.Fatalf("result: %v", result)
+	}
+}
+
 type Push struct {
 	erpc.PushCtx
 }
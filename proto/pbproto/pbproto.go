@@ -18,6 +18,7 @@ package pbproto
 
 import (
 	"encoding/binary"
+	"errors"
 	"io"
 	"sync"
 
@@ -45,6 +46,8 @@ type pbproto struct {
 	id   byte
 }
 
+var errBadPackage = errors.New("protobuf proto: bad package")
+
 // Version returns the protocol's id and name.
 func (pp *pbproto) Version() (byte, string) {
 	return pp.id, pp.name
@@ -119,6 +122,9 @@ func (pp *pbproto) Unpack(m erpc.Message) error {
 	// transfer pipe
 	var xferLen = bb.B[0]
 	bb.B = bb.B[1:]
+	if int(xferLen) > len(bb.B) {
+		return errBadPackage
+	}
 	if xferLen > 0 {
 		err = m.XferPipe().Append(bb.B[:xferLen]...)
 		if err != nil {
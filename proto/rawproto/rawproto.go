@@ -22,6 +22,9 @@ import (
 {status(urlencoded)}
 {2 bytes metadata length}
 {metadata(urlencoded)}
+# The following extensions exist only if the highest bit of message type is 1
+{2 bytes extensions length}
+{extensions(TLV: {1 byte type}{2 bytes value length}{value}...)}
 {1 byte body codec id}
 {body}
 */
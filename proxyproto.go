@@ -0,0 +1,211 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProxyHeaderTimeout the timeout of reading the PROXY protocol header
+var ProxyHeaderTimeout = 5 * time.Second
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// NewProxyProtoListener returns a listener that reads the HAProxy PROXY protocol v1 or v2 header
+// of the accepted connections, so that their RemoteAddr reflect the real client addresses.
+// NOTE:
+//  The header is only read from the trusted sources in the CIDR list, at least one CIDR is required;
+//  The connection without the header keeps the original remote address;
+//  For TLS, wrap the returned listener with tls.NewListener.
+func NewProxyProtoListener(lis net.Listener, trustedCIDRs ...string) (net.Listener, error) {
+	trusted, err := parseProxyTrustedCIDRs(trustedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	return &proxyProtoListener{Listener: lis, trusted: trusted}, nil
+}
+
+var errNoProxyTrustedCIDRs = errors.New("no trusted CIDRs for the PROXY protocol, the header would be spoofed by any client")
+
+func parseProxyTrustedCIDRs(list []string) ([]*net.IPNet, error) {
+	trusted, err := ParseCIDRs(list)
+	if err != nil {
+		return nil, err
+	}
+	if len(trusted) == 0 {
+		return nil, errNoProxyTrustedCIDRs
+	}
+	return trusted, nil
+}
+
+type proxyProtoListener struct {
+	net.Listener
+	trusted []*net.IPNet
+}
+
+func (l *proxyProtoListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.isTrusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return &proxyProtoConn{Conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+func (l *proxyProtoListener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, n := range l.trusted {
+		if n.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyProtoConn reads the PROXY header lazily, at the first Read or RemoteAddr,
+// so that the slow clients do not block the accept loop.
+type proxyProtoConn struct {
+	net.Conn
+	r       *bufio.Reader
+	once    sync.Once
+	srcAddr net.Addr
+	err     error
+}
+
+func (c *proxyProtoConn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(ProxyHeaderTimeout))
+		c.srcAddr, c.err = readProxyHeader(c.r)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			Warnf("PROXY protocol header from %s: %s", c.Conn.RemoteAddr().String(), c.err.Error())
+		}
+	})
+}
+
+func (c *proxyProtoConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.srcAddr != nil {
+		return c.srcAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader reads the PROXY protocol header,
+// returns nil address if there is no header or the source is unknown.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	switch b[0] {
+	case 'P':
+		if b, err = r.Peek(6); err == nil && string(b) == "PROXY " {
+			return readProxyHeaderV1(r)
+		}
+	case '\r':
+		if b, err = r.Peek(len(proxyV2Signature)); err == nil && bytes.Equal(b, proxyV2Signature) {
+			return readProxyHeaderV2(r)
+		}
+	}
+	return nil, nil
+}
+
+// readProxyHeaderV1 reads the human-readable header, e.g. "PROXY TCP4 1.2.3.4 5.6.7.8 1234 9090\r\n"
+func readProxyHeaderV1(r *bufio.Reader) (net.Addr, error) {
+	const maxLen = 107
+	var line []byte
+	for len(line) < maxLen {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("invalid PROXY v1 header")
+	}
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid PROXY v1 header: %q", line)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, fmt.Errorf("invalid PROXY v1 header: %q", line)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyHeaderV2 reads the binary header.
+func readProxyHeaderV2(r *bufio.Reader) (net.Addr, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, errors.New("invalid PROXY v2 version")
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	if hdr[12]&0xF == 0 {
+		// LOCAL command, e.g. health checks of the proxy
+		return nil, nil
+	}
+	switch hdr[13] >> 4 {
+	case 1: // AF_INET
+		if len(body) < 12 {
+			return nil, errors.New("invalid PROXY v2 IPv4 addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(body[:4]), Port: int(binary.BigEndian.Uint16(body[8:]))}, nil
+	case 2: // AF_INET6
+		if len(body) < 36 {
+			return nil, errors.New("invalid PROXY v2 IPv6 addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(body[:16]), Port: int(binary.BigEndian.Uint16(body[32:]))}, nil
+	}
+	return nil, nil
+}
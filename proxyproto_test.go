@@ -0,0 +1,77 @@
+package erpc_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func remote_addr(ctx erpc.CallCtx, _ *struct{}) (string, *erpc.Status) {
+	return ctx.Session().RemoteAddr().String(), nil
+}
+
+func TestProxyProtocol(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{
+		ListenPort:        9108,
+		ProxyProtocol:     true,
+		ProxyTrustedCIDRs: "127.0.0.0/8,::1",
+	})
+	srv.RouteCallFunc(remote_addr)
+	go srv.ListenAndServe()
+	defer srv.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	v2 := append([]byte("\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x0c"), 5, 6, 7, 8, 127, 0, 0, 1, 0x04, 0xd2, 0x23, 0x84)
+	cases := []struct {
+		header []byte
+		addr   string
+	}{
+		{[]byte("PROXY TCP4 1.2.3.4 127.0.0.1 5678 9108\r\n"), "1.2.3.4:5678"},
+		{v2, "5.6.7.8:1234"},
+		{nil, "127.0.0.1:"},
+	}
+	for _, c := range cases {
+		conn, err := net.Dial("tcp", "127.0.0.1:9108")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write(c.header)
+		sess, stat := cli.ServeConn(conn)
+		if !stat.OK() {
+			t.Fatal(stat)
+		}
+		var addr string
+		if stat = sess.Call("/remote/addr", nil, &addr).Status(); !stat.OK() {
+			t.Fatal(stat)
+		}
+		if !strings.HasPrefix(addr, c.addr) {
+			t.Fatalf("remote addr: expect %s, got %s", c.addr, addr)
+		}
+		sess.Close()
+	}
+}
+
+func TestProxyProtoListenerTrusted(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	// the header must not be trusted from any source
+	if _, err = erpc.NewProxyProtoListener(lis); err == nil {
+		t.Fatal("no trusted CIDRs: expect error!")
+	}
+	if _, err = erpc.NewProxyProtoListener(lis, "127.0.0.1/33"); err == nil {
+		t.Fatal("invalid CIDR: expect error!")
+	}
+	nets, err := erpc.ParseCIDRs([]string{"10.0.0.0/8", " 127.0.0.1 ", "", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nets) != 3 || !nets[1].Contains(net.ParseIP("127.0.0.1")) || nets[1].Contains(net.ParseIP("127.0.0.2")) {
+		t.Fatalf("nets: %v", nets)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"time"
+)
+
+// PushReliableOptions the retry options of Session.PushReliable
+type PushReliableOptions struct {
+	// AckTimeout the duration of waiting for the acknowledgement of each attempt, default 1s
+	AckTimeout time.Duration
+	// MaxRetries the maximum times of retries after the first attempt, default 3; no retry when <0
+	MaxRetries int
+	// Backoff the interval before the first retry, doubled each retry, default 100ms
+	Backoff time.Duration
+	// MaxBackoff the upper limit of the retry interval, default 5s
+	MaxBackoff time.Duration
+}
+
+func (o *PushReliableOptions) check() {
+	if o.AckTimeout <= 0 {
+		o.AckTimeout = time.Second
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = 3
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = time.Millisecond * 100
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = time.Second * 5
+	}
+	if o.MaxBackoff < o.Backoff {
+		o.MaxBackoff = o.Backoff
+	}
+}
+
+// PushReliable sends a message of TypePush type, and waits for the acknowledgement of the receiver,
+// retrying with the same seq and backoff until acknowledged or the retries are used up.
+// NOTE:
+// The receiver acknowledges the PUSH after handling it, even if the handling fails;
+// It is delivered at least once, deduplicate it by the seq on the receiver if necessary, e.g. plugin/dedup.
+func (s *session) PushReliable(serviceMethod string, args interface{}, opts PushReliableOptions, setting ...MessageSetting) *Status {
+	opts.check()
+	seq := s.nextSeq()
+	ackCh := make(chan struct{})
+	s.pushAcks.Store(seq, ackCh)
+	defer s.pushAcks.Delete(seq)
+	setting = append(setting[:len(setting):len(setting)], WithSetMeta(MetaPushAck, "1"))
+	backoff := opts.Backoff
+	for attempt := 0; ; attempt++ {
+		stat := s.push(seq, serviceMethod, args, setting)
+		if stat.OK() {
+			timer := time.NewTimer(opts.AckTimeout)
+			select {
+			case <-ackCh:
+				timer.Stop()
+				return nil
+			case <-s.CloseNotify():
+				timer.Stop()
+				return statConnClosed
+			case <-timer.C:
+				stat = statAckTimeout.Copy("push seq " + formatSeq(seq))
+			}
+		}
+		if attempt >= opts.MaxRetries {
+			return stat
+		}
+		Debugf("retry the reliable push (seq:%d, attempt:%d): %s", seq, attempt+1, stat.String())
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ackCh:
+			timer.Stop()
+			return nil
+		case <-s.CloseNotify():
+			timer.Stop()
+			return statConnClosed
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > opts.MaxBackoff {
+			backoff = opts.MaxBackoff
+		}
+	}
+}
+
+// ackPush wakes up the reliable push waiting for the acknowledgement.
+func (s *session) ackPush(seqBytes []byte) {
+	seq, err := parseSeq(seqBytes)
+	if err != nil {
+		return
+	}
+	if ackCh, ok := s.pushAcks.LoadAndDelete(seq); ok {
+		close(ackCh.(chan struct{}))
+	}
+}
+
+// sendPushAck acknowledges the reliable push to the sender.
+func (s *session) sendPushAck(seq uint64) {
+	if stat := s.RawPush(AckServiceMethod, nil, WithSetMeta(MetaAckSeq, formatSeq(seq))); !stat.OK() {
+		Debugf("acknowledge the push: %s", stat.String())
+	}
+}
@@ -0,0 +1,57 @@
+package erpc_test
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var reliablePushed int32
+
+// reliable_notify sleeps 300ms at the first time.
+func reliable_notify(ctx erpc.PushCtx, _ *int) *erpc.Status {
+	if atomic.AddInt32(&reliablePushed, 1) == 1 {
+		time.Sleep(300 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestPushReliable(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{})
+	defer srv.Close()
+	srv.RoutePushFunc(reliable_notify)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	time.Sleep(100 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	// the first attempt is not acknowledged in time, the retry is
+	opts := erpc.PushReliableOptions{AckTimeout: 100 * time.Millisecond, Backoff: 50 * time.Millisecond}
+	if stat = sess.PushReliable("/reliable/notify", 1, opts); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if n := atomic.LoadInt32(&reliablePushed); n < 2 {
+		t.Fatalf("pushed: %d, expect retried", n)
+	}
+
+	// the push to the unknown service method is acknowledged too
+	if stat = sess.PushReliable("/reliable/unknown", 1, opts); !stat.OK() {
+		t.Fatal(stat)
+	}
+
+	// no retry
+	atomic.StoreInt32(&reliablePushed, 0)
+	opts.MaxRetries = -1
+	if stat = sess.PushReliable("/reliable/notify", 1, opts); stat.Code() != erpc.CodeAckTimeout {
+		t.Fatalf("expect ack timeout, got %v", stat)
+	}
+}
@@ -21,7 +21,17 @@ func InheritedListen(network, laddr string, tlsConf *tls.Config, config *quic.Co
 	if err != nil {
 		return nil, err
 	}
-	return globalInheritQUIC.InheritedListen(network, udpAddr, tlsConf, config)
+	return globalInheritQUIC.InheritedListen(network, udpAddr, tlsConf, config, false)
+}
+
+// InheritedListenEarly works like InheritedListen, but it accepts the 0-RTT connections.
+// NOTE: The 0-RTT data can be replayed by the attackers.
+func InheritedListenEarly(network, laddr string, tlsConf *tls.Config, config *quic.Config) (net.Listener, error) {
+	udpAddr, err := net.ResolveUDPAddr(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+	return globalInheritQUIC.InheritedListen(network, udpAddr, tlsConf, config, true)
 }
 
 // SetInherited adds the files and envs to be inherited by the new process.
@@ -101,7 +111,7 @@ func (n *inheritQUIC) inherit() error {
 // InheritedListen announces on the local network address laddr.
 // It returns an inherited net.Listener for the matching address,
 // or creates a new one.
-func (n *inheritQUIC) InheritedListen(network string, udpAddr *net.UDPAddr, tlsConf *tls.Config, config *quic.Config) (*Listener, error) {
+func (n *inheritQUIC) InheritedListen(network string, udpAddr *net.UDPAddr, tlsConf *tls.Config, config *quic.Config, early bool) (*Listener, error) {
 	if err := n.inherit(); err != nil {
 		return nil, err
 	}
@@ -126,9 +136,9 @@ func (n *inheritQUIC) InheritedListen(network string, udpAddr *net.UDPAddr, tlsC
 	var l *Listener
 	var err error
 	if udpConn == nil {
-		l, err = ListenUDPAddr(network, udpAddr, tlsConf, config)
+		l, err = listenUDPAddr(network, udpAddr, tlsConf, config, early)
 	} else {
-		l, err = Listen(udpConn, tlsConf, config)
+		l, err = listen(udpConn, tlsConf, config, early)
 	}
 	if err != nil {
 		return nil, err
@@ -13,6 +13,19 @@ import (
 // It uses a new UDP connection and closes this connection when the QUIC session is closed.
 // The hostname for SNI is taken from the given address.
 func DialAddrContext(ctx context.Context, network string, laddr *net.UDPAddr, raddr string, tlsConf *tls.Config, config *quic.Config) (net.Conn, error) {
+	return dialAddrContext(ctx, network, laddr, raddr, tlsConf, config, false)
+}
+
+// DialAddrEarlyContext establishes a new 0-RTT QUIC connection to a server.
+// NOTE:
+//  The 0-RTT resumption needs the tls.Config.ClientSessionCache shared by the dials,
+//  and the server listening by ListenEarly;
+//  The 0-RTT data can be replayed by the attackers, so only the idempotent messages should be sent early.
+func DialAddrEarlyContext(ctx context.Context, network string, laddr *net.UDPAddr, raddr string, tlsConf *tls.Config, config *quic.Config) (net.Conn, error) {
+	return dialAddrContext(ctx, network, laddr, raddr, tlsConf, config, true)
+}
+
+func dialAddrContext(ctx context.Context, network string, laddr *net.UDPAddr, raddr string, tlsConf *tls.Config, config *quic.Config, early bool) (net.Conn, error) {
 	host, port, err := net.SplitHostPort(raddr)
 	if err != nil {
 		return nil, err
@@ -28,7 +41,12 @@ func DialAddrContext(ctx context.Context, network string, laddr *net.UDPAddr, ra
 	if err != nil {
 		return nil, err
 	}
-	sess, err := quic.DialContext(ctx, udpConn, udpAddr, raddr, tlsConf, config)
+	var sess quic.Session
+	if early {
+		sess, err = quic.DialEarlyContext(ctx, udpConn, udpAddr, raddr, tlsConf, config)
+	} else {
+		sess, err = quic.DialContext(ctx, udpConn, udpAddr, raddr, tlsConf, config)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -67,11 +85,15 @@ func ListenAddr(network, addr string, tlsConf *tls.Config, config *quic.Config)
 // The tls.Config must not be nil and must contain a certificate configuration.
 // The quic.Config may be nil, in that case the default values will be used.
 func ListenUDPAddr(network string, udpAddr *net.UDPAddr, tlsConf *tls.Config, config *quic.Config) (*Listener, error) {
+	return listenUDPAddr(network, udpAddr, tlsConf, config, false)
+}
+
+func listenUDPAddr(network string, udpAddr *net.UDPAddr, tlsConf *tls.Config, config *quic.Config, early bool) (*Listener, error) {
 	conn, err := net.ListenUDP(network, udpAddr)
 	if err != nil {
 		return nil, err
 	}
-	return Listen(conn, tlsConf, config)
+	return listen(conn, tlsConf, config, early)
 }
 
 // Listen listens for QUIC connections on a given net.PacketConn.
@@ -81,12 +103,32 @@ func ListenUDPAddr(network string, udpAddr *net.UDPAddr, tlsConf *tls.Config, co
 // The tls.Config must not be nil and must contain a certificate configuration.
 // The quic.Config may be nil, in that case the default values will be used.
 func Listen(conn net.PacketConn, tlsConf *tls.Config, config *quic.Config) (*Listener, error) {
+	return listen(conn, tlsConf, config, false)
+}
+
+// ListenEarly works like Listen, but it accepts the 0-RTT connections.
+// NOTE: The 0-RTT data can be replayed by the attackers.
+func ListenEarly(conn net.PacketConn, tlsConf *tls.Config, config *quic.Config) (*Listener, error) {
+	return listen(conn, tlsConf, config, true)
+}
+
+func listen(conn net.PacketConn, tlsConf *tls.Config, config *quic.Config, early bool) (*Listener, error) {
 	if config == nil {
 		config = &quic.Config{KeepAlive: true}
 	}
-	lis, err := quic.Listen(conn, tlsConf, config)
-	if err != nil {
-		return nil, err
+	var lis quic.Listener
+	if early {
+		earlyLis, err := quic.ListenEarly(conn, tlsConf, config)
+		if err != nil {
+			return nil, err
+		}
+		lis = earlyListener{earlyLis}
+	} else {
+		var err error
+		lis, err = quic.Listen(conn, tlsConf, config)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return &Listener{
 		lis:  lis,
@@ -94,6 +136,15 @@ func Listen(conn net.PacketConn, tlsConf *tls.Config, config *quic.Config) (*Lis
 	}, nil
 }
 
+// earlyListener adapts the quic.EarlyListener to the quic.Listener.
+type earlyListener struct {
+	quic.EarlyListener
+}
+
+func (l earlyListener) Accept(ctx context.Context) (quic.Session, error) {
+	return l.EarlyListener.Accept(ctx)
+}
+
 // PacketConn returns the net.PacketConn.
 func (l *Listener) PacketConn() net.PacketConn {
 	return l.conn
@@ -208,3 +259,21 @@ func (c *Conn) SetReadDeadline(t time.Time) error {
 func (c *Conn) SetWriteDeadline(t time.Time) error {
 	return c.stream.SetWriteDeadline(t)
 }
+
+// SupportsDatagrams returns whether both sides enabled the unreliable DATAGRAM support,
+// i.e. quic.Config.EnableDatagrams.
+// NOTE: It blocks until the handshake completes.
+func (c *Conn) SupportsDatagrams() bool {
+	return c.sess.ConnectionState().SupportsDatagrams
+}
+
+// SendDatagram sends the data as an unreliable DATAGRAM frame.
+// NOTE: It returns an error if the data does not fit in one QUIC packet.
+func (c *Conn) SendDatagram(b []byte) error {
+	return c.sess.SendMessage(b)
+}
+
+// ReceiveDatagram waits for and returns the data of the next DATAGRAM frame.
+func (c *Conn) ReceiveDatagram() ([]byte, error) {
+	return c.sess.ReceiveMessage()
+}
@@ -0,0 +1,113 @@
+package erpc
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// datagramPipe the pipe connection with the fake unreliable datagrams.
+type datagramPipe struct {
+	pipeConn
+	in, out chan []byte
+	sent    int32
+}
+
+func (c *datagramPipe) SupportsDatagrams() bool { return true }
+
+func (c *datagramPipe) SendDatagram(b []byte) error {
+	if len(b) > 1200 {
+		return errors.New("message too large")
+	}
+	atomic.AddInt32(&c.sent, 1)
+	c.out <- append([]byte(nil), b...)
+	return nil
+}
+
+func (c *datagramPipe) ReceiveDatagram() ([]byte, error) {
+	b, ok := <-c.in
+	if !ok {
+		return nil, errors.New("closed")
+	}
+	return b, nil
+}
+
+type datagramPush struct {
+	PushCtx
+}
+
+var datagramPushed = make(chan string, 16)
+
+func (q *datagramPush) Datagram(arg *string) *Status {
+	datagramPushed <- string(q.PeekMeta(MetaDatagram)) + ":" + (*arg)[:5]
+	return nil
+}
+
+func TestQUICConfig(t *testing.T) {
+	cfg := PeerConfig{QUICIdleTimeout: time.Minute, QUICMaxStreams: 8, QUICDatagrams: true}
+	srvCfg, cliCfg := cfg.quicConfig(true), cfg.quicConfig(false)
+	if !srvCfg.KeepAlive || cliCfg.KeepAlive {
+		t.Fatalf("keepalive: server %v, client %v", srvCfg.KeepAlive, cliCfg.KeepAlive)
+	}
+	if srvCfg.MaxIdleTimeout != time.Minute || srvCfg.MaxIncomingStreams != 8 || !srvCfg.EnableDatagrams {
+		t.Fatalf("config: %+v", srvCfg)
+	}
+	cfg = PeerConfig{QUICIdleTimeout: -1, QUICKeepAlive: -1, QUICMaxStreams: -1}
+	if c := cfg.quicConfig(true); c.KeepAlive || c.MaxIdleTimeout != 0 || c.MaxIncomingStreams != 0 {
+		t.Fatalf("config: %+v", c)
+	}
+}
+
+func TestWithDatagram(t *testing.T) {
+	srv := NewPeer(PeerConfig{})
+	defer srv.Close()
+	srv.RoutePush(new(datagramPush))
+	cli := NewPeer(PeerConfig{})
+	defer cli.Close()
+
+	c1, c2 := net.Pipe()
+	d1, d2 := make(chan []byte, 16), make(chan []byte, 16)
+	defer close(d1)
+	defer close(d2)
+	srvConn := &datagramPipe{pipeConn: pipeConn{Conn: c1, local: "datagram-server", remote: "datagram-client"}, in: d1, out: d2}
+	cliConn := &datagramPipe{pipeConn: pipeConn{Conn: c2, local: "datagram-client", remote: "datagram-server"}, in: d2, out: d1}
+	if _, stat := srv.ServeConn(srvConn); !stat.OK() {
+		t.Fatal(stat)
+	}
+	sess, stat := cli.ServeConn(cliConn)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+
+	small := "small"
+	big := "large" + string(make([]byte, 2000))
+	for _, arg := range []string{small, big, small} {
+		if stat = sess.Push("/datagram_push/datagram", arg, WithDatagram()); !stat.OK() {
+			t.Fatal(stat)
+		}
+		select {
+		case s := <-datagramPushed:
+			if s != "1:"+arg[:5] {
+				t.Fatalf("pushed: %q", s)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("the push is lost")
+		}
+	}
+	// the large one falls back to the stream
+	if n := atomic.LoadInt32(&cliConn.sent); n != 2 {
+		t.Fatalf("datagrams: %d, expect 2", n)
+	}
+	// only with WithDatagram
+	if stat = sess.Push("/datagram_push/datagram", small); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if s := <-datagramPushed; s != ":small" {
+		t.Fatalf("pushed: %q", s)
+	}
+	if n := atomic.LoadInt32(&cliConn.sent); n != 2 {
+		t.Fatalf("datagrams: %d, expect 2", n)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"github.com/andeya/erpc/v7/socket"
+)
+
+// RouteReadLimit returns the plugin limiting the max size of the CALL and PUSH messages of the routes it is registered with,
+// e.g. by RouteCall, RoutePush or SubRoute, and the smallest of it, the global SetReadLimit,
+// PeerConfig.ReadLimit and Session.SetReadLimit applies.
+// NOTE:
+//  The message exceeding it is replied or dropped with the bad message status without executing the handler;
+//  The larger limits of the peer and the session are required by the route accepting the larger messages,
+//  e.g. a file upload route, whose size is only checked after the header is read,
+//  while the other routes are limited by the plugin of their SubRoute;
+//  The fragmented message is limited by its reassembled size, see PeerConfig.FragmentSize.
+func RouteReadLimit(maxSize uint32) Plugin {
+	return routeReadLimit(maxSize)
+}
+
+type routeReadLimit uint32
+
+var (
+	_ PreReadCallBodyPlugin = routeReadLimit(0)
+	_ PreReadPushBodyPlugin = routeReadLimit(0)
+)
+
+func (routeReadLimit) Name() string {
+	return "route-read-limit"
+}
+
+func (r routeReadLimit) PreReadCallBody(ctx ReadCtx) *Status {
+	return r.limit(ctx)
+}
+
+func (r routeReadLimit) PreReadPushBody(ctx ReadCtx) *Status {
+	return r.limit(ctx)
+}
+
+// limit checks the size of the message read, and limits the continuation frames of it.
+func (r routeReadLimit) limit(ctx ReadCtx) *Status {
+	if r == 0 {
+		return nil
+	}
+	input := ctx.Input()
+	if input.Size() > uint32(r) {
+		return statBadMessage.Copy(socket.ErrExceedMessageSizeLimit)
+	}
+	socket.WithReadLimit(uint32(r))(input)
+	return nil
+}
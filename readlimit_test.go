@@ -0,0 +1,75 @@
+package erpc_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/andeya/erpc/v7"
+)
+
+func readLimitEcho(ctx erpc.CallCtx, arg *[]byte) ([]byte, *erpc.Status) {
+	return []byte("ok"), nil
+}
+
+func TestReadLimit(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{ReadLimit: 100000})
+	defer srv.Close()
+	srv.RouteCallFunc(readLimitEcho)
+	srv.SubRoute("/api", erpc.RouteReadLimit(1000)).RouteCallFunc(readLimitEcho)
+	cli := erpc.NewPeer(erpc.PeerConfig{FragmentSize: 512})
+	defer cli.Close()
+	sess, stat := erpc.ConnectPipe(srv, cli)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	call := func(sess erpc.Session, serviceMethod string, size int) *erpc.Status {
+		var reply []byte
+		return sess.Call(serviceMethod, bytes.Repeat([]byte{'x'}, size), &reply).Status()
+	}
+	expect := func(stat *erpc.Status, ok bool) {
+		t.Helper()
+		if stat.OK() != ok {
+			t.Fatalf("expect ok %v, got %v", ok, stat)
+		}
+		if !ok && stat.Code() != erpc.CodeBadMessage {
+			t.Fatalf("expect the bad message, got %v", stat)
+		}
+	}
+
+	// the upload route accepts the large message of the peer limit, and the routes of /api are limited
+	expect(call(sess, "/read_limit_echo", 50000), true)
+	expect(call(sess, "/api/read_limit_echo", 500), true)
+	expect(call(sess, "/api/read_limit_echo", 5000), false)
+	expect(call(sess, "/api/read_limit_echo", 500), true)
+
+	// the unfragmented message is checked after the header is read
+	cli2 := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli2.Close()
+	sess2, stat := erpc.ConnectPipe(srv, cli2)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	expect(call(sess2, "/api/read_limit_echo", 5000), false)
+	expect(call(sess2, "/read_limit_echo", 5000), true)
+
+	// the session limit is capped by the peer limit
+	srvSess, ok := srv.GetSession(sess.LocalAddr().String())
+	if !ok {
+		t.Fatal("server session not found")
+	}
+	srvSess.SetReadLimit(20000)
+	if limit := srvSess.ReadLimit(); limit != 20000 {
+		t.Fatalf("read limit: %d", limit)
+	}
+	expect(call(sess, "/read_limit_echo", 50000), false)
+	expect(call(sess, "/read_limit_echo", 10000), true)
+	srvSess.SetReadLimit(200000)
+	if limit := srvSess.ReadLimit(); limit != 100000 {
+		t.Fatalf("read limit: %d", limit)
+	}
+	srvSess.SetReadLimit(0)
+	if limit := srvSess.ReadLimit(); limit != 100000 {
+		t.Fatalf("read limit: %d", limit)
+	}
+	expect(call(sess, "/read_limit_echo", 50000), true)
+}
@@ -0,0 +1,73 @@
+package erpc
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andeya/erpc/v7/codec"
+)
+
+// scopedCodec the JSON codec with the tag prefix, which rejects the body of the other tags.
+type scopedCodec byte
+
+func (scopedCodec) ID() byte     { return 200 }
+func (scopedCodec) Name() string { return "scoped" }
+func (c scopedCodec) Marshal(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	return append([]byte{byte(c)}, b...), err
+}
+func (c scopedCodec) Unmarshal(data []byte, v interface{}) error {
+	if data[0] != byte(c) {
+		return errors.New("wrong scoped codec")
+	}
+	return json.Unmarshal(data[1:], v)
+}
+
+// xorFilter the transfer filter xoring the bytes with the key.
+type xorFilter byte
+
+func (xorFilter) ID() byte     { return 201 }
+func (xorFilter) Name() string { return "xor" }
+func (f xorFilter) OnPack(b []byte) ([]byte, error) {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[i] = b[i] ^ byte(f)
+	}
+	return r, nil
+}
+func (f xorFilter) OnUnpack(b []byte) ([]byte, error) { return f.OnPack(b) }
+
+func registry_echo(ctx CallCtx, arg *string) (string, *Status) {
+	return *arg + "@" + strconv.Itoa(int(ctx.GetBodyCodec())) + "@" + strings.Join(ctx.Input().XferPipe().Names(), ","), nil
+}
+
+func TestScopedRegistries(t *testing.T) {
+	if _, err := codec.Get(200); err == nil {
+		t.Fatal("expect the codec 200 not registered globally")
+	}
+	for _, tag := range []byte{'a', 'b'} {
+		cfg := PeerConfig{DefaultBodyCodec: "scoped", CompressFilter: "xor", AutoCompressBytes: 1}
+		srv := NewPeer(cfg, WithCodecs(scopedCodec(tag)), WithXferFilters(xorFilter(tag)))
+		defer srv.Close()
+		srv.RouteCallFunc(registry_echo)
+		cli := NewPeer(cfg, WithCodecs(scopedCodec(tag)), WithXferFilters(xorFilter(tag)))
+		defer cli.Close()
+		if c, _ := cli.Codecs().Get(200); c != scopedCodec(tag) {
+			t.Fatalf("codec: %v", c)
+		}
+		sess, stat := ConnectPipe(srv, cli)
+		if !stat.OK() {
+			t.Fatal(stat)
+		}
+		var reply string
+		if stat = sess.Call("/registry/echo", "hi", &reply).Status(); !stat.OK() || reply != "hi@200@xor" {
+			t.Fatalf("tag %c reply: %q, stat: %v", tag, reply, stat)
+		}
+	}
+	if _, err := codec.Get(200); err == nil {
+		t.Fatal("expect the scoped codec not leaked to the globals")
+	}
+}
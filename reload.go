@@ -0,0 +1,153 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// hotReloadFields the fields of PeerConfig applied to the running peer by Reload.
+var hotReloadFields = map[string]bool{
+	"SlowCometDuration": true,
+	"PrintDetail":       true,
+	"CountTime":         true,
+	"MaxConnections":    true,
+	"AcceptRateLimit":   true,
+	"RejectWithStatus":  true,
+	"ReadBps":           true,
+	"WriteBps":          true,
+	"SessionReadBps":    true,
+	"SessionWriteBps":   true,
+	"LogLevel":          true,
+}
+
+// Reload applies the config to the running peer without reconnecting the sessions,
+// and returns the changed fields that require restarting the peer, which are not applied.
+// NOTE:
+//  The fields applied are SlowCometDuration, PrintDetail, CountTime, MaxConnections, AcceptRateLimit,
+//  RejectWithStatus, ReadBps, WriteBps, SessionReadBps, SessionWriteBps and LogLevel;
+//  The new SessionReadBps and SessionWriteBps also apply to the existing sessions whose bandwidth is the old default,
+//  and not to the ones changed by Session.SetBandwidth;
+//  It emits EventConfigReloaded with the fields that require restarting the peer.
+func (p *peer) Reload(cfg PeerConfig) (restart []string, err error) {
+	cfg.checked = false
+	if err = cfg.check(); err != nil {
+		return nil, err
+	}
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+	old := p.config
+	restart = restartFields(&old, &cfg)
+
+	atomic.StoreInt64(&p.slowCometDuration, int64(cfg.slowCometDuration))
+	atomic.StoreInt32(&p.printDetail, boolToInt32(cfg.PrintDetail))
+	atomic.StoreInt32(&p.countTime, boolToInt32(cfg.CountTime))
+	p.acceptLimiter.set(&cfg)
+	if cfg.ReadBps != old.ReadBps || cfg.WriteBps != old.WriteBps {
+		p.SetBandwidth(cfg.ReadBps, cfg.WriteBps)
+	}
+	if cfg.SessionReadBps != old.SessionReadBps || cfg.SessionWriteBps != old.SessionWriteBps {
+		atomic.StoreInt64(&p.sessionReadBps, cfg.SessionReadBps)
+		atomic.StoreInt64(&p.sessionWriteBps, cfg.SessionWriteBps)
+		p.sessHub.sessions.Range(func(_, value interface{}) bool {
+			s := value.(*session)
+			if s.readLimiter.Rate() == nonNegative(old.SessionReadBps) {
+				s.readLimiter.SetRate(cfg.SessionReadBps)
+			}
+			if s.writeLimiter.Rate() == nonNegative(old.SessionWriteBps) {
+				s.writeLimiter.SetRate(cfg.SessionWriteBps)
+			}
+			return true
+		})
+	}
+	setLogLevel(cfg.LogLevel)
+
+	// keep the fields that are not applied, to report them again by the next reload
+	v, o := reflect.ValueOf(&cfg).Elem(), reflect.ValueOf(&old).Elem()
+	for _, name := range restart {
+		v.FieldByName(name).Set(o.FieldByName(name))
+	}
+	p.config = cfg
+	if len(restart) > 0 {
+		Warnf("reload config: the changed fields require restarting the peer: %v", restart)
+	}
+	p.events.emit(Event{Type: EventConfigReloaded, Network: p.network, Restart: restart})
+	return restart, nil
+}
+
+// restartFields returns the changed exported fields that are not applied by Reload, in the order of declaration.
+func restartFields(old, cfg *PeerConfig) []string {
+	var fields []string
+	o, v := reflect.ValueOf(old).Elem(), reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || hotReloadFields[f.Name] {
+			continue
+		}
+		if !reflect.DeepEqual(o.Field(i).Interface(), v.Field(i).Interface()) {
+			fields = append(fields, f.Name)
+		}
+	}
+	return fields
+}
+
+// setLogLevel sets the level of the global logger, if not empty.
+func setLogLevel(level string) {
+	if l, ok := parseLoggerLevel(level); ok {
+		SetLoggerLevel2(l)
+	}
+}
+
+// slowComet returns the slow operation alarm threshold.
+func (p *peer) slowComet() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p.slowCometDuration))
+}
+
+// timeNow returns the unix nanoseconds if CountTime, otherwise 0.
+func (p *peer) timeNow() int64 {
+	if atomic.LoadInt32(&p.countTime) == 0 {
+		return 0
+	}
+	return time.Now().UnixNano()
+}
+
+// costSince returns the cost since the start of timeNow, 0 if CountTime is changed meanwhile.
+func (p *peer) costSince(start int64) time.Duration {
+	if start == 0 {
+		return 0
+	}
+	now := p.timeNow()
+	if now == 0 {
+		return 0
+	}
+	return time.Duration(now - start)
+}
+
+func boolToInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func nonNegative(n int64) int64 {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
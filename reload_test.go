@@ -0,0 +1,78 @@
+package erpc
+
+import (
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReload(t *testing.T) {
+	defer SetLoggerLevel2(GetLoggerLevel())
+	cfg := PeerConfig{ListenPort: 9131, MaxConnections: 1, SessionReadBps: 1000}
+	srv := NewPeer(cfg)
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+	reloaded := make(chan Event, 1)
+	srv.OnEvent(func(e Event) {
+		if e.Type == EventConfigReloaded {
+			reloaded <- e
+		}
+	})
+
+	cli := NewPeer(PeerConfig{})
+	defer cli.Close()
+	if _, stat := cli.Dial(":9131"); !stat.OK() {
+		t.Fatal(stat)
+	}
+	time.Sleep(100 * time.Millisecond)
+	var sess Session
+	srv.RangeSession(func(s Session) bool {
+		sess = s
+		return false
+	})
+
+	if _, err := srv.Reload(PeerConfig{LogLevel: "verbose"}); err == nil {
+		t.Fatal("expect the invalid log level failed")
+	}
+	cfg.MaxConnections = 2
+	cfg.CountTime = true
+	cfg.SlowCometDuration = time.Second
+	cfg.SessionReadBps = 2000
+	cfg.LogLevel = "warning"
+	cfg.ListenPort = 9132
+	restart, err := srv.Reload(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restart, []string{"ListenPort"}) {
+		t.Fatalf("restart: %v", restart)
+	}
+	select {
+	case e := <-reloaded:
+		if !reflect.DeepEqual(e.Restart, restart) {
+			t.Fatalf("event: %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no config reloaded event")
+	}
+	p := srv.(*peer)
+	if atomic.LoadInt32(&p.countTime) != 1 || p.slowComet() != time.Second || GetLoggerLevel() != WARNING {
+		t.Fatal("not applied")
+	}
+	if rate := sess.(*session).readLimiter.Rate(); rate != 2000 {
+		t.Fatalf("session read bps: %d", rate)
+	}
+
+	// the new max connections applies to the running listener
+	if _, stat := cli.Dial(":9131"); !stat.OK() {
+		t.Fatal(stat)
+	}
+
+	// the field requiring restart is reported again
+	if restart, _ = srv.Reload(cfg); !reflect.DeepEqual(restart, []string{"ListenPort"}) {
+		t.Fatalf("restart: %v", restart)
+	}
+	<-reloaded
+}
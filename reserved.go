@@ -0,0 +1,197 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andeya/erpc/v7/socket"
+	"github.com/andeya/goutil"
+)
+
+const (
+	// MetaReservedPrefix the prefix of the metadata keys reserved for the framework, case-insensitive.
+	// NOTE:
+	//  The user writes to them by WithAddMeta, WithSetMeta, CallCtx.AddMeta and CallCtx.SetMeta are ignored;
+	//  They are read by the typed accessors, e.g. ctx.Deadline() and ctx.TraceContext().
+	MetaReservedPrefix = "erpc-"
+	// MetaDeadline the key of the remaining milliseconds before the deadline of the caller's context,
+	// it is set by the framework automatically for the CALL and PUSH.
+	MetaDeadline = "erpc-deadline"
+	// MetaTraceParent the key of the trace context in the W3C traceparent format, see WithTraceContext
+	MetaTraceParent = "erpc-traceparent"
+)
+
+// IsReservedMeta returns whether the metadata key is reserved for the framework.
+func IsReservedMeta(key string) bool {
+	return len(key) >= len(MetaReservedPrefix) && strings.EqualFold(key[:len(MetaReservedPrefix)], MetaReservedPrefix)
+}
+
+// WithAddMeta adds 'key=value' metadata argument.
+// Multiple values for the same key may be added.
+// SUGGEST: urlencoded string max len ≤ 65535!
+// NOTE: The reserved key of MetaReservedPrefix is ignored.
+func WithAddMeta(key, value string) MessageSetting {
+	if IsReservedMeta(key) {
+		Warnf("ignored the reserved metadata key: %s", key)
+		return socket.WithNothing()
+	}
+	return socket.WithAddMeta(key, value)
+}
+
+// WithSetMeta sets 'key=value' metadata argument.
+// SUGGEST: urlencoded string max len ≤ 65535!
+// NOTE: The reserved key of MetaReservedPrefix is ignored.
+func WithSetMeta(key, value string) MessageSetting {
+	if IsReservedMeta(key) {
+		Warnf("ignored the reserved metadata key: %s", key)
+		return socket.WithNothing()
+	}
+	return socket.WithSetMeta(key, value)
+}
+
+// WithAddMetaBytes adds 'key=value' metadata argument, the value is copied.
+// Multiple values for the same key may be added.
+// NOTE:
+//  The binary value is sent without the urlencoding by the raw proto, if the key has the MetaBinarySuffix;
+//  The reserved key of MetaReservedPrefix is ignored.
+func WithAddMetaBytes(key string, value []byte) MessageSetting {
+	if IsReservedMeta(key) {
+		Warnf("ignored the reserved metadata key: %s", key)
+		return socket.WithNothing()
+	}
+	return socket.WithAddMetaBytes(key, value)
+}
+
+// WithSetMetaBytes sets 'key=value' metadata argument, the value is copied.
+// NOTE:
+//  The binary value is sent without the urlencoding by the raw proto, if the key has the MetaBinarySuffix;
+//  The reserved key of MetaReservedPrefix is ignored.
+func WithSetMetaBytes(key string, value []byte) MessageSetting {
+	if IsReservedMeta(key) {
+		Warnf("ignored the reserved metadata key: %s", key)
+		return socket.WithNothing()
+	}
+	return socket.WithSetMetaBytes(key, value)
+}
+
+// TraceContext the distributed trace context carried by MetaTraceParent.
+type TraceContext struct {
+	// TraceID the id of the whole trace
+	TraceID [16]byte
+	// SpanID the id of the parent span
+	SpanID [8]byte
+	// Flags the trace flags, e.g. 0x01 sampled
+	Flags byte
+}
+
+var errBadTraceParent = errors.New("invalid traceparent")
+
+// ParseTraceContext parses the trace context in the W3C traceparent format,
+// i.e. '00-{32 hex trace id}-{16 hex span id}-{2 hex flags}'.
+func ParseTraceContext(s string) (TraceContext, error) {
+	var tc TraceContext
+	if len(s) != 55 || s[:3] != "00-" || s[35] != '-' || s[52] != '-' {
+		return tc, errBadTraceParent
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(tc.TraceID[:], []byte(s[3:35])); err != nil {
+		return tc, errBadTraceParent
+	}
+	if _, err := hex.Decode(tc.SpanID[:], []byte(s[36:52])); err != nil {
+		return tc, errBadTraceParent
+	}
+	if _, err := hex.Decode(flags[:], []byte(s[53:])); err != nil {
+		return tc, errBadTraceParent
+	}
+	tc.Flags = flags[0]
+	if !tc.IsValid() {
+		return tc, errBadTraceParent
+	}
+	return tc, nil
+}
+
+// IsValid returns whether both the trace id and the span id are non-zero.
+func (tc TraceContext) IsValid() bool {
+	return tc.TraceID != [16]byte{} && tc.SpanID != [8]byte{}
+}
+
+// String returns the trace context in the W3C traceparent format.
+func (tc TraceContext) String() string {
+	var b [55]byte
+	copy(b[:], "00-")
+	hex.Encode(b[3:35], tc.TraceID[:])
+	b[35] = '-'
+	hex.Encode(b[36:52], tc.SpanID[:])
+	b[52] = '-'
+	hex.Encode(b[53:], []byte{tc.Flags})
+	return string(b[:])
+}
+
+// WithTraceContext sets the trace context of the CALL or PUSH, read by ctx.TraceContext() of the receiver.
+// NOTE: The invalid trace context deletes it.
+func WithTraceContext(tc TraceContext) MessageSetting {
+	if !tc.IsValid() {
+		return socket.WithDelMeta(MetaTraceParent)
+	}
+	return socket.WithSetMeta(MetaTraceParent, tc.String())
+}
+
+// withDeadline sets the remaining milliseconds before the deadline of the output context by the peer clock.
+func (s *session) withDeadline(output Message) {
+	deadline, ok := output.Context().Deadline()
+	if !ok {
+		return
+	}
+	ms := int64(deadline.Sub(s.peer.clock.Now()) / time.Millisecond)
+	if ms <= 0 {
+		ms = 1
+	}
+	output.Meta().Set(MetaDeadline, strconv.FormatInt(ms, 10))
+}
+
+// bindDeadline records the deadline of the received CALL or PUSH by the peer clock.
+func (c *handlerCtx) bindDeadline(header Header) {
+	s := header.Meta().Peek(MetaDeadline)
+	if len(s) == 0 {
+		return
+	}
+	ms, err := strconv.ParseInt(goutil.BytesToString(s), 10, 64)
+	if err != nil || ms <= 0 {
+		return
+	}
+	c.deadline = c.sess.peer.clock.Now().Add(time.Duration(ms) * time.Millisecond).UnixNano()
+}
+
+// Deadline returns the deadline of the caller's context, converted to the local clock when received.
+// NOTE:
+//  The network transit is not subtracted, so it is a little later than the caller's;
+//  ok==false if the caller's context has no deadline.
+func (c *handlerCtx) Deadline() (deadline time.Time, ok bool) {
+	if c.deadline == 0 {
+		return
+	}
+	return time.Unix(0, c.deadline), true
+}
+
+// TraceContext returns the trace context of the input message, set by WithTraceContext.
+func (c *handlerCtx) TraceContext() (TraceContext, bool) {
+	tc, err := ParseTraceContext(goutil.BytesToString(c.PeekMeta(MetaTraceParent)))
+	return tc, err == nil
+}
@@ -0,0 +1,80 @@
+package erpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+)
+
+func TestReservedMeta(t *testing.T) {
+	if !erpc.IsReservedMeta("ERPC-Deadline") || erpc.IsReservedMeta("X-Erpc") || erpc.IsReservedMeta("erpc") {
+		t.Fatal("wrong reserved metadata keys")
+	}
+	tc := erpc.TraceContext{Flags: 1}
+	copy(tc.TraceID[:], "0123456789abcdef")
+	copy(tc.SpanID[:], "01234567")
+	if parsed, err := erpc.ParseTraceContext(tc.String()); err != nil || parsed != tc {
+		t.Fatalf("parsed: %v, err: %v", parsed, err)
+	}
+	if _, err := erpc.ParseTraceContext("00-" + tc.String()[3:52] + "-zz"); err == nil {
+		t.Fatal("expect the invalid traceparent error")
+	}
+
+	srv := erpc.NewPeer(erpc.PeerConfig{})
+	defer srv.Close()
+	type result struct {
+		deadline time.Time
+		hasDL    bool
+		tc       erpc.TraceContext
+		hasTC    bool
+		user     string
+	}
+	results := make(chan result, 2)
+	srv.RouteCallFunc(func(ctx erpc.CallCtx, arg *string) (string, *erpc.Status) {
+		var r result
+		r.deadline, r.hasDL = ctx.Deadline()
+		r.tc, r.hasTC = ctx.TraceContext()
+		r.user = string(ctx.PeekMeta(erpc.MetaReservedPrefix + "user"))
+		results <- r
+		ctx.SetMeta(erpc.MetaTraceParent, "reply")
+		return *arg, nil
+	})
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := erpc.ConnectPipe(srv, cli)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+
+	// the user writes to the reserved keys are ignored
+	var reply string
+	cmd := sess.Call("/func1", "hello", &reply,
+		erpc.WithSetMeta(erpc.MetaReservedPrefix+"user", "1"),
+		erpc.WithAddMeta(erpc.MetaTraceParent, tc.String()),
+	)
+	if stat = cmd.Status(); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if r := <-results; r.hasDL || r.hasTC || r.user != "" {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+	if v := cmd.InputMeta().Peek(erpc.MetaTraceParent); len(v) != 0 {
+		t.Fatalf("unexpected reply metadata: %q", v)
+	}
+
+	// the deadline and trace context are propagated by the framework
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if stat = sess.Call("/func1", "hello", &reply, erpc.WithContext(ctx), erpc.WithTraceContext(tc)).Status(); !stat.OK() {
+		t.Fatal(stat)
+	}
+	r := <-results
+	if !r.hasTC || r.tc != tc {
+		t.Fatalf("trace context: %v, %v", r.tc, r.hasTC)
+	}
+	if want, _ := ctx.Deadline(); !r.hasDL || r.deadline.After(want.Add(time.Second)) || r.deadline.Before(want.Add(-time.Second)) {
+		t.Fatalf("deadline: %v, want: %v", r.deadline, want)
+	}
+}
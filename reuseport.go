@@ -0,0 +1,107 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"context"
+	"net"
+	"syscall"
+)
+
+func isTCP(network string) bool {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return true
+	default:
+		return false
+	}
+}
+
+// listenTCP listens on the tcp address by PeerConfig.ReusePort and PeerConfig.TCPFastOpen,
+// and wraps the listeners by wrapListener.
+// NOTE:
+//  If ReusePort>0, it returns ReusePort listeners bound to the same address by SO_REUSEPORT,
+//  which are not inherited on Reboot, the new process binds the address by itself;
+//  Otherwise, it returns one inherited listener with TCP Fast Open.
+func (p *peer) listenTCP(addr net.Addr) ([]net.Listener, error) {
+	var lises []net.Listener
+	closeAll := func() {
+		for _, lis := range lises {
+			lis.Close()
+		}
+	}
+	if p.reusePort <= 0 {
+		lis, err := NewInheritedListener(addr, nil)
+		if err != nil {
+			return nil, err
+		}
+		lises = append(lises, lis)
+		if err = controlListener(lis, func(fd uintptr) error { return setFastOpen(fd, p.tcpFastOpen) }); err != nil {
+			closeAll()
+			return nil, err
+		}
+	} else {
+		lc := net.ListenConfig{
+			Control: func(_, _ string, c syscall.RawConn) error {
+				return rawControl(c, func(fd uintptr) error {
+					if err := setReusePort(fd); err != nil {
+						return err
+					}
+					return setFastOpen(fd, p.tcpFastOpen)
+				})
+			},
+		}
+		laddr := addr.String()
+		for i := 0; i < p.reusePort; i++ {
+			lis, err := lc.Listen(context.Background(), addr.Network(), laddr)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			lises = append(lises, lis)
+			// the random port of the first listener is shared
+			laddr = lis.Addr().String()
+		}
+	}
+	for i, lis := range lises {
+		wrapped, err := p.wrapListener(lis)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		lises[i] = wrapped
+	}
+	return lises, nil
+}
+
+func controlListener(lis net.Listener, fn func(fd uintptr) error) error {
+	sc, ok := lis.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	c, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	return rawControl(c, fn)
+}
+
+func rawControl(c syscall.RawConn, fn func(fd uintptr) error) error {
+	var opErr error
+	if err := c.Control(func(fd uintptr) { opErr = fn(fd) }); err != nil {
+		return err
+	}
+	return opErr
+}
@@ -0,0 +1,59 @@
+//go:build linux
+// +build linux
+
+package erpc
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReusePort(t *testing.T) {
+	srv := NewPeer(PeerConfig{ListenPort: 9121, ReusePort: 2, TCPFastOpen: 16})
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+	p := srv.(*peer)
+	p.mu.Lock()
+	n := len(p.listeners)
+	p.mu.Unlock()
+	if n != 2 {
+		t.Fatalf("listeners: %d, expect 2", n)
+	}
+
+	// another process can bind the address too
+	lc := net.ListenConfig{
+		Control: func(_, _ string, c syscall.RawConn) error {
+			return rawControl(c, setReusePort)
+		},
+	}
+	lis, err := lc.Listen(context.Background(), "tcp", "0.0.0.0:9121")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis.Close()
+
+	cli := NewPeer(PeerConfig{})
+	defer cli.Close()
+	for i := 0; i < 4; i++ {
+		sess, stat := cli.Dial("127.0.0.1:9121")
+		if !stat.OK() {
+			t.Fatal(stat)
+		}
+		sess.Close()
+	}
+
+	// only TCP Fast Open on the inherited listener
+	srv2 := NewPeer(PeerConfig{ListenPort: 9122, TCPFastOpen: 16})
+	defer srv2.Close()
+	go srv2.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+	sess, stat := cli.Dial("127.0.0.1:9122")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	sess.Close()
+}
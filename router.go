@@ -18,6 +18,7 @@ import (
 	"path"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"unsafe"
@@ -219,6 +220,7 @@ type (
 	// Router the router of call or push handlers.
 	Router struct {
 		subRouter *SubRouter
+		pools     *handlerPools
 	}
 	// SubRouter without the SetUnknownCall and SetUnknownPush methods
 	SubRouter struct {
@@ -241,6 +243,7 @@ type (
 		pluginContainer   *PluginContainer
 		routerTypeName    string
 		isUnknown         bool
+		pool              *handlerPool
 	}
 	// HandlersMaker makes []*Handler
 	HandlersMaker func(string, interface{}, *PluginContainer) ([]*Handler, error)
@@ -256,9 +259,10 @@ const (
 )
 
 // newRouter creates root router.
-func newRouter(pluginContainer *PluginContainer) *Router {
+func newRouter(pluginContainer *PluginContainer, pools *handlerPools) *Router {
 	rootGroup := globalServiceMethodMapper("", "")
 	root := &Router{
+		pools: pools,
 		subRouter: &SubRouter{
 			callHandlers:    make(map[string]*Handler),
 			pushHandlers:    make(map[string]*Handler),
@@ -372,6 +376,11 @@ func (r *SubRouter) reg(
 		h.routerTypeName = routerTypeName
 		hadHandlers[h.name] = h
 		pluginContainer.postReg(h)
+		if h.pool != nil {
+			if h.pool, err = r.root.pools.get(h.pool); err != nil {
+				Fatalf("%v", err)
+			}
+		}
 		Printf("register %s handler: %s", routerTypeName, h.name)
 		names = append(names, h.name)
 	}
@@ -432,6 +441,27 @@ func (r *Router) SetUnknownPush(fn func(UnknownPushCtx) *Status, plugin ...Plugi
 	r.subRouter.unknownPush = &h
 }
 
+// CallHandlers returns the registered CALL handlers sorted by name, without the unknown one.
+// NOTE: Not concurrent safe with the registering.
+func (r *Router) CallHandlers() []*Handler {
+	return sortedHandlers(r.subRouter.callHandlers)
+}
+
+// PushHandlers returns the registered PUSH handlers sorted by name, without the unknown one.
+// NOTE: Not concurrent safe with the registering.
+func (r *Router) PushHandlers() []*Handler {
+	return sortedHandlers(r.subRouter.pushHandlers)
+}
+
+func sortedHandlers(m map[string]*Handler) []*Handler {
+	handlers := make([]*Handler, 0, len(m))
+	for _, h := range m {
+		handlers = append(handlers, h)
+	}
+	sort.Slice(handlers, func(i, j int) bool { return handlers[i].name < handlers[j].name })
+	return handlers
+}
+
 func (r *SubRouter) getCall(uriPath string) (*Handler, bool) {
 	t, ok := r.callHandlers[uriPath]
 	if ok {
@@ -975,7 +1005,11 @@ func (h *Handler) ArgElemType() reflect.Type {
 }
 
 // NewArgValue creates a new arg elem value.
+// NOTE: If the arg pointer type implements BodyReleaser, it is got from the pool.
 func (h *Handler) NewArgValue() reflect.Value {
+	if pool := getArgPool(h.argElem); pool != nil {
+		return reflect.ValueOf(pool.Get())
+	}
 	return reflect.New(h.argElem)
 }
 
@@ -1003,3 +1037,12 @@ func (h *Handler) IsUnknown() bool {
 func (h *Handler) RouterTypeName() string {
 	return h.routerTypeName
 }
+
+// PoolName returns the name of the worker pool set by WithHandlerPool.
+// If not set, returns "".
+func (h *Handler) PoolName() string {
+	if h.pool == nil {
+		return ""
+	}
+	return h.pool.name
+}
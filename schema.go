@@ -0,0 +1,125 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/andeya/erpc/v7/codec"
+)
+
+// WithSchemaCodecs returns a plugin that declares the body codecs of the route.
+// When registering, it verifies that the codecs can represent the argument and
+// reply types of the handlers (see codec.TypeChecker), and panics on mismatch.
+// When handling, it rejects the message whose body codec is not declared,
+// with CodeUnsupportedCodec, and selects the reply codec automatically:
+// the accepted codec of the caller if declared, otherwise the codec of the call.
+// Example:
+//
+//	peer.RouteCall(new(PbHandler), erpc.WithSchemaCodecs(codec.ID_PROTOBUF))
+func WithSchemaCodecs(codecID ...byte) Plugin {
+	if len(codecID) == 0 {
+		Fatalf("WithSchemaCodecs: at least one codec is required")
+	}
+	names := make([]string, len(codecID))
+	for i, id := range codecID {
+		c, err := codec.Get(id)
+		if err != nil {
+			Fatalf("WithSchemaCodecs: %v", err)
+		}
+		names[i] = c.Name()
+	}
+	return &schemaPlugin{
+		codecIDs: codecID,
+		names:    strings.Join(names, ","),
+	}
+}
+
+type schemaPlugin struct {
+	codecIDs []byte
+	names    string
+}
+
+var (
+	_ PostRegPlugin         = (*schemaPlugin)(nil)
+	_ PreReadCallBodyPlugin = (*schemaPlugin)(nil)
+	_ PreReadPushBodyPlugin = (*schemaPlugin)(nil)
+	_ PreWriteReplyPlugin   = (*schemaPlugin)(nil)
+)
+
+func (s *schemaPlugin) Name() string {
+	return "schema-codecs:" + s.names
+}
+
+func (s *schemaPlugin) PostReg(h *Handler) error {
+	if h.isUnknown {
+		return nil
+	}
+	for _, id := range s.codecIDs {
+		if err := codec.CheckType(id, reflect.PtrTo(h.argElem)); err != nil {
+			return fmt.Errorf("argument: %v", err)
+		}
+		if h.reply != nil {
+			if err := codec.CheckType(id, h.reply); err != nil {
+				return fmt.Errorf("reply: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *schemaPlugin) PreReadCallBody(ctx ReadCtx) *Status {
+	return s.check(ctx.Input().BodyCodec())
+}
+
+func (s *schemaPlugin) PreReadPushBody(ctx ReadCtx) *Status {
+	return s.check(ctx.Input().BodyCodec())
+}
+
+// PreWriteReply replaces the undeclared reply codec with the selected one.
+func (s *schemaPlugin) PreWriteReply(ctx WriteCtx) *Status {
+	output := ctx.Output()
+	if s.check(output.BodyCodec()).OK() {
+		return nil
+	}
+	var callCodec = codec.NilCodecID
+	if c, ok := ctx.(interface{ Input() Message }); ok {
+		callCodec = c.Input().BodyCodec()
+	}
+	output.SetBodyCodec(s.selectCodec(callCodec))
+	return nil
+}
+
+// selectCodec returns the codec of the call if declared, otherwise the first declared one.
+func (s *schemaPlugin) selectCodec(callCodec byte) byte {
+	if callCodec != codec.NilCodecID && s.check(callCodec).OK() {
+		return callCodec
+	}
+	return s.codecIDs[0]
+}
+
+func (s *schemaPlugin) check(id byte) *Status {
+	if id == codec.NilCodecID {
+		return nil
+	}
+	for _, v := range s.codecIDs {
+		if v == id {
+			return nil
+		}
+	}
+	return statUnsupportedCodec.Copy(fmt.Sprintf("codec %q is not one of the route schema codecs: %s", id, s.names))
+}
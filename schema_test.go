@@ -0,0 +1,31 @@
+package erpc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/andeya/erpc/v7/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithSchemaCodecs(t *testing.T) {
+	p := WithSchemaCodecs(codec.ID_PROTOBUF).(*schemaPlugin)
+	assert.Equal(t, "schema-codecs:protobuf", p.Name())
+
+	h := &Handler{argElem: reflect.TypeOf(codec.PbEmpty{}), reply: reflect.TypeOf(new(codec.PbEmpty))}
+	assert.NoError(t, p.PostReg(h))
+	h = &Handler{argElem: reflect.TypeOf(map[string]int{}), reply: reflect.TypeOf(new(codec.PbEmpty))}
+	assert.Error(t, p.PostReg(h))
+	h = &Handler{argElem: reflect.TypeOf(codec.PbEmpty{}), reply: reflect.TypeOf(codec.PbEmpty{})}
+	assert.Error(t, p.PostReg(h))
+
+	assert.True(t, p.check(codec.ID_PROTOBUF).OK())
+	assert.True(t, p.check(codec.NilCodecID).OK())
+	assert.Equal(t, CodeUnsupportedCodec, p.check(codec.ID_JSON).Code())
+
+	// the reply codec is selected automatically
+	assert.Equal(t, byte(codec.ID_PROTOBUF), p.selectCodec(codec.ID_JSON))
+	p = WithSchemaCodecs(codec.ID_PROTOBUF, codec.ID_JSON).(*schemaPlugin)
+	assert.Equal(t, byte(codec.ID_JSON), p.selectCodec(codec.ID_JSON))
+	assert.Equal(t, byte(codec.ID_PROTOBUF), p.selectCodec(codec.NilCodecID))
+}
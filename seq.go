@@ -0,0 +1,137 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"encoding/binary"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/andeya/erpc/v7/socket"
+)
+
+const (
+	// ExtSeqHigh the extension type of the high 32 bits of the 64-bit seq, 4 bytes in big endian,
+	// it is reserved by the framework.
+	ExtSeqHigh byte = 0xff
+	// Seq64ServiceMethod the service method of the 64-bit seq negotiation,
+	// it is a PUSH handled by the framework, and the old peer not supporting it logs it as the unknown PUSH.
+	Seq64ServiceMethod = "/erpc/seq64"
+	// MetaSeq64 the key of the 64-bit seq negotiation, "syn" by the client, and "ack" by the server
+	MetaSeq64 = "X-Seq64"
+)
+
+// GetSeq64 returns the 64-bit seq of the message header,
+// i.e. the high 32 bits in the ExtSeqHigh extension, and the low 32 bits in the seq.
+func GetSeq64(h Header) uint64 {
+	seq := uint64(uint32(h.Seq()))
+	if high, ok := h.Extensions().Get(ExtSeqHigh); ok && len(high) == 4 {
+		seq |= uint64(binary.BigEndian.Uint32(high)) << 32
+	}
+	return seq
+}
+
+// setSeq64 sets the 64-bit seq to the message header, the extension is set only if the high 32 bits are not zero.
+func setSeq64(h Header, seq uint64) {
+	h.SetSeq(int32(uint32(seq)))
+	if high := uint32(seq >> 32); high != 0 {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], high)
+		h.Extensions().Set(ExtSeqHigh, b[:])
+	} else {
+		h.Extensions().Del(ExtSeqHigh)
+	}
+}
+
+// nextSeq returns a new seq of the session.
+// NOTE:
+//  If the 64-bit seq is negotiated, it wraps around after 2^64 seqs, otherwise after 2^32 seqs;
+//  The seq with zero low 32 bits and the ones of the pending calls are skipped,
+//  so a long-lived session never reuses the seq of a call waiting for the reply.
+func (s *session) nextSeq() uint64 {
+	for {
+		seq := atomic.AddUint64(&s.seq, 1)
+		if atomic.LoadInt32(&s.seq64) != 1 {
+			seq = uint64(uint32(seq))
+		}
+		if uint32(seq) == 0 {
+			continue
+		}
+		if _, pending := s.callCmdMap.Load(seq); !pending {
+			return seq
+		}
+	}
+}
+
+// Seq64 returns whether the 64-bit seq is negotiated with the remote peer.
+func (s *session) Seq64() bool {
+	return atomic.LoadInt32(&s.seq64) == 1
+}
+
+// negotiateSeq64 requests the remote peer to use the 64-bit seq, if PeerConfig.Seq64 is enabled.
+// NOTE:
+//  The seq is 32-bit until the remote peer acknowledges;
+//  Only for the protocols carrying the ExtSeqHigh extension, see ExtensionsCarrier.
+func (s *session) negotiateSeq64() {
+	if !s.peer.seq64 || !s.carryExtensions() {
+		return
+	}
+	if stat := s.RawPush(Seq64ServiceMethod, nil, WithSetMeta(MetaSeq64, "syn"), s.withTime()); !stat.OK() {
+		Debugf("negotiate 64-bit seq: %s", stat.String())
+	}
+}
+
+// handleSeq64 handles the 64-bit seq negotiation.
+// NOTE: The request is not acknowledged if the protocol does not carry the ExtSeqHigh extension.
+func (s *session) handleSeq64(header Header) {
+	if !s.peer.seq64 || !s.carryExtensions() {
+		return
+	}
+	switch string(header.Meta().Peek(MetaSeq64)) {
+	case "syn":
+		// NOTE: Acknowledge before enabling it, so the acknowledgement is still 32-bit for the old seq.
+		if stat := s.RawPush(Seq64ServiceMethod, nil, WithSetMeta(MetaSeq64, "ack"), s.withTimeEcho(header)); !stat.OK() {
+			Debugf("acknowledge 64-bit seq: %s", stat.String())
+			return
+		}
+		atomic.StoreInt32(&s.seq64, 1)
+	case "ack":
+		s.observeSkew(header)
+		atomic.StoreInt32(&s.seq64, 1)
+	}
+}
+
+// carryExtensions reports whether the protocol of the session carries the extensions of the messages.
+func (s *session) carryExtensions() bool {
+	us, ok := s.socket.(socket.UnsafeSocket)
+	return ok && us.CarryExtensions()
+}
+
+// formatSeq formats the seq in the notice metadata, the 32-bit one as before for the compatibility.
+func formatSeq(seq uint64) string {
+	if seq>>32 == 0 {
+		return strconv.FormatInt(int64(int32(seq)), 10)
+	}
+	return strconv.FormatUint(seq, 10)
+}
+
+// parseSeq parses the seq formatted by formatSeq.
+func parseSeq(s []byte) (uint64, error) {
+	if len(s) > 0 && s[0] == '-' {
+		v, err := strconv.ParseInt(string(s), 10, 32)
+		return uint64(uint32(v)), err
+	}
+	return strconv.ParseUint(string(s), 10, 64)
+}
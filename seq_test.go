@@ -0,0 +1,117 @@
+package erpc
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7/socket"
+)
+
+func seq_echo(ctx CallCtx, arg *uint64) (uint64, *Status) {
+	if seq := GetSeq64(ctx.Input()); seq != *arg {
+		return 0, NewStatus(1, "bad seq", seq)
+	}
+	return *arg, nil
+}
+
+func newSeqPair(t *testing.T, srvSeq64, cliSeq64 bool, protoFunc ...ProtoFunc) (Peer, Peer, *session) {
+	srv := NewPeer(PeerConfig{Seq64: srvSeq64})
+	srv.RouteCallFunc(seq_echo)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis, protoFunc...)
+	time.Sleep(100 * time.Millisecond)
+	cli := NewPeer(PeerConfig{Seq64: cliSeq64})
+	sess, stat := cli.Dial(lis.Addr().String(), protoFunc...)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	time.Sleep(100 * time.Millisecond)
+	return srv, cli, sess.(*session)
+}
+
+func TestSeq64(t *testing.T) {
+	srv, cli, sess := newSeqPair(t, true, true)
+	defer srv.Close()
+	defer cli.Close()
+	if !sess.Seq64() {
+		t.Fatal("expect the 64-bit seq negotiated")
+	}
+	// crosses the boundary of the high 32 bits, and skips the zero low 32 bits
+	atomic.StoreUint64(&sess.seq, 1<<32-2)
+	for i := 0; i < 4; i++ {
+		next := atomic.LoadUint64(&sess.seq) + 1
+		if uint32(next) == 0 {
+			next++
+		}
+		var reply uint64
+		if stat := sess.Call("/seq/echo", next, &reply).Status(); !stat.OK() {
+			t.Fatal(stat)
+		}
+		if reply != next {
+			t.Fatalf("reply: %d, expect: %d", reply, next)
+		}
+	}
+	if seq := atomic.LoadUint64(&sess.seq); seq != 1<<32+3 {
+		t.Fatalf("seq: %d", seq)
+	}
+	// skips the pending one
+	pending := &callCmd{output: GetMessage()}
+	sess.callCmdMap.Store(1<<32+4, pending)
+	if seq := sess.nextSeq(); seq != 1<<32+5 {
+		t.Fatalf("seq: %d", seq)
+	}
+	sess.callCmdMap.Delete(1<<32 + 4)
+}
+
+// noExtProto the raw protocol hiding its ExtensionsCarrier, like the protocols not carrying the extensions.
+type noExtProto struct {
+	Proto
+}
+
+func TestSeq64NoExtensions(t *testing.T) {
+	srv, cli, sess := newSeqPair(t, true, true, func(rw IOWithReadBuffer) Proto {
+		return noExtProto{socket.RawProtoFunc(rw)}
+	})
+	defer srv.Close()
+	defer cli.Close()
+	if sess.Seq64() {
+		t.Fatal("expect the 32-bit seq without the extensions")
+	}
+}
+
+func TestSeq32Wraparound(t *testing.T) {
+	// the old server does not acknowledge
+	srv, cli, sess := newSeqPair(t, false, true)
+	defer srv.Close()
+	defer cli.Close()
+	if sess.Seq64() {
+		t.Fatal("expect the 32-bit seq")
+	}
+	// skips the zero seq and the pending one
+	pending := &callCmd{output: GetMessage()}
+	pending.output.SetSeq(1)
+	sess.callCmdMap.Store(1, pending)
+	atomic.StoreUint64(&sess.seq, 1<<32-1)
+	if seq := sess.nextSeq(); seq != 2 {
+		t.Fatalf("seq: %d", seq)
+	}
+	sess.callCmdMap.Delete(1)
+	var reply uint64
+	if stat := sess.Call("/seq/echo", uint64(3), &reply).Status(); !stat.OK() || reply != 3 {
+		t.Fatal(stat, reply)
+	}
+}
+
+func TestFormatSeq(t *testing.T) {
+	for _, seq := range []uint64{1, 1<<31 + 1, 1<<32 - 1, 1 << 32, 1<<64 - 1} {
+		got, err := parseSeq([]byte(formatSeq(seq)))
+		if err != nil || got != seq {
+			t.Fatalf("seq: %d, got: %d, err: %v", seq, got, err)
+		}
+	}
+}
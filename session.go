@@ -17,6 +17,7 @@ package erpc
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -28,6 +29,7 @@ import (
 	"github.com/andeya/erpc/v7/codec"
 	"github.com/andeya/erpc/v7/socket"
 	"github.com/andeya/erpc/v7/utils"
+	"github.com/andeya/erpc/v7/xfer"
 	"github.com/andeya/goutil"
 	"github.com/andeya/goutil/coarsetime"
 )
@@ -101,6 +103,36 @@ type (
 		SetSessionAge(duration time.Duration)
 		// SetContextAge sets CALL or PUSH context max age.
 		SetContextAge(duration time.Duration)
+		// SetReadBuffer sets the range of the adaptive read buffer size of the session,
+		// the buffer grows or shrinks within it by the recent message sizes.
+		// NOTE:
+		//  If min>=max, the buffer size is fixed to min;
+		//  If min<=0, use the default 1KB, if max<=0, use the default 64KB.
+		SetReadBuffer(min, max int)
+		// SetAutoCompress sets the compression filter and the default threshold of the auto compression of the session,
+		// e.g. by the filter negotiated with the remote peer, overriding PeerConfig.CompressFilter and PeerConfig.AutoCompressBytes.
+		// NOTE: If minBytes<=0, only the messages with WithAutoCompress are compressed automatically.
+		SetAutoCompress(minBytes int, filterID byte) error
+		// SetBandwidth sets the maximum bytes per second read and written by the session at runtime,
+		// overriding PeerConfig.SessionReadBps and PeerConfig.SessionWriteBps.
+		// NOTE:
+		//  If readBps<=0 or writeBps<=0, no limit of it;
+		//  The total bandwidth of the peer is limited by Peer.SetBandwidth.
+		SetBandwidth(readBps, writeBps int64)
+		// SetReadLimit sets the max size of the messages read by the session,
+		// the smallest of it, the global SetReadLimit, PeerConfig.ReadLimit and RouteReadLimit applies.
+		// NOTE: If maxSize<=0, only the global one and the one of the peer apply.
+		SetReadLimit(maxSize uint32)
+		// SetDefaultBodyCodec sets the body codec of the messages sent by the session without one,
+		// e.g. by the codec negotiated at the handshake, overriding PeerConfig.DefaultBodyCodec.
+		SetDefaultBodyCodec(codecID byte) error
+		// DefaultBodyCodec returns the body codec of the messages sent by the session without one.
+		DefaultBodyCodec() byte
+		// AppendPlugins attaches the plugins to the session, which are executed after the plugins of the peer and the route.
+		// NOTE: The plugin name must be unique in the session and the peer.
+		AppendPlugins(plugins ...Plugin) error
+		// Plugins returns the plugins attached to the session.
+		Plugins() []Plugin
 		// Logger logger interface
 		Logger
 	}
@@ -147,11 +179,23 @@ type (
 		// If the args is []byte or *[]byte type, it can automatically fill in the body codec name;
 		// If the session is a client role and PeerConfig.RedialTimes>0, it is automatically re-called once after a failure.
 		Call(serviceMethod string, args interface{}, result interface{}, setting ...MessageSetting) CallCmd
+		// CallBatch frames the calls into one CALL message in a single round trip,
+		// and returns the call commands in the order of the items after all are completed.
+		// NOTE:
+		// The setting is applied to the batch call, and the item's setting to the item only;
+		// Each item fails or succeeds independently, check the status of each call command.
+		CallBatch(items []BatchItem, setting ...MessageSetting) []CallCmd
 		// Push sends a message of TypePush type, but do not receives reply.
 		// NOTE:
 		// If the args is []byte or *[]byte type, it can automatically fill in the body codec name;
 		// If the session is a client role and PeerConfig.RedialTimes>0, it is automatically re-called once after a failure.
 		Push(serviceMethod string, args interface{}, setting ...MessageSetting) *Status
+		// PushReliable sends a message of TypePush type, and waits for the acknowledgement of the receiver,
+		// retrying with the same seq and backoff until acknowledged or the retries are used up.
+		// NOTE:
+		// The receiver acknowledges the PUSH after handling it, even if the handling fails;
+		// It is delivered at least once, deduplicate it by the seq on the receiver if necessary, e.g. plugin/dedup.
+		PushReliable(serviceMethod string, args interface{}, opts PushReliableOptions, setting ...MessageSetting) *Status
 		// SessionAge returns the session max age.
 		SessionAge() time.Duration
 		// ContextAge returns CALL or PUSH context max age.
@@ -167,8 +211,59 @@ type (
 		SetID(newID string)
 		// Close closes the session.
 		Close() error
+		// Stats returns the snapshot of the session statistics.
+		Stats() Stats
+		// LastRead returns the time of the last message read by the session, or of the start of the reading.
+		LastRead() time.Time
+		// LastWrite returns the time of the last message written by the session, or of the creation of the session.
+		LastWrite() time.Time
+		// Ping sends an application ping to the remote peer and waits for the pong until ctx is done,
+		// returns the round-trip time, and updates the liveness of the session.
+		// NOTE: The remote peer must support the pings, see PingServiceMethod.
+		Ping(ctx context.Context) (rtt time.Duration, stat *Status)
+		// Liveness returns the liveness state of the session by the results of the pings, see PeerConfig.PingInterval.
+		Liveness() Liveness
+		// RTT returns the smoothed round-trip time of the pings, 0 if no ping is answered.
+		RTT() time.Duration
+		// ClockSkew returns the estimated offset of the clock of the remote peer to the peer clock,
+		// sampled by the handshakes and the pings, and ok is false if not estimated yet.
+		ClockSkew() (offset time.Duration, ok bool)
+		// Seq64 returns whether the 64-bit seq is negotiated with the remote peer, see PeerConfig.Seq64.
+		Seq64() bool
+		// SetBandwidth sets the maximum bytes per second read and written by the session at runtime,
+		// overriding PeerConfig.SessionReadBps and PeerConfig.SessionWriteBps.
+		// NOTE: If readBps<=0 or writeBps<=0, no limit of it.
+		SetBandwidth(readBps, writeBps int64)
+		// SetReadLimit sets the max size of the messages read by the session,
+		// the smallest of it, the global SetReadLimit, PeerConfig.ReadLimit and RouteReadLimit applies.
+		// NOTE: If maxSize<=0, only the global one and the one of the peer apply.
+		SetReadLimit(maxSize uint32)
+		// ReadLimit returns the max size of the messages read by the session,
+		// the smaller of PeerConfig.ReadLimit and the one set by SetReadLimit, 0 means only the global one applies.
+		ReadLimit() uint32
+		// SetDefaultBodyCodec sets the body codec of the messages sent by the session without one,
+		// overriding PeerConfig.DefaultBodyCodec, see PeerConfig.NegotiateCodec.
+		SetDefaultBodyCodec(codecID byte) error
+		// DefaultBodyCodec returns the body codec of the messages sent by the session without one.
+		DefaultBodyCodec() byte
+		// Migrate moves the session to the current network path by redialing,
+		// e.g. after the mobile client switched from WiFi to cellular.
+		// NOTE: Only for the client role with PeerConfig.RedialTimes!=0, see PeerConfig.RedialPending.
+		Migrate() *Status
+		// AppendPlugins attaches the plugins to the session, which are executed after the plugins of the peer and the route.
+		// NOTE: The plugin name must be unique in the session and the peer.
+		AppendPlugins(plugins ...Plugin) error
+		// Plugins returns the plugins attached to the session.
+		Plugins() []Plugin
 		CtxSession
 	}
+	// BatchItem a call of the batch.
+	BatchItem struct {
+		ServiceMethod string
+		Arg           interface{}
+		Result        interface{}
+		Setting       []MessageSetting
+	}
 )
 
 var (
@@ -182,11 +277,17 @@ type session struct {
 	peer                           *peer
 	getCallHandler, getPushHandler func(serviceMethodPath string) (*Handler, bool)
 	timeNow                        func() int64
-	callCmdMap                     goutil.Map
+	callCmdMap                     *callCmdMap
+	handlerCancels                 sync.Map // seq of the handling call -> context.CancelFunc
+	pushAcks                       sync.Map // seq of the reliable push -> chan struct{}
+	stats                          stats
 	protoFuncs                     []ProtoFunc
 	socket                         socket.Socket
+	readLimiter                    *socket.RateLimiter
+	writeLimiter                   *socket.RateLimiter
 	closeNotifyCh                  chan struct{} // closeNotifyCh is the channel returned by CloseNotify.
-	writeLock                      sync.Mutex
+	plugins                        sessionPlugins
+	writeLock                      priorityMutex
 	graceCtxWaitGroup              sync.WaitGroup
 	graceCtxMutex                  sync.Mutex
 	graceCallCmdWaitGroup          sync.WaitGroup
@@ -194,11 +295,33 @@ type session struct {
 	contextAge                     time.Duration
 	sessionAgeLock                 sync.RWMutex
 	contextAgeLock                 sync.RWMutex
+	readDeadlineTimer              Timer // sets the read deadline by the non-system clock
+	readDeadlineLock               sync.Mutex
 	lock                           sync.RWMutex
 	redialForClientLocked          func() bool // only for client role
-	seq                            int32
+	lockedEvents                   []Event     // the events emitted while holding the lock
+	handoffCh                      chan bool   // reports whether the reading is stopped at the message boundary
+	handingOff                     int32
+	seq                            uint64
+	seq64                          int32 // whether the 64-bit seq is negotiated
 	status                         int32
 	didCloseNotify                 int32
+	evicted                        atomic.Value // the *Status of closing the session by the slow consumer policy
+	slowSince                      time.Time    // since when the write queue is above PeerConfig.SlowConsumerQueue
+	slowApplied                    bool         // whether the slow consumer policy has been applied
+	idleApplied                    bool         // whether the idle policy has been applied
+	lastRead                       int64        // atomic, the unix nanoseconds of the last message read, see markActive
+	lastWrite                      int64        // atomic, the unix nanoseconds of the last message written, see markActive
+	pings                          sync.Map     // id of the ping waiting for the pong -> chan struct{}
+	pingID                         uint64       // atomic, the id of the last ping
+	pinging                        int32        // atomic, whether the automatic ping is waiting for the pong
+	pingFailures                   int32        // atomic, the number of the consecutive failed pings
+	liveness                       int32        // atomic, the Liveness
+	rtt                            int64        // atomic, the smoothed round-trip time of the pings
+	skew                           skewEstimator
+	migrating                      int32        // whether the session is redialing by Migrate
+	dialMeta                       atomic.Value // the *utils.Args sent or received at the end of the dial handshake
+	bodyCodec                      int32        // the default body codec of the session, codec.NilCodecID means of the peer
 }
 
 func newSession(peer *peer, conn net.Conn, protoFuncs []ProtoFunc) *session {
@@ -211,9 +334,35 @@ func newSession(peer *peer, conn net.Conn, protoFuncs []ProtoFunc) *session {
 		status:         statusPreparing,
 		socket:         socket.NewSocket(conn, protoFuncs...),
 		closeNotifyCh:  make(chan struct{}),
-		callCmdMap:     goutil.AtomicMap(),
+		callCmdMap:     newCallCmdMap(),
 		sessionAge:     peer.defaultSessionAge,
 		contextAge:     peer.defaultContextAge,
+		readLimiter:    socket.NewRateLimiter(atomic.LoadInt64(&peer.sessionReadBps)),
+		writeLimiter:   socket.NewRateLimiter(atomic.LoadInt64(&peer.sessionWriteBps)),
+	}
+	s.stats.parent = &peer.stats
+	s.lastWrite = peer.clock.Now().UnixNano()
+	s.lastRead = s.lastWrite
+	s.socket.(socket.UnsafeSocket).SetRegistries(peer.codecs, peer.xferFilters)
+	if !peer.socketOptions.IsZero() {
+		s.socket.(socket.UnsafeSocket).SetOptions(peer.socketOptions)
+	}
+	s.socket.(socket.UnsafeSocket).SetRateLimiters(
+		[]*socket.RateLimiter{s.readLimiter, peer.readLimiter},
+		[]*socket.RateLimiter{s.writeLimiter, peer.writeLimiter},
+	)
+	if peer.flushInterval > 0 {
+		s.socket.(socket.UnsafeSocket).SetFlushInterval(peer.flushInterval)
+	}
+	if peer.compressFilter != nil {
+		s.socket.(socket.UnsafeSocket).SetAutoCompress(peer.autoCompressBytes, peer.compressFilter.ID())
+	}
+	if peer.readLimit > 0 {
+		s.socket.(socket.UnsafeSocket).SetReadLimit(peer.readLimit)
+	}
+	if peer.maxReassemblySize > 0 {
+		// NOTE: The written messages are fragmented after the negotiation, see negotiateFragment.
+		s.socket.(socket.UnsafeSocket).SetFragment(0, peer.maxReassemblySize)
 	}
 	return s
 }
@@ -398,14 +547,37 @@ func (s *session) SessionAge() time.Duration {
 func (s *session) SetSessionAge(duration time.Duration) {
 	s.sessionAgeLock.Lock()
 	s.sessionAge = duration
-	if duration > 0 {
-		s.socket.SetReadDeadline(coarsetime.CeilingTimeNow().Add(duration))
-	} else {
-		s.socket.SetReadDeadline(time.Time{})
-	}
+	s.setReadTimeout(duration)
 	s.sessionAgeLock.Unlock()
 }
 
+// setReadTimeout sets the read deadline after the timeout by the clock of the peer,
+// no deadline if timeout<=0.
+func (s *session) setReadTimeout(timeout time.Duration) {
+	clock := s.peer.clock
+	if isSystemClock(clock) {
+		if timeout > 0 {
+			s.socket.SetReadDeadline(coarsetime.CeilingTimeNow().Add(timeout))
+		} else {
+			s.socket.SetReadDeadline(time.Time{})
+		}
+		return
+	}
+	s.readDeadlineLock.Lock()
+	defer s.readDeadlineLock.Unlock()
+	if s.readDeadlineTimer != nil {
+		s.readDeadlineTimer.Stop()
+		s.readDeadlineTimer = nil
+	}
+	s.socket.SetReadDeadline(time.Time{})
+	if timeout > 0 {
+		// the socket deadline is of the system time, so expire it immediately when the clock is up
+		s.readDeadlineTimer = clock.AfterFunc(timeout, func() {
+			s.socket.SetReadDeadline(time.Now())
+		})
+	}
+}
+
 // ContextAge returns CALL or PUSH context max age.
 func (s *session) ContextAge() time.Duration {
 	s.contextAgeLock.RLock()
@@ -421,6 +593,68 @@ func (s *session) SetContextAge(duration time.Duration) {
 	s.contextAgeLock.Unlock()
 }
 
+// SetReadBuffer sets the range of the adaptive read buffer size of the session,
+// the buffer grows or shrinks within it by the recent message sizes.
+// NOTE:
+//  If min>=max, the buffer size is fixed to min;
+//  If min<=0, use the default 1KB, if max<=0, use the default 64KB.
+func (s *session) SetReadBuffer(min, max int) {
+	if us, ok := s.socket.(socket.UnsafeSocket); ok {
+		us.SetReadBuffer(min, max)
+	}
+}
+
+// SetAutoCompress sets the compression filter and the default threshold of the auto compression of the session,
+// e.g. by the filter negotiated with the remote peer, overriding PeerConfig.CompressFilter and PeerConfig.AutoCompressBytes.
+// NOTE: If minBytes<=0, only the messages with WithAutoCompress are compressed automatically.
+func (s *session) SetAutoCompress(minBytes int, filterID byte) error {
+	return s.socket.(socket.UnsafeSocket).SetAutoCompress(minBytes, filterID)
+}
+
+// SetDefaultBodyCodec sets the body codec of the messages sent by the session without one,
+// e.g. by the codec negotiated at the handshake, overriding PeerConfig.DefaultBodyCodec.
+func (s *session) SetDefaultBodyCodec(codecID byte) error {
+	if _, err := s.peer.codecs.Get(codecID); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&s.bodyCodec, int32(codecID))
+	return nil
+}
+
+// DefaultBodyCodec returns the body codec of the messages sent by the session without one.
+func (s *session) DefaultBodyCodec() byte {
+	if id := byte(atomic.LoadInt32(&s.bodyCodec)); id != codec.NilCodecID {
+		return id
+	}
+	return s.peer.defaultBodyCodec
+}
+
+// SetBandwidth sets the maximum bytes per second read and written by the session at runtime,
+// overriding PeerConfig.SessionReadBps and PeerConfig.SessionWriteBps.
+// NOTE:
+//  If readBps<=0 or writeBps<=0, no limit of it;
+//  The total bandwidth of the peer is limited by Peer.SetBandwidth.
+func (s *session) SetBandwidth(readBps, writeBps int64) {
+	s.readLimiter.SetRate(readBps)
+	s.writeLimiter.SetRate(writeBps)
+}
+
+// SetReadLimit sets the max size of the messages read by the session,
+// the smallest of it, the global SetReadLimit, PeerConfig.ReadLimit and RouteReadLimit applies.
+// NOTE: If maxSize<=0, only the global one and the one of the peer apply.
+func (s *session) SetReadLimit(maxSize uint32) {
+	if limit := s.peer.readLimit; maxSize == 0 || (limit > 0 && limit < maxSize) {
+		maxSize = limit
+	}
+	s.socket.(socket.UnsafeSocket).SetReadLimit(maxSize)
+}
+
+// ReadLimit returns the max size of the messages read by the session,
+// the smaller of PeerConfig.ReadLimit and the one set by SetReadLimit, 0 means only the global one applies.
+func (s *session) ReadLimit() uint32 {
+	return s.socket.(socket.UnsafeSocket).ReadLimit()
+}
+
 // PreSend temporarily sends message when the session is just builded,
 // do not execute other plugins.
 // NOTE:
@@ -445,14 +679,20 @@ func (s *session) PreSend(mtype byte, serviceMethod string, body interface{}, st
 }
 
 func (s *session) send(mtype byte, seq int32, serviceMethod string, body interface{}, stat *Status, setting []MessageSetting) (Message, *Status) {
-	output := socket.GetMessage(setting...)
+	output := socket.GetMessage(s.peer.withRegistries())
+	for _, fn := range setting {
+		if fn != nil {
+			fn(output)
+		}
+	}
 	output.SetMtype(mtype)
 	if seq == 0 {
-		seq = atomic.AddInt32(&s.seq, 1)
+		setSeq64(output, s.nextSeq())
+	} else {
+		output.SetSeq(seq)
 	}
-	output.SetSeq(seq)
 	if output.BodyCodec() == codec.NilCodecID {
-		output.SetBodyCodec(s.peer.defaultBodyCodec)
+		output.SetBodyCodec(s.DefaultBodyCodec())
 	}
 	if len(serviceMethod) > 0 {
 		output.SetServiceMethod(serviceMethod)
@@ -468,24 +708,32 @@ func (s *session) send(mtype byte, seq int32, serviceMethod string, body interfa
 
 func (s *session) doSend(output Message) *Status {
 	if age := s.ContextAge(); age > 0 {
-		ctxTimout, _ := context.WithTimeout(output.Context(), age)
+		ctxTimout, _ := ClockWithTimeout(s.peer.clock, output.Context(), age)
 		socket.WithContext(ctxTimout)(output)
 	}
 
-	s.writeLock.Lock()
+	ctx := output.Context()
+	if err := s.writeLock.Lock(ctx, GetPriority(output.Meta())); err != nil {
+		s.stats.add(cntErrors, 1)
+		return statWriteFailed.Copy(err)
+	}
 	defer s.writeLock.Unlock()
 
-	ctx := output.Context()
 	select {
 	case <-ctx.Done():
+		s.stats.add(cntErrors, 1)
 		return statWriteFailed.Copy(ctx.Err())
 	default:
 		deadline, _ := ctx.Deadline()
 		s.socket.SetWriteDeadline(deadline)
 		err := s.socket.WriteMessage(output)
 		if err == nil {
+			s.stats.addMessage(output.Mtype(), output.Size(), true)
+			s.markActive(true)
+			s.peer.taps.capture(s, output, TapOutbound)
 			return nil
 		}
+		s.stats.add(cntErrors, 1)
 		if err == io.EOF || err == socket.ErrProactivelyCloseSocket {
 			return statConnClosed
 		}
@@ -520,14 +768,29 @@ func (s *session) PreReceive(newArgs NewBodyFunc, ctx ...context.Context) (input
 	}()
 
 	if age := s.ContextAge(); age > 0 {
-		ctxTimout, _ := context.WithTimeout(input.Context(), age)
+		ctxTimout, _ := ClockWithTimeout(s.peer.clock, input.Context(), age)
 		socket.WithContext(ctxTimout)(input)
 	}
-	deadline, _ := input.Context().Deadline()
-	s.socket.SetReadDeadline(deadline)
+	if isSystemClock(s.peer.clock) {
+		deadline, _ := input.Context().Deadline()
+		s.socket.SetReadDeadline(deadline)
+	} else if deadline, ok := input.Context().Deadline(); ok {
+		timeout := deadline.Sub(s.peer.clock.Now())
+		if timeout <= 0 {
+			timeout = time.Nanosecond
+		}
+		s.setReadTimeout(timeout)
+	} else {
+		s.setReadTimeout(0)
+	}
 
 	if err := s.socket.ReadMessage(input); err != nil {
+		s.stats.add(cntErrors, 1)
 		input.SetStatus(statConnClosed.Copy(err))
+	} else {
+		s.stats.addMessage(input.Mtype(), input.Size(), false)
+		s.markActive(false)
+		s.peer.taps.capture(s, input, TapInbound)
 	}
 	return input
 }
@@ -604,6 +867,11 @@ func (s *session) RawPush(serviceMethod string, args interface{}, setting ...Mes
 // If the args is []byte or *[]byte type, it can automatically fill in the body codec name;
 // If the session is a client role and PeerConfig.RedialTimes>0, it is automatically re-called once after a failure.
 func (s *session) Push(serviceMethod string, args interface{}, setting ...MessageSetting) *Status {
+	return s.push(0, serviceMethod, args, setting)
+}
+
+// push sends a message of TypePush type, if seq is 0, use a new seq.
+func (s *session) push(seq uint64, serviceMethod string, args interface{}, setting []MessageSetting) *Status {
 	ctx := s.peer.getContext(s, true)
 	defer func() {
 		s.peer.putContext(ctx, true)
@@ -623,17 +891,21 @@ func (s *session) Push(serviceMethod string, args interface{}, setting ...Messag
 			fn(output)
 		}
 	}
-	output.SetSeq(atomic.AddInt32(&s.seq, 1))
+	if seq == 0 {
+		seq = s.nextSeq()
+	}
+	setSeq64(output, seq)
 
 	if output.BodyCodec() == codec.NilCodecID {
-		output.SetBodyCodec(s.peer.defaultBodyCodec)
+		output.SetBodyCodec(s.DefaultBodyCodec())
 	}
 	if age := s.ContextAge(); age > 0 {
-		ctxTimout, _ := context.WithTimeout(output.Context(), age)
+		ctxTimout, _ := ClockWithTimeout(s.peer.clock, output.Context(), age)
 		socket.WithContext(ctxTimout)(output)
 	}
+	s.withDeadline(output)
 
-	stat := s.peer.pluginContainer.preWritePush(ctx)
+	stat := s.withPlugins(s.peer.pluginContainer).preWritePush(ctx)
 	if !stat.OK() {
 		return stat
 	}
@@ -647,9 +919,9 @@ W:
 		return stat
 	}
 	if enablePrintRunLog() {
-		s.printRunLog("", time.Duration(s.timeNow()-ctx.start), nil, output, typePushLaunch)
+		s.printRunLog("", s.peer.costSince(ctx.start), nil, output, typePushLaunch)
 	}
-	s.peer.pluginContainer.postWritePush(ctx)
+	s.withPlugins(s.peer.pluginContainer).postWritePush(ctx)
 	return nil
 }
 
@@ -675,7 +947,7 @@ func (s *session) AsyncCall(
 			Panicf("*session.AsyncCall(): callCmdChan channel is unbuffered")
 		}
 	}
-	output := socket.NewMessage()
+	output := socket.NewMessage(s.peer.withRegistries())
 	output.SetServiceMethod(serviceMethod)
 	output.SetBody(args)
 	output.SetMtype(TypeCall)
@@ -685,16 +957,17 @@ func (s *session) AsyncCall(
 		}
 	}
 
-	seq := atomic.AddInt32(&s.seq, 1)
-	output.SetSeq(seq)
+	seq := s.nextSeq()
+	setSeq64(output, seq)
 
 	if output.BodyCodec() == codec.NilCodecID {
-		output.SetBodyCodec(s.peer.defaultBodyCodec)
+		output.SetBodyCodec(s.DefaultBodyCodec())
 	}
 	if age := s.ContextAge(); age > 0 {
-		ctxTimout, _ := context.WithTimeout(output.Context(), age)
+		ctxTimout, _ := ClockWithTimeout(s.peer.clock, output.Context(), age)
 		socket.WithContext(ctxTimout)(output)
 	}
+	s.withDeadline(output)
 
 	cmd := &callCmd{
 		sess:        s,
@@ -727,7 +1000,7 @@ func (s *session) AsyncCall(
 		}
 	}()
 
-	cmd.stat = s.peer.pluginContainer.preWriteCall(cmd)
+	cmd.stat = s.withPlugins(s.peer.pluginContainer).preWriteCall(cmd)
 	if !cmd.stat.OK() {
 		cmd.done()
 		return cmd
@@ -741,8 +1014,12 @@ W:
 		cmd.done()
 		return cmd
 	}
+	cmd.conn = usedConn
 
-	s.peer.pluginContainer.postWriteCall(cmd)
+	s.withPlugins(s.peer.pluginContainer).postWriteCall(cmd)
+	if isHedgeAttempt(output.Context()) {
+		go cmd.watchContext(output.Context().Done())
+	}
 	return cmd
 }
 
@@ -764,7 +1041,7 @@ func (s *session) Swap() goutil.Map {
 // Close closes the session.
 func (s *session) Close() error {
 	s.lock.Lock()
-	defer s.lock.Unlock()
+	defer s.unlock()
 	return s.closeLocked()
 }
 
@@ -778,7 +1055,8 @@ func (s *session) closeLocked() error {
 	s.graceCallCmdWaitGroup.Wait()
 	s.changeStatus(statusActiveClosed)
 	err := s.socket.Close()
-	s.peer.pluginContainer.postDisconnect(s)
+	s.withPlugins(s.peer.pluginContainer).postDisconnect(s)
+	s.emitLocked(s.peer.sessionEvent(EventSessionClosed, s))
 	return err
 }
 
@@ -794,44 +1072,89 @@ func (s *session) readDisconnected(oldConn net.Conn, err error) {
 
 	s.peer.sessHub.delete(s.ID())
 
-	var reason string
-	if err != nil && err != socket.ErrProactivelyCloseSocket {
+	stat := statConnClosed
+	if evicted, _ := s.evicted.Swap((*Status)(nil)).(*Status); evicted != nil {
+		stat = evicted
+	} else if err != nil && err != socket.ErrProactivelyCloseSocket {
 		if errStr := err.Error(); errStr != "EOF" {
-			reason = errStr
+			stat = statConnClosed.Copy(errStr)
 			Debugf("disconnect(%s) when reading: %T %s", s.RemoteAddr().String(), err, errStr)
 		}
 	}
-	s.graceCtxWait()
-
-	// cancel the callCmd that is waiting for a reply
-	s.callCmdMap.Range(func(_, v interface{}) bool {
-		callCmd := v.(*callCmd)
-		callCmd.mu.Lock()
-		if !callCmd.hasReply() && callCmd.stat.OK() {
-			callCmd.cancel(reason)
-		}
-		callCmd.mu.Unlock()
+	// cancel the contexts of the call handlers
+	s.handlerCancels.Range(func(k, v interface{}) bool {
+		s.handlerCancels.Delete(k)
+		v.(context.CancelFunc)()
 		return true
 	})
 
+	s.graceCtxWait()
+
+	// cancel the callCmd that is waiting for a reply, or resend it after redialed
+	resend := status != statusActiveClosing && s.peer.redialPending && s.redialForClientLocked != nil
+	if !resend {
+		s.cancelPending(stat)
+	}
+
 	if status == statusActiveClosing {
 		return
 	}
 
 	s.socket.Close()
-	if !s.redialForClient(oldConn) {
+	redialed := s.redialForClient(oldConn)
+	if resend {
+		if redialed {
+			s.resendPending()
+		} else {
+			s.cancelPending(stat)
+		}
+	}
+	if !redialed {
 		s.changeStatus(statusPassiveClosed)
 		s.notifyClosed()
-		s.peer.pluginContainer.postDisconnect(s)
+		s.withPlugins(s.peer.pluginContainer).postDisconnect(s)
+		s.peer.emitSessionEvent(EventSessionClosed, s)
 	}
 }
 
+// cancelPending cancels the callCmd that is waiting for a reply.
+func (s *session) cancelPending(stat *Status) {
+	s.callCmdMap.Range(func(_ uint64, callCmd *callCmd) bool {
+		callCmd.mu.Lock()
+		if !callCmd.hasReply() && callCmd.stat.OK() {
+			callCmd.cancel(stat)
+		}
+		callCmd.mu.Unlock()
+		return true
+	})
+}
+
+// resendPending resends the callCmd that is waiting for a reply by the new connection,
+// see PeerConfig.RedialPending.
+func (s *session) resendPending() {
+	s.callCmdMap.Range(func(_ uint64, callCmd *callCmd) bool {
+		callCmd.mu.Lock()
+		if !callCmd.hasReply() && callCmd.stat.OK() {
+			// skip the one written by the new connection already
+			if conn := s.getConn(); callCmd.conn != conn {
+				if usedConn, stat := s.write(callCmd.output); stat.OK() {
+					callCmd.conn = usedConn
+				} else {
+					callCmd.cancel(stat)
+				}
+			}
+		}
+		callCmd.mu.Unlock()
+		return true
+	})
+}
+
 func (s *session) redialForClient(oldConn net.Conn) bool {
 	if s.redialForClientLocked == nil {
 		return false
 	}
 	s.lock.Lock()
-	defer s.lock.Unlock()
+	defer s.unlock()
 	// Avoid repeated calls from write and readDisconnected methods
 	if oldConn != s.getConn() {
 		return true
@@ -845,11 +1168,11 @@ func (s *session) redialForClient(oldConn net.Conn) bool {
 func (s *session) startReadAndHandle() {
 	var withContext MessageSetting
 	if readTimeout := s.SessionAge(); readTimeout > 0 {
-		s.socket.SetReadDeadline(coarsetime.CeilingTimeNow().Add(readTimeout))
-		ctxTimout, _ := context.WithTimeout(context.Background(), readTimeout)
+		s.setReadTimeout(readTimeout)
+		ctxTimout, _ := ClockWithTimeout(s.peer.clock, context.Background(), readTimeout)
 		withContext = socket.WithContext(ctxTimout)
 	} else {
-		s.socket.SetReadDeadline(time.Time{})
+		s.setReadTimeout(0)
 		withContext = socket.WithContext(nil)
 	}
 
@@ -857,33 +1180,60 @@ func (s *session) startReadAndHandle() {
 		err      error
 		usedConn = s.getConn()
 	)
+	s.markActive(false)
+	s.startReadDatagrams(usedConn)
 	defer func() {
 		if p := recover(); p != nil {
 			err = fmt.Errorf("panic:%v\n%s", p, goutil.PanicTrace(2))
 		}
+		if s.stopReadForHandoff(err) {
+			return
+		}
 		s.readDisconnected(usedConn, err)
 	}()
 	// read call, call reply or push
 	for s.goonRead() {
 		var ctx = s.peer.getContext(s, false)
 		withContext(ctx.input)
-		if s.peer.pluginContainer.preReadHeader(ctx) != nil {
+		if s.withPlugins(s.peer.pluginContainer).preReadHeader(ctx) != nil {
 			s.peer.putContext(ctx, false)
 			return
 		}
 		err = s.socket.ReadMessage(ctx.input)
+		corrupted := err != nil && errors.Is(err, xfer.ErrChecksumMismatch)
+		if corrupted {
+			s.stats.add(cntCorruptions, 1)
+		}
 		if (err != nil && ctx.GetBodyCodec() == codec.NilCodecID) || !s.goonRead() {
+			if corrupted {
+				s.stats.add(cntErrors, 1)
+			}
 			s.peer.putContext(ctx, false)
 			return
 		}
-		if err != nil {
+		if corrupted {
+			ctx.stat = statDataCorrupted.Copy(err)
+			s.stats.add(cntErrors, 1)
+		} else if err != nil {
 			ctx.stat = statBadMessage.Copy(err)
+			s.stats.add(cntErrors, 1)
+		} else {
+			s.stats.addMessage(ctx.input.Mtype(), ctx.input.Size(), false)
+			s.markActive(false)
+			s.peer.taps.capture(s, ctx.input, TapInbound)
+		}
+		var active int64
+		if mtype := ctx.input.Mtype(); mtype == TypeCall || mtype == TypePush {
+			active = 1
+			s.stats.addActiveHandlers(active)
 		}
 		s.graceCtxWaitGroup.Add(1)
-		if !Go(func() {
+		if !s.peer.goHandle(ctx, func() {
 			defer s.peer.putContext(ctx, true)
+			defer s.stats.addActiveHandlers(-active)
 			ctx.handle()
 		}) {
+			s.stats.addActiveHandlers(-active)
 			s.peer.putContext(ctx, true)
 		}
 	}
@@ -893,6 +1243,7 @@ func (s *session) write(message Message) (net.Conn, *Status) {
 	usedConn := s.getConn()
 	status := s.getStatus()
 	if !(status == statusOk || (status == statusActiveClosing && message.Mtype() == TypeReply)) {
+		s.stats.add(cntErrors, 1)
 		return usedConn, statConnClosed
 	}
 
@@ -908,7 +1259,13 @@ func (s *session) write(message Message) (net.Conn, *Status) {
 	default:
 	}
 
-	s.writeLock.Lock()
+	if s.writeDatagram(usedConn, message) {
+		return usedConn, nil
+	}
+
+	if err = s.writeLock.Lock(ctx, GetPriority(message.Meta())); err != nil {
+		goto ERR
+	}
 	defer s.writeLock.Unlock()
 
 	select {
@@ -921,19 +1278,33 @@ func (s *session) write(message Message) (net.Conn, *Status) {
 	}
 
 	if err == nil {
+		s.stats.addMessage(message.Mtype(), message.Size(), true)
+		s.markActive(true)
+		s.peer.taps.capture(s, message, TapOutbound)
 		return usedConn, nil
 	}
 
 	if err == io.EOF || err == socket.ErrProactivelyCloseSocket {
+		s.stats.add(cntErrors, 1)
 		return usedConn, statConnClosed
 	}
 
 	Debugf("write error: %s", err.Error())
 
 ERR:
+	s.stats.add(cntErrors, 1)
 	return usedConn, statWriteFailed.Copy(err)
 }
 
+// evict closes the connection without waiting for the handlers and the pending writes,
+// and the pending calls fail with the stat.
+func (s *session) evict(stat *Status) {
+	s.evicted.Store(stat)
+	if conn := s.socket.Raw(); conn != nil {
+		conn.Close()
+	}
+}
+
 // SessionHub sessions hub
 type SessionHub struct {
 	// key: session id (ip, name and so on)
@@ -1029,12 +1400,12 @@ func (s *session) printRunLog(realIP string, costTime time.Duration, input, outp
 	addr += "(real:" + realIP + ")"
 	var (
 		costTimeStr string
-		printFunc   = Infof
+		printFunc   = s.Infof
 	)
-	if s.peer.countTime {
-		if costTime >= s.peer.slowCometDuration {
+	if atomic.LoadInt32(&s.peer.countTime) != 0 {
+		if costTime >= s.peer.slowComet() {
 			costTimeStr = costTime.String() + "(slow)"
-			printFunc = Warnf
+			printFunc = s.Warnf
 		} else {
 			if GetLoggerLevel() < INFO {
 				return
@@ -1048,15 +1419,16 @@ func (s *session) printRunLog(realIP string, costTime time.Duration, input, outp
 		costTimeStr = "(-)"
 	}
 
+	printDetail := atomic.LoadInt32(&s.peer.printDetail) != 0
 	switch logType {
 	case typePushLaunch:
-		printFunc(logFormatPushLaunch, addr, costTimeStr, output.ServiceMethod(), messageLogBytes(output, s.peer.printDetail))
+		printFunc(logFormatPushLaunch, addr, costTimeStr, output.ServiceMethod(), messageLogBytes(output, printDetail))
 	case typePushHandle:
-		printFunc(logFormatPushHandle, addr, costTimeStr, input.ServiceMethod(), messageLogBytes(input, s.peer.printDetail))
+		printFunc(logFormatPushHandle, addr, costTimeStr, input.ServiceMethod(), messageLogBytes(input, printDetail))
 	case typeCallLaunch:
-		printFunc(logFormatCallLaunch, addr, costTimeStr, output.ServiceMethod(), messageLogBytes(output, s.peer.printDetail), messageLogBytes(input, s.peer.printDetail))
+		printFunc(logFormatCallLaunch, addr, costTimeStr, output.ServiceMethod(), messageLogBytes(output, printDetail), messageLogBytes(input, printDetail))
 	case typeCallHandle:
-		printFunc(logFormatCallHandle, addr, costTimeStr, input.ServiceMethod(), messageLogBytes(input, s.peer.printDetail), messageLogBytes(output, s.peer.printDetail))
+		printFunc(logFormatCallHandle, addr, costTimeStr, input.ServiceMethod(), messageLogBytes(input, printDetail), messageLogBytes(output, printDetail))
 	}
 }
 
@@ -0,0 +1,116 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"sync"
+
+	"github.com/andeya/goutil/errors"
+)
+
+// sessionPlugins the plugins of a session, executed after the plugins of the peer and the route.
+type sessionPlugins struct {
+	mu      sync.RWMutex
+	plugins []Plugin
+	merged  map[*PluginContainer]mergedPlugins
+}
+
+// mergedPlugins the container of the plugins of the peer or the route merged with the session plugins.
+type mergedPlugins struct {
+	base      []Plugin // the plugins of the base container when merged
+	container *PluginContainer
+}
+
+// WithDialPlugins attaches the plugins to the dialed session, see Session.AppendPlugins.
+// NOTE: Their PostDialPlugin hooks are executed too, also on redialing.
+func WithDialPlugins(plugins ...Plugin) DialOption {
+	return func(o *dialOptions) {
+		o.plugins = append(o.plugins, plugins...)
+	}
+}
+
+// AppendPlugins attaches the plugins to the session, e.g. by a PostAcceptPlugin based on the SNI,
+// the auth result or the client version, which are executed after the plugins of the peer and the route.
+// NOTE:
+//  The plugin name must be unique in the session and the peer;
+//  No effect on the executing hooks, i.e. the PostAcceptPlugin hooks of the accepting session.
+func (s *session) AppendPlugins(plugins ...Plugin) error {
+	sp := &s.plugins
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	all := make([]Plugin, 0, len(sp.plugins)+len(plugins))
+	all = append(all, sp.plugins...)
+	for _, plugin := range plugins {
+		if plugin == nil {
+			return errors.New("plugin cannot be nil")
+		}
+		name := plugin.Name()
+		if s.peer.pluginContainer.GetByName(name) != nil {
+			return errors.New("repeat add plugin: " + name)
+		}
+		for _, p := range all {
+			if p.Name() == name {
+				return errors.New("repeat add plugin: " + name)
+			}
+		}
+		all = append(all, plugin)
+	}
+	sp.plugins = all
+	sp.merged = nil
+	return nil
+}
+
+// Plugins returns the plugins attached to the session.
+func (s *session) Plugins() []Plugin {
+	s.plugins.mu.RLock()
+	defer s.plugins.mu.RUnlock()
+	return s.plugins.plugins
+}
+
+// withPlugins returns the container of the base plugins merged with the session plugins,
+// or the base one if the session has no plugins.
+func (s *session) withPlugins(base *PluginContainer) *PluginContainer {
+	sp := &s.plugins
+	sp.mu.RLock()
+	if len(sp.plugins) == 0 {
+		sp.mu.RUnlock()
+		return base
+	}
+	basePlugins := base.GetAll()
+	m, ok := sp.merged[base]
+	sp.mu.RUnlock()
+	if ok && samePlugins(m.base, basePlugins) {
+		return m.container
+	}
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	all := make([]Plugin, 0, len(basePlugins)+len(sp.plugins))
+	all = append(all, basePlugins...)
+	all = append(all, sp.plugins...)
+	c := newPluginContainer()
+	c.left.plugins = basePlugins
+	c.right.plugins = sp.plugins
+	c.pluginSingleContainer.plugins = sortPlugins(all)
+	if sp.merged == nil {
+		sp.merged = make(map[*PluginContainer]mergedPlugins)
+	}
+	sp.merged[base] = mergedPlugins{base: basePlugins, container: c}
+	return c
+}
+
+// samePlugins reports whether the plugin lists are the same one, i.e. the base container is not refreshed.
+func samePlugins(a, b []Plugin) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
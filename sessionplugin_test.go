@@ -0,0 +1,99 @@
+package erpc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recordPlugin records the hooks executed.
+type recordPlugin struct {
+	name  string
+	mu    sync.Mutex
+	hooks []string
+}
+
+func (p *recordPlugin) Name() string { return p.name }
+func (p *recordPlugin) record(hook string) {
+	p.mu.Lock()
+	p.hooks = append(p.hooks, hook)
+	p.mu.Unlock()
+}
+func (p *recordPlugin) recorded() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string{}, p.hooks...)
+}
+func (p *recordPlugin) PostDial(PreSession, bool) *Status {
+	p.record("PostDial")
+	return nil
+}
+func (p *recordPlugin) PreWriteCall(WriteCtx) *Status {
+	p.record("PreWriteCall")
+	return nil
+}
+func (p *recordPlugin) PostReadCallBody(ctx ReadCtx) *Status {
+	p.record("PostReadCallBody:" + ctx.ServiceMethod())
+	return nil
+}
+
+// attachPlugin attaches the plugin to the first accepted session.
+type attachPlugin struct {
+	plugin   Plugin
+	accepted int32
+}
+
+func (p *attachPlugin) Name() string { return "attach" }
+func (p *attachPlugin) PostAccept(sess PreSession) *Status {
+	if atomic.AddInt32(&p.accepted, 1) == 1 {
+		if err := sess.AppendPlugins(p.plugin); err != nil {
+			return NewStatus(CodeInternalServerError, err.Error(), nil)
+		}
+	}
+	return nil
+}
+
+func session_plugin(ctx CallCtx, arg *string) (string, *Status) {
+	return *arg, nil
+}
+
+func TestSessionPlugins(t *testing.T) {
+	verbose := &recordPlugin{name: "verbose"}
+	srv := NewPeer(PeerConfig{ListenPort: 9133}, &attachPlugin{plugin: verbose})
+	defer srv.Close()
+	srv.RouteCallFunc(session_plugin)
+	go srv.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := NewPeer(PeerConfig{})
+	defer cli.Close()
+	dialed := &recordPlugin{name: "dialed"}
+	sess1, stat := cli.DialContext(context.Background(), ":9133", WithDialPlugins(dialed))
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	sess2, stat := cli.Dial(":9133")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var reply string
+	for _, sess := range []Session{sess1, sess2} {
+		if stat = sess.Call("/session/plugin", "hi", &reply).Status(); !stat.OK() {
+			t.Fatal(stat)
+		}
+	}
+	if hooks := verbose.recorded(); len(hooks) != 1 || hooks[0] != "PostReadCallBody:/session/plugin" {
+		t.Fatalf("expect the calls of the first session only, got %v", hooks)
+	}
+	if hooks := dialed.recorded(); len(hooks) != 2 || hooks[0] != "PostDial" || hooks[1] != "PreWriteCall" {
+		t.Fatalf("dialed hooks: %v", hooks)
+	}
+	if n := len(sess2.Plugins()); n != 0 {
+		t.Fatalf("expect no plugins of the second session, got %d", n)
+	}
+	if err := sess1.AppendPlugins(&recordPlugin{name: "dialed"}); err == nil {
+		t.Fatal("expect the repeated plugin rejected")
+	}
+}
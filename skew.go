@@ -0,0 +1,116 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// MetaTime the unix nanoseconds of the clock of the sender,
+	// in the handshake messages of PeerConfig.Seq64 and PeerConfig.NegotiateCodec, and the pings and pongs
+	MetaTime = "X-Time"
+	// MetaTimeEcho the MetaTime of the answered message, in the handshake answers and the pongs
+	MetaTimeEcho = "X-Time-Echo"
+)
+
+// numSkewSamples the number of the recent samples of the clock skew estimation
+const numSkewSamples = 8
+
+// skewSample a sample of the clock offset of the remote peer, and the round-trip time of it.
+type skewSample struct {
+	offset time.Duration
+	rtt    time.Duration
+}
+
+// skewEstimator estimates the clock offset of the remote peer like NTP,
+// i.e. the offset of the sample of the min round-trip time among the recent ones.
+type skewEstimator struct {
+	mu      sync.Mutex
+	samples [numSkewSamples]skewSample
+	n       int
+	next    int
+}
+
+func (e *skewEstimator) add(sample skewSample) {
+	e.mu.Lock()
+	e.samples[e.next] = sample
+	e.next = (e.next + 1) % numSkewSamples
+	if e.n < numSkewSamples {
+		e.n++
+	}
+	e.mu.Unlock()
+}
+
+func (e *skewEstimator) estimate() (skewSample, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.n == 0 {
+		return skewSample{}, false
+	}
+	best := e.samples[0]
+	for _, s := range e.samples[1:e.n] {
+		if s.rtt < best.rtt {
+			best = s
+		}
+	}
+	return best, true
+}
+
+// withTime stamps the message by the peer clock.
+func (s *session) withTime() MessageSetting {
+	return WithSetMeta(MetaTime, strconv.FormatInt(s.peer.clock.Now().UnixNano(), 10))
+}
+
+// withTimeEcho stamps the answer of the message by the peer clock, and echoes the time of the message.
+func (s *session) withTimeEcho(header Header) MessageSetting {
+	now := strconv.FormatInt(s.peer.clock.Now().UnixNano(), 10)
+	echo := header.Meta().Peek(MetaTime)
+	return func(m Message) {
+		m.Meta().Set(MetaTime, now)
+		if len(echo) > 0 {
+			m.Meta().Set(MetaTimeEcho, string(echo))
+		}
+	}
+}
+
+// observeSkew samples the clock offset of the remote peer by the answer stamped by withTimeEcho.
+// NOTE:
+//  The offset is t1-(t0+t3)/2, where t0 is the echoed time of the sending, t1 is the time of the remote peer,
+//  and t3 is the time of the receiving, i.e. assuming the symmetric delays.
+func (s *session) observeSkew(header Header) {
+	t0, err0 := strconv.ParseInt(string(header.Meta().Peek(MetaTimeEcho)), 10, 64)
+	t1, err1 := strconv.ParseInt(string(header.Meta().Peek(MetaTime)), 10, 64)
+	if err0 != nil || err1 != nil {
+		return
+	}
+	t3 := s.peer.clock.Now().UnixNano()
+	if t3 < t0 {
+		return
+	}
+	s.skew.add(skewSample{offset: time.Duration(t1 - (t0+t3)/2), rtt: time.Duration(t3 - t0)})
+}
+
+// ClockSkew returns the estimated offset of the clock of the remote peer to the peer clock,
+// i.e. the remote time is about the local time plus the offset, and ok is false if not estimated yet.
+// NOTE:
+//  It is sampled by the handshakes of PeerConfig.Seq64 and PeerConfig.NegotiateCodec, and by the pings of the local peer;
+//  The error is at most half of the round-trip time of the sample.
+func (s *session) ClockSkew() (offset time.Duration, ok bool) {
+	sample, ok := s.skew.estimate()
+	return sample.offset, ok
+}
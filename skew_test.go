@@ -0,0 +1,70 @@
+package erpc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/erpctest"
+)
+
+func TestClockSkew(t *testing.T) {
+	start := time.Now()
+	srvClock, cliClock := erpctest.NewClock(start.Add(5*time.Second)), erpctest.NewClock(start)
+
+	// by the handshake
+	srv := erpc.NewPeer(erpc.PeerConfig{Seq64: true, Clock: srvClock})
+	defer srv.Close()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	cli := erpc.NewPeer(erpc.PeerConfig{Seq64: true, Clock: cliClock})
+	defer cli.Close()
+	sess, stat := cli.Dial(lis.Addr().String())
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	for i := 0; !sess.Seq64(); i++ {
+		if i > 100 {
+			t.Fatal("the 64-bit seq is not negotiated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if offset, ok := sess.ClockSkew(); !ok || offset != 5*time.Second {
+		t.Fatalf("offset: %v, ok: %v", offset, ok)
+	}
+
+	// by the pings
+	srv2 := erpc.NewPeer(erpc.PeerConfig{Clock: srvClock})
+	defer srv2.Close()
+	cli2 := erpc.NewPeer(erpc.PeerConfig{Clock: cliClock})
+	defer cli2.Close()
+	sess2, stat := erpc.ConnectPipe(srv2, cli2)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	if _, ok := sess2.ClockSkew(); ok {
+		t.Fatal("expect no estimation before the pings")
+	}
+	if _, stat = sess2.Ping(context.Background()); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if offset, ok := sess2.ClockSkew(); !ok || offset != 5*time.Second {
+		t.Fatalf("offset: %v, ok: %v", offset, ok)
+	}
+	var srvSess erpc.Session
+	srv2.RangeSession(func(s erpc.Session) bool {
+		srvSess = s
+		return false
+	})
+	if _, stat = srvSess.Ping(context.Background()); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if offset, ok := srvSess.ClockSkew(); !ok || offset != -5*time.Second {
+		t.Fatalf("offset: %v, ok: %v", offset, ok)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"fmt"
+	"time"
+)
+
+// The policies of the slow consumer, see PeerConfig.SlowConsumerMode.
+const (
+	// SlowConsumerLog logs a warning
+	SlowConsumerLog = "log"
+	// SlowConsumerEvent logs a warning and emits EventSlowConsumer
+	SlowConsumerEvent = "event"
+	// SlowConsumerClose logs a warning, emits EventSlowConsumer and closes the session
+	SlowConsumerClose = "close"
+)
+
+const (
+	// defaultSlowConsumerTime the default duration of the write queue above the threshold
+	defaultSlowConsumerTime = 10 * time.Second
+	// maxSlowConsumerCheck the max interval of checking the write queues
+	maxSlowConsumerCheck = time.Second
+)
+
+// slowConsumerMonitor checks the write queues of the sessions periodically,
+// and applies the policy to the sessions whose queue stays above the threshold.
+type slowConsumerMonitor struct {
+	peer     *peer
+	queue    int
+	duration time.Duration
+	mode     string
+	interval time.Duration
+}
+
+// newSlowConsumerMonitor returns nil if the detection is disabled.
+func newSlowConsumerMonitor(p *peer, cfg *PeerConfig) *slowConsumerMonitor {
+	if cfg.SlowConsumerQueue <= 0 {
+		return nil
+	}
+	m := &slowConsumerMonitor{
+		peer:     p,
+		queue:    cfg.SlowConsumerQueue,
+		duration: cfg.SlowConsumerTime,
+		mode:     cfg.SlowConsumerMode,
+		interval: cfg.SlowConsumerTime / 4,
+	}
+	if m.interval > maxSlowConsumerCheck {
+		m.interval = maxSlowConsumerCheck
+	}
+	return m
+}
+
+func (m *slowConsumerMonitor) start() {
+	m.peer.clock.AfterFunc(m.interval, m.check)
+}
+
+func (m *slowConsumerMonitor) check() {
+	select {
+	case <-m.peer.closeCh:
+		return
+	default:
+	}
+	now := m.peer.clock.Now()
+	m.peer.sessHub.rangeCallback(func(sess *session) bool {
+		m.checkSession(sess, now)
+		return true
+	})
+	m.start()
+}
+
+// checkSession applies the policy once when the write queue has stayed above the threshold for the duration,
+// and resets the detection after the queue drops.
+// NOTE: The slowSince and slowApplied fields of the session are only accessed here.
+func (m *slowConsumerMonitor) checkSession(sess *session, now time.Time) {
+	n := sess.writeLock.waiting()
+	if n <= m.queue {
+		sess.slowSince = time.Time{}
+		sess.slowApplied = false
+		return
+	}
+	if sess.slowSince.IsZero() {
+		sess.slowSince = now
+		return
+	}
+	if sess.slowApplied || now.Sub(sess.slowSince) < m.duration {
+		return
+	}
+	sess.slowApplied = true
+	stat := statSlowConsumer.Copy(fmt.Sprintf("write queue %d exceeds %d for %v", n, m.queue, now.Sub(sess.slowSince)))
+	Warnf("slow consumer: session(%s) %s, %s", sess.ID(), sess.RemoteAddr().String(), stat.Cause())
+	if m.mode == SlowConsumerLog {
+		return
+	}
+	e := m.peer.sessionEvent(EventSlowConsumer, sess)
+	e.Err = stat.Cause()
+	m.peer.events.emit(e)
+	if m.mode == SlowConsumerClose {
+		sess.evict(stat)
+	}
+}
@@ -0,0 +1,63 @@
+package erpc
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowConsumer(t *testing.T) {
+	srv := NewPeer(PeerConfig{
+		SlowConsumerQueue: 2,
+		SlowConsumerTime:  200 * time.Millisecond,
+		SlowConsumerMode:  SlowConsumerClose,
+	})
+	defer srv.Close()
+	events := srv.Events()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	time.Sleep(100 * time.Millisecond)
+
+	// the stuck client never reads
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var sess Session
+	for e := range events {
+		if e.Type == EventSessionAccepted {
+			sess = e.Session.(Session)
+			break
+		}
+	}
+	body := bytes.Repeat([]byte{'x'}, 1<<20)
+	for i := 0; i < 16; i++ {
+		go sess.Push("/slow/consumer", body)
+	}
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if e.Type != EventSlowConsumer {
+				continue
+			}
+			if e.Err == nil || !strings.Contains(e.Err.Error(), "exceeds 2") {
+				t.Fatalf("err: %v", e.Err)
+			}
+			select {
+			case <-sess.CloseNotify():
+			case <-time.After(time.Second):
+				t.Fatal("expect the slow consumer closed")
+			}
+			return
+		case <-timeout:
+			t.Fatal("expect the slow consumer event")
+		}
+	}
+}
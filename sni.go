@@ -0,0 +1,147 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"crypto/tls"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// sniHosts the certificates and routers selected by the TLS SNI host.
+type sniHosts struct {
+	mu      sync.RWMutex
+	certs   map[string]*tls.Certificate
+	routers map[string]*Router
+	// the certificate getter of the TLS config before installing the SNI selection
+	fallback func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	// the TLS config installed the SNI selection
+	installed *tls.Config
+}
+
+// matchSNIHost returns the value of the most specific matched host pattern:
+// the exact host, then the "*.suffix" wildcard matching exactly one label, then "*".
+func matchSNIHost(host string, has func(pattern string) bool) (string, bool) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host != "" && has(host) {
+		return host, true
+	}
+	// like the certificate verification, "*.example.com" matches "a.example.com" but not "a.b.example.com"
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		if pattern := "*" + host[i:]; has(pattern) {
+			return pattern, true
+		}
+	}
+	if has("*") {
+		return "*", true
+	}
+	return "", false
+}
+
+func normalizeHostPattern(hostPattern string) string {
+	hostPattern = strings.ToLower(strings.TrimSpace(hostPattern))
+	if hostPattern == "" {
+		return "*"
+	}
+	return hostPattern
+}
+
+func (h *sniHosts) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	h.mu.RLock()
+	pattern, ok := matchSNIHost(hello.ServerName, func(p string) bool { _, ok := h.certs[p]; return ok })
+	cert, fallback := h.certs[pattern], h.fallback
+	h.mu.RUnlock()
+	if ok {
+		return cert, nil
+	}
+	if fallback != nil {
+		return fallback(hello)
+	}
+	return nil, errors.New("tls: no certificate for the server name " + hello.ServerName)
+}
+
+func (h *sniHosts) getRouter(serverName string) (*Router, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	pattern, ok := matchSNIHost(serverName, func(p string) bool { _, ok := h.routers[p]; return ok })
+	return h.routers[pattern], ok
+}
+
+// AddTLSCertificate adds the server certificate selected by the TLS SNI host.
+// NOTE:
+//  The host pattern is the exact host, the "*.suffix" wildcard of one label, or "*" for the others;
+//  If the TLS config is not set, it is created for the server role only;
+//  The certificates of the original TLS config are used if no pattern matches;
+//  The certificates added after listening also take effect, if the first one is added before listening.
+func (p *peer) AddTLSCertificate(hostPattern string, cert tls.Certificate) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h := &p.sniHosts
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.certs == nil {
+		h.certs = make(map[string]*tls.Certificate)
+	}
+	h.certs[normalizeHostPattern(hostPattern)] = &cert
+	if p.tlsConfig != nil && p.tlsConfig == h.installed {
+		return
+	}
+	// install the SNI selection into the TLS config
+	var cfg = &tls.Config{}
+	h.fallback = nil
+	if p.tlsConfig != nil {
+		cfg = p.tlsConfig.Clone()
+		if cfg.GetCertificate != nil {
+			h.fallback = cfg.GetCertificate
+		} else if len(cfg.Certificates) > 0 {
+			defaultCert := &cfg.Certificates[0]
+			h.fallback = func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return defaultCert, nil }
+		}
+	}
+	cfg.GetCertificate = h.getCertificate
+	h.installed = cfg
+	p.tlsConfig = cfg
+}
+
+// SNIRouter returns the router for the sessions whose TLS SNI host matches the host pattern,
+// it is isolated from the root router, so one port can serve multiple tenants.
+// NOTE:
+//  The host pattern is the same as AddTLSCertificate;
+//  The sessions without matched SNI host use the root router.
+func (p *peer) SNIRouter(hostPattern string) *Router {
+	hostPattern = normalizeHostPattern(hostPattern)
+	h := &p.sniHosts
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if r, ok := h.routers[hostPattern]; ok {
+		return r
+	}
+	if h.routers == nil {
+		h.routers = make(map[string]*Router)
+	}
+	r := newRouter(p.pluginContainer, p.router.pools)
+	h.routers[hostPattern] = r
+	return r
+}
+
+// routeBySNI sets the router of the session by the TLS SNI host.
+func (p *peer) routeBySNI(sess *session, conn *tls.Conn) {
+	serverName := conn.ConnectionState().ServerName
+	if r, ok := p.sniHosts.getRouter(serverName); ok {
+		sess.getCallHandler = r.subRouter.getCall
+		sess.getPushHandler = r.subRouter.getPush
+	}
+}
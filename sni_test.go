@@ -0,0 +1,70 @@
+package erpc_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestSNI(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{ListenPort: 9109})
+	defaultCert := erpc.GenerateTLSConfigForServer().Certificates[0]
+	tenantCert := erpc.GenerateTLSConfigForServer().Certificates[0]
+	srv.AddTLSCertificate("*", defaultCert)
+	srv.AddTLSCertificate("*.example.com", tenantCert)
+	srv.RouteCallFunc(remote_addr)
+	srv.SNIRouter("*.example.com").RouteCallFunc(batch_call)
+	go srv.ListenAndServe()
+	defer srv.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	dial := func(serverName string) (erpc.Session, []byte) {
+		var leaf []byte
+		cli := erpc.NewPeer(erpc.PeerConfig{})
+		t.Cleanup(func() { cli.Close() })
+		cli.SetTLSConfig(&tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true,
+			VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+				leaf = rawCerts[0]
+				return nil
+			},
+		})
+		sess, stat := cli.Dial(":9109")
+		if !stat.OK() {
+			t.Fatal(stat)
+		}
+		return sess, leaf
+	}
+
+	var result int
+	sess, leaf := dial("a.example.com")
+	if !bytes.Equal(leaf, tenantCert.Certificate[0]) {
+		t.Fatal("a.example.com: not the tenant certificate")
+	}
+	if stat := sess.Call("/batch/call", 1, &result).Status(); !stat.OK() || result != 2 {
+		t.Fatalf("a.example.com: result: %d, stat: %v", result, stat)
+	}
+	if stat := sess.Call("/remote/addr", nil, nil).Status(); stat.Code() != erpc.CodeNotFound {
+		t.Fatalf("a.example.com: expect not found, got %v", stat)
+	}
+
+	// the wildcard matches exactly one label
+	sess, leaf = dial("a.b.example.com")
+	if !bytes.Equal(leaf, defaultCert.Certificate[0]) {
+		t.Fatal("a.b.example.com: not the default certificate")
+	}
+	if stat := sess.Call("/batch/call", 1, &result).Status(); stat.Code() != erpc.CodeNotFound {
+		t.Fatalf("a.b.example.com: expect not found, got %v", stat)
+	}
+
+	sess, leaf = dial("localhost")
+	if !bytes.Equal(leaf, defaultCert.Certificate[0]) {
+		t.Fatal("localhost: not the default certificate")
+	}
+	if stat := sess.Call("/batch/call", 1, &result).Status(); stat.Code() != erpc.CodeNotFound {
+		t.Fatalf("localhost: expect not found, got %v", stat)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socket
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/andeya/goutil"
+
+	"github.com/andeya/erpc/v7/utils"
+)
+
+// MetaBinarySuffix the suffix of the metadata keys whose values are binary, case-insensitive,
+// e.g. 'token-bin', so the tokens, hashes and serialized contexts need no base64 at every hop.
+// NOTE:
+//  The raw proto writes them in the binary metadata section without the urlencoding,
+//  the others urlencode them as usual, which is also binary-safe but larger;
+//  In the raw proto, the key length is limited to 255 and the value length to 65535.
+const MetaBinarySuffix = "-bin"
+
+// rawBinaryMetaFlag the second highest bit of message type, indicates that the binary metadata exist.
+const rawBinaryMetaFlag byte = 0x40
+
+var (
+	// ErrBadBinaryMeta error
+	ErrBadBinaryMeta = errors.New("raw proto: bad binary metadata")
+	// ErrExceedBinaryMetaSize error
+	ErrExceedBinaryMetaSize = errors.New("raw proto: size of binary metadata exceeds limit")
+)
+
+// IsBinaryMeta returns whether the metadata key has the MetaBinarySuffix.
+func IsBinaryMeta(key string) bool {
+	return len(key) >= len(MetaBinarySuffix) && strings.EqualFold(key[len(key)-len(MetaBinarySuffix):], MetaBinarySuffix)
+}
+
+// WithAddMetaBytes adds 'key=value' metadata argument, the value is copied.
+// Multiple values for the same key may be added.
+func WithAddMetaBytes(key string, value []byte) MessageSetting {
+	return func(m Message) {
+		m.Meta().AddBytesV(key, value)
+	}
+}
+
+// WithSetMetaBytes sets 'key=value' metadata argument, the value is copied.
+func WithSetMetaBytes(key string, value []byte) MessageSetting {
+	return func(m Message) {
+		m.Meta().SetBytesV(key, value)
+	}
+}
+
+// hasBinaryMeta returns whether any metadata key has the MetaBinarySuffix.
+func hasBinaryMeta(meta *utils.Args) (has bool) {
+	meta.VisitAll(func(key, _ []byte) {
+		if !has {
+			has = IsBinaryMeta(goutil.BytesToString(key))
+		}
+	})
+	return
+}
+
+// appendTextMeta appends the urlencoded metadata except the binary ones to dst.
+func appendTextMeta(dst []byte, meta *utils.Args) []byte {
+	first := true
+	meta.VisitAll(func(key, value []byte) {
+		if IsBinaryMeta(goutil.BytesToString(key)) {
+			return
+		}
+		if !first {
+			dst = append(dst, '&')
+		}
+		first = false
+		dst = utils.AppendQuotedArg(dst, key)
+		if len(value) > 0 {
+			dst = append(dst, '=')
+			dst = utils.AppendQuotedArg(dst, value)
+		}
+	})
+	return dst
+}
+
+// appendBinaryMeta appends the binary metadata to dst:
+// {1 byte key length}{key}{2 bytes value length}{value}...
+func appendBinaryMeta(dst []byte, meta *utils.Args) ([]byte, error) {
+	var err error
+	var l [2]byte
+	meta.VisitAll(func(key, value []byte) {
+		if err != nil || !IsBinaryMeta(goutil.BytesToString(key)) {
+			return
+		}
+		if len(key) > math.MaxUint8 || len(value) > math.MaxUint16 {
+			err = ErrExceedBinaryMetaSize
+			return
+		}
+		binary.BigEndian.PutUint16(l[:], uint16(len(value)))
+		dst = append(dst, byte(len(key)))
+		dst = append(dst, key...)
+		dst = append(dst, l[:]...)
+		dst = append(dst, value...)
+	})
+	return dst, err
+}
+
+// parseBinaryMeta adds the binary metadata parsed from data to meta.
+func parseBinaryMeta(data []byte, meta *utils.Args) error {
+	for len(data) > 0 {
+		key, rest, err := cutLen8(data)
+		if err != nil {
+			return ErrBadBinaryMeta
+		}
+		value, rest, err := cutLen16(rest)
+		if err != nil || !IsBinaryMeta(goutil.BytesToString(key)) {
+			return ErrBadBinaryMeta
+		}
+		meta.AddBytesKV(key, value)
+		data = rest
+	}
+	return nil
+}
+
+// writeMetaWithBinary writes the urlencoded metadata and the binary metadata with 2 bytes length prefixes to bb.
+func writeMetaWithBinary(bb *utils.ByteBuffer, meta *utils.Args) error {
+	start := bb.Len()
+	bb.B = appendTextMeta(append(bb.B, 0, 0), meta)
+	n := bb.Len() - start - 2
+	if n > math.MaxUint16 {
+		return errBadPackage
+	}
+	binary.BigEndian.PutUint16(bb.B[start:], uint16(n))
+
+	start = bb.Len()
+	var err error
+	bb.B, err = appendBinaryMeta(append(bb.B, 0, 0), meta)
+	if err != nil {
+		return err
+	}
+	n = bb.Len() - start - 2
+	if n > math.MaxUint16 {
+		return ErrExceedBinaryMetaSize
+	}
+	binary.BigEndian.PutUint16(bb.B[start:], uint16(n))
+	return nil
+}
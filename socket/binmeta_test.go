@@ -0,0 +1,34 @@
+package socket
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/andeya/erpc/v7/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBinaryMeta(t *testing.T) {
+	assert.True(t, IsBinaryMeta("token-BIN"))
+	assert.False(t, IsBinaryMeta("bin"))
+
+	value := []byte{0, '&', '=', '%', 0xff, '\n'}
+	w := new(countConn)
+	s := newSocket(w, nil)
+	m := GetMessage(WithServiceMethod("/a"), WithSetMeta("k", "a b"), WithSetMetaBytes("hash-bin", value), WithBodyCodec(codec.ID_JSON), WithBody("x"))
+	m.SetMtype(3)
+	assert.NoError(t, s.WriteMessage(m))
+	assert.False(t, bytes.Contains(w.buf.Bytes(), []byte("hash-bin=")))
+	PutMessage(m)
+
+	var body string
+	s = newSocket(&readConn{r: &w.buf}, nil)
+	m = GetMessage(WithNewBody(func(Header) interface{} { return &body }))
+	assert.NoError(t, s.ReadMessage(m))
+	assert.Equal(t, "/a", m.ServiceMethod())
+	assert.Equal(t, byte(3), m.Mtype())
+	assert.Equal(t, "a b", string(m.Meta().Peek("k")))
+	assert.Equal(t, value, m.Meta().Peek("hash-bin"))
+	assert.Equal(t, "x", body)
+	PutMessage(m)
+}
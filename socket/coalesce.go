@@ -0,0 +1,143 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socket
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// coalesceSize the max bytes of the pending messages, flushed by one write once reached.
+var coalesceSize = 64 * 1024
+
+// writeCoalescer coalesces the small messages written within the flush interval into one write.
+type writeCoalescer struct {
+	mu       sync.Mutex
+	interval int64 // time.Duration
+	conn     net.Conn
+	pending  []byte
+	timer    *time.Timer
+	armed    bool
+	err      error // the error of the last delayed flush, returned by the next write
+}
+
+// SetFlushInterval sets the max delay of coalescing the small messages into one write.
+// NOTE:
+//  If interval<=0, write immediately, the default;
+//  The buffered message is reported written before it is flushed, so its write error is not returned by its own write:
+//  the error of a delayed flush is returned by the next write, and the connection is closed
+//  to fail the session and its in-flight calls, instead of treating the lost messages as sent;
+//  The message bigger than 64KB is written with the pending ones by one writev.
+func (s *socket) SetFlushInterval(interval time.Duration) {
+	if interval <= 0 {
+		s.Flush()
+	}
+	atomic.StoreInt64(&s.coalescer.interval, int64(interval))
+}
+
+// Flush writes the pending coalesced messages immediately.
+func (s *socket) Flush() error {
+	return s.coalescer.flush()
+}
+
+// Write writes data to the connection, coalescing it with the others if the flush interval is set.
+// Write can be made to time out and return an Error with Timeout() == true
+// after a fixed time limit; see SetDeadline and SetWriteDeadline.
+func (s *socket) Write(b []byte) (int, error) {
+	if len(s.writeLimiters) > 0 {
+		s.throttle(s.writeLimiters, len(b))
+	}
+	interval := time.Duration(atomic.LoadInt64(&s.coalescer.interval))
+	if interval <= 0 {
+		return s.Conn.Write(b)
+	}
+	return s.coalescer.write(s.Conn, b, interval)
+}
+
+func (c *writeCoalescer) write(conn net.Conn, b []byte, interval time.Duration) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.err; err != nil {
+		c.err = nil
+		return 0, err
+	}
+	if c.conn != conn {
+		c.pending = c.pending[:0]
+		c.conn = conn
+	}
+	if len(c.pending)+len(b) <= coalesceSize {
+		c.pending = append(c.pending, b...)
+		if !c.armed {
+			c.armed = true
+			if c.timer == nil {
+				c.timer = time.AfterFunc(interval, c.delayedFlush)
+			} else {
+				c.timer.Reset(interval)
+			}
+		}
+		return len(b), nil
+	}
+	// writes the pending ones and the big one together
+	if len(c.pending) == 0 {
+		return conn.Write(b)
+	}
+	bufs := net.Buffers{c.pending, b}
+	_, err := bufs.WriteTo(conn)
+	c.pending = c.pending[:0]
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *writeCoalescer) delayedFlush() {
+	c.mu.Lock()
+	c.armed = false
+	conn := c.conn
+	err := c.flushLocked()
+	if err != nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+	if err != nil {
+		conn.Close()
+	}
+}
+
+func (c *writeCoalescer) flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flushLocked()
+}
+
+func (c *writeCoalescer) flushLocked() error {
+	if len(c.pending) == 0 || c.conn == nil {
+		return nil
+	}
+	_, err := c.conn.Write(c.pending)
+	c.pending = c.pending[:0]
+	return err
+}
+
+// reset discards the pending messages of the old connection.
+func (c *writeCoalescer) reset() {
+	c.mu.Lock()
+	c.pending = c.pending[:0]
+	c.conn = nil
+	c.err = nil
+	c.mu.Unlock()
+}
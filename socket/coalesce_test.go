@@ -0,0 +1,102 @@
+package socket
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countConn records the writes.
+type countConn struct {
+	net.Conn
+	mu     sync.Mutex
+	writes int
+	buf    bytes.Buffer
+	err    error
+	closed int
+}
+
+func (c *countConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.writes++
+	return c.buf.Write(b)
+}
+
+func (c *countConn) Close() error {
+	c.mu.Lock()
+	c.closed++
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *countConn) stat() (int, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.writes, c.buf.String()
+}
+
+func TestFlushInterval(t *testing.T) {
+	conn := new(countConn)
+	s := newSocket(conn, nil)
+	s.SetFlushInterval(20 * time.Millisecond)
+	for _, b := range []string{"a", "b", "c"} {
+		n, err := s.Write([]byte(b))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+	}
+	writes, data := conn.stat()
+	assert.Equal(t, 0, writes)
+	time.Sleep(60 * time.Millisecond)
+	writes, data = conn.stat()
+	assert.Equal(t, 1, writes)
+	assert.Equal(t, "abc", data)
+
+	// the big one is written with the pending ones
+	s.Write([]byte("d"))
+	big := bytes.Repeat([]byte("e"), coalesceSize)
+	n, err := s.Write(big)
+	assert.NoError(t, err)
+	assert.Equal(t, len(big), n)
+	_, data = conn.stat()
+	assert.Equal(t, "abcd"+string(big), data)
+
+	// the error of the delayed flush is returned by the next write
+	s.Write([]byte("f"))
+	conn.mu.Lock()
+	conn.err = errors.New("broken")
+	conn.mu.Unlock()
+	time.Sleep(60 * time.Millisecond)
+	_, err = s.Write([]byte("g"))
+	assert.EqualError(t, err, "broken")
+	// the connection is closed to fail the session
+	conn.mu.Lock()
+	assert.Equal(t, 1, conn.closed)
+	conn.mu.Unlock()
+
+	// flushed on close
+	conn.mu.Lock()
+	conn.err = nil
+	conn.mu.Unlock()
+	s.Write([]byte("h"))
+	s.Close()
+	_, data = conn.stat()
+	assert.Equal(t, byte('h'), data[len(data)-1])
+}
+
+func TestNoFlushInterval(t *testing.T) {
+	conn := new(countConn)
+	s := newSocket(conn, nil)
+	s.Write([]byte("a"))
+	s.Write([]byte("b"))
+	writes, _ := conn.stat()
+	assert.Equal(t, 2, writes)
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socket
+
+import (
+	"github.com/andeya/erpc/v7/xfer"
+)
+
+// autoCompressor applies the compression filter to the message only when its encoded body reaches the threshold.
+type autoCompressor struct {
+	filter   xfer.XferFilter
+	minBytes int // the default threshold, <=0 means only the messages with WithAutoCompress
+}
+
+// WithAutoCompress sets the threshold of the auto compression of the message,
+// i.e. the compression filter of the socket is applied only when the encoded body is at least minBytes.
+// NOTE:
+//  If minBytes<=0, never compress it automatically, overriding the default threshold of the socket;
+//  No effect if the socket has no compression filter, see SetAutoCompress.
+func WithAutoCompress(minBytes int) MessageSetting {
+	if minBytes <= 0 {
+		minBytes = -1
+	}
+	return func(m Message) {
+		m.(*message).autoCompress = minBytes
+	}
+}
+
+// SetAutoCompress sets the compression filter and the default threshold of the auto compression.
+// NOTE:
+//  If minBytes<=0, only the messages with WithAutoCompress are compressed automatically;
+//  The message whose transfer pipe already has the filter is not compressed again;
+//  Not concurrent safe with WriteMessage, call it before writing.
+func (s *socket) SetAutoCompress(minBytes int, filterID byte) error {
+	filter, err := s.filters.Get(filterID)
+	if err != nil {
+		return err
+	}
+	s.compressor = autoCompressor{filter: filter, minBytes: minBytes}
+	return nil
+}
+
+// autoCompress appends the compression filter and replaces the body with the encoded one,
+// if the encoded body reaches the threshold, and returns the old body to restore after writing.
+func (s *socket) autoCompress(m Message) (oldBody interface{}, ok bool) {
+	c := &s.compressor
+	if c.filter == nil {
+		return nil, false
+	}
+	minBytes := m.(*message).autoCompress
+	if minBytes == 0 {
+		minBytes = c.minBytes
+	}
+	if minBytes <= 0 {
+		return nil, false
+	}
+	id := c.filter.ID()
+	var has bool
+	m.XferPipe().Range(func(_ int, filter xfer.XferFilter) bool {
+		has = filter.ID() == id
+		return !has
+	})
+	if has {
+		return nil, false
+	}
+	bodyBytes, err := m.MarshalBody()
+	if err != nil || len(bodyBytes) < minBytes {
+		// NOTE: the error is returned by Pack
+		return nil, false
+	}
+	if m.XferPipe().Append(id) != nil {
+		return nil, false
+	}
+	oldBody = m.Body()
+	m.SetBody(bodyBytes)
+	return oldBody, true
+}
@@ -0,0 +1,195 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socket
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"sync/atomic"
+)
+
+// Extensions binary header extensions in TLV(type-length-value) format,
+// such as trace context, tenant id or compression dictionary id.
+// NOTE:
+//  Type 0 is invalid;
+//  A type has at most one value;
+//  The encoded size is limited by ExtensionsSizeLimit.
+type Extensions struct {
+	items []extension
+	size  int
+}
+
+type extension struct {
+	value []byte
+	typ   byte
+}
+
+const extensionHeaderLen = 3 // 1 byte type + 2 bytes length
+
+var (
+	defaultExtensionsSizeLimit uint32 = 4096
+	extensionsSizeLimit               = defaultExtensionsSizeLimit
+	// ErrInvalidExtensionType error
+	ErrInvalidExtensionType = errors.New("invalid extension type 0")
+	// ErrExceedExtensionsSizeLimit error
+	ErrExceedExtensionsSizeLimit = errors.New("size of extensions exceeds limit")
+	// ErrBadExtensions error
+	ErrBadExtensions = errors.New("bad extensions")
+)
+
+// ExtensionsSizeLimit gets the encoded size upper limit of extensions.
+func ExtensionsSizeLimit() uint32 {
+	return atomic.LoadUint32(&extensionsSizeLimit)
+}
+
+// SetExtensionsSizeLimit sets the encoded size upper limit of extensions.
+// If maxSize<=0, set it to 4096; if maxSize>65535, set it to 65535.
+func SetExtensionsSizeLimit(maxSize uint32) {
+	switch {
+	case maxSize <= 0:
+		maxSize = defaultExtensionsSizeLimit
+	case maxSize > math.MaxUint16:
+		maxSize = math.MaxUint16
+	}
+	atomic.StoreUint32(&extensionsSizeLimit, maxSize)
+}
+
+// Len returns the number of extensions.
+func (e *Extensions) Len() int {
+	return len(e.items)
+}
+
+// Size returns the encoded size of extensions.
+func (e *Extensions) Size() int {
+	return e.size
+}
+
+// Get returns the value of the extension type.
+// NOTE: The returned bytes must not be modified.
+func (e *Extensions) Get(typ byte) ([]byte, bool) {
+	if i, ok := e.search(typ); ok {
+		return e.items[i].value, true
+	}
+	return nil, false
+}
+
+// Has reports whether the extension type exists.
+func (e *Extensions) Has(typ byte) bool {
+	_, ok := e.search(typ)
+	return ok
+}
+
+// Set sets a copy of the value to the extension type, replacing any existing value.
+// If the encoded size exceeds ExtensionsSizeLimit, returns error and does nothing.
+func (e *Extensions) Set(typ byte, value []byte) error {
+	if typ == 0 {
+		return ErrInvalidExtensionType
+	}
+	i, ok := e.search(typ)
+	size := e.size + len(value)
+	if ok {
+		size -= len(e.items[i].value)
+	} else {
+		size += extensionHeaderLen
+	}
+	if uint32(size) > ExtensionsSizeLimit() {
+		return ErrExceedExtensionsSizeLimit
+	}
+	e.size = size
+	if ok {
+		e.items[i].value = append(e.items[i].value[:0], value...)
+		return nil
+	}
+	e.items = append(e.items, extension{})
+	copy(e.items[i+1:], e.items[i:])
+	e.items[i] = extension{typ: typ, value: append([]byte(nil), value...)}
+	return nil
+}
+
+// Del deletes the extension type.
+func (e *Extensions) Del(typ byte) {
+	i, ok := e.search(typ)
+	if !ok {
+		return
+	}
+	e.size -= extensionHeaderLen + len(e.items[i].value)
+	copy(e.items[i:], e.items[i+1:])
+	e.items[len(e.items)-1] = extension{}
+	e.items = e.items[:len(e.items)-1]
+}
+
+// VisitAll calls f for each extension in ascending order of type.
+// NOTE: f must not retain or modify the value.
+func (e *Extensions) VisitAll(f func(typ byte, value []byte)) {
+	for _, x := range e.items {
+		f(x.typ, x.value)
+	}
+}
+
+// Reset clears all extensions.
+func (e *Extensions) Reset() {
+	for i := range e.items {
+		e.items[i] = extension{}
+	}
+	e.items = e.items[:0]
+	e.size = 0
+}
+
+func (e *Extensions) search(typ byte) (int, bool) {
+	i := sort.Search(len(e.items), func(i int) bool {
+		return e.items[i].typ >= typ
+	})
+	return i, i < len(e.items) && e.items[i].typ == typ
+}
+
+// AppendTo appends the TLV encoding of extensions to dst:
+// {1 byte type}{2 bytes value length}{value}...
+func (e *Extensions) AppendTo(dst []byte) []byte {
+	var l [2]byte
+	for _, x := range e.items {
+		binary.BigEndian.PutUint16(l[:], uint16(len(x.value)))
+		dst = append(dst, x.typ)
+		dst = append(dst, l[:]...)
+		dst = append(dst, x.value...)
+	}
+	return dst
+}
+
+// Decode resets the extensions and parses them from the TLV encoding.
+// NOTE: The values are copied, so data can be reused.
+func (e *Extensions) Decode(data []byte) error {
+	e.Reset()
+	if uint32(len(data)) > ExtensionsSizeLimit() {
+		return ErrExceedExtensionsSizeLimit
+	}
+	for len(data) > 0 {
+		if len(data) < extensionHeaderLen {
+			e.Reset()
+			return ErrBadExtensions
+		}
+		typ := data[0]
+		n := int(binary.BigEndian.Uint16(data[1:]))
+		data = data[extensionHeaderLen:]
+		if n > len(data) || typ == 0 || e.Has(typ) {
+			e.Reset()
+			return ErrBadExtensions
+		}
+		e.Set(typ, data[:n])
+		data = data[n:]
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socket
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+)
+
+// ExtFragment the extension type of the frame of a fragmented message, reserved by the framework,
+// {4 bytes index in big endian}{1 byte flag, 1 means more frames follow}.
+// NOTE:
+//  The first frame carries the header of the message, and the continuation ones only the seq and the type;
+//  The frames of a message are written contiguously, and the body is the concatenation of their bodies.
+const ExtFragment byte = 0xfe
+
+const fragmentExtLen = 5
+
+var (
+	// ErrExceedReassemblySize error
+	ErrExceedReassemblySize = errors.New("size of reassembled message exceeds limit")
+	// ErrBadFragment error
+	ErrBadFragment = errors.New("bad fragment")
+)
+
+// fragmenter splits the large encoded bodies into the frames, and reassembles the frames read.
+type fragmenter struct {
+	size          int32  // the max body size of a frame written, <=0 means never fragment, atomic
+	maxReassembly int    // the max body size reassembled, <=0 means the read limit of the message
+	buf           []byte // the body reassembled so far
+	next          uint32 // the index of the next frame
+	more          bool   // whether more frames of the message follow
+	exceeded      bool   // whether the message exceeds maxReassembly, its remaining frames are discarded
+}
+
+// SetFragment sets the max body size of a frame of the messages written, the larger encoded body is
+// split into the continuation frames, and the max body size of the message reassembled from the frames read.
+// NOTE:
+//  If size<=0, never fragment, the default;
+//  If maxReassembly<=0, it is the read limit of the message, the default, see SetReadLimit and WithReadLimit;
+//  The message exceeding maxReassembly or the read limit is discarded, and ReadMessage returns ErrExceedReassemblySize;
+//  Only for the protocols carrying the extensions before the body, e.g. the default raw protocol;
+//  Not concurrent safe with ReadMessage and WriteMessage, call it before reading and writing.
+func (s *socket) SetFragment(size, maxReassembly int) {
+	s.SetFragmentSize(size)
+	s.fragmenter.maxReassembly = maxReassembly
+}
+
+// SetFragmentSize sets the max body size of a frame of the messages written, if size<=0, never fragment.
+// NOTE: Concurrent safe, e.g. to enable it after the remote peer agrees to reassemble the frames.
+func (s *socket) SetFragmentSize(size int) {
+	atomic.StoreInt32(&s.fragmenter.size, int32(size))
+}
+
+func (f *fragmenter) reset() {
+	f.buf = nil
+	f.next = 0
+	f.more = false
+	f.exceeded = false
+}
+
+func (f *fragmenter) limit(m *message) int {
+	limit := int(m.readSizeLimit())
+	if f.maxReassembly > 0 && f.maxReassembly < limit {
+		return f.maxReassembly
+	}
+	return limit
+}
+
+// add appends the body of the frame of the message, value is the ExtFragment extension of it.
+func (f *fragmenter) add(m *message, value, body []byte) error {
+	if len(value) != fragmentExtLen || binary.BigEndian.Uint32(value) != f.next {
+		f.reset()
+		return ErrBadFragment
+	}
+	f.next++
+	f.more = value[4] == 1
+	if f.exceeded {
+		return nil
+	}
+	if len(f.buf)+len(body) > f.limit(m) {
+		f.buf = nil
+		f.exceeded = true
+		return nil
+	}
+	f.buf = append(f.buf, body...)
+	return nil
+}
+
+func setFragmentExt(m Message, index uint32, more bool) {
+	var b [fragmentExtLen]byte
+	binary.BigEndian.PutUint32(b[:], index)
+	if more {
+		b[4] = 1
+	}
+	m.Extensions().Set(ExtFragment, b[:])
+}
+
+// writeFragments writes the message by the frames if its encoded body is larger than the frame size,
+// otherwise by one message with the encoded body, and returns false if the socket never fragments.
+func (s *socket) writeFragments(protocol Proto, msg Message) (bool, error) {
+	size := int(atomic.LoadInt32(&s.fragmenter.size))
+	if size <= 0 {
+		return false, nil
+	}
+	m := msg.(*message)
+	bodyBytes, err := m.MarshalBody()
+	if err != nil {
+		// NOTE: the error is returned by Pack
+		return false, nil
+	}
+	oldBody := m.body
+	defer func() { m.body = oldBody }()
+	if len(bodyBytes) <= size {
+		m.body = bodyBytes
+		return true, protocol.Pack(m)
+	}
+	defer m.extensions.Del(ExtFragment)
+
+	m.body = bodyBytes[:size]
+	setFragmentExt(m, 0, true)
+	if err = protocol.Pack(m); err != nil {
+		return true, err
+	}
+	total := m.size
+
+	c := GetMessage().(*message)
+	defer PutMessage(c)
+	for index := uint32(1); len(bodyBytes) > size; index++ {
+		bodyBytes = bodyBytes[size:]
+		n := len(bodyBytes)
+		if n > size {
+			n = size
+		}
+		c.Reset()
+		c.seq, c.mtype, c.bodyCodec, c.ctx = m.seq, m.mtype, m.bodyCodec, m.ctx
+		c.xferPipe.SetRegistry(m.xferPipe.Registry())
+		c.xferPipe.AppendFrom(m.xferPipe)
+		c.body = bodyBytes[:n]
+		setFragmentExt(c, index, n < len(bodyBytes))
+		if err = protocol.Pack(c); err != nil {
+			return true, err
+		}
+		total += c.size
+	}
+	m.size = total
+	return true, nil
+}
+
+// readFragments reads the continuation frames of the message, and unmarshals the body reassembled.
+func (s *socket) readFragments(protocol Proto, msg Message) error {
+	m := msg.(*message)
+	f := &s.fragmenter
+	total := m.size
+	c := GetMessage().(*message)
+	defer PutMessage(c)
+	for f.more {
+		c.Reset()
+		c.codecs = m.codecs
+		c.readLimit = m.readLimit
+		c.xferPipe.SetRegistry(m.xferPipe.Registry())
+		c.reader = s
+		err := protocol.Unpack(c)
+		if err == nil && (c.seq != m.seq || c.mtype != m.mtype || !c.extensions.Has(ExtFragment)) {
+			err = ErrBadFragment
+		}
+		if err != nil {
+			f.reset()
+			return err
+		}
+		total += c.size
+	}
+	exceeded, bodyBytes := f.exceeded, f.buf
+	f.reset()
+	m.size = total
+	m.extensions.Del(ExtFragment)
+	if exceeded {
+		return ErrExceedReassemblySize
+	}
+	// NOTE: the body is created by newBodyFunc when the first frame is read
+	newBodyFunc := m.newBodyFunc
+	m.newBodyFunc = nil
+	err := m.UnmarshalBody(bodyBytes)
+	m.newBodyFunc = newBodyFunc
+	return err
+}
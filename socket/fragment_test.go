@@ -0,0 +1,71 @@
+package socket
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/andeya/erpc/v7/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+func fragmentedFrames(t *testing.T, body []byte) (*bytes.Buffer, uint32) {
+	w := new(countConn)
+	s := newSocket(w, nil)
+	s.SetFragment(1000, 0)
+	m := GetMessage(WithServiceMethod("/a"), WithSetMeta("k", "v"), WithBody(body))
+	m.SetSeq(7)
+	assert.NoError(t, s.WriteMessage(m))
+	assert.Equal(t, 4, w.writes)
+	assert.False(t, m.Extensions().Has(ExtFragment))
+	assert.Equal(t, body, m.Body())
+	size := m.Size()
+	PutMessage(m)
+
+	m = GetMessage(WithServiceMethod("/b"), WithBodyCodec(codec.ID_JSON), WithBody("small"))
+	m.SetSeq(8)
+	assert.NoError(t, s.WriteMessage(m))
+	assert.Equal(t, 5, w.writes)
+	PutMessage(m)
+	return &w.buf, size
+}
+
+func TestFragment(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789"), 350)
+	buf, size := fragmentedFrames(t, body)
+	assert.Greater(t, size, uint32(len(body)))
+
+	s := newSocket(&readConn{r: buf}, nil)
+	m := GetMessage(WithNewBody(func(Header) interface{} { return new([]byte) }))
+	assert.NoError(t, s.ReadMessage(m))
+	assert.Equal(t, int32(7), m.Seq())
+	assert.Equal(t, "/a", m.ServiceMethod())
+	assert.Equal(t, "v", string(m.Meta().Peek("k")))
+	assert.False(t, m.Extensions().Has(ExtFragment))
+	assert.Equal(t, body, *m.Body().(*[]byte))
+	assert.Equal(t, size, m.Size())
+	PutMessage(m)
+
+	var small string
+	m = GetMessage(WithNewBody(func(Header) interface{} { return &small }))
+	assert.NoError(t, s.ReadMessage(m))
+	assert.Equal(t, "/b", m.ServiceMethod())
+	assert.Equal(t, "small", small)
+	PutMessage(m)
+}
+
+func TestFragmentExceedReassemblySize(t *testing.T) {
+	buf, _ := fragmentedFrames(t, bytes.Repeat([]byte("0123456789"), 350))
+	s := newSocket(&readConn{r: buf}, nil)
+	s.SetFragment(0, 2000)
+	m := GetMessage(WithNewBody(func(Header) interface{} { return new([]byte) }))
+	assert.Equal(t, ErrExceedReassemblySize, s.ReadMessage(m))
+	assert.Equal(t, "/a", m.ServiceMethod())
+	PutMessage(m)
+
+	// the remaining frames are discarded, and the next message is read
+	var small string
+	m = GetMessage(WithNewBody(func(Header) interface{} { return &small }))
+	assert.NoError(t, s.ReadMessage(m))
+	assert.Equal(t, "small", small)
+	PutMessage(m)
+}
@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"sync"
 
 	"github.com/andeya/erpc/v7/codec"
@@ -100,6 +101,9 @@ type (
 		// Meta returns the metadata.
 		// SUGGEST: urlencoded string max len ≤ 65535!
 		Meta() *utils.Args
+		// Extensions returns the binary header extensions.
+		// NOTE: The encoded size is limited by ExtensionsSizeLimit.
+		Extensions() *Extensions
 	}
 
 	// Body is an operation interface of optional message fields.
@@ -125,6 +129,10 @@ type (
 		//  if body=nil, try to use newBodyFunc to create a new one;
 		//  when the body is a stream of bytes, no unmarshalling is done.
 		UnmarshalBody(bodyBytes []byte) error
+		// Trailer returns the trailer metadata framed after the body,
+		// e.g. the checksum, timing or pagination cursor computed after the body is produced.
+		// NOTE: Only supported by the raw proto and the REPLY of the h2 proto, the others drop it.
+		Trailer() *utils.Args
 	}
 
 	// NewBodyFunc creates a new body by header,
@@ -140,10 +148,16 @@ type message struct {
 	serviceMethod string
 	status        *Status
 	meta          *utils.Args
+	trailer       *utils.Args
+	extensions    Extensions
 	body          interface{}
 	newBodyFunc   NewBodyFunc
 	xferPipe      *xfer.XferPipe
+	codecs        *codec.Registry // the registry of the body codec, nil means the global one
 	ctx           context.Context
+	autoCompress  int     // the threshold of the auto compression, 0 means the default of the socket, <0 means never
+	reader        *socket // the socket reading the message, only during reading
+	readLimit     uint32  // the max size of the message being read, 0 means the one of the socket
 	size          uint32
 	seq           int32
 	mtype         byte
@@ -179,6 +193,7 @@ func PutMessage(m Message) {
 func NewMessage(settings ...MessageSetting) Message {
 	var m = &message{
 		meta:     new(utils.Args),
+		trailer:  new(utils.Args),
 		xferPipe: xfer.NewXferPipe(),
 	}
 	m.doSetting(settings...)
@@ -217,13 +232,20 @@ func (m *message) Reset(settings ...MessageSetting) Message {
 	m.body = nil
 	m.status = nil
 	m.meta.Reset()
+	m.trailer.Reset()
+	m.extensions.Reset()
 	m.xferPipe.Reset()
+	m.xferPipe.SetRegistry(nil)
+	m.codecs = nil
 	m.newBodyFunc = nil
 	m.seq = 0
 	m.mtype = 0
 	m.serviceMethod = ""
 	m.size = 0
 	m.ctx = nil
+	m.autoCompress = 0
+	m.reader = nil
+	m.readLimit = 0
 	m.bodyCodec = codec.NilCodecID
 	m.doSetting(settings...)
 	return m
@@ -305,6 +327,19 @@ func (m *message) Meta() *utils.Args {
 	return m.meta
 }
 
+// Extensions returns the binary header extensions.
+// When the package is reset, it will be reset.
+// NOTE: The encoded size is limited by ExtensionsSizeLimit.
+func (m *message) Extensions() *Extensions {
+	return &m.extensions
+}
+
+// Trailer returns the trailer metadata framed after the body.
+// When the package is reset, it will be reset.
+func (m *message) Trailer() *utils.Args {
+	return m.trailer
+}
+
 // BodyCodec returns the body codec type id.
 func (m *message) BodyCodec() byte {
 	return m.bodyCodec
@@ -336,7 +371,7 @@ func (m *message) SetNewBody(newBodyFunc NewBodyFunc) {
 func (m *message) MarshalBody() ([]byte, error) {
 	switch body := m.body.(type) {
 	default:
-		c, err := codec.Get(m.bodyCodec)
+		c, err := m.codecs.Get(m.bodyCodec)
 		if err != nil {
 			return []byte{}, err
 		}
@@ -362,13 +397,18 @@ func (m *message) UnmarshalBody(bodyBytes []byte) error {
 	if m.body == nil && m.newBodyFunc != nil {
 		m.body = m.newBodyFunc(m)
 	}
+	if m.reader != nil {
+		if value, ok := m.extensions.Get(ExtFragment); ok {
+			return m.reader.fragmenter.add(m, value, bodyBytes)
+		}
+	}
 	length := len(bodyBytes)
 	if length == 0 {
 		return nil
 	}
 	switch body := m.body.(type) {
 	default:
-		c, err := codec.Get(m.bodyCodec)
+		c, err := m.codecs.Get(m.bodyCodec)
 		if err != nil {
 			return err
 		}
@@ -402,9 +442,8 @@ func (m *message) Size() uint32 {
 // If the size is too big, returns error.
 // SUGGEST: For better statistics, Proto interfaces should support it.
 func (m *message) SetSize(size uint32) error {
-	err := checkMessageSize(size)
-	if err != nil {
-		return err
+	if size > m.readSizeLimit() {
+		return ErrExceedMessageSizeLimit
 	}
 	m.size = size
 	return nil
@@ -417,8 +456,10 @@ const messageFormat = `
   "serviceMethod": %q,
   "status": %q,
   "meta": %q,
+  "extensions": %s,
   "bodyCodec": %d,
   "body": %s,
+  "trailer": %q,
   "xferPipe": %s,
   "size": %d
 }`
@@ -430,6 +471,11 @@ func (m *message) String() string {
 		xferPipeIDs[i] = int(id)
 	}
 	idsBytes, _ := json.Marshal(xferPipeIDs)
+	var extensions = make(map[string][]byte, m.extensions.Len())
+	m.extensions.VisitAll(func(typ byte, value []byte) {
+		extensions[strconv.Itoa(int(typ))] = value
+	})
+	extBytes, _ := json.Marshal(extensions)
 	b, _ := json.Marshal(m.body)
 	dst := bytes.NewBuffer(make([]byte, 0, len(b)*2))
 	json.Indent(dst, goutil.StringToBytes(
@@ -439,8 +485,10 @@ func (m *message) String() string {
 			m.serviceMethod,
 			m.status.QueryString(),
 			m.meta.QueryString(),
+			extBytes,
 			m.bodyCodec,
 			b,
+			m.trailer.QueryString(),
 			idsBytes,
 			m.size,
 		),
@@ -464,6 +512,20 @@ func WithContext(ctx context.Context) MessageSetting {
 	}
 }
 
+// WithRegistries sets the registries of the body codec and the transfer filters of the message,
+// e.g. of a peer, nil means the global one.
+// NOTE: It should be the first setting, before WithXferPipe.
+func WithRegistries(codecs *codec.Registry, filters *xfer.Registry) MessageSetting {
+	return func(m Message) {
+		m.(*message).setRegistries(codecs, filters)
+	}
+}
+
+func (m *message) setRegistries(codecs *codec.Registry, filters *xfer.Registry) {
+	m.codecs = codecs
+	m.xferPipe.SetRegistry(filters)
+}
+
 // WithServiceMethod sets the message service method.
 // SUGGEST: max len ≤ 255!
 func WithServiceMethod(serviceMethod string) MessageSetting {
@@ -503,6 +565,16 @@ func WithDelMeta(key string) MessageSetting {
 	}
 }
 
+// WithExtension sets the binary header extension.
+// NOTE: Panic if the type is 0 or the size of extensions exceeds limit.
+func WithExtension(typ byte, value []byte) MessageSetting {
+	return func(m Message) {
+		if err := m.Extensions().Set(typ, value); err != nil {
+			panic(err)
+		}
+	}
+}
+
 // WithBodyCodec sets the body codec.
 func WithBodyCodec(bodyCodec byte) MessageSetting {
 	return func(m Message) {
@@ -558,9 +630,31 @@ func SetMessageSizeLimit(maxMessageSize uint32) {
 	}
 }
 
-func checkMessageSize(messageSize uint32) error {
-	if messageSize > messageSizeLimit {
-		return ErrExceedMessageSizeLimit
+// WithReadLimit sets the max size of the message being read, e.g. by the route of it,
+// the smallest of it, the current one, the one of the socket and MessageSizeLimit applies.
+// NOTE:
+//  The size of the message already read is not checked again,
+//  i.e. it only applies to the continuation frames of the fragmented message, see SetFragment;
+//  If maxSize<=0, does nothing.
+func WithReadLimit(maxSize uint32) MessageSetting {
+	return func(m Message) {
+		if x := m.(*message); maxSize > 0 && (x.readLimit == 0 || maxSize < x.readLimit) {
+			x.readLimit = maxSize
+		}
 	}
-	return nil
+}
+
+// readSizeLimit returns the max size of the message being read,
+// the smallest of the one of it, the one of the socket reading it and MessageSizeLimit.
+func (m *message) readSizeLimit() uint32 {
+	limit := messageSizeLimit
+	if m.reader != nil {
+		if x := m.reader.ReadLimit(); x > 0 && x < limit {
+			limit = x
+		}
+	}
+	if m.readLimit > 0 && m.readLimit < limit {
+		limit = m.readLimit
+	}
+	return limit
 }
@@ -1,6 +1,7 @@
 package socket
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -48,3 +49,65 @@ func TestUint32Minus(t *testing.T) {
 	assert.EqualError(t, err, "raw proto: bad package")
 	assert.Equal(t, int(0), a)
 }
+
+func TestExtensions(t *testing.T) {
+	var e Extensions
+	assert.Equal(t, ErrInvalidExtensionType, e.Set(0, nil))
+	assert.NoError(t, e.Set(9, []byte("tenant")))
+	assert.NoError(t, e.Set(2, []byte{1, 2, 3}))
+	assert.Equal(t, 2, e.Len())
+	assert.Equal(t, 3*2+6+3, e.Size())
+	v, ok := e.Get(9)
+	assert.True(t, ok)
+	assert.Equal(t, "tenant", string(v))
+	assert.NoError(t, e.Set(9, []byte("t")))
+	assert.Equal(t, 3*2+1+3, e.Size())
+
+	var d Extensions
+	assert.NoError(t, d.Decode(e.AppendTo(nil)))
+	assert.Equal(t, e, d)
+	assert.Equal(t, ErrBadExtensions, d.Decode([]byte{2, 0, 5, 1}))
+	assert.Equal(t, 0, d.Len())
+
+	e.Del(2)
+	assert.False(t, e.Has(2))
+	assert.Equal(t, 3+1, e.Size())
+
+	SetExtensionsSizeLimit(8)
+	defer SetExtensionsSizeLimit(0)
+	assert.Equal(t, ErrExceedExtensionsSizeLimit, e.Set(3, []byte("more")))
+	assert.False(t, e.Has(3))
+}
+
+func TestRawProtoExtensions(t *testing.T) {
+	var buf bytes.Buffer
+	proto := RawProtoFunc(&buf)
+
+	m := NewMessage(
+		WithServiceMethod("/a/b"),
+		WithExtension(1, []byte("trace")),
+		WithExtension(200, []byte{0, 1}),
+		WithBody([]byte("body")),
+	)
+	m.SetMtype(1)
+	assert.NoError(t, proto.Pack(m))
+
+	var body []byte
+	r := NewMessage(WithNewBody(func(Header) interface{} { return &body }))
+	assert.NoError(t, proto.Unpack(r))
+	assert.Equal(t, byte(1), r.Mtype())
+	assert.Equal(t, "/a/b", r.ServiceMethod())
+	assert.Equal(t, "body", string(body))
+	v, _ := r.Extensions().Get(1)
+	assert.Equal(t, "trace", string(v))
+	v, _ = r.Extensions().Get(200)
+	assert.Equal(t, []byte{0, 1}, v)
+
+	// without extensions, the format is unchanged
+	m.Extensions().Reset()
+	assert.NoError(t, proto.Pack(m))
+	r.Reset(WithNewBody(func(Header) interface{} { return &body }))
+	assert.NoError(t, proto.Unpack(r))
+	assert.Equal(t, 0, r.Extensions().Len())
+	assert.Equal(t, "body", string(body))
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socket
+
+import (
+	"net"
+	"time"
+)
+
+// Options the TCP options of the connections of a socket,
+// overriding the package-global ones set by SetKeepAlive, SetKeepAlivePeriod, SetReadBuffer, SetWriteBuffer and SetNoDelay.
+// NOTE: The zero value of each field uses the package-global one.
+type Options struct {
+	// KeepAlive the period between the keepalives; if <0, disable the keepalive
+	KeepAlive time.Duration
+	// ReadBuffer the size of the operating system's receive buffer
+	ReadBuffer int
+	// WriteBuffer the size of the operating system's transmit buffer
+	WriteBuffer int
+	// NoDelay if >0, send the data as soon as possible; if <0, delay it by the Nagle's algorithm
+	NoDelay int
+}
+
+// IsZero reports whether all the options use the package-global ones.
+func (o Options) IsZero() bool {
+	return o == Options{}
+}
+
+// Apply sets the options to the connection after the package-global ones,
+// and ignores the options the connection does not support.
+func (o Options) Apply(conn net.Conn) {
+	TryOptimize(conn)
+	if c, ok := conn.(ifaceSetKeepAlive); ok {
+		if o.KeepAlive < 0 {
+			c.SetKeepAlive(false)
+		} else if o.KeepAlive > 0 {
+			c.SetKeepAlive(true)
+			c.SetKeepAlivePeriod(o.KeepAlive)
+		}
+	}
+	if c, ok := conn.(ifaceSetBuffer); ok {
+		if o.ReadBuffer > 0 {
+			c.SetReadBuffer(o.ReadBuffer)
+		}
+		if o.WriteBuffer > 0 {
+			c.SetWriteBuffer(o.WriteBuffer)
+		}
+	}
+	if c, ok := conn.(ifaceSetNoDelay); ok && o.NoDelay != 0 {
+		c.SetNoDelay(o.NoDelay > 0)
+	}
+}
+
+// SetOptions sets the TCP options of the connection, and of the connections reset later, e.g. by redialing.
+// NOTE: Not concurrent safe with Reset.
+func (s *socket) SetOptions(opts Options) {
+	s.options = opts
+	s.initOptimize()
+}
@@ -0,0 +1,64 @@
+package socket
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// optionsConn records the TCP options.
+type optionsConn struct {
+	net.Conn
+	keepAlive       bool
+	keepAlivePeriod time.Duration
+	readBuffer      int
+	writeBuffer     int
+	noDelay         bool
+}
+
+func (c *optionsConn) SetKeepAlive(keepalive bool) error {
+	c.keepAlive = keepalive
+	return nil
+}
+
+func (c *optionsConn) SetKeepAlivePeriod(d time.Duration) error {
+	c.keepAlivePeriod = d
+	return nil
+}
+
+func (c *optionsConn) SetReadBuffer(bytes int) error {
+	c.readBuffer = bytes
+	return nil
+}
+
+func (c *optionsConn) SetWriteBuffer(bytes int) error {
+	c.writeBuffer = bytes
+	return nil
+}
+
+func (c *optionsConn) SetNoDelay(noDelay bool) error {
+	c.noDelay = noDelay
+	return nil
+}
+
+func TestOptions(t *testing.T) {
+	// the global defaults
+	c := &optionsConn{keepAlive: true, noDelay: true}
+	s := newSocket(c, nil)
+	assert.Equal(t, &optionsConn{keepAlive: true, noDelay: true}, c)
+
+	s.SetOptions(Options{KeepAlive: time.Minute, ReadBuffer: 1024, WriteBuffer: 2048, NoDelay: -1})
+	assert.Equal(t, &optionsConn{keepAlive: true, keepAlivePeriod: time.Minute, readBuffer: 1024, writeBuffer: 2048}, c)
+
+	// kept after the reset
+	c2 := &optionsConn{keepAlive: true, noDelay: true}
+	s.Reset(c2)
+	assert.Equal(t, &optionsConn{keepAlive: true, keepAlivePeriod: time.Minute, readBuffer: 1024, writeBuffer: 2048}, c2)
+
+	c3 := &optionsConn{keepAlive: true}
+	Options{KeepAlive: -1, NoDelay: 1}.Apply(c3)
+	assert.Equal(t, &optionsConn{noDelay: true}, c3)
+	assert.True(t, Options{}.IsZero())
+}
@@ -40,6 +40,12 @@ type (
 		// NOTE: Concurrent unsafe!
 		Unpack(Message) error
 	}
+	// ExtensionsCarrier the optional interface of the Proto carrying the extensions of the messages,
+	// required by the framework features on the extensions, e.g. the fragmentation and the 64-bit seq.
+	ExtensionsCarrier interface {
+		// CarryExtensions reports whether the extensions of the messages are packed and unpacked.
+		CarryExtensions() bool
+	}
 	// IOWithReadBuffer implements buffered I/O with buffered reader.
 	IOWithReadBuffer interface {
 		io.ReadWriter
@@ -80,10 +86,25 @@ func SetDefaultProtoFunc(protoFunc ProtoFunc) {
 {status(urlencoded)}
 {2 bytes metadata length}
 {metadata(urlencoded)}
+# The following binary metadata exist only if the second highest bit of message type is 1
+{2 bytes binary metadata length}
+{binary metadata({1 byte key length}{key}{2 bytes value length}{value}...)}
+# The following extensions exist only if the highest bit of message type is 1
+{2 bytes extensions length}
+{extensions(TLV: {1 byte type}{2 bytes value length}{value}...)}
 {1 byte body codec id}
 {body}
+# The following trailer exist only if the third highest bit of message type is 1
+{trailer(urlencoded)}
+{2 bytes trailer length}
 */
 
+// rawExtensionsFlag the highest bit of message type, indicates that the extensions exist.
+const rawExtensionsFlag byte = 0x80
+
+// rawTrailerFlag the third highest bit of message type, indicates that the trailer exists after the body.
+const rawTrailerFlag byte = 0x20
+
 // rawProto fast socket communication protocol.
 type rawProto struct {
 	r    io.Reader
@@ -109,6 +130,11 @@ func (r *rawProto) Version() (byte, string) {
 	return r.id, r.name
 }
 
+// CarryExtensions reports whether the extensions of the messages are packed and unpacked.
+func (r *rawProto) CarryExtensions() bool {
+	return true
+}
+
 // Pack writes the Message into the connection.
 // NOTE: Make sure to write only once or there will be package contamination!
 func (r *rawProto) Pack(m Message) error {
@@ -166,7 +192,19 @@ func (r *rawProto) writeHeader(bb *utils.ByteBuffer, m Message) error {
 	bb.WriteByte(byte(len(seqStr)))
 	bb.Write(goutil.StringToBytes(seqStr))
 
-	bb.WriteByte(m.Mtype())
+	ext := m.Extensions()
+	mtype := m.Mtype()
+	if ext.Len() > 0 {
+		mtype |= rawExtensionsFlag
+	}
+	if m.Trailer().Len() > 0 {
+		mtype |= rawTrailerFlag
+	}
+	hasBinMeta := hasBinaryMeta(m.Meta())
+	if hasBinMeta {
+		mtype |= rawBinaryMetaFlag
+	}
+	bb.WriteByte(mtype)
 
 	serviceMethod := goutil.StringToBytes(m.ServiceMethod())
 	serviceMethodLength := len(serviceMethod)
@@ -175,13 +213,28 @@ func (r *rawProto) writeHeader(bb *utils.ByteBuffer, m Message) error {
 	}
 	bb.WriteByte(byte(serviceMethodLength))
 	bb.Write(serviceMethod)
-	statusBytes := m.Status(true).EncodeQuery()
+	// NOTE: the nil status is encoded as empty, i.e. OK, without allocating one
+	statusBytes := m.Status().EncodeQuery()
 	binary.Write(bb, binary.BigEndian, uint16(len(statusBytes)))
 	bb.Write(statusBytes)
 
-	metaBytes := m.Meta().QueryString()
-	binary.Write(bb, binary.BigEndian, uint16(len(metaBytes)))
-	bb.Write(metaBytes)
+	if hasBinMeta {
+		if err := writeMetaWithBinary(bb, m.Meta()); err != nil {
+			return err
+		}
+	} else {
+		metaBytes := m.Meta().QueryString()
+		binary.Write(bb, binary.BigEndian, uint16(len(metaBytes)))
+		bb.Write(metaBytes)
+	}
+
+	if ext.Len() > 0 {
+		if uint32(ext.Size()) > ExtensionsSizeLimit() {
+			return ErrExceedExtensionsSizeLimit
+		}
+		binary.Write(bb, binary.BigEndian, uint16(ext.Size()))
+		bb.B = ext.AppendTo(bb.B)
+	}
 	return nil
 }
 
@@ -192,6 +245,14 @@ func (r *rawProto) writeBody(bb *utils.ByteBuffer, m Message) error {
 		return err
 	}
 	bb.Write(bodyBytes)
+	if trailer := m.Trailer(); trailer.Len() > 0 {
+		trailerBytes := trailer.QueryString()
+		if len(trailerBytes) > math.MaxUint16 {
+			return errors.New("raw proto: not support trailer longer than 65535")
+		}
+		bb.Write(trailerBytes)
+		binary.Write(bb, binary.BigEndian, uint16(len(trailerBytes)))
+	}
 	return nil
 }
 
@@ -239,6 +300,9 @@ func (r *rawProto) readMessage(bb *utils.ByteBuffer, m Message) error {
 	if err != nil {
 		return err
 	}
+	if lastSize < 1 {
+		return errBadPackage
+	}
 	bb.ChangeLen(lastSize)
 
 	// transfer pipe
@@ -247,6 +311,9 @@ func (r *rawProto) readMessage(bb *utils.ByteBuffer, m Message) error {
 		return err
 	}
 	var xferLen = bb.B[0]
+	if int(xferLen) >= lastSize {
+		return errBadPackage
+	}
 	if xferLen > 0 {
 		_, err = io.ReadFull(r.r, bb.B[:xferLen])
 		if err != nil {
@@ -267,51 +334,127 @@ func (r *rawProto) readMessage(bb *utils.ByteBuffer, m Message) error {
 	return err
 }
 
+var errBadPackage = errors.New("raw proto: bad package")
+
 func minus(a int, b int) (int, error) {
 	r := a - b
 	if r < 0 || b < 0 {
-		return a, errors.New("raw proto: bad package")
+		return a, errBadPackage
 	}
 	return r, nil
 }
 
 func (r *rawProto) readHeader(data []byte, m Message) ([]byte, error) {
 	// seq
-	seqLen := data[0]
-	data = data[1:]
-	seq, err := strconv.ParseInt(goutil.BytesToString(data[:seqLen]), 36, 32)
+	seqBytes, data, err := cutLen8(data)
+	if err != nil {
+		return nil, err
+	}
+	seq, err := strconv.ParseInt(goutil.BytesToString(seqBytes), 36, 32)
 	if err != nil {
 		return nil, err
 	}
 	m.SetSeq(int32(seq))
-	data = data[seqLen:]
 
 	// type
-	m.SetMtype(data[0])
+	if len(data) < 1 {
+		return nil, errBadPackage
+	}
+	mtype := data[0]
+	m.SetMtype(mtype &^ (rawExtensionsFlag | rawBinaryMetaFlag | rawTrailerFlag))
 	data = data[1:]
 
 	// service method
-	serviceMethodLen := data[0]
-	data = data[1:]
-	m.SetServiceMethod(string(data[:serviceMethodLen]))
-	data = data[serviceMethodLen:]
+	serviceMethod, data, err := cutLen8(data)
+	if err != nil {
+		return nil, err
+	}
+	m.SetServiceMethod(string(serviceMethod))
 
 	// status
-	statusLen := binary.BigEndian.Uint16(data)
-	data = data[2:]
-	m.Status(true).DecodeQuery(data[:statusLen])
-	data = data[statusLen:]
+	statusBytes, data, err := cutLen16(data)
+	if err != nil {
+		return nil, err
+	}
+	m.Status(true).DecodeQuery(statusBytes)
 
 	// meta
-	metaLen := binary.BigEndian.Uint16(data)
-	data = data[2:]
-	m.Meta().ParseBytes(data[:metaLen])
-	data = data[metaLen:]
+	metaBytes, data, err := cutLen16(data)
+	if err != nil {
+		return nil, err
+	}
+	m.Meta().ParseBytes(metaBytes)
+	if mtype&rawBinaryMetaFlag != 0 {
+		var binMetaBytes []byte
+		binMetaBytes, data, err = cutLen16(data)
+		if err != nil {
+			return nil, ErrBadBinaryMeta
+		}
+		if err = parseBinaryMeta(binMetaBytes, m.Meta()); err != nil {
+			return nil, err
+		}
+	}
+
+	// extensions
+	if mtype&rawExtensionsFlag != 0 {
+		var extBytes []byte
+		extBytes, data, err = cutLen16(data)
+		if err != nil {
+			return nil, ErrBadExtensions
+		}
+		err = m.Extensions().Decode(extBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// trailer, at the end of the frame
+	if mtype&rawTrailerFlag != 0 {
+		if len(data) < 2 {
+			return nil, errBadPackage
+		}
+		n := int(binary.BigEndian.Uint16(data[len(data)-2:]))
+		data = data[:len(data)-2]
+		if n > len(data) {
+			return nil, errBadPackage
+		}
+		m.Trailer().ParseBytes(data[len(data)-n:])
+		data = data[:len(data)-n]
+	}
 
 	return data, nil
 }
 
+// cutLen8 cuts the field with 1 byte length prefix from the data.
+func cutLen8(data []byte) (field, rest []byte, err error) {
+	if len(data) < 1 {
+		return nil, nil, errBadPackage
+	}
+	n := int(data[0])
+	data = data[1:]
+	if n > len(data) {
+		return nil, nil, errBadPackage
+	}
+	return data[:n], data[n:], nil
+}
+
+// cutLen16 cuts the field with 2 bytes length prefix from the data.
+func cutLen16(data []byte) (field, rest []byte, err error) {
+	if len(data) < 2 {
+		return nil, nil, errBadPackage
+	}
+	n := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if n > len(data) {
+		return nil, nil, errBadPackage
+	}
+	return data[:n], data[n:], nil
+}
+
 func (r *rawProto) readBody(data []byte, m Message) error {
+	if len(data) < 1 {
+		return errBadPackage
+	}
 	m.SetBodyCodec(data[0])
 	return m.UnmarshalBody(data[1:])
 }
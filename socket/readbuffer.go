@@ -0,0 +1,109 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socket
+
+import (
+	"bufio"
+)
+
+// the default range of the adaptive read buffer size
+var (
+	readBufferMin = 1024
+	readBufferMax = 64 * 1024
+)
+
+// readBufferSizer sizes the read buffer by the moving average of the recent message sizes.
+type readBufferSizer struct {
+	min, max int
+	avg      int // the moving average of the recent message sizes
+}
+
+// SetReadBuffer sets the range of the adaptive read buffer size,
+// the buffer grows or shrinks within it by the recent message sizes.
+// NOTE:
+//  If min>=max, the buffer size is fixed to min;
+//  If min<=0, use the default 1KB, if max<=0, use the default 64KB;
+//  Not concurrent safe with ReadMessage, call it before reading.
+func (s *socket) SetReadBuffer(min, max int) {
+	if min <= 0 {
+		min = readBufferMin
+	}
+	if max <= 0 {
+		max = readBufferMax
+	}
+	if max < min {
+		max = min
+	}
+	s.readSizer = readBufferSizer{min: min, max: max}
+	if size := s.readerWithBuffer.Size(); size < min || size > max {
+		s.resizeReadBuffer(min)
+	}
+}
+
+// ReadBufferSize returns the current size of the read buffer.
+func (s *socket) ReadBufferSize() int {
+	return s.readerWithBuffer.Size()
+}
+
+// adaptReadBuffer records the size of the message read, and resizes the read buffer at the message boundary,
+// doubling it if the average is bigger, or halving it if the average is smaller than a quarter.
+func (s *socket) adaptReadBuffer(messageSize int) {
+	z := &s.readSizer
+	if z.min == 0 {
+		z.min, z.max = readBufferMin, readBufferMax
+	}
+	if z.min == z.max {
+		return
+	}
+	// EWMA with the weight 1/8
+	z.avg += (messageSize - z.avg) / 8
+	size := s.readerWithBuffer.Size()
+	target := size
+	switch {
+	case z.avg > size && size < z.max:
+		target = size * 2
+	case z.avg < size/4 && size > z.min:
+		target = size / 2
+	default:
+		return
+	}
+	if target > z.max {
+		target = z.max
+	} else if target < z.min {
+		target = z.min
+	}
+	if target != size {
+		s.resizeReadBuffer(target)
+	}
+}
+
+// resizeReadBuffer replaces the read buffer, and carries over the buffered bytes, which are read first.
+func (s *socket) resizeReadBuffer(size int) {
+	if n := s.readerWithBuffer.Buffered(); n > 0 {
+		b, _ := s.readerWithBuffer.Peek(n)
+		s.readCarry = append(s.readCarry, b...)
+	}
+	s.readerWithBuffer = bufio.NewReaderSize(s.Conn, size)
+}
+
+// readCarried reads the bytes carried over from the replaced read buffer.
+func (s *socket) readCarried(b []byte) int {
+	n := copy(b, s.readCarry)
+	s.readCarry = s.readCarry[n:]
+	if len(s.readCarry) == 0 {
+		s.readCarry = nil
+	}
+	return n
+}
@@ -0,0 +1,59 @@
+package socket
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readConn reads from the buffer.
+type readConn struct {
+	net.Conn
+	r *bytes.Buffer
+}
+
+func (c *readConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+func (c *readConn) Close() error { return nil }
+
+func frames(t *testing.T, n, bodySize int) *bytes.Buffer {
+	w := new(countConn)
+	s := newSocket(w, nil)
+	for i := 0; i < n; i++ {
+		m := GetMessage(WithServiceMethod("/a"), WithBody(bytes.Repeat([]byte{'x'}, bodySize)))
+		assert.NoError(t, s.WriteMessage(m))
+		PutMessage(m)
+	}
+	return &w.buf
+}
+
+func readFrames(t *testing.T, s *socket, n int) {
+	for i := 0; i < n; i++ {
+		m := GetMessage(WithNewBody(func(Header) interface{} { return new([]byte) }))
+		assert.NoError(t, s.ReadMessage(m))
+		PutMessage(m)
+	}
+}
+
+func TestAdaptiveReadBuffer(t *testing.T) {
+	buf := frames(t, 50, 20000)
+	buf.Write(frames(t, 200, 10).Bytes())
+	s := newSocket(&readConn{r: buf}, nil)
+	assert.Equal(t, readBufferMin, s.ReadBufferSize())
+
+	readFrames(t, s, 50)
+	assert.Equal(t, 32*1024, s.ReadBufferSize())
+
+	readFrames(t, s, 200)
+	assert.Equal(t, readBufferMin, s.ReadBufferSize())
+}
+
+func TestFixedReadBuffer(t *testing.T) {
+	s := newSocket(&readConn{r: frames(t, 20, 20000)}, nil)
+	s.SetReadBuffer(4096, 4096)
+	assert.Equal(t, 4096, s.ReadBufferSize())
+	readFrames(t, s, 20)
+	assert.Equal(t, 4096, s.ReadBufferSize())
+}
@@ -25,6 +25,8 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/andeya/erpc/v7/codec"
+	"github.com/andeya/erpc/v7/xfer"
 	"github.com/andeya/goutil"
 	"github.com/andeya/goutil/errors"
 )
@@ -109,10 +111,72 @@ type (
 		// NOTE:
 		//  Make sure the external is locked before calling
 		RawLocked() net.Conn
+		// ReadBoundary reports whether no byte of the next message has been read or buffered,
+		// i.e. the connection can be read by another reader from the message boundary.
+		// NOTE:
+		//  Make sure ReadMessage is not being called;
+		//  Only for the protocols reading by the socket, not by the raw net.Conn.
+		ReadBoundary() bool
+		// CarryExtensions reports whether the protocol carries the extensions of the messages, see ExtensionsCarrier.
+		CarryExtensions() bool
+		// SetFlushInterval sets the max delay of coalescing the small messages into one write.
+		// NOTE:
+		//  If interval<=0, write immediately, the default;
+		//  Only for the protocols writing by the socket, not by the raw net.Conn.
+		SetFlushInterval(interval time.Duration)
+		// Flush writes the pending coalesced messages immediately.
+		Flush() error
+		// SetAutoCompress sets the compression filter and the default threshold of the auto compression,
+		// i.e. the filter is applied to the message only when its encoded body is at least the threshold.
+		// NOTE:
+		//  If minBytes<=0, only the messages with WithAutoCompress are compressed automatically;
+		//  Not concurrent safe with WriteMessage, call it before writing.
+		SetAutoCompress(minBytes int, filterID byte) error
+		// SetFragment sets the max body size of a frame of the messages written, the larger encoded body is
+		// split into the continuation frames, and the max body size of the message reassembled from the frames read.
+		// NOTE:
+		//  If size<=0, never fragment, the default;
+		//  If maxReassembly<=0, it is the read limit of the message, the default, see SetReadLimit and WithReadLimit;
+		//  The message exceeding maxReassembly or the read limit is discarded, and ReadMessage returns ErrExceedReassemblySize;
+		//  Only for the protocols carrying the extensions before the body, e.g. the default raw protocol;
+		//  Not concurrent safe with ReadMessage and WriteMessage, call it before reading and writing.
+		SetFragment(size, maxReassembly int)
+		// SetFragmentSize sets the max body size of a frame of the messages written, if size<=0, never fragment.
+		// NOTE: Concurrent safe, e.g. to enable it after the remote peer agrees to reassemble the frames.
+		SetFragmentSize(size int)
+		// SetReadLimit sets the max size of the messages read by the socket,
+		// the smaller of it and MessageSizeLimit applies.
+		// NOTE: If maxSize<=0, only MessageSizeLimit applies, the default.
+		SetReadLimit(maxSize uint32)
+		// ReadLimit returns the max size of the messages read by the socket, 0 means only MessageSizeLimit applies.
+		ReadLimit() uint32
+		// SetReadBuffer sets the range of the adaptive read buffer size,
+		// the buffer grows or shrinks within it by the recent message sizes.
+		// NOTE:
+		//  If min>=max, the buffer size is fixed to min;
+		//  Not concurrent safe with ReadMessage, call it before reading.
+		SetReadBuffer(min, max int)
+		// ReadBufferSize returns the current size of the read buffer.
+		ReadBufferSize() int
+		// SetRateLimiters sets the limiters of the read and the write bandwidth,
+		// e.g. one of the socket and one shared by the sockets of a peer.
+		// NOTE:
+		//  The nil limiters are ignored;
+		//  Only for the protocols reading and writing by the socket, not by the raw net.Conn;
+		//  Not concurrent safe with ReadMessage and WriteMessage, call it before reading and writing.
+		SetRateLimiters(read, write []*RateLimiter)
+		// SetOptions sets the TCP options of the connection, and of the connections reset later, e.g. by redialing.
+		// NOTE: Not concurrent safe with Reset.
+		SetOptions(opts Options)
+		// SetRegistries sets the registries of the body codecs and the transfer filters of the messages read and written,
+		// e.g. of a peer, nil means the global ones.
+		// NOTE: Not concurrent safe with ReadMessage, WriteMessage and SetAutoCompress, call it before them.
+		SetRegistries(codecs *codec.Registry, filters *xfer.Registry)
 	}
 	socket struct {
 		net.Conn
 		readerWithBuffer *bufio.Reader
+		readInMessage    int // the bytes read of the message being read
 		protocol         Proto
 		id               string
 		idMutex          sync.RWMutex
@@ -121,6 +185,17 @@ type (
 		mu               sync.RWMutex
 		curState         int32
 		fromPool         bool
+		coalescer        writeCoalescer
+		readSizer        readBufferSizer
+		compressor       autoCompressor
+		fragmenter       fragmenter
+		readLimit        uint32 // the max size of the messages read, 0 means MessageSizeLimit
+		readCarry        []byte // the bytes buffered before the read buffer is resized
+		readLimiters     []*RateLimiter
+		writeLimiters    []*RateLimiter
+		options          Options
+		codecs           *codec.Registry
+		filters          *xfer.Registry
 	}
 )
 
@@ -152,8 +227,6 @@ var socketPool = sync.Pool{
 	},
 }
 
-var readerSize = 1024
-
 // NewSocket wraps a net.Conn as a Socket.
 func NewSocket(c net.Conn, protoFunc ...ProtoFunc) Socket {
 	return newSocket(c, protoFunc)
@@ -162,7 +235,7 @@ func NewSocket(c net.Conn, protoFunc ...ProtoFunc) Socket {
 func newSocket(c net.Conn, protoFuncs []ProtoFunc) *socket {
 	var s = &socket{
 		Conn:             c,
-		readerWithBuffer: bufio.NewReaderSize(c, readerSize),
+		readerWithBuffer: bufio.NewReaderSize(c, readBufferMin),
 	}
 	s.protocol = getProto(protoFuncs, s)
 	s.initOptimize()
@@ -189,7 +262,36 @@ func (s *socket) RawLocked() net.Conn {
 // Read can be made to time out and return an Error with Timeout() == true
 // after a fixed time limit; see SetDeadline and SetReadDeadline.
 func (s *socket) Read(b []byte) (int, error) {
-	return s.readerWithBuffer.Read(b)
+	var n int
+	var err error
+	if len(s.readCarry) > 0 {
+		n = s.readCarried(b)
+	} else {
+		n, err = s.readerWithBuffer.Read(b)
+	}
+	s.readInMessage += n
+	if len(s.readLimiters) > 0 {
+		s.throttle(s.readLimiters, n)
+	}
+	return n, err
+}
+
+// ReadBoundary reports whether no byte of the next message has been read or buffered,
+// i.e. the connection can be read by another reader from the message boundary.
+// NOTE:
+//  Make sure ReadMessage is not being called;
+//  Only for the protocols reading by the socket, not by the raw net.Conn.
+func (s *socket) ReadBoundary() bool {
+	return s.readInMessage == 0 && s.readerWithBuffer.Buffered() == 0 && len(s.readCarry) == 0
+}
+
+// CarryExtensions reports whether the protocol carries the extensions of the messages, see ExtensionsCarrier.
+func (s *socket) CarryExtensions() bool {
+	s.mu.RLock()
+	protocol := s.protocol
+	s.mu.RUnlock()
+	c, ok := protocol.(ExtensionsCarrier)
+	return ok && c.CarryExtensions()
 }
 
 // ControlFD invokes f on the underlying connection's file
@@ -218,7 +320,14 @@ func (s *socket) WriteMessage(message Message) error {
 	s.mu.RLock()
 	protocol := s.protocol
 	s.mu.RUnlock()
-	err := protocol.Pack(message)
+	s.bindRegistries(message)
+	if oldBody, ok := s.autoCompress(message); ok {
+		defer message.SetBody(oldBody)
+	}
+	fragmented, err := s.writeFragments(protocol, message)
+	if !fragmented {
+		err = protocol.Pack(message)
+	}
 	if err != nil && s.isActiveClosed() {
 		err = ErrProactivelyCloseSocket
 	}
@@ -233,7 +342,18 @@ func (s *socket) ReadMessage(message Message) error {
 	s.mu.RLock()
 	protocol := s.protocol
 	s.mu.RUnlock()
-	return protocol.Unpack(message)
+	s.bindRegistries(message)
+	s.bindReader(message, true)
+	err := protocol.Unpack(message)
+	s.bindReader(message, false)
+	if err == nil && message.Extensions().Has(ExtFragment) {
+		err = s.readFragments(protocol, message)
+	}
+	if err == nil {
+		s.readInMessage = 0
+		s.adaptReadBuffer(int(message.Size()))
+	}
+	return err
 }
 
 // Swap returns custom data swap of the socket.
@@ -288,6 +408,11 @@ func (s *socket) Reset(netConn net.Conn, protoFunc ...ProtoFunc) {
 	s.Conn = netConn
 	s.readerWithBuffer.Discard(s.readerWithBuffer.Buffered())
 	s.readerWithBuffer.Reset(netConn)
+	s.readInMessage = 0
+	s.readSizer.avg = 0
+	s.readCarry = nil
+	s.fragmenter.reset()
+	s.coalescer.reset()
 	s.protocol = getProto(protoFunc, s)
 	s.SetID("")
 	s.swapMutex.Lock()
@@ -314,9 +439,20 @@ func (s *socket) Close() error {
 
 	var err error
 	if s.Conn != nil {
+		_ = s.coalescer.flush()
 		_ = s.Conn.Close()
 	}
+	s.coalescer.reset()
 	if s.fromPool {
+		atomic.StoreInt64(&s.coalescer.interval, 0)
+		s.readSizer = readBufferSizer{}
+		s.compressor = autoCompressor{}
+		s.fragmenter = fragmenter{}
+		atomic.StoreUint32(&s.readLimit, 0)
+		s.readLimiters = nil
+		s.writeLimiters = nil
+		s.options = Options{}
+		s.codecs, s.filters = nil, nil
 		s.Conn = nil
 		s.swapMutex.Lock()
 		s.swap = nil
@@ -327,12 +463,55 @@ func (s *socket) Close() error {
 	return err
 }
 
+// SetReadLimit sets the max size of the messages read by the socket,
+// the smaller of it and MessageSizeLimit applies.
+// NOTE: If maxSize<=0, only MessageSizeLimit applies, the default.
+func (s *socket) SetReadLimit(maxSize uint32) {
+	atomic.StoreUint32(&s.readLimit, maxSize)
+}
+
+// ReadLimit returns the max size of the messages read by the socket, 0 means only MessageSizeLimit applies.
+func (s *socket) ReadLimit() uint32 {
+	return atomic.LoadUint32(&s.readLimit)
+}
+
+// SetRegistries sets the registries of the body codecs and the transfer filters of the messages read and written,
+// e.g. of a peer, nil means the global ones.
+// NOTE: Not concurrent safe with ReadMessage, WriteMessage and SetAutoCompress, call it before them.
+func (s *socket) SetRegistries(codecs *codec.Registry, filters *xfer.Registry) {
+	s.codecs, s.filters = codecs, filters
+}
+
+// bindReader sets the socket to the message being read, for its read limit and the reassembly of the frames,
+// or unsets it.
+func (s *socket) bindReader(msg Message, bind bool) {
+	if bind {
+		msg.(*message).reader = s
+	} else {
+		msg.(*message).reader = nil
+	}
+}
+
+// bindRegistries sets the registries of the socket to the message without them.
+func (s *socket) bindRegistries(msg Message) {
+	if s.codecs == nil && s.filters == nil {
+		return
+	}
+	m := msg.(*message)
+	if m.codecs == nil {
+		m.codecs = s.codecs
+	}
+	if m.xferPipe.Registry() == nil {
+		m.xferPipe.SetRegistry(s.filters)
+	}
+}
+
 func (s *socket) isActiveClosed() bool {
 	return atomic.LoadInt32(&s.curState) == activeClose
 }
 
 func (s *socket) initOptimize() {
-	TryOptimize(s.Conn)
+	s.options.Apply(s.Conn)
 }
 
 type (
@@ -0,0 +1,123 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socket
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxThrottleSleep the max duration of each sleep of the throttled read or write,
+// so the closed socket stops waiting soon.
+const maxThrottleSleep = 100 * time.Millisecond
+
+// RateLimiter a token bucket limiting the bytes per second,
+// which can be shared by the sockets to limit their total bandwidth.
+// NOTE:
+//  The bucket holds at most one second of the bytes, i.e. the burst;
+//  The read or write over the tokens is not split, it is done and the next one waits for the debt.
+type RateLimiter struct {
+	rate   int64 // bytes per second, <=0 means unlimited
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a bandwidth limiter of bytesPerSec.
+// NOTE: If bytesPerSec<=0, no limit.
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	r := new(RateLimiter)
+	r.SetRate(bytesPerSec)
+	return r
+}
+
+// SetRate sets the bytes per second at runtime.
+// NOTE: If bytesPerSec<=0, no limit.
+func (r *RateLimiter) SetRate(bytesPerSec int64) {
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	r.mu.Lock()
+	atomic.StoreInt64(&r.rate, bytesPerSec)
+	r.tokens = float64(bytesPerSec)
+	r.last = time.Now()
+	r.mu.Unlock()
+}
+
+// Rate returns the bytes per second, 0 means no limit.
+func (r *RateLimiter) Rate() int64 {
+	return atomic.LoadInt64(&r.rate)
+}
+
+// reserve takes n bytes from the bucket, and returns the delay until the debt is repaid.
+func (r *RateLimiter) reserve(n int) time.Duration {
+	if n <= 0 || atomic.LoadInt64(&r.rate) <= 0 {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rate := float64(r.rate)
+	if rate <= 0 {
+		return 0
+	}
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * rate
+	if r.tokens > rate {
+		r.tokens = rate
+	}
+	r.last = now
+	r.tokens -= float64(n)
+	if r.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-r.tokens / rate * float64(time.Second))
+}
+
+// SetRateLimiters sets the limiters of the read and the write bandwidth,
+// e.g. one of the socket and one shared by the sockets of a peer.
+// NOTE:
+//  The nil limiters are ignored;
+//  Only for the protocols reading and writing by the socket, not by the raw net.Conn;
+//  Not concurrent safe with ReadMessage and WriteMessage, call it before reading and writing.
+func (s *socket) SetRateLimiters(read, write []*RateLimiter) {
+	s.readLimiters = compactLimiters(read)
+	s.writeLimiters = compactLimiters(write)
+}
+
+func compactLimiters(limiters []*RateLimiter) []*RateLimiter {
+	var r []*RateLimiter
+	for _, l := range limiters {
+		if l != nil {
+			r = append(r, l)
+		}
+	}
+	return r
+}
+
+// throttle waits until all the limiters allow the n bytes, or the socket is closed.
+func (s *socket) throttle(limiters []*RateLimiter, n int) {
+	for _, l := range limiters {
+		delay := l.reserve(n)
+		for delay > 0 && !s.isActiveClosed() {
+			d := delay
+			if d > maxThrottleSleep {
+				d = maxThrottleSleep
+			}
+			time.Sleep(d)
+			delay -= d
+		}
+	}
+}
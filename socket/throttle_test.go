@@ -0,0 +1,52 @@
+package socket
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	r := NewRateLimiter(0)
+	assert.Equal(t, time.Duration(0), r.reserve(1<<30))
+
+	r.SetRate(1000)
+	assert.Equal(t, int64(1000), r.Rate())
+	// the burst of one second
+	assert.Equal(t, time.Duration(0), r.reserve(1000))
+	d := r.reserve(500)
+	assert.True(t, d > 400*time.Millisecond && d <= 500*time.Millisecond, d)
+
+	// unlimited at runtime
+	r.SetRate(-1)
+	assert.Equal(t, int64(0), r.Rate())
+	assert.Equal(t, time.Duration(0), r.reserve(1<<30))
+}
+
+func TestThrottle(t *testing.T) {
+	const rate = 64 * 1024
+	body := bytes.Repeat([]byte{'x'}, rate/2)
+	w := new(countConn)
+	s := newSocket(w, nil)
+	shared := NewRateLimiter(0)
+	s.SetRateLimiters(nil, []*RateLimiter{nil, NewRateLimiter(rate), shared})
+	start := time.Now()
+	// the burst, then half a second for each message
+	for i := 0; i < 4; i++ {
+		m := GetMessage(WithServiceMethod("/a"), WithBody(body))
+		assert.NoError(t, s.WriteMessage(m))
+		PutMessage(m)
+	}
+	cost := time.Since(start)
+	assert.True(t, cost > 800*time.Millisecond && cost < 1500*time.Millisecond, cost)
+
+	r := newSocket(&readConn{r: &w.buf}, nil)
+	r.SetRateLimiters([]*RateLimiter{shared}, nil)
+	shared.SetRate(rate)
+	start = time.Now()
+	readFrames(t, r, 4)
+	cost = time.Since(start)
+	assert.True(t, cost > 800*time.Millisecond && cost < 1500*time.Millisecond, cost)
+}
@@ -0,0 +1,161 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"sync/atomic"
+)
+
+// Stats the snapshot of the statistics of a session or a peer.
+// NOTE:
+//  The counters of a peer include the closed sessions;
+//  The messages of all the sending and receiving methods are counted, including PreCall, PreReply, PreReceive and RawPush.
+type Stats struct {
+	CallsSent       uint64 `json:"calls_sent"`
+	CallsReceived   uint64 `json:"calls_received"`
+	RepliesSent     uint64 `json:"replies_sent"`
+	RepliesReceived uint64 `json:"replies_received"`
+	PushesSent      uint64 `json:"pushes_sent"`
+	PushesReceived  uint64 `json:"pushes_received"`
+	BytesSent       uint64 `json:"bytes_sent"`
+	BytesReceived   uint64 `json:"bytes_received"`
+	// Errors the number of messages failed to write or read, and the calls or pushes failed to handle
+	Errors uint64 `json:"errors"`
+	// Corruptions the number of messages failed to read by the checksum mismatch of the integrity filters, included in Errors
+	Corruptions uint64 `json:"corruptions"`
+	// Expired the number of the calls failed and the pushes dropped by the expired TTL before the handlers, included in Errors, see WithTTL
+	Expired uint64 `json:"expired"`
+	// ActiveHandlers the number of the calls and pushes being handled
+	ActiveHandlers int64 `json:"active_handlers"`
+	// PendingCalls the number of the calls waiting for the reply
+	PendingCalls int64 `json:"pending_calls"`
+	// WriteQueue the number of messages waiting for writing
+	WriteQueue int64 `json:"write_queue"`
+	// HandlerQueue the number of messages waiting for the handler workers and the named handler pools, only for peer
+	HandlerQueue int64 `json:"handler_queue"`
+	// AdmissionQueue the number of messages waiting in the admission queue for the global goroutine pool, only for peer
+	AdmissionQueue int64 `json:"admission_queue"`
+	// Shed the number of the calls and pushes shed by the admission queue, only for peer
+	Shed uint64 `json:"shed"`
+}
+
+// indexes of the counters
+const (
+	cntCallsSent = iota
+	cntCallsReceived
+	cntRepliesSent
+	cntRepliesReceived
+	cntPushesSent
+	cntPushesReceived
+	cntBytesSent
+	cntBytesReceived
+	cntErrors
+	cntCorruptions
+	cntExpired
+	numCounters
+)
+
+// stats the counters of a session or a peer,
+// the counters of a session are also added to the peer's.
+type stats struct {
+	parent         *stats
+	counters       [numCounters]uint64
+	activeHandlers int64
+}
+
+func (s *stats) add(i int, n uint64) {
+	for ; s != nil; s = s.parent {
+		atomic.AddUint64(&s.counters[i], n)
+	}
+}
+
+func (s *stats) addActiveHandlers(n int64) {
+	for ; s != nil; s = s.parent {
+		atomic.AddInt64(&s.activeHandlers, n)
+	}
+}
+
+// addMessage counts the message written or read.
+func (s *stats) addMessage(mtype byte, size uint32, sent bool) {
+	i := -1
+	switch mtype {
+	case TypeCall, TypeAuthCall:
+		i = cntCallsSent
+	case TypeReply, TypeAuthReply:
+		i = cntRepliesSent
+	case TypePush:
+		i = cntPushesSent
+	}
+	bytes := cntBytesSent
+	if !sent {
+		bytes = cntBytesReceived
+	}
+	if i >= 0 {
+		if !sent {
+			// the received counter follows the sent one
+			i++
+		}
+		s.add(i, 1)
+	}
+	s.add(bytes, uint64(size))
+}
+
+func (s *stats) snapshot() Stats {
+	var c [numCounters]uint64
+	for i := range c {
+		c[i] = atomic.LoadUint64(&s.counters[i])
+	}
+	return Stats{
+		CallsSent:       c[cntCallsSent],
+		CallsReceived:   c[cntCallsReceived],
+		RepliesSent:     c[cntRepliesSent],
+		RepliesReceived: c[cntRepliesReceived],
+		PushesSent:      c[cntPushesSent],
+		PushesReceived:  c[cntPushesReceived],
+		BytesSent:       c[cntBytesSent],
+		BytesReceived:   c[cntBytesReceived],
+		Errors:          c[cntErrors],
+		Corruptions:     c[cntCorruptions],
+		Expired:         c[cntExpired],
+		ActiveHandlers:  atomic.LoadInt64(&s.activeHandlers),
+	}
+}
+
+// Stats returns the snapshot of the session statistics.
+func (s *session) Stats() Stats {
+	st := s.stats.snapshot()
+	st.PendingCalls = int64(s.callCmdMap.Len())
+	st.WriteQueue = int64(s.writeLock.waiting())
+	return st
+}
+
+// Stats returns the snapshot of the peer statistics.
+func (p *peer) Stats() Stats {
+	st := p.stats.snapshot()
+	p.sessHub.rangeCallback(func(sess *session) bool {
+		st.PendingCalls += int64(sess.callCmdMap.Len())
+		st.WriteQueue += int64(sess.writeLock.waiting())
+		return true
+	})
+	if p.handlerPool != nil {
+		st.HandlerQueue = int64(p.handlerPool.queued())
+	}
+	st.HandlerQueue += int64(p.router.pools.queued())
+	if p.admission != nil {
+		st.AdmissionQueue = p.admission.len()
+		st.Shed = atomic.LoadUint64(&p.admission.shed)
+	}
+	return st
+}
@@ -0,0 +1,37 @@
+package erpc_test
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{ListenPort: 9103})
+	srv.RouteCallFunc(batch_call)
+	go srv.ListenAndServe()
+	defer srv.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(":9103")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var result int
+	sess.Call("/batch/call", 1, &result)
+	sess.Call("/batch/call", -1, &result)
+	sess.Push("/not/found", nil)
+	time.Sleep(100 * time.Millisecond)
+
+	st := sess.Stats()
+	if st.CallsSent != 2 || st.RepliesReceived != 2 || st.PushesSent != 1 || st.BytesSent == 0 || st.BytesReceived == 0 {
+		t.Fatalf("session stats: %+v", st)
+	}
+	if st = cli.Stats(); st.CallsSent != 2 || st.PendingCalls != 0 {
+		t.Fatalf("client stats: %+v", st)
+	}
+	if st = srv.Stats(); st.CallsReceived != 2 || st.RepliesSent != 2 || st.PushesReceived != 1 || st.Errors != 2 || st.ActiveHandlers != 0 {
+		t.Fatalf("server stats: %+v", st)
+	}
+}
@@ -1,6 +1,9 @@
 package erpc
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/andeya/goutil/status"
 )
 
@@ -77,18 +80,23 @@ const (
 	CodeConnClosed          int32 = 102
 	CodeWriteFailed         int32 = 104
 	CodeDialFailed          int32 = 105
+	CodeCallCanceled        int32 = 106
+	CodeAckTimeout          int32 = 107
+	CodeSessionNotFound     int32 = 108
 	CodeBadMessage          int32 = 400
 	CodeUnauthorized        int32 = 401
 	CodeNotFound            int32 = 404
 	CodeMtypeNotAllowed     int32 = 405
 	CodeHandleTimeout       int32 = 408
+	CodeUnsupportedCodec    int32 = 415
+	CodeDataCorrupted       int32 = 422
+	CodeMetaTooLarge        int32 = 431
 	CodeInternalServerError int32 = 500
 	CodeBadGateway          int32 = 502
+	CodeServiceUnavailable  int32 = 503
 
 	// CodeConflict                      int32 = 409
 	// CodeUnsupportedTx                 int32 = 410
-	// CodeUnsupportedCodecType          int32 = 415
-	// CodeServiceUnavailable            int32 = 503
 	// CodeGatewayTimeout                int32 = 504
 	// CodeVariantAlsoNegotiates         int32 = 506
 	// CodeInsufficientStorage           int32 = 507
@@ -98,7 +106,7 @@ const (
 )
 
 // CodeText returns the reply error code text.
-// If the type is undefined returns 'Unknown Error'.
+// If the type is undefined or unregistered returns 'Unknown Error'.
 func CodeText(statCode int32) string {
 	switch statCode {
 	case CodeNoError:
@@ -117,23 +125,121 @@ func CodeText(statCode int32) string {
 		return "Connection Closed"
 	case CodeWriteFailed:
 		return "Write Failed"
+	case CodeCallCanceled:
+		return "Call Canceled"
+	case CodeAckTimeout:
+		return "Ack Timeout"
+	case CodeSessionNotFound:
+		return "Session Not Found"
 	case CodeNotFound:
 		return "Not Found"
 	case CodeHandleTimeout:
 		return "Handle Timeout"
 	case CodeMtypeNotAllowed:
 		return "Message Type Not Allowed"
+	case CodeUnsupportedCodec:
+		return "Unsupported Codec"
+	case CodeDataCorrupted:
+		return "Data Corrupted"
+	case CodeMetaTooLarge:
+		return "Metadata Too Large"
 	case CodeInternalServerError:
 		return "Internal Server Error"
 	case CodeBadGateway:
 		return "Bad Gateway"
+	case CodeServiceUnavailable:
+		return "Service Unavailable"
 	case CodeUnknownError:
-		fallthrough
+		return "Unknown Error"
 	default:
+		codeRegistry.RLock()
+		c, ok := codeRegistry.codes[statCode]
+		codeRegistry.RUnlock()
+		if ok {
+			return c.text
+		}
 		return "Unknown Error"
 	}
 }
 
+type registeredCode struct {
+	name string
+	text string
+}
+
+// codeRegistry the stable machine-readable names of the status codes.
+var codeRegistry = struct {
+	sync.RWMutex
+	codes map[int32]registeredCode
+	names map[string]int32
+}{
+	codes: map[int32]registeredCode{},
+	names: map[string]int32{},
+}
+
+func init() {
+	for code, name := range map[int32]string{
+		CodeUnknownError:        "UNKNOWN_ERROR",
+		CodeOK:                  "OK",
+		CodeInvalidOp:           "INVALID_OP",
+		CodeWrongConn:           "WRONG_CONN",
+		CodeConnClosed:          "CONN_CLOSED",
+		CodeWriteFailed:         "WRITE_FAILED",
+		CodeDialFailed:          "DIAL_FAILED",
+		CodeCallCanceled:        "CALL_CANCELED",
+		CodeAckTimeout:          "ACK_TIMEOUT",
+		CodeSessionNotFound:     "SESSION_NOT_FOUND",
+		CodeBadMessage:          "BAD_MESSAGE",
+		CodeUnauthorized:        "UNAUTHORIZED",
+		CodeNotFound:            "NOT_FOUND",
+		CodeMtypeNotAllowed:     "MTYPE_NOT_ALLOWED",
+		CodeHandleTimeout:       "HANDLE_TIMEOUT",
+		CodeUnsupportedCodec:    "UNSUPPORTED_CODEC",
+		CodeDataCorrupted:       "DATA_CORRUPTED",
+		CodeMetaTooLarge:        "META_TOO_LARGE",
+		CodeInternalServerError: "INTERNAL_SERVER_ERROR",
+		CodeBadGateway:          "BAD_GATEWAY",
+		CodeServiceUnavailable:  "SERVICE_UNAVAILABLE",
+	} {
+		codeRegistry.codes[code] = registeredCode{name: name, text: CodeText(code)}
+		codeRegistry.names[name] = code
+	}
+}
+
+// RegisterCode registers the custom status code with the stable machine-readable name and the text,
+// so that the clients can branch on the code by CodeByName instead of matching the msg.
+// NOTE:
+//  It panics if the code or the name is registered already, including the internal framework codes;
+//  Recommended custom code is greater than 1000.
+func RegisterCode(code int32, name, text string) {
+	codeRegistry.Lock()
+	defer codeRegistry.Unlock()
+	if c, ok := codeRegistry.codes[code]; ok {
+		panic(fmt.Sprintf("erpc: status code %d is registered already as %q", code, c.name))
+	}
+	if _, ok := codeRegistry.names[name]; ok || name == "" {
+		panic(fmt.Sprintf("erpc: status code name %q is empty or registered already", name))
+	}
+	codeRegistry.codes[code] = registeredCode{name: name, text: text}
+	codeRegistry.names[name] = code
+}
+
+// CodeName returns the stable machine-readable name of the status code, e.g. "NOT_FOUND".
+// If the code is unregistered returns "".
+func CodeName(code int32) string {
+	codeRegistry.RLock()
+	defer codeRegistry.RUnlock()
+	return codeRegistry.codes[code].name
+}
+
+// CodeByName returns the status code of the machine-readable name.
+func CodeByName(name string) (int32, bool) {
+	codeRegistry.RLock()
+	defer codeRegistry.RUnlock()
+	code, ok := codeRegistry.names[name]
+	return code, ok
+}
+
 // Internal Framework Status string.
 var (
 	statInvalidOpError      = NewStatus(CodeInvalidOp, CodeText(CodeInvalidOp), "")
@@ -141,11 +247,18 @@ var (
 	statDialFailed          = NewStatus(CodeDialFailed, CodeText(CodeDialFailed), "")
 	statConnClosed          = NewStatus(CodeConnClosed, CodeText(CodeConnClosed), "")
 	statWriteFailed         = NewStatus(CodeWriteFailed, CodeText(CodeWriteFailed), "")
+	statCallCanceled        = NewStatus(CodeCallCanceled, CodeText(CodeCallCanceled), "")
+	statAckTimeout          = NewStatus(CodeAckTimeout, CodeText(CodeAckTimeout), "")
+	statSessionNotFound     = NewStatus(CodeSessionNotFound, CodeText(CodeSessionNotFound), "")
 	statBadMessage          = NewStatus(CodeBadMessage, CodeText(CodeBadMessage), "")
 	statNotFound            = NewStatus(CodeNotFound, CodeText(CodeNotFound), "")
 	statCodeMtypeNotAllowed = NewStatus(CodeMtypeNotAllowed, CodeText(CodeMtypeNotAllowed), "")
 	statHandleTimeout       = NewStatus(CodeHandleTimeout, CodeText(CodeHandleTimeout), "")
+	statUnsupportedCodec    = NewStatus(CodeUnsupportedCodec, CodeText(CodeUnsupportedCodec), "")
+	statDataCorrupted       = NewStatus(CodeDataCorrupted, CodeText(CodeDataCorrupted), "")
 	statInternalServerError = NewStatus(CodeInternalServerError, CodeText(CodeInternalServerError), "")
+	statServiceUnavailable  = NewStatus(CodeServiceUnavailable, CodeText(CodeServiceUnavailable), "")
+	statSlowConsumer        = NewStatus(CodeConnClosed, "Slow Consumer", "")
 )
 
 // IsConnError determines whether the status is a connection error.
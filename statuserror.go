@@ -0,0 +1,240 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/andeya/erpc/v7/utils"
+	"github.com/andeya/goutil"
+)
+
+// MetaStatusDetails the key of the typed detail payloads of the reply status, encoded in JSON
+const MetaStatusDetails = "X-Status-Details"
+
+// WithCause returns a copy of the status with the wrapped cause, keeping the details.
+// NOTE:
+//  The cause is kept as is locally, so errors.Is and errors.As work on stat.Cause(),
+//  but only its text is sent to the remote peer.
+func WithCause(stat *Status, err error) *Status {
+	if stat == nil {
+		return nil
+	}
+	if c, ok := stat.Cause().(*statusCause); ok {
+		return stat.Copy(&statusCause{err: err, details: c.details})
+	}
+	return stat.Copy(err)
+}
+
+// WithStatusDetails returns a copy of the status with the typed detail payloads appended,
+// which are sent to the remote peer by the MetaStatusDetails metadata of the reply.
+// NOTE:
+//  The detail is encoded in JSON, its type should be registered by RegisterStatusDetail,
+//  otherwise it is decoded as json.RawMessage by the remote peer.
+func WithStatusDetails(stat *Status, details ...interface{}) *Status {
+	if stat == nil || len(details) == 0 {
+		return stat
+	}
+	c := &statusCause{err: stat.Cause()}
+	if old, ok := c.err.(*statusCause); ok {
+		c.err = old.err
+		c.details = append(c.details, old.details...)
+	}
+	if c.err == nil {
+		c.err = errors.New(stat.Msg())
+	}
+	c.details = append(c.details, details...)
+	return stat.Copy(c)
+}
+
+// StatusDetails returns the typed detail payloads of the status.
+func StatusDetails(stat *Status) []interface{} {
+	if c, ok := stat.Cause().(*statusCause); ok {
+		return c.details
+	}
+	return nil
+}
+
+// GetStatusDetail finds the first detail of the status that is assignable to the value pointed to by target,
+// and if so, sets target to that detail and returns true.
+// NOTE:
+//  target must be a non-nil pointer, like the target of errors.As.
+func GetStatusDetail(stat *Status, target interface{}) bool {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		panic("erpc: the target of GetStatusDetail must be a non-nil pointer")
+	}
+	t := v.Type().Elem()
+	for _, d := range StatusDetails(stat) {
+		if d != nil && reflect.TypeOf(d).AssignableTo(t) {
+			v.Elem().Set(reflect.ValueOf(d))
+			return true
+		}
+	}
+	return false
+}
+
+// statusCause the cause of the status with the typed detail payloads.
+type statusCause struct {
+	err     error
+	details []interface{}
+}
+
+func (c *statusCause) Error() string {
+	if c.err == nil {
+		return ""
+	}
+	return c.err.Error()
+}
+
+func (c *statusCause) Unwrap() error {
+	return c.err
+}
+
+// statusDetailTypes the registered types of the status detail payloads.
+var statusDetailTypes = struct {
+	sync.RWMutex
+	byName map[string]reflect.Type
+	byType map[reflect.Type]string
+}{
+	byName: map[string]reflect.Type{},
+	byType: map[reflect.Type]string{},
+}
+
+// RegisterStatusDetail registers the type of the status detail payload by the stable name,
+// so that the received details are decoded to that type.
+// NOTE:
+//  typ is a value of the type, e.g. RetryInfo{} or (*RetryInfo)(nil);
+//  It panics if the name or the type is registered already.
+func RegisterStatusDetail(name string, typ interface{}) {
+	t := reflect.TypeOf(typ)
+	if t == nil {
+		panic("erpc: the type of the status detail is nil")
+	}
+	statusDetailTypes.Lock()
+	defer statusDetailTypes.Unlock()
+	if _, ok := statusDetailTypes.byName[name]; ok {
+		panic(fmt.Sprintf("erpc: status detail %q is registered already", name))
+	}
+	if _, ok := statusDetailTypes.byType[t]; ok {
+		panic(fmt.Sprintf("erpc: status detail type %s is registered already", t))
+	}
+	statusDetailTypes.byName[name] = t
+	statusDetailTypes.byType[t] = name
+}
+
+type statusDetail struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// setStatusDetails sets the details of the status to the MetaStatusDetails metadata.
+func setStatusDetails(meta *utils.Args, stat *Status) {
+	details := StatusDetails(stat)
+	if len(details) == 0 {
+		return
+	}
+	a := make([]statusDetail, 0, len(details))
+	statusDetailTypes.RLock()
+	for _, d := range details {
+		b, err := json.Marshal(d)
+		if err != nil {
+			Warnf("marshal status detail %T: %s", d, err.Error())
+			continue
+		}
+		name, ok := statusDetailTypes.byType[reflect.TypeOf(d)]
+		if !ok {
+			name = reflect.TypeOf(d).String()
+		}
+		a = append(a, statusDetail{Type: name, Value: b})
+	}
+	statusDetailTypes.RUnlock()
+	b, _ := json.Marshal(a)
+	meta.Set(MetaStatusDetails, goutil.BytesToString(b))
+}
+
+// getStatusDetails returns the status with the details of the MetaStatusDetails metadata.
+func getStatusDetails(meta *utils.Args, stat *Status) *Status {
+	s := meta.Peek(MetaStatusDetails)
+	if len(s) == 0 || stat.OK() {
+		return stat
+	}
+	var a []statusDetail
+	if err := json.Unmarshal(s, &a); err != nil {
+		return stat
+	}
+	details := make([]interface{}, 0, len(a))
+	statusDetailTypes.RLock()
+	for _, d := range a {
+		t, ok := statusDetailTypes.byName[d.Type]
+		if !ok {
+			details = append(details, d.Value)
+			continue
+		}
+		v := reflect.New(t)
+		if err := json.Unmarshal(d.Value, v.Interface()); err != nil {
+			details = append(details, d.Value)
+			continue
+		}
+		details = append(details, v.Elem().Interface())
+	}
+	statusDetailTypes.RUnlock()
+	return WithStatusDetails(stat, details...)
+}
+
+// StatusError returns the status as an error, nil if the status is OK.
+// NOTE:
+//  errors.Is reports whether the codes are equal if the target is a status error too,
+//  and errors.Unwrap returns stat.Cause().
+func StatusError(stat *Status) error {
+	if stat.OK() {
+		return nil
+	}
+	return &statusError{stat: stat}
+}
+
+// StatusFromError returns the status of the error from StatusError in the chain,
+// or a status of CodeUnknownError with the error as the cause, nil if err is nil.
+func StatusFromError(err error) *Status {
+	if err == nil {
+		return nil
+	}
+	var e *statusError
+	if errors.As(err, &e) {
+		return e.stat
+	}
+	return NewStatus(CodeUnknownError, CodeText(CodeUnknownError), err)
+}
+
+type statusError struct {
+	stat *Status
+}
+
+func (e *statusError) Error() string {
+	return e.stat.String()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.stat.Cause()
+}
+
+func (e *statusError) Is(target error) bool {
+	t, ok := target.(*statusError)
+	return ok && t.stat.Code() == e.stat.Code()
+}
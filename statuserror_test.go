@@ -0,0 +1,85 @@
+package erpc
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+type statusRetryInfo struct {
+	Delay string `json:"delay"`
+}
+
+func statusErr_fail(ctx CallCtx, arg *string) (string, *Status) {
+	stat := NewStatus(5001, "quota exceeded", "")
+	return "", WithStatusDetails(stat, statusRetryInfo{Delay: "1s"}, map[string]int{"limit": 10})
+}
+
+var registerStatusOnce sync.Once
+
+func TestStatusError(t *testing.T) {
+	registerStatusOnce.Do(func() {
+		RegisterCode(5001, "QUOTA_EXCEEDED", "Quota Exceeded")
+		RegisterStatusDetail("test.RetryInfo", statusRetryInfo{})
+	})
+	if CodeText(5001) != "Quota Exceeded" || CodeName(5001) != "QUOTA_EXCEEDED" || CodeName(CodeNotFound) != "NOT_FOUND" {
+		t.Fatalf("code text: %q, name: %q", CodeText(5001), CodeName(5001))
+	}
+	if code, ok := CodeByName("QUOTA_EXCEEDED"); !ok || code != 5001 {
+		t.Fatalf("code by name: %d, %v", code, ok)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expect panic on the registered code")
+			}
+		}()
+		RegisterCode(CodeNotFound, "MY_NOT_FOUND", "")
+	}()
+
+	// wrapping causes
+	stat := WithCause(statNotFound, io.EOF)
+	if !errors.Is(stat.Cause(), io.EOF) || statNotFound.Cause() == stat.Cause() {
+		t.Fatalf("cause: %v", stat.Cause())
+	}
+	err := StatusError(stat)
+	if !errors.Is(err, io.EOF) || !errors.Is(err, StatusError(statNotFound)) || errors.Is(err, StatusError(statBadMessage)) {
+		t.Fatalf("errors.Is: %v", err)
+	}
+	if StatusFromError(err) != stat || StatusFromError(io.EOF).Code() != CodeUnknownError || StatusError(nil) != nil {
+		t.Fatal("StatusFromError")
+	}
+	stat = WithStatusDetails(stat, statusRetryInfo{Delay: "2s"})
+	if !errors.Is(stat.Cause(), io.EOF) || len(StatusDetails(WithCause(stat, io.ErrUnexpectedEOF))) != 1 {
+		t.Fatalf("details with cause: %v", stat.Cause())
+	}
+
+	// the details over the wire
+	srv := NewPeer(PeerConfig{ListenPort: 9129})
+	defer srv.Close()
+	srv.RouteCallFunc(statusErr_fail)
+	go srv.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := NewPeer(PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(":9129")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var reply string
+	stat = sess.Call("/status_err/fail", "hello", &reply).Status()
+	if stat.Code() != 5001 || stat.Msg() != "quota exceeded" {
+		t.Fatalf("stat: %v", stat)
+	}
+	var info statusRetryInfo
+	if !GetStatusDetail(stat, &info) || info.Delay != "1s" {
+		t.Fatalf("detail: %+v", StatusDetails(stat))
+	}
+	if details := StatusDetails(stat); len(details) != 2 || string(details[1].(json.RawMessage)) != `{"limit":10}` {
+		t.Fatalf("details: %+v", details)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andeya/erpc/v7/socket"
+	"github.com/andeya/erpc/v7/utils"
+	"github.com/andeya/goutil"
+)
+
+// MetaAcceptLanguage the key of the languages that the caller wishes to accept for the status msg,
+// in the format of the HTTP Accept-Language header, e.g. "zh-CN,zh;q=0.9,en;q=0.8"
+const MetaAcceptLanguage = "X-Accept-Language"
+
+// WithAcceptLanguage sets the languages that the caller wishes to accept for the status msg of the reply.
+func WithAcceptLanguage(acceptLanguage string) MessageSetting {
+	if acceptLanguage == "" {
+		return WithNothing()
+	}
+	return socket.WithSetMeta(MetaAcceptLanguage, acceptLanguage)
+}
+
+// statusTexts the message templates of the status codes by the lower case locale.
+var statusTexts = struct {
+	sync.RWMutex
+	m map[int32]map[string]string
+}{
+	m: map[int32]map[string]string{},
+}
+
+// RegisterStatusText registers the message template of the status code in the locale, e.g. "zh-CN",
+// which replaces the msg of the reply status if the caller accepts the language by MetaAcceptLanguage.
+// NOTE:
+//  The "{msg}" and "{cause}" in the template are replaced with the original msg and cause;
+//  The code is kept as is, so the clients still branch on it.
+func RegisterStatusText(code int32, locale, template string) {
+	statusTexts.Lock()
+	defer statusTexts.Unlock()
+	texts := statusTexts.m[code]
+	if texts == nil {
+		texts = make(map[string]string)
+		statusTexts.m[code] = texts
+	}
+	texts[strings.ToLower(locale)] = template
+}
+
+// LocalizeStatus returns a copy of the status with the msg of the template that best matches the accepted languages,
+// or the status itself if no template matches.
+func LocalizeStatus(stat *Status, acceptLanguage string) *Status {
+	if stat.OK() || acceptLanguage == "" {
+		return stat
+	}
+	statusTexts.RLock()
+	texts := statusTexts.m[stat.Code()]
+	var (
+		template string
+		ok       bool
+	)
+	for _, locale := range parseAcceptLanguage(acceptLanguage) {
+		if template, ok = texts[locale]; ok {
+			break
+		}
+		// e.g. "zh-cn" falls back to "zh"
+		if i := strings.IndexByte(locale, '-'); i > 0 {
+			if template, ok = texts[locale[:i]]; ok {
+				break
+			}
+		}
+	}
+	statusTexts.RUnlock()
+	if !ok {
+		return stat
+	}
+	var cause string
+	if err := stat.Cause(); err != nil {
+		cause = err.Error()
+	}
+	msg := strings.NewReplacer("{msg}", stat.Msg(), "{cause}", cause).Replace(template)
+	return stat.Copy(nil).SetMsg(msg)
+}
+
+// localizeStatus localizes the reply status by the MetaAcceptLanguage metadata of the input message.
+func localizeStatus(stat *Status, meta *utils.Args) *Status {
+	s := meta.Peek(MetaAcceptLanguage)
+	if len(s) == 0 {
+		return stat
+	}
+	return LocalizeStatus(stat, goutil.BytesToString(s))
+}
+
+// parseAcceptLanguage returns the lower case locales in the descending order of the quality,
+// the ones of q=0 and "*" are dropped.
+func parseAcceptLanguage(s string) []string {
+	type lang struct {
+		locale string
+		q      float64
+	}
+	var langs []lang
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		q := 1.0
+		if i := strings.IndexByte(part, ';'); i >= 0 {
+			param := strings.TrimSpace(part[i+1:])
+			part = strings.TrimSpace(part[:i])
+			if strings.HasPrefix(param, "q=") {
+				f, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					continue
+				}
+				q = f
+			}
+		}
+		if part == "" || part == "*" || q <= 0 {
+			continue
+		}
+		langs = append(langs, lang{locale: strings.ToLower(part), q: q})
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	locales := make([]string, len(langs))
+	for i, l := range langs {
+		locales[i] = l.locale
+	}
+	return locales
+}
@@ -0,0 +1,47 @@
+package erpc
+
+import (
+	"testing"
+	"time"
+)
+
+func i18n_fail(ctx CallCtx, arg *string) (string, *Status) {
+	return "", NewStatus(CodeUnauthorized, "token expired", "")
+}
+
+func TestLocalizeStatus(t *testing.T) {
+	RegisterStatusText(CodeUnauthorized, "zh", "未授权：{msg}")
+	RegisterStatusText(CodeUnauthorized, "fr-CA", "Non autorisé")
+	if locales := parseAcceptLanguage("en;q=0.5, zh-CN, *, fr;q=0"); len(locales) != 2 || locales[0] != "zh-cn" || locales[1] != "en" {
+		t.Fatalf("locales: %v", locales)
+	}
+	stat := NewStatus(CodeUnauthorized, "token expired", "")
+	if s := LocalizeStatus(stat, "fr-CA,zh;q=0.8"); s.Msg() != "Non autorisé" || s == stat {
+		t.Fatalf("stat: %v", s)
+	}
+	if s := LocalizeStatus(stat, "de, en"); s != stat {
+		t.Fatalf("stat: %v", s)
+	}
+
+	srv := NewPeer(PeerConfig{ListenPort: 9130})
+	defer srv.Close()
+	srv.RouteCallFunc(i18n_fail)
+	go srv.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := NewPeer(PeerConfig{})
+	defer cli.Close()
+	sess, stat := cli.Dial(":9130")
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var reply string
+	stat = sess.Call("/i18n/fail", "hello", &reply, WithAcceptLanguage("zh-CN,en;q=0.8")).Status()
+	if stat.Code() != CodeUnauthorized || stat.Msg() != "未授权：token expired" {
+		t.Fatalf("stat: %v", stat)
+	}
+	stat = sess.Call("/i18n/fail", "hello", &reply).Status()
+	if stat.Msg() != "token expired" {
+		t.Fatalf("stat: %v", stat)
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"net/http"
+	"sync"
+)
+
+// GRPCCode the canonical gRPC status code, the same as google.golang.org/grpc/codes.Code.
+type GRPCCode uint32
+
+// The canonical gRPC status codes.
+const (
+	GRPCOK                 GRPCCode = 0
+	GRPCCanceled           GRPCCode = 1
+	GRPCUnknown            GRPCCode = 2
+	GRPCInvalidArgument    GRPCCode = 3
+	GRPCDeadlineExceeded   GRPCCode = 4
+	GRPCNotFound           GRPCCode = 5
+	GRPCAlreadyExists      GRPCCode = 6
+	GRPCPermissionDenied   GRPCCode = 7
+	GRPCResourceExhausted  GRPCCode = 8
+	GRPCFailedPrecondition GRPCCode = 9
+	GRPCAborted            GRPCCode = 10
+	GRPCOutOfRange         GRPCCode = 11
+	GRPCUnimplemented      GRPCCode = 12
+	GRPCInternal           GRPCCode = 13
+	GRPCUnavailable        GRPCCode = 14
+	GRPCDataLoss           GRPCCode = 15
+	GRPCUnauthenticated    GRPCCode = 16
+)
+
+// statusHTTPCanceled the HTTP code of the canceled call, i.e. "Client Closed Request" of nginx.
+const statusHTTPCanceled = 499
+
+// codeMappings the mapping tables between the status codes and the HTTP/gRPC codes.
+var codeMappings = struct {
+	sync.RWMutex
+	toHTTP   map[int32]int
+	fromHTTP map[int]int32
+	toGRPC   map[int32]GRPCCode
+	fromGRPC map[GRPCCode]int32
+}{
+	toHTTP: map[int32]int{
+		CodeUnknownError:        http.StatusInternalServerError,
+		CodeOK:                  http.StatusOK,
+		CodeInvalidOp:           http.StatusBadRequest,
+		CodeWrongConn:           http.StatusBadGateway,
+		CodeConnClosed:          http.StatusServiceUnavailable,
+		CodeWriteFailed:         http.StatusBadGateway,
+		CodeDialFailed:          http.StatusServiceUnavailable,
+		CodeCallCanceled:        statusHTTPCanceled,
+		CodeAckTimeout:          http.StatusGatewayTimeout,
+		CodeSessionNotFound:     http.StatusNotFound,
+		CodeBadMessage:          http.StatusBadRequest,
+		CodeUnauthorized:        http.StatusUnauthorized,
+		CodeNotFound:            http.StatusNotFound,
+		CodeMtypeNotAllowed:     http.StatusMethodNotAllowed,
+		CodeHandleTimeout:       http.StatusGatewayTimeout,
+		CodeUnsupportedCodec:    http.StatusUnsupportedMediaType,
+		CodeDataCorrupted:       http.StatusUnprocessableEntity,
+		CodeMetaTooLarge:        http.StatusRequestHeaderFieldsTooLarge,
+		CodeInternalServerError: http.StatusInternalServerError,
+		CodeBadGateway:          http.StatusBadGateway,
+		CodeServiceUnavailable:  http.StatusServiceUnavailable,
+	},
+	fromHTTP: map[int]int32{
+		http.StatusOK:                          CodeOK,
+		http.StatusBadRequest:                  CodeBadMessage,
+		http.StatusUnauthorized:                CodeUnauthorized,
+		http.StatusForbidden:                   CodeUnauthorized,
+		http.StatusNotFound:                    CodeNotFound,
+		http.StatusMethodNotAllowed:            CodeMtypeNotAllowed,
+		http.StatusRequestTimeout:              CodeHandleTimeout,
+		http.StatusUnsupportedMediaType:        CodeUnsupportedCodec,
+		http.StatusUnprocessableEntity:         CodeDataCorrupted,
+		http.StatusRequestHeaderFieldsTooLarge: CodeMetaTooLarge,
+		http.StatusTooManyRequests:             CodeServiceUnavailable,
+		statusHTTPCanceled:                     CodeCallCanceled,
+		http.StatusInternalServerError:         CodeInternalServerError,
+		http.StatusNotImplemented:              CodeNotFound,
+		http.StatusBadGateway:                  CodeBadGateway,
+		http.StatusServiceUnavailable:          CodeServiceUnavailable,
+		http.StatusGatewayTimeout:              CodeHandleTimeout,
+	},
+	toGRPC: map[int32]GRPCCode{
+		CodeUnknownError:        GRPCUnknown,
+		CodeOK:                  GRPCOK,
+		CodeInvalidOp:           GRPCFailedPrecondition,
+		CodeWrongConn:           GRPCUnavailable,
+		CodeConnClosed:          GRPCUnavailable,
+		CodeWriteFailed:         GRPCUnavailable,
+		CodeDialFailed:          GRPCUnavailable,
+		CodeCallCanceled:        GRPCCanceled,
+		CodeAckTimeout:          GRPCDeadlineExceeded,
+		CodeSessionNotFound:     GRPCNotFound,
+		CodeBadMessage:          GRPCInvalidArgument,
+		CodeUnauthorized:        GRPCUnauthenticated,
+		CodeNotFound:            GRPCUnimplemented,
+		CodeMtypeNotAllowed:     GRPCUnimplemented,
+		CodeHandleTimeout:       GRPCDeadlineExceeded,
+		CodeUnsupportedCodec:    GRPCInvalidArgument,
+		CodeDataCorrupted:       GRPCDataLoss,
+		CodeMetaTooLarge:        GRPCResourceExhausted,
+		CodeInternalServerError: GRPCInternal,
+		CodeBadGateway:          GRPCUnavailable,
+		CodeServiceUnavailable:  GRPCUnavailable,
+	},
+	fromGRPC: map[GRPCCode]int32{
+		GRPCOK:                 CodeOK,
+		GRPCCanceled:           CodeCallCanceled,
+		GRPCUnknown:            CodeUnknownError,
+		GRPCInvalidArgument:    CodeBadMessage,
+		GRPCDeadlineExceeded:   CodeHandleTimeout,
+		GRPCNotFound:           CodeNotFound,
+		GRPCAlreadyExists:      CodeBadMessage,
+		GRPCPermissionDenied:   CodeUnauthorized,
+		GRPCResourceExhausted:  CodeServiceUnavailable,
+		GRPCFailedPrecondition: CodeBadMessage,
+		GRPCAborted:            CodeServiceUnavailable,
+		GRPCOutOfRange:         CodeBadMessage,
+		GRPCUnimplemented:      CodeNotFound,
+		GRPCInternal:           CodeInternalServerError,
+		GRPCUnavailable:        CodeServiceUnavailable,
+		GRPCDataLoss:           CodeDataCorrupted,
+		GRPCUnauthenticated:    CodeUnauthorized,
+	},
+}
+
+// RegisterHTTPCode registers the mapping between the custom status code and the HTTP code in both directions.
+// NOTE:
+//  It overrides the existing mappings of the codes.
+func RegisterHTTPCode(code int32, httpCode int) {
+	codeMappings.Lock()
+	codeMappings.toHTTP[code] = httpCode
+	codeMappings.fromHTTP[httpCode] = code
+	codeMappings.Unlock()
+}
+
+// RegisterGRPCCode registers the mapping between the custom status code and the gRPC code in both directions.
+// NOTE:
+//  It overrides the existing mappings of the codes.
+func RegisterGRPCCode(code int32, grpcCode GRPCCode) {
+	codeMappings.Lock()
+	codeMappings.toGRPC[code] = grpcCode
+	codeMappings.fromGRPC[grpcCode] = code
+	codeMappings.Unlock()
+}
+
+// CodeToHTTP returns the HTTP code of the status code.
+// NOTE:
+//  The unmapped code in [400,599] is returned as is, the others are 500.
+func CodeToHTTP(code int32) int {
+	codeMappings.RLock()
+	httpCode, ok := codeMappings.toHTTP[code]
+	codeMappings.RUnlock()
+	if ok {
+		return httpCode
+	}
+	if code >= 400 && code <= 599 {
+		return int(code)
+	}
+	return http.StatusInternalServerError
+}
+
+// CodeFromHTTP returns the status code of the HTTP code.
+// NOTE:
+//  The unmapped 2xx is CodeOK, 4xx is CodeBadMessage, 5xx is CodeInternalServerError, the others are CodeUnknownError.
+func CodeFromHTTP(httpCode int) int32 {
+	codeMappings.RLock()
+	code, ok := codeMappings.fromHTTP[httpCode]
+	codeMappings.RUnlock()
+	if ok {
+		return code
+	}
+	switch httpCode / 100 {
+	case 2:
+		return CodeOK
+	case 4:
+		return CodeBadMessage
+	case 5:
+		return CodeInternalServerError
+	default:
+		return CodeUnknownError
+	}
+}
+
+// CodeToGRPC returns the gRPC code of the status code, GRPCUnknown if unmapped.
+func CodeToGRPC(code int32) GRPCCode {
+	codeMappings.RLock()
+	grpcCode, ok := codeMappings.toGRPC[code]
+	codeMappings.RUnlock()
+	if ok {
+		return grpcCode
+	}
+	return GRPCUnknown
+}
+
+// CodeFromGRPC returns the status code of the gRPC code, CodeUnknownError if unmapped.
+func CodeFromGRPC(grpcCode GRPCCode) int32 {
+	codeMappings.RLock()
+	code, ok := codeMappings.fromGRPC[grpcCode]
+	codeMappings.RUnlock()
+	if ok {
+		return code
+	}
+	return CodeUnknownError
+}
+
+// StatusToHTTP returns the HTTP code of the status, 200 if the status is OK.
+func StatusToHTTP(stat *Status) int {
+	return CodeToHTTP(stat.Code())
+}
+
+// StatusToGRPC returns the gRPC code of the status, GRPCOK if the status is OK.
+func StatusToGRPC(stat *Status) GRPCCode {
+	return CodeToGRPC(stat.Code())
+}
+
+// StatusFromHTTP creates a status of the HTTP code, nil if the status is OK.
+// NOTE:
+//  If msg is empty, the msg comes from the CodeText value.
+func StatusFromHTTP(httpCode int, msg string) *Status {
+	return statusFromMapped(CodeFromHTTP(httpCode), msg)
+}
+
+// StatusFromGRPC creates a status of the gRPC code, nil if the status is OK.
+// NOTE:
+//  If msg is empty, the msg comes from the CodeText value.
+func StatusFromGRPC(grpcCode GRPCCode, msg string) *Status {
+	return statusFromMapped(CodeFromGRPC(grpcCode), msg)
+}
+
+func statusFromMapped(code int32, msg string) *Status {
+	if code == CodeOK {
+		return nil
+	}
+	if msg == "" {
+		msg = CodeText(code)
+	}
+	return NewStatus(code, msg)
+}
@@ -0,0 +1,39 @@
+package erpc
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCodeMapping(t *testing.T) {
+	if StatusToHTTP(nil) != http.StatusOK || StatusToGRPC(nil) != GRPCOK {
+		t.Fatal("ok status")
+	}
+	if StatusToHTTP(statNotFound) != http.StatusNotFound || StatusToGRPC(statNotFound) != GRPCUnimplemented {
+		t.Fatal("not found")
+	}
+	if CodeToHTTP(CodeCallCanceled) != 499 || CodeToGRPC(CodeConnClosed) != GRPCUnavailable {
+		t.Fatal("framework codes")
+	}
+	if CodeToHTTP(429) != 429 || CodeToHTTP(3002) != http.StatusInternalServerError || CodeToGRPC(3002) != GRPCUnknown {
+		t.Fatal("unmapped codes")
+	}
+	if CodeFromHTTP(http.StatusTeapot) != CodeBadMessage || CodeFromHTTP(http.StatusGatewayTimeout) != CodeHandleTimeout ||
+		CodeFromGRPC(GRPCDataLoss) != CodeDataCorrupted || CodeFromGRPC(99) != CodeUnknownError {
+		t.Fatal("reverse")
+	}
+	if StatusFromHTTP(http.StatusNoContent, "") != nil {
+		t.Fatal("ok reverse")
+	}
+	if stat := StatusFromGRPC(GRPCUnavailable, ""); stat.Code() != CodeServiceUnavailable || stat.Msg() != "Service Unavailable" {
+		t.Fatalf("stat: %v", stat)
+	}
+
+	// custom mappings
+	RegisterHTTPCode(3001, http.StatusConflict)
+	RegisterGRPCCode(3001, GRPCAlreadyExists)
+	if CodeToHTTP(3001) != http.StatusConflict || CodeFromHTTP(http.StatusConflict) != 3001 ||
+		CodeToGRPC(3001) != GRPCAlreadyExists || StatusFromGRPC(GRPCAlreadyExists, "exists").Code() != 3001 {
+		t.Fatal("custom mappings")
+	}
+}
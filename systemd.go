@@ -0,0 +1,74 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// systemdListenFdsStart the first file descriptor passed by systemd
+const systemdListenFdsStart = 3
+
+// SystemdListeners returns the listeners passed by the systemd socket activation,
+// in the order of the sockets in the unit file, and the names set by FileDescriptorName.
+// NOTE:
+//  It returns nil if the process is not activated by systemd, i.e. LISTEN_PID is not the current process;
+//  The LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES environment variables are unset,
+//  so that the child processes do not inherit them;
+//  Serve the listeners by Peer.ServeListener.
+func SystemdListeners() (listeners []net.Listener, names []string, err error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil, fmt.Errorf("invalid LISTEN_FDS: %q", os.Getenv("LISTEN_FDS"))
+	}
+	names = strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	if len(names) != n {
+		names = make([]string, n)
+	}
+	listeners = make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		fd := uintptr(systemdListenFdsStart + i)
+		name := names[i]
+		if name == "" {
+			name = "LISTEN_FD_" + strconv.Itoa(int(fd))
+			names[i] = name
+		}
+		f := os.NewFile(fd, name)
+		lis, err := net.FileListener(f)
+		// the listener holds a dup of the file descriptor
+		f.Close()
+		if err != nil {
+			for _, lis := range listeners {
+				lis.Close()
+			}
+			return nil, nil, fmt.Errorf("systemd socket %s: %v", name, err)
+		}
+		listeners = append(listeners, lis)
+	}
+	return listeners, names, nil
+}
@@ -0,0 +1,275 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andeya/erpc/v7/utils"
+)
+
+// TapDirection the direction of the tapped messages.
+type TapDirection uint8
+
+// The directions of the tapped messages.
+const (
+	TapInbound TapDirection = 1 << iota
+	TapOutbound
+	TapBoth = TapInbound | TapOutbound
+)
+
+// String returns the direction text.
+func (d TapDirection) String() string {
+	switch d {
+	case TapInbound:
+		return "in"
+	case TapOutbound:
+		return "out"
+	case TapBoth:
+		return "both"
+	}
+	return "unknown"
+}
+
+// tapBufferSize the default buffer size of the channel returned by Tap
+const tapBufferSize = 256
+
+// TapFilter the filter of the messages copied by Peer.Tap.
+// NOTE: The zero value matches all the messages.
+type TapFilter struct {
+	// ServiceMethods the service methods of the messages, or the prefixes ending with "*", e.g. "/user/*"
+	// NOTE: The replies have no service method on the wire, so they never match it
+	ServiceMethods []string
+	// SessionIDs the ids of the sessions of the messages
+	SessionIDs []string
+	// Direction the direction of the messages, 0 means TapBoth
+	Direction TapDirection
+	// Mtypes the types of the messages, e.g. TypeCall
+	Mtypes []byte
+	// SampleRate the ratio of the matched messages copied, in (0,1], 0 means 1
+	SampleRate float64
+	// Redact modifies the copy before it is sent to the channel, e.g. removes the sensitive metadata or body,
+	// and the copy is dropped if it returns false
+	Redact func(*MessageCopy) bool
+	// BufferSize the buffer size of the channel, default is 256
+	BufferSize int
+}
+
+// MessageCopy the copy of a message tapped by Peer.Tap.
+type MessageCopy struct {
+	Time          time.Time
+	Direction     TapDirection
+	SessionID     string
+	LocalAddr     string
+	RemoteAddr    string
+	Mtype         byte
+	Seq           int32
+	ServiceMethod string
+	Status        *Status
+	Meta          *utils.Args
+	BodyCodec     byte
+	XferPipe      []byte
+	// Body the encoded body, nil if it fails to encode
+	Body []byte
+	// Size the size of the message on the wire, 0 for the datagrams
+	Size uint32
+}
+
+// tapHub the taps of a peer.
+type tapHub struct {
+	mu    sync.RWMutex
+	taps  []*tap
+	count int32
+}
+
+type tap struct {
+	mu      sync.RWMutex
+	filter  TapFilter
+	ch      chan MessageCopy
+	matched uint64
+	closed  bool
+}
+
+// Tap streams the copies of the messages matching the filter written and read by the sessions of the peer,
+// like tcpdump at the RPC layer, until cancel is called, which closes the channel.
+// NOTE:
+//  The copy is dropped when the channel buffer is full, i.e. the consumer never blocks the sessions;
+//  The copies of the inbound and the outbound messages are made after they are read and written successfully.
+func (p *peer) Tap(filter TapFilter) (copies <-chan MessageCopy, cancel func()) {
+	if filter.Direction == 0 {
+		filter.Direction = TapBoth
+	}
+	if filter.SampleRate <= 0 || filter.SampleRate > 1 {
+		filter.SampleRate = 1
+	}
+	if filter.BufferSize <= 0 {
+		filter.BufferSize = tapBufferSize
+	}
+	t := &tap{filter: filter, ch: make(chan MessageCopy, filter.BufferSize)}
+	h := &p.taps
+	h.mu.Lock()
+	h.taps = append(h.taps, t)
+	atomic.StoreInt32(&h.count, int32(len(h.taps)))
+	h.mu.Unlock()
+	var once sync.Once
+	return t.ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			for i, x := range h.taps {
+				if x == t {
+					h.taps = append(h.taps[:i:i], h.taps[i+1:]...)
+					break
+				}
+			}
+			atomic.StoreInt32(&h.count, int32(len(h.taps)))
+			h.mu.Unlock()
+			t.mu.Lock()
+			t.closed = true
+			close(t.ch)
+			t.mu.Unlock()
+		})
+	}
+}
+
+// capture copies the message to the matching taps.
+func (h *tapHub) capture(s *session, m Message, dir TapDirection) {
+	if atomic.LoadInt32(&h.count) == 0 {
+		return
+	}
+	h.mu.RLock()
+	taps := h.taps
+	h.mu.RUnlock()
+	var c *MessageCopy
+	for _, t := range taps {
+		if !t.match(s, m, dir) {
+			continue
+		}
+		if c == nil {
+			c = newMessageCopy(s, m, dir)
+		}
+		t.send(*c)
+	}
+}
+
+func (t *tap) match(s *session, m Message, dir TapDirection) bool {
+	f := &t.filter
+	if f.Direction&dir == 0 {
+		return false
+	}
+	if len(f.Mtypes) > 0 && !containsByte(f.Mtypes, m.Mtype()) {
+		return false
+	}
+	if len(f.ServiceMethods) > 0 && !matchServiceMethod(f.ServiceMethods, m.ServiceMethod()) {
+		return false
+	}
+	if len(f.SessionIDs) > 0 && !containsString(f.SessionIDs, s.ID()) {
+		return false
+	}
+	if f.SampleRate < 1 {
+		// the deterministic sampling, e.g. every 4th message of 0.25
+		n := atomic.AddUint64(&t.matched, 1)
+		if uint64(float64(n)*f.SampleRate) == uint64(float64(n-1)*f.SampleRate) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *tap) send(c MessageCopy) {
+	if t.filter.Redact != nil {
+		// each tap redacts its own copy
+		c.Meta = copyArgs(c.Meta)
+		c.Body = append([]byte(nil), c.Body...)
+		if !t.filter.Redact(&c) {
+			return
+		}
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.ch <- c:
+	default:
+	}
+}
+
+func newMessageCopy(s *session, m Message, dir TapDirection) *MessageCopy {
+	body, err := m.MarshalBody()
+	if err != nil {
+		body = nil
+	} else {
+		body = append([]byte(nil), body...)
+	}
+	return &MessageCopy{
+		Time:          time.Now(),
+		Direction:     dir,
+		SessionID:     s.ID(),
+		LocalAddr:     s.LocalAddr().String(),
+		RemoteAddr:    s.RemoteAddr().String(),
+		Mtype:         m.Mtype(),
+		Seq:           m.Seq(),
+		ServiceMethod: m.ServiceMethod(),
+		Status:        m.Status().Copy(nil),
+		Meta:          copyArgs(m.Meta()),
+		BodyCodec:     m.BodyCodec(),
+		XferPipe:      m.XferPipe().IDs(),
+		Body:          body,
+		Size:          m.Size(),
+	}
+}
+
+func copyArgs(a *utils.Args) *utils.Args {
+	dst := new(utils.Args)
+	if a != nil {
+		a.CopyTo(dst)
+	}
+	return dst
+}
+
+func matchServiceMethod(patterns []string, serviceMethod string) bool {
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(serviceMethod, p[:len(p)-1]) {
+				return true
+			}
+		} else if p == serviceMethod {
+			return true
+		}
+	}
+	return false
+}
+
+func containsByte(a []byte, b byte) bool {
+	for _, x := range a {
+		if x == b {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
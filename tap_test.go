@@ -0,0 +1,96 @@
+package erpc
+
+import (
+	"testing"
+	"time"
+)
+
+func tap_echo(ctx CallCtx, arg *string) (string, *Status) {
+	return *arg, nil
+}
+
+func tap_other(ctx CallCtx, arg *string) (string, *Status) {
+	return *arg, nil
+}
+
+func recvTap(t *testing.T, ch <-chan MessageCopy) MessageCopy {
+	t.Helper()
+	select {
+	case c := <-ch:
+		return c
+	case <-time.After(time.Second):
+		t.Fatal("expect a message copy")
+	}
+	return MessageCopy{}
+}
+
+func TestTap(t *testing.T) {
+	srv := NewPeer(PeerConfig{})
+	defer srv.Close()
+	srv.RouteCallFunc(tap_echo)
+	srv.RouteCallFunc(tap_other)
+	cli := NewPeer(PeerConfig{})
+	defer cli.Close()
+
+	in, cancelIn := srv.Tap(TapFilter{ServiceMethods: []string{"/tap/echo"}, Direction: TapInbound})
+	out, cancelOut := srv.Tap(TapFilter{
+		Mtypes:    []byte{TypeReply},
+		Direction: TapOutbound,
+		Redact: func(c *MessageCopy) bool {
+			c.Meta.Del("token")
+			return string(c.Body) != `"world"`
+		},
+	})
+	defer cancelOut()
+	sampled, cancelSampled := cli.Tap(TapFilter{Mtypes: []byte{TypeCall}, SampleRate: 0.5})
+	defer cancelSampled()
+
+	sess, stat := ConnectPipe(srv, cli)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var reply string
+	for i := 0; i < 4; i++ {
+		if stat = sess.Call("/tap/echo", "hello", &reply, WithSetMeta("token", "secret")).Status(); !stat.OK() {
+			t.Fatal(stat)
+		}
+		if stat = sess.Call("/tap/other", "world", &reply).Status(); !stat.OK() {
+			t.Fatal(stat)
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		c := recvTap(t, in)
+		if c.Direction != TapInbound || c.Mtype != TypeCall || c.ServiceMethod != "/tap/echo" ||
+			string(c.Body) != `"hello"` || string(c.Meta.Peek("token")) != "secret" || c.Size == 0 {
+			t.Fatalf("inbound copy: %+v", c)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		c := recvTap(t, out)
+		if c.Direction != TapOutbound || c.Mtype != TypeReply || string(c.Body) != `"hello"` || c.Meta.Has("token") {
+			t.Fatalf("outbound copy: %+v", c)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		if c := recvTap(t, sampled); c.Direction != TapOutbound || c.Mtype != TypeCall {
+			t.Fatalf("sampled copy: %+v", c)
+		}
+	}
+	select {
+	case c := <-out:
+		t.Fatalf("expect the redacted copy dropped, got %+v", c)
+	case c := <-sampled:
+		t.Fatalf("expect the half of the calls sampled, got %+v", c)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancelIn()
+	cancelIn()
+	if _, ok := <-in; ok {
+		t.Fatal("expect the channel closed by cancel")
+	}
+	if stat = sess.Call("/tap/echo", "hello", &reply).Status(); !stat.OK() {
+		t.Fatal(stat)
+	}
+}
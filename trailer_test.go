@@ -0,0 +1,59 @@
+package erpc_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/andeya/erpc/v7"
+)
+
+type trailerPlugin struct{}
+
+func (trailerPlugin) Name() string { return "trailer" }
+
+func (trailerPlugin) PreWriteReply(ctx erpc.WriteCtx) *erpc.Status {
+	if body, ok := ctx.Output().Body().(string); ok {
+		ctx.Output().Trailer().Set("size", strconv.Itoa(len(body)))
+	}
+	return nil
+}
+
+func TestTrailer(t *testing.T) {
+	srv := erpc.NewPeer(erpc.PeerConfig{}, trailerPlugin{})
+	defer srv.Close()
+	srv.RouteCallFunc(func(ctx erpc.CallCtx, arg *string) (string, *erpc.Status) {
+		ctx.SetTrailer("cursor", "next")
+		return *arg, nil
+	})
+	plain := srv.RouteCallFunc(func(ctx erpc.CallCtx, arg *int) (int, *erpc.Status) {
+		return *arg, nil
+	})
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+	sess, stat := erpc.ConnectPipe(srv, cli)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var reply string
+	cmd := sess.Call("/func1", "hello", &reply)
+	if stat = cmd.Status(); !stat.OK() || reply != "hello" {
+		t.Fatalf("reply: %q, stat: %v", reply, stat)
+	}
+	trailer := cmd.TrailerMeta()
+	if cursor, size := string(trailer.Peek("cursor")), string(trailer.Peek("size")); cursor != "next" || size != "5" {
+		t.Fatalf("cursor: %q, size: %q", cursor, size)
+	}
+	if len(cmd.InputMeta().Peek("cursor")) != 0 {
+		t.Fatal("expect the trailer not in the metadata")
+	}
+
+	// the replies without the trailers share the empty value
+	var n int
+	cmd1, cmd2 := sess.Call(plain, 1, &n), sess.Call(plain, 2, &n)
+	if !cmd1.Status().OK() || !cmd2.Status().OK() {
+		t.Fatal(cmd1.Status(), cmd2.Status())
+	}
+	if trailer := cmd1.TrailerMeta(); trailer.Len() != 0 || trailer != cmd2.TrailerMeta() {
+		t.Fatalf("trailer: %v", trailer)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erpc
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/andeya/erpc/v7/socket"
+	"github.com/andeya/erpc/v7/utils"
+	"github.com/andeya/goutil"
+)
+
+// MetaTTL the key of the time to live of the CALL or PUSH in milliseconds, see WithTTL
+const MetaTTL = "X-TTL"
+
+// statExpired the status of the CALL expired before the handler, see WithTTL
+var statExpired = NewStatus(CodeHandleTimeout, "Message Expired", "")
+
+// WithTTL sets the time to live of the CALL or PUSH,
+// the receiver drops the PUSH or fails the CALL with the expired status without executing the handler,
+// if it has waited longer than the TTL since received, e.g. in the handler queues during the overload.
+// NOTE:
+//  The TTL is counted from the receiving by the clock of the receiver, i.e. not including the network transit,
+//  so the clocks of the peers need not be synchronized;
+//  The precision is millisecond, and ttl<=0 deletes it;
+//  The expired messages are counted by Stats.Expired.
+func WithTTL(ttl time.Duration) MessageSetting {
+	if ttl <= 0 {
+		return socket.WithDelMeta(MetaTTL)
+	}
+	ms := int64(ttl / time.Millisecond)
+	if ms == 0 {
+		ms = 1
+	}
+	return socket.WithSetMeta(MetaTTL, strconv.FormatInt(ms, 10))
+}
+
+// GetTTL gets the time to live of the message from metadata.
+// If not set or invalid, returns 0.
+func GetTTL(meta *utils.Args) time.Duration {
+	s := meta.Peek(MetaTTL)
+	if len(s) == 0 {
+		return 0
+	}
+	ms, err := strconv.ParseInt(goutil.BytesToString(s), 10, 64)
+	if err != nil || ms <= 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// bindTTL records the expiry of the received CALL or PUSH by the peer clock.
+func (c *handlerCtx) bindTTL(header Header) {
+	if ttl := GetTTL(header.Meta()); ttl > 0 {
+		c.expireAt = c.sess.peer.clock.Now().Add(ttl).UnixNano()
+	}
+}
+
+// checkExpired returns the expired status if the message has waited longer than its TTL before the handler.
+func (c *handlerCtx) checkExpired() *Status {
+	if c.expireAt == 0 {
+		return nil
+	}
+	late := c.sess.peer.clock.Now().UnixNano() - c.expireAt
+	if late <= 0 {
+		return nil
+	}
+	c.sess.stats.add(cntExpired, 1)
+	return statExpired.Copy(fmt.Sprintf("%s expired %v ago, TTL %v",
+		c.input.ServiceMethod(), time.Duration(late), GetTTL(c.input.Meta())))
+}
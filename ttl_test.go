@@ -0,0 +1,78 @@
+package erpc_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/erpctest"
+)
+
+func TestTTL(t *testing.T) {
+	clock := erpctest.NewClock(time.Now())
+	srv, cli, sess := erpc.NewPipePeerPair(erpc.PeerConfig{HandlerWorkers: 1, Clock: clock}, erpc.PeerConfig{})
+	defer srv.Close()
+	defer cli.Close()
+	started, release := make(chan struct{}), make(chan struct{})
+	srv.RouteCallFunc(func(ctx erpc.CallCtx, arg *string) (string, *erpc.Status) {
+		if *arg == "block" {
+			close(started)
+			<-release
+		}
+		return *arg, nil
+	})
+	var pushed int32
+	srv.RoutePushFunc(func(ctx erpc.PushCtx, arg *string) *erpc.Status {
+		atomic.AddInt32(&pushed, 1)
+		return nil
+	})
+
+	var reply string
+	blocked := sess.AsyncCall("/func1", "block", &reply, make(chan erpc.CallCmd, 1))
+	<-started
+	expired := sess.AsyncCall("/func1", "expired", new(string), make(chan erpc.CallCmd, 1), erpc.WithTTL(time.Second))
+	alive := sess.AsyncCall("/func1", "alive", new(string), make(chan erpc.CallCmd, 1), erpc.WithTTL(time.Minute))
+	if stat := sess.Push("/func2", "expired", erpc.WithTTL(time.Second)); !stat.OK() {
+		t.Fatal(stat)
+	}
+	for i := 0; srv.Stats().HandlerQueue < 3; i++ {
+		if i > 100 {
+			t.Fatalf("expect the messages queued, got %d", srv.Stats().HandlerQueue)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	clock.Advance(2 * time.Second)
+	close(release)
+
+	if _, stat := blocked.Reply(); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if _, stat := expired.Reply(); stat.Code() != erpc.CodeHandleTimeout || stat.Msg() != "Message Expired" {
+		t.Fatalf("expect the expired status, got %v", stat)
+	}
+	if _, stat := alive.Reply(); !stat.OK() {
+		t.Fatal(stat)
+	}
+	for i := 0; srv.Stats().Expired < 2; i++ {
+		if i > 100 {
+			t.Fatalf("expect 2 expired, got %d", srv.Stats().Expired)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&pushed); n != 0 {
+		t.Fatalf("expect the expired push dropped, got %d", n)
+	}
+}
+
+func TestGetTTL(t *testing.T) {
+	m := erpc.GetMessage(erpc.WithTTL(1500 * time.Microsecond))
+	defer erpc.PutMessage(m)
+	if ttl := erpc.GetTTL(m.Meta()); ttl != time.Millisecond {
+		t.Fatalf("ttl: %v", ttl)
+	}
+	erpc.WithTTL(0)(m)
+	if ttl := erpc.GetTTL(m.Meta()); ttl != 0 {
+		t.Fatalf("ttl: %v", ttl)
+	}
+}
@@ -0,0 +1,76 @@
+// Package crc32c provides a CRC-32C (Castagnoli) integrity check transfer filter,
+// to detect the corruption of the messages traversing the middleboxes that terminate TLS.
+//
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crc32c
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/andeya/erpc/v7/xfer"
+)
+
+// Reg registers a crc32c checker filter for transfer.
+func Reg(id byte, name string) {
+	xfer.Reg(&crc32cHash{
+		id:   id,
+		name: name,
+	})
+}
+
+// crc32cHash integrity check filter
+type crc32cHash struct {
+	id   byte
+	name string
+}
+
+const crc32cLength = 4
+
+var (
+	table         = crc32.MakeTable(crc32.Castagnoli)
+	errDataCheck  = fmt.Errorf("crc32c: %w", xfer.ErrChecksumMismatch)
+	errDataLength = fmt.Errorf("crc32c: %w, the data is shorter than the checksum", xfer.ErrChecksumMismatch)
+)
+
+// ID returns transfer filter id.
+func (c *crc32cHash) ID() byte {
+	return c.id
+}
+
+// Name returns transfer filter name.
+func (c *crc32cHash) Name() string {
+	return c.name
+}
+
+// OnPack appends the checksum in big endian.
+func (c *crc32cHash) OnPack(src []byte) ([]byte, error) {
+	var sum [crc32cLength]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.Checksum(src, table))
+	return append(src, sum[:]...), nil
+}
+
+// OnUnpack verifies and removes the checksum.
+func (c *crc32cHash) OnUnpack(src []byte) ([]byte, error) {
+	n := len(src) - crc32cLength
+	if n < 0 {
+		return nil, errDataLength
+	}
+	if crc32.Checksum(src[:n], table) != binary.BigEndian.Uint32(src[n:]) {
+		return nil, errDataCheck
+	}
+	return src[:n], nil
+}
@@ -0,0 +1,98 @@
+package crc32c_test
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/xfer"
+	"github.com/andeya/erpc/v7/xfer/crc32c"
+)
+
+func TestSeparate(t *testing.T) {
+	crc32c.Reg('c', "crc32c")
+	f, _ := xfer.Get('c')
+	b, err := f.OnPack([]byte("crc32c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := f.OnUnpack(b); err != nil || string(data) != "crc32c" {
+		t.Fatalf("data: %s, err: %v", data, err)
+	}
+	// tamper with data
+	b[0] ^= 1
+	if _, err = f.OnUnpack(b); !errors.Is(err, xfer.ErrChecksumMismatch) {
+		t.Fatalf("expect ErrChecksumMismatch, got %v", err)
+	}
+	if _, err = f.OnUnpack(b[:2]); !errors.Is(err, xfer.ErrChecksumMismatch) {
+		t.Fatalf("expect ErrChecksumMismatch, got %v", err)
+	}
+}
+
+// corruptConn flips the last byte read once armed, like a faulty middlebox.
+type corruptConn struct {
+	net.Conn
+	armed int32
+}
+
+func (c *corruptConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 && atomic.CompareAndSwapInt32(&c.armed, 1, 0) {
+		b[n-1] ^= 1
+	}
+	return n, err
+}
+
+type home struct {
+	erpc.CallCtx
+}
+
+func (h *home) Echo(arg *string) (string, *erpc.Status) {
+	return *arg, nil
+}
+
+func TestCombined(t *testing.T) {
+	crc32c.Reg('k', "crc32c-combined")
+	srv := erpc.NewPeer(erpc.PeerConfig{})
+	defer srv.Close()
+	srv.RouteCall(new(home))
+	cli := erpc.NewPeer(erpc.PeerConfig{})
+	defer cli.Close()
+
+	c1, c2 := net.Pipe()
+	conn := &corruptConn{Conn: c1}
+	srvSess, stat := srv.ServeConn(conn)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	sess, stat := cli.ServeConn(c2)
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	var result string
+	if stat = sess.Call("/home/echo", "ok", &result, erpc.WithXferPipe('k')).Status(); !stat.OK() || result != "ok" {
+		t.Fatal(stat, result)
+	}
+
+	// the corrupted message is detected, and the session is closed
+	atomic.StoreInt32(&conn.armed, 1)
+	callCmd := sess.AsyncCall("/home/echo", "corrupted", &result, nil, erpc.WithXferPipe('k'))
+	select {
+	case <-callCmd.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("the corrupted call is not done")
+	}
+	if callCmd.Status().OK() {
+		t.Fatal("expect the corrupted call failed")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if st := srvSess.Stats(); st.Corruptions != 1 || st.Errors < 1 {
+		t.Fatalf("stats: %+v", st)
+	}
+	if st := srv.Stats(); st.Corruptions != 1 {
+		t.Fatalf("peer stats: %+v", st)
+	}
+}
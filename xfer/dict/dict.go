@@ -0,0 +1,150 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dict is the DEFLATE compression filter with a preset dictionary trained from the samples,
+// so the small repetitive bodies, e.g. JSON, compress far better than by the generic gzip.
+package dict
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/andeya/erpc/v7/utils"
+	"github.com/andeya/erpc/v7/xfer"
+)
+
+// MaxDictSize the max effective size of the dictionary, i.e. the DEFLATE window size
+const MaxDictSize = 32 * 1024
+
+var ids []byte // in the order of registration
+
+var (
+	unpackSizeLimit int64 = 1 << 30 // 1GB
+	// ErrExceedUnpackSizeLimit error
+	ErrExceedUnpackSizeLimit = errors.New("dict: size of unpacked data exceeds limit")
+)
+
+// SetUnpackSizeLimit sets the max size of the unpacked data, against the decompression bomb.
+// If maxSize<=0, set it to 1GB.
+func SetUnpackSizeLimit(maxSize int64) {
+	if maxSize <= 0 {
+		unpackSizeLimit = 1 << 30
+	} else {
+		unpackSizeLimit = maxSize
+	}
+}
+
+// Reg registers a dictionary compression filter for transfer, the id identifies the dictionary.
+// NOTE:
+//  The peers must register the same dictionary by the same id;
+//  Only the last 32KB of the dictionary is effective.
+func Reg(id byte, name string, dict []byte, level int) {
+	xfer.Reg(newDict(id, name, dict, level))
+	ids = append(ids, id)
+}
+
+// Is determines if the id is a dictionary compression filter.
+func Is(id byte) bool {
+	return bytes.IndexByte(ids, id) >= 0
+}
+
+// IDs returns the ids of the dictionary compression filters, in the order of registration.
+func IDs() []byte {
+	return append([]byte{}, ids...)
+}
+
+// newDict creates a new dictionary compression filter.
+func newDict(id byte, name string, dict []byte, level int) *Dict {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		panic(fmt.Sprintf("dict: invalid compression level: %d", level))
+	}
+	if len(dict) > MaxDictSize {
+		dict = dict[len(dict)-MaxDictSize:]
+	}
+	d := new(Dict)
+	d.id = id
+	d.name = name
+	d.level = level
+	d.dict = append([]byte{}, dict...)
+	d.wPool = sync.Pool{
+		New: func() interface{} {
+			fw, _ := flate.NewWriterDict(nil, d.level, d.dict)
+			return fw
+		},
+	}
+	d.rPool = sync.Pool{
+		New: func() interface{} {
+			return flate.NewReaderDict(nil, d.dict)
+		},
+	}
+	return d
+}
+
+// Dict dictionary compression filter
+type Dict struct {
+	id    byte
+	name  string
+	level int
+	dict  []byte
+	wPool sync.Pool
+	rPool sync.Pool
+}
+
+// ID returns transfer filter id.
+func (d *Dict) ID() byte {
+	return d.id
+}
+
+// Name returns transfer filter name.
+func (d *Dict) Name() string {
+	return d.name
+}
+
+// OnPack performs filtering on packing.
+func (d *Dict) OnPack(src []byte) ([]byte, error) {
+	bb := utils.AcquireByteBuffer()
+	fw := d.wPool.Get().(*flate.Writer)
+	fw.Reset(bb)
+	fw.Write(src)
+	err := fw.Close()
+	d.wPool.Put(fw)
+	if err != nil {
+		utils.ReleaseByteBuffer(bb)
+		return nil, err
+	}
+	return bb.Bytes(), nil
+}
+
+// OnUnpack performs filtering on unpacking.
+func (d *Dict) OnUnpack(src []byte) (dest []byte, err error) {
+	if len(src) == 0 {
+		return src, nil
+	}
+	fr := d.rPool.Get().(io.ReadCloser)
+	err = fr.(flate.Resetter).Reset(bytes.NewReader(src), d.dict)
+	if err == nil {
+		dest, err = ioutil.ReadAll(io.LimitReader(fr, unpackSizeLimit+1))
+		if err == nil && int64(len(dest)) > unpackSizeLimit {
+			dest, err = nil, ErrExceedUnpackSizeLimit
+		}
+	}
+	fr.Close()
+	d.rPool.Put(fr)
+	return dest, err
+}
@@ -0,0 +1,68 @@
+package dict
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"testing"
+)
+
+func jsonSamples(n int) [][]byte {
+	samples := make([][]byte, n)
+	for i := range samples {
+		samples[i] = []byte(fmt.Sprintf(`{"user_id":%d,"user_name":"user-%d","status":"active","roles":["reader","writer"],"created_at":"2024-01-%02dT10:00:00Z"}`, i, i*7, i%28+1))
+	}
+	return samples
+}
+
+func TestDict(t *testing.T) {
+	samples := jsonSamples(200)
+	d := Train(samples[:100], 4096)
+	if len(d) == 0 || len(d) > 4096 {
+		t.Fatalf("dict size: %d", len(d))
+	}
+	Reg('d', "dict-test", d, 9)
+	if !Is('d') || !bytes.Equal(IDs(), []byte{'d'}) {
+		t.Fatalf("ids: %v", IDs())
+	}
+	f := newDict('d', "dict-test", d, 9)
+	var dictSize, gzipSize int
+	for _, sample := range samples[100:] {
+		packed, err := f.OnPack(sample)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dictSize += len(packed)
+		unpacked, err := f.OnUnpack(packed)
+		if err != nil || !bytes.Equal(unpacked, sample) {
+			t.Fatalf("unpacked: %s, err: %v", unpacked, err)
+		}
+		var buf bytes.Buffer
+		gw, _ := gzip.NewWriterLevel(&buf, 9)
+		gw.Write(sample)
+		gw.Close()
+		gzipSize += buf.Len()
+	}
+	if dictSize*2 > gzipSize {
+		t.Fatalf("dict: %d bytes, gzip: %d bytes, expect the dict less than half", dictSize, gzipSize)
+	}
+}
+
+func TestTrainNothingShared(t *testing.T) {
+	if d := Train([][]byte{[]byte("abcdefghijk"), []byte("0123456789")}, 0); d != nil {
+		t.Fatalf("dict: %q", d)
+	}
+}
+
+func TestUnpackSizeLimit(t *testing.T) {
+	defer SetUnpackSizeLimit(0)
+	f := newDict('l', "dict-limit", []byte("0123456789"), 9)
+	packed, err := f.OnPack(make([]byte, 1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetUnpackSizeLimit(100)
+	if _, err = f.OnUnpack(packed); err != ErrExceedUnpackSizeLimit {
+		t.Fatalf("expect ErrExceedUnpackSizeLimit, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command dicttrain trains a compression dictionary from the capture files,
+// i.e. the streams of the frames of the length-prefixed protocols, or the raw sample files.
+//
+// Usage:
+//  dicttrain [-proto raw|json|pb] [-raw] [-size 16384] [-o dict.bin] file...
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/andeya/erpc/v7"
+	"github.com/andeya/erpc/v7/proto"
+	"github.com/andeya/erpc/v7/proto/jsonproto"
+	"github.com/andeya/erpc/v7/proto/pbproto"
+	"github.com/andeya/erpc/v7/xfer/dict"
+)
+
+var (
+	protoName = flag.String("proto", "raw", "protocol of the frames in the capture files: raw, json or pb")
+	rawFiles  = flag.Bool("raw", false, "take each file as one sample, instead of the frames")
+	size      = flag.Int("size", 16*1024, "max size of the dictionary, at most 32KB")
+	output    = flag.String("o", "dict.bin", "output file of the dictionary")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: dicttrain [flags] file...")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	var samples [][]byte
+	for _, name := range flag.Args() {
+		s, err := readSamples(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "read %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		samples = append(samples, s...)
+	}
+	d := dict.Train(samples, *size)
+	if len(d) == 0 {
+		fmt.Fprintln(os.Stderr, "the samples share nothing, no dictionary is trained")
+		os.Exit(1)
+	}
+	if err := ioutil.WriteFile(*output, d, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "write %s: %v\n", *output, err)
+		os.Exit(1)
+	}
+	fmt.Printf("trained %d bytes from %d samples into %s\n", len(d), len(samples), *output)
+}
+
+func readSamples(name string) ([][]byte, error) {
+	if *rawFiles {
+		b, err := ioutil.ReadFile(name)
+		return [][]byte{b}, err
+	}
+	var protoFunc erpc.ProtoFunc
+	switch *protoName {
+	case "raw":
+		protoFunc = erpc.DefaultProtoFunc()
+	case "json":
+		protoFunc = jsonproto.NewJSONProtoFunc()
+	case "pb":
+		protoFunc = pbproto.NewPbProtoFunc()
+	default:
+		return nil, errors.New("unsupported protocol: " + *protoName)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var samples [][]byte
+	for {
+		m, err := proto.Decode(f, proto.Limits{}, protoFunc)
+		if err == io.EOF {
+			return samples, nil
+		}
+		if err != nil {
+			return samples, err
+		}
+		if body := *m.Body().(*[]byte); len(body) > 0 {
+			samples = append(samples, append([]byte{}, body...))
+		}
+		erpc.PutMessage(m)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dict
+
+import (
+	"container/heap"
+)
+
+const (
+	kmerLen    = 8  // the length of the substring counted
+	segmentLen = 48 // the length of the segment picked into the dictionary
+	segmentGap = 4  // the gap of the candidate segments in a sample
+)
+
+// Train builds a dictionary of at most size bytes from the samples, e.g. the bodies read from the capture files,
+// by picking the segments covering the most substrings shared by the samples.
+// NOTE:
+//  If size<=0 or size>32KB, use 32KB;
+//  The more valuable segment is placed nearer the end, where DEFLATE finds it by the shorter distance;
+//  It returns nil if the samples share nothing.
+func Train(samples [][]byte, size int) []byte {
+	if size <= 0 || size > MaxDictSize {
+		size = MaxDictSize
+	}
+	// the number of the samples containing each substring
+	weights := make(map[string]int)
+	seen := make(map[string]int)
+	for i, sample := range samples {
+		for j := 0; j+kmerLen <= len(sample); j++ {
+			k := string(sample[j : j+kmerLen])
+			if seen[k] != i+1 {
+				seen[k] = i + 1
+				weights[k]++
+			}
+		}
+	}
+	for k, w := range weights {
+		if w < 2 {
+			delete(weights, k)
+		}
+	}
+	if len(weights) == 0 {
+		return nil
+	}
+
+	var h segmentHeap
+	for i, sample := range samples {
+		for j := 0; j < len(sample); j += segmentGap {
+			seg := segment{sample: i, start: j, end: j + segmentLen}
+			if seg.end > len(sample) {
+				seg.end = len(sample)
+			}
+			if seg.score = seg.scoreBy(samples, weights); seg.score > 0 {
+				h = append(h, seg)
+			}
+		}
+	}
+	heap.Init(&h)
+
+	// lazy greedy: the score only decreases as the substrings are covered
+	var picked []segment
+	var total int
+	for h.Len() > 0 && total < size {
+		seg := heap.Pop(&h).(segment)
+		score := seg.scoreBy(samples, weights)
+		if score <= 0 {
+			continue
+		}
+		if score < seg.score && h.Len() > 0 && score < h[0].score {
+			seg.score = score
+			heap.Push(&h, seg)
+			continue
+		}
+		b := samples[seg.sample][seg.start:seg.end]
+		for j := 0; j+kmerLen <= len(b); j++ {
+			delete(weights, string(b[j:j+kmerLen]))
+		}
+		picked = append(picked, seg)
+		total += len(b)
+	}
+
+	dict := make([]byte, 0, total)
+	for i := len(picked) - 1; i >= 0; i-- {
+		seg := picked[i]
+		dict = append(dict, samples[seg.sample][seg.start:seg.end]...)
+	}
+	if len(dict) > size {
+		dict = dict[len(dict)-size:]
+	}
+	return dict
+}
+
+type segment struct {
+	sample, start, end int
+	score              int
+}
+
+// scoreBy returns the total weight of the substrings in the segment, each counted once.
+func (s segment) scoreBy(samples [][]byte, weights map[string]int) int {
+	b := samples[s.sample][s.start:s.end]
+	var score int
+	var counted map[string]bool
+	for j := 0; j+kmerLen <= len(b); j++ {
+		k := string(b[j : j+kmerLen])
+		w := weights[k]
+		if w == 0 || counted[k] {
+			continue
+		}
+		if counted == nil {
+			counted = make(map[string]bool)
+		}
+		counted[k] = true
+		score += w
+	}
+	return score
+}
+
+// segmentHeap the max heap of the segments by score.
+type segmentHeap []segment
+
+func (h segmentHeap) Len() int            { return len(h) }
+func (h segmentHeap) Less(i, j int) bool  { return h[i].score > h[j].score }
+func (h segmentHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *segmentHeap) Push(x interface{}) { *h = append(*h, x.(segment)) }
+func (h *segmentHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
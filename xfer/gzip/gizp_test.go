@@ -36,3 +36,18 @@ func TestGzip(t *testing.T) {
 		}
 	}
 }
+
+func TestUnpackSizeLimit(t *testing.T) {
+	gzip.Reg('h', "gzip-limit", 9)
+	xferPipe := xfer.NewXferPipe()
+	xferPipe.Append('h')
+	b, err := xferPipe.OnPack(make([]byte, 1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzip.SetUnpackSizeLimit(1 << 10)
+	defer gzip.SetUnpackSizeLimit(0)
+	if _, err = xferPipe.OnUnpack(b); err != gzip.ErrExceedUnpackSizeLimit {
+		t.Fatalf("expect ErrExceedUnpackSizeLimit, got %v", err)
+	}
+}
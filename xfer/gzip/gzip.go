@@ -17,7 +17,9 @@ package gzip
 import (
 	"bytes"
 	"compress/gzip"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"sync"
 
@@ -27,6 +29,22 @@ import (
 
 var ids = map[byte]bool{}
 
+var (
+	unpackSizeLimit int64 = 1 << 30 // 1GB
+	// ErrExceedUnpackSizeLimit error
+	ErrExceedUnpackSizeLimit = errors.New("gzip: size of unpacked data exceeds limit")
+)
+
+// SetUnpackSizeLimit sets the max size of the unpacked data, against the decompression bomb.
+// If maxSize<=0, set it to 1GB.
+func SetUnpackSizeLimit(maxSize int64) {
+	if maxSize <= 0 {
+		unpackSizeLimit = 1 << 30
+	} else {
+		unpackSizeLimit = maxSize
+	}
+}
+
 // Reg registers a gzip filter for transfer.
 func Reg(id byte, name string, level int) {
 	xfer.Reg(newGzip(id, name, level))
@@ -104,7 +122,10 @@ func (g *Gzip) OnUnpack(src []byte) (dest []byte, err error) {
 	gr := g.rPool.Get().(*gzip.Reader)
 	err = gr.Reset(bytes.NewReader(src))
 	if err == nil {
-		dest, err = ioutil.ReadAll(gr)
+		dest, err = ioutil.ReadAll(io.LimitReader(gr, unpackSizeLimit+1))
+		if err == nil && int64(len(dest)) > unpackSizeLimit {
+			dest, err = nil, ErrExceedUnpackSizeLimit
+		}
 	}
 	gr.Close()
 	g.rPool.Put(gr)
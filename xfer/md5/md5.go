@@ -4,7 +4,7 @@ package md5
 import (
 	"bytes"
 	"crypto/md5"
-	"errors"
+	"fmt"
 
 	"github.com/andeya/erpc/v7/xfer"
 )
@@ -25,7 +25,7 @@ type md5Hash struct {
 
 const md5Length = 16
 
-var errDataCheck = errors.New("check failed")
+var errDataCheck = fmt.Errorf("md5: %w", xfer.ErrChecksumMismatch)
 
 // ID returns transfer filter id.
 func (m *md5Hash) ID() byte {
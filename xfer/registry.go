@@ -0,0 +1,86 @@
+// Copyright 2015-2019 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xfer
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Registry the scoped transfer filters, e.g. of a peer, with the global ones registered by Reg as the fallback,
+// so that the filters of the same id in the different scopes do not clobber each other.
+// NOTE:
+//  The nil *Registry is the global one;
+//  Concurrent safe.
+type Registry struct {
+	mu      sync.RWMutex
+	idMap   map[byte]XferFilter
+	nameMap map[string]XferFilter
+}
+
+// NewRegistry creates a new scoped transfer filter registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		idMap:   make(map[byte]XferFilter),
+		nameMap: make(map[string]XferFilter),
+	}
+}
+
+// Reg registers transfer filter to the registry, which shadows the global one of the same id or name.
+// NOTE: Panic if the id or name is registered to the registry already.
+func (r *Registry) Reg(xferFilter XferFilter) {
+	if r == nil {
+		Reg(xferFilter)
+		return
+	}
+	id := xferFilter.ID()
+	name := xferFilter.Name()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.idMap[id]; ok {
+		panic(fmt.Sprintf("multi-register transfer filter id: %d", id))
+	}
+	if _, ok := r.nameMap[name]; ok {
+		panic("multi-register transfer filter name: " + name)
+	}
+	r.idMap[id] = xferFilter
+	r.nameMap[name] = xferFilter
+}
+
+// Get returns transfer filter by id, from the registry or the global ones.
+func (r *Registry) Get(id byte) (XferFilter, error) {
+	if r != nil {
+		r.mu.RLock()
+		xferFilter, ok := r.idMap[id]
+		r.mu.RUnlock()
+		if ok {
+			return xferFilter, nil
+		}
+	}
+	return Get(id)
+}
+
+// GetByName returns transfer filter by name, from the registry or the global ones.
+func (r *Registry) GetByName(name string) (XferFilter, error) {
+	if r != nil {
+		r.mu.RLock()
+		xferFilter, ok := r.nameMap[name]
+		r.mu.RUnlock()
+		if ok {
+			return xferFilter, nil
+		}
+	}
+	return GetByName(name)
+}
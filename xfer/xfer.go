@@ -45,6 +45,10 @@ var xferFilterMap = struct {
 // ErrXferPipeTooLong error
 var ErrXferPipeTooLong = errors.New("The length of transfer pipe cannot be bigger than 255")
 
+// ErrChecksumMismatch the error of the integrity check filters, wrapped by them, e.g. md5 and crc32c,
+// the message is corrupted on the way.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
 // Reg registers transfer filter.
 func Reg(xferFilter XferFilter) {
 	id := xferFilter.ID()
@@ -80,7 +84,8 @@ func GetByName(name string) (XferFilter, error) {
 // XferPipe transfer filter pipe, handlers from outer-most to inner-most.
 // NOTE: the length can not be bigger than 255!
 type XferPipe struct {
-	filters []XferFilter
+	filters  []XferFilter
+	registry *Registry // the registry of the filters appended by id, nil means the global ones
 }
 
 // NewXferPipe creates a new transfer filter pipe.
@@ -93,10 +98,20 @@ func (x *XferPipe) Reset() {
 	x.filters = x.filters[:0]
 }
 
+// SetRegistry sets the registry of the filters appended by id, nil means the global ones.
+func (x *XferPipe) SetRegistry(registry *Registry) {
+	x.registry = registry
+}
+
+// Registry returns the registry of the filters appended by id, nil means the global ones.
+func (x *XferPipe) Registry() *Registry {
+	return x.registry
+}
+
 // Append appends transfer filter by id.
 func (x *XferPipe) Append(filterID ...byte) error {
 	for _, id := range filterID {
-		filter, err := Get(id)
+		filter, err := x.registry.Get(id)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,140 @@
+// Package xxhash provides a XXH64 integrity check transfer filter,
+// faster than crc32c on the platforms without the CRC-32C instructions.
+//
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package xxhash
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+
+	"github.com/andeya/erpc/v7/xfer"
+)
+
+// Reg registers a xxhash checker filter for transfer.
+func Reg(id byte, name string) {
+	xfer.Reg(&xxHash{
+		id:   id,
+		name: name,
+	})
+}
+
+// xxHash integrity check filter
+type xxHash struct {
+	id   byte
+	name string
+}
+
+const xxhashLength = 8
+
+var (
+	errDataCheck  = fmt.Errorf("xxhash: %w", xfer.ErrChecksumMismatch)
+	errDataLength = fmt.Errorf("xxhash: %w, the data is shorter than the checksum", xfer.ErrChecksumMismatch)
+)
+
+// ID returns transfer filter id.
+func (x *xxHash) ID() byte {
+	return x.id
+}
+
+// Name returns transfer filter name.
+func (x *xxHash) Name() string {
+	return x.name
+}
+
+// OnPack appends the checksum in big endian.
+func (x *xxHash) OnPack(src []byte) ([]byte, error) {
+	var sum [xxhashLength]byte
+	binary.BigEndian.PutUint64(sum[:], Sum64(src))
+	return append(src, sum[:]...), nil
+}
+
+// OnUnpack verifies and removes the checksum.
+func (x *xxHash) OnUnpack(src []byte) ([]byte, error) {
+	n := len(src) - xxhashLength
+	if n < 0 {
+		return nil, errDataLength
+	}
+	if Sum64(src[:n]) != binary.BigEndian.Uint64(src[n:]) {
+		return nil, errDataCheck
+	}
+	return src[:n], nil
+}
+
+// NOTE: the primes are variables to allow the wrapping arithmetic.
+var (
+	prime1 uint64 = 11400714785074694791
+	prime2 uint64 = 14029467366897019727
+	prime3 uint64 = 1609587929392839161
+	prime4 uint64 = 9650029242287828579
+	prime5 uint64 = 2870177450012600261
+)
+
+// Sum64 returns the XXH64 hash of b with the zero seed.
+func Sum64(b []byte) uint64 {
+	n := len(b)
+	var h uint64
+	if n >= 32 {
+		v1 := prime1 + prime2
+		v2 := prime2
+		v3 := uint64(0)
+		v4 := -prime1
+		for ; len(b) >= 32; b = b[32:] {
+			v1 = round(v1, binary.LittleEndian.Uint64(b[0:8]))
+			v2 = round(v2, binary.LittleEndian.Uint64(b[8:16]))
+			v3 = round(v3, binary.LittleEndian.Uint64(b[16:24]))
+			v4 = round(v4, binary.LittleEndian.Uint64(b[24:32]))
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = mergeRound(h, v1)
+		h = mergeRound(h, v2)
+		h = mergeRound(h, v3)
+		h = mergeRound(h, v4)
+	} else {
+		h = prime5
+	}
+	h += uint64(n)
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= round(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*prime1 + prime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * prime1
+		h = bits.RotateLeft64(h, 23)*prime2 + prime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * prime5
+		h = bits.RotateLeft64(h, 11) * prime1
+	}
+	h ^= h >> 33
+	h *= prime2
+	h ^= h >> 29
+	h *= prime3
+	h ^= h >> 32
+	return h
+}
+
+func round(acc, input uint64) uint64 {
+	acc += input * prime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * prime1
+}
+
+func mergeRound(acc, val uint64) uint64 {
+	acc ^= round(0, val)
+	return acc*prime1 + prime4
+}
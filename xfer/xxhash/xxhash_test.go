@@ -0,0 +1,45 @@
+package xxhash
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/andeya/erpc/v7/xfer"
+)
+
+func TestSum64(t *testing.T) {
+	cases := []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	}
+	for _, c := range cases {
+		if got := Sum64([]byte(c.in)); got != c.want {
+			t.Errorf("Sum64(%q) = %#x, want %#x", c.in, got, c.want)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	f := &xxHash{id: 'x', name: "xxhash"}
+	src := []byte(strings.Repeat("erpc", 20))
+	b, err := f.OnPack(append([]byte{}, src...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := f.OnUnpack(b); err != nil || string(data) != string(src) {
+		t.Fatalf("data: %s, err: %v", data, err)
+	}
+	b[3] ^= 1
+	if _, err = f.OnUnpack(b); !errors.Is(err, xfer.ErrChecksumMismatch) {
+		t.Fatalf("expect ErrChecksumMismatch, got %v", err)
+	}
+	if _, err = f.OnUnpack(b[:4]); !errors.Is(err, xfer.ErrChecksumMismatch) {
+		t.Fatalf("expect ErrChecksumMismatch, got %v", err)
+	}
+}